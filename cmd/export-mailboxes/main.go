@@ -0,0 +1,155 @@
+// Command export-mailboxes writes every mailbox of a domain as an mbox file or a
+// tar.gz Maildir, one file per mailbox, into an output directory.
+//
+// It reads the same environment as the server (DATABASE_URL, storage and
+// encryption settings), so encrypted attachments and bodies are exported in plaintext.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/config"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/validator"
+)
+
+// exportReport summarizes a domain export
+type exportReport struct {
+	Domain    string   `json:"domain"`
+	Format    string   `json:"format"`
+	Mailboxes int      `json:"mailboxes"`
+	Messages  int      `json:"messages"`
+	Files     []string `json:"files"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+func main() {
+	domainName := flag.String("domain", "", "domain whose mailboxes are exported (required)")
+	formatName := flag.String("format", "mbox", "export format: mbox or maildir")
+	outDir := flag.String("out", ".", "directory the export files are written to")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	if *domainName == "" {
+		logger.Error("-domain is required")
+		os.Exit(2)
+	}
+	format, err := services.ParseExportFormat(*formatName)
+	if err != nil {
+		logger.Error("invalid -format", slog.Any("error", err))
+		os.Exit(2)
+	}
+	if err := os.MkdirAll(*outDir, 0o700); err != nil {
+		logger.Error("failed to create output directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("failed to load configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("failed to connect to database", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer database.Close(db)
+
+	// Encrypted bodies and files are decrypted; nothing is written back
+	keyring, err := encryption.LoadKeyring(cfg.EncryptionKey, cfg.EncryptionKeyFile)
+	if err != nil {
+		logger.Error("failed to load encryption keys", slog.Any("error", err))
+		os.Exit(1)
+	}
+	encryption.ConfigureColumns(keyring, false)
+
+	fileStorage, err := storage.NewFromConfig(cfg)
+	if err != nil {
+		logger.Error("failed to initialize file storage", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if keyring != nil {
+		fileStorage = storage.NewEncryptedStorage(fileStorage, keyring, repository.NewDataKeyRepository(db))
+	}
+
+	ctx := context.Background()
+	domain, err := repository.NewDomainRepository(db).GetByName(ctx, *domainName)
+	if err != nil {
+		logger.Error("failed to find domain", slog.String("domain", *domainName), slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	exporter := services.NewMailboxExporter(repository.NewMessageRepository(db), fileStorage)
+	mailboxRepo := repository.NewMailboxRepository(db)
+	report := &exportReport{Domain: domain.Name, Format: string(format), Files: []string{}}
+
+	const pageSize = 100
+	for offset := 0; ; offset += pageSize {
+		mailboxes, _, err := mailboxRepo.ListByDomain(ctx, domain.ID, pageSize, offset)
+		if err != nil {
+			logger.Error("failed to list mailboxes", slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		for _, mailbox := range mailboxes {
+			path := filepath.Join(*outDir, validator.SanitizeFilename(format.Filename(&mailbox.Mailbox)))
+			count, err := exportMailbox(ctx, exporter, &mailbox.Mailbox, format, path)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", mailbox.FullAddress, err))
+				logger.Error("failed to export mailbox",
+					slog.String("mailbox", mailbox.FullAddress),
+					slog.Any("error", err))
+				continue
+			}
+			report.Mailboxes++
+			report.Messages += count
+			report.Files = append(report.Files, path)
+		}
+
+		if len(mailboxes) < pageSize {
+			break
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// exportMailbox writes one mailbox to a new file at path
+func exportMailbox(
+	ctx context.Context,
+	exporter *services.MailboxExporter,
+	mailbox *models.Mailbox,
+	format services.ExportFormat,
+	path string,
+) (int, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := exporter.Export(ctx, file, mailbox, format)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
@@ -0,0 +1,76 @@
+// Command migrate-storage moves attachment files stored under per-upload paths
+// into content-addressed blobs, so identical attachments share one file.
+//
+// It reads the same environment as the server (DATABASE_URL, ATTACHMENT_STORAGE_PATH).
+// Stop the server before running it: reference counts are only coordinated within one process.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/config"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without changing anything")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("failed to load configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	if cfg.StorageBackend == "s3" {
+		logger.Error("content-addressed migration only applies to local storage (STORAGE_BACKEND=local)")
+		os.Exit(1)
+	}
+
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("failed to connect to database", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer database.Close(db)
+
+	if err := database.Migrate(db); err != nil {
+		logger.Error("failed to run migrations", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	fileStorage, err := storage.NewContentAddressedStorage(cfg.AttachmentStoragePath)
+	if err != nil {
+		logger.Error("failed to initialize file storage", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	report, err := services.MigrateToContentAddressed(
+		context.Background(),
+		repository.NewAttachmentRepository(db, fileStorage),
+		fileStorage,
+		*dryRun,
+		logger,
+	)
+	if err != nil {
+		logger.Error("storage migration failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
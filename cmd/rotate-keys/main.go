@@ -0,0 +1,77 @@
+// Command rotate-keys re-wraps encryption data keys with the primary master key.
+//
+// It reads the same environment as the server (DATABASE_URL, ENCRYPTION_KEY or
+// ENCRYPTION_KEY_FILE). Put the new master key first in the key file and keep
+// the previous keys below it; once a run reports no errors the old keys can be
+// removed. Stored files and body ciphertexts are not rewritten.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/config"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be re-wrapped without changing anything")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Error("failed to load configuration", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	keyring, err := encryption.LoadKeyring(cfg.EncryptionKey, cfg.EncryptionKeyFile)
+	if err != nil {
+		logger.Error("failed to load encryption keys", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if keyring == nil {
+		logger.Error("encryption is not configured (set ENCRYPTION_KEY or ENCRYPTION_KEY_FILE)")
+		os.Exit(1)
+	}
+
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("failed to connect to database", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer database.Close(db)
+
+	if err := database.Migrate(db); err != nil {
+		logger.Error("failed to run migrations", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	report, err := services.RotateEncryptionKeys(
+		context.Background(),
+		repository.NewDataKeyRepository(db),
+		repository.NewMessageRepository(db),
+		keyring,
+		*dryRun,
+		logger,
+	)
+	if err != nil {
+		logger.Error("key rotation failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(report)
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
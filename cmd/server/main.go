@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,11 +12,17 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/labstack/echo/v4"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/handlers"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/config"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
-	seclogger "github.com/welldanyogia/webrana-infinimail-backend/internal/logger"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imap"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/jmap"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/notify"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/pop3"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/smtp"
@@ -70,26 +77,60 @@ func main() {
 	}
 	logger.Info("database migrations completed")
 
+	// Load encryption keys; keyring is nil when encryption at rest is disabled
+	keyring, err := encryption.LoadKeyring(cfg.EncryptionKey, cfg.EncryptionKeyFile)
+	if err != nil {
+		logger.Error("failed to load encryption keys", slog.Any("error", err))
+		os.Exit(1)
+	}
+	encryption.ConfigureColumns(keyring, cfg.EncryptMessageBodies)
+	repository.ConfigureSearch(cfg.SearchEncryptedBodies)
+
 	// Initialize file storage
-	fileStorage, err := storage.NewLocalStorage(cfg.AttachmentStoragePath)
+	fileStorage, err := storage.NewFromConfig(cfg)
 	if err != nil {
 		logger.Error("failed to initialize file storage", slog.Any("error", err))
 		os.Exit(1)
 	}
+	if keyring != nil {
+		fileStorage = storage.NewEncryptedStorage(fileStorage, keyring, repository.NewDataKeyRepository(db))
+		logger.Info("encryption at rest enabled",
+			slog.String("primary_key_id", keyring.PrimaryKeyID()),
+			slog.Bool("message_bodies", cfg.EncryptMessageBodies))
+	}
+
+	// Initialize image proxy for remote images in rendered messages
+	imageProxy, err := newImageProxy(cfg, logger)
+	if err != nil {
+		logger.Error("failed to initialize image proxy", slog.Any("error", err))
+		os.Exit(1)
+	}
 
-	// Initialize WebSocket hub
+	// Initialize WebSocket hub and the tickets that authorize browser connections
 	wsHub := ws.NewHub(logger)
+	if cfg.EventBackend == "postgres" {
+		// Clients get the events of every instance sharing the database
+		wsHub.SetBackend(ws.NewPostgresBackend(db, cfg.DatabaseURL, ws.DefaultNotifyChannel))
+	}
 	go wsHub.Run()
-
-	// Initialize security logger
-	securityLogger := seclogger.NewSecurityLogger()
+	wsTickets, err := newTicketIssuer(cfg, logger)
+	if err != nil {
+		logger.Error("failed to initialize websocket tickets", slog.Any("error", err))
+		os.Exit(1)
+	}
 
 	// Initialize repositories
-	domainRepo := repository.NewDomainRepository(db)
-	mailboxRepo := repository.NewMailboxRepository(db)
-	messageRepo := repository.NewMessageRepository(db)
+	domainRepo := repository.NewDomainRepositoryWithStorage(db, fileStorage)
+	mailboxRepo := repository.NewMailboxRepositoryWithStorage(db, fileStorage)
+	messageRepo := repository.NewMessageRepositoryWithStorage(db, fileStorage)
 	attachmentRepo := repository.NewAttachmentRepository(db, fileStorage)
 
+	// Publish repository changes as WebSocket events, also to domain subscribers
+	wsHub.SetDomainResolver(notify.MailboxDomains(mailboxRepo))
+	domainRepo = notify.NewDomainRepository(domainRepo, wsHub)
+	mailboxRepo = notify.NewMailboxRepository(mailboxRepo, wsHub)
+	messageRepo = notify.NewMessageRepository(messageRepo, wsHub)
+
 	// Parse allowed origins for CORS and WebSocket
 	var allowedOrigins []string
 	if origins := os.Getenv("ALLOWED_ORIGINS"); origins != "" {
@@ -114,8 +155,8 @@ func main() {
 
 	// Initialize certificate store for SNI support
 	var certStore services.CertificateStore
-	certRepo := repository.NewCertificateRepository(db)
-	
+	certRepo := notify.NewCertificateRepository(repository.NewCertificateRepository(db), wsHub)
+
 	// Create certificate storage
 	certStorage, err := services.NewCertStorage(services.CertStorageConfig{
 		BasePath: cfg.CertStoragePath,
@@ -138,7 +179,7 @@ func main() {
 			} else {
 				logger.Info("certificate store initialized", slog.Int("certificates_loaded", certStore.Count()))
 			}
-			
+
 			// Set the GetCertificate function for SNI support
 			smtpConfig.GetCertificate = certStore.GetCertificateFunc()
 		}
@@ -154,11 +195,11 @@ func main() {
 
 	// DNS Verifier Service
 	dnsVerifierConfig := services.DNSVerifierConfig{
-		SMTPHostname:   cfg.SMTPHostname,
-		ServerIP:       cfg.ServerIP,
-		MaxRetries:     3,
-		RetryDelay:     5 * time.Second,
-		LookupTimeout:  10 * time.Second,
+		SMTPHostname:  cfg.SMTPHostname,
+		ServerIP:      cfg.ServerIP,
+		MaxRetries:    3,
+		RetryDelay:    5 * time.Second,
+		LookupTimeout: 10 * time.Second,
 	}
 	dnsVerifier := services.NewDNSVerifierService(domainRepo, dnsVerifierConfig)
 
@@ -221,6 +262,136 @@ func main() {
 			slog.Int("renewal_days", cfg.CertRenewalDays))
 	}
 
+	// Initialize Retention Service (message and mailbox expiry background job)
+	retentionInterval, err := time.ParseDuration(cfg.RetentionCheckInterval)
+	if err != nil {
+		logger.Warn("invalid RETENTION_CHECK_INTERVAL, using default 1h",
+			slog.String("value", cfg.RetentionCheckInterval),
+			slog.Any("error", err))
+		retentionInterval = time.Hour
+	}
+	retentionService := services.NewRetentionService(
+		domainRepo,
+		mailboxRepo,
+		messageRepo,
+		fileStorage,
+		services.RetentionConfig{
+			CheckInterval:         retentionInterval,
+			MessageRetentionHours: cfg.RetentionMessageHours,
+			MailboxRetentionDays:  cfg.RetentionMailboxDays,
+			DryRun:                cfg.RetentionDryRun,
+		},
+		logger,
+	)
+	retentionService.Start()
+
+	// Initialize Storage Reconciler (orphaned file / missing file cleanup)
+	reconcileInterval, err := time.ParseDuration(cfg.StorageReconcileInterval)
+	if err != nil {
+		logger.Warn("invalid STORAGE_RECONCILE_INTERVAL, using default 24h",
+			slog.String("value", cfg.StorageReconcileInterval),
+			slog.Any("error", err))
+		reconcileInterval = 24 * time.Hour
+	}
+	reconcileMinAge, err := time.ParseDuration(cfg.StorageReconcileMinAge)
+	if err != nil {
+		logger.Warn("invalid STORAGE_RECONCILE_MIN_AGE, using default 1h",
+			slog.String("value", cfg.StorageReconcileMinAge),
+			slog.Any("error", err))
+		reconcileMinAge = time.Hour
+	}
+	storageReconciler := services.NewStorageReconciler(
+		attachmentRepo,
+		messageRepo,
+		fileStorage,
+		services.ReconcileConfig{
+			CheckInterval: reconcileInterval,
+			MinAge:        reconcileMinAge,
+			DryRun:        cfg.StorageReconcileDryRun,
+		},
+		logger,
+	)
+	storageReconciler.Start()
+
+	// Index messages stored before full-text search existed
+	indexCtx, stopIndexing := context.WithCancel(context.Background())
+	go indexSearchBacklog(indexCtx, messageRepo, logger)
+
+	// Initialize IMAP and POP3 servers for mail clients (disabled unless a port is set);
+	// their credentials are also used by JMAP
+	var mailAuth *mailauth.Authenticator
+	if cfg.IMAPEnabled() || cfg.POP3Enabled() || cfg.JMAPEnabled {
+		mailAuth, err = newMailAuthenticator(cfg, logger)
+		if err != nil {
+			logger.Error("failed to initialize mail access credentials", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+	folderRepo := repository.NewFolderRepository(db)
+
+	var imapServer *imap.Server
+	if cfg.IMAPEnabled() {
+		imapBackend := imap.NewBackend(&imap.BackendConfig{
+			MailboxRepo: mailboxRepo,
+			MessageRepo: messageRepo,
+			FolderRepo:  folderRepo,
+			FileStorage: fileStorage,
+			Deliverer:   smtpBackend,
+			Auth:        mailAuth,
+			Logger:      logger,
+		})
+		imapConfig := imap.LoadServerConfigFromEnv()
+		if cfg.IMAPPort != 0 {
+			imapConfig.Addr = fmt.Sprintf(":%d", cfg.IMAPPort)
+		}
+		if cfg.IMAPSPort != 0 {
+			imapConfig.TLSAddr = fmt.Sprintf(":%d", cfg.IMAPSPort)
+		}
+		if certStore != nil {
+			imapConfig.GetCertificate = certStore.GetCertificateFunc()
+		}
+		imapServer = imap.NewServer(imapBackend, imapConfig)
+	}
+
+	var pop3Server *pop3.Server
+	if cfg.POP3Enabled() {
+		pop3Backend := pop3.NewBackend(&pop3.BackendConfig{
+			MailboxRepo: mailboxRepo,
+			MessageRepo: messageRepo,
+			FolderRepo:  folderRepo,
+			FileStorage: fileStorage,
+			Auth:        mailAuth,
+			Logger:      logger,
+		})
+		pop3Config := pop3.LoadServerConfigFromEnv()
+		pop3Config.Hostname = cfg.SMTPHostname
+		if cfg.POP3Port != 0 {
+			pop3Config.Addr = fmt.Sprintf(":%d", cfg.POP3Port)
+		}
+		if cfg.POP3SPort != 0 {
+			pop3Config.TLSAddr = fmt.Sprintf(":%d", cfg.POP3SPort)
+		}
+		if certStore != nil {
+			pop3Config.GetCertificate = certStore.GetCertificateFunc()
+		}
+		pop3Server = pop3.NewServer(pop3Backend, pop3Config)
+	}
+
+	// JMAP is served by the HTTP router and syncs clients from the message change log
+	var jmapServer *jmap.Server
+	pruneCtx, stopPruning := context.WithCancel(context.Background())
+	if cfg.JMAPEnabled {
+		messageChangeRepo := repository.NewMessageChangeRepository(db)
+		jmapServer = jmap.NewServer(&jmap.ServerConfig{
+			MessageRepo: messageRepo,
+			FolderRepo:  folderRepo,
+			ChangeRepo:  messageChangeRepo,
+			FileStorage: fileStorage,
+			Logger:      logger,
+		})
+		go pruneMessageChanges(pruneCtx, messageChangeRepo, logger)
+	}
+
 	// Initialize HTTP router with security configuration
 	router := api.NewRouter(&api.RouterConfig{
 		DB:             db,
@@ -232,30 +403,27 @@ func main() {
 		RateBurst:      cfg.RateLimitBurst,
 		EnableAuth:     cfg.APIKey != "",
 		// SSL Domain Setup services
-		DomainManager:  domainManager,
-		DNSVerifier:    dnsVerifier,
-		DNSExporter:    dnsExporter,
-		CertManager:    certManager,
-	})
-
-	// Create secure WebSocket upgrader
-	upgrader := ws.NewSecureUpgrader(logger)
-
-	router.GET("/ws", func(c echo.Context) error {
-		conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
-		if err != nil {
-			securityLogger.SuspiciousActivity(c.RealIP(), "/ws", "websocket_upgrade_failed")
-			logger.Error("websocket upgrade failed", slog.Any("error", err))
-			return err
-		}
-
-		client := ws.NewClient(wsHub, conn, logger)
-		wsHub.Register(client)
-
-		go client.WritePump()
-		go client.ReadPump()
-
-		return nil
+		DomainManager:     domainManager,
+		DNSVerifier:       dnsVerifier,
+		DNSExporter:       dnsExporter,
+		CertManager:       certManager,
+		Retention:         retentionService,
+		StorageReconciler: storageReconciler,
+		ImageProxy:        imageProxy,
+		Importer:          services.NewMailboxImporter(smtpBackend),
+		BulkNotifier:      wsHub,
+		EventHub:          wsHub,
+		WSTickets:         wsTickets,
+		MailAuth:          mailAuth,
+		MailAccessServers: handlers.MailAccessServers{
+			Host:      cfg.SMTPHostname,
+			IMAPPort:  cfg.IMAPPort,
+			IMAPSPort: cfg.IMAPSPort,
+			POP3Port:  cfg.POP3Port,
+			POP3SPort: cfg.POP3SPort,
+		},
+		JMAP:        jmapServer,
+		JMAPBaseURL: cfg.PublicBaseURL,
 	})
 
 	smtpServer := smtp.NewSecureServer(smtpBackend, smtpConfig)
@@ -267,7 +435,7 @@ func main() {
 		slog.Bool("sni_enabled", certStore != nil))
 
 	// Start servers
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 4)
 
 	// Start HTTP server
 	go func() {
@@ -286,6 +454,30 @@ func main() {
 		}
 	}()
 
+	// Start IMAP server
+	if imapServer != nil {
+		go func() {
+			logger.Info("starting IMAP server",
+				slog.Int("imap_port", cfg.IMAPPort),
+				slog.Int("imaps_port", cfg.IMAPSPort))
+			if err := imapServer.ListenAndServe(); err != nil {
+				errChan <- fmt.Errorf("IMAP server error: %w", err)
+			}
+		}()
+	}
+
+	// Start POP3 server
+	if pop3Server != nil {
+		go func() {
+			logger.Info("starting POP3 server",
+				slog.Int("pop3_port", cfg.POP3Port),
+				slog.Int("pop3s_port", cfg.POP3SPort))
+			if err := pop3Server.ListenAndServe(); err != nil {
+				errChan <- fmt.Errorf("POP3 server error: %w", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -308,6 +500,16 @@ func main() {
 		certRenewalService.Stop()
 	}
 
+	// Stop retention service
+	retentionService.Stop()
+
+	// Stop storage reconciler
+	storageReconciler.Stop()
+
+	// Stop search backfill
+	stopIndexing()
+	stopPruning()
+
 	// Shutdown HTTP server
 	if err := router.Shutdown(ctx); err != nil {
 		logger.Error("HTTP server shutdown error", slog.Any("error", err))
@@ -318,6 +520,20 @@ func main() {
 		logger.Error("SMTP server shutdown error", slog.Any("error", err))
 	}
 
+	// Shutdown IMAP server
+	if imapServer != nil {
+		if err := imapServer.Close(); err != nil {
+			logger.Error("IMAP server shutdown error", slog.Any("error", err))
+		}
+	}
+
+	// Shutdown POP3 server
+	if pop3Server != nil {
+		if err := pop3Server.Close(); err != nil {
+			logger.Error("POP3 server shutdown error", slog.Any("error", err))
+		}
+	}
+
 	// Close database connection
 	sqlDB, _ := db.DB()
 	if sqlDB != nil {
@@ -326,3 +542,95 @@ func main() {
 
 	logger.Info("servers stopped")
 }
+
+// indexSearchBacklog adds messages missing from the search index in batches until none are left
+func indexSearchBacklog(ctx context.Context, messageRepo repository.MessageRepository, logger *slog.Logger) {
+	const batchSize = 200
+	total := 0
+	for ctx.Err() == nil {
+		indexed, err := messageRepo.IndexUnindexed(ctx, batchSize)
+		total += indexed
+		if err != nil {
+			logger.Error("failed to index messages for search", slog.Any("error", err))
+			return
+		}
+		if indexed < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Info("indexed messages for search", slog.Int("messages", total))
+	}
+}
+
+// pruneMessageChanges removes old entries of the message change log every hour.
+// Clients that last synced before the oldest kept change refetch everything.
+func pruneMessageChanges(ctx context.Context, changeRepo repository.MessageChangeRepository, logger *slog.Logger) {
+	const retention = 7 * 24 * time.Hour
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		deleted, err := changeRepo.DeleteBefore(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logger.Error("failed to prune message changes", slog.Any("error", err))
+		} else if deleted > 0 {
+			logger.Info("pruned message changes", slog.Int64("changes", deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newImageProxy creates the image proxy; without IMAGE_PROXY_SECRET a random
+// secret is used, so proxy URLs stop working when the process restarts
+func newImageProxy(cfg *config.Config, logger *slog.Logger) (*imageproxy.Proxy, error) {
+	secret := []byte(cfg.ImageProxySecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate image proxy secret: %w", err)
+		}
+		logger.Warn("IMAGE_PROXY_SECRET not set, using a random secret; proxied image URLs will not survive restarts")
+	}
+
+	return imageproxy.New(imageproxy.Config{
+		Secret:  secret,
+		BaseURL: cfg.PublicBaseURL,
+	})
+}
+
+// newTicketIssuer creates the issuer of WebSocket tickets; without
+// WS_TICKET_SECRET a random secret is used, so tickets only work on the instance
+// that issued them
+func newTicketIssuer(cfg *config.Config, logger *slog.Logger) (*ws.TicketIssuer, error) {
+	secret := []byte(cfg.WSTicketSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate websocket ticket secret: %w", err)
+		}
+		logger.Warn("WS_TICKET_SECRET not set, using a random secret; websocket tickets are only valid on this instance")
+	}
+
+	return ws.NewTicketIssuer(secret, ws.DefaultTicketTTL)
+}
+
+// newMailAuthenticator creates the authenticator for mail client logins; without
+// MAIL_ACCESS_SECRET a random secret is used, so passwords change on restart.
+// The API key is accepted as a password for every mailbox.
+func newMailAuthenticator(cfg *config.Config, logger *slog.Logger) (*mailauth.Authenticator, error) {
+	secret := []byte(cfg.MailAccessSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, mailauth.MinSecretLength)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate mail access secret: %w", err)
+		}
+		logger.Warn("MAIL_ACCESS_SECRET not set, using a random secret; mail client passwords will not survive restarts")
+	}
+
+	return mailauth.New(secret, cfg.APIKey)
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/validator"
+)
+
+// dateLayout is the date-only form accepted by the from and to query parameters
+const dateLayout = "2006-01-02"
+
+// ArchiveHandler serves attachments bundled into archives and mailbox exports
+type ArchiveHandler struct {
+	attachmentRepo repository.AttachmentRepository
+	messageRepo    repository.MessageRepository
+	mailboxRepo    repository.MailboxRepository
+	fileStorage    storage.FileStorage
+	exporter       *services.MailboxExporter
+}
+
+// NewArchiveHandler creates a new ArchiveHandler
+func NewArchiveHandler(
+	attachmentRepo repository.AttachmentRepository,
+	messageRepo repository.MessageRepository,
+	mailboxRepo repository.MailboxRepository,
+	fileStorage storage.FileStorage,
+) *ArchiveHandler {
+	return &ArchiveHandler{
+		attachmentRepo: attachmentRepo,
+		messageRepo:    messageRepo,
+		mailboxRepo:    mailboxRepo,
+		fileStorage:    fileStorage,
+		exporter:       services.NewMailboxExporter(messageRepo, fileStorage),
+	}
+}
+
+// archiveEntry is one file of a ZIP archive
+type archiveEntry struct {
+	name     string
+	filePath string
+	modified time.Time
+}
+
+// MessageAttachments handles GET /api/messages/:id/attachments.zip
+// Streams all attachments of a message as a ZIP archive.
+func (h *ArchiveHandler) MessageAttachments(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid message ID")
+	}
+
+	ctx := c.Request().Context()
+	message, err := h.messageRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "message not found")
+		}
+		return response.InternalError(c, "failed to get message")
+	}
+
+	attachments, err := h.attachmentRepo.ListByMessage(ctx, message.ID)
+	if err != nil {
+		return response.InternalError(c, "failed to list attachments")
+	}
+	if len(attachments) == 0 {
+		return response.NotFound(c, "message has no attachments")
+	}
+
+	names := make(map[string]int)
+	entries := make([]archiveEntry, 0, len(attachments))
+	for _, attachment := range attachments {
+		entries = append(entries, archiveEntry{
+			name:     uniqueFilename(names, validator.SanitizeFilename(attachment.Filename)),
+			filePath: attachment.FilePath,
+			modified: message.ReceivedAt,
+		})
+	}
+
+	return h.streamZip(c, fmt.Sprintf("message-%d-attachments.zip", message.ID), entries)
+}
+
+// MailboxAttachments handles GET /api/mailboxes/:id/attachments.zip?from=&to=
+// Streams the attachments of all messages received in [from, to) as a ZIP archive,
+// with one folder per message. from and to accept RFC 3339 timestamps or dates;
+// a date in to includes that whole day.
+func (h *ArchiveHandler) MailboxAttachments(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	from, err := parseRangeTime(c.QueryParam("from"), false)
+	if err != nil {
+		return response.BadRequest(c, "from must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	to, err := parseRangeTime(c.QueryParam("to"), true)
+	if err != nil {
+		return response.BadRequest(c, "to must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return response.BadRequest(c, "from must be before to")
+	}
+
+	ctx := c.Request().Context()
+	mailbox, err := h.mailboxRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	attachments, err := h.attachmentRepo.ListByMailbox(ctx, mailbox.ID, from, to)
+	if err != nil {
+		return response.InternalError(c, "failed to list attachments")
+	}
+	if len(attachments) == 0 {
+		return response.NotFound(c, "no attachments found")
+	}
+
+	// Filenames are unique per message folder
+	folders := make(map[uint]map[string]int)
+	entries := make([]archiveEntry, 0, len(attachments))
+	for _, attachment := range attachments {
+		names, ok := folders[attachment.MessageID]
+		if !ok {
+			names = make(map[string]int)
+			folders[attachment.MessageID] = names
+		}
+		folder := fmt.Sprintf("%s_%d", attachment.ReceivedAt.UTC().Format("2006-01-02_150405"), attachment.MessageID)
+		entries = append(entries, archiveEntry{
+			name:     folder + "/" + uniqueFilename(names, validator.SanitizeFilename(attachment.Filename)),
+			filePath: attachment.FilePath,
+			modified: attachment.ReceivedAt,
+		})
+	}
+
+	filename := validator.SanitizeFilename(mailbox.FullAddress) + "-attachments.zip"
+	return h.streamZip(c, filename, entries)
+}
+
+// ExportMailbox handles GET /api/mailboxes/:id/export?format=mbox|maildir
+// Streams every message of the mailbox as an mboxrd file or a tar.gz Maildir.
+func (h *ArchiveHandler) ExportMailbox(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	format, err := services.ParseExportFormat(c.QueryParam("format"))
+	if err != nil {
+		return response.BadRequest(c, "format must be mbox or maildir")
+	}
+
+	ctx := c.Request().Context()
+	mailbox, err := h.mailboxRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, format.ContentType())
+	header.Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s"`, validator.SanitizeFilename(format.Filename(mailbox))))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure can only cut the stream short
+	_, err = h.exporter.Export(ctx, c.Response(), mailbox, format)
+	return err
+}
+
+// missingListName is the archive entry listing files that were skipped
+const missingListName = "MISSING.txt"
+
+// streamZip writes entries as a ZIP archive straight from storage to the response.
+// Once the first byte is sent the status can no longer change, so files missing
+// from storage are skipped and listed in MISSING.txt, while any other error
+// aborts the response and leaves the client with a truncated archive.
+func (h *ArchiveHandler) streamZip(c echo.Context, filename string, entries []archiveEntry) error {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "application/zip")
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(c.Response())
+	var missing []string
+	for _, entry := range entries {
+		err := h.writeZipEntry(zw, entry)
+		if errors.Is(err, storage.ErrFileNotFound) {
+			missing = append(missing, entry.name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		if err := writeMissingList(zw, entries, missing); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeZipEntry copies one stored file into the archive
+func (h *ArchiveHandler) writeZipEntry(zw *zip.Writer, entry archiveEntry) error {
+	file, err := h.fileStorage.Get(entry.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.name,
+		Method:   zip.Deflate,
+		Modified: entry.modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// writeMissingList adds an entry naming the files that were not found in storage
+func writeMissingList(zw *zip.Writer, entries []archiveEntry, missing []string) error {
+	// An attachment may itself be called MISSING.txt
+	names := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		names[strings.ToLower(entry.name)] = 1
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     uniqueFilename(names, missingListName),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "These attachments could not be found in storage:\n\n"+strings.Join(missing, "\n")+"\n")
+	return err
+}
+
+// uniqueFilename returns name, or name with a " (n)" suffix before its extension
+// when it was already used; names differing only in case count as equal
+func uniqueFilename(used map[string]int, name string) string {
+	key := strings.ToLower(name)
+	used[key]++
+	if used[key] == 1 {
+		return name
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := used[key]; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if used[strings.ToLower(candidate)] == 0 {
+			used[strings.ToLower(candidate)] = 1
+			used[key] = n
+			return candidate
+		}
+	}
+}
+
+// parseRangeTime parses an RFC 3339 timestamp or a date; a date used as the
+// end of a range is moved to the start of the next day so the day is included
+func parseRangeTime(v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
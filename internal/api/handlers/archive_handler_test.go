@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// ArchiveHandlerTestSuite is the test suite for ArchiveHandler
+type ArchiveHandlerTestSuite struct {
+	suite.Suite
+	echo               *echo.Echo
+	handler            *ArchiveHandler
+	mockAttachmentRepo *mocks.MockAttachmentRepository
+	mockMessageRepo    *mocks.MockMessageRepository
+	mockMailboxRepo    *mocks.MockMailboxRepository
+	mockFileStorage    *mocks.MockFileStorage
+}
+
+// SetupTest runs before each test
+func (s *ArchiveHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockAttachmentRepo = new(mocks.MockAttachmentRepository)
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockFileStorage = new(mocks.MockFileStorage)
+	s.handler = NewArchiveHandler(s.mockAttachmentRepo, s.mockMessageRepo, s.mockMailboxRepo, s.mockFileStorage)
+}
+
+// TearDownTest runs after each test
+func (s *ArchiveHandlerTestSuite) TearDownTest() {
+	s.mockAttachmentRepo.AssertExpectations(s.T())
+	s.mockMessageRepo.AssertExpectations(s.T())
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockFileStorage.AssertExpectations(s.T())
+}
+
+// TestArchiveHandlerTestSuite runs the test suite
+func TestArchiveHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ArchiveHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *ArchiveHandlerTestSuite) createContext(target, id string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+// Helper function to read a ZIP response into a map of file name to content
+func (s *ArchiveHandlerTestSuite) readZip(body []byte) (map[string]string, []string) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	s.Require().NoError(err)
+
+	files := make(map[string]string)
+	var names []string
+	for _, f := range zr.File {
+		r, err := f.Open()
+		s.Require().NoError(err)
+		content, err := io.ReadAll(r)
+		r.Close()
+		s.Require().NoError(err)
+		files[f.Name] = string(content)
+		names = append(names, f.Name)
+	}
+	return files, names
+}
+
+// ==================== Message Archive Tests ====================
+
+// TestMessageAttachments_Success tests streaming all attachments of a message
+func (s *ArchiveHandlerTestSuite) TestMessageAttachments_Success() {
+	// Arrange
+	c, rec := s.createContext("/api/messages/1/attachments.zip", "1")
+	message := &models.Message{ID: 1, MailboxID: 1, ReceivedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	attachments := []models.Attachment{
+		{ID: 1, MessageID: 1, Filename: "report.pdf", FilePath: "/a/1"},
+		{ID: 2, MessageID: 1, Filename: "Report.pdf", FilePath: "/a/2"},
+		{ID: 3, MessageID: 1, Filename: "../../etc/passwd", FilePath: "/a/3"},
+	}
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+	s.mockAttachmentRepo.On("ListByMessage", mock.Anything, uint(1)).Return(attachments, nil)
+	s.mockFileStorage.On("Get", "/a/1").Return(newMockReadCloser([]byte("one")), nil)
+	s.mockFileStorage.On("Get", "/a/2").Return(newMockReadCloser([]byte("two")), nil)
+	s.mockFileStorage.On("Get", "/a/3").Return(newMockReadCloser([]byte("three")), nil)
+
+	// Act
+	err := s.handler.MessageAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("application/zip", rec.Header().Get(echo.HeaderContentType))
+	s.Equal(`attachment; filename="message-1-attachments.zip"`, rec.Header().Get(echo.HeaderContentDisposition))
+
+	files, names := s.readZip(rec.Body.Bytes())
+	s.Equal([]string{"report.pdf", "Report (2).pdf", "____etc_passwd"}, names)
+	s.Equal("one", files["report.pdf"])
+	s.Equal("two", files["Report (2).pdf"])
+}
+
+// TestMessageAttachments_SkipsMissingFiles tests that unreadable files do not break the archive
+func (s *ArchiveHandlerTestSuite) TestMessageAttachments_SkipsMissingFiles() {
+	// Arrange
+	c, rec := s.createContext("/api/messages/1/attachments.zip", "1")
+	attachments := []models.Attachment{
+		{ID: 1, MessageID: 1, Filename: "gone.pdf", FilePath: "/a/1"},
+		{ID: 2, MessageID: 1, Filename: "kept.pdf", FilePath: "/a/2"},
+	}
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Message{ID: 1}, nil)
+	s.mockAttachmentRepo.On("ListByMessage", mock.Anything, uint(1)).Return(attachments, nil)
+	s.mockFileStorage.On("Get", "/a/1").Return(nil, storage.ErrFileNotFound)
+	s.mockFileStorage.On("Get", "/a/2").Return(newMockReadCloser([]byte("kept")), nil)
+
+	// Act
+	err := s.handler.MessageAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	files, names := s.readZip(rec.Body.Bytes())
+	s.Equal([]string{"kept.pdf", "MISSING.txt"}, names)
+	s.Contains(files["MISSING.txt"], "\ngone.pdf\n")
+	s.NotContains(files["MISSING.txt"], "kept.pdf")
+}
+
+// TestMessageAttachments_StorageError tests that storage failures other than missing files abort the archive
+func (s *ArchiveHandlerTestSuite) TestMessageAttachments_StorageError() {
+	// Arrange
+	c, rec := s.createContext("/api/messages/1/attachments.zip", "1")
+	attachments := []models.Attachment{
+		{ID: 1, MessageID: 1, Filename: "first.pdf", FilePath: "/a/1"},
+		{ID: 2, MessageID: 1, Filename: "second.pdf", FilePath: "/a/2"},
+	}
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Message{ID: 1}, nil)
+	s.mockAttachmentRepo.On("ListByMessage", mock.Anything, uint(1)).Return(attachments, nil)
+	s.mockFileStorage.On("Get", "/a/1").Return(nil, errors.New("connection reset"))
+
+	// Act
+	err := s.handler.MessageAttachments(c)
+
+	// Assert
+	s.Error(err)
+	_, err = zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	s.Error(err, "the archive must not look complete")
+}
+
+// TestMessageAttachments_NoAttachments tests a message without attachments
+func (s *ArchiveHandlerTestSuite) TestMessageAttachments_NoAttachments() {
+	// Arrange
+	c, rec := s.createContext("/api/messages/1/attachments.zip", "1")
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Message{ID: 1}, nil)
+	s.mockAttachmentRepo.On("ListByMessage", mock.Anything, uint(1)).Return([]models.Attachment{}, nil)
+
+	// Act
+	err := s.handler.MessageAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestMessageAttachments_MessageNotFound tests a non-existent message
+func (s *ArchiveHandlerTestSuite) TestMessageAttachments_MessageNotFound() {
+	// Arrange
+	c, rec := s.createContext("/api/messages/999/attachments.zip", "999")
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(999)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.MessageAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestMessageAttachments_InvalidID tests an invalid message ID
+func (s *ArchiveHandlerTestSuite) TestMessageAttachments_InvalidID() {
+	// Arrange
+	c, rec := s.createContext("/api/messages/abc/attachments.zip", "abc")
+
+	// Act
+	err := s.handler.MessageAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// ==================== Mailbox Archive Tests ====================
+
+// TestMailboxAttachments_DateRange tests streaming a mailbox's attachments for a date range
+func (s *ArchiveHandlerTestSuite) TestMailboxAttachments_DateRange() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/1/attachments.zip?from=2024-03-01&to=2024-03-31", "1")
+	mailbox := &models.Mailbox{ID: 1, FullAddress: "user@example.com"}
+	receivedAt := time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)
+	attachments := []models.MailboxAttachment{
+		{Attachment: models.Attachment{ID: 1, MessageID: 10, Filename: "a.txt", FilePath: "/a/1"}, ReceivedAt: receivedAt},
+		{Attachment: models.Attachment{ID: 2, MessageID: 11, Filename: "a.txt", FilePath: "/a/2"}, ReceivedAt: receivedAt},
+	}
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
+	s.mockAttachmentRepo.On("ListByMailbox", mock.Anything, uint(1), from, to).Return(attachments, nil)
+	s.mockFileStorage.On("Get", "/a/1").Return(newMockReadCloser([]byte("first")), nil)
+	s.mockFileStorage.On("Get", "/a/2").Return(newMockReadCloser([]byte("second")), nil)
+
+	// Act
+	err := s.handler.MailboxAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(`attachment; filename="user@example.com-attachments.zip"`, rec.Header().Get(echo.HeaderContentDisposition))
+
+	files, _ := s.readZip(rec.Body.Bytes())
+	s.Equal("first", files["2024-03-05_083000_10/a.txt"])
+	s.Equal("second", files["2024-03-05_083000_11/a.txt"])
+}
+
+// TestMailboxAttachments_InvalidRange tests rejected date ranges
+func (s *ArchiveHandlerTestSuite) TestMailboxAttachments_InvalidRange() {
+	for _, query := range []string{"from=yesterday", "to=2024-13-01", "from=2024-03-02&to=2024-03-01"} {
+		// Arrange
+		c, rec := s.createContext("/api/mailboxes/1/attachments.zip?"+query, "1")
+
+		// Act
+		err := s.handler.MailboxAttachments(c)
+
+		// Assert
+		s.NoError(err)
+		s.Equal(http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+// TestMailboxAttachments_MailboxNotFound tests a non-existent mailbox
+func (s *ArchiveHandlerTestSuite) TestMailboxAttachments_MailboxNotFound() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/999/attachments.zip", "999")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(999)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.MailboxAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestMailboxAttachments_NoAttachments tests a range without attachments
+func (s *ArchiveHandlerTestSuite) TestMailboxAttachments_NoAttachments() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/1/attachments.zip", "1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+	s.mockAttachmentRepo.On("ListByMailbox", mock.Anything, uint(1), time.Time{}, time.Time{}).Return([]models.MailboxAttachment{}, nil)
+
+	// Act
+	err := s.handler.MailboxAttachments(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// ==================== Mailbox Export Tests ====================
+
+// TestExportMailbox_Mbox tests exporting a mailbox as mbox
+func (s *ArchiveHandlerTestSuite) TestExportMailbox_Mbox() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/1/export", "1")
+	mailbox := &models.Mailbox{ID: 1, FullAddress: "user@example.com"}
+	messages := []models.Message{
+		{ID: 5, MailboxID: 1, SenderEmail: "sender@example.com", RawPath: "/raw/5", ReceivedAt: time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)},
+	}
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
+	s.mockMessageRepo.On("ListByMailboxAfterID", mock.Anything, uint(1), uint(0), mock.Anything).Return(messages, nil)
+	s.mockFileStorage.On("Get", "/raw/5").Return(newMockReadCloser([]byte("Subject: hi\r\n\r\nbody\r\n")), nil)
+
+	// Act
+	err := s.handler.ExportMailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("application/mbox", rec.Header().Get(echo.HeaderContentType))
+	s.Equal(`attachment; filename="user@example.com.mbox"`, rec.Header().Get(echo.HeaderContentDisposition))
+	s.Equal("From sender@example.com Tue Mar  5 08:30:00 2024\nSubject: hi\n\nbody\n\n", rec.Body.String())
+}
+
+// TestExportMailbox_Maildir tests exporting a mailbox as a Maildir archive
+func (s *ArchiveHandlerTestSuite) TestExportMailbox_Maildir() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/1/export?format=maildir", "1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1, FullAddress: "user@example.com"}, nil)
+	s.mockMessageRepo.On("ListByMailboxAfterID", mock.Anything, uint(1), uint(0), mock.Anything).Return([]models.Message{}, nil)
+
+	// Act
+	err := s.handler.ExportMailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("application/gzip", rec.Header().Get(echo.HeaderContentType))
+	s.Equal(`attachment; filename="user@example.com.maildir.tar.gz"`, rec.Header().Get(echo.HeaderContentDisposition))
+	s.NotEmpty(rec.Body.Bytes())
+}
+
+// TestExportMailbox_InvalidFormat tests an unknown export format
+func (s *ArchiveHandlerTestSuite) TestExportMailbox_InvalidFormat() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/1/export?format=pst", "1")
+
+	// Act
+	err := s.handler.ExportMailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestExportMailbox_MailboxNotFound tests exporting a non-existent mailbox
+func (s *ArchiveHandlerTestSuite) TestExportMailbox_MailboxNotFound() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/999/export", "999")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(999)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.ExportMailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
@@ -1,15 +1,28 @@
 package handlers
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/thumbnail"
+)
+
+const (
+	// defaultThumbnailSize is used when the size query parameter is omitted
+	defaultThumbnailSize = 256
+	// minThumbnailSize is the smallest accepted size query parameter
+	minThumbnailSize = 16
 )
 
 // AttachmentHandler handles attachment-related HTTP requests
@@ -17,6 +30,7 @@ type AttachmentHandler struct {
 	attachmentRepo repository.AttachmentRepository
 	messageRepo    repository.MessageRepository
 	fileStorage    storage.FileStorage
+	imageProxy     *imageproxy.Proxy
 }
 
 // NewAttachmentHandler creates a new AttachmentHandler
@@ -32,6 +46,22 @@ func NewAttachmentHandler(
 	}
 }
 
+// NewAttachmentHandlerWithImageProxy creates a new AttachmentHandler that also serves
+// the signed inline attachment URLs issued by the image proxy
+func NewAttachmentHandlerWithImageProxy(
+	attachmentRepo repository.AttachmentRepository,
+	messageRepo repository.MessageRepository,
+	fileStorage storage.FileStorage,
+	imageProxy *imageproxy.Proxy,
+) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentRepo: attachmentRepo,
+		messageRepo:    messageRepo,
+		fileStorage:    fileStorage,
+		imageProxy:     imageProxy,
+	}
+}
+
 // List handles GET /api/messages/:message_id/attachments
 func (h *AttachmentHandler) List(c echo.Context) error {
 	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 32)
@@ -74,7 +104,10 @@ func (h *AttachmentHandler) Get(c echo.Context) error {
 	return response.Success(c, attachment)
 }
 
-// Download handles GET /api/attachments/:id/download
+// Download handles GET /api/attachments/:id/download?inline=1
+// Redirects to a presigned URL when the storage supports direct downloads.
+// With inline=1, raster images are served for display within a rendered message;
+// other content types are always sent as downloads so they cannot run in the API origin.
 func (h *AttachmentHandler) Download(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -89,6 +122,49 @@ func (h *AttachmentHandler) Download(c echo.Context) error {
 		return response.InternalError(c, "failed to get attachment")
 	}
 
+	// Inline images stay on this origin, which is all the message CSP allows
+	inline := c.QueryParam("inline") == "1" && thumbnail.Supported(attachment.ContentType)
+
+	// Let the client fetch the file straight from object storage when possible
+	if signer, ok := h.fileStorage.(storage.URLSigner); ok && !inline {
+		if url, err := signer.SignedURL(attachment.FilePath, attachment.Filename); err == nil {
+			return c.Redirect(http.StatusFound, url)
+		}
+	}
+
+	return h.serveFile(c, attachment, inline)
+}
+
+// Inline handles GET /proxy/attachments/:id?exp=...&sig=...
+// The signature, issued when a message is rendered, authorizes the request
+// instead of the API key, so <img> tags can load cid: images until it expires.
+func (h *AttachmentHandler) Inline(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || h.imageProxy == nil ||
+		!h.imageProxy.VerifyAttachment(uint(id), c.QueryParam("exp"), c.QueryParam("sig"), time.Now()) {
+		return response.Forbidden(c, "invalid attachment signature")
+	}
+
+	attachment, err := h.attachmentRepo.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "attachment not found")
+		}
+		return response.InternalError(c, "failed to get attachment")
+	}
+	// Only images are displayed in place; anything else needs the API key
+	if !thumbnail.Supported(attachment.ContentType) {
+		return response.NotFound(c, "attachment is not an inline image")
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "private, max-age="+strconv.Itoa(int(imageproxy.AttachmentURLTTL.Seconds())))
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	return h.serveFile(c, attachment, true)
+}
+
+// serveFile streams an attachment from storage, inline or as a download
+func (h *AttachmentHandler) serveFile(c echo.Context, attachment *models.Attachment, inline bool) error {
 	// Get file from storage
 	file, err := h.fileStorage.Get(attachment.FilePath)
 	if err != nil {
@@ -98,7 +174,11 @@ func (h *AttachmentHandler) Download(c echo.Context) error {
 
 	// Set headers for download
 	c.Response().Header().Set("Content-Type", attachment.ContentType)
-	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, attachment.Filename))
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, attachment.Filename))
 	if attachment.SizeBytes > 0 {
 		c.Response().Header().Set("Content-Length", strconv.FormatInt(attachment.SizeBytes, 10))
 	}
@@ -111,3 +191,91 @@ func (h *AttachmentHandler) Download(c echo.Context) error {
 
 	return nil
 }
+
+// Thumbnail handles GET /api/attachments/:id/thumbnail?size=256
+// Returns a JPEG preview of an image attachment whose longest side is at most size pixels.
+// Previews are normally rendered at ingestion; older attachments get one on first request.
+func (h *AttachmentHandler) Thumbnail(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid attachment ID")
+	}
+
+	size := defaultThumbnailSize
+	if v := c.QueryParam("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size < minThumbnailSize || size > thumbnail.MaxSize {
+			return response.BadRequest(c, fmt.Sprintf("size must be between %d and %d", minThumbnailSize, thumbnail.MaxSize))
+		}
+	}
+
+	attachment, err := h.attachmentRepo.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "attachment not found")
+		}
+		return response.InternalError(c, "failed to get attachment")
+	}
+	if !thumbnail.Supported(attachment.ContentType) {
+		return response.NotFound(c, "attachment has no preview")
+	}
+
+	preview, err := h.loadPreview(c, attachment)
+	if err != nil {
+		if errors.Is(err, thumbnail.ErrUnsupported) || errors.Is(err, thumbnail.ErrTooLarge) {
+			return response.NotFound(c, "attachment has no preview")
+		}
+		return response.InternalError(c, "failed to load preview")
+	}
+
+	if size < thumbnail.MaxSize {
+		preview, err = thumbnail.Generate(bytes.NewReader(preview), size)
+		if err != nil {
+			return response.InternalError(c, "failed to resize preview")
+		}
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	return c.Blob(http.StatusOK, thumbnail.ContentType, preview)
+}
+
+// loadPreview reads the stored preview of an attachment, generating and storing it first if needed
+func (h *AttachmentHandler) loadPreview(c echo.Context, attachment *models.Attachment) ([]byte, error) {
+	if attachment.PreviewPath != "" {
+		file, err := h.fileStorage.Get(attachment.PreviewPath)
+		if err == nil {
+			defer file.Close()
+			return io.ReadAll(file)
+		}
+		if !errors.Is(err, storage.ErrFileNotFound) {
+			return nil, err
+		}
+		// A lost preview is rendered again from the original
+	}
+
+	file, err := h.fileStorage.Get(attachment.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	preview, err := thumbnail.Generate(file, thumbnail.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Caching the preview is best effort; it is served either way
+	if attachment.PreviewPath != "" {
+		return preview, nil
+	}
+	previewPath, err := h.fileStorage.Save("preview.jpg", bytes.NewReader(preview))
+	if err != nil {
+		return preview, nil
+	}
+	stored, err := h.attachmentRepo.SetPreviewPath(c.Request().Context(), attachment.ID, previewPath)
+	if err != nil || !stored {
+		// Another request stored a preview first
+		_ = h.fileStorage.Delete(previewPath)
+	}
+	return preview, nil
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -17,6 +20,7 @@ import (
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/thumbnail"
 	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
 )
 
@@ -331,6 +335,65 @@ func (s *AttachmentHandlerTestSuite) TestDownload_SetsContentDisposition() {
 	s.Contains(rec.Header().Get("Content-Disposition"), `attachment; filename="report.xlsx"`)
 }
 
+// TestDownload_InlineImage tests that inline=1 displays images in place, bypassing presigned URLs
+func (s *AttachmentHandlerTestSuite) TestDownload_InlineImage() {
+	// Arrange
+	signingStorage := new(mocks.MockSigningFileStorage)
+	handler := NewAttachmentHandler(s.mockAttachmentRepo, s.mockMessageRepo, signingStorage)
+	attachment := &models.Attachment{
+		ID:          1,
+		MessageID:   1,
+		Filename:    "inline.png",
+		ContentType: "image/png",
+		FilePath:    "/attachments/logo.png",
+		ContentID:   "logo@example.com",
+		Inline:      true,
+	}
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	signingStorage.On("Get", attachment.FilePath).Return(newMockReadCloser([]byte("png")), nil)
+
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/download?inline=1", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(`inline; filename="inline.png"`, rec.Header().Get("Content-Disposition"))
+	s.Equal("png", rec.Body.String())
+	signingStorage.AssertExpectations(s.T())
+}
+
+// TestDownload_InlineIgnoredForActiveContent tests that inline=1 never displays non-image content
+func (s *AttachmentHandlerTestSuite) TestDownload_InlineIgnoredForActiveContent() {
+	// Arrange
+	attachment := &models.Attachment{
+		ID:          1,
+		MessageID:   1,
+		Filename:    "page.html",
+		ContentType: "text/html",
+		FilePath:    "/attachments/page.html",
+		Inline:      true,
+	}
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	s.mockFileStorage.On("Get", attachment.FilePath).Return(newMockReadCloser([]byte("<script>")), nil)
+
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/download?inline=1", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := s.handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(`attachment; filename="page.html"`, rec.Header().Get("Content-Disposition"))
+}
+
 // TestDownload_NotFound tests downloading non-existent attachment
 func (s *AttachmentHandlerTestSuite) TestDownload_NotFound() {
 	// Arrange
@@ -410,6 +473,53 @@ func (s *AttachmentHandlerTestSuite) TestDownload_CorrectContentType() {
 	s.Equal("image/png", rec.Header().Get("Content-Type"))
 }
 
+// TestDownload_RedirectsToSignedURL tests that Download redirects when storage can presign URLs
+func (s *AttachmentHandlerTestSuite) TestDownload_RedirectsToSignedURL() {
+	// Arrange
+	signingStorage := new(mocks.MockSigningFileStorage)
+	handler := NewAttachmentHandler(s.mockAttachmentRepo, s.mockMessageRepo, signingStorage)
+	attachment := s.createTestAttachment(1, 1)
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	signingStorage.On("SignedURL", attachment.FilePath, attachment.Filename).Return("https://s3.example.com/signed", nil)
+
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/download", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusFound, rec.Code)
+	s.Equal("https://s3.example.com/signed", rec.Header().Get("Location"))
+	signingStorage.AssertExpectations(s.T())
+}
+
+// TestDownload_SignedURLErrorFallsBackToStream tests that Download streams when presigning fails
+func (s *AttachmentHandlerTestSuite) TestDownload_SignedURLErrorFallsBackToStream() {
+	// Arrange
+	signingStorage := new(mocks.MockSigningFileStorage)
+	handler := NewAttachmentHandler(s.mockAttachmentRepo, s.mockMessageRepo, signingStorage)
+	attachment := s.createTestAttachment(1, 1)
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	signingStorage.On("SignedURL", attachment.FilePath, attachment.Filename).Return("", errors.New("presign failed"))
+	signingStorage.On("Get", attachment.FilePath).Return(newMockReadCloser([]byte("file content")), nil)
+
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/download", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("file content", rec.Body.String())
+	signingStorage.AssertExpectations(s.T())
+}
+
 // TestDownload_InternalError tests downloading when repository returns error
 func (s *AttachmentHandlerTestSuite) TestDownload_InternalError() {
 	// Arrange
@@ -426,3 +536,153 @@ func (s *AttachmentHandlerTestSuite) TestDownload_InternalError() {
 	s.NoError(err)
 	s.Equal(http.StatusInternalServerError, rec.Code)
 }
+
+// ==================== Thumbnail Tests ====================
+
+// encodeTestPNG returns a PNG of the given dimensions
+func encodeTestPNG(width, height int) []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+// createImageAttachment returns a PNG attachment with the given preview path
+func (s *AttachmentHandlerTestSuite) createImageAttachment(previewPath string) *models.Attachment {
+	return &models.Attachment{
+		ID:          1,
+		MessageID:   1,
+		Filename:    "photo.png",
+		ContentType: "image/png",
+		FilePath:    "blobs/aa/photo",
+		HasPreview:  previewPath != "",
+		PreviewPath: previewPath,
+	}
+}
+
+// decodeThumbnail decodes a JPEG response body
+func (s *AttachmentHandlerTestSuite) decodeThumbnail(rec *httptest.ResponseRecorder) image.Config {
+	s.Equal("image/jpeg", rec.Header().Get("Content-Type"))
+	cfg, err := jpeg.DecodeConfig(rec.Body)
+	s.Require().NoError(err)
+	return cfg
+}
+
+// TestThumbnail_ServesStoredPreview tests resizing the preview rendered at ingestion
+func (s *AttachmentHandlerTestSuite) TestThumbnail_ServesStoredPreview() {
+	// Arrange
+	attachment := s.createImageAttachment("blobs/bb/preview")
+	preview, err := thumbnail.Generate(bytes.NewReader(encodeTestPNG(1024, 512)), thumbnail.MaxSize)
+	s.Require().NoError(err)
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/thumbnail?size=128", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	s.mockFileStorage.On("Get", "blobs/bb/preview").Return(newMockReadCloser(preview), nil)
+
+	// Act
+	err = s.handler.Thumbnail(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	cfg := s.decodeThumbnail(rec)
+	s.Equal(128, cfg.Width)
+	s.Equal(64, cfg.Height)
+}
+
+// TestThumbnail_GeneratesMissingPreview tests lazy rendering for attachments stored without a preview
+func (s *AttachmentHandlerTestSuite) TestThumbnail_GeneratesMissingPreview() {
+	// Arrange
+	attachment := s.createImageAttachment("")
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/thumbnail", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	s.mockFileStorage.On("Get", attachment.FilePath).Return(newMockReadCloser(encodeTestPNG(300, 600)), nil)
+	s.mockFileStorage.On("Save", "preview.jpg", mock.Anything).Return("blobs/cc/preview", nil)
+	s.mockAttachmentRepo.On("SetPreviewPath", mock.Anything, uint(1), "blobs/cc/preview").Return(true, nil)
+
+	// Act
+	err := s.handler.Thumbnail(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	cfg := s.decodeThumbnail(rec)
+	s.Equal(128, cfg.Width)
+	s.Equal(256, cfg.Height)
+}
+
+// TestThumbnail_ReleasesPreviewStoredConcurrently tests dropping a duplicate preview
+func (s *AttachmentHandlerTestSuite) TestThumbnail_ReleasesPreviewStoredConcurrently() {
+	// Arrange
+	attachment := s.createImageAttachment("")
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/thumbnail", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	s.mockFileStorage.On("Get", attachment.FilePath).Return(newMockReadCloser(encodeTestPNG(40, 40)), nil)
+	s.mockFileStorage.On("Save", "preview.jpg", mock.Anything).Return("blobs/cc/preview", nil)
+	s.mockAttachmentRepo.On("SetPreviewPath", mock.Anything, uint(1), "blobs/cc/preview").Return(false, nil)
+	s.mockFileStorage.On("Delete", "blobs/cc/preview").Return(nil)
+
+	// Act
+	err := s.handler.Thumbnail(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+}
+
+// TestThumbnail_NotAnImage tests requesting a preview of a non-image attachment
+func (s *AttachmentHandlerTestSuite) TestThumbnail_NotAnImage() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/thumbnail", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(s.createTestAttachment(1, 1), nil)
+
+	// Act
+	err := s.handler.Thumbnail(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestThumbnail_UndecodableImage tests an image attachment that cannot be previewed
+func (s *AttachmentHandlerTestSuite) TestThumbnail_UndecodableImage() {
+	// Arrange
+	attachment := s.createImageAttachment("")
+	c, rec := s.createContext(http.MethodGet, "/api/attachments/1/thumbnail", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(1)).Return(attachment, nil)
+	s.mockFileStorage.On("Get", attachment.FilePath).Return(newMockReadCloser([]byte("not a png")), nil)
+
+	// Act
+	err := s.handler.Thumbnail(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestThumbnail_InvalidSize tests rejecting out-of-range sizes
+func (s *AttachmentHandlerTestSuite) TestThumbnail_InvalidSize() {
+	for _, size := range []string{"abc", "8", "4096"} {
+		c, rec := s.createContext(http.MethodGet, "/api/attachments/1/thumbnail?size="+size, "")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err := s.handler.Thumbnail(c)
+
+		s.NoError(err)
+		s.Equal(http.StatusBadRequest, rec.Code, "size=%s", size)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// BulkHandler handles operations on many messages at once
+type BulkHandler struct {
+	mailboxRepo repository.MailboxRepository
+	service     *services.BulkMessageService
+}
+
+// NewBulkHandler creates a new BulkHandler
+func NewBulkHandler(mailboxRepo repository.MailboxRepository, service *services.BulkMessageService) *BulkHandler {
+	return &BulkHandler{mailboxRepo: mailboxRepo, service: service}
+}
+
+// BulkMessagesRequest represents the request body for bulk message operations.
+// Messages are selected either by ids or by filter within mailbox_id or domain_id.
+type BulkMessagesRequest struct {
+	Action string `json:"action"`
+	IDs    []uint `json:"ids,omitempty"`
+	// Filter uses the search syntax; an empty string selects every message in scope
+	Filter          *string `json:"filter,omitempty"`
+	MailboxID       uint    `json:"mailbox_id,omitempty"`
+	DomainID        uint    `json:"domain_id,omitempty"`
+	TargetMailboxID uint    `json:"target_mailbox_id,omitempty"`
+}
+
+// Bulk handles POST /api/messages/bulk
+// Applies mark_read, mark_unread, flag, unflag, move or delete to the selected messages.
+func (h *BulkHandler) Bulk(c echo.Context) error {
+	var req BulkMessagesRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+
+	action, err := services.ParseBulkAction(req.Action)
+	if err != nil {
+		return response.BadRequest(c, "action must be mark_read, mark_unread, flag, unflag, move or delete")
+	}
+
+	bulk := services.BulkRequest{
+		Action:          action,
+		IDs:             req.IDs,
+		Scope:           repository.SearchScope{MailboxID: req.MailboxID, DomainID: req.DomainID},
+		TargetMailboxID: req.TargetMailboxID,
+	}
+	if req.Filter != nil {
+		query, err := search.Parse(*req.Filter)
+		if errors.Is(err, search.ErrEmptyQuery) {
+			query, err = &search.Query{}, nil
+		}
+		if err != nil {
+			return response.BadRequest(c, err.Error())
+		}
+		if bulk.Scope.MailboxID == 0 && bulk.Scope.DomainID == 0 {
+			return response.BadRequest(c, "mailbox_id or domain_id is required with filter")
+		}
+		bulk.Filter = query
+	}
+
+	return h.apply(c, bulk)
+}
+
+// MarkAllRead handles POST /api/mailboxes/:id/mark-all-read
+func (h *BulkHandler) MarkAllRead(c echo.Context) error {
+	mailboxID, ok, err := h.mailboxParam(c, "id")
+	if !ok {
+		return err
+	}
+
+	unread := true
+	return h.apply(c, services.BulkRequest{
+		Action: services.BulkMarkRead,
+		Filter: &search.Query{Unread: &unread},
+		Scope:  repository.SearchScope{MailboxID: mailboxID},
+	})
+}
+
+// DeleteAll handles DELETE /api/mailboxes/:mailbox_id/messages
+// Deletes every message of the mailbox and keeps the mailbox itself.
+func (h *BulkHandler) DeleteAll(c echo.Context) error {
+	mailboxID, ok, err := h.mailboxParam(c, "mailbox_id")
+	if !ok {
+		return err
+	}
+
+	return h.apply(c, services.BulkRequest{
+		Action: services.BulkDelete,
+		Filter: &search.Query{},
+		Scope:  repository.SearchScope{MailboxID: mailboxID},
+	})
+}
+
+// mailboxParam parses the mailbox ID path parameter and checks the mailbox exists.
+// When ok is false the error response has already been written.
+func (h *BulkHandler) mailboxParam(c echo.Context, name string) (uint, bool, error) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil {
+		return 0, false, response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	if _, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return 0, false, response.NotFound(c, "mailbox not found")
+		}
+		return 0, false, response.InternalError(c, "failed to get mailbox")
+	}
+	return uint(id), true, nil
+}
+
+// apply runs a bulk request and writes its result
+func (h *BulkHandler) apply(c echo.Context, req services.BulkRequest) error {
+	result, err := h.service.Apply(c.Request().Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidBulkSelection),
+			errors.Is(err, services.ErrTooManyBulkIDs),
+			errors.Is(err, services.ErrMoveTargetRequired):
+			return response.BadRequest(c, err.Error())
+		case errors.Is(err, repository.ErrNotFound):
+			return response.NotFound(c, "target mailbox not found")
+		}
+		return response.InternalError(c, "failed to update messages")
+	}
+
+	return response.Success(c, result)
+}
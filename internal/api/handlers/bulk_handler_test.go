@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// BulkHandlerTestSuite is the test suite for BulkHandler
+type BulkHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *BulkHandler
+	mockMessageRepo *mocks.MockMessageRepository
+	mockMailboxRepo *mocks.MockMailboxRepository
+}
+
+// SetupTest runs before each test
+func (s *BulkHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	service := services.NewBulkMessageService(s.mockMessageRepo, s.mockMailboxRepo, nil, nil, nil)
+	s.handler = NewBulkHandler(s.mockMailboxRepo, service)
+}
+
+// TearDownTest runs after each test
+func (s *BulkHandlerTestSuite) TearDownTest() {
+	s.mockMessageRepo.AssertExpectations(s.T())
+	s.mockMailboxRepo.AssertExpectations(s.T())
+}
+
+// TestBulkHandlerTestSuite runs the test suite
+func TestBulkHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(BulkHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *BulkHandlerTestSuite) createContext(method, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// decodeResult decodes the bulk result of a successful response
+func (s *BulkHandlerTestSuite) decodeResult(rec *httptest.ResponseRecorder) services.BulkResult {
+	var resp struct {
+		Data services.BulkResult `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Data
+}
+
+// TestBulk_MarkReadByIDs tests marking listed messages as read
+func (s *BulkHandlerTestSuite) TestBulk_MarkReadByIDs() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, `{"action":"mark_read","ids":[1,2]}`)
+	s.mockMessageRepo.On("MailboxIDsByIDs", mock.Anything, []uint{1, 2}).Return(map[uint]uint{1: 3, 2: 3}, nil)
+	s.mockMessageRepo.On("SetReadByIDs", mock.Anything, []uint{1, 2}, true).Return(int64(2), nil)
+
+	// Act
+	err := s.handler.Bulk(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	result := s.decodeResult(rec)
+	s.Equal(services.BulkMarkRead, result.Action)
+	s.Equal(int64(2), result.Affected)
+	s.Equal([]uint{3}, result.MailboxIDs)
+}
+
+// TestBulk_DeleteByFilter tests deleting messages selected by a filter
+func (s *BulkHandlerTestSuite) TestBulk_DeleteByFilter() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, `{"action":"delete","filter":"from:shop.com","mailbox_id":3}`)
+	s.mockMessageRepo.On("SearchIDs", mock.Anything,
+		mock.MatchedBy(func(q *search.Query) bool { return len(q.From) == 1 && q.From[0] == "shop.com" }),
+		repository.SearchScope{MailboxID: 3}, uint(0), services.BulkBatchSize).Return([]uint{4}, nil)
+	s.mockMessageRepo.On("MailboxIDsByIDs", mock.Anything, []uint{4}).Return(map[uint]uint{4: 3}, nil)
+	s.mockMessageRepo.On("DeleteByIDs", mock.Anything, []uint{4}).Return([]string{}, nil)
+
+	// Act
+	err := s.handler.Bulk(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(int64(1), s.decodeResult(rec).Affected)
+}
+
+// TestBulk_FilterWithoutScope tests that a filter requires a mailbox or domain
+func (s *BulkHandlerTestSuite) TestBulk_FilterWithoutScope() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, `{"action":"delete","filter":""}`)
+
+	// Act
+	err := s.handler.Bulk(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestBulk_InvalidAction tests an unknown action
+func (s *BulkHandlerTestSuite) TestBulk_InvalidAction() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, `{"action":"archive","ids":[1]}`)
+
+	// Act
+	err := s.handler.Bulk(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestBulk_MoveToUnknownMailbox tests moving to a mailbox that does not exist
+func (s *BulkHandlerTestSuite) TestBulk_MoveToUnknownMailbox() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, `{"action":"move","ids":[1],"target_mailbox_id":9}`)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Bulk(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestBulk_RepositoryError tests a failing update
+func (s *BulkHandlerTestSuite) TestBulk_RepositoryError() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, `{"action":"flag","ids":[1]}`)
+	s.mockMessageRepo.On("MailboxIDsByIDs", mock.Anything, []uint{1}).Return(nil, errors.New("database error"))
+
+	// Act
+	err := s.handler.Bulk(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusInternalServerError, rec.Code)
+}
+
+// TestMarkAllRead_Success tests marking every unread message of a mailbox as read
+func (s *BulkHandlerTestSuite) TestMarkAllRead_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.Mailbox{ID: 3}, nil)
+	s.mockMessageRepo.On("SearchIDs", mock.Anything,
+		mock.MatchedBy(func(q *search.Query) bool { return q.Unread != nil && *q.Unread }),
+		repository.SearchScope{MailboxID: 3}, uint(0), services.BulkBatchSize).Return([]uint{5, 6}, nil)
+	s.mockMessageRepo.On("MailboxIDsByIDs", mock.Anything, []uint{5, 6}).Return(map[uint]uint{5: 3, 6: 3}, nil)
+	s.mockMessageRepo.On("SetReadByIDs", mock.Anything, []uint{5, 6}, true).Return(int64(2), nil)
+
+	// Act
+	err := s.handler.MarkAllRead(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(int64(2), s.decodeResult(rec).Affected)
+}
+
+// TestMarkAllRead_MailboxNotFound tests an unknown mailbox
+func (s *BulkHandlerTestSuite) TestMarkAllRead_MailboxNotFound() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "")
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.MarkAllRead(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestDeleteAll_Success tests emptying a mailbox
+func (s *BulkHandlerTestSuite) TestDeleteAll_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodDelete, "")
+	c.SetParamNames("mailbox_id")
+	c.SetParamValues("3")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.Mailbox{ID: 3}, nil)
+	s.mockMessageRepo.On("SearchIDs", mock.Anything, &search.Query{},
+		repository.SearchScope{MailboxID: 3}, uint(0), services.BulkBatchSize).Return([]uint{}, nil)
+
+	// Act
+	err := s.handler.DeleteAll(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(int64(0), s.decodeResult(rec).Affected)
+}
+
+// TestDeleteAll_InvalidID tests a malformed mailbox ID
+func (s *BulkHandlerTestSuite) TestDeleteAll_InvalidID() {
+	// Arrange
+	c, rec := s.createContext(http.MethodDelete, "")
+	c.SetParamNames("mailbox_id")
+	c.SetParamValues("abc")
+
+	// Act
+	err := s.handler.DeleteAll(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
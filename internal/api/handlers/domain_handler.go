@@ -48,12 +48,20 @@ func NewDomainHandlerWithServices(
 type CreateDomainRequest struct {
 	Name     string `json:"name" validate:"required"`
 	IsActive *bool  `json:"is_active,omitempty"`
+	// TenantID gives the domain to a tenant (super-admin keys only; tenant
+	// keys always create domains of their tenant)
+	TenantID *uint `json:"tenant_id,omitempty"`
 }
 
 // UpdateDomainRequest represents the request body for updating a domain
 type UpdateDomainRequest struct {
 	Name     string `json:"name,omitempty"`
 	IsActive *bool  `json:"is_active,omitempty"`
+	// Retention overrides (0 = keep forever, negative = revert to server default)
+	MessageRetentionHours *int `json:"message_retention_hours,omitempty"`
+	MailboxRetentionDays  *int `json:"mailbox_retention_days,omitempty"`
+	// TenantID gives the domain to another tenant, 0 to none (super-admin keys only)
+	TenantID *uint `json:"tenant_id,omitempty"`
 }
 
 // Create handles POST /api/domains
@@ -69,14 +77,19 @@ func (h *DomainHandler) Create(c echo.Context) error {
 		return response.BadRequest(c, "name is required")
 	}
 
+	ctx := c.Request().Context()
+	if req.TenantID != nil {
+		if _, ok := repository.TenantFromContext(ctx); ok {
+			return response.Forbidden(c, "tenant keys cannot choose the tenant of a domain")
+		}
+		ctx = repository.WithTenant(ctx, *req.TenantID)
+	}
+
 	// If domain manager is configured, use the new SSL setup flow
 	if h.domainManager != nil {
-		domain, err := h.domainManager.CreateDomain(c.Request().Context(), req.Name)
+		domain, err := h.domainManager.CreateDomain(ctx, req.Name)
 		if err != nil {
-			if errors.Is(err, repository.ErrDuplicateEntry) {
-				return response.Conflict(c, "domain already exists")
-			}
-			return response.InternalError(c, "failed to create domain")
+			return domainCreateError(c, err)
 		}
 		return response.Created(c, domain)
 	}
@@ -90,16 +103,26 @@ func (h *DomainHandler) Create(c echo.Context) error {
 		domain.IsActive = *req.IsActive
 	}
 
-	if err := h.repo.Create(c.Request().Context(), domain); err != nil {
-		if errors.Is(err, repository.ErrDuplicateEntry) {
-			return response.Conflict(c, "domain already exists")
-		}
-		return response.InternalError(c, "failed to create domain")
+	if err := h.repo.Create(ctx, domain); err != nil {
+		return domainCreateError(c, err)
 	}
 
 	return response.Created(c, domain)
 }
 
+// domainCreateError maps the errors of creating a domain to responses
+func domainCreateError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrDuplicateEntry):
+		return response.Conflict(c, "domain already exists")
+	case errors.Is(err, repository.ErrLimitExceeded):
+		return response.Forbidden(c, "tenant already owns as many domains as it may")
+	case errors.Is(err, repository.ErrInvalidInput):
+		return response.BadRequest(c, "tenant not found")
+	}
+	return response.InternalError(c, "failed to create domain")
+}
+
 // List handles GET /api/domains
 func (h *DomainHandler) List(c echo.Context) error {
 	activeOnly := c.QueryParam("active_only") == "true"
@@ -141,6 +164,9 @@ func (h *DomainHandler) Update(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return response.BadRequest(c, "invalid request body")
 	}
+	if _, ok := repository.TenantFromContext(c.Request().Context()); ok && req.TenantID != nil {
+		return response.Forbidden(c, "tenant keys cannot give domains to another tenant")
+	}
 
 	// Get existing domain
 	domain, err := h.repo.GetByID(c.Request().Context(), uint(id))
@@ -158,10 +184,27 @@ func (h *DomainHandler) Update(c echo.Context) error {
 	if req.IsActive != nil {
 		domain.IsActive = *req.IsActive
 	}
+	if req.MessageRetentionHours != nil {
+		domain.MessageRetentionHours = retentionOverride(*req.MessageRetentionHours)
+	}
+	if req.MailboxRetentionDays != nil {
+		domain.MailboxRetentionDays = retentionOverride(*req.MailboxRetentionDays)
+	}
+	if req.TenantID != nil {
+		domain.TenantID = req.TenantID
+		if *req.TenantID == 0 {
+			domain.TenantID = nil
+		}
+	}
 
 	if err := h.repo.Update(c.Request().Context(), domain); err != nil {
-		if errors.Is(err, repository.ErrDuplicateEntry) {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateEntry):
 			return response.Conflict(c, "domain name already exists")
+		case errors.Is(err, repository.ErrLimitExceeded):
+			return response.Forbidden(c, "tenant already owns as many domains as it may")
+		case errors.Is(err, repository.ErrInvalidInput):
+			return response.BadRequest(c, "tenant not found")
 		}
 		return response.InternalError(c, "failed to update domain")
 	}
@@ -169,6 +212,15 @@ func (h *DomainHandler) Update(c echo.Context) error {
 	return response.Success(c, domain)
 }
 
+// retentionOverride converts a requested retention value into a domain override,
+// where a negative value clears the override so the server default applies
+func retentionOverride(value int) *int {
+	if value < 0 {
+		return nil
+	}
+	return &value
+}
+
 // Delete handles DELETE /api/domains/:id
 func (h *DomainHandler) Delete(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -200,6 +201,57 @@ func (s *DomainHandlerTestSuite) TestCreate_InternalError() {
 	s.Equal(http.StatusInternalServerError, rec.Code)
 }
 
+// TestCreate_ForTenant tests a super-admin creating a domain for a tenant
+func (s *DomainHandlerTestSuite) TestCreate_ForTenant() {
+	// Arrange
+	body := `{"name": "example.com", "tenant_id": 4}`
+	c, rec := s.createContext(http.MethodPost, "/api/domains", body)
+
+	s.mockRepo.On("Create", mock.MatchedBy(func(ctx context.Context) bool {
+		tenantID, ok := repository.TenantFromContext(ctx)
+		return ok && tenantID == 4
+	}), mock.AnythingOfType("*models.Domain")).Return(nil)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+}
+
+// TestCreate_TenantChoosesTenant tests a tenant key naming a tenant
+func (s *DomainHandlerTestSuite) TestCreate_TenantChoosesTenant() {
+	// Arrange
+	body := `{"name": "example.com", "tenant_id": 5}`
+	c, rec := s.createContext(http.MethodPost, "/api/domains", body)
+	c.SetRequest(c.Request().WithContext(repository.WithTenant(c.Request().Context(), 4)))
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, rec.Code)
+}
+
+// TestCreate_LimitExceeded tests creating a domain beyond the tenant limit
+func (s *DomainHandlerTestSuite) TestCreate_LimitExceeded() {
+	// Arrange
+	body := `{"name": "example.com"}`
+	c, rec := s.createContext(http.MethodPost, "/api/domains", body)
+
+	s.mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Domain")).
+		Return(repository.ErrLimitExceeded)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, rec.Code)
+}
+
 
 // ==================== Get Tests ====================
 
@@ -470,6 +522,30 @@ func (s *DomainHandlerTestSuite) TestUpdate_IsActiveOnly() {
 	s.Equal(http.StatusOK, rec.Code)
 }
 
+// TestUpdate_RetentionOverrides tests setting and clearing retention overrides
+func (s *DomainHandlerTestSuite) TestUpdate_RetentionOverrides() {
+	// Arrange
+	domain := s.createTestDomain(1, "example.com", true)
+	days := 7
+	domain.MailboxRetentionDays = &days
+	body := `{"message_retention_hours": 24, "mailbox_retention_days": -1}`
+	c, rec := s.createContext(http.MethodPut, "/api/domains/1", body)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	s.mockRepo.On("GetByID", mock.Anything, uint(1)).Return(domain, nil)
+	s.mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(d *models.Domain) bool {
+		return d.MessageRetentionHours != nil && *d.MessageRetentionHours == 24 && d.MailboxRetentionDays == nil
+	})).Return(nil)
+
+	// Act
+	err := s.handler.Update(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+}
+
 // ==================== Delete Tests ====================
 
 // TestDelete_ValidID tests deleting a domain with valid ID
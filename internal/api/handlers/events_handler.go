@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment so proxies
+// keep the connection open
+const eventsKeepAlive = 25 * time.Second
+
+// EventTypeReset tells a resuming client that events were missed and it should
+// reload instead
+const EventTypeReset = string(websocket.MessageTypeReset)
+
+// EventsHandler streams the events of the WebSocket hub as Server-Sent Events,
+// for clients and proxies that cannot use WebSocket
+type EventsHandler struct {
+	mailboxRepo repository.MailboxRepository
+	domainRepo  repository.DomainRepository
+	hub         *websocket.Hub
+	keepAlive   time.Duration
+}
+
+// NewEventsHandler creates a new EventsHandler
+func NewEventsHandler(mailboxRepo repository.MailboxRepository, domainRepo repository.DomainRepository, hub *websocket.Hub) *EventsHandler {
+	return &EventsHandler{
+		mailboxRepo: mailboxRepo,
+		domainRepo:  domainRepo,
+		hub:         hub,
+		keepAlive:   eventsKeepAlive,
+	}
+}
+
+// Mailbox handles GET /api/mailboxes/:id/events
+// Streams the events of a mailbox. A client
+// resumes with the Last-Event-ID header or the last_event_id query parameter.
+func (h *EventsHandler) Mailbox(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+	if _, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+	return h.stream(c, func(lastEventID string) (*websocket.Stream, []*websocket.Event, bool) {
+		return h.hub.OpenStream(uint(id), lastEventID)
+	})
+}
+
+// Domain handles GET /api/domains/:id/events
+// Streams the events of a domain and of every mailbox of it, including mailboxes
+// created after the stream was opened
+func (h *EventsHandler) Domain(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid domain ID")
+	}
+	if _, err := h.domainRepo.GetByID(c.Request().Context(), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "domain not found")
+		}
+		return response.InternalError(c, "failed to get domain")
+	}
+	return h.stream(c, func(lastEventID string) (*websocket.Stream, []*websocket.Event, bool) {
+		return h.hub.OpenDomainStream(uint(id), lastEventID)
+	})
+}
+
+// stream writes the events of a hub stream until the client disconnects or the
+// hub drops the stream
+func (h *EventsHandler) stream(c echo.Context, open func(lastEventID string) (*websocket.Stream, []*websocket.Event, bool)) error {
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+	stream, missed, resumed := open(lastEventID)
+	defer h.hub.CloseStream(stream)
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(event *websocket.Event) error {
+		_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+		return err
+	}
+
+	if !resumed {
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", EventTypeReset); err != nil {
+			return nil
+		}
+	}
+	for _, event := range missed {
+		if err := write(event); err != nil {
+			return nil
+		}
+	}
+	w.Flush()
+
+	ctx := c.Request().Context()
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		case event, ok := <-stream.Events():
+			if !ok {
+				// Too far behind; the client reconnects with its Last-Event-ID
+				return nil
+			}
+			if err := write(event); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
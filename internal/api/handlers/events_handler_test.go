@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// EventsHandlerTestSuite is the test suite for EventsHandler
+type EventsHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *EventsHandler
+	hub             *websocket.Hub
+	mockMailboxRepo *mocks.MockMailboxRepository
+	mockDomainRepo  *mocks.MockDomainRepository
+}
+
+// SetupTest runs before each test
+func (s *EventsHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockDomainRepo = new(mocks.MockDomainRepository)
+	s.hub = websocket.NewHub(nil)
+	go s.hub.Run()
+	s.handler = NewEventsHandler(s.mockMailboxRepo, s.mockDomainRepo, s.hub)
+}
+
+// TearDownTest runs after each test
+func (s *EventsHandlerTestSuite) TearDownTest() {
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockDomainRepo.AssertExpectations(s.T())
+}
+
+// TestEventsHandlerTestSuite runs the test suite
+func TestEventsHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(EventsHandlerTestSuite))
+}
+
+// Helper function to create a test context for a stream the client already
+// disconnected from, so the handler returns after writing the missed events
+func (s *EventsHandlerTestSuite) createContext(target, lastEventID, id string) (echo.Context, *httptest.ResponseRecorder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+// broadcast sends events through the hub and returns their IDs once the hub has
+// recorded them
+func (s *EventsHandlerTestSuite) broadcast(mailboxIDs ...uint) []string {
+	probe, _, _ := s.hub.OpenStream(0, "")
+	defer s.hub.CloseStream(probe)
+
+	for i, mailboxID := range mailboxIDs {
+		s.hub.BroadcastNewMessage(mailboxID, &websocket.NewMessagePayload{ID: uint(i + 1)})
+	}
+	ids := make([]string, 0, len(mailboxIDs))
+	for range mailboxIDs {
+		select {
+		case event := <-probe.Events():
+			ids = append(ids, event.ID)
+		case <-time.After(time.Second):
+			s.FailNow("event not broadcast")
+		}
+	}
+	return ids
+}
+
+// TestMailbox_ReplaysMissedEvents tests resuming a mailbox stream with Last-Event-ID
+func (s *EventsHandlerTestSuite) TestMailbox_ReplaysMissedEvents() {
+	// Arrange
+	ids := s.broadcast(1, 2, 1)
+	c, rec := s.createContext("/api/mailboxes/1/events", ids[0], "1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+
+	// Act
+	err := s.handler.Mailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("text/event-stream", rec.Header().Get(echo.HeaderContentType))
+	body := rec.Body.String()
+	s.Contains(body, "id: "+ids[2]+"\nevent: new_message\ndata: {")
+	s.Contains(body, `"mailbox_id":1`)
+	s.NotContains(body, ids[1])
+	s.NotContains(body, "event: reset")
+}
+
+// TestMailbox_QueryLastEventID tests resuming with the last_event_id query parameter
+func (s *EventsHandlerTestSuite) TestMailbox_QueryLastEventID() {
+	// Arrange
+	ids := s.broadcast(1, 1)
+	c, rec := s.createContext("/api/mailboxes/1/events?last_event_id="+ids[0], "", "1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+
+	// Act
+	err := s.handler.Mailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Contains(rec.Body.String(), "id: "+ids[1])
+}
+
+// TestMailbox_Reset tests resuming from an event ID the hub no longer knows
+func (s *EventsHandlerTestSuite) TestMailbox_Reset() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/1/events", "restarted-7", "1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+
+	// Act
+	err := s.handler.Mailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), "event: reset\ndata: {}")
+}
+
+// TestMailbox_NotFound tests streaming a mailbox that does not exist
+func (s *EventsHandlerTestSuite) TestMailbox_NotFound() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/9/events", "", "9")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Mailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestMailbox_InvalidID tests a malformed mailbox ID
+func (s *EventsHandlerTestSuite) TestMailbox_InvalidID() {
+	// Arrange
+	c, rec := s.createContext("/api/mailboxes/abc/events", "", "abc")
+
+	// Act
+	err := s.handler.Mailbox(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestDomain_FiltersOtherDomains tests that a domain stream only carries the
+// events of its own mailboxes
+func (s *EventsHandlerTestSuite) TestDomain_FiltersOtherDomains() {
+	// Arrange
+	s.hub.SetDomainResolver(func(_ context.Context, mailboxID uint) (uint, error) {
+		return map[uint]uint{1: 5, 2: 6}[mailboxID], nil
+	})
+	ids := s.broadcast(1, 2, 1, 3)
+	c, rec := s.createContext("/api/domains/5/events", ids[0], "5")
+	s.mockDomainRepo.On("GetByID", mock.Anything, uint(5)).Return(&models.Domain{ID: 5}, nil)
+
+	// Act
+	err := s.handler.Domain(c)
+
+	// Assert
+	s.NoError(err)
+	body := rec.Body.String()
+	s.Contains(body, "id: "+ids[2])
+	s.NotContains(body, ids[1])
+	s.NotContains(body, ids[3])
+}
+
+// TestDomain_NotFound tests streaming a domain that does not exist
+func (s *EventsHandlerTestSuite) TestDomain_NotFound() {
+	// Arrange
+	c, rec := s.createContext("/api/domains/9/events", "", "9")
+	s.mockDomainRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Domain(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// maxFolderNameLength is the maximum length of folder and label names in characters
+const maxFolderNameLength = 100
+
+// FolderHandler handles folder-related HTTP requests
+type FolderHandler struct {
+	folderRepo  repository.FolderRepository
+	mailboxRepo repository.MailboxRepository
+	messageRepo repository.MessageRepository
+}
+
+// NewFolderHandler creates a new FolderHandler
+func NewFolderHandler(
+	folderRepo repository.FolderRepository,
+	mailboxRepo repository.MailboxRepository,
+	messageRepo repository.MessageRepository,
+) *FolderHandler {
+	return &FolderHandler{
+		folderRepo:  folderRepo,
+		mailboxRepo: mailboxRepo,
+		messageRepo: messageRepo,
+	}
+}
+
+// FolderRequest represents the request body for creating or renaming a folder
+type FolderRequest struct {
+	Name string `json:"name"`
+}
+
+// MoveToFolderRequest represents the request body for moving a message to a folder
+type MoveToFolderRequest struct {
+	FolderID uint `json:"folder_id"`
+}
+
+// List handles GET /api/mailboxes/:id/folders
+// System folders (Inbox, Archive, Junk, Trash) come first, then custom folders by name.
+func (h *FolderHandler) List(c echo.Context) error {
+	mailboxID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	if _, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(mailboxID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	folders, err := h.folderRepo.ListByMailbox(c.Request().Context(), uint(mailboxID))
+	if err != nil {
+		return response.InternalError(c, "failed to list folders")
+	}
+
+	return response.Success(c, folders)
+}
+
+// Create handles POST /api/mailboxes/:id/folders
+func (h *FolderHandler) Create(c echo.Context) error {
+	mailboxID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	var req FolderRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	name, err := validateFolderName(req.Name)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+
+	if _, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(mailboxID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	folder := &models.Folder{MailboxID: uint(mailboxID), Name: name}
+	if err := h.folderRepo.Create(c.Request().Context(), folder); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return response.Conflict(c, "folder already exists")
+		}
+		return response.InternalError(c, "failed to create folder")
+	}
+
+	return response.Created(c, folder)
+}
+
+// Rename handles PATCH /api/folders/:id
+// System folders cannot be renamed.
+func (h *FolderHandler) Rename(c echo.Context) error {
+	folder, ok, err := h.customFolder(c)
+	if !ok {
+		return err
+	}
+
+	var req FolderRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	name, err := validateFolderName(req.Name)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+
+	if err := h.folderRepo.Rename(c.Request().Context(), folder.ID, name); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return response.Conflict(c, "folder already exists")
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "folder not found")
+		}
+		return response.InternalError(c, "failed to rename folder")
+	}
+
+	folder.Name = name
+	return response.Success(c, folder)
+}
+
+// Delete handles DELETE /api/folders/:id
+// Messages of the folder return to the Inbox. System folders cannot be deleted.
+func (h *FolderHandler) Delete(c echo.Context) error {
+	folder, ok, err := h.customFolder(c)
+	if !ok {
+		return err
+	}
+
+	if err := h.folderRepo.Delete(c.Request().Context(), folder.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "folder not found")
+		}
+		return response.InternalError(c, "failed to delete folder")
+	}
+
+	return response.NoContent(c)
+}
+
+// MoveMessage handles PUT /api/messages/:id/folder
+// Moves a message to another folder of its mailbox.
+func (h *FolderHandler) MoveMessage(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid message ID")
+	}
+
+	var req MoveToFolderRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	if req.FolderID == 0 {
+		return response.BadRequest(c, "folder_id is required")
+	}
+
+	ctx := c.Request().Context()
+	message, err := h.messageRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "message not found")
+		}
+		return response.InternalError(c, "failed to get message")
+	}
+
+	folder, err := h.folderRepo.GetByID(ctx, req.FolderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "folder not found")
+		}
+		return response.InternalError(c, "failed to get folder")
+	}
+	if folder.MailboxID != message.MailboxID {
+		return response.BadRequest(c, "folder belongs to another mailbox")
+	}
+
+	// Messages without a folder are in the Inbox
+	var folderID *uint
+	if folder.Role != models.FolderRoleInbox {
+		folderID = &folder.ID
+	}
+	if _, err := h.messageRepo.SetFolderByIDs(ctx, []uint{message.ID}, folderID); err != nil {
+		return response.InternalError(c, "failed to move message")
+	}
+
+	message.FolderID = folderID
+	return response.Success(c, message)
+}
+
+// customFolder loads the folder of the :id parameter and rejects system folders.
+// When ok is false the error response has already been written.
+func (h *FolderHandler) customFolder(c echo.Context) (*models.Folder, bool, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, false, response.BadRequest(c, "invalid folder ID")
+	}
+
+	folder, err := h.folderRepo.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, false, response.NotFound(c, "folder not found")
+		}
+		return nil, false, response.InternalError(c, "failed to get folder")
+	}
+	if folder.IsSystem() {
+		return nil, false, response.Forbidden(c, "system folders cannot be changed")
+	}
+	return folder, true, nil
+}
+
+// validateFolderName trims a folder name and checks it does not clash with a system folder
+func validateFolderName(name string) (string, error) {
+	name, err := validateName(name)
+	if err != nil {
+		return "", err
+	}
+	for _, folder := range models.SystemFolders {
+		if strings.EqualFold(folder.Name, name) {
+			return "", errors.New("name is reserved for a system folder")
+		}
+	}
+	return name, nil
+}
+
+// validateName trims a folder or label name and checks its length
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > maxFolderNameLength {
+		return "", errors.New("name is too long")
+	}
+	return name, nil
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// FolderHandlerTestSuite is the test suite for FolderHandler
+type FolderHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *FolderHandler
+	mockFolderRepo  *mocks.MockFolderRepository
+	mockMailboxRepo *mocks.MockMailboxRepository
+	mockMessageRepo *mocks.MockMessageRepository
+}
+
+// SetupTest runs before each test
+func (s *FolderHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockFolderRepo = new(mocks.MockFolderRepository)
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.handler = NewFolderHandler(s.mockFolderRepo, s.mockMailboxRepo, s.mockMessageRepo)
+}
+
+// TearDownTest runs after each test
+func (s *FolderHandlerTestSuite) TearDownTest() {
+	s.mockFolderRepo.AssertExpectations(s.T())
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockMessageRepo.AssertExpectations(s.T())
+}
+
+// TestFolderHandlerTestSuite runs the test suite
+func TestFolderHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(FolderHandlerTestSuite))
+}
+
+// Helper function to create a test context with an :id parameter
+func (s *FolderHandlerTestSuite) createContext(method, id, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+// TestList_Success tests listing the folders of a mailbox
+func (s *FolderHandlerTestSuite) TestList_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "1", "")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+	s.mockFolderRepo.On("ListByMailbox", mock.Anything, uint(1)).Return([]models.FolderWithCounts{
+		{Folder: models.Folder{ID: 1, MailboxID: 1, Name: "Inbox", Role: models.FolderRoleInbox}, MessageCount: 3, UnreadCount: 1},
+	}, nil)
+
+	// Act
+	err := s.handler.List(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"role":"inbox"`)
+	s.Contains(rec.Body.String(), `"unread_count":1`)
+}
+
+// TestCreate_Success tests creating a custom folder
+func (s *FolderHandlerTestSuite) TestCreate_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "1", `{"name":"  Receipts "}`)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+	s.mockFolderRepo.On("Create", mock.Anything, mock.MatchedBy(func(f *models.Folder) bool {
+		return f.MailboxID == 1 && f.Name == "Receipts" && !f.IsSystem()
+	})).Return(nil)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+}
+
+// TestCreate_ReservedName tests creating a folder named like a system folder
+func (s *FolderHandlerTestSuite) TestCreate_ReservedName() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "1", `{"name":"trash"}`)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestCreate_Duplicate tests creating an existing folder
+func (s *FolderHandlerTestSuite) TestCreate_Duplicate() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "1", `{"name":"Work"}`)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+	s.mockFolderRepo.On("Create", mock.Anything, mock.Anything).Return(repository.ErrDuplicateEntry)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusConflict, rec.Code)
+}
+
+// TestRename_SystemFolder tests that system folders cannot be renamed
+func (s *FolderHandlerTestSuite) TestRename_SystemFolder() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPatch, "2", `{"name":"Old"}`)
+	s.mockFolderRepo.On("GetByID", mock.Anything, uint(2)).
+		Return(&models.Folder{ID: 2, MailboxID: 1, Name: "Archive", Role: models.FolderRoleArchive}, nil)
+
+	// Act
+	err := s.handler.Rename(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, rec.Code)
+}
+
+// TestDelete_Success tests deleting a custom folder
+func (s *FolderHandlerTestSuite) TestDelete_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodDelete, "5", "")
+	s.mockFolderRepo.On("GetByID", mock.Anything, uint(5)).Return(&models.Folder{ID: 5, MailboxID: 1, Name: "Work"}, nil)
+	s.mockFolderRepo.On("Delete", mock.Anything, uint(5)).Return(nil)
+
+	// Act
+	err := s.handler.Delete(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, rec.Code)
+}
+
+// TestMoveMessage_ToInbox tests that moving to the Inbox clears the folder
+func (s *FolderHandlerTestSuite) TestMoveMessage_ToInbox() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPut, "7", `{"folder_id":1}`)
+	folderID := uint(5)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Message{ID: 7, MailboxID: 1, FolderID: &folderID}, nil)
+	s.mockFolderRepo.On("GetByID", mock.Anything, uint(1)).
+		Return(&models.Folder{ID: 1, MailboxID: 1, Name: "Inbox", Role: models.FolderRoleInbox}, nil)
+	s.mockMessageRepo.On("SetFolderByIDs", mock.Anything, []uint{7}, (*uint)(nil)).Return(int64(1), nil)
+
+	// Act
+	err := s.handler.MoveMessage(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.NotContains(rec.Body.String(), "folder_id")
+}
+
+// TestMoveMessage_OtherMailbox tests moving to a folder of another mailbox
+func (s *FolderHandlerTestSuite) TestMoveMessage_OtherMailbox() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPut, "7", `{"folder_id":9}`)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Message{ID: 7, MailboxID: 1}, nil)
+	s.mockFolderRepo.On("GetByID", mock.Anything, uint(9)).Return(&models.Folder{ID: 9, MailboxID: 2, Name: "Work"}, nil)
+
+	// Act
+	err := s.handler.MoveMessage(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
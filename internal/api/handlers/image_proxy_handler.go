@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
+)
+
+// ImageProxyHandler serves remote images referenced by rendered messages
+type ImageProxyHandler struct {
+	proxy *imageproxy.Proxy
+}
+
+// NewImageProxyHandler creates a new ImageProxyHandler
+func NewImageProxyHandler(proxy *imageproxy.Proxy) *ImageProxyHandler {
+	return &ImageProxyHandler{proxy: proxy}
+}
+
+// Serve handles GET /proxy/image?url=...&sig=...
+// The signature, issued when a message is rendered with remote=proxy, authorizes
+// the request, so it works from <img> tags that cannot send an API key.
+func (h *ImageProxyHandler) Serve(c echo.Context) error {
+	remoteURL := c.QueryParam("url")
+	if remoteURL == "" || !h.proxy.Verify(remoteURL, c.QueryParam("sig")) {
+		return response.Forbidden(c, "invalid image proxy signature")
+	}
+
+	image, err := h.proxy.Fetch(c.Request().Context(), remoteURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, imageproxy.ErrInvalidURL), errors.Is(err, imageproxy.ErrForbiddenAddress):
+			return response.BadRequest(c, err.Error())
+		case errors.Is(err, imageproxy.ErrNotImage), errors.Is(err, imageproxy.ErrTooLarge):
+			return c.JSON(http.StatusBadGateway, response.ErrorResponse{Success: false, Error: err.Error()})
+		default:
+			return c.JSON(http.StatusBadGateway, response.ErrorResponse{Success: false, Error: "failed to fetch remote image"})
+		}
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "private, max-age=86400")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("Content-Disposition", "inline")
+	return c.Blob(http.StatusOK, image.ContentType, image.Data)
+}
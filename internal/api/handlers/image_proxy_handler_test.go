@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
+)
+
+// ImageProxyHandlerTestSuite is the test suite for ImageProxyHandler
+type ImageProxyHandlerTestSuite struct {
+	suite.Suite
+	echo     *echo.Echo
+	upstream *httptest.Server
+	proxy    *imageproxy.Proxy
+	handler  *ImageProxyHandler
+	image    []byte
+}
+
+// SetupTest runs before each test
+func (s *ImageProxyHandlerTestSuite) SetupTest() {
+	var buf bytes.Buffer
+	s.Require().NoError(png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	s.image = buf.Bytes()
+
+	s.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page.html" {
+			w.Write([]byte("<html><body>not an image</body></html>"))
+			return
+		}
+		w.Write(s.image)
+	}))
+
+	proxy, err := imageproxy.New(imageproxy.Config{Secret: []byte("secret"), AllowPrivateNetworks: true})
+	s.Require().NoError(err)
+	s.proxy = proxy
+	s.echo = echo.New()
+	s.handler = NewImageProxyHandler(proxy)
+}
+
+// TearDownTest runs after each test
+func (s *ImageProxyHandlerTestSuite) TearDownTest() {
+	s.upstream.Close()
+}
+
+// TestImageProxyHandlerTestSuite runs the test suite
+func TestImageProxyHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ImageProxyHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *ImageProxyHandlerTestSuite) createContext(target string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// TestServe_Success tests serving a signed remote image
+func (s *ImageProxyHandlerTestSuite) TestServe_Success() {
+	// Arrange
+	c, rec := s.createContext(s.proxy.URL(s.upstream.URL + "/logo.png"))
+
+	// Act
+	err := s.handler.Serve(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("image/png", rec.Header().Get(echo.HeaderContentType))
+	s.Equal("default-src 'none'; sandbox", rec.Header().Get("Content-Security-Policy"))
+	s.Equal(s.image, rec.Body.Bytes())
+}
+
+// TestServe_InvalidSignature tests that unsigned URLs are rejected
+func (s *ImageProxyHandlerTestSuite) TestServe_InvalidSignature() {
+	// Arrange
+	query := url.Values{"url": {s.upstream.URL + "/logo.png"}, "sig": {"deadbeef"}}
+	c, rec := s.createContext(imageproxy.Path + "?" + query.Encode())
+
+	// Act
+	err := s.handler.Serve(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, rec.Code)
+}
+
+// TestServe_MissingURL tests a request without a remote URL
+func (s *ImageProxyHandlerTestSuite) TestServe_MissingURL() {
+	// Arrange
+	c, rec := s.createContext(imageproxy.Path)
+
+	// Act
+	err := s.handler.Serve(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusForbidden, rec.Code)
+}
+
+// TestServe_NotImage tests that non-image remote content is not relayed
+func (s *ImageProxyHandlerTestSuite) TestServe_NotImage() {
+	// Arrange
+	c, rec := s.createContext(s.proxy.URL(s.upstream.URL + "/page.html"))
+
+	// Act
+	err := s.handler.Serve(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadGateway, rec.Code)
+	s.NotContains(rec.Body.String(), "not an image</body>")
+}
+
+// TestServe_InvalidScheme tests a signed URL with a scheme the proxy does not fetch
+func (s *ImageProxyHandlerTestSuite) TestServe_InvalidScheme() {
+	// Arrange
+	c, rec := s.createContext(s.proxy.URL("file:///etc/passwd"))
+
+	// Act
+	err := s.handler.Serve(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
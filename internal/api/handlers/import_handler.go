@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// maxImportUploadSize limits the request body of an import
+const maxImportUploadSize = 200 * 1024 * 1024
+
+// ImportHandler handles message imports into mailboxes
+type ImportHandler struct {
+	mailboxRepo repository.MailboxRepository
+	importer    *services.MailboxImporter
+}
+
+// NewImportHandler creates a new ImportHandler
+func NewImportHandler(mailboxRepo repository.MailboxRepository, importer *services.MailboxImporter) *ImportHandler {
+	return &ImportHandler{mailboxRepo: mailboxRepo, importer: importer}
+}
+
+// Import handles POST /api/mailboxes/:id/import
+// Accepts one or more multipart "file" fields holding .eml, mbox or zip-of-eml files
+// and stores every message as if it was received over SMTP. With preserve_date=true
+// the Date header of each message becomes its received time.
+func (h *ImportHandler) Import(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxImportUploadSize)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, response.ErrorResponse{
+				Success: false,
+				Error:   fmt.Sprintf("upload exceeds %d bytes", maxImportUploadSize),
+			})
+		}
+		return response.BadRequest(c, "request must be a multipart upload")
+	}
+	defer form.RemoveAll()
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		return response.BadRequest(c, "file is required")
+	}
+
+	preserveDate := false
+	if v := c.FormValue("preserve_date"); v != "" {
+		if preserveDate, err = strconv.ParseBool(v); err != nil {
+			return response.BadRequest(c, "preserve_date must be a boolean")
+		}
+	}
+
+	ctx := req.Context()
+	mailbox, err := h.mailboxRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	report := &services.ImportReport{Results: []services.ImportResult{}}
+	for _, fileHeader := range files {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return response.InternalError(c, "failed to read upload")
+		}
+		err = h.importer.ImportFile(ctx, mailbox, fileHeader.Filename, file, fileHeader.Size, preserveDate, report)
+		file.Close()
+		if err != nil {
+			return response.InternalError(c, "import was interrupted")
+		}
+	}
+
+	return response.Success(c, report)
+}
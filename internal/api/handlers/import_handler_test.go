@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// stubDeliverer stores nothing and numbers delivered messages
+type stubDeliverer struct {
+	preserveDate bool
+	count        int
+}
+
+func (d *stubDeliverer) DeliverRaw(_ context.Context, mailbox *models.Mailbox, _ []byte, preserveDate bool) (*models.Message, error) {
+	d.count++
+	d.preserveDate = preserveDate
+	return &models.Message{ID: uint(d.count), MailboxID: mailbox.ID}, nil
+}
+
+// ImportHandlerTestSuite is the test suite for ImportHandler
+type ImportHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *ImportHandler
+	deliverer       *stubDeliverer
+	mockMailboxRepo *mocks.MockMailboxRepository
+}
+
+// SetupTest runs before each test
+func (s *ImportHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.deliverer = &stubDeliverer{}
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.handler = NewImportHandler(s.mockMailboxRepo, services.NewMailboxImporter(s.deliverer))
+}
+
+// TearDownTest runs after each test
+func (s *ImportHandlerTestSuite) TearDownTest() {
+	s.mockMailboxRepo.AssertExpectations(s.T())
+}
+
+// TestImportHandlerTestSuite runs the test suite
+func TestImportHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ImportHandlerTestSuite))
+}
+
+// Helper function to create a multipart upload context
+func (s *ImportHandlerTestSuite) createContext(id string, fields map[string]string, files map[string]string) (echo.Context, *httptest.ResponseRecorder) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		s.Require().NoError(mw.WriteField(name, value))
+	}
+	for filename, content := range files {
+		w, err := mw.CreateFormFile("file", filename)
+		s.Require().NoError(err)
+		_, _ = w.Write([]byte(content))
+	}
+	s.Require().NoError(mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/mailboxes/"+id+"/import", &body)
+	req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+// TestImport_Success tests importing an .eml and an mbox upload
+func (s *ImportHandlerTestSuite) TestImport_Success() {
+	// Arrange
+	mbox := "From a@example.com Tue Mar  5 08:30:00 2024\nSubject: one\n\n" +
+		"From b@example.com Tue Mar  5 08:31:00 2024\nSubject: two\n"
+	c, rec := s.createContext("1", map[string]string{"preserve_date": "true"}, map[string]string{
+		"single.eml":   "Subject: hi\r\n\r\nbody\r\n",
+		"archive.mbox": mbox,
+	})
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+
+	// Act
+	err := s.handler.Import(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	var resp struct {
+		Data services.ImportReport `json:"data"`
+	}
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	s.Equal(3, resp.Data.Imported)
+	s.Equal(0, resp.Data.Failed)
+	s.Len(resp.Data.Results, 3)
+	s.True(s.deliverer.preserveDate)
+}
+
+// TestImport_MissingFile tests a request without uploads
+func (s *ImportHandlerTestSuite) TestImport_MissingFile() {
+	// Arrange
+	c, rec := s.createContext("1", map[string]string{"preserve_date": "true"}, nil)
+
+	// Act
+	err := s.handler.Import(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestImport_InvalidPreserveDate tests a non-boolean preserve_date
+func (s *ImportHandlerTestSuite) TestImport_InvalidPreserveDate() {
+	// Arrange
+	c, rec := s.createContext("1", map[string]string{"preserve_date": "maybe"}, map[string]string{"a.eml": "Subject: a\r\n\r\n"})
+
+	// Act
+	err := s.handler.Import(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestImport_MailboxNotFound tests importing into a non-existent mailbox
+func (s *ImportHandlerTestSuite) TestImport_MailboxNotFound() {
+	// Arrange
+	c, rec := s.createContext("999", nil, map[string]string{"a.eml": "Subject: a\r\n\r\n"})
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(999)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Import(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+	s.Equal(0, s.deliverer.count)
+}
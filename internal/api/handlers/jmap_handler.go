@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/jmap"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// jmapPollInterval is how often event sources check the change log
+const jmapPollInterval = 2 * time.Second
+
+// jmapMinPing is the shortest ping interval an event source can ask for
+const jmapMinPing = 10 * time.Second
+
+// errJMAPUnauthorized is returned when the Basic credentials are missing or wrong
+var errJMAPUnauthorized = errors.New("unauthorized")
+
+// JMAPHandler serves the JMAP session, API, download and push endpoints. Clients
+// log in with HTTP Basic using the mailbox address and its mail client password.
+type JMAPHandler struct {
+	mailboxRepo  repository.MailboxRepository
+	auth         *mailauth.Authenticator
+	server       *jmap.Server
+	baseURL      string
+	pollInterval time.Duration
+}
+
+// NewJMAPHandler creates a new JMAPHandler. Session URLs start with baseURL, or
+// with the scheme and host of the request when it is empty.
+func NewJMAPHandler(mailboxRepo repository.MailboxRepository, auth *mailauth.Authenticator, server *jmap.Server, baseURL string) *JMAPHandler {
+	return &JMAPHandler{
+		mailboxRepo:  mailboxRepo,
+		auth:         auth,
+		server:       server,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		pollInterval: jmapPollInterval,
+	}
+}
+
+// WellKnown handles GET /.well-known/jmap
+// Redirects to the session resource (RFC 8620 section 2.2)
+func (h *JMAPHandler) WellKnown(c echo.Context) error {
+	return c.Redirect(http.StatusTemporaryRedirect, h.base(c)+"/jmap/session")
+}
+
+// Session handles GET /jmap/session
+// Returns the session resource of the authenticated mailbox
+func (h *JMAPHandler) Session(c echo.Context) error {
+	mailbox, err := h.authenticate(c)
+	if err != nil {
+		return h.authError(c, err)
+	}
+
+	base := h.base(c)
+	return c.JSON(http.StatusOK, h.server.Session(mailbox, jmap.SessionURLs{
+		API:         base + "/jmap/api",
+		Download:    base + "/jmap/download/{accountId}/{blobId}/{name}?accept={type}",
+		Upload:      base + "/jmap/upload/{accountId}/",
+		EventSource: base + "/jmap/eventsource?types={types}&closeafter={closeafter}&ping={ping}",
+	}))
+}
+
+// API handles POST /jmap/api
+// Runs the method calls of a JMAP request
+func (h *JMAPHandler) API(c echo.Context) error {
+	mailbox, err := h.authenticate(c)
+	if err != nil {
+		return h.authError(c, err)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, jmap.MaxSizeRequest+1))
+	if err != nil {
+		return jmapProblem(c, &jmap.Problem{Type: jmap.ProblemNotRequest, Status: http.StatusBadRequest, Detail: "failed to read request"})
+	}
+	if len(body) > jmap.MaxSizeRequest {
+		return jmapProblem(c, &jmap.Problem{Type: jmap.ProblemLimit, Status: http.StatusBadRequest, Limit: "maxSizeRequest",
+			Detail: fmt.Sprintf("requests are limited to %d bytes", jmap.MaxSizeRequest)})
+	}
+	if !json.Valid(body) {
+		return jmapProblem(c, &jmap.Problem{Type: jmap.ProblemNotJSON, Status: http.StatusBadRequest, Detail: "request is not JSON"})
+	}
+	var req jmap.Request
+	if err := json.Unmarshal(body, &req); err != nil || req.Using == nil || req.MethodCalls == nil {
+		return jmapProblem(c, &jmap.Problem{Type: jmap.ProblemNotRequest, Status: http.StatusBadRequest, Detail: "request is not a JMAP request"})
+	}
+
+	resp, err := h.server.Handle(c.Request().Context(), mailbox, &req)
+	if err != nil {
+		var problem *jmap.Problem
+		if errors.As(err, &problem) {
+			return jmapProblem(c, problem)
+		}
+		return response.InternalError(c, "failed to process request")
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Download handles GET /jmap/download/:accountId/:blobId/:name?accept=type
+// Streams a message source, body or attachment
+func (h *JMAPHandler) Download(c echo.Context) error {
+	mailbox, err := h.authenticate(c)
+	if err != nil {
+		return h.authError(c, err)
+	}
+	if c.Param("accountId") != strconv.FormatUint(uint64(mailbox.ID), 10) {
+		return response.NotFound(c, "account not found")
+	}
+
+	blob, err := h.server.Blob(c.Request().Context(), mailbox, c.Param("blobId"))
+	if err != nil {
+		if errors.Is(err, jmap.ErrBlobNotFound) {
+			return response.NotFound(c, "blob not found")
+		}
+		return response.InternalError(c, "failed to read blob")
+	}
+	defer blob.Content.Close()
+
+	contentType := blob.Type
+	if accept := c.QueryParam("accept"); accept != "" {
+		if _, _, err := mime.ParseMediaType(accept); err == nil {
+			contentType = accept
+		}
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		mime.FormatMediaType("attachment", map[string]string{"filename": c.Param("name")}))
+	c.Response().Header().Set("Cache-Control", "private, immutable, max-age=31536000")
+	return c.Stream(http.StatusOK, contentType, blob.Content)
+}
+
+// Upload handles POST /jmap/upload/:accountId/
+// Uploads are not supported; the session advertises a maxSizeUpload of 0
+func (h *JMAPHandler) Upload(c echo.Context) error {
+	if _, err := h.authenticate(c); err != nil {
+		return h.authError(c, err)
+	}
+	return jmapProblem(c, &jmap.Problem{Type: jmap.ProblemLimit, Status: http.StatusRequestEntityTooLarge,
+		Limit: "maxSizeUpload", Detail: "uploads are not supported"})
+}
+
+// EventSource handles GET /jmap/eventsource?types=&closeafter=&ping=
+// Pushes StateChange events (RFC 8620 section 7.3) when the messages of the
+// mailbox change. Folder changes are pushed with the next message change.
+func (h *JMAPHandler) EventSource(c echo.Context) error {
+	mailbox, err := h.authenticate(c)
+	if err != nil {
+		return h.authError(c, err)
+	}
+
+	types := map[string]bool{}
+	for _, name := range strings.Split(c.QueryParam("types"), ",") {
+		if name = strings.TrimSpace(name); name != "" && name != "*" {
+			types[name] = true
+		}
+	}
+	closeAfterState := c.QueryParam("closeafter") == "state"
+	var ping time.Duration
+	if value := c.QueryParam("ping"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return response.BadRequest(c, "ping must be a number of seconds")
+		}
+		ping = time.Duration(seconds) * time.Second
+		if ping > 0 && ping < jmapMinPing {
+			ping = jmapMinPing
+		}
+	}
+
+	ctx := c.Request().Context()
+	states, since, err := h.server.States(ctx, mailbox)
+	if err != nil {
+		return response.InternalError(c, "failed to get state")
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// push sends the states of the requested types that changed since the last
+	// event and reports whether there were any
+	sent := map[string]string{}
+	push := func() (bool, error) {
+		changed := map[string]string{}
+		for name, state := range states {
+			if (len(types) == 0 || types[name]) && sent[name] != state {
+				changed[name] = state
+				sent[name] = state
+			}
+		}
+		if len(changed) == 0 {
+			return false, nil
+		}
+		data, _ := json.Marshal(jmap.NewStateChange(mailbox, changed))
+		if _, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", data); err != nil {
+			return false, err
+		}
+		w.Flush()
+		return true, nil
+	}
+
+	if closeAfterState {
+		// Long polling: only a change ends the response
+		for name, state := range states {
+			sent[name] = state
+		}
+	} else if _, err := push(); err != nil {
+		return nil
+	}
+	w.Flush()
+
+	poll := time.NewTicker(h.pollInterval)
+	defer poll.Stop()
+	var pings <-chan time.Time
+	if ping > 0 {
+		pingTicker := time.NewTicker(ping)
+		defer pingTicker.Stop()
+		pings = pingTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-pings:
+			if _, err := fmt.Fprintf(w, "event: ping\ndata: {\"interval\":%d}\n\n", int(ping/time.Second)); err != nil {
+				return nil
+			}
+			w.Flush()
+		case <-poll.C:
+			changed, err := h.server.HasChanges(ctx, mailbox, since)
+			if err != nil || !changed {
+				continue
+			}
+			if states, since, err = h.server.States(ctx, mailbox); err != nil {
+				continue
+			}
+			pushed, err := push()
+			if err != nil || (pushed && closeAfterState) {
+				return nil
+			}
+		}
+	}
+}
+
+// authenticate returns the mailbox named by the Basic credentials of the request
+func (h *JMAPHandler) authenticate(c echo.Context) (*models.Mailbox, error) {
+	username, password, ok := c.Request().BasicAuth()
+	if !ok {
+		return nil, errJMAPUnauthorized
+	}
+	address := strings.ToLower(strings.TrimSpace(username))
+	if !h.auth.Verify(address, password) {
+		return nil, errJMAPUnauthorized
+	}
+	mailbox, err := h.mailboxRepo.GetByAddress(c.Request().Context(), address)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errJMAPUnauthorized
+		}
+		return nil, err
+	}
+	return mailbox, nil
+}
+
+// authError responds to a failed authentication
+func (h *JMAPHandler) authError(c echo.Context, err error) error {
+	if errors.Is(err, errJMAPUnauthorized) {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="Infinimail JMAP", charset="UTF-8"`)
+		return jmapProblem(c, &jmap.Problem{Type: "about:blank", Status: http.StatusUnauthorized, Detail: "invalid credentials"})
+	}
+	return response.InternalError(c, "failed to authenticate")
+}
+
+// base returns the external URL the JMAP endpoints are served under
+func (h *JMAPHandler) base(c echo.Context) string {
+	if h.baseURL != "" {
+		return h.baseURL
+	}
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+// jmapProblem writes a request-level error as application/problem+json (RFC 7807)
+func jmapProblem(c echo.Context, problem *jmap.Problem) error {
+	data, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	return c.Blob(problem.Status, "application/problem+json", data)
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/jmap"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// JMAPHandlerTestSuite is the test suite for JMAPHandler
+type JMAPHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *JMAPHandler
+	auth            *mailauth.Authenticator
+	mailbox         *models.Mailbox
+	mockMailboxRepo *mocks.MockMailboxRepository
+	mockMessageRepo *mocks.MockMessageRepository
+	mockFolderRepo  *mocks.MockFolderRepository
+	mockChangeRepo  *mocks.MockMessageChangeRepository
+}
+
+// SetupTest runs before each test
+func (s *JMAPHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.mockFolderRepo = new(mocks.MockFolderRepository)
+	s.mockChangeRepo = new(mocks.MockMessageChangeRepository)
+	auth, err := mailauth.New(bytes.Repeat([]byte("k"), mailauth.MinSecretLength), "")
+	s.Require().NoError(err)
+	s.auth = auth
+	s.mailbox = &models.Mailbox{ID: 1, FullAddress: "qa@example.com"}
+
+	server := jmap.NewServer(&jmap.ServerConfig{
+		MessageRepo: s.mockMessageRepo,
+		FolderRepo:  s.mockFolderRepo,
+		ChangeRepo:  s.mockChangeRepo,
+	})
+	s.handler = NewJMAPHandler(s.mockMailboxRepo, auth, server, "")
+	s.handler.pollInterval = 10 * time.Millisecond
+}
+
+// TearDownTest runs after each test
+func (s *JMAPHandlerTestSuite) TearDownTest() {
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockMessageRepo.AssertExpectations(s.T())
+	s.mockFolderRepo.AssertExpectations(s.T())
+	s.mockChangeRepo.AssertExpectations(s.T())
+}
+
+// TestJMAPHandlerTestSuite runs the test suite
+func TestJMAPHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(JMAPHandlerTestSuite))
+}
+
+// Helper function to create a test context authenticated as the mailbox
+func (s *JMAPHandlerTestSuite) createContext(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.SetBasicAuth(s.mailbox.FullAddress, s.auth.Password(s.mailbox.FullAddress))
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// expectLogin expects the mailbox to be looked up after the password is verified
+func (s *JMAPHandlerTestSuite) expectLogin() {
+	s.mockMailboxRepo.On("GetByAddress", mock.Anything, s.mailbox.FullAddress).Return(s.mailbox, nil)
+}
+
+// TestSession_Success tests returning the session resource with request-based URLs
+func (s *JMAPHandlerTestSuite) TestSession_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/session", "")
+	s.expectLogin()
+
+	// Act
+	err := s.handler.Session(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"apiUrl":"http://example.com/jmap/api"`)
+	s.Contains(rec.Body.String(), `"username":"qa@example.com"`)
+	s.Contains(rec.Body.String(), `"urn:ietf:params:jmap:mail":"1"`)
+}
+
+// TestSession_InvalidPassword tests that a wrong password is rejected before any lookup
+func (s *JMAPHandlerTestSuite) TestSession_InvalidPassword() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/session", "")
+	c.Request().SetBasicAuth(s.mailbox.FullAddress, "wrong")
+
+	// Act
+	err := s.handler.Session(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+	s.Contains(rec.Header().Get(echo.HeaderWWWAuthenticate), "Basic")
+	s.Equal("application/problem+json", rec.Header().Get(echo.HeaderContentType))
+}
+
+// TestSession_UnknownMailbox tests valid credentials for a deleted mailbox
+func (s *JMAPHandlerTestSuite) TestSession_UnknownMailbox() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/session", "")
+	s.mockMailboxRepo.On("GetByAddress", mock.Anything, s.mailbox.FullAddress).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Session(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+}
+
+// TestWellKnown_Redirects tests the redirect to the session resource
+func (s *JMAPHandlerTestSuite) TestWellKnown_Redirects() {
+	// Arrange
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jmap", nil)
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+
+	// Act
+	err := s.handler.WellKnown(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusTemporaryRedirect, rec.Code)
+	s.Equal("http://example.com/jmap/session", rec.Header().Get(echo.HeaderLocation))
+}
+
+// TestAPI_Echo tests running a method call
+func (s *JMAPHandlerTestSuite) TestAPI_Echo() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/jmap/api",
+		`{"using":["urn:ietf:params:jmap:core"],"methodCalls":[["Core/echo",{"ping":"pong"},"c1"]]}`)
+	s.expectLogin()
+
+	// Act
+	err := s.handler.API(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"methodResponses":[["Core/echo",{"ping":"pong"},"c1"]]`)
+	s.Contains(rec.Body.String(), `"sessionState"`)
+}
+
+// TestAPI_RequestErrors tests the request-level errors
+func (s *JMAPHandlerTestSuite) TestAPI_RequestErrors() {
+	tests := []struct {
+		name    string
+		body    string
+		problem string
+	}{
+		{"not JSON", `{"using":`, jmap.ProblemNotJSON},
+		{"not a request", `{"hello":"world"}`, jmap.ProblemNotRequest},
+		{"unknown capability", `{"using":["urn:example:unknown"],"methodCalls":[]}`, jmap.ProblemUnknownCapability},
+	}
+	s.expectLogin()
+
+	for _, tt := range tests {
+		// Arrange
+		c, rec := s.createContext(http.MethodPost, "/jmap/api", tt.body)
+
+		// Act
+		err := s.handler.API(c)
+
+		// Assert
+		s.NoError(err, tt.name)
+		s.Equal(http.StatusBadRequest, rec.Code, tt.name)
+		s.Equal("application/problem+json", rec.Header().Get(echo.HeaderContentType), tt.name)
+		s.Contains(rec.Body.String(), tt.problem, tt.name)
+	}
+}
+
+// TestDownload_Success tests downloading the text body of a message
+func (s *JMAPHandlerTestSuite) TestDownload_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/download/1/P7/body.txt", "")
+	c.SetParamNames("accountId", "blobId", "name")
+	c.SetParamValues("1", "P7", "body.txt")
+	s.expectLogin()
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(7)).
+		Return(&models.Message{ID: 7, MailboxID: 1, BodyText: "hello"}, nil)
+
+	// Act
+	err := s.handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("hello", rec.Body.String())
+	s.Equal("text/plain; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	s.Contains(rec.Header().Get(echo.HeaderContentDisposition), `filename=body.txt`)
+}
+
+// TestDownload_OtherMailbox tests that blobs of other mailboxes are not found
+func (s *JMAPHandlerTestSuite) TestDownload_OtherMailbox() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/download/1/P7/body.txt", "")
+	c.SetParamNames("accountId", "blobId", "name")
+	c.SetParamValues("1", "P7", "body.txt")
+	s.expectLogin()
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(7)).
+		Return(&models.Message{ID: 7, MailboxID: 2, BodyText: "secret"}, nil)
+
+	// Act
+	err := s.handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+	s.NotContains(rec.Body.String(), "secret")
+}
+
+// TestDownload_OtherAccount tests a download URL naming another account
+func (s *JMAPHandlerTestSuite) TestDownload_OtherAccount() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/download/2/P7/body.txt", "")
+	c.SetParamNames("accountId", "blobId", "name")
+	c.SetParamValues("2", "P7", "body.txt")
+	s.expectLogin()
+
+	// Act
+	err := s.handler.Download(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestUpload_NotSupported tests that uploads are refused
+func (s *JMAPHandlerTestSuite) TestUpload_NotSupported() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/jmap/upload/1/", "data")
+	s.expectLogin()
+
+	// Act
+	err := s.handler.Upload(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+	s.Contains(rec.Body.String(), "maxSizeUpload")
+}
+
+// TestEventSource_CloseAfterState tests that a change is pushed and ends a long poll
+func (s *JMAPHandlerTestSuite) TestEventSource_CloseAfterState() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/eventsource?types=Email&closeafter=state&ping=0", "")
+	s.expectLogin()
+	s.mockChangeRepo.On("LatestSeq", mock.Anything, uint(1)).Return(uint(5), nil).Once()
+	s.mockChangeRepo.On("LatestSeq", mock.Anything, uint(1)).Return(uint(6), nil).Once()
+	s.mockFolderRepo.On("ListByMailbox", mock.Anything, uint(1)).Return([]models.FolderWithCounts{}, nil)
+	s.mockChangeRepo.On("HasChangesSince", mock.Anything, uint(1), uint(5)).Return(true, nil).Once()
+
+	// Act
+	err := s.handler.EventSource(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal("text/event-stream", rec.Header().Get(echo.HeaderContentType))
+	body, _ := io.ReadAll(rec.Body)
+	s.Equal(1, strings.Count(string(body), "event: state"))
+	s.Contains(string(body), `"changed":{"1":{"Email":"6"}}`)
+}
+
+// TestEventSource_InvalidPing tests a malformed ping interval
+func (s *JMAPHandlerTestSuite) TestEventSource_InvalidPing() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/jmap/eventsource?types=*&closeafter=no&ping=soon", "")
+	s.expectLogin()
+
+	// Act
+	err := s.handler.EventSource(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// labelColorPattern matches #rrggbb colors
+var labelColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// LabelHandler handles label-related HTTP requests
+type LabelHandler struct {
+	labelRepo   repository.LabelRepository
+	mailboxRepo repository.MailboxRepository
+	messageRepo repository.MessageRepository
+}
+
+// NewLabelHandler creates a new LabelHandler
+func NewLabelHandler(
+	labelRepo repository.LabelRepository,
+	mailboxRepo repository.MailboxRepository,
+	messageRepo repository.MessageRepository,
+) *LabelHandler {
+	return &LabelHandler{
+		labelRepo:   labelRepo,
+		mailboxRepo: mailboxRepo,
+		messageRepo: messageRepo,
+	}
+}
+
+// LabelRequest represents the request body for creating or updating a label;
+// omitted fields are left unchanged on update
+type LabelRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+// MessageLabelsRequest represents the request body for setting the labels of a message
+type MessageLabelsRequest struct {
+	LabelIDs []uint `json:"label_ids"`
+}
+
+// List handles GET /api/mailboxes/:id/labels
+func (h *LabelHandler) List(c echo.Context) error {
+	mailboxID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	if _, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(mailboxID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	labels, err := h.labelRepo.ListByMailbox(c.Request().Context(), uint(mailboxID))
+	if err != nil {
+		return response.InternalError(c, "failed to list labels")
+	}
+
+	return response.Success(c, labels)
+}
+
+// Create handles POST /api/mailboxes/:id/labels
+// color is a #rrggbb value and defaults to grey.
+func (h *LabelHandler) Create(c echo.Context) error {
+	mailboxID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	var req LabelRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	label := &models.Label{MailboxID: uint(mailboxID), Color: models.DefaultLabelColor}
+	if req.Name == nil {
+		return response.BadRequest(c, "name is required")
+	}
+	if err := applyLabelRequest(label, req); err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+
+	if _, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(mailboxID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	if err := h.labelRepo.Create(c.Request().Context(), label); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return response.Conflict(c, "label already exists")
+		}
+		return response.InternalError(c, "failed to create label")
+	}
+
+	return response.Created(c, label)
+}
+
+// Update handles PATCH /api/labels/:id
+func (h *LabelHandler) Update(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid label ID")
+	}
+
+	var req LabelRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+
+	ctx := c.Request().Context()
+	label, err := h.labelRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "label not found")
+		}
+		return response.InternalError(c, "failed to get label")
+	}
+	if err := applyLabelRequest(label, req); err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+
+	if err := h.labelRepo.Update(ctx, label); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return response.Conflict(c, "label already exists")
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "label not found")
+		}
+		return response.InternalError(c, "failed to update label")
+	}
+
+	return response.Success(c, label)
+}
+
+// Delete handles DELETE /api/labels/:id
+// The label is removed from all of its messages.
+func (h *LabelHandler) Delete(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid label ID")
+	}
+
+	if err := h.labelRepo.Delete(c.Request().Context(), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "label not found")
+		}
+		return response.InternalError(c, "failed to delete label")
+	}
+
+	return response.NoContent(c)
+}
+
+// ListMessageLabels handles GET /api/messages/:id/labels
+func (h *LabelHandler) ListMessageLabels(c echo.Context) error {
+	message, ok, err := h.message(c)
+	if !ok {
+		return err
+	}
+
+	labels, err := h.labelRepo.ListByMessage(c.Request().Context(), message.ID)
+	if err != nil {
+		return response.InternalError(c, "failed to list labels")
+	}
+
+	return response.Success(c, labels)
+}
+
+// SetMessageLabels handles PUT /api/messages/:id/labels
+// Replaces the labels of a message; every label must belong to the message's mailbox.
+func (h *LabelHandler) SetMessageLabels(c echo.Context) error {
+	message, ok, err := h.message(c)
+	if !ok {
+		return err
+	}
+
+	var req MessageLabelsRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+
+	ctx := c.Request().Context()
+	available, err := h.labelRepo.ListByMailbox(ctx, message.MailboxID)
+	if err != nil {
+		return response.InternalError(c, "failed to list labels")
+	}
+	byID := make(map[uint]models.Label, len(available))
+	for _, label := range available {
+		byID[label.ID] = label
+	}
+	labels := make([]models.Label, 0, len(req.LabelIDs))
+	labelIDs := make([]uint, 0, len(req.LabelIDs))
+	seen := make(map[uint]bool, len(req.LabelIDs))
+	for _, id := range req.LabelIDs {
+		label, ok := byID[id]
+		if !ok {
+			return response.BadRequest(c, fmt.Sprintf("label %d does not belong to the mailbox", id))
+		}
+		if !seen[id] {
+			seen[id] = true
+			labels = append(labels, label)
+			labelIDs = append(labelIDs, id)
+		}
+	}
+
+	if err := h.labelRepo.SetMessageLabels(ctx, message.ID, labelIDs); err != nil {
+		return response.InternalError(c, "failed to set labels")
+	}
+
+	return response.Success(c, labels)
+}
+
+// message loads the message of the :id parameter.
+// When ok is false the error response has already been written.
+func (h *LabelHandler) message(c echo.Context) (*models.Message, bool, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, false, response.BadRequest(c, "invalid message ID")
+	}
+
+	message, err := h.messageRepo.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, false, response.NotFound(c, "message not found")
+		}
+		return nil, false, response.InternalError(c, "failed to get message")
+	}
+	return message, true, nil
+}
+
+// applyLabelRequest validates the fields of req and copies them to label
+func applyLabelRequest(label *models.Label, req LabelRequest) error {
+	if req.Name != nil {
+		name, err := validateName(*req.Name)
+		if err != nil {
+			return err
+		}
+		label.Name = name
+	}
+	if req.Color != nil {
+		color := strings.ToLower(strings.TrimSpace(*req.Color))
+		if !labelColorPattern.MatchString(color) {
+			return errors.New("color must be a #rrggbb value")
+		}
+		label.Color = color
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// LabelHandlerTestSuite is the test suite for LabelHandler
+type LabelHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *LabelHandler
+	mockLabelRepo   *mocks.MockLabelRepository
+	mockMailboxRepo *mocks.MockMailboxRepository
+	mockMessageRepo *mocks.MockMessageRepository
+}
+
+// SetupTest runs before each test
+func (s *LabelHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockLabelRepo = new(mocks.MockLabelRepository)
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.handler = NewLabelHandler(s.mockLabelRepo, s.mockMailboxRepo, s.mockMessageRepo)
+}
+
+// TearDownTest runs after each test
+func (s *LabelHandlerTestSuite) TearDownTest() {
+	s.mockLabelRepo.AssertExpectations(s.T())
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockMessageRepo.AssertExpectations(s.T())
+}
+
+// TestLabelHandlerTestSuite runs the test suite
+func TestLabelHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(LabelHandlerTestSuite))
+}
+
+// Helper function to create a test context with an :id parameter
+func (s *LabelHandlerTestSuite) createContext(method, id, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+// TestCreate_DefaultColor tests creating a label without a color
+func (s *LabelHandlerTestSuite) TestCreate_DefaultColor() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "1", `{"name":"work"}`)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(&models.Mailbox{ID: 1}, nil)
+	s.mockLabelRepo.On("Create", mock.Anything, mock.MatchedBy(func(l *models.Label) bool {
+		return l.MailboxID == 1 && l.Name == "work" && l.Color == models.DefaultLabelColor
+	})).Return(nil)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+}
+
+// TestCreate_InvalidColor tests creating a label with a malformed color
+func (s *LabelHandlerTestSuite) TestCreate_InvalidColor() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "1", `{"name":"work","color":"red"}`)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestUpdate_Color tests changing only the color of a label
+func (s *LabelHandlerTestSuite) TestUpdate_Color() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPatch, "3", `{"color":"#FF8800"}`)
+	s.mockLabelRepo.On("GetByID", mock.Anything, uint(3)).
+		Return(&models.Label{ID: 3, MailboxID: 1, Name: "work", Color: models.DefaultLabelColor}, nil)
+	s.mockLabelRepo.On("Update", mock.Anything, mock.MatchedBy(func(l *models.Label) bool {
+		return l.Name == "work" && l.Color == "#ff8800"
+	})).Return(nil)
+
+	// Act
+	err := s.handler.Update(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+}
+
+// TestDelete_NotFound tests deleting a non-existent label
+func (s *LabelHandlerTestSuite) TestDelete_NotFound() {
+	// Arrange
+	c, rec := s.createContext(http.MethodDelete, "3", "")
+	s.mockLabelRepo.On("Delete", mock.Anything, uint(3)).Return(repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Delete(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestSetMessageLabels_Success tests replacing the labels of a message
+func (s *LabelHandlerTestSuite) TestSetMessageLabels_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPut, "7", `{"label_ids":[2,3,2]}`)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Message{ID: 7, MailboxID: 1}, nil)
+	s.mockLabelRepo.On("ListByMailbox", mock.Anything, uint(1)).Return([]models.Label{
+		{ID: 2, MailboxID: 1, Name: "home"}, {ID: 3, MailboxID: 1, Name: "work"},
+	}, nil)
+	s.mockLabelRepo.On("SetMessageLabels", mock.Anything, uint(7), []uint{2, 3}).Return(nil)
+
+	// Act
+	err := s.handler.SetMessageLabels(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"name":"work"`)
+}
+
+// TestSetMessageLabels_ForeignLabel tests assigning a label of another mailbox
+func (s *LabelHandlerTestSuite) TestSetMessageLabels_ForeignLabel() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPut, "7", `{"label_ids":[9]}`)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(7)).Return(&models.Message{ID: 7, MailboxID: 1}, nil)
+	s.mockLabelRepo.On("ListByMailbox", mock.Anything, uint(1)).Return([]models.Label{}, nil)
+
+	// Act
+	err := s.handler.SetMessageLabels(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
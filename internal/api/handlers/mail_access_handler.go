@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// MailAccessServers describes where mail clients connect; a zero port is not served
+type MailAccessServers struct {
+	Host      string
+	IMAPPort  int
+	IMAPSPort int
+	POP3Port  int
+	POP3SPort int
+}
+
+// MailAccessCredentials is the response body of the credentials endpoint
+type MailAccessCredentials struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Host      string `json:"host"`
+	IMAPPort  int    `json:"imap_port,omitempty"`
+	IMAPSPort int    `json:"imaps_port,omitempty"`
+	POP3Port  int    `json:"pop3_port,omitempty"`
+	POP3SPort int    `json:"pop3s_port,omitempty"`
+}
+
+// MailAccessHandler hands out the credentials mail clients log in with
+type MailAccessHandler struct {
+	mailboxRepo repository.MailboxRepository
+	auth        *mailauth.Authenticator
+	servers     MailAccessServers
+}
+
+// NewMailAccessHandler creates a new MailAccessHandler
+func NewMailAccessHandler(mailboxRepo repository.MailboxRepository, auth *mailauth.Authenticator, servers MailAccessServers) *MailAccessHandler {
+	return &MailAccessHandler{
+		mailboxRepo: mailboxRepo,
+		auth:        auth,
+		servers:     servers,
+	}
+}
+
+// Credentials handles GET /api/mailboxes/:id/credentials
+// Returns the username and password a mail client uses for the mailbox
+func (h *MailAccessHandler) Credentials(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	mailbox, err := h.mailboxRepo.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	return response.Success(c, MailAccessCredentials{
+		Username:  mailbox.FullAddress,
+		Password:  h.auth.Password(mailbox.FullAddress),
+		Host:      h.servers.Host,
+		IMAPPort:  h.servers.IMAPPort,
+		IMAPSPort: h.servers.IMAPSPort,
+		POP3Port:  h.servers.POP3Port,
+		POP3SPort: h.servers.POP3SPort,
+	})
+}
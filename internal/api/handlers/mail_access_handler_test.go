@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// MailAccessHandlerTestSuite is the test suite for MailAccessHandler
+type MailAccessHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *MailAccessHandler
+	auth            *mailauth.Authenticator
+	mockMailboxRepo *mocks.MockMailboxRepository
+}
+
+// SetupTest runs before each test
+func (s *MailAccessHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	auth, err := mailauth.New(bytes.Repeat([]byte("k"), mailauth.MinSecretLength), "")
+	s.Require().NoError(err)
+	s.auth = auth
+	s.handler = NewMailAccessHandler(s.mockMailboxRepo, auth, MailAccessServers{Host: "mail.example.com", IMAPPort: 143, POP3SPort: 995})
+}
+
+// TearDownTest runs after each test
+func (s *MailAccessHandlerTestSuite) TearDownTest() {
+	s.mockMailboxRepo.AssertExpectations(s.T())
+}
+
+// TestMailAccessHandlerTestSuite runs the test suite
+func TestMailAccessHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(MailAccessHandlerTestSuite))
+}
+
+// Helper function to create a test context with an :id parameter
+func (s *MailAccessHandlerTestSuite) createContext(id string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := s.echo.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	return c, rec
+}
+
+// TestCredentials_Success tests returning the client credentials of a mailbox
+func (s *MailAccessHandlerTestSuite) TestCredentials_Success() {
+	// Arrange
+	c, rec := s.createContext("1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).
+		Return(&models.Mailbox{ID: 1, FullAddress: "qa@example.com"}, nil)
+
+	// Act
+	err := s.handler.Credentials(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"username":"qa@example.com"`)
+	s.Contains(rec.Body.String(), `"password":"`+s.auth.Password("qa@example.com")+`"`)
+	s.Contains(rec.Body.String(), `"host":"mail.example.com"`)
+	s.Contains(rec.Body.String(), `"imap_port":143`)
+	s.Contains(rec.Body.String(), `"pop3s_port":995`)
+	s.NotContains(rec.Body.String(), "imaps_port")
+	s.NotContains(rec.Body.String(), `"pop3_port"`)
+}
+
+// TestCredentials_InvalidID tests a non-numeric mailbox ID
+func (s *MailAccessHandlerTestSuite) TestCredentials_InvalidID() {
+	// Arrange
+	c, rec := s.createContext("abc")
+
+	// Act
+	err := s.handler.Credentials(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestCredentials_NotFound tests an unknown mailbox
+func (s *MailAccessHandlerTestSuite) TestCredentials_NotFound() {
+	// Arrange
+	c, rec := s.createContext("9")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Credentials(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
@@ -5,17 +5,20 @@ import (
 	"errors"
 	"math/big"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
 )
 
 // MailboxHandler handles mailbox-related HTTP requests
 type MailboxHandler struct {
 	mailboxRepo repository.MailboxRepository
 	domainRepo  repository.DomainRepository
+	tokens      *services.MailboxTokenService
 }
 
 // NewMailboxHandler creates a new MailboxHandler
@@ -26,15 +29,36 @@ func NewMailboxHandler(mailboxRepo repository.MailboxRepository, domainRepo repo
 	}
 }
 
+// NewMailboxHandlerWithTokens creates a new MailboxHandler that issues a
+// mailbox token with every mailbox it creates
+func NewMailboxHandlerWithTokens(mailboxRepo repository.MailboxRepository, domainRepo repository.DomainRepository, tokens *services.MailboxTokenService) *MailboxHandler {
+	h := NewMailboxHandler(mailboxRepo, domainRepo)
+	h.tokens = tokens
+	return h
+}
+
 // CreateMailboxRequest represents the request body for creating a mailbox
 type CreateMailboxRequest struct {
 	LocalPart string `json:"local_part" validate:"required"`
 	DomainID  uint   `json:"domain_id" validate:"required"`
+	// TokenExpiresIn is the lifetime of the issued mailbox token in seconds;
+	// 0 never expires
+	TokenExpiresIn int64 `json:"token_expires_in"`
 }
 
 // CreateRandomMailboxRequest represents the request body for creating a random mailbox
 type CreateRandomMailboxRequest struct {
 	DomainID uint `json:"domain_id" validate:"required"`
+	// TokenExpiresIn is the lifetime of the issued mailbox token in seconds;
+	// 0 never expires
+	TokenExpiresIn int64 `json:"token_expires_in"`
+}
+
+// CreatedMailboxResponse represents a new mailbox with its access token
+type CreatedMailboxResponse struct {
+	*models.Mailbox
+	AccessToken    string     `json:"access_token"`
+	TokenExpiresAt *time.Time `json:"token_expires_at"`
 }
 
 // Create handles POST /api/mailboxes
@@ -50,6 +74,10 @@ func (h *MailboxHandler) Create(c echo.Context) error {
 	if req.DomainID == 0 {
 		return response.BadRequest(c, "domain_id is required")
 	}
+	ttl, err := tokenTTL(req.TokenExpiresIn)
+	if err != nil {
+		return response.BadRequest(c, "token_"+err.Error())
+	}
 
 	// Get domain to verify it exists and is active
 	domain, err := h.domainRepo.GetByID(c.Request().Context(), req.DomainID)
@@ -74,10 +102,13 @@ func (h *MailboxHandler) Create(c echo.Context) error {
 		if errors.Is(err, repository.ErrDuplicateEntry) {
 			return response.Conflict(c, "mailbox already exists")
 		}
+		if errors.Is(err, repository.ErrLimitExceeded) {
+			return response.Forbidden(c, "tenant already owns as many mailboxes as it may")
+		}
 		return response.InternalError(c, "failed to create mailbox")
 	}
 
-	return response.Created(c, mailbox)
+	return h.created(c, mailbox, ttl)
 }
 
 // CreateRandom handles POST /api/mailboxes/random
@@ -90,6 +121,10 @@ func (h *MailboxHandler) CreateRandom(c echo.Context) error {
 	if req.DomainID == 0 {
 		return response.BadRequest(c, "domain_id is required")
 	}
+	ttl, err := tokenTTL(req.TokenExpiresIn)
+	if err != nil {
+		return response.BadRequest(c, "token_"+err.Error())
+	}
 
 	// Get domain to verify it exists and is active
 	domain, err := h.domainRepo.GetByID(c.Request().Context(), req.DomainID)
@@ -122,12 +157,35 @@ func (h *MailboxHandler) CreateRandom(c echo.Context) error {
 			if err := h.mailboxRepo.Create(c.Request().Context(), mailbox); err != nil {
 				return response.InternalError(c, "failed to create mailbox")
 			}
+		} else if errors.Is(err, repository.ErrLimitExceeded) {
+			return response.Forbidden(c, "tenant already owns as many mailboxes as it may")
 		} else {
 			return response.InternalError(c, "failed to create mailbox")
 		}
 	}
 
-	return response.Created(c, mailbox)
+	return h.created(c, mailbox, ttl)
+}
+
+// created responds with a new mailbox and, when tokens are enabled, a token
+// for it; the mailbox is deleted again when its token cannot be issued
+func (h *MailboxHandler) created(c echo.Context, mailbox *models.Mailbox, ttl time.Duration) error {
+	if h.tokens == nil {
+		return response.Created(c, mailbox)
+	}
+
+	token, record, err := h.tokens.Issue(c.Request().Context(), mailbox.ID, "default", ttl)
+	if err != nil {
+		// Without its token the client cannot use the mailbox, and a retry
+		// would find the address taken
+		_ = h.mailboxRepo.Delete(c.Request().Context(), mailbox.ID)
+		return response.InternalError(c, "failed to issue mailbox token")
+	}
+	return response.Created(c, CreatedMailboxResponse{
+		Mailbox:        mailbox,
+		AccessToken:    token,
+		TokenExpiresAt: record.ExpiresAt,
+	})
 }
 
 // List handles GET /api/mailboxes
@@ -15,6 +15,7 @@ import (
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
 	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
 )
 
@@ -221,6 +222,78 @@ func (s *MailboxHandlerTestSuite) TestCreateRandom_ValidInput() {
 	s.True(resp.Success)
 }
 
+// TestCreateRandom_IssuesToken tests that a random mailbox is returned with its access token
+func (s *MailboxHandlerTestSuite) TestCreateRandom_IssuesToken() {
+	// Arrange
+	tokenRepo := new(mocks.MockMailboxTokenRepository)
+	s.handler = NewMailboxHandlerWithTokens(s.mockMailboxRepo, s.mockDomainRepo, services.NewMailboxTokenService(tokenRepo))
+	domain := s.createTestDomain(1, "example.com", true)
+	c, rec := s.createContext(http.MethodPost, "/api/mailboxes/random", `{"domain_id": 1, "token_expires_in": 3600}`)
+
+	s.mockDomainRepo.On("GetByID", mock.Anything, uint(1)).Return(domain, nil)
+	s.mockMailboxRepo.On("Create", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			args.Get(1).(*models.Mailbox).ID = 5
+		}).
+		Return(nil)
+	tokenRepo.On("Create", mock.Anything, mock.MatchedBy(func(token *models.MailboxToken) bool {
+		return token.MailboxID == 5 && token.ExpiresAt != nil
+	})).Return(nil)
+
+	// Act
+	err := s.handler.CreateRandom(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+	resp, err := parseAPIResponse(rec)
+	s.Require().NoError(err)
+	data := resp.Data.(map[string]interface{})
+	s.Equal(float64(5), data["id"])
+	s.True(strings.HasPrefix(data["access_token"].(string), services.MailboxTokenPrefix))
+	s.NotEmpty(data["token_expires_at"])
+	tokenRepo.AssertExpectations(s.T())
+}
+
+// TestCreateRandom_TokenFailureDeletesMailbox tests that a mailbox is not left behind without its token
+func (s *MailboxHandlerTestSuite) TestCreateRandom_TokenFailureDeletesMailbox() {
+	// Arrange
+	tokenRepo := new(mocks.MockMailboxTokenRepository)
+	s.handler = NewMailboxHandlerWithTokens(s.mockMailboxRepo, s.mockDomainRepo, services.NewMailboxTokenService(tokenRepo))
+	domain := s.createTestDomain(1, "example.com", true)
+	c, rec := s.createContext(http.MethodPost, "/api/mailboxes/random", `{"domain_id": 1}`)
+
+	s.mockDomainRepo.On("GetByID", mock.Anything, uint(1)).Return(domain, nil)
+	s.mockMailboxRepo.On("Create", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			args.Get(1).(*models.Mailbox).ID = 5
+		}).
+		Return(nil)
+	tokenRepo.On("Create", mock.Anything, mock.Anything).Return(errors.New("database error"))
+	s.mockMailboxRepo.On("Delete", mock.Anything, uint(5)).Return(nil)
+
+	// Act
+	err := s.handler.CreateRandom(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusInternalServerError, rec.Code)
+	tokenRepo.AssertExpectations(s.T())
+}
+
+// TestCreateRandom_InvalidTokenExpiry tests a token lifetime over the limit
+func (s *MailboxHandlerTestSuite) TestCreateRandom_InvalidTokenExpiry() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/mailboxes/random", `{"domain_id": 1, "token_expires_in": 99999999999}`)
+
+	// Act
+	err := s.handler.CreateRandom(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
 // TestCreateRandom_InvalidDomainID tests creating a random mailbox with non-existent domain
 func (s *MailboxHandlerTestSuite) TestCreateRandom_InvalidDomainID() {
 	// Arrange
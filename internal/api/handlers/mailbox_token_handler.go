@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// mailboxTokenKey is the context key of a verified mailbox token
+const mailboxTokenKey = "mailbox_token"
+
+// maxMailboxTokenTTL limits the lifetime a token can be issued with
+const maxMailboxTokenTTL = 365 * 24 * time.Hour
+
+// errWrongMailbox is returned by resolvers for resources outside the token mailbox
+var errWrongMailbox = errors.New("resource belongs to another mailbox")
+
+// MailboxResolver returns the mailbox of the resource a request is for
+type MailboxResolver func(c echo.Context) (uint, error)
+
+// MailboxTokenHandler issues and revokes mailbox tokens and authenticates the
+// requests made with them. A token is only accepted on the routes passed to
+// Allow, and only for resources of its mailbox.
+type MailboxTokenHandler struct {
+	tokens         *services.MailboxTokenService
+	mailboxRepo    repository.MailboxRepository
+	messageRepo    repository.MessageRepository
+	attachmentRepo repository.AttachmentRepository
+	// routes maps "METHOD /path" to the resolver checking its resources; a nil
+	// resolver leaves the check to the handler
+	routes map[string]MailboxResolver
+	logger *slog.Logger
+}
+
+// NewMailboxTokenHandler creates a new MailboxTokenHandler
+func NewMailboxTokenHandler(tokens *services.MailboxTokenService, mailboxRepo repository.MailboxRepository, messageRepo repository.MessageRepository, attachmentRepo repository.AttachmentRepository, logger *slog.Logger) *MailboxTokenHandler {
+	return &MailboxTokenHandler{
+		tokens:         tokens,
+		mailboxRepo:    mailboxRepo,
+		messageRepo:    messageRepo,
+		attachmentRepo: attachmentRepo,
+		routes:         make(map[string]MailboxResolver),
+		logger:         logger,
+	}
+}
+
+// CreateMailboxTokenRequest represents the request body for issuing a token
+type CreateMailboxTokenRequest struct {
+	Name string `json:"name"`
+	// ExpiresIn is the lifetime of the token in seconds; 0 never expires
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// MailboxTokenResponse represents a newly issued token; the token itself is
+// only returned once
+type MailboxTokenResponse struct {
+	*models.MailboxToken
+	Token string `json:"token"`
+}
+
+// Create handles POST /api/mailboxes/:id/tokens
+func (h *MailboxTokenHandler) Create(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+	var req CreateMailboxTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	ttl, err := tokenTTL(req.ExpiresIn)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+	if len(req.Name) > 100 {
+		return response.BadRequest(c, "name must be at most 100 characters")
+	}
+
+	ctx := c.Request().Context()
+	if _, err := h.mailboxRepo.GetByID(ctx, uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox not found")
+		}
+		return response.InternalError(c, "failed to get mailbox")
+	}
+
+	token, record, err := h.tokens.Issue(ctx, uint(id), req.Name, ttl)
+	if err != nil {
+		return response.InternalError(c, "failed to issue mailbox token")
+	}
+	return response.Created(c, MailboxTokenResponse{MailboxToken: record, Token: token})
+}
+
+// List handles GET /api/mailboxes/:id/tokens
+func (h *MailboxTokenHandler) List(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+
+	tokens, err := h.tokens.List(c.Request().Context(), uint(id))
+	if err != nil {
+		return response.InternalError(c, "failed to list mailbox tokens")
+	}
+	return response.Success(c, tokens)
+}
+
+// Revoke handles DELETE /api/mailboxes/:id/tokens/:token_id
+func (h *MailboxTokenHandler) Revoke(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid mailbox ID")
+	}
+	tokenID, err := strconv.ParseUint(c.Param("token_id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid token ID")
+	}
+
+	if err := h.tokens.Revoke(c.Request().Context(), uint(id), uint(tokenID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "mailbox token not found")
+		}
+		return response.InternalError(c, "failed to revoke mailbox token")
+	}
+	return response.NoContent(c)
+}
+
+// Allow accepts mailbox tokens on a route when resolve finds the mailbox of the
+// requested resource to be the token's. A nil resolve leaves the check to the
+// handler, which reads the token with mailboxTokenFrom.
+func (h *MailboxTokenHandler) Allow(route *echo.Route, resolve MailboxResolver) {
+	h.routes[route.Method+" "+route.Path] = resolve
+}
+
+// Authenticate admits requests with a mailbox token on the allowed routes and
+// hands the others to fallback, usually the API key check
+func (h *MailboxTokenHandler) Authenticate(fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAPIKey := fallback(next)
+		return func(c echo.Context) error {
+			value := bearerToken(c.Request())
+			if !services.IsMailboxToken(value) {
+				return withAPIKey(c)
+			}
+
+			resolve, allowed := h.routes[c.Request().Method+" "+c.Path()]
+			if !allowed {
+				return echo.NewHTTPError(http.StatusForbidden, map[string]string{
+					"error": "mailbox tokens are not accepted on this route",
+					"code":  "FORBIDDEN",
+				})
+			}
+
+			token, err := h.tokens.Verify(c.Request().Context(), value)
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidMailboxToken) && !errors.Is(err, services.ErrMailboxTokenExpired) {
+					return response.InternalError(c, "failed to verify mailbox token")
+				}
+				if h.logger != nil {
+					h.logger.Warn("invalid mailbox token",
+						slog.String("ip", c.RealIP()),
+						slog.String("path", c.Path()),
+						slog.Any("error", err))
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, map[string]string{
+					"error": err.Error(),
+					"code":  "UNAUTHORIZED",
+				})
+			}
+			c.Set(mailboxTokenKey, token)
+
+			if resolve != nil {
+				mailboxID, err := resolve(c)
+				if err == nil && mailboxID != token.MailboxID {
+					err = errWrongMailbox
+				}
+				if err != nil {
+					// Unknown resources are refused like foreign ones, so tokens
+					// cannot probe for IDs
+					if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errWrongMailbox) || errors.Is(err, strconv.ErrSyntax) || errors.Is(err, strconv.ErrRange) {
+						return response.Forbidden(c, "mailbox token is not valid for this resource")
+					}
+					return response.InternalError(c, "failed to check mailbox token")
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// Mailbox resolves the mailbox ID in the named path parameter
+func (h *MailboxTokenHandler) Mailbox(param string) MailboxResolver {
+	return func(c echo.Context) (uint, error) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		return uint(id), err
+	}
+}
+
+// Message resolves the mailbox of the message ID in the named path parameter
+func (h *MailboxTokenHandler) Message(param string) MailboxResolver {
+	return func(c echo.Context) (uint, error) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		message, err := h.messageRepo.GetByID(c.Request().Context(), uint(id))
+		if err != nil {
+			return 0, err
+		}
+		return message.MailboxID, nil
+	}
+}
+
+// Attachment resolves the mailbox of the attachment ID in the named path parameter
+func (h *MailboxTokenHandler) Attachment(param string) MailboxResolver {
+	return func(c echo.Context) (uint, error) {
+		id, err := strconv.ParseUint(c.Param(param), 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		attachment, err := h.attachmentRepo.GetByID(c.Request().Context(), uint(id))
+		if err != nil {
+			return 0, err
+		}
+		message, err := h.messageRepo.GetByID(c.Request().Context(), attachment.MessageID)
+		if err != nil {
+			return 0, err
+		}
+		return message.MailboxID, nil
+	}
+}
+
+// mailboxTokenFrom returns the mailbox token a request was authenticated with, if any
+func mailboxTokenFrom(c echo.Context) *models.MailboxToken {
+	token, _ := c.Get(mailboxTokenKey).(*models.MailboxToken)
+	return token
+}
+
+// bearerToken returns the credential of the X-API-Key or Authorization header
+func bearerToken(r *http.Request) string {
+	if token := r.Header.Get("X-API-Key"); token != "" {
+		return token
+	}
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+}
+
+// tokenTTL converts a requested lifetime in seconds
+func tokenTTL(expiresIn int64) (time.Duration, error) {
+	if expiresIn < 0 || expiresIn > int64(maxMailboxTokenTTL/time.Second) {
+		return 0, errors.New("expires_in must be between 0 and 31536000 seconds")
+	}
+	return time.Duration(expiresIn) * time.Second, nil
+}
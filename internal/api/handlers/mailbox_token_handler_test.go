@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// MailboxTokenHandlerTestSuite is the test suite for MailboxTokenHandler
+type MailboxTokenHandlerTestSuite struct {
+	suite.Suite
+	echo               *echo.Echo
+	handler            *MailboxTokenHandler
+	tokens             *services.MailboxTokenService
+	mockTokenRepo      *mocks.MockMailboxTokenRepository
+	mockMailboxRepo    *mocks.MockMailboxRepository
+	mockMessageRepo    *mocks.MockMessageRepository
+	mockAttachmentRepo *mocks.MockAttachmentRepository
+}
+
+// SetupTest runs before each test
+func (s *MailboxTokenHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockTokenRepo = new(mocks.MockMailboxTokenRepository)
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.mockAttachmentRepo = new(mocks.MockAttachmentRepository)
+	s.tokens = services.NewMailboxTokenService(s.mockTokenRepo)
+	s.handler = NewMailboxTokenHandler(s.tokens, s.mockMailboxRepo, s.mockMessageRepo, s.mockAttachmentRepo, nil)
+}
+
+// TearDownTest runs after each test
+func (s *MailboxTokenHandlerTestSuite) TearDownTest() {
+	s.mockTokenRepo.AssertExpectations(s.T())
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockMessageRepo.AssertExpectations(s.T())
+	s.mockAttachmentRepo.AssertExpectations(s.T())
+}
+
+// TestMailboxTokenHandlerTestSuite runs the test suite
+func TestMailboxTokenHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(MailboxTokenHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *MailboxTokenHandlerTestSuite) createContext(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// issue creates a token for a mailbox whose record the repository then finds
+func (s *MailboxTokenHandlerTestSuite) issue(mailboxID uint, ttl time.Duration) string {
+	s.mockTokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+	token, record, err := s.tokens.Issue(context.Background(), mailboxID, "", ttl)
+	s.Require().NoError(err)
+	s.mockTokenRepo.On("GetByHash", mock.Anything, record.TokenHash).Return(record, nil).Maybe()
+	return token
+}
+
+// TestCreate_Success tests issuing a token for an existing mailbox
+func (s *MailboxTokenHandlerTestSuite) TestCreate_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/mailboxes/3/tokens", `{"name":"phone","expires_in":3600}`)
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.Mailbox{ID: 3}, nil)
+	s.mockTokenRepo.On("Create", mock.Anything, mock.MatchedBy(func(token *models.MailboxToken) bool {
+		return token.MailboxID == 3 && token.Name == "phone" && token.ExpiresAt != nil
+	})).Return(nil)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+	resp, err := parseAPIResponse(rec)
+	s.Require().NoError(err)
+	data := resp.Data.(map[string]interface{})
+	s.True(strings.HasPrefix(data["token"].(string), services.MailboxTokenPrefix))
+	s.NotEmpty(data["expires_at"])
+	s.NotContains(data, "token_hash")
+}
+
+// TestCreate_InvalidExpiry tests a negative lifetime
+func (s *MailboxTokenHandlerTestSuite) TestCreate_InvalidExpiry() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/mailboxes/3/tokens", `{"expires_in":-1}`)
+	c.SetParamNames("id")
+	c.SetParamValues("3")
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestCreate_MailboxNotFound tests issuing a token for a missing mailbox
+func (s *MailboxTokenHandlerTestSuite) TestCreate_MailboxNotFound() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/mailboxes/9/tokens", `{}`)
+	c.SetParamNames("id")
+	c.SetParamValues("9")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestRevoke tests revoking tokens of a mailbox
+func (s *MailboxTokenHandlerTestSuite) TestRevoke() {
+	s.mockTokenRepo.On("Delete", mock.Anything, uint(3), uint(7)).Return(nil)
+	s.mockTokenRepo.On("Delete", mock.Anything, uint(3), uint(8)).Return(repository.ErrNotFound)
+	tests := []struct {
+		tokenID string
+		status  int
+	}{
+		{"7", http.StatusNoContent},
+		{"8", http.StatusNotFound},
+		{"abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		// Arrange
+		c, rec := s.createContext(http.MethodDelete, "/api/mailboxes/3/tokens/"+tt.tokenID, "")
+		c.SetParamNames("id", "token_id")
+		c.SetParamValues("3", tt.tokenID)
+
+		// Act
+		err := s.handler.Revoke(c)
+
+		// Assert
+		s.NoError(err, tt.tokenID)
+		s.Equal(tt.status, rec.Code, tt.tokenID)
+	}
+}
+
+// TestAuthenticate tests which routes and resources a mailbox token opens
+func (s *MailboxTokenHandlerTestSuite) TestAuthenticate() {
+	// Arrange
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	auth := s.handler.Authenticate(rejectAll)
+	s.handler.Allow(s.echo.GET("/api/mailboxes/:mailbox_id/messages", ok, auth), s.handler.Mailbox("mailbox_id"))
+	s.handler.Allow(s.echo.GET("/api/messages/:id", ok, auth), s.handler.Message("id"))
+	s.handler.Allow(s.echo.GET("/api/attachments/:id", ok, auth), s.handler.Attachment("id"))
+	s.echo.GET("/api/domains", ok, auth)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(10)).Return(&models.Message{ID: 10, MailboxID: 3}, nil)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(11)).Return(&models.Message{ID: 11, MailboxID: 4}, nil)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(99)).Return(nil, repository.ErrNotFound)
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(20)).Return(&models.Attachment{ID: 20, MessageID: 10}, nil)
+	s.mockAttachmentRepo.On("GetByID", mock.Anything, uint(21)).Return(&models.Attachment{ID: 21, MessageID: 11}, nil)
+	valid := s.issue(3, 0)
+	expired := s.issue(3, time.Nanosecond)
+	s.mockTokenRepo.On("GetByHash", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+	}{
+		{"own mailbox", "/api/mailboxes/3/messages", valid, http.StatusOK},
+		{"other mailbox", "/api/mailboxes/4/messages", valid, http.StatusForbidden},
+		{"own message", "/api/messages/10", valid, http.StatusOK},
+		{"other message", "/api/messages/11", valid, http.StatusForbidden},
+		{"unknown message", "/api/messages/99", valid, http.StatusForbidden},
+		{"own attachment", "/api/attachments/20", valid, http.StatusOK},
+		{"other attachment", "/api/attachments/21", valid, http.StatusForbidden},
+		{"route not allowed", "/api/domains", valid, http.StatusForbidden},
+		{"expired token", "/api/messages/10", expired, http.StatusUnauthorized},
+		{"unknown token", "/api/messages/10", services.MailboxTokenPrefix + "unknown", http.StatusUnauthorized},
+		{"api key", "/api/domains", "some-api-key", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+
+		// Act
+		s.echo.ServeHTTP(rec, req)
+
+		// Assert
+		s.Equal(tt.status, rec.Code, tt.name)
+	}
+}
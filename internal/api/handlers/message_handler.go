@@ -2,17 +2,29 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"html"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/sanitize"
 )
 
 // MessageHandler handles message-related HTTP requests
 type MessageHandler struct {
 	messageRepo repository.MessageRepository
 	mailboxRepo repository.MailboxRepository
+	imageProxy  *imageproxy.Proxy
+	// frameAncestors are the origins besides the API's own that may show
+	// rendered messages in an iframe
+	frameAncestors []string
 }
 
 // NewMessageHandler creates a new MessageHandler
@@ -23,13 +35,47 @@ func NewMessageHandler(messageRepo repository.MessageRepository, mailboxRepo rep
 	}
 }
 
+// NewMessageHandlerWithImageProxy creates a MessageHandler that can route remote
+// images of rendered messages through the image proxy
+func NewMessageHandlerWithImageProxy(
+	messageRepo repository.MessageRepository,
+	mailboxRepo repository.MailboxRepository,
+	imageProxy *imageproxy.Proxy,
+) *MessageHandler {
+	return &MessageHandler{
+		messageRepo: messageRepo,
+		mailboxRepo: mailboxRepo,
+		imageProxy:  imageProxy,
+	}
+}
+
+// SetFrameAncestors lets the given origins, usually the frontends of
+// ALLOWED_ORIGINS, embed rendered messages in an iframe; wildcards are ignored
+func (h *MessageHandler) SetFrameAncestors(origins []string) {
+	h.frameAncestors = h.frameAncestors[:0]
+	for _, origin := range origins {
+		if origin != "" && origin != "*" {
+			h.frameAncestors = append(h.frameAncestors, origin)
+		}
+	}
+}
+
 // List handles GET /api/mailboxes/:mailbox_id/messages
+// Filters: unread, flagged, folder_id, label_id, sender, subject, from, to (RFC 3339
+// or YYYY-MM-DD), has_attachments, min_size and max_size. sort is received_at (default), sender, subject or size and
+// order is desc (default) or asc. Pages are selected with offset, or with the cursor
+// returned as meta.next_cursor by the previous page.
 func (h *MessageHandler) List(c echo.Context) error {
 	mailboxID, err := strconv.ParseUint(c.Param("mailbox_id"), 10, 32)
 	if err != nil {
 		return response.BadRequest(c, "invalid mailbox ID")
 	}
 
+	opts, err := parseMessageListOptions(c)
+	if err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+
 	// Verify mailbox exists
 	_, err = h.mailboxRepo.GetByID(c.Request().Context(), uint(mailboxID))
 	if err != nil {
@@ -39,26 +85,125 @@ func (h *MessageHandler) List(c echo.Context) error {
 		return response.InternalError(c, "failed to get mailbox")
 	}
 
-	limit := 20
-	offset := 0
+	messages, total, err := h.messageRepo.ListByMailboxWithOptions(c.Request().Context(), uint(mailboxID), opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return response.BadRequest(c, "cursor does not match the sort order")
+		}
+		return response.InternalError(c, "failed to list messages")
+	}
+
+	var nextCursor string
+	if len(messages) == opts.Limit {
+		nextCursor = repository.NewMessageCursor(messages[len(messages)-1], opts.Sort, opts.Ascending).Encode()
+	}
+
+	offset := opts.Offset
+	if opts.Cursor != nil {
+		offset = 0
+	}
+	return response.PaginatedWithCursor(c, messages, total, opts.Limit, offset, nextCursor)
+}
+
+// parseMessageListOptions reads the filter, sort and paging query parameters of List
+func parseMessageListOptions(c echo.Context) (repository.MessageListOptions, error) {
+	opts := repository.MessageListOptions{
+		Limit:   20,
+		Sender:  c.QueryParam("sender"),
+		Subject: c.QueryParam("subject"),
+	}
 
 	if l := c.QueryParam("limit"); l != "" {
 		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
+			opts.Limit = parsed
 		}
 	}
 	if o := c.QueryParam("offset"); o != "" {
 		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
+			opts.Offset = parsed
+		}
+	}
+
+	var err error
+	if opts.Unread, err = parseOptionalBool(c.QueryParam("unread")); err != nil {
+		return opts, errors.New("unread must be a boolean")
+	}
+	if opts.HasAttachments, err = parseOptionalBool(c.QueryParam("has_attachments")); err != nil {
+		return opts, errors.New("has_attachments must be a boolean")
+	}
+	if opts.From, err = parseRangeTime(c.QueryParam("from"), false); err != nil {
+		return opts, errors.New("from must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	if opts.To, err = parseRangeTime(c.QueryParam("to"), true); err != nil {
+		return opts, errors.New("to must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	if opts.MinSize, err = parseSize(c.QueryParam("min_size")); err != nil {
+		return opts, errors.New("min_size must be a non-negative integer")
+	}
+	if opts.MaxSize, err = parseSize(c.QueryParam("max_size")); err != nil {
+		return opts, errors.New("max_size must be a non-negative integer")
+	}
+	if opts.Flagged, err = parseOptionalBool(c.QueryParam("flagged")); err != nil {
+		return opts, errors.New("flagged must be a boolean")
+	}
+	if v := c.QueryParam("folder_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || id == 0 {
+			return opts, errors.New("invalid folder ID")
+		}
+		opts.FolderID = uint(id)
+	}
+	if v := c.QueryParam("label_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || id == 0 {
+			return opts, errors.New("invalid label ID")
+		}
+		opts.LabelID = uint(id)
+	}
+
+	if opts.Sort, err = repository.ParseMessageSortField(c.QueryParam("sort")); err != nil {
+		return opts, errors.New("sort must be received_at, sender, subject or size")
+	}
+	switch strings.ToLower(c.QueryParam("order")) {
+	case "", "desc":
+	case "asc":
+		opts.Ascending = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err := repository.DecodeMessageCursor(v)
+		if err != nil {
+			return opts, errors.New("invalid cursor")
 		}
+		opts.Cursor = cursor
 	}
+	return opts, nil
+}
 
-	messages, total, err := h.messageRepo.ListByMailbox(c.Request().Context(), uint(mailboxID), limit, offset)
+// parseOptionalBool parses an optional boolean query parameter; empty means unset
+func parseOptionalBool(v string) (*bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
 	if err != nil {
-		return response.InternalError(c, "failed to list messages")
+		return nil, err
 	}
+	return &b, nil
+}
 
-	return response.Paginated(c, messages, total, limit, offset)
+// parseSize parses an optional byte size; empty means 0
+func parseSize(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || size < 0 {
+		return 0, errors.New("invalid size")
+	}
+	return size, nil
 }
 
 // Get handles GET /api/messages/:id
@@ -102,6 +247,63 @@ func (h *MessageHandler) MarkAsRead(c echo.Context) error {
 	return response.SuccessWithMessage(c, nil, "message marked as read")
 }
 
+// UpdateFlagsRequest represents the request body for updating message flags;
+// omitted flags are left unchanged
+type UpdateFlagsRequest struct {
+	Seen     *bool `json:"seen"`
+	Flagged  *bool `json:"flagged"`
+	Answered *bool `json:"answered"`
+	Deleted  *bool `json:"deleted"`
+	Draft    *bool `json:"draft"`
+}
+
+// UpdateFlags handles PATCH /api/messages/:id/flags
+// Sets or clears the \Seen, \Flagged, \Answered, \Deleted and \Draft flags.
+func (h *MessageHandler) UpdateFlags(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid message ID")
+	}
+
+	var req UpdateFlagsRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+
+	flags := make(map[string]bool)
+	for flag, value := range map[string]*bool{
+		models.FlagSeen:     req.Seen,
+		models.FlagFlagged:  req.Flagged,
+		models.FlagAnswered: req.Answered,
+		models.FlagDeleted:  req.Deleted,
+		models.FlagDraft:    req.Draft,
+	} {
+		if value != nil {
+			flags[flag] = *value
+		}
+	}
+	if len(flags) == 0 {
+		return response.BadRequest(c, "at least one flag is required")
+	}
+
+	ctx := c.Request().Context()
+	if err := h.messageRepo.SetFlags(ctx, uint(id), flags); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "message not found")
+		}
+		return response.InternalError(c, "failed to update message flags")
+	}
+
+	message, err := h.messageRepo.GetByID(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "message not found")
+		}
+		return response.InternalError(c, "failed to get message")
+	}
+	return response.Success(c, message)
+}
+
 // Delete handles DELETE /api/messages/:id
 func (h *MessageHandler) Delete(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -118,3 +320,99 @@ func (h *MessageHandler) Delete(c echo.Context) error {
 
 	return response.NoContent(c)
 }
+
+// HTML handles GET /api/messages/:id/html?remote=block|proxy|allow
+// Serves the sanitized message body as a standalone document under a strict CSP.
+// Remote images are blocked by default; the number of remote images is reported
+// in X-Remote-Images so clients can offer to load them. cid: references to inline
+// parts are rewritten to signed, short-lived attachment URLs that need no API key.
+func (h *MessageHandler) HTML(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid message ID")
+	}
+
+	policy, err := sanitize.ParseRemotePolicy(c.QueryParam("remote"))
+	if err != nil {
+		return response.BadRequest(c, "remote must be block, proxy or allow")
+	}
+	opts := sanitize.Options{Remote: policy}
+	if policy == sanitize.RemoteProxy {
+		if h.imageProxy == nil {
+			return response.BadRequest(c, "image proxy is not configured")
+		}
+		opts.ProxyURL = h.imageProxy.URL
+	}
+
+	message, err := h.messageRepo.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "message not found")
+		}
+		return response.InternalError(c, "failed to get message")
+	}
+
+	opts.ContentURL = h.inlineContentURLs(message.Attachments)
+
+	body := message.BodyHTML
+	if body == "" {
+		body = "<pre>" + html.EscapeString(message.BodyText) + "</pre>"
+	}
+	result, err := sanitize.Sanitize(body, opts)
+	if err != nil {
+		return response.InternalError(c, "failed to render message")
+	}
+
+	header := c.Response().Header()
+	header.Set("Content-Security-Policy", h.messageCSP(policy))
+	// frame-ancestors decides who may embed the message
+	header.Del("X-Frame-Options")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("Cache-Control", "private, no-store")
+	header.Set("X-Remote-Images", strconv.Itoa(result.RemoteImages))
+	header.Set("X-Trackers-Removed", strconv.Itoa(result.TrackersRemoved))
+	return c.HTMLBlob(http.StatusOK, []byte(result.HTML))
+}
+
+// inlineContentURLs resolves the cid: references of a message to its attachment URLs.
+// <img> tags cannot send an API key, so the URLs are signed by the image proxy;
+// without one they fall back to the authenticated download route.
+func (h *MessageHandler) inlineContentURLs(attachments []models.Attachment) func(string) (string, bool) {
+	expires := time.Now().Add(imageproxy.AttachmentURLTTL)
+	urls := make(map[string]string)
+	for _, attachment := range attachments {
+		if attachment.ContentID == "" {
+			continue
+		}
+		if h.imageProxy != nil {
+			urls[attachment.ContentID] = h.imageProxy.AttachmentURL(attachment.ID, expires)
+		} else {
+			urls[attachment.ContentID] = fmt.Sprintf("/api/attachments/%d/download?inline=1", attachment.ID)
+		}
+	}
+	return func(contentID string) (string, bool) {
+		u, ok := urls[contentID]
+		return u, ok
+	}
+}
+
+// messageCSP builds the Content-Security-Policy for a rendered message.
+// Nothing may run or submit; images may only come from where the policy allows.
+// The API's own origin and the frame ancestors may show it in an iframe.
+func (h *MessageHandler) messageCSP(policy sanitize.RemotePolicy) string {
+	// Inline attachments are always served by this API, through the proxy when there is one
+	imgSrc := []string{"data:", "'self'"}
+	if h.imageProxy != nil {
+		if origin := h.imageProxy.Origin(); origin != "" {
+			imgSrc = append(imgSrc, origin)
+		}
+	}
+	if policy == sanitize.RemoteAllow {
+		imgSrc = append(imgSrc, "http:", "https:")
+	}
+
+	return "default-src 'none'; img-src " + strings.Join(imgSrc, " ") +
+		"; style-src 'unsafe-inline'; font-src data:; base-uri 'none'; form-action 'none'" +
+		"; frame-ancestors " + strings.Join(append([]string{"'self'"}, h.frameAncestors...), " ") +
+		"; sandbox allow-popups allow-popups-to-escape-sandbox"
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"html"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
 	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
@@ -115,7 +118,9 @@ func (s *MessageHandlerTestSuite) TestList_Success() {
 	c.SetParamValues("1")
 
 	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
-	s.mockMessageRepo.On("ListByMailbox", mock.Anything, uint(1), 20, 0).Return(messages, int64(2), nil)
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), repository.MessageListOptions{
+		Limit: 20, Sort: repository.SortByReceivedAt,
+	}).Return(messages, int64(2), nil)
 
 	// Act
 	err := s.handler.List(c)
@@ -142,7 +147,9 @@ func (s *MessageHandlerTestSuite) TestList_WithPagination() {
 	c.SetParamValues("1")
 
 	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
-	s.mockMessageRepo.On("ListByMailbox", mock.Anything, uint(1), 10, 10).Return(messages, int64(15), nil)
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), repository.MessageListOptions{
+		Limit: 10, Offset: 10, Sort: repository.SortByReceivedAt,
+	}).Return(messages, int64(15), nil)
 
 	// Act
 	err := s.handler.List(c)
@@ -158,6 +165,125 @@ func (s *MessageHandlerTestSuite) TestList_WithPagination() {
 	s.Equal(10, resp.Meta.Offset)
 }
 
+// TestList_FiltersAndSort tests that filter and sort parameters reach the repository
+func (s *MessageHandlerTestSuite) TestList_FiltersAndSort() {
+	// Arrange
+	mailbox := s.createTestMailbox(1)
+	c, rec := s.createContext(http.MethodGet,
+		"/api/mailboxes/1/messages?unread=true&sender=shop&subject=invoice&from=2024-03-01&to=2024-03-31"+
+			"&has_attachments=false&min_size=100&max_size=5000&sort=size&order=asc", "")
+	c.SetParamNames("mailbox_id")
+	c.SetParamValues("1")
+
+	unread, hasAttachments := true, false
+	expected := repository.MessageListOptions{
+		Unread:         &unread,
+		Sender:         "shop",
+		Subject:        "invoice",
+		From:           time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		HasAttachments: &hasAttachments,
+		MinSize:        100,
+		MaxSize:        5000,
+		Sort:           repository.SortBySize,
+		Ascending:      true,
+		Limit:          20,
+	}
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), expected).
+		Return([]models.MessageListItem{}, int64(0), nil)
+
+	// Act
+	err := s.handler.List(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+}
+
+// TestList_CursorPagination tests that a full page returns a cursor that selects the next page
+func (s *MessageHandlerTestSuite) TestList_CursorPagination() {
+	// Arrange
+	mailbox := s.createTestMailbox(1)
+	page := []models.MessageListItem{s.createTestMessageListItem(9, 1, false), s.createTestMessageListItem(8, 1, false)}
+	c, rec := s.createContext(http.MethodGet, "/api/mailboxes/1/messages?limit=2", "")
+	c.SetParamNames("mailbox_id")
+	c.SetParamValues("1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), repository.MessageListOptions{
+		Limit: 2, Sort: repository.SortByReceivedAt,
+	}).Return(page, int64(5), nil)
+
+	// Act
+	err := s.handler.List(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	var resp response.PaginatedResponse
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	s.Require().NotEmpty(resp.Meta.NextCursor)
+
+	// Arrange the next page with the returned cursor
+	cursor, err := repository.DecodeMessageCursor(resp.Meta.NextCursor)
+	s.Require().NoError(err)
+	s.Equal(uint(8), cursor.ID)
+	next, nextRec := s.createContext(http.MethodGet, "/api/mailboxes/1/messages?limit=2&offset=4&cursor="+resp.Meta.NextCursor, "")
+	next.SetParamNames("mailbox_id")
+	next.SetParamValues("1")
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), repository.MessageListOptions{
+		Limit: 2, Offset: 4, Sort: repository.SortByReceivedAt, Cursor: cursor,
+	}).Return([]models.MessageListItem{s.createTestMessageListItem(7, 1, false)}, int64(5), nil)
+
+	// Act
+	err = s.handler.List(next)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, nextRec.Code)
+	var nextResp response.PaginatedResponse
+	s.Require().NoError(json.Unmarshal(nextRec.Body.Bytes(), &nextResp))
+	s.Empty(nextResp.Meta.NextCursor)
+	s.Equal(0, nextResp.Meta.Offset)
+}
+
+// TestList_InvalidParameters tests malformed filter, sort and cursor parameters
+func (s *MessageHandlerTestSuite) TestList_InvalidParameters() {
+	for _, query := range []string{"unread=maybe", "from=yesterday", "min_size=-1", "sort=priority", "order=up", "cursor=%21%21"} {
+		// Arrange
+		c, rec := s.createContext(http.MethodGet, "/api/mailboxes/1/messages?"+query, "")
+		c.SetParamNames("mailbox_id")
+		c.SetParamValues("1")
+
+		// Act
+		err := s.handler.List(c)
+
+		// Assert
+		s.NoError(err)
+		s.Equal(http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+// TestList_CursorFromOtherSort tests a cursor used with a different sort order
+func (s *MessageHandlerTestSuite) TestList_CursorFromOtherSort() {
+	// Arrange
+	mailbox := s.createTestMailbox(1)
+	cursor := repository.NewMessageCursor(s.createTestMessageListItem(3, 1, false), repository.SortByReceivedAt, false)
+	c, rec := s.createContext(http.MethodGet, "/api/mailboxes/1/messages?sort=size&cursor="+cursor.Encode(), "")
+	c.SetParamNames("mailbox_id")
+	c.SetParamValues("1")
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), mock.Anything).
+		Return(nil, int64(0), repository.ErrInvalidCursor)
+
+	// Act
+	err := s.handler.List(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
 // TestList_MailboxNotFound tests listing messages for non-existent mailbox
 func (s *MessageHandlerTestSuite) TestList_MailboxNotFound() {
 	// Arrange
@@ -199,7 +325,7 @@ func (s *MessageHandlerTestSuite) TestList_InternalError() {
 	c.SetParamValues("1")
 
 	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(1)).Return(mailbox, nil)
-	s.mockMessageRepo.On("ListByMailbox", mock.Anything, uint(1), 20, 0).Return(nil, int64(0), errors.New("database error"))
+	s.mockMessageRepo.On("ListByMailboxWithOptions", mock.Anything, uint(1), mock.Anything).Return(nil, int64(0), errors.New("database error"))
 
 	// Act
 	err := s.handler.List(c)
@@ -406,6 +532,63 @@ func (s *MessageHandlerTestSuite) TestMarkAsRead_InternalError() {
 	s.Equal(http.StatusInternalServerError, rec.Code)
 }
 
+// ==================== UpdateFlags Tests ====================
+
+// TestUpdateFlags_Success tests setting and clearing flags
+func (s *MessageHandlerTestSuite) TestUpdateFlags_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPatch, "/api/messages/1/flags", `{"flagged":true,"seen":false}`)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	message := s.createTestMessage(1, 1, false)
+	message.IsFlagged = true
+
+	s.mockMessageRepo.On("SetFlags", mock.Anything, uint(1),
+		map[string]bool{models.FlagFlagged: true, models.FlagSeen: false}).Return(nil)
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+
+	// Act
+	err := s.handler.UpdateFlags(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `"is_flagged":true`)
+}
+
+// TestUpdateFlags_NoFlags tests a request without any flag
+func (s *MessageHandlerTestSuite) TestUpdateFlags_NoFlags() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPatch, "/api/messages/1/flags", `{}`)
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := s.handler.UpdateFlags(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestUpdateFlags_NotFound tests flagging a non-existent message
+func (s *MessageHandlerTestSuite) TestUpdateFlags_NotFound() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPatch, "/api/messages/999/flags", `{"deleted":true}`)
+	c.SetParamNames("id")
+	c.SetParamValues("999")
+
+	s.mockMessageRepo.On("SetFlags", mock.Anything, uint(999), map[string]bool{models.FlagDeleted: true}).
+		Return(repository.ErrNotFound)
+
+	// Act
+	err := s.handler.UpdateFlags(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
 // ==================== Delete Tests ====================
 
 // TestDelete_Success tests deleting a message
@@ -473,3 +656,240 @@ func (s *MessageHandlerTestSuite) TestDelete_InternalError() {
 	s.NoError(err)
 	s.Equal(http.StatusInternalServerError, rec.Code)
 }
+
+// TestHTML_BlocksRemoteImagesByDefault tests rendering a message with remote images blocked
+func (s *MessageHandlerTestSuite) TestHTML_BlocksRemoteImagesByDefault() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	message := s.createTestMessage(1, 1, false)
+	message.BodyHTML = `<p onclick="x()">Hi</p><script>alert(1)</script>` +
+		`<img src="https://cdn.example.com/logo.png"><img src="https://t.example.com/o.gif" width="1" height="1">`
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Header().Get(echo.HeaderContentType), "text/html")
+	s.Contains(rec.Header().Get("Content-Security-Policy"), "default-src 'none'; img-src data: 'self';")
+	s.Contains(rec.Header().Get("Content-Security-Policy"), "sandbox")
+	s.Equal("1", rec.Header().Get("X-Remote-Images"))
+	s.Equal("1", rec.Header().Get("X-Trackers-Removed"))
+	s.Contains(rec.Body.String(), "<p>Hi</p>")
+	s.NotContains(rec.Body.String(), "script")
+	s.NotContains(rec.Body.String(), "example.com")
+}
+
+// TestHTML_FrameAncestors tests that the frontends may embed rendered messages
+func (s *MessageHandlerTestSuite) TestHTML_FrameAncestors() {
+	// Arrange
+	s.handler.SetFrameAncestors([]string{"https://app.example.com", "*"})
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	c.Response().Header().Set("X-Frame-Options", "DENY")
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(s.createTestMessage(1, 1, false), nil)
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Header().Get("Content-Security-Policy"), "; frame-ancestors 'self' https://app.example.com;")
+	s.Empty(rec.Header().Get("X-Frame-Options"))
+}
+
+// TestHTML_ProxiesRemoteImages tests rendering a message with remote images routed through the proxy
+func (s *MessageHandlerTestSuite) TestHTML_ProxiesRemoteImages() {
+	// Arrange
+	proxy, err := imageproxy.New(imageproxy.Config{Secret: []byte("secret"), BaseURL: "https://mail.example.com"})
+	s.Require().NoError(err)
+	s.handler = NewMessageHandlerWithImageProxy(s.mockMessageRepo, s.mockMailboxRepo, proxy)
+
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html?remote=proxy", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	message := s.createTestMessage(1, 1, false)
+	message.BodyHTML = `<img src="https://cdn.example.com/logo.png">`
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+
+	// Act
+	err = s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Header().Get("Content-Security-Policy"), "img-src data: 'self' https://mail.example.com;")
+	s.Contains(rec.Body.String(), `src="https://mail.example.com/proxy/image?`)
+}
+
+// TestHTML_AllowRemoteImages tests rendering a message with remote images left unchanged
+func (s *MessageHandlerTestSuite) TestHTML_AllowRemoteImages() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html?remote=allow", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	message := s.createTestMessage(1, 1, false)
+	message.BodyHTML = `<img src="https://cdn.example.com/logo.png">`
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Header().Get("Content-Security-Policy"), "img-src data: 'self' http: https:;")
+	s.Contains(rec.Body.String(), `src="https://cdn.example.com/logo.png"`)
+}
+
+// TestHTML_TextOnlyMessage tests rendering a message without an HTML body
+func (s *MessageHandlerTestSuite) TestHTML_TextOnlyMessage() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	message := s.createTestMessage(1, 1, false)
+	message.BodyHTML = ""
+	message.BodyText = "1 < 2 <script>"
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), "<pre>1 &lt; 2 &lt;script&gt;</pre>")
+}
+
+// TestHTML_ProxyNotConfigured tests requesting proxied images without an image proxy
+func (s *MessageHandlerTestSuite) TestHTML_ProxyNotConfigured() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html?remote=proxy", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestHTML_InvalidRemotePolicy tests rendering with an unknown remote policy
+func (s *MessageHandlerTestSuite) TestHTML_InvalidRemotePolicy() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html?remote=always", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestHTML_NotFound tests rendering a non-existent message
+func (s *MessageHandlerTestSuite) TestHTML_NotFound() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/999/html", "")
+	c.SetParamNames("id")
+	c.SetParamValues("999")
+
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(999)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestHTML_ResolvesInlineImages tests that cid: references point at inline attachment downloads
+func (s *MessageHandlerTestSuite) TestHTML_ResolvesInlineImages() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	message := s.createTestMessage(1, 1, false)
+	message.BodyHTML = `<img src="cid:logo@example.com"><img src="cid:missing@example.com" alt="gone">`
+	message.Attachments = []models.Attachment{
+		{ID: 7, MessageID: 1, Filename: "inline.png", ContentType: "image/png", ContentID: "logo@example.com", Inline: true},
+		{ID: 8, MessageID: 1, Filename: "report.pdf", ContentType: "application/pdf"},
+	}
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+
+	// Act
+	err := s.handler.HTML(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), `<img src="/api/attachments/7/download?inline=1"/>`)
+	s.Contains(rec.Body.String(), `<img alt="gone"/>`)
+	s.NotContains(rec.Body.String(), "cid:")
+}
+
+// TestHTML_SignedInlineImagesLoadWithoutAuth tests that rewritten cid: URLs load from an <img> tag without an API key
+func (s *MessageHandlerTestSuite) TestHTML_SignedInlineImagesLoadWithoutAuth() {
+	// Arrange
+	proxy, err := imageproxy.New(imageproxy.Config{Secret: []byte("secret")})
+	s.Require().NoError(err)
+	s.handler = NewMessageHandlerWithImageProxy(s.mockMessageRepo, s.mockMailboxRepo, proxy)
+	attachmentRepo := new(mocks.MockAttachmentRepository)
+	fileStorage := new(mocks.MockFileStorage)
+	attachments := NewAttachmentHandlerWithImageProxy(attachmentRepo, s.mockMessageRepo, fileStorage, proxy)
+	// Registered as the router does, outside the authenticated /api group
+	s.echo.GET(imageproxy.AttachmentPath+"/:id", attachments.Inline)
+
+	c, rec := s.createContext(http.MethodGet, "/api/messages/1/html", "")
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+	message := s.createTestMessage(1, 1, false)
+	message.BodyHTML = `<img src="cid:logo@example.com">`
+	attachment := models.Attachment{ID: 7, MessageID: 1, Filename: "inline.png", ContentType: "image/png",
+		FilePath: "/attachments/logo.png", ContentID: "logo@example.com", Inline: true}
+	message.Attachments = []models.Attachment{attachment}
+	s.mockMessageRepo.On("GetByID", mock.Anything, uint(1)).Return(message, nil)
+	attachmentRepo.On("GetByID", mock.Anything, uint(7)).Return(&attachment, nil).Once()
+	fileStorage.On("Get", attachment.FilePath).Return(newMockReadCloser([]byte("png data")), nil).Once()
+
+	// Act
+	s.Require().NoError(s.handler.HTML(c))
+	match := regexp.MustCompile(`<img src="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	s.Require().Len(match, 2)
+	signed := html.UnescapeString(match[1])
+	fetch := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	loaded := fetch(signed)
+	tampered := fetch(strings.Replace(signed, imageproxy.AttachmentPath+"/7", imageproxy.AttachmentPath+"/8", 1))
+	unsigned := fetch(imageproxy.AttachmentPath + "/7")
+
+	// Assert
+	s.True(strings.HasPrefix(signed, imageproxy.AttachmentPath+"/7?"), signed)
+	s.Equal(http.StatusOK, loaded.Code)
+	s.Equal("png data", loaded.Body.String())
+	s.Contains(loaded.Header().Get("Content-Disposition"), "inline")
+	s.Equal(http.StatusForbidden, tampered.Code)
+	s.Equal(http.StatusForbidden, unsigned.Code)
+	attachmentRepo.AssertExpectations(s.T())
+	fileStorage.AssertExpectations(s.T())
+}
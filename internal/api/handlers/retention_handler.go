@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// RetentionHandler handles retention administration endpoints
+type RetentionHandler struct {
+	runner services.RetentionRunner
+}
+
+// NewRetentionHandler creates a new RetentionHandler
+func NewRetentionHandler(runner services.RetentionRunner) *RetentionHandler {
+	return &RetentionHandler{runner: runner}
+}
+
+// GetLastRun handles GET /api/admin/retention
+// Returns the report of the most recent retention sweep
+func (h *RetentionHandler) GetLastRun(c echo.Context) error {
+	report := h.runner.LastReport()
+	if report == nil {
+		return response.NotFound(c, "retention has not run yet")
+	}
+	return response.Success(c, report)
+}
+
+// Run handles POST /api/admin/retention/run?dry_run=true
+// Performs a retention sweep immediately and returns its report
+func (h *RetentionHandler) Run(c echo.Context) error {
+	dryRun, err := parseDryRun(c)
+	if err != nil {
+		return response.BadRequest(c, "dry_run must be a boolean")
+	}
+
+	report, err := h.runner.RunOnce(c.Request().Context(), dryRun)
+	if err != nil {
+		return response.InternalError(c, "failed to run retention")
+	}
+
+	return response.Success(c, report)
+}
+
+// parseDryRun reads the optional dry_run query parameter (default false)
+func parseDryRun(c echo.Context) (bool, error) {
+	v := c.QueryParam("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
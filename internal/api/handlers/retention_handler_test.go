@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// fakeRetentionRunner is a test double for services.RetentionRunner
+type fakeRetentionRunner struct {
+	last      *services.RetentionReport
+	runErr    error
+	runDryRun *bool
+}
+
+func (f *fakeRetentionRunner) LastReport() *services.RetentionReport {
+	return f.last
+}
+
+func (f *fakeRetentionRunner) RunOnce(ctx context.Context, dryRun bool) (*services.RetentionReport, error) {
+	f.runDryRun = &dryRun
+	if f.runErr != nil {
+		return nil, f.runErr
+	}
+	return &services.RetentionReport{DryRun: dryRun}, nil
+}
+
+func newRetentionContext(method, target string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(method, target, nil)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func TestRetentionHandler_GetLastRun_NotRunYet(t *testing.T) {
+	handler := NewRetentionHandler(&fakeRetentionRunner{})
+	c, rec := newRetentionContext(http.MethodGet, "/api/admin/retention")
+
+	err := handler.GetLastRun(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRetentionHandler_GetLastRun_Success(t *testing.T) {
+	handler := NewRetentionHandler(&fakeRetentionRunner{
+		last: &services.RetentionReport{MessagesDeleted: 3},
+	})
+	c, rec := newRetentionContext(http.MethodGet, "/api/admin/retention")
+
+	err := handler.GetLastRun(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"messages_deleted":3`)
+}
+
+func TestRetentionHandler_Run_DryRun(t *testing.T) {
+	runner := &fakeRetentionRunner{}
+	handler := NewRetentionHandler(runner)
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/retention/run?dry_run=true")
+
+	err := handler.Run(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.NotNil(t, runner.runDryRun) {
+		assert.True(t, *runner.runDryRun)
+	}
+	assert.Contains(t, rec.Body.String(), `"dry_run":true`)
+}
+
+func TestRetentionHandler_Run_InvalidDryRun(t *testing.T) {
+	runner := &fakeRetentionRunner{}
+	handler := NewRetentionHandler(runner)
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/retention/run?dry_run=maybe")
+
+	err := handler.Run(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, runner.runDryRun)
+}
+
+func TestRetentionHandler_Run_Error(t *testing.T) {
+	handler := NewRetentionHandler(&fakeRetentionRunner{runErr: errors.New("db down")})
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/retention/run")
+
+	err := handler.Run(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+)
+
+// snippetLength is the length of highlighted body excerpts in runes
+const snippetLength = 200
+
+// SearchHandler handles message search
+type SearchHandler struct {
+	messageRepo repository.MessageRepository
+}
+
+// NewSearchHandler creates a new SearchHandler
+func NewSearchHandler(messageRepo repository.MessageRepository) *SearchHandler {
+	return &SearchHandler{messageRepo: messageRepo}
+}
+
+// SearchResultResponse is one search hit. SubjectHighlight and Highlight are
+// HTML-escaped with matched words wrapped in <mark>.
+type SearchResultResponse struct {
+	ID               uint      `json:"id"`
+	MailboxID        uint      `json:"mailbox_id"`
+	MailboxAddress   string    `json:"mailbox_address"`
+	SenderEmail      string    `json:"sender_email"`
+	SenderName       string    `json:"sender_name,omitempty"`
+	Subject          string    `json:"subject,omitempty"`
+	SubjectHighlight string    `json:"subject_highlight,omitempty"`
+	Highlight        string    `json:"highlight,omitempty"`
+	IsRead           bool      `json:"is_read"`
+	ReceivedAt       time.Time `json:"received_at"`
+	AttachmentCount  int       `json:"attachment_count"`
+	Rank             float64   `json:"rank"`
+}
+
+// Search handles GET /api/search?q=&mailbox_id=&domain_id=&limit=&offset=
+// Searches messages of a mailbox or a domain. q supports free text, "quoted phrases"
+// and the from:, to:, subject:, has:attachment, is:unread, is:read, before: and
+// after: operators.
+func (h *SearchHandler) Search(c echo.Context) error {
+	query, err := search.Parse(c.QueryParam("q"))
+	if err != nil {
+		if errors.Is(err, search.ErrEmptyQuery) {
+			return response.BadRequest(c, "q is required")
+		}
+		return response.BadRequest(c, err.Error())
+	}
+
+	var scope repository.SearchScope
+	if v := c.QueryParam("mailbox_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return response.BadRequest(c, "invalid mailbox ID")
+		}
+		scope.MailboxID = uint(id)
+	}
+	if v := c.QueryParam("domain_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return response.BadRequest(c, "invalid domain ID")
+		}
+		scope.DomainID = uint(id)
+	}
+	if scope.MailboxID == 0 && scope.DomainID == 0 {
+		return response.BadRequest(c, "mailbox_id or domain_id is required")
+	}
+
+	limit := 20
+	offset := 0
+	if l := c.QueryParam("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+	if o := c.QueryParam("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	hits, total, err := h.messageRepo.Search(c.Request().Context(), query, scope, limit, offset)
+	if err != nil {
+		return response.InternalError(c, "failed to search messages")
+	}
+
+	words := query.Words()
+	results := make([]SearchResultResponse, 0, len(hits))
+	for _, hit := range hits {
+		body := hit.BodyText
+		if body == "" {
+			body = search.PlainText(hit.BodyHTML)
+		}
+		results = append(results, SearchResultResponse{
+			ID:               hit.ID,
+			MailboxID:        hit.MailboxID,
+			MailboxAddress:   hit.MailboxAddress,
+			SenderEmail:      hit.SenderEmail,
+			SenderName:       hit.SenderName,
+			Subject:          hit.Subject,
+			IsRead:           hit.IsRead,
+			ReceivedAt:       hit.ReceivedAt,
+			AttachmentCount:  len(hit.Attachments),
+			SubjectHighlight: search.Highlight(hit.Subject, words, 0),
+			Highlight:        search.Highlight(body, words, snippetLength),
+			Rank:             hit.Rank,
+		})
+	}
+
+	return response.Paginated(c, results, total, limit, offset)
+}
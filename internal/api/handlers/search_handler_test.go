@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// SearchHandlerTestSuite is the test suite for SearchHandler
+type SearchHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *SearchHandler
+	mockMessageRepo *mocks.MockMessageRepository
+}
+
+// SetupTest runs before each test
+func (s *SearchHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockMessageRepo = new(mocks.MockMessageRepository)
+	s.handler = NewSearchHandler(s.mockMessageRepo)
+}
+
+// TearDownTest runs after each test
+func (s *SearchHandlerTestSuite) TearDownTest() {
+	s.mockMessageRepo.AssertExpectations(s.T())
+}
+
+// TestSearchHandlerTestSuite runs the test suite
+func TestSearchHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(SearchHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *SearchHandlerTestSuite) createContext(target string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// TestSearch_Success tests a search with highlighted results
+func (s *SearchHandlerTestSuite) TestSearch_Success() {
+	// Arrange
+	c, rec := s.createContext("/api/search?q=invoice+is:unread&mailbox_id=3&limit=5")
+	hits := []models.MessageSearchHit{
+		{
+			Message: models.Message{
+				ID: 7, MailboxID: 3, SenderEmail: "billing@shop.com", Subject: "Your invoice",
+				BodyHTML:    "<p>The <b>invoice</b> is attached</p>",
+				Attachments: []models.Attachment{{ID: 1}},
+			},
+			MailboxAddress: "user@test.com",
+			Rank:           0.5,
+		},
+	}
+	s.mockMessageRepo.On("Search", mock.Anything,
+		mock.MatchedBy(func(q *search.Query) bool {
+			return len(q.Terms) == 1 && q.Terms[0] == "invoice" && q.Unread != nil && *q.Unread
+		}),
+		repository.SearchScope{MailboxID: 3}, 5, 0).Return(hits, int64(1), nil)
+
+	// Act
+	err := s.handler.Search(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	var resp struct {
+		Data []SearchResultResponse `json:"data"`
+		Meta struct {
+			Total int64 `json:"total"`
+		} `json:"meta"`
+	}
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	s.Equal(int64(1), resp.Meta.Total)
+	s.Require().Len(resp.Data, 1)
+	s.Equal("user@test.com", resp.Data[0].MailboxAddress)
+	s.Equal("Your <mark>invoice</mark>", resp.Data[0].SubjectHighlight)
+	s.Equal("The <mark>invoice</mark> is attached", resp.Data[0].Highlight)
+	s.Equal(1, resp.Data[0].AttachmentCount)
+	s.Equal(0.5, resp.Data[0].Rank)
+}
+
+// TestSearch_MissingQuery tests a search without q
+func (s *SearchHandlerTestSuite) TestSearch_MissingQuery() {
+	// Arrange
+	c, rec := s.createContext("/api/search?mailbox_id=3")
+
+	// Act
+	err := s.handler.Search(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+	s.Contains(rec.Body.String(), "q is required")
+}
+
+// TestSearch_InvalidOperator tests a malformed operator
+func (s *SearchHandlerTestSuite) TestSearch_InvalidOperator() {
+	// Arrange
+	c, rec := s.createContext("/api/search?q=before:tomorrow&mailbox_id=3")
+
+	// Act
+	err := s.handler.Search(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestSearch_MissingScope tests a search without mailbox or domain
+func (s *SearchHandlerTestSuite) TestSearch_MissingScope() {
+	// Arrange
+	c, rec := s.createContext("/api/search?q=invoice")
+
+	// Act
+	err := s.handler.Search(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestSearch_RepositoryError tests a failing search
+func (s *SearchHandlerTestSuite) TestSearch_RepositoryError() {
+	// Arrange
+	c, rec := s.createContext("/api/search?q=invoice&domain_id=2")
+	s.mockMessageRepo.On("Search", mock.Anything, mock.Anything, repository.SearchScope{DomainID: 2}, 20, 0).
+		Return(nil, int64(0), errors.New("database error"))
+
+	// Act
+	err := s.handler.Search(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusInternalServerError, rec.Code)
+}
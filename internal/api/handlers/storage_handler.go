@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// StorageHandler handles storage administration endpoints
+type StorageHandler struct {
+	reconciler services.StorageReconcileRunner
+}
+
+// NewStorageHandler creates a new StorageHandler
+func NewStorageHandler(reconciler services.StorageReconcileRunner) *StorageHandler {
+	return &StorageHandler{reconciler: reconciler}
+}
+
+// GetLastReconcile handles GET /api/admin/storage/reconcile
+// Returns the report of the most recent storage reconciliation
+func (h *StorageHandler) GetLastReconcile(c echo.Context) error {
+	report := h.reconciler.LastReport()
+	if report == nil {
+		return response.NotFound(c, "storage reconciliation has not run yet")
+	}
+	return response.Success(c, report)
+}
+
+// Reconcile handles POST /api/admin/storage/reconcile?dry_run=true
+// Removes orphaned files and attachment rows whose file is missing, and returns the report
+func (h *StorageHandler) Reconcile(c echo.Context) error {
+	dryRun, err := parseDryRun(c)
+	if err != nil {
+		return response.BadRequest(c, "dry_run must be a boolean")
+	}
+
+	report, err := h.reconciler.RunOnce(c.Request().Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, services.ErrStorageNotWalkable) {
+			return response.BadRequest(c, "storage backend does not support reconciliation")
+		}
+		return response.InternalError(c, "failed to reconcile storage")
+	}
+
+	return response.Success(c, report)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// fakeReconcileRunner is a test double for services.StorageReconcileRunner
+type fakeReconcileRunner struct {
+	last      *services.ReconcileReport
+	runErr    error
+	runDryRun *bool
+}
+
+func (f *fakeReconcileRunner) LastReport() *services.ReconcileReport {
+	return f.last
+}
+
+func (f *fakeReconcileRunner) RunOnce(ctx context.Context, dryRun bool) (*services.ReconcileReport, error) {
+	f.runDryRun = &dryRun
+	if f.runErr != nil {
+		return nil, f.runErr
+	}
+	return &services.ReconcileReport{DryRun: dryRun, OrphanedFileCount: 2}, nil
+}
+
+func TestStorageHandler_GetLastReconcile_NotRunYet(t *testing.T) {
+	handler := NewStorageHandler(&fakeReconcileRunner{})
+	c, rec := newRetentionContext(http.MethodGet, "/api/admin/storage/reconcile")
+
+	err := handler.GetLastReconcile(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestStorageHandler_Reconcile_DryRun(t *testing.T) {
+	runner := &fakeReconcileRunner{}
+	handler := NewStorageHandler(runner)
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/storage/reconcile?dry_run=1")
+
+	err := handler.Reconcile(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.NotNil(t, runner.runDryRun) {
+		assert.True(t, *runner.runDryRun)
+	}
+	assert.Contains(t, rec.Body.String(), `"orphaned_file_count":2`)
+}
+
+func TestStorageHandler_Reconcile_InvalidDryRun(t *testing.T) {
+	runner := &fakeReconcileRunner{}
+	handler := NewStorageHandler(runner)
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/storage/reconcile?dry_run=maybe")
+
+	err := handler.Reconcile(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Nil(t, runner.runDryRun)
+}
+
+func TestStorageHandler_Reconcile_UnsupportedStorage(t *testing.T) {
+	handler := NewStorageHandler(&fakeReconcileRunner{runErr: services.ErrStorageNotWalkable})
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/storage/reconcile")
+
+	err := handler.Reconcile(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestStorageHandler_Reconcile_Error(t *testing.T) {
+	handler := NewStorageHandler(&fakeReconcileRunner{runErr: errors.New("db down")})
+	c, rec := newRetentionContext(http.MethodPost, "/api/admin/storage/reconcile")
+
+	err := handler.Reconcile(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
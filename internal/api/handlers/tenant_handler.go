@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// apiKeyKey is the context key of a verified API key of the database
+const apiKeyKey = "api_key"
+
+// TenantHandler manages tenants and their API keys and authenticates the
+// requests made with API keys of the database. Requests with a tenant key only
+// see the tenant's rows; super-admin keys and the API_KEY of the configuration
+// see everything.
+type TenantHandler struct {
+	tenants repository.TenantRepository
+	keys    *services.APIKeyService
+	logger  *slog.Logger
+}
+
+// NewTenantHandler creates a new TenantHandler
+func NewTenantHandler(tenants repository.TenantRepository, keys *services.APIKeyService, logger *slog.Logger) *TenantHandler {
+	return &TenantHandler{tenants: tenants, keys: keys, logger: logger}
+}
+
+// TenantRequest represents the request body for creating or updating a tenant;
+// omitted fields are left unchanged on update
+type TenantRequest struct {
+	Name *string `json:"name"`
+	// Limits on what the tenant can own (0 = unlimited)
+	MaxDomains   *int `json:"max_domains"`
+	MaxMailboxes *int `json:"max_mailboxes"`
+}
+
+// TenantResponse represents a tenant with what it owns
+type TenantResponse struct {
+	*models.Tenant
+	Usage *models.TenantUsage `json:"usage"`
+}
+
+// CreateAPIKeyRequest represents the request body for issuing an API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// APIKeyResponse represents a newly issued API key; the key itself is only
+// returned once
+type APIKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// Create handles POST /api/tenants
+func (h *TenantHandler) Create(c echo.Context) error {
+	var req TenantRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		return response.BadRequest(c, "name is required")
+	}
+
+	tenant := &models.Tenant{}
+	if err := applyTenantRequest(tenant, req); err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+	if err := h.tenants.Create(c.Request().Context(), tenant); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return response.Conflict(c, "tenant already exists")
+		}
+		return response.InternalError(c, "failed to create tenant")
+	}
+	return response.Created(c, tenant)
+}
+
+// List handles GET /api/tenants
+// Tenant keys only list their own tenant.
+func (h *TenantHandler) List(c echo.Context) error {
+	tenants, err := h.tenants.List(c.Request().Context())
+	if err != nil {
+		return response.InternalError(c, "failed to list tenants")
+	}
+	return response.Success(c, tenants)
+}
+
+// Get handles GET /api/tenants/:id
+// Returns the tenant with the number of domains and mailboxes it owns.
+func (h *TenantHandler) Get(c echo.Context) error {
+	tenant, ok, err := h.tenant(c)
+	if !ok {
+		return err
+	}
+
+	usage, err := h.tenants.Usage(c.Request().Context(), tenant.ID)
+	if err != nil {
+		return response.InternalError(c, "failed to get tenant usage")
+	}
+	return response.Success(c, TenantResponse{Tenant: tenant, Usage: usage})
+}
+
+// Update handles PUT /api/tenants/:id
+func (h *TenantHandler) Update(c echo.Context) error {
+	tenant, ok, err := h.tenant(c)
+	if !ok {
+		return err
+	}
+	var req TenantRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return response.BadRequest(c, "name cannot be empty")
+	}
+	if err := applyTenantRequest(tenant, req); err != nil {
+		return response.BadRequest(c, err.Error())
+	}
+
+	if err := h.tenants.Update(c.Request().Context(), tenant); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "tenant not found")
+		}
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return response.Conflict(c, "tenant name already exists")
+		}
+		return response.InternalError(c, "failed to update tenant")
+	}
+	return response.Success(c, tenant)
+}
+
+// Delete handles DELETE /api/tenants/:id
+// Tenants still owning domains are refused with 409.
+func (h *TenantHandler) Delete(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid tenant ID")
+	}
+
+	if err := h.tenants.Delete(c.Request().Context(), uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "tenant not found")
+		}
+		if errors.Is(err, repository.ErrInvalidInput) {
+			return response.Conflict(c, "tenant still owns domains")
+		}
+		return response.InternalError(c, "failed to delete tenant")
+	}
+	return response.NoContent(c)
+}
+
+// CreateKey handles POST /api/tenants/:id/keys
+func (h *TenantHandler) CreateKey(c echo.Context) error {
+	tenant, ok, err := h.tenant(c)
+	if !ok {
+		return err
+	}
+	return h.issueKey(c, &tenant.ID)
+}
+
+// ListKeys handles GET /api/tenants/:id/keys
+func (h *TenantHandler) ListKeys(c echo.Context) error {
+	tenant, ok, err := h.tenant(c)
+	if !ok {
+		return err
+	}
+	return h.listKeys(c, &tenant.ID)
+}
+
+// RevokeKey handles DELETE /api/tenants/:id/keys/:key_id
+func (h *TenantHandler) RevokeKey(c echo.Context) error {
+	tenant, ok, err := h.tenant(c)
+	if !ok {
+		return err
+	}
+	return h.revokeKey(c, &tenant.ID)
+}
+
+// CreateAdminKey handles POST /api/admin/keys
+func (h *TenantHandler) CreateAdminKey(c echo.Context) error {
+	return h.issueKey(c, nil)
+}
+
+// ListAdminKeys handles GET /api/admin/keys
+func (h *TenantHandler) ListAdminKeys(c echo.Context) error {
+	return h.listKeys(c, nil)
+}
+
+// RevokeAdminKey handles DELETE /api/admin/keys/:key_id
+func (h *TenantHandler) RevokeAdminKey(c echo.Context) error {
+	return h.revokeKey(c, nil)
+}
+
+// Authenticate admits requests with an API key of the database, limiting
+// those of tenant keys to the tenant, and hands the others to fallback,
+// usually the API key check
+func (h *TenantHandler) Authenticate(fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAPIKey := fallback(next)
+		return func(c echo.Context) error {
+			value := bearerToken(c.Request())
+			if !services.IsAPIKey(value) {
+				return withAPIKey(c)
+			}
+
+			key, err := h.keys.Verify(c.Request().Context(), value)
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidAPIKey) {
+					return response.InternalError(c, "failed to verify API key")
+				}
+				if h.logger != nil {
+					h.logger.Warn("invalid API key attempt",
+						slog.String("ip", c.RealIP()),
+						slog.String("path", c.Path()))
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, map[string]string{
+					"error": "invalid API key",
+					"code":  "UNAUTHORIZED",
+				})
+			}
+			c.Set(apiKeyKey, key)
+			if key.TenantID != nil {
+				req := c.Request()
+				c.SetRequest(req.WithContext(repository.WithTenant(req.Context(), *key.TenantID)))
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireSuperAdmin refuses requests made with a tenant key or a mailbox token
+func (h *TenantHandler) RequireSuperAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := repository.TenantFromContext(c.Request().Context()); ok || mailboxTokenFrom(c) != nil {
+			return response.Forbidden(c, "this route requires a super-admin key")
+		}
+		return next(c)
+	}
+}
+
+// tenant loads the tenant in the id path parameter, writing the error
+// response when it cannot; tenant keys only find their own tenant
+func (h *TenantHandler) tenant(c echo.Context) (*models.Tenant, bool, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, false, response.BadRequest(c, "invalid tenant ID")
+	}
+	tenant, err := h.tenants.GetByID(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, false, response.NotFound(c, "tenant not found")
+		}
+		return nil, false, response.InternalError(c, "failed to get tenant")
+	}
+	return tenant, true, nil
+}
+
+// issueKey issues a key for a tenant, or a super-admin key for nil
+func (h *TenantHandler) issueKey(c echo.Context, tenantID *uint) error {
+	var req CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	if len(req.Name) > 100 {
+		return response.BadRequest(c, "name must be at most 100 characters")
+	}
+
+	key, record, err := h.keys.Issue(c.Request().Context(), tenantID, req.Name)
+	if err != nil {
+		return response.InternalError(c, "failed to issue API key")
+	}
+	return response.Created(c, APIKeyResponse{APIKey: record, Key: key})
+}
+
+// listKeys lists the keys of a tenant, or the super-admin keys for nil
+func (h *TenantHandler) listKeys(c echo.Context, tenantID *uint) error {
+	keys, err := h.keys.List(c.Request().Context(), tenantID)
+	if err != nil {
+		return response.InternalError(c, "failed to list API keys")
+	}
+	return response.Success(c, keys)
+}
+
+// revokeKey revokes the key in the key_id path parameter
+func (h *TenantHandler) revokeKey(c echo.Context, tenantID *uint) error {
+	keyID, err := strconv.ParseUint(c.Param("key_id"), 10, 32)
+	if err != nil {
+		return response.BadRequest(c, "invalid key ID")
+	}
+
+	if err := h.keys.Revoke(c.Request().Context(), tenantID, uint(keyID)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return response.NotFound(c, "API key not found")
+		}
+		return response.InternalError(c, "failed to revoke API key")
+	}
+	return response.NoContent(c)
+}
+
+// applyTenantRequest copies the given fields of a request onto a tenant
+func applyTenantRequest(tenant *models.Tenant, req TenantRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if len(name) > 100 {
+			return errors.New("name must be at most 100 characters")
+		}
+		tenant.Name = name
+	}
+	if req.MaxDomains != nil {
+		if *req.MaxDomains < 0 {
+			return errors.New("max_domains cannot be negative")
+		}
+		tenant.MaxDomains = *req.MaxDomains
+	}
+	if req.MaxMailboxes != nil {
+		if *req.MaxMailboxes < 0 {
+			return errors.New("max_mailboxes cannot be negative")
+		}
+		tenant.MaxMailboxes = *req.MaxMailboxes
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// TenantHandlerTestSuite is the test suite for TenantHandler
+type TenantHandlerTestSuite struct {
+	suite.Suite
+	echo           *echo.Echo
+	handler        *TenantHandler
+	keys           *services.APIKeyService
+	mockTenantRepo *mocks.MockTenantRepository
+	mockKeyRepo    *mocks.MockAPIKeyRepository
+}
+
+// SetupTest runs before each test
+func (s *TenantHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockTenantRepo = new(mocks.MockTenantRepository)
+	s.mockKeyRepo = new(mocks.MockAPIKeyRepository)
+	s.keys = services.NewAPIKeyService(s.mockKeyRepo)
+	s.handler = NewTenantHandler(s.mockTenantRepo, s.keys, nil)
+}
+
+// TearDownTest runs after each test
+func (s *TenantHandlerTestSuite) TearDownTest() {
+	s.mockTenantRepo.AssertExpectations(s.T())
+	s.mockKeyRepo.AssertExpectations(s.T())
+}
+
+// TestTenantHandlerTestSuite runs the test suite
+func TestTenantHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TenantHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *TenantHandlerTestSuite) createContext(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// issue creates a key whose record the repository then finds
+func (s *TenantHandlerTestSuite) issue(tenantID *uint) string {
+	s.mockKeyRepo.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+	key, record, err := s.keys.Issue(context.Background(), tenantID, "")
+	s.Require().NoError(err)
+	s.mockKeyRepo.On("GetByHash", mock.Anything, record.KeyHash).Return(record, nil).Maybe()
+	return key
+}
+
+// TestCreate_Success tests creating a tenant with limits
+func (s *TenantHandlerTestSuite) TestCreate_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/tenants", `{"name":" team ","max_domains":2}`)
+	s.mockTenantRepo.On("Create", mock.Anything, mock.MatchedBy(func(tenant *models.Tenant) bool {
+		return tenant.Name == "team" && tenant.MaxDomains == 2 && tenant.MaxMailboxes == 0
+	})).Return(nil)
+
+	// Act
+	err := s.handler.Create(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+}
+
+// TestCreate_InvalidInput tests missing names and negative limits
+func (s *TenantHandlerTestSuite) TestCreate_InvalidInput() {
+	for _, body := range []string{`{}`, `{"name":"  "}`, `{"name":"team","max_mailboxes":-1}`} {
+		// Arrange
+		c, rec := s.createContext(http.MethodPost, "/api/tenants", body)
+
+		// Act
+		err := s.handler.Create(c)
+
+		// Assert
+		s.NoError(err, body)
+		s.Equal(http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+// TestGet_WithUsage tests that a tenant is returned with what it owns
+func (s *TenantHandlerTestSuite) TestGet_WithUsage() {
+	// Arrange
+	c, rec := s.createContext(http.MethodGet, "/api/tenants/4", "")
+	c.SetParamNames("id")
+	c.SetParamValues("4")
+	s.mockTenantRepo.On("GetByID", mock.Anything, uint(4)).Return(&models.Tenant{ID: 4, Name: "team"}, nil)
+	s.mockTenantRepo.On("Usage", mock.Anything, uint(4)).Return(&models.TenantUsage{Domains: 1, Mailboxes: 3}, nil)
+
+	// Act
+	err := s.handler.Get(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusOK, rec.Code)
+	resp, err := parseAPIResponse(rec)
+	s.Require().NoError(err)
+	data := resp.Data.(map[string]interface{})
+	s.Equal("team", data["name"])
+	s.Equal(float64(3), data["usage"].(map[string]interface{})["mailboxes"])
+}
+
+// TestDelete tests deleting tenants
+func (s *TenantHandlerTestSuite) TestDelete() {
+	s.mockTenantRepo.On("Delete", mock.Anything, uint(4)).Return(nil)
+	s.mockTenantRepo.On("Delete", mock.Anything, uint(5)).Return(repository.ErrInvalidInput)
+	s.mockTenantRepo.On("Delete", mock.Anything, uint(6)).Return(repository.ErrNotFound)
+	tests := []struct {
+		id     string
+		status int
+	}{
+		{"4", http.StatusNoContent},
+		{"5", http.StatusConflict},
+		{"6", http.StatusNotFound},
+		{"abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		// Arrange
+		c, rec := s.createContext(http.MethodDelete, "/api/tenants/"+tt.id, "")
+		c.SetParamNames("id")
+		c.SetParamValues(tt.id)
+
+		// Act
+		err := s.handler.Delete(c)
+
+		// Assert
+		s.NoError(err, tt.id)
+		s.Equal(tt.status, rec.Code, tt.id)
+	}
+}
+
+// TestCreateKey tests issuing a key for a tenant
+func (s *TenantHandlerTestSuite) TestCreateKey() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/tenants/4/keys", `{"name":"ci"}`)
+	c.SetParamNames("id")
+	c.SetParamValues("4")
+	s.mockTenantRepo.On("GetByID", mock.Anything, uint(4)).Return(&models.Tenant{ID: 4}, nil)
+	s.mockKeyRepo.On("Create", mock.Anything, mock.MatchedBy(func(key *models.APIKey) bool {
+		return key.TenantID != nil && *key.TenantID == 4 && key.Role == models.RoleTenant && key.Name == "ci"
+	})).Return(nil)
+
+	// Act
+	err := s.handler.CreateKey(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+	resp, err := parseAPIResponse(rec)
+	s.Require().NoError(err)
+	data := resp.Data.(map[string]interface{})
+	s.True(strings.HasPrefix(data["key"].(string), services.APIKeyPrefix))
+	s.NotContains(data, "key_hash")
+}
+
+// TestCreateKey_OtherTenant tests that tenant keys cannot issue keys of other tenants
+func (s *TenantHandlerTestSuite) TestCreateKey_OtherTenant() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/tenants/5/keys", `{}`)
+	c.SetRequest(c.Request().WithContext(repository.WithTenant(c.Request().Context(), 4)))
+	c.SetParamNames("id")
+	c.SetParamValues("5")
+	s.mockTenantRepo.On("GetByID", mock.Anything, uint(5)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.CreateKey(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestAuthenticate tests the tenant and super-admin keys and the fallback
+func (s *TenantHandlerTestSuite) TestAuthenticate() {
+	// Arrange
+	var tenantID uint
+	var scoped bool
+	s.echo.GET("/api/domains", func(c echo.Context) error {
+		tenantID, scoped = repository.TenantFromContext(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	}, s.handler.Authenticate(rejectAll))
+	four := uint(4)
+	tenantKey := s.issue(&four)
+	adminKey := s.issue(nil)
+	s.mockKeyRepo.On("GetByHash", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		scoped bool
+	}{
+		{"tenant key", tenantKey, http.StatusOK, true},
+		{"super-admin key", adminKey, http.StatusOK, false},
+		{"unknown key", services.APIKeyPrefix + "unknown", http.StatusUnauthorized, false},
+		{"configured API key", "some-api-key", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		tenantID, scoped = 0, false
+		req := httptest.NewRequest(http.MethodGet, "/api/domains", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		rec := httptest.NewRecorder()
+
+		// Act
+		s.echo.ServeHTTP(rec, req)
+
+		// Assert
+		s.Equal(tt.status, rec.Code, tt.name)
+		s.Equal(tt.scoped, scoped, tt.name)
+		if tt.scoped {
+			s.Equal(four, tenantID, tt.name)
+		}
+	}
+}
+
+// TestRequireSuperAdmin tests that tenant keys are refused on super-admin routes
+func (s *TenantHandlerTestSuite) TestRequireSuperAdmin() {
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"super-admin", context.Background(), http.StatusOK},
+		{"tenant", repository.WithTenant(context.Background(), 4), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		// Arrange
+		c, rec := s.createContext(http.MethodGet, "/api/admin/keys", "")
+		c.SetRequest(c.Request().WithContext(tt.ctx))
+
+		// Act
+		err := s.handler.RequireSuperAdmin(ok)(c)
+
+		// Assert
+		s.NoError(err, tt.name)
+		s.Equal(tt.status, rec.Code, tt.name)
+	}
+}
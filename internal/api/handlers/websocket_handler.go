@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/response"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// maxTicketMailboxes limits the mailboxes a ticket can name
+const maxTicketMailboxes = 100
+
+// wsTicketKey is the context key of a verified ticket
+const wsTicketKey = "ws_ticket"
+
+// WebSocketHandler upgrades authenticated connections to the WebSocket hub and
+// issues tickets for browsers, which cannot send headers with the handshake
+type WebSocketHandler struct {
+	mailboxRepo repository.MailboxRepository
+	domainRepo  repository.DomainRepository
+	hub         *websocket.Hub
+	tickets     *websocket.TicketIssuer
+	upgrader    gorillaws.Upgrader
+	logger      *slog.Logger
+}
+
+// NewWebSocketHandler creates a new WebSocketHandler; without tickets only API
+// key authentication is accepted
+func NewWebSocketHandler(mailboxRepo repository.MailboxRepository, domainRepo repository.DomainRepository, hub *websocket.Hub, tickets *websocket.TicketIssuer, logger *slog.Logger) *WebSocketHandler {
+	return &WebSocketHandler{
+		mailboxRepo: mailboxRepo,
+		domainRepo:  domainRepo,
+		hub:         hub,
+		tickets:     tickets,
+		upgrader:    websocket.NewSecureUpgrader(logger),
+		logger:      logger,
+	}
+}
+
+// CreateTicketRequest represents the request body for creating a ticket
+type CreateTicketRequest struct {
+	// MailboxIDs limits the mailboxes the connection can subscribe to; empty
+	// allows every mailbox
+	MailboxIDs []uint `json:"mailbox_ids"`
+}
+
+// TicketResponse represents a ticket for opening a WebSocket connection
+type TicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateTicket handles POST /api/ws/tickets
+// Returns a short-lived ticket to pass as ?ticket= when connecting to /ws
+func (h *WebSocketHandler) CreateTicket(c echo.Context) error {
+	var req CreateTicketRequest
+	if err := c.Bind(&req); err != nil {
+		return response.BadRequest(c, "invalid request body")
+	}
+	if len(req.MailboxIDs) > maxTicketMailboxes {
+		return response.BadRequest(c, fmt.Sprintf("a ticket can name at most %d mailboxes", maxTicketMailboxes))
+	}
+	// Tickets issued for a mailbox token only cover its mailbox
+	if token := mailboxTokenFrom(c); token != nil {
+		for _, id := range req.MailboxIDs {
+			if id != token.MailboxID {
+				return response.Forbidden(c, "mailbox token is not valid for this resource")
+			}
+		}
+		req.MailboxIDs = []uint{token.MailboxID}
+	}
+
+	ctx := c.Request().Context()
+	seen := make(map[uint]bool, len(req.MailboxIDs))
+	mailboxIDs := make([]uint, 0, len(req.MailboxIDs))
+	for _, id := range req.MailboxIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, err := h.mailboxRepo.GetByID(ctx, id); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return response.NotFound(c, fmt.Sprintf("mailbox %d not found", id))
+			}
+			return response.InternalError(c, "failed to get mailbox")
+		}
+		mailboxIDs = append(mailboxIDs, id)
+	}
+
+	// Tickets of tenants keep the connection to the tenant's domains
+	var tenantID *uint
+	if id, ok := repository.TenantFromContext(ctx); ok {
+		tenantID = &id
+	}
+	ticket, expiresAt := h.tickets.IssueForTenant(tenantID, mailboxIDs)
+	return response.Created(c, TicketResponse{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
+// Authenticate admits upgrades with a valid ?ticket= and hands the others to
+// fallback, usually the API key check
+func (h *WebSocketHandler) Authenticate(fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withAPIKey := fallback(next)
+		return func(c echo.Context) error {
+			value := c.QueryParam("ticket")
+			if value == "" || h.tickets == nil {
+				return withAPIKey(c)
+			}
+
+			ticket, err := h.tickets.Verify(value)
+			if err != nil {
+				if h.logger != nil {
+					h.logger.Warn("invalid websocket ticket",
+						slog.String("ip", c.RealIP()),
+						slog.Any("error", err))
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, map[string]string{
+					"error": err.Error(),
+					"code":  "UNAUTHORIZED",
+				})
+			}
+			c.Set(wsTicketKey, ticket)
+			return next(c)
+		}
+	}
+}
+
+// Connect handles GET /ws
+// Upgrades the connection; subscriptions are limited to existing mailboxes and
+// domains and, for ticket and mailbox token connections, to the mailboxes of
+// the ticket or the token
+func (h *WebSocketHandler) Connect(c echo.Context) error {
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("websocket upgrade failed",
+				slog.String("ip", c.RealIP()),
+				slog.Any("error", err))
+		}
+		return err
+	}
+
+	ticket, _ := c.Get(wsTicketKey).(*websocket.Ticket)
+	if token := mailboxTokenFrom(c); ticket == nil && token != nil {
+		ticket = &websocket.Ticket{MailboxIDs: []uint{token.MailboxID}}
+	}
+	authorizer := &mailboxAuthorizer{mailboxRepo: h.mailboxRepo, domainRepo: h.domainRepo, ticket: ticket}
+	if tenantID, ok := repository.TenantFromContext(c.Request().Context()); ok {
+		authorizer.tenantID = &tenantID
+	} else if ticket != nil {
+		authorizer.tenantID = ticket.TenantID
+	}
+	client := websocket.NewClientWithAuthorizer(h.hub, conn, authorizer, h.logger)
+	h.hub.Register(client)
+
+	go client.WritePump()
+	go client.ReadPump()
+
+	return nil
+}
+
+// mailboxAuthorizer allows subscriptions to existing mailboxes covered by the
+// ticket of the connection, if any, and to existing domains for connections
+// whose ticket covers every mailbox. Connections of a tenant only find the
+// mailboxes and domains of the tenant.
+type mailboxAuthorizer struct {
+	mailboxRepo repository.MailboxRepository
+	domainRepo  repository.DomainRepository
+	ticket      *websocket.Ticket
+	tenantID    *uint
+}
+
+// scope limits the repositories to the tenant of the connection, if any
+func (a *mailboxAuthorizer) scope(ctx context.Context) context.Context {
+	if a.tenantID == nil {
+		return ctx
+	}
+	return repository.WithTenant(ctx, *a.tenantID)
+}
+
+// AuthorizeMailbox implements websocket.Authorizer
+func (a *mailboxAuthorizer) AuthorizeMailbox(ctx context.Context, mailboxID uint) error {
+	if a.ticket != nil && !a.ticket.Allows(mailboxID) {
+		return websocket.ErrForbidden
+	}
+	if _, err := a.mailboxRepo.GetByID(a.scope(ctx), mailboxID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return websocket.ErrMailboxNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// AuthorizeDomain implements websocket.Authorizer
+func (a *mailboxAuthorizer) AuthorizeDomain(ctx context.Context, domainID uint) error {
+	// A domain subscription would reach mailboxes outside a limited ticket
+	if a.ticket != nil && len(a.ticket.MailboxIDs) > 0 {
+		return websocket.ErrForbidden
+	}
+	if _, err := a.domainRepo.GetByID(a.scope(ctx), domainID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return websocket.ErrDomainNotFound
+		}
+		return err
+	}
+	return nil
+}
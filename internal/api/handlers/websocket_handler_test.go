@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+	"github.com/welldanyogia/webrana-infinimail-backend/tests/mocks"
+)
+
+// WebSocketHandlerTestSuite is the test suite for WebSocketHandler
+type WebSocketHandlerTestSuite struct {
+	suite.Suite
+	echo            *echo.Echo
+	handler         *WebSocketHandler
+	hub             *websocket.Hub
+	tickets         *websocket.TicketIssuer
+	mockMailboxRepo *mocks.MockMailboxRepository
+	mockDomainRepo  *mocks.MockDomainRepository
+}
+
+// SetupTest runs before each test
+func (s *WebSocketHandlerTestSuite) SetupTest() {
+	s.echo = echo.New()
+	s.mockMailboxRepo = new(mocks.MockMailboxRepository)
+	s.mockDomainRepo = new(mocks.MockDomainRepository)
+	s.hub = websocket.NewHub(nil)
+	go s.hub.Run()
+	tickets, err := websocket.NewTicketIssuer([]byte("test-secret"), time.Minute)
+	s.Require().NoError(err)
+	s.tickets = tickets
+	s.handler = NewWebSocketHandler(s.mockMailboxRepo, s.mockDomainRepo, s.hub, tickets, nil)
+}
+
+// TearDownTest runs after each test
+func (s *WebSocketHandlerTestSuite) TearDownTest() {
+	s.mockMailboxRepo.AssertExpectations(s.T())
+	s.mockDomainRepo.AssertExpectations(s.T())
+}
+
+// TestWebSocketHandlerTestSuite runs the test suite
+func TestWebSocketHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(WebSocketHandlerTestSuite))
+}
+
+// Helper function to create a test context
+func (s *WebSocketHandlerTestSuite) createContext(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	return s.echo.NewContext(req, rec), rec
+}
+
+// rejectAll stands in for the API key check
+func rejectAll(echo.HandlerFunc) echo.HandlerFunc {
+	return func(echo.Context) error {
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing API key")
+	}
+}
+
+// TestCreateTicket_Success tests issuing a ticket limited to mailboxes
+func (s *WebSocketHandlerTestSuite) TestCreateTicket_Success() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/ws/tickets", `{"mailbox_ids":[3,3,5]}`)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.Mailbox{ID: 3}, nil).Once()
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(5)).Return(&models.Mailbox{ID: 5}, nil).Once()
+
+	// Act
+	err := s.handler.CreateTicket(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+	resp, err := parseAPIResponse(rec)
+	s.Require().NoError(err)
+	data := resp.Data.(map[string]interface{})
+	ticket, err := s.tickets.Verify(data["ticket"].(string))
+	s.Require().NoError(err)
+	s.Equal([]uint{3, 5}, ticket.MailboxIDs)
+	s.NotEmpty(data["expires_at"])
+}
+
+// TestCreateTicket_AllMailboxes tests issuing a ticket without a body
+func (s *WebSocketHandlerTestSuite) TestCreateTicket_AllMailboxes() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/ws/tickets", "")
+
+	// Act
+	err := s.handler.CreateTicket(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+}
+
+// TestCreateTicket_Tenant tests that tickets issued with a tenant key carry the tenant
+func (s *WebSocketHandlerTestSuite) TestCreateTicket_Tenant() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/ws/tickets", "")
+	c.SetRequest(c.Request().WithContext(repository.WithTenant(c.Request().Context(), 7)))
+
+	// Act
+	err := s.handler.CreateTicket(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusCreated, rec.Code)
+	resp, err := parseAPIResponse(rec)
+	s.Require().NoError(err)
+	ticket, err := s.tickets.Verify(resp.Data.(map[string]interface{})["ticket"].(string))
+	s.Require().NoError(err)
+	s.Require().NotNil(ticket.TenantID)
+	s.Equal(uint(7), *ticket.TenantID)
+}
+
+// TestCreateTicket_UnknownMailbox tests naming a mailbox that does not exist
+func (s *WebSocketHandlerTestSuite) TestCreateTicket_UnknownMailbox() {
+	// Arrange
+	c, rec := s.createContext(http.MethodPost, "/api/ws/tickets", `{"mailbox_ids":[9]}`)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+
+	// Act
+	err := s.handler.CreateTicket(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestCreateTicket_TooManyMailboxes tests the mailbox limit of a ticket
+func (s *WebSocketHandlerTestSuite) TestCreateTicket_TooManyMailboxes() {
+	// Arrange
+	ids := strings.Repeat("1,", maxTicketMailboxes) + "1"
+	c, rec := s.createContext(http.MethodPost, "/api/ws/tickets", `{"mailbox_ids":[`+ids+`]}`)
+
+	// Act
+	err := s.handler.CreateTicket(c)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestCreateTicket_MailboxToken tests that tickets for a mailbox token only cover its mailbox
+func (s *WebSocketHandlerTestSuite) TestCreateTicket_MailboxToken() {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"no mailboxes", "", http.StatusCreated},
+		{"own mailbox", `{"mailbox_ids":[3]}`, http.StatusCreated},
+		{"other mailbox", `{"mailbox_ids":[3,4]}`, http.StatusForbidden},
+	}
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.Mailbox{ID: 3}, nil)
+
+	for _, tt := range tests {
+		// Arrange
+		c, rec := s.createContext(http.MethodPost, "/api/ws/tickets", tt.body)
+		c.Set(mailboxTokenKey, &models.MailboxToken{MailboxID: 3})
+
+		// Act
+		err := s.handler.CreateTicket(c)
+
+		// Assert
+		s.NoError(err, tt.name)
+		s.Require().Equal(tt.status, rec.Code, tt.name)
+		if tt.status != http.StatusCreated {
+			continue
+		}
+		resp, err := parseAPIResponse(rec)
+		s.Require().NoError(err, tt.name)
+		ticket, err := s.tickets.Verify(resp.Data.(map[string]interface{})["ticket"].(string))
+		s.Require().NoError(err, tt.name)
+		s.Equal([]uint{3}, ticket.MailboxIDs, tt.name)
+	}
+}
+
+// TestAuthenticate tests that upgrades need a valid ticket or pass the fallback
+func (s *WebSocketHandlerTestSuite) TestAuthenticate() {
+	valid, _ := s.tickets.Issue([]uint{3})
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"valid ticket", "/ws?ticket=" + valid, http.StatusOK},
+		{"forged ticket", "/ws?ticket=abc.def", http.StatusUnauthorized},
+		{"no ticket", "/ws", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		// Arrange
+		c, _ := s.createContext(http.MethodGet, tt.target, "")
+		var ticket *websocket.Ticket
+		next := func(c echo.Context) error {
+			ticket, _ = c.Get(wsTicketKey).(*websocket.Ticket)
+			return c.NoContent(http.StatusOK)
+		}
+
+		// Act
+		err := s.handler.Authenticate(rejectAll)(next)(c)
+
+		// Assert
+		if tt.status == http.StatusOK {
+			s.NoError(err, tt.name)
+			s.Require().NotNil(ticket, tt.name)
+			s.Equal([]uint{3}, ticket.MailboxIDs, tt.name)
+			continue
+		}
+		httpErr, ok := err.(*echo.HTTPError)
+		s.Require().True(ok, tt.name)
+		s.Equal(tt.status, httpErr.Code, tt.name)
+	}
+}
+
+// TestAuthenticate_TicketUsedOnce tests that a ticket cannot open a second connection
+func (s *WebSocketHandlerTestSuite) TestAuthenticate_TicketUsedOnce() {
+	// Arrange
+	ticket, _ := s.tickets.Issue([]uint{3})
+	next := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	upgrade := func() error {
+		c, _ := s.createContext(http.MethodGet, "/ws?ticket="+ticket, "")
+		return s.handler.Authenticate(rejectAll)(next)(c)
+	}
+
+	// Act
+	first := upgrade()
+	second := upgrade()
+
+	// Assert
+	s.NoError(first)
+	httpErr, ok := second.(*echo.HTTPError)
+	s.Require().True(ok)
+	s.Equal(http.StatusUnauthorized, httpErr.Code)
+}
+
+// TestMailboxAuthorizer tests the subscription checks of ticket and API key connections
+func (s *WebSocketHandlerTestSuite) TestMailboxAuthorizer() {
+	// Arrange
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(3)).Return(&models.Mailbox{ID: 3}, nil)
+	s.mockMailboxRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+	ticketed := &mailboxAuthorizer{mailboxRepo: s.mockMailboxRepo, ticket: &websocket.Ticket{MailboxIDs: []uint{3}}}
+	apiKey := &mailboxAuthorizer{mailboxRepo: s.mockMailboxRepo}
+	ctx := context.Background()
+
+	// Act & Assert
+	s.NoError(ticketed.AuthorizeMailbox(ctx, 3))
+	s.ErrorIs(ticketed.AuthorizeMailbox(ctx, 9), websocket.ErrForbidden)
+	s.NoError(apiKey.AuthorizeMailbox(ctx, 3))
+	s.ErrorIs(apiKey.AuthorizeMailbox(ctx, 9), websocket.ErrMailboxNotFound)
+}
+
+// TestMailboxAuthorizer_Domain tests the domain subscription checks
+func (s *WebSocketHandlerTestSuite) TestMailboxAuthorizer_Domain() {
+	// Arrange
+	s.mockDomainRepo.On("GetByID", mock.Anything, uint(2)).Return(&models.Domain{ID: 2}, nil)
+	s.mockDomainRepo.On("GetByID", mock.Anything, uint(9)).Return(nil, repository.ErrNotFound)
+	limited := &mailboxAuthorizer{domainRepo: s.mockDomainRepo, ticket: &websocket.Ticket{MailboxIDs: []uint{3}}}
+	unlimited := &mailboxAuthorizer{domainRepo: s.mockDomainRepo, ticket: &websocket.Ticket{}}
+	apiKey := &mailboxAuthorizer{domainRepo: s.mockDomainRepo}
+	ctx := context.Background()
+
+	// Act & Assert
+	s.ErrorIs(limited.AuthorizeDomain(ctx, 2), websocket.ErrForbidden)
+	s.NoError(unlimited.AuthorizeDomain(ctx, 2))
+	s.NoError(apiKey.AuthorizeDomain(ctx, 2))
+	s.ErrorIs(apiKey.AuthorizeDomain(ctx, 9), websocket.ErrDomainNotFound)
+}
+
+// TestMailboxAuthorizer_Tenant tests that tenant connections look mailboxes up as the tenant
+func (s *WebSocketHandlerTestSuite) TestMailboxAuthorizer_Tenant() {
+	// Arrange
+	asTenant := mock.MatchedBy(func(ctx context.Context) bool {
+		tenantID, ok := repository.TenantFromContext(ctx)
+		return ok && tenantID == 7
+	})
+	s.mockMailboxRepo.On("GetByID", asTenant, uint(3)).Return(&models.Mailbox{ID: 3}, nil)
+	s.mockDomainRepo.On("GetByID", asTenant, uint(2)).Return(nil, repository.ErrNotFound)
+	tenantID := uint(7)
+	tenant := &mailboxAuthorizer{mailboxRepo: s.mockMailboxRepo, domainRepo: s.mockDomainRepo, tenantID: &tenantID}
+	ctx := context.Background()
+
+	// Act & Assert
+	s.NoError(tenant.AuthorizeMailbox(ctx, 3))
+	s.ErrorIs(tenant.AuthorizeDomain(ctx, 2), websocket.ErrDomainNotFound)
+}
+
+// TestConnect_RefusesSubscriptionOutsideTicket tests a full connection with a
+// ticket limited to one mailbox
+func (s *WebSocketHandlerTestSuite) TestConnect_RefusesSubscriptionOutsideTicket() {
+	// Arrange
+	s.echo.GET("/ws", s.handler.Connect, s.handler.Authenticate(rejectAll))
+	server := httptest.NewServer(s.echo)
+	defer server.Close()
+	ticket, _ := s.tickets.Issue([]uint{3})
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?ticket=" + ticket
+
+	// Act
+	conn, _, err := gorillaws.DefaultDialer.Dial(url, nil)
+	s.Require().NoError(err)
+	defer conn.Close()
+	s.Require().NoError(conn.WriteJSON(websocket.WSMessage{Type: websocket.MessageTypeSubscribe, MailboxID: 4}))
+
+	// Assert
+	var frame websocket.WSMessage
+	s.Require().NoError(conn.SetReadDeadline(time.Now().Add(time.Second)))
+	s.Require().NoError(conn.ReadJSON(&frame))
+	s.Equal(websocket.MessageTypeError, frame.Type)
+	s.Equal(websocket.ErrorCodeForbidden, frame.Code)
+	s.Equal(uint(4), frame.MailboxID)
+}
+
+// TestConnect_RequiresAuthentication tests that the upgrade is refused without credentials
+func (s *WebSocketHandlerTestSuite) TestConnect_RequiresAuthentication() {
+	// Arrange
+	s.echo.GET("/ws", s.handler.Connect, s.handler.Authenticate(rejectAll))
+	server := httptest.NewServer(s.echo)
+	defer server.Close()
+
+	// Act
+	_, resp, err := gorillaws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+
+	// Assert
+	s.Error(err)
+	s.Require().NotNil(resp)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
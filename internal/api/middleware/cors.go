@@ -12,6 +12,20 @@ import (
 // Reads allowed origins from ALLOWED_ORIGINS environment variable.
 // Does NOT allow wildcard (*) origin in production.
 func SecureCORS() echo.MiddlewareFunc {
+	origins := AllowedOrigins()
+
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE, echo.OPTIONS},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "X-API-Key"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	})
+}
+
+// AllowedOrigins returns the origins of ALLOWED_ORIGINS, the frontends that may
+// call the API. Wildcards are dropped in production.
+func AllowedOrigins() []string {
 	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
 	if allowedOrigins == "" {
 		// Default to localhost only in development
@@ -37,12 +51,5 @@ func SecureCORS() echo.MiddlewareFunc {
 			origins = []string{"http://localhost:3000"}
 		}
 	}
-
-	return middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins:     origins,
-		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE, echo.OPTIONS},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "X-API-Key"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	})
+	return origins
 }
@@ -8,7 +8,8 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
-// RequestLogger returns a middleware that logs HTTP requests
+// RequestLogger returns a middleware that logs HTTP requests. Only the path is
+// logged: query parameters can carry credentials such as WebSocket tickets.
 func RequestLogger(logger *slog.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
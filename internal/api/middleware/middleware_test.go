@@ -60,6 +60,27 @@ func TestRequestLogger_LogsCorrectStatus(t *testing.T) {
 	assert.Contains(t, buf.String(), "404")
 }
 
+func TestRequestLogger_OmitsQuery(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	e := echo.New()
+	e.Use(RequestLogger(logger))
+
+	e.GET("/ws", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	// Tickets and other credentials travel in query parameters
+	req := httptest.NewRequest(http.MethodGet, "/ws?ticket=secret-ticket", nil)
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	assert.Contains(t, buf.String(), "/ws")
+	assert.NotContains(t, buf.String(), "secret-ticket")
+}
+
 func TestCORS_SetsCorrectHeaders(t *testing.T) {
 	e := echo.New()
 	e.Use(CORS())
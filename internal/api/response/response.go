@@ -33,6 +33,8 @@ type Meta struct {
 	Total  int64 `json:"total"`
 	Limit  int   `json:"limit"`
 	Offset int   `json:"offset"`
+	// NextCursor continues keyset pagination after this page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // Success returns a successful response with data
@@ -78,6 +80,20 @@ func Paginated(c echo.Context, data interface{}, total int64, limit, offset int)
 	})
 }
 
+// PaginatedWithCursor returns a paginated response that also carries the cursor of the next page
+func PaginatedWithCursor(c echo.Context, data interface{}, total int64, limit, offset int, nextCursor string) error {
+	return c.JSON(http.StatusOK, PaginatedResponse{
+		Success: true,
+		Data:    data,
+		Meta: Meta{
+			Total:      total,
+			Limit:      limit,
+			Offset:     offset,
+			NextCursor: nextCursor,
+		},
+	})
+}
+
 // Error returns an error response with appropriate status code
 func Error(c echo.Context, err error) error {
 	code := apperrors.GetErrorCode(err)
@@ -118,6 +134,15 @@ func NotFound(c echo.Context, message string) error {
 	})
 }
 
+// Forbidden returns a 403 Forbidden response
+func Forbidden(c echo.Context, message string) error {
+	return c.JSON(http.StatusForbidden, ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    apperrors.CodeForbidden,
+	})
+}
+
 // Conflict returns a 409 Conflict response
 func Conflict(c echo.Context, message string) error {
 	return c.JSON(http.StatusConflict, ErrorResponse{
@@ -103,6 +103,18 @@ func TestPaginated_ReturnsDataWithMeta(t *testing.T) {
 	assert.Equal(t, 0, resp.Meta.Offset)
 }
 
+func TestPaginatedWithCursor_IncludesNextCursor(t *testing.T) {
+	c, rec := setupTestContext()
+
+	err := PaginatedWithCursor(c, []string{"item1"}, 3, 1, 0, "abc")
+
+	require.NoError(t, err)
+	var resp PaginatedResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "abc", resp.Meta.NextCursor)
+	assert.Equal(t, int64(3), resp.Meta.Total)
+}
+
 func TestError_ReturnsCorrectStatusCode(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -201,6 +213,23 @@ func TestNotFound_Returns404(t *testing.T) {
 	assert.Equal(t, apperrors.CodeNotFound, resp.Code)
 }
 
+func TestForbidden_Returns403(t *testing.T) {
+	c, rec := setupTestContext()
+
+	err := Forbidden(c, "access denied")
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	var resp ErrorResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &resp)
+	require.NoError(t, err)
+
+	assert.False(t, resp.Success)
+	assert.Equal(t, "access denied", resp.Error)
+	assert.Equal(t, apperrors.CodeForbidden, resp.Code)
+}
+
 func TestConflict_Returns409(t *testing.T) {
 	c, rec := setupTestContext()
 
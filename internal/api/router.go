@@ -8,9 +8,14 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/handlers"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/api/middleware"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/imageproxy"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/jmap"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/notify"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
 	"gorm.io/gorm"
 )
 
@@ -30,6 +35,26 @@ type RouterConfig struct {
 	DNSVerifier    services.DNSVerifierService
 	DNSExporter    services.DNSExporter
 	CertManager    services.CertificateManagerService
+	// Retention service (optional)
+	Retention services.RetentionRunner
+	// Storage reconciler (optional)
+	StorageReconciler services.StorageReconcileRunner
+	// Image proxy for remote images in rendered messages (optional)
+	ImageProxy *imageproxy.Proxy
+	// Message import into mailboxes (optional)
+	Importer *services.MailboxImporter
+	// Receives bulk update summaries, usually the WebSocket hub (optional)
+	BulkNotifier services.BulkNotifier
+	// Mail client credentials and the servers they are valid for (optional)
+	MailAuth          *mailauth.Authenticator
+	MailAccessServers handlers.MailAccessServers
+	// JMAP for mail clients, authenticated with MailAuth (optional)
+	JMAP        *jmap.Server
+	JMAPBaseURL string // external URL in JMAP session links (empty = from the request)
+	// Hub served on /ws and streamed as Server-Sent Events (optional)
+	EventHub *websocket.Hub
+	// Signs tickets that authorize /ws for browsers (optional, API key only when nil)
+	WSTickets *websocket.TicketIssuer
 }
 
 // NewRouter creates and configures the Echo router with all routes
@@ -63,16 +88,34 @@ func NewRouter(cfg *RouterConfig) *echo.Echo {
 	}
 
 	// Initialize repositories
-	domainRepo := repository.NewDomainRepository(cfg.DB)
-	mailboxRepo := repository.NewMailboxRepository(cfg.DB)
-	messageRepo := repository.NewMessageRepository(cfg.DB)
+	domainRepo := repository.NewDomainRepositoryWithStorage(cfg.DB, cfg.FileStorage)
+	mailboxRepo := repository.NewMailboxRepositoryWithStorage(cfg.DB, cfg.FileStorage)
+	messageRepo := repository.NewMessageRepositoryWithStorage(cfg.DB, cfg.FileStorage)
 	attachmentRepo := repository.NewAttachmentRepository(cfg.DB, cfg.FileStorage)
+	folderRepo := repository.NewFolderRepository(cfg.DB)
+	labelRepo := repository.NewLabelRepository(cfg.DB)
+	if cfg.EventHub != nil {
+		domainRepo = notify.NewDomainRepository(domainRepo, cfg.EventHub)
+		mailboxRepo = notify.NewMailboxRepository(mailboxRepo, cfg.EventHub)
+		messageRepo = notify.NewMessageRepository(messageRepo, cfg.EventHub)
+	}
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(cfg.DB)
-	mailboxHandler := handlers.NewMailboxHandler(mailboxRepo, domainRepo)
-	messageHandler := handlers.NewMessageHandler(messageRepo, mailboxRepo)
-	attachmentHandler := handlers.NewAttachmentHandler(attachmentRepo, messageRepo, cfg.FileStorage)
+	mailboxTokens := services.NewMailboxTokenService(repository.NewMailboxTokenRepository(cfg.DB))
+	mailboxHandler := handlers.NewMailboxHandlerWithTokens(mailboxRepo, domainRepo, mailboxTokens)
+	tokenHandler := handlers.NewMailboxTokenHandler(mailboxTokens, mailboxRepo, messageRepo, attachmentRepo, cfg.Logger)
+	tenantHandler := handlers.NewTenantHandler(repository.NewTenantRepository(cfg.DB),
+		services.NewAPIKeyService(repository.NewAPIKeyRepository(cfg.DB)), cfg.Logger)
+	messageHandler := handlers.NewMessageHandlerWithImageProxy(messageRepo, mailboxRepo, cfg.ImageProxy)
+	messageHandler.SetFrameAncestors(middleware.AllowedOrigins())
+	attachmentHandler := handlers.NewAttachmentHandlerWithImageProxy(attachmentRepo, messageRepo, cfg.FileStorage, cfg.ImageProxy)
+	archiveHandler := handlers.NewArchiveHandler(attachmentRepo, messageRepo, mailboxRepo, cfg.FileStorage)
+	searchHandler := handlers.NewSearchHandler(messageRepo)
+	folderHandler := handlers.NewFolderHandler(folderRepo, mailboxRepo, messageRepo)
+	labelHandler := handlers.NewLabelHandler(labelRepo, mailboxRepo, messageRepo)
+	bulkHandler := handlers.NewBulkHandler(mailboxRepo,
+		services.NewBulkMessageService(messageRepo, mailboxRepo, cfg.FileStorage, cfg.BulkNotifier, cfg.Logger))
 
 	// Initialize domain handler with optional SSL services
 	var domainHandler *handlers.DomainHandler
@@ -92,6 +135,24 @@ func NewRouter(cfg *RouterConfig) *echo.Echo {
 	e.GET("/health", healthHandler.Health)
 	e.GET("/ready", healthHandler.Ready)
 
+	// Image proxy (authorized by URL signature, so <img> tags can load it without an API key)
+	if cfg.ImageProxy != nil {
+		imageProxyHandler := handlers.NewImageProxyHandler(cfg.ImageProxy)
+		e.GET(imageproxy.Path, imageProxyHandler.Serve)
+	}
+
+	// JMAP routes (authenticated with mail client credentials instead of the API key)
+	if cfg.JMAP != nil && cfg.MailAuth != nil {
+		jmapHandler := handlers.NewJMAPHandler(mailboxRepo, cfg.MailAuth, cfg.JMAP, cfg.JMAPBaseURL)
+		e.GET("/.well-known/jmap", jmapHandler.WellKnown)
+		jmapRoutes := e.Group("/jmap")
+		jmapRoutes.GET("/session", jmapHandler.Session)
+		jmapRoutes.POST("/api", jmapHandler.API)
+		jmapRoutes.GET("/download/:accountId/:blobId/:name", jmapHandler.Download)
+		jmapRoutes.POST("/upload/:accountId/", jmapHandler.Upload)
+		jmapRoutes.GET("/eventsource", jmapHandler.EventSource)
+	}
+
 	// API routes
 	api := e.Group("/api")
 
@@ -100,7 +161,19 @@ func NewRouter(cfg *RouterConfig) *echo.Echo {
 	if cfg.EnableAuth && cfg.APIKey != "" {
 		os.Setenv("API_KEY", cfg.APIKey)
 	}
-	api.Use(middleware.APIKeyAuth(cfg.Logger))
+	// Mailbox tokens are accepted on the routes passed to tokenHandler.Allow;
+	// API keys of the database limit tenants to their own domains
+	apiKeyAuth := tenantHandler.Authenticate(middleware.APIKeyAuth(cfg.Logger))
+	api.Use(tokenHandler.Authenticate(apiKeyAuth))
+
+	// WebSocket routes (API key, mailbox token or a ticket from POST /api/ws/tickets)
+	if cfg.EventHub != nil {
+		wsHandler := handlers.NewWebSocketHandler(mailboxRepo, domainRepo, cfg.EventHub, cfg.WSTickets, cfg.Logger)
+		tokenHandler.Allow(e.GET("/ws", wsHandler.Connect, wsHandler.Authenticate(tokenHandler.Authenticate(apiKeyAuth))), nil)
+		if cfg.WSTickets != nil {
+			tokenHandler.Allow(api.POST("/ws/tickets", wsHandler.CreateTicket), nil)
+		}
+	}
 
 	// Domain routes
 	domains := api.Group("/domains")
@@ -122,35 +195,111 @@ func NewRouter(cfg *RouterConfig) *echo.Echo {
 	domains.POST("/:id/submit-acme-challenge", domainHandler.SubmitACMEChallenge)
 	domains.GET("/:id/acme-status", domainHandler.GetACMEStatus)
 
+	var eventsHandler *handlers.EventsHandler
+	if cfg.EventHub != nil {
+		eventsHandler = handlers.NewEventsHandler(mailboxRepo, domainRepo, cfg.EventHub)
+		domains.GET("/:id/events", eventsHandler.Domain)
+	}
+
 	// Mailbox routes
 	mailboxes := api.Group("/mailboxes")
 	mailboxes.POST("", mailboxHandler.Create)
 	mailboxes.POST("/random", mailboxHandler.CreateRandom)
 	mailboxes.GET("", mailboxHandler.List)
-	mailboxes.GET("/:id", mailboxHandler.Get)
+	tokenHandler.Allow(mailboxes.GET("/:id", mailboxHandler.Get), tokenHandler.Mailbox("id"))
 	mailboxes.DELETE("/:id", mailboxHandler.Delete)
+	tokenHandler.Allow(mailboxes.GET("/:id/attachments.zip", archiveHandler.MailboxAttachments), tokenHandler.Mailbox("id"))
+	mailboxes.GET("/:id/export", archiveHandler.ExportMailbox)
+	tokenHandler.Allow(mailboxes.POST("/:id/mark-all-read", bulkHandler.MarkAllRead), tokenHandler.Mailbox("id"))
+	mailboxes.GET("/:id/tokens", tokenHandler.List)
+	mailboxes.POST("/:id/tokens", tokenHandler.Create)
+	mailboxes.DELETE("/:id/tokens/:token_id", tokenHandler.Revoke)
+	mailboxes.GET("/:id/folders", folderHandler.List)
+	mailboxes.POST("/:id/folders", folderHandler.Create)
+	mailboxes.GET("/:id/labels", labelHandler.List)
+	mailboxes.POST("/:id/labels", labelHandler.Create)
+	if cfg.Importer != nil {
+		importHandler := handlers.NewImportHandler(mailboxRepo, cfg.Importer)
+		mailboxes.POST("/:id/import", importHandler.Import)
+	}
+	if eventsHandler != nil {
+		tokenHandler.Allow(mailboxes.GET("/:id/events", eventsHandler.Mailbox), tokenHandler.Mailbox("id"))
+	}
+	if cfg.MailAuth != nil {
+		mailAccessHandler := handlers.NewMailAccessHandler(mailboxRepo, cfg.MailAuth, cfg.MailAccessServers)
+		mailboxes.GET("/:id/credentials", mailAccessHandler.Credentials)
+	}
 
 	// Message routes (nested under mailboxes)
-	mailboxes.GET("/:mailbox_id/messages", messageHandler.List)
+	tokenHandler.Allow(mailboxes.GET("/:mailbox_id/messages", messageHandler.List), tokenHandler.Mailbox("mailbox_id"))
+	tokenHandler.Allow(mailboxes.DELETE("/:mailbox_id/messages", bulkHandler.DeleteAll), tokenHandler.Mailbox("mailbox_id"))
 
 	// Message routes (standalone)
 	messages := api.Group("/messages")
-	messages.GET("/:id", messageHandler.Get)
-	messages.PATCH("/:id/read", messageHandler.MarkAsRead)
-	messages.DELETE("/:id", messageHandler.Delete)
+	messages.POST("/bulk", bulkHandler.Bulk)
+	tokenHandler.Allow(messages.GET("/:id", messageHandler.Get), tokenHandler.Message("id"))
+	tokenHandler.Allow(messages.GET("/:id/html", messageHandler.HTML), tokenHandler.Message("id"))
+	tokenHandler.Allow(messages.PATCH("/:id/read", messageHandler.MarkAsRead), tokenHandler.Message("id"))
+	tokenHandler.Allow(messages.PATCH("/:id/flags", messageHandler.UpdateFlags), tokenHandler.Message("id"))
+	messages.PUT("/:id/folder", folderHandler.MoveMessage)
+	messages.GET("/:id/labels", labelHandler.ListMessageLabels)
+	messages.PUT("/:id/labels", labelHandler.SetMessageLabels)
+	tokenHandler.Allow(messages.DELETE("/:id", messageHandler.Delete), tokenHandler.Message("id"))
 
 	// Attachment routes (nested under messages)
-	messages.GET("/:message_id/attachments", attachmentHandler.List)
+	tokenHandler.Allow(messages.GET("/:message_id/attachments", attachmentHandler.List), tokenHandler.Message("message_id"))
+	tokenHandler.Allow(messages.GET("/:id/attachments.zip", archiveHandler.MessageAttachments), tokenHandler.Message("id"))
+
+	// Folder routes (standalone)
+	folders := api.Group("/folders")
+	folders.PATCH("/:id", folderHandler.Rename)
+	folders.DELETE("/:id", folderHandler.Delete)
+
+	// Label routes (standalone)
+	labels := api.Group("/labels")
+	labels.PATCH("/:id", labelHandler.Update)
+	labels.DELETE("/:id", labelHandler.Delete)
 
 	// Attachment routes (standalone)
 	attachments := api.Group("/attachments")
-	attachments.GET("/:id", attachmentHandler.Get)
-	attachments.GET("/:id/download", attachmentHandler.Download)
+	tokenHandler.Allow(attachments.GET("/:id", attachmentHandler.Get), tokenHandler.Attachment("id"))
+	tokenHandler.Allow(attachments.GET("/:id/download", attachmentHandler.Download), tokenHandler.Attachment("id"))
+	tokenHandler.Allow(attachments.GET("/:id/thumbnail", attachmentHandler.Thumbnail), tokenHandler.Attachment("id"))
+
+	// Search routes
+	api.GET("/search", searchHandler.Search)
+
+	// Tenant routes (tenant keys only see their own tenant and cannot change it)
+	tenants := api.Group("/tenants")
+	tenants.POST("", tenantHandler.Create, tenantHandler.RequireSuperAdmin)
+	tenants.GET("", tenantHandler.List)
+	tenants.GET("/:id", tenantHandler.Get)
+	tenants.PUT("/:id", tenantHandler.Update, tenantHandler.RequireSuperAdmin)
+	tenants.DELETE("/:id", tenantHandler.Delete, tenantHandler.RequireSuperAdmin)
+	tenants.GET("/:id/keys", tenantHandler.ListKeys)
+	tenants.POST("/:id/keys", tenantHandler.CreateKey)
+	tenants.DELETE("/:id/keys/:key_id", tenantHandler.RevokeKey)
+
+	// Admin routes (super-admin keys only)
+	admin := api.Group("/admin", tenantHandler.RequireSuperAdmin)
+	admin.GET("/keys", tenantHandler.ListAdminKeys)
+	admin.POST("/keys", tenantHandler.CreateAdminKey)
+	admin.DELETE("/keys/:key_id", tenantHandler.RevokeAdminKey)
+	if cfg.Retention != nil {
+		retentionHandler := handlers.NewRetentionHandler(cfg.Retention)
+		admin.GET("/retention", retentionHandler.GetLastRun)
+		admin.POST("/retention/run", retentionHandler.Run)
+	}
+	if cfg.StorageReconciler != nil {
+		storageHandler := handlers.NewStorageHandler(cfg.StorageReconciler)
+		admin.GET("/storage/reconcile", storageHandler.GetLastReconcile)
+		admin.POST("/storage/reconcile", storageHandler.Reconcile)
+	}
 
 	// ACME Log routes (for debugging certificate generation)
 	acmeLogHandler := handlers.NewACMELogHandler()
 	// JSON API endpoints
-	acmeLogs := api.Group("/acme/logs")
+	acmeLogs := api.Group("/acme/logs", tenantHandler.RequireSuperAdmin)
 	acmeLogs.GET("", acmeLogHandler.ListLogs)
 	acmeLogs.GET("/:domain", acmeLogHandler.GetDomainLog)
 	// Browser-friendly HTML endpoints (no auth required for easy access)
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -14,15 +15,51 @@ type Config struct {
 	DatabaseURL string
 
 	// Server ports
-	APIPort  int
-	SMTPPort int
+	APIPort   int
+	SMTPPort  int
+	IMAPPort  int // 0 disables the STARTTLS listener
+	IMAPSPort int // 0 disables the implicit TLS listener
+	POP3Port  int // 0 disables the STLS listener
+	POP3SPort int // 0 disables the implicit TLS listener
 
 	// Features
 	AutoProvisioningEnabled bool
 
 	// Storage
+	StorageBackend        string // "local" or "s3"
 	AttachmentStoragePath string
 
+	// S3-compatible object storage (STORAGE_BACKEND=s3)
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3Prefix         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3UseSSL         bool
+	S3ForcePathStyle bool
+	S3SSE            string
+	S3SSEKMSKeyID    string
+	S3PartSizeMB     int
+	S3PresignExpiry  string
+
+	// Encryption at rest
+	EncryptionKey        string // base64 master key
+	EncryptionKeyFile    string // file with one base64 master key per line, primary first
+	EncryptMessageBodies bool
+	// SearchEncryptedBodies indexes encrypted bodies for search without word positions
+	SearchEncryptedBodies bool
+
+	// Remote images in rendered messages
+	ImageProxySecret string // signs image proxy URLs; random per process when empty
+	PublicBaseURL    string // external URL of the API, used in image proxy URLs
+
+	// Mail client access (IMAP, POP3 and JMAP)
+	MailAccessSecret string // derives per-mailbox passwords; random per process when empty
+	WSTicketSecret   string // signs WebSocket tickets; random per process when empty
+	EventBackend     string // "memory" or "postgres" to share WebSocket events between instances
+	JMAPEnabled      bool   // serves JMAP under /jmap on the API port
+
 	// Logging
 	LogLevel string
 
@@ -46,6 +83,17 @@ type Config struct {
 	CertStoragePath           string
 	CertRenewalDays           int
 	CertRenewalCheckInterval  string
+
+	// Retention Configuration
+	RetentionCheckInterval string
+	RetentionMessageHours  int
+	RetentionMailboxDays   int
+	RetentionDryRun        bool
+
+	// Storage Reconciliation Configuration
+	StorageReconcileInterval string
+	StorageReconcileMinAge   string
+	StorageReconcileDryRun   bool
 }
 
 // Load reads configuration from environment variables
@@ -82,6 +130,38 @@ func Load() (*Config, error) {
 		cfg.SMTPPort = port
 	}
 
+	// IMAP_PORT and IMAPS_PORT (default: disabled)
+	if imapPort := os.Getenv("IMAP_PORT"); imapPort != "" {
+		port, err := strconv.Atoi(imapPort)
+		if err != nil {
+			return nil, fmt.Errorf("IMAP_PORT must be a valid integer: %w", err)
+		}
+		cfg.IMAPPort = port
+	}
+	if imapsPort := os.Getenv("IMAPS_PORT"); imapsPort != "" {
+		port, err := strconv.Atoi(imapsPort)
+		if err != nil {
+			return nil, fmt.Errorf("IMAPS_PORT must be a valid integer: %w", err)
+		}
+		cfg.IMAPSPort = port
+	}
+
+	// POP3_PORT and POP3S_PORT (default: disabled)
+	if pop3Port := os.Getenv("POP3_PORT"); pop3Port != "" {
+		port, err := strconv.Atoi(pop3Port)
+		if err != nil {
+			return nil, fmt.Errorf("POP3_PORT must be a valid integer: %w", err)
+		}
+		cfg.POP3Port = port
+	}
+	if pop3sPort := os.Getenv("POP3S_PORT"); pop3sPort != "" {
+		port, err := strconv.Atoi(pop3sPort)
+		if err != nil {
+			return nil, fmt.Errorf("POP3S_PORT must be a valid integer: %w", err)
+		}
+		cfg.POP3SPort = port
+	}
+
 	// AUTO_PROVISIONING_ENABLED (default: true)
 	autoProvisioning := os.Getenv("AUTO_PROVISIONING_ENABLED")
 	if autoProvisioning == "" {
@@ -100,6 +180,98 @@ func Load() (*Config, error) {
 		cfg.AttachmentStoragePath = "./attachments"
 	}
 
+	// STORAGE_BACKEND (default: local)
+	cfg.StorageBackend = strings.ToLower(os.Getenv("STORAGE_BACKEND"))
+	if cfg.StorageBackend == "" {
+		cfg.StorageBackend = "local"
+	}
+
+	// S3-compatible object storage
+	cfg.S3Endpoint = os.Getenv("S3_ENDPOINT")
+	cfg.S3Region = os.Getenv("S3_REGION")
+	cfg.S3Bucket = os.Getenv("S3_BUCKET")
+	cfg.S3Prefix = os.Getenv("S3_PREFIX")
+	cfg.S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	cfg.S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	cfg.S3SSE = os.Getenv("S3_SSE")
+	cfg.S3SSEKMSKeyID = os.Getenv("S3_SSE_KMS_KEY_ID")
+
+	s3UseSSL := os.Getenv("S3_USE_SSL")
+	if s3UseSSL == "" {
+		cfg.S3UseSSL = true
+	} else {
+		v, err := strconv.ParseBool(s3UseSSL)
+		if err != nil {
+			return nil, fmt.Errorf("S3_USE_SSL must be a valid boolean: %w", err)
+		}
+		cfg.S3UseSSL = v
+	}
+
+	if pathStyle := os.Getenv("S3_FORCE_PATH_STYLE"); pathStyle != "" {
+		v, err := strconv.ParseBool(pathStyle)
+		if err != nil {
+			return nil, fmt.Errorf("S3_FORCE_PATH_STYLE must be a valid boolean: %w", err)
+		}
+		cfg.S3ForcePathStyle = v
+	}
+
+	s3PartSize := os.Getenv("S3_PART_SIZE_MB")
+	if s3PartSize == "" {
+		cfg.S3PartSizeMB = 16
+	} else {
+		v, err := strconv.Atoi(s3PartSize)
+		if err != nil {
+			return nil, fmt.Errorf("S3_PART_SIZE_MB must be a valid integer: %w", err)
+		}
+		cfg.S3PartSizeMB = v
+	}
+
+	cfg.S3PresignExpiry = os.Getenv("S3_PRESIGN_EXPIRY")
+	if cfg.S3PresignExpiry == "" {
+		cfg.S3PresignExpiry = "15m"
+	}
+
+	// Encryption at rest (disabled unless a master key is configured)
+	cfg.EncryptionKey = os.Getenv("ENCRYPTION_KEY")
+	cfg.EncryptionKeyFile = os.Getenv("ENCRYPTION_KEY_FILE")
+	if encryptBodies := os.Getenv("ENCRYPT_MESSAGE_BODIES"); encryptBodies != "" {
+		v, err := strconv.ParseBool(encryptBodies)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPT_MESSAGE_BODIES must be a valid boolean: %w", err)
+		}
+		cfg.EncryptMessageBodies = v
+	}
+	if searchBodies := os.Getenv("SEARCH_ENCRYPTED_BODIES"); searchBodies != "" {
+		v, err := strconv.ParseBool(searchBodies)
+		if err != nil {
+			return nil, fmt.Errorf("SEARCH_ENCRYPTED_BODIES must be a valid boolean: %w", err)
+		}
+		cfg.SearchEncryptedBodies = v
+	}
+
+	// Image proxy (relative URLs and a per-process secret by default)
+	cfg.ImageProxySecret = os.Getenv("IMAGE_PROXY_SECRET")
+	cfg.PublicBaseURL = strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+
+	// WebSocket tickets for browsers
+	cfg.WSTicketSecret = os.Getenv("WS_TICKET_SECRET")
+
+	// EVENT_BACKEND (default: memory, events stay in this instance)
+	cfg.EventBackend = strings.ToLower(os.Getenv("EVENT_BACKEND"))
+	if cfg.EventBackend == "" {
+		cfg.EventBackend = "memory"
+	}
+
+	// Mail client access
+	cfg.MailAccessSecret = os.Getenv("MAIL_ACCESS_SECRET")
+	if jmapEnabled := os.Getenv("JMAP_ENABLED"); jmapEnabled != "" {
+		v, err := strconv.ParseBool(jmapEnabled)
+		if err != nil {
+			return nil, fmt.Errorf("JMAP_ENABLED must be a valid boolean: %w", err)
+		}
+		cfg.JMAPEnabled = v
+	}
+
 	// LOG_LEVEL (default: info)
 	cfg.LogLevel = os.Getenv("LOG_LEVEL")
 	if cfg.LogLevel == "" {
@@ -182,6 +354,55 @@ func Load() (*Config, error) {
 		cfg.CertRenewalCheckInterval = "24h"
 	}
 
+	// Retention Configuration
+	cfg.RetentionCheckInterval = os.Getenv("RETENTION_CHECK_INTERVAL")
+	if cfg.RetentionCheckInterval == "" {
+		cfg.RetentionCheckInterval = "1h"
+	}
+
+	if hours := os.Getenv("RETENTION_MESSAGE_HOURS"); hours != "" {
+		v, err := strconv.Atoi(hours)
+		if err != nil {
+			return nil, fmt.Errorf("RETENTION_MESSAGE_HOURS must be a valid integer: %w", err)
+		}
+		cfg.RetentionMessageHours = v
+	}
+
+	if days := os.Getenv("RETENTION_MAILBOX_DAYS"); days != "" {
+		v, err := strconv.Atoi(days)
+		if err != nil {
+			return nil, fmt.Errorf("RETENTION_MAILBOX_DAYS must be a valid integer: %w", err)
+		}
+		cfg.RetentionMailboxDays = v
+	}
+
+	if dryRun := os.Getenv("RETENTION_DRY_RUN"); dryRun != "" {
+		v, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("RETENTION_DRY_RUN must be a valid boolean: %w", err)
+		}
+		cfg.RetentionDryRun = v
+	}
+
+	// Storage Reconciliation Configuration
+	cfg.StorageReconcileInterval = os.Getenv("STORAGE_RECONCILE_INTERVAL")
+	if cfg.StorageReconcileInterval == "" {
+		cfg.StorageReconcileInterval = "24h"
+	}
+
+	cfg.StorageReconcileMinAge = os.Getenv("STORAGE_RECONCILE_MIN_AGE")
+	if cfg.StorageReconcileMinAge == "" {
+		cfg.StorageReconcileMinAge = "1h"
+	}
+
+	if dryRun := os.Getenv("STORAGE_RECONCILE_DRY_RUN"); dryRun != "" {
+		v, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("STORAGE_RECONCILE_DRY_RUN must be a valid boolean: %w", err)
+		}
+		cfg.StorageReconcileDryRun = v
+	}
+
 	return cfg, nil
 }
 
@@ -217,12 +438,77 @@ func (c *Config) Validate() error {
 	if c.SMTPPort <= 0 || c.SMTPPort > 65535 {
 		return fmt.Errorf("SMTPPort must be between 1 and 65535")
 	}
+	if c.IMAPPort < 0 || c.IMAPPort > 65535 {
+		return fmt.Errorf("IMAPPort must be between 0 and 65535")
+	}
+	if c.IMAPSPort < 0 || c.IMAPSPort > 65535 {
+		return fmt.Errorf("IMAPSPort must be between 0 and 65535")
+	}
+	if c.POP3Port < 0 || c.POP3Port > 65535 {
+		return fmt.Errorf("POP3Port must be between 0 and 65535")
+	}
+	if c.POP3SPort < 0 || c.POP3SPort > 65535 {
+		return fmt.Errorf("POP3SPort must be between 0 and 65535")
+	}
 	if c.AttachmentStoragePath == "" {
 		return fmt.Errorf("AttachmentStoragePath cannot be empty")
 	}
+	switch c.StorageBackend {
+	case "", "local":
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			return fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required when STORAGE_BACKEND is s3")
+		}
+		if c.S3PartSizeMB < 5 {
+			return fmt.Errorf("S3_PART_SIZE_MB must be at least 5")
+		}
+	default:
+		return fmt.Errorf("STORAGE_BACKEND must be local or s3")
+	}
+	if c.EncryptionKey != "" && c.EncryptionKeyFile != "" {
+		return fmt.Errorf("set only one of ENCRYPTION_KEY and ENCRYPTION_KEY_FILE")
+	}
+	if c.EncryptMessageBodies && !c.EncryptionEnabled() {
+		return fmt.Errorf("ENCRYPT_MESSAGE_BODIES requires ENCRYPTION_KEY or ENCRYPTION_KEY_FILE")
+	}
+	if c.ImageProxySecret != "" && len(c.ImageProxySecret) < 32 {
+		return fmt.Errorf("IMAGE_PROXY_SECRET must be at least 32 characters")
+	}
+	if c.PublicBaseURL != "" {
+		u, err := url.Parse(c.PublicBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("PUBLIC_BASE_URL must be an absolute http or https URL")
+		}
+	}
+	if c.MailAccessSecret != "" && len(c.MailAccessSecret) < 32 {
+		return fmt.Errorf("MAIL_ACCESS_SECRET must be at least 32 characters")
+	}
+	if c.WSTicketSecret != "" && len(c.WSTicketSecret) < 32 {
+		return fmt.Errorf("WS_TICKET_SECRET must be at least 32 characters")
+	}
+	switch c.EventBackend {
+	case "", "memory", "postgres":
+	default:
+		return fmt.Errorf("EVENT_BACKEND must be memory or postgres")
+	}
 	return nil
 }
 
+// IMAPEnabled reports whether an IMAP listener is configured
+func (c *Config) IMAPEnabled() bool {
+	return c.IMAPPort != 0 || c.IMAPSPort != 0
+}
+
+// POP3Enabled reports whether a POP3 listener is configured
+func (c *Config) POP3Enabled() bool {
+	return c.POP3Port != 0 || c.POP3SPort != 0
+}
+
+// EncryptionEnabled reports whether a master key is configured for encryption at rest
+func (c *Config) EncryptionEnabled() bool {
+	return c.EncryptionKey != "" || c.EncryptionKeyFile != ""
+}
+
 // ValidateProduction performs additional validation for production environment
 func (c *Config) ValidateProduction() error {
 	if c.APIKey == "" {
@@ -265,8 +551,27 @@ func (c *Config) LogConfig(logger *slog.Logger) {
 	logger.Info("configuration loaded",
 		slog.Int("api_port", c.APIPort),
 		slog.Int("smtp_port", c.SMTPPort),
+		slog.Int("imap_port", c.IMAPPort),
+		slog.Int("imaps_port", c.IMAPSPort),
+		slog.Int("pop3_port", c.POP3Port),
+		slog.Int("pop3s_port", c.POP3SPort),
+		slog.Bool("mail_access_secret_set", c.MailAccessSecret != ""),
+		slog.Bool("jmap_enabled", c.JMAPEnabled),
 		slog.Bool("auto_provisioning", c.AutoProvisioningEnabled),
+		slog.String("storage_backend", c.StorageBackend),
 		slog.String("storage_path", c.AttachmentStoragePath),
+		slog.String("s3_endpoint", c.S3Endpoint),
+		slog.String("s3_bucket", c.S3Bucket),
+		slog.String("s3_prefix", c.S3Prefix),
+		slog.String("s3_sse", c.S3SSE),
+		slog.Bool("s3_credentials_set", c.S3AccessKey != ""),
+		slog.Bool("encryption_enabled", c.EncryptionEnabled()),
+		slog.Bool("encrypt_message_bodies", c.EncryptMessageBodies),
+		slog.Bool("search_encrypted_bodies", c.SearchEncryptedBodies),
+		slog.Bool("image_proxy_secret_set", c.ImageProxySecret != ""),
+		slog.Bool("ws_ticket_secret_set", c.WSTicketSecret != ""),
+		slog.String("event_backend", c.EventBackend),
+		slog.String("public_base_url", c.PublicBaseURL),
 		slog.String("log_level", c.LogLevel),
 		slog.String("app_env", c.AppEnv),
 		slog.Bool("api_key_set", c.APIKey != ""),
@@ -281,5 +586,12 @@ func (c *Config) LogConfig(logger *slog.Logger) {
 		slog.String("cert_storage_path", c.CertStoragePath),
 		slog.Int("cert_renewal_days", c.CertRenewalDays),
 		slog.String("cert_renewal_check_interval", c.CertRenewalCheckInterval),
+		slog.String("retention_check_interval", c.RetentionCheckInterval),
+		slog.Int("retention_message_hours", c.RetentionMessageHours),
+		slog.Int("retention_mailbox_days", c.RetentionMailboxDays),
+		slog.Bool("retention_dry_run", c.RetentionDryRun),
+		slog.String("storage_reconcile_interval", c.StorageReconcileInterval),
+		slog.String("storage_reconcile_min_age", c.StorageReconcileMinAge),
+		slog.Bool("storage_reconcile_dry_run", c.StorageReconcileDryRun),
 	)
 }
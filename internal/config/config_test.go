@@ -328,3 +328,317 @@ func TestLoad_InvalidCertRenewalDays(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "CERT_RENEWAL_DAYS must be a valid integer")
 }
+
+func TestLoad_RetentionValues(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("RETENTION_MESSAGE_HOURS", "48")
+	os.Setenv("RETENTION_MAILBOX_DAYS", "14")
+	os.Setenv("RETENTION_DRY_RUN", "true")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("RETENTION_MESSAGE_HOURS")
+		os.Unsetenv("RETENTION_MAILBOX_DAYS")
+		os.Unsetenv("RETENTION_DRY_RUN")
+	}()
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "1h", cfg.RetentionCheckInterval)
+	assert.Equal(t, 48, cfg.RetentionMessageHours)
+	assert.Equal(t, 14, cfg.RetentionMailboxDays)
+	assert.True(t, cfg.RetentionDryRun)
+}
+
+func TestLoad_InvalidRetentionHours(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("RETENTION_MESSAGE_HOURS", "forever")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("RETENTION_MESSAGE_HOURS")
+	}()
+
+	_, err := Load()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "RETENTION_MESSAGE_HOURS")
+}
+
+func TestLoad_StorageReconcileDefaults(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	defer os.Unsetenv("DATABASE_URL")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "24h", cfg.StorageReconcileInterval)
+	assert.Equal(t, "1h", cfg.StorageReconcileMinAge)
+	assert.False(t, cfg.StorageReconcileDryRun)
+}
+
+func TestLoad_InvalidStorageReconcileDryRun(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("STORAGE_RECONCILE_DRY_RUN", "sometimes")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("STORAGE_RECONCILE_DRY_RUN")
+	}()
+
+	_, err := Load()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "STORAGE_RECONCILE_DRY_RUN")
+}
+
+func TestLoad_S3Config(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("STORAGE_BACKEND", "S3")
+	os.Setenv("S3_ENDPOINT", "minio:9000")
+	os.Setenv("S3_BUCKET", "mail")
+	os.Setenv("S3_USE_SSL", "false")
+	os.Setenv("S3_FORCE_PATH_STYLE", "true")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("STORAGE_BACKEND")
+		os.Unsetenv("S3_ENDPOINT")
+		os.Unsetenv("S3_BUCKET")
+		os.Unsetenv("S3_USE_SSL")
+		os.Unsetenv("S3_FORCE_PATH_STYLE")
+	}()
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+
+	assert.Equal(t, "s3", cfg.StorageBackend)
+	assert.Equal(t, "minio:9000", cfg.S3Endpoint)
+	assert.Equal(t, "mail", cfg.S3Bucket)
+	assert.False(t, cfg.S3UseSSL)
+	assert.True(t, cfg.S3ForcePathStyle)
+	assert.Equal(t, 16, cfg.S3PartSizeMB)
+	assert.Equal(t, "15m", cfg.S3PresignExpiry)
+}
+
+func TestValidate_S3RequiresBucket(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:           "postgres://localhost/test",
+		APIPort:               8080,
+		SMTPPort:              2525,
+		AttachmentStoragePath: "./attachments",
+		StorageBackend:        "s3",
+		S3Endpoint:            "minio:9000",
+		S3PartSizeMB:          16,
+	}
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "S3_BUCKET")
+}
+
+func TestValidate_UnknownStorageBackend(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:           "postgres://localhost/test",
+		APIPort:               8080,
+		SMTPPort:              2525,
+		AttachmentStoragePath: "./attachments",
+		StorageBackend:        "ftp",
+	}
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "STORAGE_BACKEND")
+}
+
+func TestLoad_EncryptionConfig(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("ENCRYPTION_KEY_FILE", "/run/secrets/keys")
+	os.Setenv("ENCRYPT_MESSAGE_BODIES", "true")
+	os.Setenv("SEARCH_ENCRYPTED_BODIES", "true")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("ENCRYPTION_KEY_FILE")
+		os.Unsetenv("ENCRYPT_MESSAGE_BODIES")
+		os.Unsetenv("SEARCH_ENCRYPTED_BODIES")
+	}()
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+
+	assert.Equal(t, "/run/secrets/keys", cfg.EncryptionKeyFile)
+	assert.True(t, cfg.EncryptMessageBodies)
+	assert.True(t, cfg.SearchEncryptedBodies)
+	assert.True(t, cfg.EncryptionEnabled())
+}
+
+func TestValidate_EncryptBodiesRequiresKey(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:           "postgres://localhost/test",
+		APIPort:               8080,
+		SMTPPort:              2525,
+		AttachmentStoragePath: "./attachments",
+		EncryptMessageBodies:  true,
+	}
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ENCRYPT_MESSAGE_BODIES")
+
+	cfg.EncryptionKey = "a2V5"
+	cfg.EncryptionKeyFile = "/run/secrets/keys"
+	err = cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only one")
+}
+
+func TestLoad_ImageProxyConfig(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("IMAGE_PROXY_SECRET", "0123456789abcdef0123456789abcdef")
+	os.Setenv("PUBLIC_BASE_URL", "https://mail.example.com/")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("IMAGE_PROXY_SECRET")
+		os.Unsetenv("PUBLIC_BASE_URL")
+	}()
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", cfg.ImageProxySecret)
+	assert.Equal(t, "https://mail.example.com", cfg.PublicBaseURL)
+}
+
+func TestValidate_ImageProxyConfig(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:           "postgres://localhost/test",
+		APIPort:               8080,
+		SMTPPort:              2525,
+		AttachmentStoragePath: "./attachments",
+		ImageProxySecret:      "short",
+	}
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "IMAGE_PROXY_SECRET")
+
+	cfg.ImageProxySecret = ""
+	cfg.PublicBaseURL = "mail.example.com"
+	err = cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PUBLIC_BASE_URL")
+
+	cfg.PublicBaseURL = "https://mail.example.com"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoad_IMAPConfig(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("IMAP_PORT", "1143")
+	os.Setenv("IMAPS_PORT", "1993")
+	os.Setenv("MAIL_ACCESS_SECRET", "0123456789abcdef0123456789abcdef")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("IMAP_PORT")
+		os.Unsetenv("IMAPS_PORT")
+		os.Unsetenv("MAIL_ACCESS_SECRET")
+	}()
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1143, cfg.IMAPPort)
+	assert.Equal(t, 1993, cfg.IMAPSPort)
+	assert.True(t, cfg.IMAPEnabled())
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", cfg.MailAccessSecret)
+}
+
+func TestValidate_IMAPConfig(t *testing.T) {
+	cfg := &Config{
+		DatabaseURL:           "postgres://localhost/test",
+		APIPort:               8080,
+		SMTPPort:              2525,
+		AttachmentStoragePath: "./attachments",
+	}
+	assert.NoError(t, cfg.Validate())
+	assert.False(t, cfg.IMAPEnabled())
+
+	cfg.IMAPPort = 70000
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "IMAPPort")
+
+	cfg.IMAPPort = 143
+	cfg.MailAccessSecret = "short"
+	err = cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "MAIL_ACCESS_SECRET")
+}
+
+func TestLoad_POP3Config(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("POP3_PORT", "1110")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("POP3_PORT")
+	}()
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1110, cfg.POP3Port)
+	assert.Equal(t, 0, cfg.POP3SPort)
+	assert.True(t, cfg.POP3Enabled())
+	assert.False(t, cfg.IMAPEnabled())
+}
+
+func TestLoad_JMAPConfig(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("JMAP_ENABLED", "true")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("JMAP_ENABLED")
+	}()
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+	assert.True(t, cfg.JMAPEnabled)
+
+	os.Setenv("JMAP_ENABLED", "sometimes")
+	_, err = LoadWithValidation()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "JMAP_ENABLED")
+}
+
+func TestLoad_WSTicketSecret(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	os.Setenv("WS_TICKET_SECRET", "short")
+	defer func() {
+		os.Unsetenv("DATABASE_URL")
+		os.Unsetenv("WS_TICKET_SECRET")
+	}()
+
+	_, err := LoadWithValidation()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "WS_TICKET_SECRET")
+
+	os.Setenv("WS_TICKET_SECRET", "0123456789abcdef0123456789abcdef")
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", cfg.WSTicketSecret)
+}
+
+func TestLoad_EventBackend(t *testing.T) {
+	os.Setenv("DATABASE_URL", "postgres://localhost/test")
+	defer os.Unsetenv("DATABASE_URL")
+
+	cfg, err := LoadWithValidation()
+	require.NoError(t, err)
+	assert.Equal(t, "memory", cfg.EventBackend)
+
+	os.Setenv("EVENT_BACKEND", "Postgres")
+	defer os.Unsetenv("EVENT_BACKEND")
+	cfg, err = LoadWithValidation()
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", cfg.EventBackend)
+
+	os.Setenv("EVENT_BACKEND", "redis")
+	_, err = LoadWithValidation()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "EVENT_BACKEND")
+}
@@ -109,17 +109,44 @@ func ConnectWithConfig(databaseURL string, maxIdleConns, maxOpenConns int, connM
 func Migrate(db *gorm.DB) error {
 	slog.Info("Running database migrations...")
 
-	err := db.AutoMigrate(
+	tables := []interface{}{
+		&models.Tenant{},
+		&models.APIKey{},
 		&models.Domain{},
 		&models.DomainCertificate{},
 		&models.Mailbox{},
 		&models.Message{},
+		&models.MessageChange{},
+		&models.Folder{},
+		&models.Label{},
+		&models.MessageLabel{},
 		&models.Attachment{},
-	)
+		&models.DataKey{},
+		&models.EventPayload{},
+		&models.MailboxToken{},
+	}
+	// The full-text index is a tsvector with a GIN index, which only
+	// PostgreSQL has; other databases search with LIKE instead
+	if db.Dialector.Name() == "postgres" {
+		tables = append(tables, &models.MessageSearchIndex{})
+	}
+
+	err := db.AutoMigrate(tables...)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Messages stored before IMAP UIDs were assigned keep their ID as UID
+	err = db.Exec("UPDATE messages SET uid = id WHERE uid = 0").Error
+	if err == nil {
+		err = db.Exec("UPDATE mailboxes SET uid_next = " +
+			"(SELECT MAX(uid) + 1 FROM messages WHERE messages.mailbox_id = mailboxes.id) " +
+			"WHERE uid_next <= (SELECT MAX(uid) FROM messages WHERE messages.mailbox_id = mailboxes.id)").Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign message UIDs: %w", err)
+	}
+
 	slog.Info("Database migrations completed successfully")
 	return nil
 }
@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// columnPrefix marks an encrypted column value and its format version
+const columnPrefix = "enc:v1:"
+
+// IsEncryptedValue reports whether a stored column value was produced by EncryptString
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, columnPrefix)
+}
+
+// EncryptString encrypts a column value with a fresh data key.
+//
+// The result is "enc:v1:<master key id>:<wrapped data key>:<ciphertext>" with
+// base64 fields, so rotation can re-wrap the data key in place. aad should name
+// the column so a value cannot be copied into another column.
+func (k *Keyring) EncryptString(plaintext string, aad []byte) (string, error) {
+	dataKey, err := k.NewDataKey()
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := k.WrapKey(dataKey, aad)
+	if err != nil {
+		return "", err
+	}
+	return formatColumnValue(keyID, wrapped, ciphertext), nil
+}
+
+// DecryptString decrypts a value produced by EncryptString.
+// Values without the encryption prefix are returned unchanged, so columns can
+// hold a mix of rows written before and after encryption was enabled.
+func (k *Keyring) DecryptString(value string, aad []byte) (string, error) {
+	if !IsEncryptedValue(value) {
+		return value, nil
+	}
+	keyID, wrapped, ciphertext, err := parseColumnValue(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.UnwrapKey(keyID, wrapped, aad)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// RewrapString re-wraps the data key of an encrypted column value with the
+// primary master key, leaving the ciphertext untouched. Plaintext values and
+// values already wrapped by the primary key are returned with changed=false.
+func (k *Keyring) RewrapString(value string, aad []byte) (string, bool, error) {
+	if !IsEncryptedValue(value) {
+		return value, false, nil
+	}
+	keyID, wrapped, ciphertext, err := parseColumnValue(value)
+	if err != nil {
+		return "", false, err
+	}
+	newKeyID, newWrapped, changed, err := k.RewrapKey(keyID, wrapped, aad)
+	if err != nil || !changed {
+		return value, false, err
+	}
+	return formatColumnValue(newKeyID, newWrapped, ciphertext), true, nil
+}
+
+func formatColumnValue(keyID string, wrapped, ciphertext []byte) string {
+	return columnPrefix + keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func parseColumnValue(value string) (keyID string, wrapped, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, columnPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("%w: malformed encrypted value", ErrDecrypt)
+	}
+	if wrapped, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return "", nil, nil, fmt.Errorf("%w: malformed wrapped key", ErrDecrypt)
+	}
+	if ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("%w: malformed ciphertext", ErrDecrypt)
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestEncryptString_RoundTrip(t *testing.T) {
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	aad := ColumnAAD("messages", "body_text", 1)
+
+	value, err := keyring.EncryptString("account number 1234", aad)
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedValue(value))
+	assert.NotContains(t, value, "1234")
+
+	plaintext, err := keyring.DecryptString(value, aad)
+	require.NoError(t, err)
+	assert.Equal(t, "account number 1234", plaintext)
+
+	_, err = keyring.DecryptString(value, ColumnAAD("messages", "body_html", 1))
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = keyring.DecryptString(value, ColumnAAD("messages", "body_text", 2))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	plaintext, err = keyring.DecryptString("written before encryption", aad)
+	require.NoError(t, err)
+	assert.Equal(t, "written before encryption", plaintext)
+
+	_, err = keyring.DecryptString(columnPrefix+"garbage", aad)
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestRewrapString_KeepsCiphertext(t *testing.T) {
+	oldKeyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	value, err := oldKeyring.EncryptString("hello", nil)
+	require.NoError(t, err)
+
+	rotated, err := NewKeyring(testKey(2), testKey(1))
+	require.NoError(t, err)
+	rewrapped, changed, err := rotated.RewrapString(value, nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	oldParts := strings.Split(value, ":")
+	newParts := strings.Split(rewrapped, ":")
+	assert.Equal(t, oldParts[len(oldParts)-1], newParts[len(newParts)-1], "ciphertext must not change")
+	assert.Equal(t, rotated.PrimaryKeyID(), newParts[2])
+
+	plaintext, err := rotated.DecryptString(rewrapped, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", plaintext)
+
+	_, changed, err = rotated.RewrapString("plain", nil)
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
+
+type encryptedRow struct {
+	ID   uint
+	Body string `gorm:"serializer:encrypted"`
+}
+
+func TestColumnSerializer_NeedsRowID(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&encryptedRow{}))
+	t.Cleanup(func() { ConfigureColumns(nil, false) })
+
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	ConfigureColumns(keyring, true)
+
+	assert.ErrorIs(t, db.Create(&encryptedRow{Body: "secret"}).Error, ErrNoRowID)
+}
+
+func TestColumnSerializer(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&encryptedRow{}))
+	t.Cleanup(func() { ConfigureColumns(nil, false) })
+
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+
+	// Plaintext rows written before encryption was enabled
+	ConfigureColumns(nil, false)
+	require.NoError(t, db.Create(&encryptedRow{ID: 1, Body: "old row"}).Error)
+
+	ConfigureColumns(keyring, true)
+	require.NoError(t, db.Create(&encryptedRow{ID: 2, Body: "secret row"}).Error)
+
+	var stored []string
+	require.NoError(t, db.Table("encrypted_rows").Order("id").Pluck("body", &stored).Error)
+	assert.Equal(t, "old row", stored[0])
+	assert.True(t, IsEncryptedValue(stored[1]))
+
+	var rows []encryptedRow
+	require.NoError(t, db.Order("id").Find(&rows).Error)
+	assert.Equal(t, "old row", rows[0].Body)
+	assert.Equal(t, "secret row", rows[1].Body)
+
+	// Turning encryption off keeps existing rows readable
+	ConfigureColumns(keyring, false)
+	require.NoError(t, db.Create(&encryptedRow{ID: 3, Body: "new plain row"}).Error)
+	rows = nil
+	require.NoError(t, db.Order("id").Find(&rows).Error)
+	assert.Equal(t, "secret row", rows[1].Body)
+	assert.Equal(t, "new plain row", rows[2].Body)
+
+	// An encrypted value copied to another row does not decrypt there
+	require.NoError(t, db.Exec("UPDATE encrypted_rows SET body = ? WHERE id = 3", stored[1]).Error)
+	assert.ErrorIs(t, db.Order("id").Find(&rows).Error, ErrDecrypt)
+
+	// Encrypted rows cannot be read without the key
+	ConfigureColumns(nil, false)
+	assert.ErrorIs(t, db.Order("id").Find(&rows).Error, ErrNoColumnKeyring)
+}
@@ -0,0 +1,191 @@
+// Package encryption implements envelope encryption for data at rest.
+//
+// Every stored file or column value is encrypted with its own random data key
+// (AES-256-GCM). Data keys are wrapped by a master key from the Keyring and the
+// wrapped key is stored next to the data, so rotating the master key only
+// re-wraps data keys and never rewrites the encrypted payload.
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// KeySize is the size in bytes of master and data keys (AES-256)
+const KeySize = 32
+
+// Encryption errors
+var (
+	ErrInvalidKey = errors.New("encryption key must be 32 bytes")
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrNoKeys     = errors.New("keyring has no master keys")
+	ErrDecrypt    = errors.New("failed to decrypt data")
+)
+
+// Keyring holds the master keys used to wrap data keys.
+// The primary key wraps new data keys; older keys are kept to unwrap existing ones.
+type Keyring struct {
+	primaryID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from raw master keys. The first key is the primary.
+func NewKeyring(masterKeys ...[]byte) (*Keyring, error) {
+	if len(masterKeys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(masterKeys))}
+	for i, masterKey := range masterKeys {
+		aead, err := newAEAD(masterKey)
+		if err != nil {
+			return nil, err
+		}
+		id := KeyID(masterKey)
+		if i == 0 {
+			k.primaryID = id
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// ParseKeyring parses base64-encoded master keys, one per line.
+// Blank lines and lines starting with # are ignored; the first key is the primary.
+func ParseKeyring(r io.Reader) (*Keyring, error) {
+	var masterKeys [][]byte
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		masterKey, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 master key on line %d: %w", len(masterKeys)+1, err)
+		}
+		masterKeys = append(masterKeys, masterKey)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	return NewKeyring(masterKeys...)
+}
+
+// LoadKeyring builds a keyring from a base64 master key or a key file.
+// It returns nil without error when neither is set, meaning encryption is disabled.
+func LoadKeyring(encodedKey, keyFile string) (*Keyring, error) {
+	switch {
+	case keyFile != "":
+		f, err := os.Open(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open key file: %w", err)
+		}
+		defer f.Close()
+		return ParseKeyring(f)
+	case encodedKey != "":
+		return ParseKeyring(strings.NewReader(encodedKey))
+	default:
+		return nil, nil
+	}
+}
+
+// KeyID returns a short, stable identifier for a master key that does not reveal it
+func KeyID(masterKey []byte) string {
+	sum := sha256.Sum256(masterKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PrimaryKeyID returns the identifier of the key used to wrap new data keys
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primaryID
+}
+
+// NewDataKey generates a random data key
+func (k *Keyring) NewDataKey() ([]byte, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// WrapKey encrypts a data key with the primary master key.
+// aad binds the wrapped key to its owner (e.g. a file path) so it cannot be swapped.
+func (k *Keyring) WrapKey(dataKey, aad []byte) (keyID string, wrapped []byte, err error) {
+	wrapped, err = seal(k.keys[k.primaryID], dataKey, aad)
+	if err != nil {
+		return "", nil, err
+	}
+	return k.primaryID, wrapped, nil
+}
+
+// UnwrapKey decrypts a data key wrapped by the master key keyID
+func (k *Keyring) UnwrapKey(keyID string, wrapped, aad []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(aead, wrapped, aad)
+}
+
+// RewrapKey re-wraps a data key with the primary master key.
+// changed is false when the key is already wrapped by the primary key.
+func (k *Keyring) RewrapKey(keyID string, wrapped, aad []byte) (newKeyID string, newWrapped []byte, changed bool, err error) {
+	if keyID == k.primaryID {
+		return keyID, wrapped, false, nil
+	}
+	dataKey, err := k.UnwrapKey(keyID, wrapped, aad)
+	if err != nil {
+		return "", nil, false, err
+	}
+	newKeyID, newWrapped, err = k.WrapKey(dataKey, aad)
+	if err != nil {
+		return "", nil, false, err
+	}
+	return newKeyID, newWrapped, true, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher for key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, returning nonce||ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts nonce||ciphertext produced by seal
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
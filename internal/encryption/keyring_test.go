@@ -0,0 +1,110 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestNewKeyring_RejectsInvalidKeys(t *testing.T) {
+	_, err := NewKeyring()
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	_, err = NewKeyring([]byte("too short"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestParseKeyring_FirstKeyIsPrimary(t *testing.T) {
+	text := "# rotated 2026-10\n" +
+		base64.StdEncoding.EncodeToString(testKey(2)) + "\n\n" +
+		base64.StdEncoding.EncodeToString(testKey(1)) + "\n"
+
+	keyring, err := ParseKeyring(strings.NewReader(text))
+	require.NoError(t, err)
+
+	assert.Equal(t, KeyID(testKey(2)), keyring.PrimaryKeyID())
+	assert.Len(t, keyring.keys, 2)
+}
+
+func TestParseKeyring_InvalidBase64(t *testing.T) {
+	_, err := ParseKeyring(strings.NewReader("not base64!"))
+	assert.Error(t, err)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	keyring, err := LoadKeyring("", "")
+	require.NoError(t, err)
+	assert.Nil(t, keyring, "no key means encryption is disabled")
+
+	keyring, err = LoadKeyring(base64.StdEncoding.EncodeToString(testKey(1)), "")
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(testKey(1)), keyring.PrimaryKeyID())
+
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(testKey(3))+"\n"), 0600))
+	keyring, err = LoadKeyring("", keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(testKey(3)), keyring.PrimaryKeyID())
+
+	_, err = LoadKeyring("", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestKeyring_WrapUnwrap(t *testing.T) {
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+
+	dataKey, err := keyring.NewDataKey()
+	require.NoError(t, err)
+	keyID, wrapped, err := keyring.WrapKey(dataKey, []byte("blobs/ab/abc"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := keyring.UnwrapKey(keyID, wrapped, []byte("blobs/ab/abc"))
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, err = keyring.UnwrapKey(keyID, wrapped, []byte("blobs/cd/other"))
+	assert.ErrorIs(t, err, ErrDecrypt, "wrapped key must be bound to its owner")
+
+	_, err = keyring.UnwrapKey("0000000000000000", wrapped, []byte("blobs/ab/abc"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyring_RewrapKey(t *testing.T) {
+	oldKeyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	dataKey, err := oldKeyring.NewDataKey()
+	require.NoError(t, err)
+	oldID, wrapped, err := oldKeyring.WrapKey(dataKey, nil)
+	require.NoError(t, err)
+
+	rotated, err := NewKeyring(testKey(2), testKey(1))
+	require.NoError(t, err)
+
+	newID, newWrapped, changed, err := rotated.RewrapKey(oldID, wrapped, nil)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, rotated.PrimaryKeyID(), newID)
+
+	// The old master key is no longer needed
+	newOnly, err := NewKeyring(testKey(2))
+	require.NoError(t, err)
+	unwrapped, err := newOnly.UnwrapKey(newID, newWrapped, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, _, changed, err = rotated.RewrapKey(newID, newWrapped, nil)
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,135 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+// SerializerName is the GORM serializer for encrypted string columns.
+// Use it with the struct tag `gorm:"serializer:encrypted"`.
+const SerializerName = "encrypted"
+
+// ErrNoColumnKeyring is returned when an encrypted column is read without a configured keyring
+var ErrNoColumnKeyring = errors.New("encrypted column value found but no encryption key is configured")
+
+// ErrNoRowID is returned when an encrypted column is written or read without
+// the primary key of its row, which is part of the associated data
+var ErrNoRowID = errors.New("encrypted column needs the primary key of its row")
+
+// columnConfig is the process-wide configuration used by the column serializer
+type columnConfig struct {
+	keyring *Keyring
+	encrypt bool
+}
+
+var columns atomic.Pointer[columnConfig]
+
+func init() {
+	schema.RegisterSerializer(SerializerName, columnSerializer{})
+}
+
+// ConfigureColumns sets the keyring used by encrypted columns.
+// Values are always decrypted when a keyring is set; new values are only
+// encrypted when encryptWrites is true, so encryption can be turned off
+// without losing access to rows written while it was on.
+func ConfigureColumns(keyring *Keyring, encryptWrites bool) {
+	columns.Store(&columnConfig{keyring: keyring, encrypt: encryptWrites && keyring != nil})
+}
+
+// ColumnsEncrypted reports whether new values of encrypted columns are encrypted
+func ColumnsEncrypted() bool {
+	_, encrypt := columnKeyring()
+	return encrypt
+}
+
+// columnKeyring returns the configured column keyring and whether writes are encrypted
+func columnKeyring() (*Keyring, bool) {
+	cfg := columns.Load()
+	if cfg == nil {
+		return nil, false
+	}
+	return cfg.keyring, cfg.encrypt
+}
+
+// ColumnAAD returns the associated data that binds an encrypted value to its
+// table, column and row, so a value copied to another row fails to decrypt
+func ColumnAAD(table, column string, id uint64) []byte {
+	return []byte(table + "." + column + ":" + strconv.FormatUint(id, 10))
+}
+
+// columnAAD returns the associated data of a field of the row dst
+func columnAAD(ctx context.Context, field *schema.Field, dst reflect.Value) ([]byte, error) {
+	pk := field.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, ErrNoRowID
+	}
+	id, zero := pk.ValueOf(ctx, dst)
+	if zero {
+		return nil, ErrNoRowID
+	}
+	rowID, err := strconv.ParseUint(fmt.Sprint(id), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported primary key %v for encrypted column %s", id, field.DBName)
+	}
+	return ColumnAAD(field.Schema.Table, field.DBName, rowID), nil
+}
+
+// columnSerializer encrypts and decrypts string fields tagged with the encrypted serializer
+type columnSerializer struct{}
+
+// Scan decrypts the database value into the string field
+func (columnSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for encrypted column %s", dbValue, field.DBName)
+	}
+
+	if IsEncryptedValue(value) {
+		keyring, _ := columnKeyring()
+		if keyring == nil {
+			return ErrNoColumnKeyring
+		}
+		aad, err := columnAAD(ctx, field, dst)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt column %s: %w", field.DBName, err)
+		}
+		plaintext, err := keyring.DecryptString(value, aad)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt column %s: %w", field.DBName, err)
+		}
+		value = plaintext
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(value)
+	return nil
+}
+
+// Value encrypts the string field when column encryption is enabled
+func (columnSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T for encrypted column %s", fieldValue, field.DBName)
+	}
+
+	keyring, encrypt := columnKeyring()
+	if !encrypt || value == "" {
+		return value, nil
+	}
+	aad, err := columnAAD(ctx, field, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt column %s: %w", field.DBName, err)
+	}
+	return keyring.EncryptString(value, aad)
+}
@@ -0,0 +1,179 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// streamMagic prefixes every encrypted stream and identifies its format version
+var streamMagic = []byte("IME1")
+
+// segmentSize is the plaintext size of each encrypted segment.
+// Streams are split into segments so large files never need to be held in memory.
+const segmentSize = 64 * 1024
+
+// NewEncryptReader returns a reader producing the encryption of src under dataKey.
+//
+// The stream is a header followed by AES-GCM sealed segments. Each segment nonce
+// carries its index and a final-segment flag, so reordering, truncation and
+// appended data are all detected on decryption. Nonces are never reused because
+// every stream has its own data key.
+func NewEncryptReader(dataKey []byte, src io.Reader) (io.Reader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		segmentReader: segmentReader{aead: aead, src: src},
+		buf:           make([]byte, segmentSize+1),
+		sealed:        make([]byte, 0, len(streamMagic)+segmentSize+aead.Overhead()),
+	}, nil
+}
+
+// NewDecryptReader returns a reader producing the plaintext of a stream created by NewEncryptReader.
+// Read returns ErrDecrypt if the stream was modified or was encrypted with another key.
+func NewDecryptReader(dataKey []byte, src io.Reader) (io.Reader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		segmentReader: segmentReader{aead: aead, src: src},
+		buf:           make([]byte, segmentSize+aead.Overhead()+1),
+	}, nil
+}
+
+// segmentReader holds the state shared by the encrypting and decrypting readers
+type segmentReader struct {
+	aead    cipher.AEAD
+	src     io.Reader
+	out     []byte // processed bytes not yet returned to the caller
+	pending int    // look-ahead bytes carried over at the start of buf
+	index   uint64 // index of the next segment
+	done    bool   // the final segment has been processed
+	err     error
+}
+
+// nonce builds the nonce for the current segment
+func (s *segmentReader) nonce(final bool) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], s.index)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	s.index++
+	return nonce
+}
+
+// read drains out, calling fill to process the next segment when it is empty
+func (s *segmentReader) read(p []byte, fill func() error) (int, error) {
+	for len(s.out) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = fill()
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// next reads the next segment into buf. It reports whether the segment is the
+// final one by reading one byte ahead, which is kept for the following segment.
+func (s *segmentReader) next(buf []byte) (segment []byte, final bool, err error) {
+	n, err := io.ReadFull(s.src, buf[s.pending:])
+	n += s.pending
+	s.pending = 0
+
+	switch {
+	case err == nil:
+		return buf[:len(buf)-1], false, nil
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return buf[:n], true, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// carry moves the look-ahead byte to the start of buf after a non-final segment
+func (s *segmentReader) carry(buf []byte) {
+	buf[0] = buf[len(buf)-1]
+	s.pending = 1
+}
+
+// encryptReader implements the encrypting side of the segmented stream
+type encryptReader struct {
+	segmentReader
+	buf     []byte
+	sealed  []byte
+	started bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	return r.read(p, r.fill)
+}
+
+func (r *encryptReader) fill() error {
+	segment, final, err := r.next(r.buf)
+	if err != nil {
+		return err
+	}
+	dst := r.sealed[:0]
+	if !r.started {
+		dst = append(dst, streamMagic...)
+		r.started = true
+	}
+	r.sealed = r.aead.Seal(dst, r.nonce(final), segment, nil)
+	r.out = r.sealed
+	if final {
+		r.done = true
+	} else {
+		r.carry(r.buf)
+	}
+	return nil
+}
+
+// decryptReader implements the decrypting side of the segmented stream
+type decryptReader struct {
+	segmentReader
+	buf       []byte
+	plaintext []byte
+	started   bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	return r.read(p, r.fill)
+}
+
+func (r *decryptReader) fill() error {
+	if !r.started {
+		header := make([]byte, len(streamMagic))
+		if _, err := io.ReadFull(r.src, header); err != nil || !bytes.Equal(header, streamMagic) {
+			return ErrDecrypt
+		}
+		r.started = true
+	}
+
+	segment, final, err := r.next(r.buf)
+	if err != nil {
+		return err
+	}
+	plaintext, err := r.aead.Open(r.plaintext[:0], r.nonce(final), segment, nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	r.plaintext = plaintext
+	r.out = plaintext
+	if final {
+		r.done = true
+	} else {
+		r.carry(r.buf)
+	}
+	return nil
+}
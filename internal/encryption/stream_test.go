@@ -0,0 +1,72 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptBytes(t *testing.T, dataKey, plaintext []byte) []byte {
+	t.Helper()
+	reader, err := NewEncryptReader(dataKey, bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return ciphertext
+}
+
+func decryptBytes(dataKey, ciphertext []byte) ([]byte, error) {
+	reader, err := NewDecryptReader(dataKey, bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestStream_RoundTrip(t *testing.T) {
+	dataKey := testKey(7)
+	sizes := []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 123}
+
+	for _, size := range sizes {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		ciphertext := encryptBytes(t, dataKey, plaintext)
+		if size > 16 {
+			assert.False(t, bytes.Contains(ciphertext, plaintext[:16]), "size %d: plaintext leaked", size)
+		}
+
+		decrypted, err := decryptBytes(dataKey, ciphertext)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, plaintext, decrypted, "size %d", size)
+	}
+}
+
+func TestStream_DetectsTampering(t *testing.T) {
+	dataKey := testKey(7)
+	plaintext := bytes.Repeat([]byte("mail"), segmentSize)
+	ciphertext := encryptBytes(t, dataKey, plaintext)
+	segment := segmentSize + 16
+	flipped := append([]byte{}, ciphertext...)
+	flipped[100] ^= 1
+
+	cases := map[string][]byte{
+		"flipped bit":       flipped,
+		"truncated segment": ciphertext[:len(streamMagic)+segment],
+		"appended data":     append(append([]byte{}, ciphertext...), 0),
+		"missing header":    ciphertext[len(streamMagic):],
+	}
+
+	for name, tampered := range cases {
+		_, err := decryptBytes(dataKey, tampered)
+		assert.ErrorIs(t, err, ErrDecrypt, name)
+	}
+
+	_, err := decryptBytes(testKey(8), ciphertext)
+	assert.ErrorIs(t, err, ErrDecrypt, "wrong key")
+}
@@ -0,0 +1,234 @@
+// Package imageproxy fetches remote email images on behalf of clients, so
+// opening a message does not reveal the reader's IP address to the sender.
+package imageproxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Path is the route that serves proxied images
+const Path = "/proxy/image"
+
+// AttachmentPath is the route that serves inline attachments of rendered messages
+const AttachmentPath = "/proxy/attachments"
+
+// AttachmentURLTTL is how long signed inline attachment URLs stay valid
+const AttachmentURLTTL = 15 * time.Minute
+
+const (
+	// DefaultMaxBytes is the largest image the proxy will relay
+	DefaultMaxBytes = 10 * 1024 * 1024
+	// DefaultTimeout bounds the whole remote fetch
+	DefaultTimeout = 10 * time.Second
+	maxRedirects   = 3
+)
+
+// Proxy errors
+var (
+	ErrForbiddenAddress = errors.New("remote address is not publicly routable")
+	ErrInvalidURL       = errors.New("only http and https image URLs can be proxied")
+	ErrNotImage         = errors.New("remote content is not an image")
+	ErrTooLarge         = errors.New("remote image exceeds size limit")
+	ErrUpstream         = errors.New("remote server returned an error")
+)
+
+// Config configures a Proxy
+type Config struct {
+	// Secret signs proxy URLs so the endpoint cannot be used as an open proxy
+	Secret []byte
+	// BaseURL is prepended to Path in generated URLs; empty produces relative URLs
+	BaseURL  string
+	MaxBytes int64
+	Timeout  time.Duration
+	// AllowPrivateNetworks disables the guard against fetching internal addresses.
+	// Only for tests and local development.
+	AllowPrivateNetworks bool
+}
+
+// Image is a fetched remote image
+type Image struct {
+	ContentType string
+	Data        []byte
+}
+
+// Proxy signs image URLs and fetches them safely
+type Proxy struct {
+	secret   []byte
+	baseURL  string
+	maxBytes int64
+	client   *http.Client
+}
+
+// New creates a Proxy
+func New(config Config) (*Proxy, error) {
+	if len(config.Secret) == 0 {
+		return nil, errors.New("image proxy secret is required")
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultMaxBytes
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivateNetworks {
+		// Checked on the resolved address of every connection, including redirects
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		}
+	}
+
+	client := &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: config.Timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrInvalidURL
+			}
+			return nil
+		},
+	}
+
+	return &Proxy{
+		secret:   config.Secret,
+		baseURL:  strings.TrimSuffix(config.BaseURL, "/"),
+		maxBytes: config.MaxBytes,
+		client:   client,
+	}, nil
+}
+
+// URL returns the signed proxy URL serving remoteURL
+func (p *Proxy) URL(remoteURL string) string {
+	query := url.Values{"url": {remoteURL}, "sig": {p.sign(remoteURL)}}
+	return p.baseURL + Path + "?" + query.Encode()
+}
+
+// Origin returns the scheme and host proxy URLs point at, or "" when they are relative
+func (p *Proxy) Origin() string {
+	u, err := url.Parse(p.baseURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Verify reports whether sig is the signature of remoteURL
+func (p *Proxy) Verify(remoteURL, sig string) bool {
+	return hmac.Equal([]byte(sig), []byte(p.sign(remoteURL)))
+}
+
+// AttachmentURL returns a signed URL serving an inline attachment until expires
+func (p *Proxy) AttachmentURL(id uint, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{"exp": {exp}, "sig": {p.sign(attachmentPayload(id, exp))}}
+	return fmt.Sprintf("%s%s/%d?%s", p.baseURL, AttachmentPath, id, query.Encode())
+}
+
+// VerifyAttachment reports whether sig signs attachment id until exp and exp has not passed
+func (p *Proxy) VerifyAttachment(id uint, exp, sig string, now time.Time) bool {
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(p.sign(attachmentPayload(id, exp))))
+}
+
+// attachmentPayload is what attachment URLs sign. It cannot be mistaken for a
+// remote image URL, which always has an http or https scheme.
+func attachmentPayload(id uint, exp string) string {
+	return fmt.Sprintf("attachment:%d:%s", id, exp)
+}
+
+func (p *Proxy) sign(remoteURL string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(remoteURL))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fetch downloads a remote image without cookies or referrer.
+// The content type is sniffed from the data, so only real raster images are returned.
+func (p *Proxy) Fetch(ctx context.Context, remoteURL string) (*Image, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "Infinimail-ImageProxy/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenAddress) {
+			return nil, ErrForbiddenAddress
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrUpstream, resp.StatusCode)
+	}
+	if resp.ContentLength > p.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	if int64(len(data)) > p.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	// DetectContentType never reports SVG, which could carry scripts
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, ErrNotImage
+	}
+
+	return &Image{ContentType: contentType, Data: data}, nil
+}
+
+// carrierGradeNAT is the shared address space of RFC 6598, not covered by net.IP.IsPrivate
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || carrierGradeNAT.Contains(ip))
+}
@@ -0,0 +1,161 @@
+package imageproxy
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	return buf.Bytes()
+}
+
+func newTestProxy(t *testing.T, config Config) *Proxy {
+	t.Helper()
+	if config.Secret == nil {
+		config.Secret = []byte("test-secret")
+	}
+	proxy, err := New(config)
+	require.NoError(t, err)
+	return proxy
+}
+
+func TestNew_RequiresSecret(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+}
+
+func TestURL_SignsRemoteURL(t *testing.T) {
+	proxy := newTestProxy(t, Config{BaseURL: "https://mail.example.com/"})
+
+	proxied := proxy.URL("https://cdn.example.com/logo.png?a=1&b=2")
+
+	u, err := url.Parse(proxied)
+	require.NoError(t, err)
+	assert.Equal(t, "mail.example.com", u.Host)
+	assert.Equal(t, Path, u.Path)
+	assert.Equal(t, "https://cdn.example.com/logo.png?a=1&b=2", u.Query().Get("url"))
+	assert.True(t, proxy.Verify(u.Query().Get("url"), u.Query().Get("sig")))
+	assert.False(t, proxy.Verify("https://cdn.example.com/other.png", u.Query().Get("sig")))
+
+	other := newTestProxy(t, Config{Secret: []byte("other-secret")})
+	assert.False(t, other.Verify(u.Query().Get("url"), u.Query().Get("sig")))
+}
+
+func TestAttachmentURL_SignsIDAndExpiry(t *testing.T) {
+	proxy := newTestProxy(t, Config{BaseURL: "https://mail.example.com"})
+	now := time.Unix(1700000000, 0)
+
+	u, err := url.Parse(proxy.AttachmentURL(7, now.Add(AttachmentURLTTL)))
+	require.NoError(t, err)
+	assert.Equal(t, AttachmentPath+"/7", u.Path)
+	exp, sig := u.Query().Get("exp"), u.Query().Get("sig")
+	assert.True(t, proxy.VerifyAttachment(7, exp, sig, now))
+	assert.False(t, proxy.VerifyAttachment(8, exp, sig, now), "other attachment")
+	assert.False(t, proxy.VerifyAttachment(7, exp, sig, now.Add(AttachmentURLTTL+time.Second)), "expired")
+	assert.False(t, proxy.VerifyAttachment(7, "9999999999", sig, now), "extended expiry")
+}
+
+func TestOrigin(t *testing.T) {
+	assert.Equal(t, "https://mail.example.com", newTestProxy(t, Config{BaseURL: "https://mail.example.com/app"}).Origin())
+	assert.Equal(t, "", newTestProxy(t, Config{}).Origin())
+	assert.True(t, strings.HasPrefix(newTestProxy(t, Config{}).URL("https://x.example/a.png"), Path+"?"))
+}
+
+func TestFetch_ReturnsImage(t *testing.T) {
+	data := pngBytes(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Referer"))
+		assert.Empty(t, r.Header.Get("Cookie"))
+		// A wrong declared type must not matter; the data is sniffed
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	proxy := newTestProxy(t, Config{AllowPrivateNetworks: true})
+	img, err := proxy.Fetch(context.Background(), server.URL+"/logo.png")
+
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+	assert.Equal(t, data, img.Data)
+}
+
+func TestFetch_RejectsNonImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+	}))
+	defer server.Close()
+
+	proxy := newTestProxy(t, Config{AllowPrivateNetworks: true})
+	_, err := proxy.Fetch(context.Background(), server.URL)
+
+	assert.ErrorIs(t, err, ErrNotImage)
+}
+
+func TestFetch_EnforcesSizeLimit(t *testing.T) {
+	data := pngBytes(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	proxy := newTestProxy(t, Config{AllowPrivateNetworks: true, MaxBytes: int64(len(data) - 1)})
+	_, err := proxy.Fetch(context.Background(), server.URL)
+
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestFetch_UpstreamError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	proxy := newTestProxy(t, Config{AllowPrivateNetworks: true})
+	_, err := proxy.Fetch(context.Background(), server.URL)
+
+	assert.ErrorIs(t, err, ErrUpstream)
+}
+
+func TestFetch_RejectsInvalidURLs(t *testing.T) {
+	proxy := newTestProxy(t, Config{})
+	for _, remote := range []string{"file:///etc/passwd", "ftp://example.com/a.png", "/relative.png", "https://"} {
+		_, err := proxy.Fetch(context.Background(), remote)
+		assert.ErrorIs(t, err, ErrInvalidURL, remote)
+	}
+}
+
+func TestFetch_BlocksPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("private address must not be contacted")
+	}))
+	defer server.Close()
+
+	proxy := newTestProxy(t, Config{})
+	_, err := proxy.Fetch(context.Background(), server.URL)
+
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "::1", "fe80::1", "fc00::1", "0.0.0.0"} {
+		assert.False(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		assert.True(t, isPublicIP(net.ParseIP(ip)), ip)
+	}
+}
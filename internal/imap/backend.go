@@ -0,0 +1,212 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// updateTimeout bounds how long a change waits for connections to receive its updates
+const updateTimeout = 5 * time.Second
+
+// errTemporary is returned to clients instead of internal errors, which are logged
+var errTemporary = errors.New("internal server error, try again later")
+
+// Backend implements the go-imap Backend interface on top of the repositories.
+// Every models.Mailbox is an account named by its address and its folders are the
+// IMAP mailboxes. Message IDs serve as UIDs and folder IDs as UIDVALIDITY.
+type Backend struct {
+	mailboxRepo repository.MailboxRepository
+	messageRepo repository.MessageRepository
+	folderRepo  repository.FolderRepository
+	fileStorage storage.FileStorage
+	deliverer   services.MessageDeliverer
+	auth        *mailauth.Authenticator
+	logger      *slog.Logger
+
+	updates chan backend.Update
+
+	// Folder views shared by the sessions that opened them, by folder ID
+	mu    sync.Mutex
+	views map[uint]*folderView
+}
+
+// BackendConfig holds configuration for the IMAP backend
+type BackendConfig struct {
+	MailboxRepo repository.MailboxRepository
+	MessageRepo repository.MessageRepository
+	FolderRepo  repository.FolderRepository
+	FileStorage storage.FileStorage
+	// Deliverer stores messages added with APPEND; APPEND is refused when nil
+	Deliverer services.MessageDeliverer
+	Auth      *mailauth.Authenticator
+	Logger    *slog.Logger
+}
+
+// NewBackend creates a new IMAP backend
+func NewBackend(cfg *BackendConfig) *Backend {
+	return &Backend{
+		mailboxRepo: cfg.MailboxRepo,
+		messageRepo: cfg.MessageRepo,
+		folderRepo:  cfg.FolderRepo,
+		fileStorage: cfg.FileStorage,
+		deliverer:   cfg.Deliverer,
+		auth:        cfg.Auth,
+		logger:      cfg.Logger,
+		updates:     make(chan backend.Update, 64),
+		views:       make(map[uint]*folderView),
+	}
+}
+
+// Login authenticates a mail client. The username is the mailbox address and the
+// password is the mailbox password issued by mailauth or the master token.
+func (b *Backend) Login(connInfo *imap.ConnInfo, username, password string) (backend.User, error) {
+	ctx := context.Background()
+	address := strings.ToLower(strings.TrimSpace(username))
+
+	if b.auth == nil || !b.auth.Verify(address, password) {
+		b.logLoginFailure(connInfo, address)
+		return nil, backend.ErrInvalidCredentials
+	}
+
+	mailbox, err := b.mailboxRepo.GetByAddress(ctx, address)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			b.logLoginFailure(connInfo, address)
+			return nil, backend.ErrInvalidCredentials
+		}
+		return nil, b.internalError("failed to get mailbox", err)
+	}
+
+	if err := b.mailboxRepo.UpdateLastAccessed(ctx, mailbox.ID); err != nil && b.logger != nil {
+		b.logger.Warn("failed to update mailbox last access", slog.Any("error", err))
+	}
+	if b.logger != nil {
+		b.logger.Info("IMAP login", slog.String("mailbox", mailbox.FullAddress), slog.String("remote_addr", remoteAddr(connInfo)))
+	}
+
+	return &User{backend: b, mailbox: mailbox, views: make(map[uint]*folderView)}, nil
+}
+
+// Updates returns the channel the server reads EXISTS, EXPUNGE and FETCH updates from
+func (b *Backend) Updates() <-chan backend.Update {
+	return b.updates
+}
+
+// Watch checks the open folders for changes made outside IMAP, such as new mail
+// from SMTP or deletions in the web UI, every interval until ctx is done. Idling
+// clients learn about the changes through the resulting updates.
+func (b *Backend) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			views := make([]*folderView, 0, len(b.views))
+			for _, view := range b.views {
+				views = append(views, view)
+			}
+			b.mu.Unlock()
+
+			for _, view := range views {
+				if _, err := view.sync(ctx, true); err != nil && b.logger != nil && ctx.Err() == nil {
+					b.logger.Warn("failed to check IMAP folder",
+						slog.Uint64("folder_id", uint64(view.folderID)),
+						slog.Any("error", err))
+				}
+			}
+		}
+	}
+}
+
+// acquireView returns the shared view of a folder, creating it on first use
+func (b *Backend) acquireView(username string, folder *models.Folder) *folderView {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	view, ok := b.views[folder.ID]
+	if !ok {
+		view = &folderView{
+			backend:   b,
+			username:  username,
+			name:      folderName(folder),
+			mailboxID: folder.MailboxID,
+			folderID:  folder.ID,
+		}
+		b.views[folder.ID] = view
+	}
+	view.refs++
+	return view
+}
+
+// releaseView drops a reference to a view; unused views stop being watched
+func (b *Backend) releaseView(view *folderView) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	view.refs--
+	if view.refs <= 0 {
+		delete(b.views, view.folderID)
+	}
+}
+
+// watchedView returns the view of a folder if a session has it open
+func (b *Backend) watchedView(folderID uint) *folderView {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.views[folderID]
+}
+
+// sendUpdate hands an update to the server and waits until the connections got it,
+// so updates reach clients before the response of the command that caused them
+func (b *Backend) sendUpdate(update backend.Update) {
+	done := update.Done()
+	timeout := time.NewTimer(updateTimeout)
+	defer timeout.Stop()
+
+	select {
+	case b.updates <- update:
+	case <-timeout.C:
+		return
+	}
+	select {
+	case <-done:
+	case <-timeout.C:
+	}
+}
+
+// internalError logs err and returns the error shown to clients
+func (b *Backend) internalError(msg string, err error) error {
+	if b.logger != nil {
+		b.logger.Error(msg, slog.Any("error", err))
+	}
+	return errTemporary
+}
+
+func (b *Backend) logLoginFailure(connInfo *imap.ConnInfo, address string) {
+	if b.logger != nil {
+		b.logger.Warn("IMAP login failed", slog.String("username", address), slog.String("remote_addr", remoteAddr(connInfo)))
+	}
+}
+
+func remoteAddr(connInfo *imap.ConnInfo) string {
+	if connInfo == nil || connInfo.RemoteAddr == nil {
+		return ""
+	}
+	return connInfo.RemoteAddr.String()
+}
@@ -0,0 +1,545 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/smtp"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const masterToken = "master-token"
+
+// imapFixture serves an IMAP backend over an in-memory database and temp storage
+type imapFixture struct {
+	db          *gorm.DB
+	fileStorage storage.FileStorage
+	messageRepo repository.MessageRepository
+	folderRepo  repository.FolderRepository
+	auth        *mailauth.Authenticator
+	mailbox     *models.Mailbox
+	addr        string
+}
+
+func newIMAPFixture(t *testing.T) *imapFixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// Every connection of an in-memory database is a separate database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db.Exec("PRAGMA foreign_keys = ON")
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	fileStorage, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	domain := &models.Domain{Name: "imap.test", IsActive: true}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("failed to create domain: %v", err)
+	}
+	mailbox := &models.Mailbox{LocalPart: "qa", DomainID: domain.ID, FullAddress: "qa@imap.test"}
+	if err := db.Create(mailbox).Error; err != nil {
+		t.Fatalf("failed to create mailbox: %v", err)
+	}
+
+	auth, err := mailauth.New(bytes.Repeat([]byte{1}, mailauth.MinSecretLength), masterToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	mailboxRepo := repository.NewMailboxRepository(db)
+	messageRepo := repository.NewMessageRepositoryWithStorage(db, fileStorage)
+	folderRepo := repository.NewFolderRepository(db)
+	deliverer := smtp.NewBackend(&smtp.BackendConfig{
+		MailboxRepo:    mailboxRepo,
+		MessageRepo:    messageRepo,
+		AttachmentRepo: repository.NewAttachmentRepository(db, fileStorage),
+		FileStorage:    fileStorage,
+		Logger:         logger,
+	})
+	backend := NewBackend(&BackendConfig{
+		MailboxRepo: mailboxRepo,
+		MessageRepo: messageRepo,
+		FolderRepo:  folderRepo,
+		FileStorage: fileStorage,
+		Deliverer:   deliverer,
+		Auth:        auth,
+		Logger:      logger,
+	})
+	server := NewServer(backend, &ServerConfig{AllowInsecure: true, PollInterval: 50 * time.Millisecond})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return &imapFixture{
+		db:          db,
+		fileStorage: fileStorage,
+		messageRepo: messageRepo,
+		folderRepo:  folderRepo,
+		auth:        auth,
+		mailbox:     mailbox,
+		addr:        listener.Addr().String(),
+	}
+}
+
+// createMessage stores a message with its raw source in the Inbox
+func (f *imapFixture) createMessage(t *testing.T, subject string) *models.Message {
+	t.Helper()
+	raw := "From: Sender <sender@example.com>\r\n" +
+		"To: " + f.mailbox.FullAddress + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Body of " + subject + "\r\n"
+	rawPath, err := f.fileStorage.Save("message.eml", strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to save raw source: %v", err)
+	}
+	message := &models.Message{
+		MailboxID:   f.mailbox.ID,
+		SenderEmail: "sender@example.com",
+		Subject:     subject,
+		BodyText:    "Body of " + subject,
+		RawPath:     rawPath,
+		SizeBytes:   int64(len(raw)),
+		ReceivedAt:  time.Now(),
+	}
+	if err := f.messageRepo.Create(context.Background(), message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return message
+}
+
+// dial connects and logs in with the mailbox password
+func (f *imapFixture) dial(t *testing.T) *client.Client {
+	t.Helper()
+	c, err := client.Dial(f.addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { c.Logout() })
+	if err := c.Login(f.mailbox.FullAddress, f.auth.Password(f.mailbox.FullAddress)); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	return c
+}
+
+// fetch fetches items of the messages in seqset
+func fetch(t *testing.T, c *client.Client, uid bool, seqset *imap.SeqSet, items []imap.FetchItem) []*imap.Message {
+	t.Helper()
+	ch := make(chan *imap.Message, 10)
+	var err error
+	if uid {
+		err = c.UidFetch(seqset, items, ch)
+	} else {
+		err = c.Fetch(seqset, items, ch)
+	}
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	var messages []*imap.Message
+	for message := range ch {
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func seqSet(ids ...uint32) *imap.SeqSet {
+	set := new(imap.SeqSet)
+	set.AddNum(ids...)
+	return set
+}
+
+func TestLogin(t *testing.T) {
+	f := newIMAPFixture(t)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{"mailbox password", "qa@imap.test", f.auth.Password("qa@imap.test"), false},
+		{"address case is ignored", "QA@imap.test", f.auth.Password("qa@imap.test"), false},
+		{"master token", "qa@imap.test", masterToken, false},
+		{"wrong password", "qa@imap.test", "guess", true},
+		{"unknown mailbox", "nobody@imap.test", masterToken, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := client.Dial(f.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Logout()
+
+			err = c.Login(tt.username, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestList_SystemFolders(t *testing.T) {
+	f := newIMAPFixture(t)
+	c := f.dial(t)
+
+	ch := make(chan *imap.MailboxInfo, 10)
+	if err := c.List("", "*", ch); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	attributes := make(map[string][]string)
+	var names []string
+	for info := range ch {
+		names = append(names, info.Name)
+		attributes[info.Name] = info.Attributes
+	}
+
+	if strings.Join(names, ",") != "INBOX,Archive,Junk,Trash" {
+		t.Errorf("List() names = %v", names)
+	}
+	if !hasFlag(attributes["Trash"], imap.TrashAttr) {
+		t.Errorf("Trash attributes = %v, want %s", attributes["Trash"], imap.TrashAttr)
+	}
+}
+
+func TestSelectAndFetch(t *testing.T) {
+	f := newIMAPFixture(t)
+	first := f.createMessage(t, "First")
+	f.createMessage(t, "Second")
+	c := f.dial(t)
+
+	status, err := c.Select("INBOX", false)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if status.Messages != 2 {
+		t.Errorf("Messages = %d, want 2", status.Messages)
+	}
+	inbox, err := f.folderRepo.GetByRole(context.Background(), f.mailbox.ID, models.FolderRoleInbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.UidValidity != uint32(inbox.ID) {
+		t.Errorf("UidValidity = %d, want %d", status.UidValidity, inbox.ID)
+	}
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := fetch(t, c, false, seqSet(1), []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchFlags, section.FetchItem()})
+	if len(messages) != 1 {
+		t.Fatalf("Fetch() returned %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	if message.Uid != uint32(first.UID) {
+		t.Errorf("Uid = %d, want %d", message.Uid, first.UID)
+	}
+	if message.Envelope == nil || message.Envelope.Subject != "First" {
+		t.Errorf("Envelope = %+v, want subject First", message.Envelope)
+	}
+	body, err := io.ReadAll(message.GetBody(section))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "Body of First") {
+		t.Errorf("body = %q", body)
+	}
+
+	stored, err := f.messageRepo.GetByID(context.Background(), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsRead {
+		t.Error("BODY.PEEK[] marked the message as read")
+	}
+
+	fetch(t, c, false, seqSet(1), []imap.FetchItem{(&imap.BodySectionName{}).FetchItem()})
+	stored, err = f.messageRepo.GetByID(context.Background(), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsRead {
+		t.Error("BODY[] did not mark the message as read")
+	}
+}
+
+func TestFetch_RebuildsMessageWithoutSource(t *testing.T) {
+	f := newIMAPFixture(t)
+	message := &models.Message{
+		MailboxID:   f.mailbox.ID,
+		SenderEmail: "sender@example.com",
+		Subject:     "Rebuilt",
+		BodyText:    "Stored text",
+		ReceivedAt:  time.Now(),
+	}
+	if err := f.messageRepo.Create(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+	c := f.dial(t)
+	if _, err := c.Select("INBOX", true); err != nil {
+		t.Fatal(err)
+	}
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := fetch(t, c, true, seqSet(uint32(message.UID)), []imap.FetchItem{imap.FetchRFC822Size, section.FetchItem()})
+	if len(messages) != 1 {
+		t.Fatalf("Fetch() returned %d messages, want 1", len(messages))
+	}
+	body, err := io.ReadAll(messages[0].GetBody(section))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Subject: Rebuilt", "Stored text", "X-Infinimail-Rebuilt: true"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("rebuilt source is missing %q:\n%s", want, body)
+		}
+	}
+	if messages[0].Size != uint32(len(body)) {
+		t.Errorf("Size = %d, want %d", messages[0].Size, len(body))
+	}
+}
+
+func TestStoreSearchAndExpunge(t *testing.T) {
+	f := newIMAPFixture(t)
+	keep := f.createMessage(t, "Keep")
+	remove := f.createMessage(t, "Remove")
+	c := f.dial(t)
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Store(seqSet(1), imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.FlaggedFlag}, nil); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{imap.FlaggedFlag}
+	found, err := c.Search(criteria)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(found) != 1 || found[0] != 1 {
+		t.Errorf("Search(FLAGGED) = %v, want [1]", found)
+	}
+
+	criteria = imap.NewSearchCriteria()
+	criteria.Header.Add("Subject", "remove")
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		t.Fatalf("UidSearch() error = %v", err)
+	}
+	if len(uids) != 1 || uids[0] != uint32(remove.UID) {
+		t.Errorf("UidSearch(SUBJECT remove) = %v, want [%d]", uids, remove.UID)
+	}
+
+	if err := c.Store(seqSet(2), imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	expunged := make(chan uint32, 10)
+	if err := c.Expunge(expunged); err != nil {
+		t.Fatalf("Expunge() error = %v", err)
+	}
+	var seqNums []uint32
+	for seqNum := range expunged {
+		seqNums = append(seqNums, seqNum)
+	}
+	if len(seqNums) != 1 || seqNums[0] != 2 {
+		t.Errorf("expunged = %v, want [2]", seqNums)
+	}
+
+	if _, err := f.messageRepo.GetByID(context.Background(), remove.ID); err == nil {
+		t.Error("expunged message still exists")
+	}
+	stored, err := f.messageRepo.GetByID(context.Background(), keep.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsFlagged {
+		t.Error("STORE +FLAGS \\Flagged was not saved")
+	}
+}
+
+func TestMove_ToTrash(t *testing.T) {
+	f := newIMAPFixture(t)
+	message := f.createMessage(t, "Spam")
+	c := f.dial(t)
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UidMove(seqSet(uint32(message.UID)), "Trash"); err != nil {
+		t.Fatalf("UidMove() error = %v", err)
+	}
+
+	status, err := c.Status("Trash", []imap.StatusItem{imap.StatusMessages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Messages != 1 {
+		t.Errorf("Trash messages = %d, want 1", status.Messages)
+	}
+	trash, err := f.folderRepo.GetByRole(context.Background(), f.mailbox.ID, models.FolderRoleTrash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := f.messageRepo.GetByID(context.Background(), message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FolderID == nil || *stored.FolderID != trash.ID {
+		t.Errorf("FolderID = %v, want %d", stored.FolderID, trash.ID)
+	}
+}
+
+func TestMove_AssignsHigherUID(t *testing.T) {
+	f := newIMAPFixture(t)
+	older := f.createMessage(t, "Older")
+	newer := f.createMessage(t, "Newer")
+	ctx := context.Background()
+	archive, err := f.folderRepo.GetByRole(ctx, f.mailbox.ID, models.FolderRoleArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.messageRepo.SetFolderByIDs(ctx, []uint{newer.ID}, &archive.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	c := f.dial(t)
+	status, err := c.Select("Archive", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := status.UidNext - 1
+
+	// The older message arrives after the newer one was announced
+	if _, err := f.messageRepo.SetFolderByIDs(ctx, []uint{older.ID}, &archive.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Noop(); err != nil {
+		t.Fatal(err)
+	}
+
+	since := new(imap.SeqSet)
+	since.AddRange(last+1, 0)
+	messages := fetch(t, c, true, since, []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope})
+	if len(messages) != 1 || messages[0].Envelope.Subject != "Older" {
+		t.Fatalf("UID FETCH %d:* = %d messages, want the moved one", last+1, len(messages))
+	}
+	if messages[0].Uid <= last {
+		t.Errorf("Uid = %d, want above %d", messages[0].Uid, last)
+	}
+
+	// UIDNEXT stays above every UID handed out, even once they are gone
+	if err := f.messageRepo.Delete(ctx, older.ID); err != nil {
+		t.Fatal(err)
+	}
+	status, err = c.Status("Archive", []imap.StatusItem{imap.StatusUidNext})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.UidNext <= messages[0].Uid {
+		t.Errorf("UidNext = %d, want above %d", status.UidNext, messages[0].Uid)
+	}
+}
+
+func TestAppend_ToFolderWithFlags(t *testing.T) {
+	f := newIMAPFixture(t)
+	c := f.dial(t)
+
+	raw := "From: me@imap.test\r\nTo: qa@imap.test\r\nSubject: Draft\r\n\r\nHello\r\n"
+	if err := c.Append("Archive", []string{imap.SeenFlag}, time.Now(), bytes.NewBufferString(raw)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	archive, err := f.folderRepo.GetByRole(context.Background(), f.mailbox.ID, models.FolderRoleArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := f.messageRepo.ListFolderItems(context.Background(), f.mailbox.ID, archive.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Subject != "Draft" || !items[0].IsRead {
+		t.Errorf("Archive = %+v, want one read message with subject Draft", items)
+	}
+}
+
+func TestIdle_AnnouncesNewMessage(t *testing.T) {
+	f := newIMAPFixture(t)
+	c := f.dial(t)
+	updates := make(chan client.Update, 10)
+	c.Updates = updates
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal(err)
+	}
+	// Drop the updates of SELECT; the client keeps changing the status they point to
+	for len(updates) > 0 {
+		<-updates
+	}
+
+	stop := make(chan struct{})
+	idleDone := make(chan error, 1)
+	go func() {
+		idleDone <- c.Idle(stop, nil)
+	}()
+	f.createMessage(t, "Pushed")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update := <-updates:
+			if _, ok := update.(*client.MailboxUpdate); ok {
+				close(stop)
+				if err := <-idleDone; err != nil {
+					t.Fatalf("Idle() error = %v", err)
+				}
+				// The update's status is shared with the client, so ask the server again
+				status, err := c.Select("INBOX", false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status.Messages != 1 {
+					t.Errorf("INBOX messages = %d, want 1", status.Messages)
+				}
+				return
+			}
+		case <-timeout:
+			close(stop)
+			t.Fatal("no EXISTS update while idling")
+		}
+	}
+}
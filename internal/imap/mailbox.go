@@ -0,0 +1,521 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// systemFlags are the flags stored for every message; keywords are not kept
+var systemFlags = []string{models.FlagSeen, models.FlagFlagged, models.FlagAnswered, models.FlagDeleted, models.FlagDraft}
+
+// errCopyUnsupported is returned for COPY; a message belongs to exactly one folder
+var errCopyUnsupported = errors.New("COPY is not supported, use MOVE")
+
+// Mailbox is an open folder of a mailbox
+type Mailbox struct {
+	user   *User
+	folder *models.Folder
+	name   string
+	view   *folderView
+}
+
+// Name returns the IMAP name of the folder
+func (m *Mailbox) Name() string {
+	return m.name
+}
+
+// Info returns the LIST entry of the folder
+func (m *Mailbox) Info() (*imap.MailboxInfo, error) {
+	return &imap.MailboxInfo{
+		Attributes: folderAttributes(m.folder),
+		Delimiter:  Delimiter,
+		Name:       m.name,
+	}, nil
+}
+
+// Status returns the requested counters of the folder
+func (m *Mailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	snapshot, err := m.sync(true)
+	if err != nil {
+		return nil, err
+	}
+
+	status := imap.NewMailboxStatus(m.name, items)
+	status.Flags = systemFlags
+	status.PermanentFlags = systemFlags
+
+	var unseen uint32
+	for i, uid := range snapshot.uids {
+		item, ok := snapshot.items[uid]
+		if !ok || item.IsRead {
+			continue
+		}
+		unseen++
+		if status.UnseenSeqNum == 0 {
+			status.UnseenSeqNum = uint32(i + 1)
+		}
+	}
+
+	for _, name := range items {
+		switch name {
+		case imap.StatusMessages:
+			status.Messages = uint32(len(snapshot.uids))
+		case imap.StatusUidNext:
+			status.UidNext = snapshot.uidNext
+		case imap.StatusUidValidity:
+			status.UidValidity = uint32(m.folder.ID)
+		case imap.StatusRecent:
+			status.Recent = 0
+		case imap.StatusUnseen:
+			status.Unseen = unseen
+		}
+	}
+	return status, nil
+}
+
+// SetSubscribed is a no-op; every folder counts as subscribed
+func (m *Mailbox) SetSubscribed(subscribed bool) error {
+	return nil
+}
+
+// Check is a no-op; changes are written immediately
+func (m *Mailbox) Check() error {
+	return nil
+}
+
+// Poll announces changes made outside this session; the server calls it for NOOP
+func (m *Mailbox) Poll() error {
+	_, err := m.sync(true)
+	return err
+}
+
+// ListMessages sends the requested items of the messages in seqSet to ch.
+// Fetching a body section without PEEK marks the message as read.
+func (m *Mailbox) ListMessages(uid bool, seqSet *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+	defer close(ch)
+
+	ctx := context.Background()
+	snapshot, err := m.sync(false)
+	if err != nil {
+		return err
+	}
+
+	for i, messageUID := range snapshot.uids {
+		seqNum := uint32(i + 1)
+		if !matchesSet(seqSet, uid, seqNum, messageUID) {
+			continue
+		}
+		item, ok := snapshot.items[messageUID]
+		if !ok {
+			continue
+		}
+
+		fetched, err := m.fetch(ctx, seqNum, item, items)
+		if err != nil {
+			if m.user.backend.logger != nil {
+				m.user.backend.logger.Warn("failed to fetch message over IMAP",
+					slog.Uint64("message_id", uint64(item.ID)),
+					slog.Any("error", err))
+			}
+			continue
+		}
+		ch <- fetched
+	}
+	return nil
+}
+
+// SearchMessages returns the sequence numbers or UIDs of the messages matching
+// criteria. Message sources are only read for criteria on headers, text or size.
+func (m *Mailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]uint32, error) {
+	ctx := context.Background()
+	snapshot, err := m.sync(false)
+	if err != nil {
+		return nil, err
+	}
+
+	withContent := needsContent(criteria)
+	var ids []uint32
+	for i, messageUID := range snapshot.uids {
+		seqNum := uint32(i + 1)
+		item, ok := snapshot.items[messageUID]
+		if !ok {
+			continue
+		}
+
+		entity, err := message.New(message.Header{}, strings.NewReader(""))
+		if err != nil {
+			return nil, err
+		}
+		if withContent {
+			raw, err := m.source(ctx, item.ID)
+			if err != nil {
+				continue
+			}
+			entity, err = message.Read(bytes.NewReader(raw))
+			if err != nil && !message.IsUnknownCharset(err) {
+				continue
+			}
+		}
+
+		matched, err := backendutil.Match(entity, seqNum, messageUID, item.ReceivedAt, itemFlags(item), criteria)
+		if err != nil || !matched {
+			continue
+		}
+		if uid {
+			ids = append(ids, messageUID)
+		} else {
+			ids = append(ids, seqNum)
+		}
+	}
+	return ids, nil
+}
+
+// CreateMessage delivers an appended message to the folder
+func (m *Mailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	b := m.user.backend
+	if b.deliverer == nil {
+		return errors.New("APPEND is not supported")
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	created, err := b.deliverer.DeliverRaw(ctx, m.user.mailbox, raw, true)
+	if err != nil {
+		return b.internalError("failed to deliver appended message", err)
+	}
+	if m.folder.Role != models.FolderRoleInbox {
+		if _, err := b.messageRepo.SetFolderByIDs(ctx, []uint{created.ID}, &m.folder.ID); err != nil {
+			return b.internalError("failed to file appended message", err)
+		}
+	}
+
+	changes := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		if _, ok := models.FlagColumn(flag); ok {
+			changes[flag] = true
+		}
+	}
+	if err := b.messageRepo.SetFlags(ctx, created.ID, changes); err != nil {
+		return b.internalError("failed to set flags of appended message", err)
+	}
+
+	_, err = m.sync(false)
+	return err
+}
+
+// UpdateMessagesFlags changes the flags of the messages in seqSet.
+// Keywords are ignored; only system flags are stored.
+func (m *Mailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, op imap.FlagsOp, flags []string) error {
+	ctx := context.Background()
+	snapshot, err := m.sync(false)
+	if err != nil {
+		return err
+	}
+
+	for i, messageUID := range snapshot.uids {
+		seqNum := uint32(i + 1)
+		if !matchesSet(seqSet, uid, seqNum, messageUID) {
+			continue
+		}
+		item, ok := snapshot.items[messageUID]
+		if !ok {
+			continue
+		}
+
+		current := itemFlags(item)
+		updated := backendutil.UpdateFlags(current, op, flags)
+		changes := make(map[string]bool)
+		for _, flag := range systemFlags {
+			if set := hasFlag(updated, flag); set != hasFlag(current, flag) {
+				changes[flag] = set
+			}
+		}
+		if len(changes) > 0 {
+			if err := m.user.backend.messageRepo.SetFlags(ctx, item.ID, changes); err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					continue
+				}
+				return m.user.backend.internalError("failed to update message flags", err)
+			}
+			applyFlags(item, changes)
+		}
+		m.view.sendFlags(seqNum, item)
+	}
+	return nil
+}
+
+// CopyMessages is not supported
+func (m *Mailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	return errCopyUnsupported
+}
+
+// MoveMessages moves the messages in seqSet to another folder of the mailbox
+func (m *Mailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	ctx := context.Background()
+	target, err := m.user.folder(ctx, dest)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := m.sync(false)
+	if err != nil {
+		return err
+	}
+	var ids []uint
+	for i, messageUID := range snapshot.uids {
+		if item, ok := snapshot.items[messageUID]; ok && matchesSet(seqSet, uid, uint32(i+1), messageUID) {
+			ids = append(ids, item.ID)
+		}
+	}
+	if len(ids) == 0 || target.ID == m.folder.ID {
+		return nil
+	}
+
+	// Messages without a folder are in the Inbox
+	var folderID *uint
+	if target.Role != models.FolderRoleInbox {
+		folderID = &target.ID
+	}
+	if _, err := m.user.backend.messageRepo.SetFolderByIDs(ctx, ids, folderID); err != nil {
+		return m.user.backend.internalError("failed to move messages", err)
+	}
+
+	if _, err := m.sync(true); err != nil {
+		return err
+	}
+	if view := m.user.backend.watchedView(target.ID); view != nil {
+		if _, err := view.sync(ctx, true); err != nil {
+			return m.user.backend.internalError("failed to check target folder", err)
+		}
+	}
+	return nil
+}
+
+// Expunge permanently deletes the messages flagged \Deleted, with their files
+func (m *Mailbox) Expunge() error {
+	ctx := context.Background()
+	snapshot, err := m.sync(true)
+	if err != nil {
+		return err
+	}
+
+	for _, messageUID := range snapshot.uids {
+		item, ok := snapshot.items[messageUID]
+		if !ok || !item.IsDeleted {
+			continue
+		}
+		if err := m.user.backend.messageRepo.Delete(ctx, item.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return m.user.backend.internalError("failed to delete message", err)
+		}
+	}
+
+	_, err = m.sync(true)
+	return err
+}
+
+// sync refreshes the shared view of the folder
+func (m *Mailbox) sync(expunge bool) (*folderSnapshot, error) {
+	snapshot, err := m.view.sync(context.Background(), expunge)
+	if err != nil {
+		return nil, m.user.backend.internalError("failed to list folder messages", err)
+	}
+	return snapshot, nil
+}
+
+// fetch builds the FETCH response of a message. The message source is only read
+// for items that need it.
+func (m *Mailbox) fetch(ctx context.Context, seqNum uint32, item *models.MessageListItem, items []imap.FetchItem) (*imap.Message, error) {
+	fetched := imap.NewMessage(seqNum, items)
+
+	var raw []byte
+	source := func() ([]byte, error) {
+		if raw != nil {
+			return raw, nil
+		}
+		var err error
+		raw, err = m.source(ctx, item.ID)
+		return raw, err
+	}
+
+	markSeen := false
+	for _, fetchItem := range items {
+		switch fetchItem {
+		case imap.FetchEnvelope:
+			raw, err := source()
+			if err != nil {
+				return nil, err
+			}
+			header, _, err := splitMessage(raw)
+			if err != nil {
+				return nil, err
+			}
+			fetched.Envelope, _ = backendutil.FetchEnvelope(header)
+		case imap.FetchBody, imap.FetchBodyStructure:
+			raw, err := source()
+			if err != nil {
+				return nil, err
+			}
+			header, body, err := splitMessage(raw)
+			if err != nil {
+				return nil, err
+			}
+			fetched.BodyStructure, _ = backendutil.FetchBodyStructure(header, body, fetchItem == imap.FetchBodyStructure)
+		case imap.FetchFlags:
+			fetched.Flags = itemFlags(item)
+		case imap.FetchInternalDate:
+			fetched.InternalDate = item.ReceivedAt
+		case imap.FetchRFC822Size:
+			// The stored size is the length of the raw source; rebuilt messages are measured
+			if item.SizeBytes > 0 {
+				fetched.Size = uint32(item.SizeBytes)
+			} else {
+				raw, err := source()
+				if err != nil {
+					return nil, err
+				}
+				fetched.Size = uint32(len(raw))
+			}
+		case imap.FetchUid:
+			fetched.Uid = uint32(item.UID)
+		default:
+			section, err := imap.ParseBodySectionName(fetchItem)
+			if err != nil {
+				break
+			}
+			raw, err := source()
+			if err != nil {
+				return nil, err
+			}
+			header, body, err := splitMessage(raw)
+			if err != nil {
+				return nil, err
+			}
+			literal, _ := backendutil.FetchBodySection(header, body, section)
+			fetched.Body[section] = literal
+			if !section.Peek && !item.IsRead {
+				markSeen = true
+			}
+		}
+	}
+
+	if markSeen {
+		if _, err := m.user.backend.messageRepo.SetReadByIDs(ctx, []uint{item.ID}, true); err != nil {
+			return nil, err
+		}
+		item.IsRead = true
+		fetched.Items[imap.FetchFlags] = nil
+		fetched.Flags = itemFlags(item)
+	}
+	return fetched, nil
+}
+
+// source returns the RFC 822 source of a message, rebuilt from the stored fields
+// when the raw source is not available
+func (m *Mailbox) source(ctx context.Context, id uint) ([]byte, error) {
+	stored, err := m.user.backend.messageRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return services.MessageSource(m.user.backend.fileStorage, m.user.mailbox, stored)
+}
+
+// splitMessage parses the header of a message source and returns it with the body
+func splitMessage(raw []byte) (textproto.Header, io.Reader, error) {
+	body := bufio.NewReader(bytes.NewReader(raw))
+	header, err := textproto.ReadHeader(body)
+	return header, body, err
+}
+
+// matchesSet reports whether a message is in a sequence set of sequence numbers or UIDs
+func matchesSet(seqSet *imap.SeqSet, uid bool, seqNum, messageUID uint32) bool {
+	if uid {
+		return seqSet.Contains(messageUID)
+	}
+	return seqSet.Contains(seqNum)
+}
+
+// needsContent reports whether criteria look at the message source rather than
+// only at flags, dates and numbers
+func needsContent(criteria *imap.SearchCriteria) bool {
+	if len(criteria.Header) > 0 || len(criteria.Body) > 0 || len(criteria.Text) > 0 ||
+		!criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() ||
+		criteria.Larger > 0 || criteria.Smaller > 0 {
+		return true
+	}
+	for _, not := range criteria.Not {
+		if needsContent(not) {
+			return true
+		}
+	}
+	for _, or := range criteria.Or {
+		if needsContent(or[0]) || needsContent(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// itemFlags returns the system flags set on a message
+func itemFlags(item *models.MessageListItem) []string {
+	message := models.Message{
+		IsRead:     item.IsRead,
+		IsFlagged:  item.IsFlagged,
+		IsAnswered: item.IsAnswered,
+		IsDeleted:  item.IsDeleted,
+		IsDraft:    item.IsDraft,
+	}
+	return message.Flags()
+}
+
+// applyFlags copies flag changes to a listed message
+func applyFlags(item *models.MessageListItem, changes map[string]bool) {
+	for flag, set := range changes {
+		switch flag {
+		case models.FlagSeen:
+			item.IsRead = set
+		case models.FlagFlagged:
+			item.IsFlagged = set
+		case models.FlagAnswered:
+			item.IsAnswered = set
+		case models.FlagDeleted:
+			item.IsDeleted = set
+		case models.FlagDraft:
+			item.IsDraft = set
+		}
+	}
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile-time checks of the optional backend interfaces
+var (
+	_ backend.MoveMailbox    = (*Mailbox)(nil)
+	_ backend.MailboxPoller  = (*Mailbox)(nil)
+	_ backend.BackendUpdater = (*Backend)(nil)
+)
@@ -0,0 +1,310 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/server"
+)
+
+// Server defaults
+const (
+	DefaultMaxMessageSize = 25 * 1024 * 1024 // 25 MB
+	DefaultPollInterval   = 10 * time.Second
+)
+
+// ServerConfig holds configuration for the IMAP server
+type ServerConfig struct {
+	// Addr is the plain listener, upgraded with STARTTLS; empty disables it
+	Addr string
+	// TLSAddr is the implicit TLS listener; empty disables it
+	TLSAddr string
+	// AllowInsecure allows LOGIN before STARTTLS
+	AllowInsecure  bool
+	MaxMessageSize int64
+	// PollInterval is how often open folders are checked for changes made outside IMAP
+	PollInterval time.Duration
+	// SNI Support
+	GetCertificate  func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	DefaultCertFile string
+	DefaultKeyFile  string
+}
+
+// Server wraps the go-imap server with SNI certificates, a STARTTLS and an
+// implicit TLS listener, and the folder watcher of the backend
+type Server struct {
+	*server.Server
+	backend        *Backend
+	cfg            *ServerConfig
+	mu             sync.RWMutex
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	defaultCert    *tls.Certificate
+	stopWatch      context.CancelFunc
+	logger         *slog.Logger
+}
+
+// NewServer creates a new IMAP server. TLS is only offered when a certificate
+// source is configured.
+func NewServer(backend *Backend, cfg *ServerConfig) *Server {
+	s := server.New(backend)
+	s.AllowInsecureAuth = cfg.AllowInsecure
+	// Route library errors to the application log
+	s.ErrorLog = slogLogger{backend.logger}
+
+	if cfg.MaxMessageSize > 0 {
+		s.MaxLiteralSize = uint32(cfg.MaxMessageSize)
+	} else {
+		s.MaxLiteralSize = DefaultMaxMessageSize
+	}
+	// Log out idle clients after the shortest time RFC 3501 allows
+	s.AutoLogout = server.MinAutoLogout
+
+	imapServer := &Server{
+		Server:         s,
+		backend:        backend,
+		cfg:            cfg,
+		getCertificate: cfg.GetCertificate,
+		logger:         backend.logger,
+	}
+
+	if cfg.DefaultCertFile != "" && cfg.DefaultKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.DefaultCertFile, cfg.DefaultKeyFile)
+		if err == nil {
+			imapServer.defaultCert = &cert
+		} else if backend.logger != nil {
+			backend.logger.Warn("failed to load default IMAP certificate", slog.Any("error", err))
+		}
+	}
+	if imapServer.getCertificate != nil || imapServer.defaultCert != nil {
+		s.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: imapServer.getCertificateWithFallback,
+		}
+	}
+
+	return imapServer
+}
+
+// ListenAndServe listens on the configured addresses and serves IMAP until Close
+func (s *Server) ListenAndServe() error {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	if s.cfg.Addr != "" {
+		l, err := net.Listen("tcp", s.cfg.Addr)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	if s.cfg.TLSAddr != "" {
+		if s.TLSConfig == nil {
+			if s.logger != nil {
+				s.logger.Warn("no certificate configured, IMAP implicit TLS listener disabled",
+					slog.String("addr", s.cfg.TLSAddr))
+			}
+		} else {
+			l, err := net.Listen("tcp", s.cfg.TLSAddr)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			listeners = append(listeners, tls.NewListener(l, s.TLSConfig))
+		}
+	}
+	if len(listeners) == 0 {
+		return errors.New("no IMAP listener configured")
+	}
+
+	return s.Serve(listeners...)
+}
+
+// Serve accepts connections on all listeners. go-imap starts an update loop for
+// every Serve call, so the listeners are merged to keep a single one.
+func (s *Server) Serve(listeners ...net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.stopWatch = cancel
+	s.mu.Unlock()
+
+	interval := s.cfg.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	go s.backend.Watch(ctx, interval)
+
+	return s.Server.Serve(newMultiListener(listeners...))
+}
+
+// Close stops the folder watcher and closes all listeners and connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	s.mu.Unlock()
+	return s.Server.Close()
+}
+
+// getCertificateWithFallback returns the certificate for the SNI hostname,
+// falling back to the default certificate
+func (s *Server) getCertificateWithFallback(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	getCertificate := s.getCertificate
+	defaultCert := s.defaultCert
+	s.mu.RUnlock()
+
+	if getCertificate != nil {
+		cert, err := getCertificate(hello)
+		if err == nil && cert != nil {
+			return cert, nil
+		}
+		if s.logger != nil && err != nil {
+			s.logger.Debug("SNI certificate lookup failed, using fallback",
+				slog.String("server_name", hello.ServerName),
+				slog.Any("error", err))
+		}
+	}
+	return defaultCert, nil
+}
+
+// multiListener accepts connections from several listeners
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners ...net.Listener) *multiListener {
+	ml := &multiListener{
+		listeners: listeners,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error, len(listeners)),
+		done:      make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go ml.accept(l)
+	}
+	return ml
+}
+
+func (ml *multiListener) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			ml.errs <- err
+			return
+		}
+		select {
+		case ml.conns <- conn:
+		case <-ml.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+// Accept returns the next connection of any listener; the first listener error ends serving
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ml.conns:
+		return conn, nil
+	case err := <-ml.errs:
+		return nil, err
+	case <-ml.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes every listener
+func (ml *multiListener) Close() error {
+	var err error
+	ml.closeOnce.Do(func() {
+		close(ml.done)
+		for _, l := range ml.listeners {
+			if closeErr := l.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener
+func (ml *multiListener) Addr() net.Addr {
+	return ml.listeners[0].Addr()
+}
+
+// slogLogger adapts slog to the logger interface of go-imap
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) Printf(format string, v ...interface{}) {
+	if l.logger != nil {
+		l.logger.Debug("imap server", slog.String("message", fmt.Sprintf(format, v...)))
+	}
+}
+
+func (l slogLogger) Println(v ...interface{}) {
+	if l.logger != nil {
+		l.logger.Debug("imap server", slog.String("message", strings.TrimSuffix(fmt.Sprintln(v...), "\n")))
+	}
+}
+
+// LoadServerConfigFromEnv loads server configuration from environment variables.
+// The listener addresses come from the application config.
+func LoadServerConfigFromEnv() *ServerConfig {
+	cfg := &ServerConfig{
+		AllowInsecure: getEnvBool("IMAP_ALLOW_INSECURE", false),
+	}
+
+	if maxSize := os.Getenv("IMAP_MAX_MESSAGE_SIZE"); maxSize != "" {
+		if size, err := strconv.ParseInt(maxSize, 10, 64); err == nil {
+			cfg.MaxMessageSize = size
+		}
+	}
+
+	if interval := os.Getenv("IMAP_POLL_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			cfg.PollInterval = d
+		}
+	}
+
+	// Default certificate used when SNI finds no match; falls back to the SMTP one
+	cfg.DefaultCertFile = getEnvOrDefault("IMAP_TLS_CERT", os.Getenv("SMTP_TLS_CERT"))
+	cfg.DefaultKeyFile = getEnvOrDefault("IMAP_TLS_KEY", os.Getenv("SMTP_TLS_KEY"))
+
+	return cfg
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,217 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// Delimiter separates levels of mailbox names. Folders are flat, so it only
+// appears in names that contain it.
+const Delimiter = "/"
+
+// inboxName is the IMAP name of the Inbox folder
+const inboxName = "INBOX"
+
+// maxFolderNameLength matches the size of models.Folder.Name
+const maxFolderNameLength = 100
+
+// errSystemFolder is returned when deleting or renaming a system folder
+var errSystemFolder = errors.New("system folders cannot be deleted or renamed")
+
+// User is a logged in mailbox
+type User struct {
+	backend *Backend
+	mailbox *models.Mailbox
+
+	// Folder views this session holds, by folder ID
+	mu    sync.Mutex
+	views map[uint]*folderView
+}
+
+// Username returns the mailbox address
+func (u *User) Username() string {
+	return u.mailbox.FullAddress
+}
+
+// ListMailboxes returns the folders of the mailbox. Every folder counts as subscribed.
+func (u *User) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	folders, err := u.backend.folderRepo.ListByMailbox(context.Background(), u.mailbox.ID)
+	if err != nil {
+		return nil, u.backend.internalError("failed to list folders", err)
+	}
+
+	mailboxes := make([]backend.Mailbox, len(folders))
+	for i := range folders {
+		folder := folders[i].Folder
+		mailboxes[i] = u.newMailbox(&folder)
+	}
+	return mailboxes, nil
+}
+
+// GetMailbox returns a folder by its IMAP name
+func (u *User) GetMailbox(name string) (backend.Mailbox, error) {
+	folder, err := u.folder(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	return u.newMailbox(folder), nil
+}
+
+// CreateMailbox creates a custom folder
+func (u *User) CreateMailbox(name string) error {
+	if err := validateFolderName(name); err != nil {
+		return err
+	}
+	if strings.EqualFold(name, inboxName) {
+		return backend.ErrMailboxAlreadyExists
+	}
+
+	ctx := context.Background()
+	if err := u.backend.folderRepo.EnsureSystemFolders(ctx, u.mailbox.ID); err != nil {
+		return u.backend.internalError("failed to create system folders", err)
+	}
+	folder := &models.Folder{MailboxID: u.mailbox.ID, Name: name}
+	if err := u.backend.folderRepo.Create(ctx, folder); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return backend.ErrMailboxAlreadyExists
+		}
+		return u.backend.internalError("failed to create folder", err)
+	}
+	return nil
+}
+
+// DeleteMailbox deletes a custom folder; its messages return to the Inbox
+func (u *User) DeleteMailbox(name string) error {
+	ctx := context.Background()
+	folder, err := u.folder(ctx, name)
+	if err != nil {
+		return err
+	}
+	if folder.IsSystem() {
+		return errSystemFolder
+	}
+
+	if err := u.backend.folderRepo.Delete(ctx, folder.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return backend.ErrNoSuchMailbox
+		}
+		return u.backend.internalError("failed to delete folder", err)
+	}
+	return nil
+}
+
+// RenameMailbox renames a custom folder
+func (u *User) RenameMailbox(existingName, newName string) error {
+	if err := validateFolderName(newName); err != nil {
+		return err
+	}
+	if strings.EqualFold(newName, inboxName) {
+		return backend.ErrMailboxAlreadyExists
+	}
+
+	ctx := context.Background()
+	folder, err := u.folder(ctx, existingName)
+	if err != nil {
+		return err
+	}
+	if folder.IsSystem() {
+		return errSystemFolder
+	}
+
+	if err := u.backend.folderRepo.Rename(ctx, folder.ID, newName); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return backend.ErrMailboxAlreadyExists
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return backend.ErrNoSuchMailbox
+		}
+		return u.backend.internalError("failed to rename folder", err)
+	}
+	return nil
+}
+
+// Logout releases the folder views of the session
+func (u *User) Logout() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for id, view := range u.views {
+		u.backend.releaseView(view)
+		delete(u.views, id)
+	}
+	return nil
+}
+
+// folder looks up a folder by its IMAP name; INBOX is case-insensitive
+func (u *User) folder(ctx context.Context, name string) (*models.Folder, error) {
+	if strings.EqualFold(name, inboxName) {
+		folder, err := u.backend.folderRepo.GetByRole(ctx, u.mailbox.ID, models.FolderRoleInbox)
+		if err != nil {
+			return nil, u.backend.internalError("failed to get inbox", err)
+		}
+		return folder, nil
+	}
+
+	folders, err := u.backend.folderRepo.ListByMailbox(ctx, u.mailbox.ID)
+	if err != nil {
+		return nil, u.backend.internalError("failed to list folders", err)
+	}
+	for i := range folders {
+		if folderName(&folders[i].Folder) == name {
+			return &folders[i].Folder, nil
+		}
+	}
+	return nil, backend.ErrNoSuchMailbox
+}
+
+// newMailbox opens a folder, watching it for changes until logout
+func (u *User) newMailbox(folder *models.Folder) *Mailbox {
+	u.mu.Lock()
+	view, ok := u.views[folder.ID]
+	if !ok {
+		view = u.backend.acquireView(u.Username(), folder)
+		u.views[folder.ID] = view
+	}
+	u.mu.Unlock()
+
+	return &Mailbox{user: u, folder: folder, name: folderName(folder), view: view}
+}
+
+// folderName returns the IMAP name of a folder
+func folderName(folder *models.Folder) string {
+	if folder.Role == models.FolderRoleInbox {
+		return inboxName
+	}
+	return folder.Name
+}
+
+// folderAttributes returns the LIST attributes of a folder, including the
+// special-use attributes of RFC 6154
+func folderAttributes(folder *models.Folder) []string {
+	attributes := []string{imap.HasNoChildrenAttr}
+	switch folder.Role {
+	case models.FolderRoleArchive:
+		attributes = append(attributes, imap.ArchiveAttr)
+	case models.FolderRoleJunk:
+		attributes = append(attributes, imap.JunkAttr)
+	case models.FolderRoleTrash:
+		attributes = append(attributes, imap.TrashAttr)
+	}
+	return attributes
+}
+
+// validateFolderName checks the name of a new custom folder
+func validateFolderName(name string) error {
+	if strings.TrimSpace(name) == "" || utf8.RuneCountInString(name) > maxFolderNameLength {
+		return errors.New("invalid mailbox name")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package imap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+)
+
+// folderView numbers the messages of a folder. One view is shared by every
+// session of the account, so all of them agree on sequence numbers, and it turns
+// changes found in the database into EXISTS and EXPUNGE updates.
+//
+// UIDs are assigned by the message repository when a message is stored or moved
+// into a folder, in commit order, so new messages are numbered after the known
+// ones and UIDs only grow. UIDVALIDITY is the folder ID.
+type folderView struct {
+	backend   *Backend
+	username  string
+	name      string
+	mailboxID uint
+	folderID  uint
+
+	mu      sync.Mutex
+	loaded  bool
+	uids    []uint32
+	uidNext uint32
+	refs    int
+}
+
+// folderSnapshot is the state of a folder after a sync
+type folderSnapshot struct {
+	// uids holds the UID of every message in sequence number order
+	uids []uint32
+	// items holds the messages by UID; UIDs of messages deleted since the last
+	// expunging sync are missing
+	items   map[uint32]*models.MessageListItem
+	uidNext uint32
+}
+
+// sync reloads the folder and announces new messages. With expunge, messages that
+// are gone are also removed from the numbering and announced; RFC 3501 forbids
+// that while answering FETCH, STORE and SEARCH.
+func (v *folderView) sync(ctx context.Context, expunge bool) (*folderSnapshot, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// The counter is read before the messages, so every UID it has handed out
+	// is either listed or still uncommitted and higher than the listed ones
+	mailbox, err := v.backend.mailboxRepo.GetByID(ctx, v.mailboxID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := v.backend.messageRepo.ListFolderItems(ctx, v.mailboxID, v.folderID)
+	if err != nil {
+		return nil, err
+	}
+	byUID := make(map[uint32]*models.MessageListItem, len(items))
+	for i := range items {
+		byUID[uint32(items[i].UID)] = &items[i]
+	}
+
+	if !v.loaded {
+		v.loaded = true
+		for _, item := range items {
+			v.uids = append(v.uids, uint32(item.UID))
+		}
+	} else {
+		if expunge {
+			for i := len(v.uids) - 1; i >= 0; i-- {
+				if _, ok := byUID[v.uids[i]]; ok {
+					continue
+				}
+				v.uids = append(v.uids[:i], v.uids[i+1:]...)
+				v.backend.sendUpdate(&backend.ExpungeUpdate{
+					Update: backend.NewUpdate(v.username, v.name),
+					SeqNum: uint32(i + 1),
+				})
+			}
+		}
+
+		known := make(map[uint32]bool, len(v.uids))
+		for _, uid := range v.uids {
+			known[uid] = true
+		}
+		added := false
+		for _, item := range items {
+			if uid := uint32(item.UID); !known[uid] {
+				v.uids = append(v.uids, uid)
+				added = true
+			}
+		}
+		if added {
+			status := imap.NewMailboxStatus(v.name, []imap.StatusItem{imap.StatusMessages})
+			status.Messages = uint32(len(v.uids))
+			v.backend.sendUpdate(&backend.MailboxUpdate{
+				Update:        backend.NewUpdate(v.username, v.name),
+				MailboxStatus: status,
+			})
+		}
+	}
+
+	// UIDNEXT never decreases, even when the newest messages are deleted
+	if next := uint32(mailbox.UIDNext); next > v.uidNext {
+		v.uidNext = next
+	}
+	for _, uid := range v.uids {
+		if uid >= v.uidNext {
+			v.uidNext = uid + 1
+		}
+	}
+	if v.uidNext == 0 {
+		v.uidNext = 1
+	}
+
+	return &folderSnapshot{
+		uids:    append([]uint32(nil), v.uids...),
+		items:   byUID,
+		uidNext: v.uidNext,
+	}, nil
+}
+
+// sendFlags announces the new flags of a message to the sessions of the folder
+func (v *folderView) sendFlags(seqNum uint32, item *models.MessageListItem) {
+	message := imap.NewMessage(seqNum, []imap.FetchItem{imap.FetchFlags, imap.FetchUid})
+	message.Flags = itemFlags(item)
+	message.Uid = uint32(item.UID)
+	v.backend.sendUpdate(&backend.MessageUpdate{
+		Update:  backend.NewUpdate(v.username, v.name),
+		Message: message,
+	})
+}
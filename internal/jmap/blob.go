@@ -0,0 +1,79 @@
+package jmap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// ErrBlobNotFound is returned for a blob id that does not name data of the account
+var ErrBlobNotFound = errors.New("blob not found")
+
+// Blob is the content of a blob id. Blob ids name the source of a message (M),
+// its text (P) and HTML (H) bodies, and its attachments (A<message>_<attachment>).
+type Blob struct {
+	Content io.ReadCloser
+	Type    string
+}
+
+// Blob opens the content of a blob of an account
+func (s *Server) Blob(ctx context.Context, account *models.Mailbox, blobID string) (*Blob, error) {
+	if blobID == "" {
+		return nil, ErrBlobNotFound
+	}
+	kind, id := blobID[0], blobID[1:]
+	var attachmentID uint
+	if kind == 'A' {
+		messagePart, attachmentPart, ok := strings.Cut(id, "_")
+		if !ok {
+			return nil, ErrBlobNotFound
+		}
+		id, attachmentID = messagePart, parseID(attachmentPart)
+	}
+
+	c := &call{ctx: ctx, server: s, account: account}
+	message, err := c.message(parseID(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+
+	switch kind {
+	case 'M':
+		source, err := services.MessageSource(s.fileStorage, account, message)
+		if err != nil {
+			return nil, err
+		}
+		return &Blob{Content: io.NopCloser(bytes.NewReader(source)), Type: "message/rfc822"}, nil
+	case 'P':
+		if message.BodyText == "" {
+			return nil, ErrBlobNotFound
+		}
+		return &Blob{Content: io.NopCloser(strings.NewReader(message.BodyText)), Type: "text/plain; charset=utf-8"}, nil
+	case 'H':
+		if message.BodyHTML == "" {
+			return nil, ErrBlobNotFound
+		}
+		return &Blob{Content: io.NopCloser(strings.NewReader(message.BodyHTML)), Type: "text/html; charset=utf-8"}, nil
+	case 'A':
+		for _, attachment := range message.Attachments {
+			if attachment.ID != attachmentID {
+				continue
+			}
+			content, err := s.fileStorage.Get(attachment.FilePath)
+			if err != nil {
+				return nil, err
+			}
+			return &Blob{Content: content, Type: attachment.ContentType}, nil
+		}
+	}
+	return nil, ErrBlobNotFound
+}
@@ -0,0 +1,478 @@
+package jmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+)
+
+// emailProperties are the properties of an Email object, in the default order of
+// Email/get
+var emailProperties = []string{
+	"id", "blobId", "threadId", "mailboxIds", "keywords", "size", "receivedAt",
+	"messageId", "inReplyTo", "references", "sender", "from", "to", "cc", "bcc",
+	"replyTo", "subject", "sentAt", "hasAttachment", "preview", "bodyValues",
+	"textBody", "htmlBody", "attachments",
+}
+
+// bodyPartProperties are the properties of an EmailBodyPart object
+var bodyPartProperties = []string{
+	"partId", "blobId", "size", "name", "type", "charset", "disposition", "cid",
+	"language", "location", "subParts",
+}
+
+// headerProperties are the Email properties parsed from the message source
+var headerProperties = map[string]bool{
+	"messageId": true, "inReplyTo": true, "references": true, "sender": true, "to": true,
+	"cc": true, "bcc": true, "replyTo": true, "sentAt": true,
+}
+
+// keywordFlags maps the supported keywords to system flags; keywords are
+// case-insensitive and kept in lower case
+var keywordFlags = map[string]string{
+	"$seen":     models.FlagSeen,
+	"$flagged":  models.FlagFlagged,
+	"$answered": models.FlagAnswered,
+	"$draft":    models.FlagDraft,
+}
+
+type emailGetArgs struct {
+	getArgs
+	BodyProperties      []string `json:"bodyProperties"`
+	FetchTextBodyValues bool     `json:"fetchTextBodyValues"`
+	FetchHTMLBodyValues bool     `json:"fetchHTMLBodyValues"`
+	FetchAllBodyValues  bool     `json:"fetchAllBodyValues"`
+	MaxBodyValueBytes   int      `json:"maxBodyValueBytes"`
+}
+
+// emailGet implements Email/get
+func emailGet(c *call, raw json.RawMessage) (interface{}, error) {
+	var args emailGetArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	properties, err := selectProperties(args.Properties, append(emailProperties, "bodyStructure"), emailProperties)
+	if err != nil {
+		return nil, err
+	}
+	partProperties, err := selectProperties(args.BodyProperties, bodyPartProperties, bodyPartProperties[:len(bodyPartProperties)-1])
+	if err != nil {
+		return nil, err
+	}
+	if args.MaxBodyValueBytes < 0 {
+		return nil, methodError(errInvalidArguments, "maxBodyValueBytes must not be negative")
+	}
+
+	state, _, err := c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if args.IDs == nil {
+		items, total, err := c.server.messageRepo.ListByMailboxWithOptions(c.ctx, c.account.ID,
+			repository.MessageListOptions{Limit: MaxObjectsInGet})
+		if err != nil {
+			return nil, err
+		}
+		if total > MaxObjectsInGet {
+			return nil, methodError(errRequestTooLarge, "the account has more than %d emails, give ids", MaxObjectsInGet)
+		}
+		for _, item := range items {
+			ids = append(ids, formatID(item.ID))
+		}
+	} else {
+		ids = *args.IDs
+		if len(ids) > MaxObjectsInGet {
+			return nil, methodError(errRequestTooLarge, "at most %d ids are allowed", MaxObjectsInGet)
+		}
+	}
+
+	resp := getResponse{AccountID: args.AccountID, State: state, List: []map[string]interface{}{}, NotFound: []string{}}
+	for _, id := range ids {
+		message, err := c.message(parseID(id))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				resp.NotFound = append(resp.NotFound, id)
+				continue
+			}
+			return nil, err
+		}
+		email, err := c.email(message, properties, partProperties, &args)
+		if err != nil {
+			return nil, err
+		}
+		resp.List = append(resp.List, email)
+	}
+	return resp, nil
+}
+
+// email returns the selected properties of the Email object of a message
+func (c *call) email(message *models.Message, properties, partProperties map[string]bool, args *emailGetArgs) (map[string]interface{}, error) {
+	email := map[string]interface{}{"id": formatID(message.ID)}
+	set := func(property string, value func() interface{}) {
+		if properties[property] {
+			email[property] = value()
+		}
+	}
+
+	var source []byte
+	loadSource := func() error {
+		if source != nil {
+			return nil
+		}
+		var err error
+		source, err = services.MessageSource(c.server.fileStorage, c.account, message)
+		return err
+	}
+
+	set("blobId", func() interface{} { return "M" + formatID(message.ID) })
+	set("threadId", func() interface{} { return "T" + formatID(message.ID) })
+	if properties["mailboxIds"] {
+		folderID, err := c.mailboxOf(message)
+		if err != nil {
+			return nil, err
+		}
+		email["mailboxIds"] = map[string]bool{formatID(folderID): true}
+	}
+	set("keywords", func() interface{} { return keywords(message) })
+	if properties["size"] {
+		size := message.SizeBytes
+		if size <= 0 {
+			if err := loadSource(); err != nil {
+				return nil, err
+			}
+			size = int64(len(source))
+		}
+		email["size"] = size
+	}
+	set("receivedAt", func() interface{} { return formatDate(message.ReceivedAt) })
+	set("from", func() interface{} {
+		return []emailAddress{{Name: nullable(message.SenderName), Email: message.SenderEmail}}
+	})
+	set("subject", func() interface{} { return message.Subject })
+	set("preview", func() interface{} { return message.Snippet })
+	set("hasAttachment", func() interface{} {
+		for _, attachment := range message.Attachments {
+			if !attachment.Inline {
+				return true
+			}
+		}
+		return false
+	})
+
+	for property := range headerProperties {
+		if !properties[property] {
+			continue
+		}
+		if err := loadSource(); err != nil {
+			return nil, err
+		}
+		header := parseHeader(source)
+		for property := range headerProperties {
+			if properties[property] {
+				email[property] = headerValue(header, property)
+			}
+		}
+		break
+	}
+
+	parts := bodyParts(message)
+	textBody, htmlBody := parts.textBody(), parts.htmlBody()
+	set("textBody", func() interface{} { return parts.objects(textBody, partProperties) })
+	set("htmlBody", func() interface{} { return parts.objects(htmlBody, partProperties) })
+	set("attachments", func() interface{} { return parts.objects(parts.attachments, partProperties) })
+	set("bodyStructure", func() interface{} { return parts.structure(partProperties) })
+	set("bodyValues", func() interface{} {
+		values := map[string]bodyValue{}
+		if args.FetchTextBodyValues || args.FetchAllBodyValues {
+			parts.addValues(values, textBody, args.MaxBodyValueBytes)
+		}
+		if args.FetchHTMLBodyValues || args.FetchAllBodyValues {
+			parts.addValues(values, htmlBody, args.MaxBodyValueBytes)
+		}
+		return values
+	})
+	return email, nil
+}
+
+// mailboxOf returns the folder of a message; messages without one are in the Inbox
+func (c *call) mailboxOf(message *models.Message) (uint, error) {
+	if message.FolderID != nil {
+		return *message.FolderID, nil
+	}
+	inbox, err := c.inboxFolder()
+	if err != nil {
+		return 0, err
+	}
+	return inbox.ID, nil
+}
+
+// keywords returns the keywords of the flags set on a message
+func keywords(message *models.Message) map[string]bool {
+	result := map[string]bool{}
+	for _, flag := range message.Flags() {
+		for keyword, keywordFlag := range keywordFlags {
+			if keywordFlag == flag {
+				result[keyword] = true
+			}
+		}
+	}
+	return result
+}
+
+// emailAddress is an EmailAddress object
+type emailAddress struct {
+	Name  *string `json:"name"`
+	Email string  `json:"email"`
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// formatDate formats a UTCDate
+func formatDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// parseHeader returns the header of a message source; an unparsable header is empty
+func parseHeader(source []byte) mail.Header {
+	msg, err := mail.ReadMessage(bytes.NewReader(source))
+	if err != nil {
+		return mail.Header{}
+	}
+	return msg.Header
+}
+
+// headerValue returns an Email property parsed from the header, or nil when the
+// header field is missing or malformed
+func headerValue(header mail.Header, property string) interface{} {
+	switch property {
+	case "messageId":
+		return messageIDs(header.Get("Message-ID"))
+	case "inReplyTo":
+		return messageIDs(header.Get("In-Reply-To"))
+	case "references":
+		return messageIDs(header.Get("References"))
+	case "sentAt":
+		date, err := header.Date()
+		if err != nil {
+			return nil
+		}
+		return date.Format(time.RFC3339)
+	}
+
+	field := map[string]string{"sender": "Sender", "to": "To", "cc": "Cc", "bcc": "Bcc", "replyTo": "Reply-To"}[property]
+	list, err := header.AddressList(field)
+	if err != nil {
+		return nil
+	}
+	addresses := make([]emailAddress, len(list))
+	for i, address := range list {
+		addresses[i] = emailAddress{Name: nullable(address.Name), Email: address.Address}
+	}
+	return addresses
+}
+
+// messageIDs parses a list of message identifiers without their angle brackets
+func messageIDs(value string) []string {
+	var ids []string
+	for _, field := range strings.Fields(value) {
+		id := strings.TrimSuffix(strings.TrimPrefix(field, "<"), ">")
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// bodyPart is a leaf of the body of a stored message: its text, its HTML or an
+// attachment
+type bodyPart struct {
+	id          string
+	blobID      string
+	contentType string
+	charset     string
+	size        int64
+	name        string
+	disposition string
+	cid         string
+	value       string
+}
+
+// messageParts are the body parts of a stored message
+type messageParts struct {
+	text        *bodyPart
+	html        *bodyPart
+	attachments []*bodyPart
+}
+
+func bodyParts(message *models.Message) *messageParts {
+	parts := &messageParts{}
+	id := formatID(message.ID)
+	if message.BodyText != "" {
+		parts.text = &bodyPart{id: "text", blobID: "P" + id, contentType: "text/plain", charset: "utf-8",
+			size: int64(len(message.BodyText)), value: message.BodyText}
+	}
+	if message.BodyHTML != "" {
+		parts.html = &bodyPart{id: "html", blobID: "H" + id, contentType: "text/html", charset: "utf-8",
+			size: int64(len(message.BodyHTML)), value: message.BodyHTML}
+	}
+	for _, attachment := range message.Attachments {
+		disposition := "attachment"
+		if attachment.Inline {
+			disposition = "inline"
+		}
+		parts.attachments = append(parts.attachments, &bodyPart{
+			id:          "a" + formatID(attachment.ID),
+			blobID:      "A" + id + "_" + formatID(attachment.ID),
+			contentType: attachment.ContentType,
+			size:        attachment.SizeBytes,
+			name:        attachment.Filename,
+			disposition: disposition,
+			cid:         strings.TrimSuffix(strings.TrimPrefix(attachment.ContentID, "<"), ">"),
+		})
+	}
+	return parts
+}
+
+// textBody lists the text part, or the HTML part when there is no text
+func (p *messageParts) textBody() []*bodyPart {
+	if p.text != nil {
+		return []*bodyPart{p.text}
+	}
+	if p.html != nil {
+		return []*bodyPart{p.html}
+	}
+	return nil
+}
+
+// htmlBody lists the HTML part, or the text part when there is no HTML
+func (p *messageParts) htmlBody() []*bodyPart {
+	if p.html != nil {
+		return []*bodyPart{p.html}
+	}
+	return p.textBody()
+}
+
+// objects returns the EmailBodyPart objects of parts
+func (p *messageParts) objects(parts []*bodyPart, properties map[string]bool) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0, len(parts))
+	for _, part := range parts {
+		objects = append(objects, part.object(properties))
+	}
+	return objects
+}
+
+// structure returns the bodyStructure: the alternative of text and HTML, mixed
+// with the attachments
+func (p *messageParts) structure(properties map[string]bool) map[string]interface{} {
+	var body []map[string]interface{}
+	if p.text != nil {
+		body = append(body, p.text.object(properties))
+	}
+	if p.html != nil {
+		body = append(body, p.html.object(properties))
+	}
+	if len(body) > 1 {
+		body = []map[string]interface{}{multipart("multipart/alternative", body, properties)}
+	}
+	if len(p.attachments) == 0 && len(body) == 1 {
+		return body[0]
+	}
+	return multipart("multipart/mixed", append(body, p.objects(p.attachments, properties)...), properties)
+}
+
+// addValues adds the EmailBodyValue objects of text parts, truncated to
+// maxBytes when it is positive
+func (p *messageParts) addValues(values map[string]bodyValue, parts []*bodyPart, maxBytes int) {
+	for _, part := range parts {
+		value := bodyValue{Value: part.value}
+		if maxBytes > 0 && len(value.Value) > maxBytes {
+			end := maxBytes
+			for end > 0 && !utf8.RuneStart(value.Value[end]) {
+				end--
+			}
+			value.Value, value.IsTruncated = value.Value[:end], true
+		}
+		values[part.id] = value
+	}
+}
+
+// bodyValue is an EmailBodyValue object
+type bodyValue struct {
+	Value             string `json:"value"`
+	IsEncodingProblem bool   `json:"isEncodingProblem"`
+	IsTruncated       bool   `json:"isTruncated"`
+}
+
+// object returns the selected properties of the EmailBodyPart object of a leaf
+func (part *bodyPart) object(properties map[string]bool) map[string]interface{} {
+	var name, charset, disposition, cid interface{}
+	if part.name != "" {
+		name = part.name
+	}
+	if part.charset != "" {
+		charset = part.charset
+	}
+	if part.disposition != "" {
+		disposition = part.disposition
+	}
+	if part.cid != "" {
+		cid = part.cid
+	}
+	object := map[string]interface{}{
+		"partId":      part.id,
+		"blobId":      part.blobID,
+		"size":        part.size,
+		"name":        name,
+		"type":        part.contentType,
+		"charset":     charset,
+		"disposition": disposition,
+		"cid":         cid,
+		"language":    nil,
+		"location":    nil,
+	}
+	return selectPartProperties(object, properties)
+}
+
+// multipart returns the EmailBodyPart object of a multipart holding subParts
+func multipart(contentType string, subParts []map[string]interface{}, properties map[string]bool) map[string]interface{} {
+	object := map[string]interface{}{
+		"partId":      nil,
+		"blobId":      nil,
+		"size":        0,
+		"name":        nil,
+		"type":        contentType,
+		"charset":     nil,
+		"disposition": nil,
+		"cid":         nil,
+		"language":    nil,
+		"location":    nil,
+		"subParts":    subParts,
+	}
+	return selectPartProperties(object, properties)
+}
+
+// selectPartProperties keeps the selected properties of a body part; subParts is
+// always kept so the structure can be walked
+func selectPartProperties(object map[string]interface{}, properties map[string]bool) map[string]interface{} {
+	for property := range object {
+		if !properties[property] && property != "subParts" {
+			delete(object, property)
+		}
+	}
+	return object
+}
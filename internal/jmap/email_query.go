@@ -0,0 +1,391 @@
+package jmap
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+)
+
+// filterCondition is an Email FilterCondition, or a FilterOperator when Operator
+// is set. Only the AND operator is supported.
+type filterCondition struct {
+	Operator   string             `json:"operator"`
+	Conditions []*filterCondition `json:"conditions"`
+
+	InMailbox     string     `json:"inMailbox"`
+	Text          string     `json:"text"`
+	From          string     `json:"from"`
+	Subject       string     `json:"subject"`
+	Before        *time.Time `json:"before"`
+	After         *time.Time `json:"after"`
+	MinSize       *int64     `json:"minSize"`
+	MaxSize       *int64     `json:"maxSize"`
+	HasAttachment *bool      `json:"hasAttachment"`
+	HasKeyword    string     `json:"hasKeyword"`
+	NotKeyword    string     `json:"notKeyword"`
+}
+
+type comparator struct {
+	Property    string `json:"property"`
+	IsAscending *bool  `json:"isAscending"`
+	Collation   string `json:"collation"`
+}
+
+type queryArgs struct {
+	accountArgs
+	Filter          *filterCondition `json:"filter"`
+	Sort            []comparator     `json:"sort"`
+	Position        int              `json:"position"`
+	Anchor          *string          `json:"anchor"`
+	AnchorOffset    int              `json:"anchorOffset"`
+	Limit           *int             `json:"limit"`
+	CalculateTotal  bool             `json:"calculateTotal"`
+	CollapseThreads bool             `json:"collapseThreads"`
+}
+
+type queryResponse struct {
+	AccountID           string   `json:"accountId"`
+	QueryState          string   `json:"queryState"`
+	CanCalculateChanges bool     `json:"canCalculateChanges"`
+	Position            int      `json:"position"`
+	IDs                 []string `json:"ids"`
+	Total               *int64   `json:"total,omitempty"`
+	Limit               *int     `json:"limit,omitempty"`
+}
+
+// sortFields maps the supported sort properties to message list sort fields
+var sortFields = map[string]repository.MessageSortField{
+	"receivedAt": repository.SortByReceivedAt,
+	"size":       repository.SortBySize,
+	"from":       repository.SortBySender,
+	"subject":    repository.SortBySubject,
+}
+
+// emailQuery implements Email/query on top of the message list. Every Email is
+// its own Thread, so collapseThreads changes nothing.
+func emailQuery(c *call, raw json.RawMessage) (interface{}, error) {
+	var args queryArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Anchor != nil {
+		return nil, methodError(errInvalidArguments, "anchor is not supported, use position")
+	}
+
+	opts := repository.MessageListOptions{Sort: repository.SortByReceivedAt}
+	if len(args.Sort) > 1 {
+		return nil, methodError(errUnsupportedSort, "only one sort property is supported")
+	}
+	for _, sort := range args.Sort {
+		field, ok := sortFields[sort.Property]
+		if !ok {
+			return nil, methodError(errUnsupportedSort, "cannot sort by %q", sort.Property)
+		}
+		opts.Sort = field
+		opts.Ascending = sort.IsAscending == nil || *sort.IsAscending
+	}
+	if args.Filter != nil {
+		if err := c.applyFilter(&opts, args.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := defaultQueryLimit
+	if args.Limit != nil {
+		if *args.Limit < 0 {
+			return nil, methodError(errInvalidArguments, "limit must not be negative")
+		}
+		limit = *args.Limit
+	}
+	resp := queryResponse{AccountID: args.AccountID, IDs: []string{}}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+		resp.Limit = &limit
+	}
+
+	state, _, err := c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+	resp.QueryState = state
+
+	position := args.Position
+	if position < 0 {
+		opts.Limit = 0
+		_, total, err := c.server.messageRepo.ListByMailboxWithOptions(c.ctx, c.account.ID, opts)
+		if err != nil {
+			return nil, err
+		}
+		position += int(total)
+		if position < 0 {
+			position = 0
+		}
+	}
+	opts.Limit, opts.Offset = limit, position
+
+	items, total, err := c.server.messageRepo.ListByMailboxWithOptions(c.ctx, c.account.ID, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		resp.IDs = append(resp.IDs, formatID(item.ID))
+	}
+	resp.Position = position
+	if int64(position) > total {
+		resp.Position = int(total)
+	}
+	if args.CalculateTotal {
+		resp.Total = &total
+	}
+	return resp, nil
+}
+
+// applyFilter narrows the message list options by a filter. Conditions that can
+// never match leave an empty ID list.
+func (c *call) applyFilter(opts *repository.MessageListOptions, filter *filterCondition) error {
+	if filter.Operator != "" {
+		if filter.Operator != "AND" {
+			return methodError(errUnsupportedFilter, "only the AND operator is supported")
+		}
+		for _, condition := range filter.Conditions {
+			if condition == nil {
+				continue
+			}
+			if err := c.applyFilter(opts, condition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	none := func() { opts.IDs = []uint{} }
+	setBool := func(field **bool, value bool) {
+		if *field != nil && **field != value {
+			none()
+		}
+		*field = &value
+	}
+
+	if filter.InMailbox != "" {
+		folderID := parseID(filter.InMailbox)
+		folder, err := c.server.folderRepo.GetByID(c.ctx, folderID)
+		if err != nil || folder.MailboxID != c.account.ID || (opts.FolderID != 0 && opts.FolderID != folderID) {
+			none()
+		}
+		opts.FolderID = folderID
+	}
+	if filter.Text != "" {
+		if err := c.applyText(opts, filter.Text); err != nil {
+			return err
+		}
+	}
+	if filter.From != "" {
+		if opts.Sender != "" && !strings.EqualFold(opts.Sender, filter.From) {
+			return methodError(errUnsupportedFilter, "only one from condition is supported")
+		}
+		opts.Sender = filter.From
+	}
+	if filter.Subject != "" {
+		if opts.Subject != "" && !strings.EqualFold(opts.Subject, filter.Subject) {
+			return methodError(errUnsupportedFilter, "only one subject condition is supported")
+		}
+		opts.Subject = filter.Subject
+	}
+	if filter.Before != nil && (opts.To.IsZero() || filter.Before.Before(opts.To)) {
+		opts.To = *filter.Before
+	}
+	if filter.After != nil && filter.After.After(opts.From) {
+		opts.From = *filter.After
+	}
+	if filter.MinSize != nil && *filter.MinSize > opts.MinSize {
+		opts.MinSize = *filter.MinSize
+	}
+	if filter.MaxSize != nil {
+		// maxSize is exclusive and the list bound is inclusive
+		if *filter.MaxSize <= 1 {
+			none()
+		} else if opts.MaxSize == 0 || *filter.MaxSize-1 < opts.MaxSize {
+			opts.MaxSize = *filter.MaxSize - 1
+		}
+	}
+	if filter.HasAttachment != nil {
+		setBool(&opts.HasAttachments, *filter.HasAttachment)
+	}
+
+	for _, k := range []struct {
+		keyword string
+		has     bool
+	}{{filter.HasKeyword, true}, {filter.NotKeyword, false}} {
+		keyword, has := k.keyword, k.has
+		switch strings.ToLower(keyword) {
+		case "":
+		case "$seen":
+			setBool(&opts.Unread, !has)
+		case "$flagged":
+			setBool(&opts.Flagged, has)
+		case "$answered", "$draft":
+			return methodError(errUnsupportedFilter, "cannot filter by %s", keyword)
+		default:
+			// Other keywords are never set
+			if has {
+				none()
+			}
+		}
+	}
+	return nil
+}
+
+// applyText keeps the messages matching a search query
+func (c *call) applyText(opts *repository.MessageListOptions, text string) error {
+	query, err := search.Parse(text)
+	if err != nil {
+		return methodError(errUnsupportedFilter, "invalid text filter: %v", err)
+	}
+
+	var matches []uint
+	var after uint
+	for len(matches) < maxTextMatches {
+		ids, err := c.server.messageRepo.SearchIDs(c.ctx, query, repository.SearchScope{MailboxID: c.account.ID}, after, 1000)
+		if err != nil {
+			return err
+		}
+		matches = append(matches, ids...)
+		if len(ids) < 1000 {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+
+	if opts.IDs != nil {
+		keep := make(map[uint]bool, len(opts.IDs))
+		for _, id := range opts.IDs {
+			keep[id] = true
+		}
+		intersection := []uint{}
+		for _, id := range matches {
+			if keep[id] {
+				intersection = append(intersection, id)
+			}
+		}
+		matches = intersection
+	}
+	if matches == nil {
+		matches = []uint{}
+	}
+	opts.IDs = matches
+	return nil
+}
+
+// emailQueryChanges implements Email/queryChanges. Query results are not
+// tracked, so clients rerun the query.
+func emailQueryChanges(c *call, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		accountArgs
+		Filter          json.RawMessage `json:"filter"`
+		Sort            json.RawMessage `json:"sort"`
+		SinceQueryState string          `json:"sinceQueryState"`
+		MaxChanges      *int            `json:"maxChanges"`
+		UpToID          *string         `json:"upToId"`
+		CalculateTotal  bool            `json:"calculateTotal"`
+		CollapseThreads bool            `json:"collapseThreads"`
+	}
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	return nil, methodError(errCannotCalculateChanges, "query changes are not tracked, rerun the query")
+}
+
+// emailChanges implements Email/changes from the message change log
+func emailChanges(c *call, raw json.RawMessage) (interface{}, error) {
+	var args changesArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	maxChanges := defaultMaxChanges
+	if args.MaxChanges != nil {
+		if *args.MaxChanges <= 0 {
+			return nil, methodError(errInvalidArguments, "maxChanges must be positive")
+		}
+		if *args.MaxChanges < maxChanges {
+			maxChanges = *args.MaxChanges
+		}
+	}
+
+	since, ok := parseState(args.SinceState)
+	if !ok {
+		return nil, methodError(errCannotCalculateChanges, "unknown state %q", args.SinceState)
+	}
+	// The latest Seq is read first so changes committed meanwhile are left for the next call
+	latest, err := c.server.changeRepo.LatestSeq(c.ctx, c.account.ID)
+	if err != nil {
+		return nil, err
+	}
+	oldest, err := c.server.changeRepo.OldestSeq(c.ctx, c.account.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Seqs have no gaps and pruning keeps the newest changes, so the changes after
+	// since are all kept when the oldest one kept directly follows it
+	if since > latest || (since < latest && (oldest == 0 || since+1 < oldest)) {
+		return nil, methodError(errCannotCalculateChanges, "state %q is no longer available", args.SinceState)
+	}
+
+	changes, err := c.server.changeRepo.ListSince(c.ctx, c.account.ID, since, maxChanges+1)
+	if err != nil {
+		return nil, err
+	}
+	for i, change := range changes {
+		if change.Seq > latest {
+			changes = changes[:i]
+			break
+		}
+	}
+
+	resp := changesResponse{
+		AccountID: args.AccountID,
+		OldState:  args.SinceState,
+		NewState:  formatID(latest),
+		Created:   []string{},
+		Updated:   []string{},
+		Destroyed: []string{},
+	}
+	if len(changes) > maxChanges {
+		changes = changes[:maxChanges]
+		resp.HasMoreChanges = true
+		resp.NewState = formatID(changes[len(changes)-1].Seq)
+	}
+
+	// A message counts as created or destroyed by whether it existed before the
+	// first and after the last of its changes
+	type span struct {
+		first, last models.MessageChangeKind
+	}
+	var order []uint
+	spans := make(map[uint]*span)
+	for _, change := range changes {
+		s, ok := spans[change.MessageID]
+		if !ok {
+			s = &span{first: change.Kind}
+			spans[change.MessageID] = s
+			order = append(order, change.MessageID)
+		}
+		s.last = change.Kind
+	}
+	for _, id := range order {
+		existedBefore := spans[id].first != models.MessageCreated
+		existsNow := spans[id].last != models.MessageDestroyed
+		switch {
+		case existedBefore && existsNow:
+			resp.Updated = append(resp.Updated, formatID(id))
+		case existedBefore:
+			resp.Destroyed = append(resp.Destroyed, formatID(id))
+		case existsNow:
+			resp.Created = append(resp.Created, formatID(id))
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,227 @@
+package jmap
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+type setArgs struct {
+	accountArgs
+	IfInState *string                               `json:"ifInState"`
+	Create    map[string]json.RawMessage            `json:"create"`
+	Update    map[string]map[string]json.RawMessage `json:"update"`
+	Destroy   []string                              `json:"destroy"`
+}
+
+type setResponse struct {
+	AccountID    string                 `json:"accountId"`
+	OldState     string                 `json:"oldState"`
+	NewState     string                 `json:"newState"`
+	Created      map[string]interface{} `json:"created"`
+	Updated      map[string]interface{} `json:"updated"`
+	Destroyed    []string               `json:"destroyed"`
+	NotCreated   map[string]*SetError   `json:"notCreated"`
+	NotUpdated   map[string]*SetError   `json:"notUpdated"`
+	NotDestroyed map[string]*SetError   `json:"notDestroyed"`
+}
+
+// emailSet implements Email/set. Keywords and the Mailbox of an Email can be
+// updated and Emails destroyed; Emails arrive by SMTP and cannot be created.
+func emailSet(c *call, raw json.RawMessage) (interface{}, error) {
+	var args setArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if len(args.Create)+len(args.Update)+len(args.Destroy) > MaxObjectsInSet {
+		return nil, methodError(errRequestTooLarge, "at most %d objects can be changed", MaxObjectsInSet)
+	}
+
+	oldState, _, err := c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+	if args.IfInState != nil && *args.IfInState != oldState {
+		return nil, methodError(errStateMismatch, "state is %q", oldState)
+	}
+
+	resp := setResponse{AccountID: args.AccountID, OldState: oldState}
+	for id := range args.Create {
+		if resp.NotCreated == nil {
+			resp.NotCreated = map[string]*SetError{}
+		}
+		resp.NotCreated[id] = &SetError{Type: setErrForbidden, Description: "emails cannot be created"}
+	}
+
+	for id, patch := range args.Update {
+		setErr, err := c.updateEmail(id, patch)
+		if err != nil {
+			return nil, err
+		}
+		if setErr != nil {
+			if resp.NotUpdated == nil {
+				resp.NotUpdated = map[string]*SetError{}
+			}
+			resp.NotUpdated[id] = setErr
+			continue
+		}
+		if resp.Updated == nil {
+			resp.Updated = map[string]interface{}{}
+		}
+		resp.Updated[id] = nil
+	}
+
+	for _, id := range args.Destroy {
+		err := c.destroyEmail(id)
+		if errors.Is(err, repository.ErrNotFound) {
+			if resp.NotDestroyed == nil {
+				resp.NotDestroyed = map[string]*SetError{}
+			}
+			resp.NotDestroyed[id] = &SetError{Type: setErrNotFound}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Destroyed = append(resp.Destroyed, id)
+	}
+
+	resp.NewState, _, err = c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// updateEmail applies a patch to the keywords and Mailbox of an Email. A rejected
+// patch is returned as a SetError.
+func (c *call) updateEmail(id string, patch map[string]json.RawMessage) (*SetError, error) {
+	message, err := c.message(parseID(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		return &SetError{Type: setErrNotFound}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	current, err := c.mailboxOf(message)
+	if err != nil {
+		return nil, err
+	}
+
+	oldKeywords := keywords(message)
+	newKeywords := keywords(message)
+	mailboxes := map[string]bool{formatID(current): true}
+	for path, value := range patch {
+		var ok bool
+		switch {
+		case path == "keywords":
+			newKeywords, ok = decodeSet(value)
+		case strings.HasPrefix(path, "keywords/"):
+			ok = patchSet(newKeywords, strings.ToLower(unescapePointer(path[len("keywords/"):])), value)
+		case path == "mailboxIds":
+			mailboxes, ok = decodeSet(value)
+		case strings.HasPrefix(path, "mailboxIds/"):
+			ok = patchSet(mailboxes, unescapePointer(path[len("mailboxIds/"):]), value)
+		}
+		if !ok {
+			return invalidProperty(path, "only keywords and mailboxIds can be changed"), nil
+		}
+	}
+
+	set := make(map[string]bool, len(newKeywords))
+	for keyword := range newKeywords {
+		keyword = strings.ToLower(keyword)
+		if _, ok := keywordFlags[keyword]; !ok {
+			return invalidProperty("keywords", "only $seen, $flagged, $answered and $draft are supported"), nil
+		}
+		set[keyword] = true
+	}
+	flags := map[string]bool{}
+	for keyword, flag := range keywordFlags {
+		if set[keyword] != oldKeywords[keyword] {
+			flags[flag] = set[keyword]
+		}
+	}
+
+	if len(mailboxes) != 1 {
+		return invalidProperty("mailboxIds", "an email is in exactly one mailbox"), nil
+	}
+	var target *models.Folder
+	for mailboxID := range mailboxes {
+		folder, err := c.server.folderRepo.GetByID(c.ctx, parseID(mailboxID))
+		if err != nil || folder.MailboxID != c.account.ID {
+			return invalidProperty("mailboxIds", "unknown mailbox "+mailboxID), nil
+		}
+		target = folder
+	}
+
+	if len(flags) > 0 {
+		if err := c.server.messageRepo.SetFlags(c.ctx, message.ID, flags); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return &SetError{Type: setErrNotFound}, nil
+			}
+			return nil, err
+		}
+	}
+	if target.ID != current {
+		// Messages without a folder are in the Inbox
+		var folderID *uint
+		if target.Role != models.FolderRoleInbox {
+			folderID = &target.ID
+		}
+		if _, err := c.server.messageRepo.SetFolderByIDs(c.ctx, []uint{message.ID}, folderID); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// destroyEmail deletes a message of the account with its stored files
+func (c *call) destroyEmail(id string) error {
+	message, err := c.message(parseID(id))
+	if err != nil {
+		return err
+	}
+	return c.server.messageRepo.Delete(c.ctx, message.ID)
+}
+
+// decodeSet parses a set of ids or keywords given as an object with true values
+func decodeSet(value json.RawMessage) (map[string]bool, bool) {
+	var set map[string]bool
+	if err := json.Unmarshal(value, &set); err != nil {
+		return nil, false
+	}
+	result := make(map[string]bool, len(set))
+	for key, member := range set {
+		if !member {
+			return nil, false
+		}
+		result[key] = true
+	}
+	return result, true
+}
+
+// patchSet adds a member to a set for true and removes it for null
+func patchSet(set map[string]bool, key string, value json.RawMessage) bool {
+	switch strings.TrimSpace(string(value)) {
+	case "true":
+		set[key] = true
+	case "null":
+		delete(set, key)
+	default:
+		return false
+	}
+	return true
+}
+
+// unescapePointer decodes a JSON pointer token
+func unescapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+func invalidProperty(property, description string) *SetError {
+	return &SetError{Type: setErrInvalidProperties, Description: description, Properties: []string{property}}
+}
@@ -0,0 +1,159 @@
+// Package jmap implements the JMAP Core (RFC 8620) and Mail (RFC 8621) protocols
+// on top of the repositories. Every models.Mailbox is a JMAP account, its folders
+// are JMAP Mailboxes and its messages are Emails. HTTP routing and
+// authentication are left to the API handlers.
+package jmap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Capabilities supported by the server
+const (
+	CapabilityCore = "urn:ietf:params:jmap:core"
+	CapabilityMail = "urn:ietf:params:jmap:mail"
+)
+
+// Limits advertised in the session and enforced by Server
+const (
+	MaxSizeRequest        = 10 << 20
+	MaxCallsInRequest     = 16
+	MaxObjectsInGet       = 500
+	MaxObjectsInSet       = 500
+	maxQueryLimit         = 1000
+	defaultQueryLimit     = 256
+	defaultMaxChanges     = 256
+	maxTextMatches        = 10000
+	maxConcurrentRequests = 4
+)
+
+// Invocation is a method call or response: [name, arguments, method call id]
+type Invocation struct {
+	Name   string
+	Args   json.RawMessage
+	CallID string
+}
+
+// UnmarshalJSON parses the array form of an invocation
+func (i *Invocation) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil || len(parts) != 3 {
+		return errors.New("invocation must be an array of 3 elements")
+	}
+	if err := json.Unmarshal(parts[0], &i.Name); err != nil {
+		return errors.New("invocation name must be a string")
+	}
+	if err := json.Unmarshal(parts[2], &i.CallID); err != nil {
+		return errors.New("method call id must be a string")
+	}
+	i.Args = parts[1]
+	return nil
+}
+
+// MarshalJSON encodes the invocation in its array form
+func (i Invocation) MarshalJSON() ([]byte, error) {
+	args := i.Args
+	if args == nil {
+		args = json.RawMessage("{}")
+	}
+	return json.Marshal([]interface{}{i.Name, args, i.CallID})
+}
+
+// Request is the body of a call to the API endpoint
+type Request struct {
+	Using       []string          `json:"using"`
+	MethodCalls []Invocation      `json:"methodCalls"`
+	CreatedIDs  map[string]string `json:"createdIds,omitempty"`
+}
+
+// Response is the body returned by the API endpoint
+type Response struct {
+	MethodResponses []Invocation      `json:"methodResponses"`
+	CreatedIDs      map[string]string `json:"createdIds,omitempty"`
+	SessionState    string            `json:"sessionState"`
+}
+
+// Problem is a request-level error, returned as application/problem+json (RFC 7807)
+type Problem struct {
+	Type   string `json:"type"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Limit  string `json:"limit,omitempty"`
+}
+
+// Error implements error
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+// Request-level error types
+const (
+	ProblemUnknownCapability = "urn:ietf:params:jmap:error:unknownCapability"
+	ProblemNotJSON           = "urn:ietf:params:jmap:error:notJSON"
+	ProblemNotRequest        = "urn:ietf:params:jmap:error:notRequest"
+	ProblemLimit             = "urn:ietf:params:jmap:error:limit"
+)
+
+// MethodError is returned as an "error" method response
+type MethodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// Error implements error
+func (e *MethodError) Error() string {
+	if e.Description == "" {
+		return e.Type
+	}
+	return e.Type + ": " + e.Description
+}
+
+func methodError(errorType, format string, args ...interface{}) *MethodError {
+	return &MethodError{Type: errorType, Description: fmt.Sprintf(format, args...)}
+}
+
+// Method error types
+const (
+	errServerFail             = "serverFail"
+	errUnknownMethod          = "unknownMethod"
+	errInvalidArguments       = "invalidArguments"
+	errInvalidResultReference = "invalidResultReference"
+	errAccountNotFound        = "accountNotFound"
+	errRequestTooLarge        = "requestTooLarge"
+	errCannotCalculateChanges = "cannotCalculateChanges"
+	errStateMismatch          = "stateMismatch"
+	errUnsupportedFilter      = "unsupportedFilter"
+	errUnsupportedSort        = "unsupportedSort"
+	errAnchorNotFound         = "anchorNotFound"
+)
+
+// SetError explains why one object of a /set call was not changed
+type SetError struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties,omitempty"`
+}
+
+// Set error types
+const (
+	setErrForbidden         = "forbidden"
+	setErrNotFound          = "notFound"
+	setErrInvalidProperties = "invalidProperties"
+)
+
+// formatID returns the JMAP id of a database ID
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// parseID returns the database ID of a JMAP id, or 0 when it is not one of ours
+func parseID(id string) uint {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n == 0 || strconv.FormatUint(n, 10) != id {
+		return 0
+	}
+	return uint(n)
+}
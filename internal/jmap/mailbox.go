@@ -0,0 +1,246 @@
+package jmap
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// mailboxProperties are the properties of a Mailbox object
+var mailboxProperties = []string{
+	"id", "name", "parentId", "role", "sortOrder", "totalEmails", "unreadEmails",
+	"totalThreads", "unreadThreads", "myRights", "isSubscribed",
+}
+
+type getArgs struct {
+	accountArgs
+	IDs        *[]string `json:"ids"`
+	Properties []string  `json:"properties"`
+}
+
+type getResponse struct {
+	AccountID string                   `json:"accountId"`
+	State     string                   `json:"state"`
+	List      []map[string]interface{} `json:"list"`
+	NotFound  []string                 `json:"notFound"`
+}
+
+// mailboxGet implements Mailbox/get. Folders are the Mailboxes of the account and
+// each Email is its own Thread.
+func mailboxGet(c *call, raw json.RawMessage) (interface{}, error) {
+	var args getArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	properties, err := selectProperties(args.Properties, mailboxProperties, mailboxProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	email, _, err := c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := c.server.folderRepo.ListByMailbox(c.ctx, c.account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := getResponse{
+		AccountID: args.AccountID,
+		State:     mailboxState(email, folders),
+		List:      []map[string]interface{}{},
+		NotFound:  []string{},
+	}
+	byID := make(map[string]models.FolderWithCounts, len(folders))
+	order := make(map[uint]int, len(folders))
+	for i, folder := range folders {
+		byID[formatID(folder.ID)] = folder
+		order[folder.ID] = i
+	}
+
+	ids := make([]string, 0, len(folders))
+	if args.IDs == nil {
+		for _, folder := range folders {
+			ids = append(ids, formatID(folder.ID))
+		}
+	} else {
+		ids = *args.IDs
+	}
+	for _, id := range ids {
+		folder, ok := byID[id]
+		if !ok {
+			resp.NotFound = append(resp.NotFound, id)
+			continue
+		}
+		resp.List = append(resp.List, filterProperties(mailboxObject(folder, order[folder.ID]), properties))
+	}
+	return resp, nil
+}
+
+// mailboxObject returns the Mailbox object of a folder
+func mailboxObject(folder models.FolderWithCounts, sortOrder int) map[string]interface{} {
+	var role interface{}
+	if folder.Role != "" {
+		role = string(folder.Role)
+	}
+	return map[string]interface{}{
+		"id":            formatID(folder.ID),
+		"name":          folder.Name,
+		"parentId":      nil,
+		"role":          role,
+		"sortOrder":     sortOrder,
+		"totalEmails":   folder.MessageCount,
+		"unreadEmails":  folder.UnreadCount,
+		"totalThreads":  folder.MessageCount,
+		"unreadThreads": folder.UnreadCount,
+		"myRights": map[string]bool{
+			"mayReadItems":   true,
+			"mayAddItems":    true,
+			"mayRemoveItems": true,
+			"maySetSeen":     true,
+			"maySetKeywords": true,
+			"mayCreateChild": false,
+			"mayRename":      false,
+			"mayDelete":      false,
+			"maySubmit":      false,
+		},
+		"isSubscribed": true,
+	}
+}
+
+type changesArgs struct {
+	accountArgs
+	SinceState string `json:"sinceState"`
+	MaxChanges *int   `json:"maxChanges"`
+}
+
+type changesResponse struct {
+	AccountID      string   `json:"accountId"`
+	OldState       string   `json:"oldState"`
+	NewState       string   `json:"newState"`
+	HasMoreChanges bool     `json:"hasMoreChanges"`
+	Created        []string `json:"created"`
+	Updated        []string `json:"updated"`
+	Destroyed      []string `json:"destroyed"`
+}
+
+// mailboxChanges implements Mailbox/changes. Folder changes are not logged, so
+// only an unchanged state can be answered.
+func mailboxChanges(c *call, raw json.RawMessage) (interface{}, error) {
+	var args changesArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	email, _, err := c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := c.server.folderRepo.ListByMailbox(c.ctx, c.account.ID)
+	if err != nil {
+		return nil, err
+	}
+	state := mailboxState(email, folders)
+	if args.SinceState != state {
+		return nil, methodError(errCannotCalculateChanges, "mailbox changes are not tracked, refetch all mailboxes")
+	}
+	return changesResponse{
+		AccountID: args.AccountID,
+		OldState:  state,
+		NewState:  state,
+		Created:   []string{},
+		Updated:   []string{},
+		Destroyed: []string{},
+	}, nil
+}
+
+// threadGet implements Thread/get; each Email is a Thread of its own whose id is
+// the Email id prefixed with T
+func threadGet(c *call, raw json.RawMessage) (interface{}, error) {
+	var args getArgs
+	if err := c.decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	threadProperties := []string{"id", "emailIds"}
+	properties, err := selectProperties(args.Properties, threadProperties, threadProperties)
+	if err != nil {
+		return nil, err
+	}
+	if args.IDs == nil {
+		return nil, methodError(errRequestTooLarge, "ids must be given")
+	}
+	if len(*args.IDs) > MaxObjectsInGet {
+		return nil, methodError(errRequestTooLarge, "at most %d ids are allowed", MaxObjectsInGet)
+	}
+
+	state, _, err := c.server.emailState(c.ctx, c.account)
+	if err != nil {
+		return nil, err
+	}
+	resp := getResponse{AccountID: args.AccountID, State: state, List: []map[string]interface{}{}, NotFound: []string{}}
+	for _, id := range *args.IDs {
+		var messageID uint
+		if len(id) > 1 && id[0] == 'T' {
+			messageID = parseID(id[1:])
+		}
+		if _, err := c.message(messageID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				resp.NotFound = append(resp.NotFound, id)
+				continue
+			}
+			return nil, err
+		}
+		resp.List = append(resp.List, filterProperties(map[string]interface{}{
+			"id":       id,
+			"emailIds": []string{formatID(messageID)},
+		}, properties))
+	}
+	return resp, nil
+}
+
+// message returns a message of the account, or repository.ErrNotFound
+func (c *call) message(id uint) (*models.Message, error) {
+	if id == 0 {
+		return nil, repository.ErrNotFound
+	}
+	message, err := c.server.messageRepo.GetByID(c.ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if message.MailboxID != c.account.ID {
+		return nil, repository.ErrNotFound
+	}
+	return message, nil
+}
+
+// selectProperties validates requested properties; nil selects the defaults. The
+// id is always returned.
+func selectProperties(requested, known, defaults []string) (map[string]bool, error) {
+	if requested == nil {
+		requested = defaults
+	}
+	valid := make(map[string]bool, len(known))
+	for _, property := range known {
+		valid[property] = true
+	}
+	selected := map[string]bool{"id": true}
+	for _, property := range requested {
+		if !valid[property] {
+			return nil, methodError(errInvalidArguments, "unknown property %q", property)
+		}
+		selected[property] = true
+	}
+	return selected, nil
+}
+
+// filterProperties keeps the selected properties of an object
+func filterProperties(object map[string]interface{}, properties map[string]bool) map[string]interface{} {
+	for property := range object {
+		if !properties[property] {
+			delete(object, property)
+		}
+	}
+	return object
+}
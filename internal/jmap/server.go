@@ -0,0 +1,298 @@
+package jmap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// Server answers JMAP requests for an authenticated account
+type Server struct {
+	messageRepo repository.MessageRepository
+	folderRepo  repository.FolderRepository
+	changeRepo  repository.MessageChangeRepository
+	fileStorage storage.FileStorage
+	logger      *slog.Logger
+}
+
+// ServerConfig holds configuration for the JMAP server
+type ServerConfig struct {
+	MessageRepo repository.MessageRepository
+	FolderRepo  repository.FolderRepository
+	ChangeRepo  repository.MessageChangeRepository
+	FileStorage storage.FileStorage
+	Logger      *slog.Logger
+}
+
+// NewServer creates a new JMAP server
+func NewServer(cfg *ServerConfig) *Server {
+	return &Server{
+		messageRepo: cfg.MessageRepo,
+		folderRepo:  cfg.FolderRepo,
+		changeRepo:  cfg.ChangeRepo,
+		fileStorage: cfg.FileStorage,
+		logger:      cfg.Logger,
+	}
+}
+
+// method implements a JMAP method; it returns the response arguments or a
+// *MethodError
+type method struct {
+	capability string
+	run        func(c *call, args json.RawMessage) (interface{}, error)
+}
+
+var methods = map[string]method{
+	"Core/echo":          {CapabilityCore, echo},
+	"Mailbox/get":        {CapabilityMail, mailboxGet},
+	"Mailbox/changes":    {CapabilityMail, mailboxChanges},
+	"Thread/get":         {CapabilityMail, threadGet},
+	"Email/get":          {CapabilityMail, emailGet},
+	"Email/query":        {CapabilityMail, emailQuery},
+	"Email/queryChanges": {CapabilityMail, emailQueryChanges},
+	"Email/changes":      {CapabilityMail, emailChanges},
+	"Email/set":          {CapabilityMail, emailSet},
+}
+
+// call is the context of one method call
+type call struct {
+	ctx     context.Context
+	server  *Server
+	account *models.Mailbox
+	inbox   *models.Folder
+}
+
+// Handle runs the method calls of a request in order. Request-level errors are
+// returned as *Problem; method errors become "error" responses.
+func (s *Server) Handle(ctx context.Context, account *models.Mailbox, req *Request) (*Response, error) {
+	using := make(map[string]bool, len(req.Using))
+	for _, capability := range req.Using {
+		if capability != CapabilityCore && capability != CapabilityMail {
+			return nil, &Problem{Type: ProblemUnknownCapability, Status: http.StatusBadRequest,
+				Detail: fmt.Sprintf("unknown capability %q", capability)}
+		}
+		using[capability] = true
+	}
+	if len(req.MethodCalls) > MaxCallsInRequest {
+		return nil, &Problem{Type: ProblemLimit, Status: http.StatusBadRequest, Limit: "maxCallsInRequest",
+			Detail: fmt.Sprintf("at most %d method calls are allowed", MaxCallsInRequest)}
+	}
+
+	resp := &Response{
+		MethodResponses: make([]Invocation, 0, len(req.MethodCalls)),
+		CreatedIDs:      req.CreatedIDs,
+		SessionState:    sessionState(account),
+	}
+	c := &call{ctx: ctx, server: s, account: account}
+	for _, invocation := range req.MethodCalls {
+		result, err := c.run(invocation, using, resp.MethodResponses)
+		if err != nil {
+			var methodErr *MethodError
+			if !errors.As(err, &methodErr) {
+				if s.logger != nil {
+					s.logger.Error("JMAP method failed",
+						slog.String("method", invocation.Name),
+						slog.Uint64("mailbox_id", uint64(account.ID)),
+						slog.Any("error", err))
+				}
+				methodErr = &MethodError{Type: errServerFail}
+			}
+			result = methodErr
+			invocation.Name = "error"
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		resp.MethodResponses = append(resp.MethodResponses, Invocation{Name: invocation.Name, Args: data, CallID: invocation.CallID})
+	}
+	return resp, nil
+}
+
+// run resolves the result references of a call and runs its method
+func (c *call) run(invocation Invocation, using map[string]bool, previous []Invocation) (interface{}, error) {
+	m, ok := methods[invocation.Name]
+	if !ok || !using[m.capability] {
+		return nil, methodError(errUnknownMethod, "unknown method %q", invocation.Name)
+	}
+	args, err := resolveReferences(invocation.Args, previous)
+	if err != nil {
+		return nil, err
+	}
+	return m.run(c, args)
+}
+
+// decodeArgs parses the arguments of a call and checks its account
+func (c *call) decodeArgs(args json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return methodError(errInvalidArguments, "%v", err)
+	}
+	if a, ok := v.(interface{ account() string }); ok && a.account() != formatID(c.account.ID) {
+		return methodError(errAccountNotFound, "account %q not found", a.account())
+	}
+	return nil
+}
+
+// accountArgs is embedded in the arguments of every method that works on an account
+type accountArgs struct {
+	AccountID string `json:"accountId"`
+}
+
+func (a accountArgs) account() string {
+	return a.AccountID
+}
+
+// inboxFolder returns the Inbox of the account, which holds messages without a folder
+func (c *call) inboxFolder() (*models.Folder, error) {
+	if c.inbox == nil {
+		inbox, err := c.server.folderRepo.GetByRole(c.ctx, c.account.ID, models.FolderRoleInbox)
+		if err != nil {
+			return nil, err
+		}
+		c.inbox = inbox
+	}
+	return c.inbox, nil
+}
+
+// resultReference points into the response of a previous call (RFC 8620 section 3.7)
+type resultReference struct {
+	ResultOf string `json:"resultOf"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
+
+// resolveReferences replaces the arguments prefixed with # by the values they refer to
+func resolveReferences(args json.RawMessage, previous []Invocation) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(args, &fields); err != nil || fields == nil {
+		return nil, methodError(errInvalidArguments, "arguments must be an object")
+	}
+
+	resolved := false
+	for key, raw := range fields {
+		if !strings.HasPrefix(key, "#") {
+			continue
+		}
+		name := key[1:]
+		if _, ok := fields[name]; ok {
+			return nil, methodError(errInvalidArguments, "both %q and %q are given", name, key)
+		}
+		var ref resultReference
+		if err := json.Unmarshal(raw, &ref); err != nil {
+			return nil, methodError(errInvalidResultReference, "invalid result reference %q", key)
+		}
+		value, err := ref.resolve(previous)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		delete(fields, key)
+		fields[name] = data
+		resolved = true
+	}
+	if !resolved {
+		return args, nil
+	}
+	return json.Marshal(fields)
+}
+
+// resolve evaluates the reference against the responses of previous calls
+func (r resultReference) resolve(previous []Invocation) (interface{}, error) {
+	for _, response := range previous {
+		if response.CallID != r.ResultOf {
+			continue
+		}
+		if response.Name != r.Name {
+			return nil, methodError(errInvalidResultReference, "call %q is not %s", r.ResultOf, r.Name)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(response.Args))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if r.Path == "" {
+			return value, nil
+		}
+		if !strings.HasPrefix(r.Path, "/") {
+			return nil, methodError(errInvalidResultReference, "invalid path %q", r.Path)
+		}
+		result, err := evaluatePointer(value, strings.Split(r.Path[1:], "/"))
+		if err != nil {
+			return nil, methodError(errInvalidResultReference, "path %q: %v", r.Path, err)
+		}
+		return result, nil
+	}
+	return nil, methodError(errInvalidResultReference, "no response for call %q", r.ResultOf)
+}
+
+// evaluatePointer evaluates a JSON pointer (RFC 6901) where * maps the rest of the
+// pointer over an array, flattening arrays it yields
+func evaluatePointer(value interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token := unescapePointer(tokens[0])
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		next, ok := v[token]
+		if !ok {
+			return nil, fmt.Errorf("no property %q", token)
+		}
+		return evaluatePointer(next, tokens[1:])
+	case []interface{}:
+		if token == "*" {
+			results := make([]interface{}, 0, len(v))
+			for _, item := range v {
+				result, err := evaluatePointer(item, tokens[1:])
+				if err != nil {
+					return nil, err
+				}
+				if items, ok := result.([]interface{}); ok {
+					results = append(results, items...)
+				} else {
+					results = append(results, result)
+				}
+			}
+			return results, nil
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("no array item %q", token)
+		}
+		return evaluatePointer(v[i], tokens[1:])
+	default:
+		return nil, fmt.Errorf("cannot descend into %q", token)
+	}
+}
+
+// echo implements Core/echo
+func echo(_ *call, args json.RawMessage) (interface{}, error) {
+	return args, nil
+}
+
+// sessionState identifies the session object of an account, which only changes
+// with the address of the account
+func sessionState(account *models.Mailbox) string {
+	sum := sha256.Sum256([]byte(formatID(account.ID) + ":" + account.FullAddress))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,451 @@
+package jmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// jmapFixture serves JMAP for a mailbox over an in-memory database and temp storage
+type jmapFixture struct {
+	fileStorage storage.FileStorage
+	messageRepo repository.MessageRepository
+	folderRepo  repository.FolderRepository
+	mailbox     *models.Mailbox
+	server      *Server
+}
+
+func newJMAPFixture(t *testing.T) *jmapFixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// Every connection of an in-memory database is a separate database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db.Exec("PRAGMA foreign_keys = ON")
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	fileStorage, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	domain := &models.Domain{Name: "jmap.test", IsActive: true}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("failed to create domain: %v", err)
+	}
+	mailbox := &models.Mailbox{LocalPart: "qa", DomainID: domain.ID, FullAddress: "qa@jmap.test"}
+	if err := db.Create(mailbox).Error; err != nil {
+		t.Fatalf("failed to create mailbox: %v", err)
+	}
+	folderRepo := repository.NewFolderRepository(db)
+	if err := folderRepo.EnsureSystemFolders(context.Background(), mailbox.ID); err != nil {
+		t.Fatalf("failed to create folders: %v", err)
+	}
+
+	messageRepo := repository.NewMessageRepositoryWithStorage(db, fileStorage)
+	return &jmapFixture{
+		fileStorage: fileStorage,
+		messageRepo: messageRepo,
+		folderRepo:  folderRepo,
+		mailbox:     mailbox,
+		server: NewServer(&ServerConfig{
+			MessageRepo: messageRepo,
+			FolderRepo:  folderRepo,
+			ChangeRepo:  repository.NewMessageChangeRepository(db),
+			FileStorage: fileStorage,
+		}),
+	}
+}
+
+// createMessage stores a message with its raw source in the Inbox
+func (f *jmapFixture) createMessage(t *testing.T, subject, body string, receivedAt time.Time) *models.Message {
+	t.Helper()
+	raw := "From: Sender <sender@example.com>\r\n" +
+		"To: " + f.mailbox.FullAddress + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Message-ID: <" + strings.ReplaceAll(subject, " ", "-") + "@example.com>\r\n" +
+		"\r\n" +
+		body
+	rawPath, err := f.fileStorage.Save("message.eml", strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to save raw source: %v", err)
+	}
+	message := &models.Message{
+		MailboxID:   f.mailbox.ID,
+		SenderEmail: "sender@example.com",
+		SenderName:  "Sender",
+		Subject:     subject,
+		Snippet:     body,
+		BodyText:    body,
+		RawPath:     rawPath,
+		SizeBytes:   int64(len(raw)),
+		ReceivedAt:  receivedAt,
+	}
+	if err := f.messageRepo.Create(context.Background(), message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return message
+}
+
+// folder returns the ID of a system folder as a JMAP id
+func (f *jmapFixture) folder(t *testing.T, role models.FolderRole) string {
+	t.Helper()
+	folder, err := f.folderRepo.GetByRole(context.Background(), f.mailbox.ID, role)
+	if err != nil {
+		t.Fatalf("failed to get %s folder: %v", role, err)
+	}
+	return formatID(folder.ID)
+}
+
+// call runs method calls given as a JSON array and returns the decoded responses
+func (f *jmapFixture) call(t *testing.T, methodCalls string) []response {
+	t.Helper()
+	var req Request
+	body := `{"using":["` + CapabilityCore + `","` + CapabilityMail + `"],"methodCalls":` + methodCalls + `}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	resp, err := f.server.Handle(context.Background(), f.mailbox, &req)
+	if err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	responses := make([]response, len(resp.MethodResponses))
+	for i, invocation := range resp.MethodResponses {
+		responses[i].name = invocation.Name
+		if err := json.Unmarshal(invocation.Args, &responses[i].args); err != nil {
+			t.Fatalf("invalid response arguments: %v", err)
+		}
+	}
+	return responses
+}
+
+// response is a decoded method response
+type response struct {
+	name string
+	args map[string]interface{}
+}
+
+// list returns the objects of a /get response
+func (r response) list(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	if r.name == "error" {
+		t.Fatalf("method failed: %v", r.args)
+	}
+	items, _ := r.args["list"].([]interface{})
+	objects := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		objects[i] = item.(map[string]interface{})
+	}
+	return objects
+}
+
+// strings returns a list of strings of the response arguments
+func (r response) strings(key string) []string {
+	items, _ := r.args[key].([]interface{})
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.(string))
+	}
+	return result
+}
+
+func TestMailboxGet(t *testing.T) {
+	f := newJMAPFixture(t)
+	f.createMessage(t, "one", "first", time.Now())
+
+	responses := f.call(t, `[["Mailbox/get",{"accountId":"`+formatID(f.mailbox.ID)+`","properties":["name","role","totalEmails","unreadEmails"]},"0"]]`)
+
+	mailboxes := responses[0].list(t)
+	if len(mailboxes) != len(models.SystemFolders) {
+		t.Fatalf("got %d mailboxes, want %d", len(mailboxes), len(models.SystemFolders))
+	}
+	inbox := mailboxes[0]
+	if inbox["role"] != "inbox" || inbox["totalEmails"] != float64(1) || inbox["unreadEmails"] != float64(1) {
+		t.Errorf("inbox = %v, want role inbox with 1 unread email", inbox)
+	}
+	if _, ok := inbox["myRights"]; ok {
+		t.Errorf("unrequested property myRights returned")
+	}
+	if responses[0].args["state"] == "" {
+		t.Errorf("state is empty")
+	}
+}
+
+func TestEmailQueryAndGetWithResultReference(t *testing.T) {
+	f := newJMAPFixture(t)
+	base := time.Now().Add(-time.Hour)
+	older := f.createMessage(t, "older report", "older body", base)
+	newer := f.createMessage(t, "newer report", "newer body", base.Add(time.Minute))
+	account := formatID(f.mailbox.ID)
+
+	responses := f.call(t, `[
+		["Email/query",{"accountId":"`+account+`","filter":{"inMailbox":"`+f.folder(t, models.FolderRoleInbox)+`"},
+			"sort":[{"property":"receivedAt","isAscending":false}],"calculateTotal":true},"q"],
+		["Email/get",{"accountId":"`+account+`","#ids":{"resultOf":"q","name":"Email/query","path":"/ids"},
+			"properties":["subject","mailboxIds","keywords","to","messageId","textBody","bodyValues"],
+			"fetchTextBodyValues":true},"g"]
+	]`)
+
+	if got, want := responses[0].strings("ids"), []string{formatID(newer.ID), formatID(older.ID)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("query ids = %v, want %v", got, want)
+	}
+	if responses[0].args["total"] != float64(2) {
+		t.Errorf("total = %v, want 2", responses[0].args["total"])
+	}
+
+	emails := responses[1].list(t)
+	if len(emails) != 2 {
+		t.Fatalf("got %d emails, want 2", len(emails))
+	}
+	email := emails[0]
+	if email["subject"] != "newer report" {
+		t.Errorf("subject = %v, want newer report", email["subject"])
+	}
+	if mailboxIDs := email["mailboxIds"].(map[string]interface{}); mailboxIDs[f.folder(t, models.FolderRoleInbox)] != true {
+		t.Errorf("mailboxIds = %v, want the inbox", mailboxIDs)
+	}
+	if to := email["to"].([]interface{}); to[0].(map[string]interface{})["email"] != f.mailbox.FullAddress {
+		t.Errorf("to = %v, want %s", to, f.mailbox.FullAddress)
+	}
+	if messageID := email["messageId"].([]interface{}); messageID[0] != "newer-report@example.com" {
+		t.Errorf("messageId = %v", messageID)
+	}
+	values := email["bodyValues"].(map[string]interface{})
+	if value := values["text"].(map[string]interface{}); value["value"] != "newer body" {
+		t.Errorf("text body value = %v, want newer body", value)
+	}
+}
+
+func TestEmailQueryFilters(t *testing.T) {
+	f := newJMAPFixture(t)
+	base := time.Now().Add(-time.Hour)
+	invoice := f.createMessage(t, "invoice", "pay", base)
+	f.createMessage(t, "newsletter", "read", base.Add(time.Minute))
+	if _, err := f.messageRepo.SetFlaggedByIDs(context.Background(), []uint{invoice.ID}, true); err != nil {
+		t.Fatal(err)
+	}
+	account := formatID(f.mailbox.ID)
+
+	tests := []struct {
+		name   string
+		filter string
+		want   []string
+	}{
+		{"subject", `{"subject":"invoice"}`, []string{formatID(invoice.ID)}},
+		{"keyword", `{"hasKeyword":"$flagged"}`, []string{formatID(invoice.ID)}},
+		{"conflicting keywords", `{"operator":"AND","conditions":[{"hasKeyword":"$seen"},{"notKeyword":"$seen"}]}`, []string{}},
+		{"unknown keyword", `{"hasKeyword":"$junk"}`, []string{}},
+		{"other mailbox", `{"inMailbox":"` + f.folder(t, models.FolderRoleTrash) + `"}`, []string{}},
+	}
+	for _, tt := range tests {
+		responses := f.call(t, `[["Email/query",{"accountId":"`+account+`","filter":`+tt.filter+`},"q"]]`)
+		if responses[0].name == "error" {
+			t.Errorf("%s: error %v", tt.name, responses[0].args)
+			continue
+		}
+		if got := responses[0].strings("ids"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ids = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	responses := f.call(t, `[["Email/query",{"accountId":"`+account+`","filter":{"operator":"OR","conditions":[]}},"q"]]`)
+	if responses[0].name != "error" || responses[0].args["type"] != errUnsupportedFilter {
+		t.Errorf("OR filter = %v, want unsupportedFilter", responses[0])
+	}
+}
+
+func TestEmailSetAndChanges(t *testing.T) {
+	f := newJMAPFixture(t)
+	kept := f.createMessage(t, "kept", "body", time.Now())
+	removed := f.createMessage(t, "removed", "body", time.Now())
+	account := formatID(f.mailbox.ID)
+	archive := f.folder(t, models.FolderRoleArchive)
+
+	state := f.call(t, `[["Email/get",{"accountId":"`+account+`","ids":[]},"s"]]`)[0].args["state"].(string)
+
+	responses := f.call(t, `[["Email/set",{"accountId":"`+account+`","ifInState":"`+state+`",
+		"create":{"new":{}},
+		"update":{"`+formatID(kept.ID)+`":{"keywords/$seen":true,"mailboxIds":{"`+archive+`":true}}},
+		"destroy":["`+formatID(removed.ID)+`","999999"]},"set"]]`)
+	set := responses[0].args
+	if _, ok := set["updated"].(map[string]interface{})[formatID(kept.ID)]; !ok {
+		t.Errorf("updated = %v, want the kept email", set["updated"])
+	}
+	if got := responses[0].strings("destroyed"); !reflect.DeepEqual(got, []string{formatID(removed.ID)}) {
+		t.Errorf("destroyed = %v", got)
+	}
+	if set["notCreated"].(map[string]interface{})["new"].(map[string]interface{})["type"] != setErrForbidden {
+		t.Errorf("notCreated = %v, want forbidden", set["notCreated"])
+	}
+	if set["notDestroyed"].(map[string]interface{})["999999"].(map[string]interface{})["type"] != setErrNotFound {
+		t.Errorf("notDestroyed = %v, want notFound", set["notDestroyed"])
+	}
+
+	message, err := f.messageRepo.GetByID(context.Background(), kept.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !message.IsRead || message.FolderID == nil || formatID(*message.FolderID) != archive {
+		t.Errorf("message = read %v folder %v, want read in the archive", message.IsRead, message.FolderID)
+	}
+
+	changes := f.call(t, `[["Email/changes",{"accountId":"`+account+`","sinceState":"`+state+`"},"c"]]`)[0]
+	if got := changes.strings("updated"); !reflect.DeepEqual(got, []string{formatID(kept.ID)}) {
+		t.Errorf("changes updated = %v, want the kept email", got)
+	}
+	if got := changes.strings("destroyed"); !reflect.DeepEqual(got, []string{formatID(removed.ID)}) {
+		t.Errorf("changes destroyed = %v, want the removed email", got)
+	}
+	if changes.args["newState"] != set["newState"] {
+		t.Errorf("newState = %v, want %v", changes.args["newState"], set["newState"])
+	}
+
+	stale := f.call(t, `[["Email/set",{"accountId":"`+account+`","ifInState":"`+state+`","destroy":[]},"set"]]`)[0]
+	if stale.name != "error" || stale.args["type"] != errStateMismatch {
+		t.Errorf("stale ifInState = %v, want stateMismatch", stale)
+	}
+}
+
+func TestEmailSetRejectsInvalidPatches(t *testing.T) {
+	f := newJMAPFixture(t)
+	message := f.createMessage(t, "subject", "body", time.Now())
+	account := formatID(f.mailbox.ID)
+	id := formatID(message.ID)
+
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"two mailboxes", `{"mailboxIds/` + f.folder(t, models.FolderRoleTrash) + `":true}`},
+		{"unknown mailbox", `{"mailboxIds":{"999999":true}}`},
+		{"custom keyword", `{"keywords/$important":true}`},
+		{"read-only property", `{"subject":"changed"}`},
+	}
+	for _, tt := range tests {
+		set := f.call(t, `[["Email/set",{"accountId":"`+account+`","update":{"`+id+`":`+tt.patch+`}},"set"]]`)[0]
+		notUpdated, _ := set.args["notUpdated"].(map[string]interface{})
+		if err, _ := notUpdated[id].(map[string]interface{}); err["type"] != setErrInvalidProperties {
+			t.Errorf("%s: notUpdated = %v, want invalidProperties", tt.name, set.args["notUpdated"])
+		}
+	}
+}
+
+func TestEmailChangesCreatedAndUnknownState(t *testing.T) {
+	f := newJMAPFixture(t)
+	account := formatID(f.mailbox.ID)
+	state := f.call(t, `[["Email/get",{"accountId":"`+account+`","ids":[]},"s"]]`)[0].args["state"].(string)
+
+	first := f.createMessage(t, "first", "body", time.Now())
+	second := f.createMessage(t, "second", "body", time.Now())
+
+	changes := f.call(t, `[["Email/changes",{"accountId":"`+account+`","sinceState":"`+state+`","maxChanges":1},"c"]]`)[0]
+	if got := changes.strings("created"); !reflect.DeepEqual(got, []string{formatID(first.ID)}) {
+		t.Errorf("created = %v, want the first email", got)
+	}
+	if changes.args["hasMoreChanges"] != true {
+		t.Errorf("hasMoreChanges = %v, want true", changes.args["hasMoreChanges"])
+	}
+
+	next := f.call(t, `[["Email/changes",{"accountId":"`+account+`","sinceState":"`+changes.args["newState"].(string)+`"},"c"]]`)[0]
+	if got := next.strings("created"); !reflect.DeepEqual(got, []string{formatID(second.ID)}) {
+		t.Errorf("created = %v, want the second email", got)
+	}
+
+	for _, since := range []string{"999999", "not-a-state"} {
+		result := f.call(t, `[["Email/changes",{"accountId":"`+account+`","sinceState":"`+since+`"},"c"]]`)[0]
+		if result.name != "error" || result.args["type"] != errCannotCalculateChanges {
+			t.Errorf("since %s = %v, want cannotCalculateChanges", since, result)
+		}
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	f := newJMAPFixture(t)
+
+	responses := f.call(t, `[
+		["Email/import",{},"a"],
+		["Mailbox/get",{"accountId":"other"},"b"],
+		["Email/get",{"accountId":"`+formatID(f.mailbox.ID)+`","#ids":{"resultOf":"missing","name":"Email/query","path":"/ids"}},"c"],
+		["Core/echo",{"hello":"world"},"d"]
+	]`)
+	for i, want := range []string{errUnknownMethod, errAccountNotFound, errInvalidResultReference} {
+		if responses[i].name != "error" || responses[i].args["type"] != want {
+			t.Errorf("response %d = %v, want %s", i, responses[i], want)
+		}
+	}
+	if responses[3].name != "Core/echo" || responses[3].args["hello"] != "world" {
+		t.Errorf("echo = %v", responses[3])
+	}
+
+	_, err := f.server.Handle(context.Background(), f.mailbox, &Request{Using: []string{"urn:example:unknown"}})
+	var problem *Problem
+	if !errors.As(err, &problem) || problem.Type != ProblemUnknownCapability {
+		t.Errorf("unknown capability error = %v, want %s", err, ProblemUnknownCapability)
+	}
+}
+
+func TestEvaluatePointer(t *testing.T) {
+	var value interface{}
+	json.Unmarshal([]byte(`{"list":[{"id":"1","emailIds":["a","b"]},{"id":"2","emailIds":["c"]}]}`), &value)
+
+	got, err := evaluatePointer(value, strings.Split("list/*/emailIds", "/"))
+	if err != nil {
+		t.Fatalf("evaluatePointer() error = %v", err)
+	}
+	if want := []interface{}{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("evaluatePointer() = %v, want %v", got, want)
+	}
+	if _, err := evaluatePointer(value, []string{"missing"}); err == nil {
+		t.Errorf("evaluatePointer() of a missing property succeeded")
+	}
+}
+
+func TestBlob(t *testing.T) {
+	f := newJMAPFixture(t)
+	message := f.createMessage(t, "source", "text body", time.Now())
+
+	blob, err := f.server.Blob(context.Background(), f.mailbox, "M"+formatID(message.ID))
+	if err != nil {
+		t.Fatalf("Blob() error = %v", err)
+	}
+	defer blob.Content.Close()
+	content, _ := io.ReadAll(blob.Content)
+	if blob.Type != "message/rfc822" || !strings.Contains(string(content), "Subject: source") {
+		t.Errorf("Blob() = %s %q, want the message source", blob.Type, content)
+	}
+
+	other := &models.Mailbox{ID: f.mailbox.ID + 1, FullAddress: "other@jmap.test"}
+	for _, blobID := range []string{"P" + formatID(message.ID) + "x", "H" + formatID(message.ID), "Z1", ""} {
+		if _, err := f.server.Blob(context.Background(), f.mailbox, blobID); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Blob(%q) error = %v, want ErrBlobNotFound", blobID, err)
+		}
+	}
+	if _, err := f.server.Blob(context.Background(), other, "M"+formatID(message.ID)); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Blob() of another account error = %v, want ErrBlobNotFound", err)
+	}
+}
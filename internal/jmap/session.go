@@ -0,0 +1,161 @@
+package jmap
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+)
+
+// Session is the session resource (RFC 8620 section 2)
+type Session struct {
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	Accounts        map[string]Account     `json:"accounts"`
+	PrimaryAccounts map[string]string      `json:"primaryAccounts"`
+	Username        string                 `json:"username"`
+	APIURL          string                 `json:"apiUrl"`
+	DownloadURL     string                 `json:"downloadUrl"`
+	UploadURL       string                 `json:"uploadUrl"`
+	EventSourceURL  string                 `json:"eventSourceUrl"`
+	State           string                 `json:"state"`
+}
+
+// Account is an account of the session
+type Account struct {
+	Name                string                 `json:"name"`
+	IsPersonal          bool                   `json:"isPersonal"`
+	IsReadOnly          bool                   `json:"isReadOnly"`
+	AccountCapabilities map[string]interface{} `json:"accountCapabilities"`
+}
+
+// SessionURLs are the endpoints of the session; download and event source URLs
+// are the URI templates of RFC 8620
+type SessionURLs struct {
+	API         string
+	Download    string
+	Upload      string
+	EventSource string
+}
+
+// Session returns the session resource of an account. Each mailbox address logs
+// in to its own session with the mailbox as its only account.
+func (s *Server) Session(account *models.Mailbox, urls SessionURLs) *Session {
+	accountID := formatID(account.ID)
+	return &Session{
+		Capabilities: map[string]interface{}{
+			CapabilityCore: map[string]interface{}{
+				"maxSizeUpload":         0,
+				"maxConcurrentUpload":   1,
+				"maxSizeRequest":        MaxSizeRequest,
+				"maxConcurrentRequests": maxConcurrentRequests,
+				"maxCallsInRequest":     MaxCallsInRequest,
+				"maxObjectsInGet":       MaxObjectsInGet,
+				"maxObjectsInSet":       MaxObjectsInSet,
+				"collationAlgorithms":   []string{"i;ascii-casemap"},
+			},
+			CapabilityMail: map[string]interface{}{},
+		},
+		Accounts: map[string]Account{
+			accountID: {
+				Name:       account.FullAddress,
+				IsPersonal: true,
+				AccountCapabilities: map[string]interface{}{
+					CapabilityCore: map[string]interface{}{},
+					CapabilityMail: map[string]interface{}{
+						"maxMailboxesPerEmail":       1,
+						"maxMailboxDepth":            1,
+						"maxSizeMailboxName":         100,
+						"maxSizeAttachmentsPerEmail": 0,
+						"emailQuerySortOptions":      []string{"receivedAt", "size", "from", "subject"},
+						"mayCreateTopLevelMailbox":   false,
+					},
+				},
+			},
+		},
+		PrimaryAccounts: map[string]string{
+			CapabilityCore: accountID,
+			CapabilityMail: accountID,
+		},
+		Username:       account.FullAddress,
+		APIURL:         urls.API,
+		DownloadURL:    urls.Download,
+		UploadURL:      urls.Upload,
+		EventSourceURL: urls.EventSource,
+		State:          sessionState(account),
+	}
+}
+
+// The Email and Thread state is the Seq of the latest message change of the
+// account, and the Mailbox state adds a hash of the folders. Seqs are numbered
+// per account in commit order, so a state only moves when the account changes
+// and every change up to it is visible.
+
+// emailState returns the current Email state of an account and the change Seq
+// it stands for
+func (s *Server) emailState(ctx context.Context, account *models.Mailbox) (string, uint, error) {
+	latest, err := s.changeRepo.LatestSeq(ctx, account.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	return formatID(latest), latest, nil
+}
+
+// parseState returns the change Seq of an Email state
+func parseState(state string) (uint, bool) {
+	n, err := strconv.ParseUint(state, 10, 64)
+	if err != nil || strconv.FormatUint(n, 10) != state {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// mailboxState returns the Mailbox state for an Email state and the folders of
+// the account
+func mailboxState(emailState string, folders []models.FolderWithCounts) string {
+	h := fnv.New64a()
+	for _, folder := range folders {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00", folder.ID, folder.Name, folder.Role)
+	}
+	return fmt.Sprintf("%s-%x", emailState, h.Sum64())
+}
+
+// StateChange is the object pushed when data of an account changes (RFC 8620
+// section 7.1)
+type StateChange struct {
+	Type    string                       `json:"@type"`
+	Changed map[string]map[string]string `json:"changed"`
+}
+
+// States returns the current state of each data type of an account and the
+// change Seq of its Email state, which HasChanges compares against
+func (s *Server) States(ctx context.Context, account *models.Mailbox) (map[string]string, uint, error) {
+	email, latest, err := s.emailState(ctx, account)
+	if err != nil {
+		return nil, 0, err
+	}
+	folders, err := s.folderRepo.ListByMailbox(ctx, account.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return map[string]string{
+		"Email":   email,
+		"Thread":  email,
+		"Mailbox": mailboxState(email, folders),
+	}, latest, nil
+}
+
+// HasChanges reports whether messages of an account changed after a change Seq
+// returned by States
+func (s *Server) HasChanges(ctx context.Context, account *models.Mailbox, since uint) (bool, error) {
+	return s.changeRepo.HasChangesSince(ctx, account.ID, since)
+}
+
+// NewStateChange returns the push object for the given states of an account
+func NewStateChange(account *models.Mailbox, states map[string]string) *StateChange {
+	return &StateChange{
+		Type:    "StateChange",
+		Changed: map[string]map[string]string{formatID(account.ID): states},
+	}
+}
@@ -0,0 +1,80 @@
+// Package mailauth issues and checks the credentials mail clients use to open a
+// mailbox over IMAP or POP3. Mailboxes have no stored password: each mailbox password is
+// derived from its address with a server secret, so it can be shown again at any
+// time and changes for every mailbox when the secret is rotated.
+package mailauth
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// MinSecretLength is the shortest accepted secret in bytes
+const MinSecretLength = 32
+
+// ErrSecretTooShort is returned for a secret shorter than MinSecretLength
+var ErrSecretTooShort = errors.New("mail access secret must be at least 32 bytes")
+
+// Authenticator derives and verifies per-mailbox passwords
+type Authenticator struct {
+	secret []byte
+	// masterToken, when set, is accepted as the password of every mailbox
+	masterToken string
+}
+
+// New creates an Authenticator. masterToken is optional; it lets operators open
+// any mailbox with one token, typically the API key.
+func New(secret []byte, masterToken string) (*Authenticator, error) {
+	if len(secret) < MinSecretLength {
+		return nil, ErrSecretTooShort
+	}
+	return &Authenticator{secret: secret, masterToken: masterToken}, nil
+}
+
+// Password returns the password of the mailbox with the given address
+func (a *Authenticator) Password(address string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte("mailbox:" + normalize(address)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether password opens the mailbox with the given address
+func (a *Authenticator) Verify(address, password string) bool {
+	if password == "" {
+		return false
+	}
+	if a.masterToken != "" && subtle.ConstantTimeCompare([]byte(password), []byte(a.masterToken)) == 1 {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(a.Password(address))) == 1
+}
+
+// VerifyDigest reports whether digest is the APOP digest (RFC 1939) of the
+// server timestamp and a password that opens the mailbox
+func (a *Authenticator) VerifyDigest(address, timestamp, digest string) bool {
+	digest = strings.ToLower(digest)
+	if digest == "" {
+		return false
+	}
+	if a.masterToken != "" && subtle.ConstantTimeCompare([]byte(digest), []byte(Digest(timestamp, a.masterToken))) == 1 {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(digest), []byte(Digest(timestamp, a.Password(address)))) == 1
+}
+
+// Digest returns the APOP digest of a server timestamp and a password
+func Digest(timestamp, password string) string {
+	sum := md5.Sum([]byte(timestamp + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalize makes addresses that differ only in case share a password
+func normalize(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
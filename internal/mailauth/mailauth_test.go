@@ -0,0 +1,112 @@
+package mailauth
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newAuthenticator(t *testing.T, masterToken string) *Authenticator {
+	t.Helper()
+	auth, err := New(bytes.Repeat([]byte{7}, MinSecretLength), masterToken)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return auth
+}
+
+func TestNew_RejectsShortSecret(t *testing.T) {
+	if _, err := New([]byte("short"), ""); !errors.Is(err, ErrSecretTooShort) {
+		t.Errorf("New() error = %v, want ErrSecretTooShort", err)
+	}
+}
+
+func TestPassword_PerMailbox(t *testing.T) {
+	auth := newAuthenticator(t, "")
+
+	alice := auth.Password("alice@example.com")
+	if alice == "" {
+		t.Fatal("Password() is empty")
+	}
+	if alice != auth.Password(" Alice@Example.com") {
+		t.Error("Password() differs by address case")
+	}
+	if alice == auth.Password("bob@example.com") {
+		t.Error("Password() is the same for two mailboxes")
+	}
+
+	other, err := New(bytes.Repeat([]byte{8}, MinSecretLength), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice == other.Password("alice@example.com") {
+		t.Error("Password() does not depend on the secret")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	auth := newAuthenticator(t, "master-token")
+	password := auth.Password("alice@example.com")
+
+	tests := []struct {
+		name     string
+		address  string
+		password string
+		want     bool
+	}{
+		{"mailbox password", "alice@example.com", password, true},
+		{"password of another mailbox", "bob@example.com", password, false},
+		{"master token", "bob@example.com", "master-token", true},
+		{"wrong password", "alice@example.com", "guess", false},
+		{"empty password", "alice@example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auth.Verify(tt.address, tt.password); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify_EmptyMasterTokenDisabled(t *testing.T) {
+	auth := newAuthenticator(t, "")
+	if auth.Verify("alice@example.com", "") {
+		t.Error("Verify() accepted an empty password")
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	auth := newAuthenticator(t, "master")
+	const timestamp = "<1896.697170952@example.com>"
+	password := auth.Password("alice@example.com")
+
+	tests := []struct {
+		name    string
+		address string
+		digest  string
+		want    bool
+	}{
+		{"mailbox password", "alice@example.com", Digest(timestamp, password), true},
+		{"upper case digest", "alice@example.com", strings.ToUpper(Digest(timestamp, password)), true},
+		{"master token", "bob@example.com", Digest(timestamp, "master"), true},
+		{"other mailbox", "bob@example.com", Digest(timestamp, password), false},
+		{"other timestamp", "alice@example.com", Digest("<1@example.com>", password), false},
+		{"empty digest", "alice@example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auth.VerifyDigest(tt.address, timestamp, tt.digest); got != tt.want {
+				t.Errorf("VerifyDigest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigest_RFC1939Example(t *testing.T) {
+	got := Digest("<1896.697170952@dbc.mtview.ca.us>", "tanstaaf")
+	if got != "c4c9334bac560ecc979e58001b3e22fb" {
+		t.Errorf("Digest() = %s", got)
+	}
+}
@@ -0,0 +1,102 @@
+package mailfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// Flag is a Maildir info flag (the letters after ":2,")
+type Flag byte
+
+// Maildir flags, see https://cr.yp.to/proto/maildir.html
+const (
+	FlagDraft   Flag = 'D'
+	FlagFlagged Flag = 'F'
+	FlagPassed  Flag = 'P'
+	FlagReplied Flag = 'R'
+	FlagSeen    Flag = 'S'
+	FlagTrashed Flag = 'T'
+)
+
+// MaildirWriter writes messages as a gzip-compressed tar of a Maildir
+type MaildirWriter struct {
+	root string
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+// NewMaildirWriter creates a MaildirWriter whose archive holds the Maildir in directory root
+func NewMaildirWriter(w io.Writer, root string) (*MaildirWriter, error) {
+	gz := gzip.NewWriter(w)
+	m := &MaildirWriter{root: root, gz: gz, tw: tar.NewWriter(gz)}
+
+	for _, dir := range []string{root, path.Join(root, "cur"), path.Join(root, "new"), path.Join(root, "tmp")} {
+		err := m.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir + "/",
+			Mode:     0o700,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WriteMessage adds a message. unique must be unique within the archive.
+// Messages without flags are delivered to new/; others go to cur/ with their flags
+// in the info suffix. Line endings are converted to LF.
+func (m *MaildirWriter) WriteMessage(unique string, date time.Time, flags []Flag, raw []byte) error {
+	name := fmt.Sprintf("%d.%s.infinimail", date.Unix(), unique)
+	dir := "new"
+	if len(flags) > 0 {
+		dir = "cur"
+		name += ":2," + flagString(flags)
+	}
+
+	var body bytes.Buffer
+	for _, line := range splitLines(raw) {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	err := m.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(m.root, dir, name),
+		Mode:     0o600,
+		Size:     int64(body.Len()),
+		ModTime:  date,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.tw.Write(body.Bytes())
+	return err
+}
+
+// Close finishes the archive; it does not close the underlying writer
+func (m *MaildirWriter) Close() error {
+	if err := m.tw.Close(); err != nil {
+		return err
+	}
+	return m.gz.Close()
+}
+
+// flagString returns flags in ASCII order without duplicates, as Maildir requires
+func flagString(flags []Flag) string {
+	letters := make([]byte, 0, len(flags))
+	for _, flag := range flags {
+		if bytes.IndexByte(letters, byte(flag)) < 0 {
+			letters = append(letters, byte(flag))
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+	return string(letters)
+}
@@ -0,0 +1,117 @@
+package mailfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDate = time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)
+
+func TestMboxWriter_QuotesFromLines(t *testing.T) {
+	var buf bytes.Buffer
+	mbox := NewMboxWriter(&buf)
+
+	raw := "Subject: one\r\n\r\nFrom here\r\n>From quoted\r\nnot From\r\n"
+	require.NoError(t, mbox.WriteMessage("alice@example.com", testDate, []byte(raw)))
+	require.NoError(t, mbox.WriteMessage("", testDate, []byte("Subject: two\n\nbody")))
+	require.NoError(t, mbox.Close())
+
+	expected := "From alice@example.com Tue Mar  5 08:30:00 2024\n" +
+		"Subject: one\n" +
+		"\n" +
+		">From here\n" +
+		">>From quoted\n" +
+		"not From\n" +
+		"\n" +
+		"From MAILER-DAEMON Tue Mar  5 08:30:00 2024\n" +
+		"Subject: two\n" +
+		"\n" +
+		"body\n" +
+		"\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestMboxReader_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	mbox := NewMboxWriter(&buf)
+	first := "Subject: one\r\n\r\nFrom here\r\n>From quoted\r\n"
+	second := "Subject: two\r\n\r\nbody\r\n"
+	require.NoError(t, mbox.WriteMessage("alice@example.com", testDate, []byte(first)))
+	require.NoError(t, mbox.WriteMessage("", testDate, []byte(second)))
+	require.NoError(t, mbox.Close())
+
+	reader := NewMboxReader(&buf, 0)
+	raw, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, first, string(raw))
+	raw, err = reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, second, string(raw))
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMboxReader_SkipsLargeMessages(t *testing.T) {
+	input := "preamble\n" +
+		"From a Tue Mar  5 08:30:00 2024\n" +
+		"Subject: big\n\n" + strings.Repeat("x", 100) + "\n\n" +
+		"From b Tue Mar  5 08:30:00 2024\n" +
+		"Subject: small\n"
+
+	reader := NewMboxReader(strings.NewReader(input), 50)
+	_, err := reader.Next()
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+	raw, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "Subject: small\r\n", string(raw))
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMboxReader_Empty(t *testing.T) {
+	_, err := NewMboxReader(strings.NewReader(""), 0).Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMaildirWriter_Layout(t *testing.T) {
+	var buf bytes.Buffer
+	maildir, err := NewMaildirWriter(&buf, "user@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, maildir.WriteMessage("1", testDate, nil, []byte("Subject: new\r\n\r\nhi\r\n")))
+	require.NoError(t, maildir.WriteMessage("2", testDate, []Flag{FlagSeen, FlagFlagged, FlagSeen}, []byte("Subject: read\r\n\r\nhi\r\n")))
+	require.NoError(t, maildir.Close())
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	files := make(map[string]string)
+	var dirs []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if header.Typeflag == tar.TypeDir {
+			dirs = append(dirs, header.Name)
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+
+	assert.Equal(t, []string{"user@example.com/", "user@example.com/cur/", "user@example.com/new/", "user@example.com/tmp/"}, dirs)
+	assert.Equal(t, "Subject: new\n\nhi\n", files["user@example.com/new/1709627400.1.infinimail"])
+	assert.Equal(t, "Subject: read\n\nhi\n", files["user@example.com/cur/1709627400.2.infinimail:2,FS"])
+}
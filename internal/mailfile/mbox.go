@@ -0,0 +1,169 @@
+// Package mailfile reads and writes messages in standard mailbox file formats.
+package mailfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"time"
+)
+
+// ErrMessageTooLarge is returned by MboxReader.Next for a message over the size limit
+var ErrMessageTooLarge = errors.New("message too large")
+
+// mboxDateLayout is the asctime date of mbox "From " separator lines
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// fromLineRegex matches body lines that mboxrd escapes with one more '>'
+var fromLineRegex = regexp.MustCompile(`^>*From `)
+
+// quotedFromLineRegex matches body lines escaped by mboxrd
+var quotedFromLineRegex = regexp.MustCompile(`^>+From `)
+
+// MboxWriter writes messages as an mboxrd file
+type MboxWriter struct {
+	w *bufio.Writer
+}
+
+// NewMboxWriter creates an MboxWriter writing to w
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteMessage appends a message. sender is the envelope sender for the separator line;
+// line endings are converted to LF and "From " lines are quoted as mboxrd requires.
+func (m *MboxWriter) WriteMessage(sender string, date time.Time, raw []byte) error {
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+	if _, err := m.w.WriteString("From " + sender + " " + date.UTC().Format(mboxDateLayout) + "\n"); err != nil {
+		return err
+	}
+
+	for _, line := range splitLines(raw) {
+		if fromLineRegex.Match(line) {
+			if err := m.w.WriteByte('>'); err != nil {
+				return err
+			}
+		}
+		if _, err := m.w.Write(line); err != nil {
+			return err
+		}
+		if err := m.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	// A blank line separates messages
+	if err := m.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return m.w.Flush()
+}
+
+// Close flushes buffered output; it does not close the underlying writer
+func (m *MboxWriter) Close() error {
+	return m.w.Flush()
+}
+
+// splitLines splits raw into lines without their CRLF or LF terminators
+func splitLines(raw []byte) [][]byte {
+	raw = bytes.TrimRight(raw, "\r\n")
+	if len(raw) == 0 {
+		return nil
+	}
+	lines := bytes.Split(raw, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimSuffix(line, []byte("\r"))
+	}
+	return lines
+}
+
+// MboxReader reads messages from an mbox file. Quoted "From " lines are
+// unquoted as mboxrd describes, and line endings are converted to CRLF.
+type MboxReader struct {
+	r       *bufio.Reader
+	maxSize int
+	started bool
+	done    bool
+}
+
+// NewMboxReader creates an MboxReader reading from r; messages larger than
+// maxSize bytes are skipped with ErrMessageTooLarge, 0 means no limit
+func NewMboxReader(r io.Reader, maxSize int) *MboxReader {
+	return &MboxReader{r: bufio.NewReader(r), maxSize: maxSize}
+}
+
+// Next returns the raw source of the next message, or io.EOF after the last one.
+// After ErrMessageTooLarge the reader continues with the following message.
+func (m *MboxReader) Next() ([]byte, error) {
+	if m.done {
+		return nil, io.EOF
+	}
+
+	// Anything before the first separator line is not part of a message
+	for !m.started {
+		line, err := m.r.ReadBytes('\n')
+		if isSeparatorLine(line) {
+			m.started = true
+			break
+		}
+		if err == io.EOF {
+			m.done = true
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	tooLarge := false
+	empty := true
+	for {
+		line, err := m.r.ReadBytes('\n')
+		if isSeparatorLine(line) {
+			break
+		}
+		if len(line) > 0 {
+			empty = false
+			line = bytes.TrimRight(line, "\r\n")
+			if quotedFromLineRegex.Match(line) {
+				line = line[1:]
+			}
+			if m.maxSize > 0 && buf.Len()+len(line)+2 > m.maxSize {
+				tooLarge = true
+				buf.Reset()
+			}
+			if !tooLarge {
+				buf.Write(line)
+				buf.WriteString("\r\n")
+			}
+		}
+		if err == io.EOF {
+			m.done = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tooLarge {
+		return nil, ErrMessageTooLarge
+	}
+	if empty && m.done {
+		return nil, io.EOF
+	}
+
+	// The blank line before the next separator belongs to the mbox, not the message
+	raw := bytes.TrimRight(buf.Bytes(), "\r\n")
+	return append(raw, '\r', '\n'), nil
+}
+
+// isSeparatorLine reports whether line starts a new message
+func isSeparatorLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
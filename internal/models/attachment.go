@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Attachment represents a file attached to an email message
 type Attachment struct {
 	ID          uint   `gorm:"primaryKey" json:"id"`
@@ -8,6 +10,10 @@ type Attachment struct {
 	ContentType string `gorm:"size:100" json:"content_type"`
 	FilePath    string `gorm:"size:500" json:"file_path"`
 	SizeBytes   int64  `json:"size_bytes"`
+	HasPreview  bool   `gorm:"default:false" json:"has_preview"`
+	PreviewPath string `gorm:"size:500" json:"-"`
+	ContentID   string `gorm:"size:255" json:"content_id,omitempty"`
+	Inline      bool   `gorm:"default:false" json:"inline"`
 
 	// Relationships
 	Message Message `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE" json:"-"`
@@ -17,3 +23,9 @@ type Attachment struct {
 func (Attachment) TableName() string {
 	return "attachments"
 }
+
+// MailboxAttachment is an attachment together with the receive time of its message
+type MailboxAttachment struct {
+	Attachment `gorm:"embedded"`
+	ReceivedAt time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// DataKey stores the wrapped data key of an encrypted attachment file.
+// Keys live outside the file so master key rotation never rewrites file contents.
+type DataKey struct {
+	FilePath    string    `gorm:"primaryKey;size:500" json:"file_path"`
+	MasterKeyID string    `gorm:"not null;size:32;index" json:"master_key_id"`
+	WrappedKey  []byte    `gorm:"not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for DataKey
+func (DataKey) TableName() string {
+	return "data_keys"
+}
@@ -34,6 +34,9 @@ type Domain struct {
 	Status       DomainStatus `gorm:"type:varchar(50);default:'pending_dns'" json:"status"`
 	DNSChallenge string       `gorm:"size:255" json:"dns_challenge,omitempty"`
 	ErrorMessage string       `gorm:"size:1000" json:"error_message,omitempty"`
+	// TenantID is the tenant owning the domain and its mailboxes (nil = only
+	// visible to super-admins)
+	TenantID *uint `gorm:"index" json:"tenant_id,omitempty"`
 
 	// ACME Challenge fields for Manual DNS Verification flow
 	ACMEChallengeToken     string     `gorm:"size:255" json:"acme_challenge_token,omitempty"`
@@ -41,6 +44,10 @@ type Domain struct {
 	ACMEChallengeExpiresAt *time.Time `json:"acme_challenge_expires_at,omitempty"`
 	ACMEDNSVerified        bool       `gorm:"default:false" json:"acme_dns_verified"`
 
+	// Retention policy overrides (nil = use server default, 0 = keep forever)
+	MessageRetentionHours *int `json:"message_retention_hours,omitempty"`
+	MailboxRetentionDays  *int `json:"mailbox_retention_days,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// EventPayload holds a WebSocket event that is too large for a Postgres
+// notification; the notification carries its ID instead
+type EventPayload struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Data      []byte    `gorm:"not null" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName returns the table name for EventPayload
+func (EventPayload) TableName() string {
+	return "event_payloads"
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// FolderRole marks a system folder; custom folders have no role
+type FolderRole string
+
+const (
+	FolderRoleInbox   FolderRole = "inbox"
+	FolderRoleArchive FolderRole = "archive"
+	FolderRoleJunk    FolderRole = "junk"
+	FolderRoleTrash   FolderRole = "trash"
+)
+
+// SystemFolders are created in every mailbox, in display order
+var SystemFolders = []Folder{
+	{Name: "Inbox", Role: FolderRoleInbox},
+	{Name: "Archive", Role: FolderRoleArchive},
+	{Name: "Junk", Role: FolderRoleJunk},
+	{Name: "Trash", Role: FolderRoleTrash},
+}
+
+// Folder groups the messages of a mailbox. Messages without a folder are in the Inbox.
+type Folder struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	MailboxID uint       `gorm:"not null;uniqueIndex:idx_folders_mailbox_name,priority:1" json:"mailbox_id"`
+	Name      string     `gorm:"not null;size:100;uniqueIndex:idx_folders_mailbox_name,priority:2" json:"name"`
+	Role      FolderRole `gorm:"size:20" json:"role,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	Mailbox Mailbox `gorm:"foreignKey:MailboxID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName returns the table name for Folder
+func (Folder) TableName() string {
+	return "folders"
+}
+
+// IsSystem reports whether the folder is one of SystemFolders
+func (f Folder) IsSystem() bool {
+	return f.Role != ""
+}
+
+// FolderWithCounts is used for API responses that include message counts
+type FolderWithCounts struct {
+	Folder
+	MessageCount int64 `json:"message_count"`
+	UnreadCount  int64 `json:"unread_count"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultLabelColor is used for labels created without a color
+const DefaultLabelColor = "#9e9e9e"
+
+// Label is a user-defined tag of a mailbox; a message can have many labels
+type Label struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MailboxID uint      `gorm:"not null;uniqueIndex:idx_labels_mailbox_name,priority:1" json:"mailbox_id"`
+	Name      string    `gorm:"not null;size:100;uniqueIndex:idx_labels_mailbox_name,priority:2" json:"name"`
+	Color     string    `gorm:"not null;size:7" json:"color"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	Mailbox Mailbox `gorm:"foreignKey:MailboxID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName returns the table name for Label
+func (Label) TableName() string {
+	return "labels"
+}
+
+// MessageLabel assigns a label to a message
+type MessageLabel struct {
+	MessageID uint `gorm:"primaryKey;autoIncrement:false"`
+	LabelID   uint `gorm:"primaryKey;autoIncrement:false;index"`
+
+	Message Message `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE"`
+	Label   Label   `gorm:"foreignKey:LabelID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName returns the table name for MessageLabel
+func (MessageLabel) TableName() string {
+	return "message_labels"
+}
@@ -4,7 +4,9 @@ import (
 	"time"
 )
 
-// Mailbox represents an email address within a domain
+// Mailbox represents an email address within a domain. ChangeSeq is the Seq
+// of the latest message change of the mailbox, and UIDNext the IMAP UID its next
+// stored or moved message gets.
 type Mailbox struct {
 	ID             uint       `gorm:"primaryKey" json:"id"`
 	LocalPart      string     `gorm:"not null;size:255" json:"local_part"`
@@ -12,6 +14,8 @@ type Mailbox struct {
 	FullAddress    string     `gorm:"uniqueIndex;not null;size:255" json:"full_address"`
 	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	ChangeSeq      uint       `gorm:"not null;default:0" json:"-"`
+	UIDNext        uint       `gorm:"not null;default:1" json:"-"`
 
 	// Relationships
 	Domain   Domain    `gorm:"foreignKey:DomainID;constraint:OnDelete:CASCADE" json:"-"`
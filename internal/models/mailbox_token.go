@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// MailboxToken is a bearer token that gives an end user access to one mailbox.
+// Only the SHA-256 hash of the token is stored.
+type MailboxToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	MailboxID uint       `gorm:"not null;index" json:"mailbox_id"`
+	Name      string     `gorm:"size:100" json:"name,omitempty"`
+	TokenHash string     `gorm:"uniqueIndex;not null;size:64" json:"-"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	Mailbox Mailbox `gorm:"foreignKey:MailboxID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName returns the table name for MailboxToken
+func (MailboxToken) TableName() string {
+	return "mailbox_tokens"
+}
+
+// IsExpired reports whether the token expired at the given time
+func (t *MailboxToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
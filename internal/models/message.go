@@ -1,25 +1,40 @@
 package models
 
 import (
+	"strings"
 	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"gorm.io/gorm"
 )
 
 // Message represents an email message received by a mailbox
 type Message struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	MailboxID   uint      `gorm:"not null;index" json:"mailbox_id"`
+	MailboxID   uint      `gorm:"not null;index;index:idx_messages_mailbox_received,priority:1;index:idx_messages_mailbox_uid,priority:1" json:"mailbox_id"`
 	SenderEmail string    `gorm:"not null;size:255" json:"sender_email"`
 	SenderName  string    `gorm:"size:255" json:"sender_name,omitempty"`
 	Subject     string    `json:"subject,omitempty"`
 	Snippet     string    `gorm:"size:255" json:"snippet,omitempty"`
-	BodyText    string    `json:"body_text,omitempty"`
-	BodyHTML    string    `json:"body_html,omitempty"`
+	BodyText    string    `gorm:"serializer:encrypted" json:"body_text,omitempty"`
+	BodyHTML    string    `gorm:"serializer:encrypted" json:"body_html,omitempty"`
 	IsRead      bool      `gorm:"default:false" json:"is_read"`
-	ReceivedAt  time.Time `gorm:"autoCreateTime" json:"received_at"`
+	IsFlagged   bool      `gorm:"default:false" json:"is_flagged"`
+	IsAnswered  bool      `gorm:"default:false" json:"is_answered"`
+	IsDeleted   bool      `gorm:"default:false" json:"is_deleted"`
+	IsDraft     bool      `gorm:"default:false" json:"is_draft"`
+	FolderID    *uint     `gorm:"index" json:"folder_id,omitempty"`
+	RawPath     string    `gorm:"size:500" json:"-"`
+	SizeBytes   int64     `gorm:"default:0" json:"size_bytes"`
+	ReceivedAt  time.Time `gorm:"autoCreateTime;index:idx_messages_mailbox_received,priority:2" json:"received_at"`
+	UID         uint      `gorm:"not null;default:0;index:idx_messages_mailbox_uid,priority:2" json:"-"`
 
 	// Relationships
 	Mailbox     Mailbox      `gorm:"foreignKey:MailboxID;constraint:OnDelete:CASCADE" json:"-"`
 	Attachments []Attachment `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE" json:"attachments,omitempty"`
+
+	// pendingBodies holds the bodies left out of an insert until the row has an ID
+	pendingBodies *[2]string
 }
 
 // TableName returns the table name for Message
@@ -27,6 +42,74 @@ func (Message) TableName() string {
 	return "messages"
 }
 
+// BeforeCreate leaves encrypted bodies out of the insert, since they are bound
+// to the ID of their row and a new row does not have one yet
+func (m *Message) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == 0 && encryption.ColumnsEncrypted() && (m.BodyText != "" || m.BodyHTML != "") {
+		m.pendingBodies = &[2]string{m.BodyText, m.BodyHTML}
+		m.BodyText, m.BodyHTML = "", ""
+	}
+	return nil
+}
+
+// AfterCreate writes the bodies left out by BeforeCreate now that the row has an ID
+func (m *Message) AfterCreate(tx *gorm.DB) error {
+	if m.pendingBodies == nil {
+		return nil
+	}
+	m.BodyText, m.BodyHTML = m.pendingBodies[0], m.pendingBodies[1]
+	m.pendingBodies = nil
+	return tx.Model(m).Select("body_text", "body_html").Updates(m).Error
+}
+
+// IMAP system flags of a message
+const (
+	FlagSeen     = `\Seen`
+	FlagFlagged  = `\Flagged`
+	FlagAnswered = `\Answered`
+	FlagDeleted  = `\Deleted`
+	FlagDraft    = `\Draft`
+)
+
+// flagColumns maps each system flag to its column
+var flagColumns = map[string]string{
+	FlagSeen:     "is_read",
+	FlagFlagged:  "is_flagged",
+	FlagAnswered: "is_answered",
+	FlagDeleted:  "is_deleted",
+	FlagDraft:    "is_draft",
+}
+
+// FlagColumn returns the column storing a system flag; flag names are case-insensitive
+func FlagColumn(flag string) (string, bool) {
+	for name, column := range flagColumns {
+		if strings.EqualFold(name, flag) {
+			return column, true
+		}
+	}
+	return "", false
+}
+
+// Flags returns the system flags set on the message
+func (m *Message) Flags() []string {
+	flags := make([]string, 0, len(flagColumns))
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{FlagSeen, m.IsRead},
+		{FlagFlagged, m.IsFlagged},
+		{FlagAnswered, m.IsAnswered},
+		{FlagDeleted, m.IsDeleted},
+		{FlagDraft, m.IsDraft},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
 // MessageListItem is a lightweight version for list views
 type MessageListItem struct {
 	ID              uint      `json:"id"`
@@ -36,6 +119,44 @@ type MessageListItem struct {
 	Subject         string    `json:"subject,omitempty"`
 	Snippet         string    `json:"snippet,omitempty"`
 	IsRead          bool      `json:"is_read"`
+	IsFlagged       bool      `json:"is_flagged"`
+	IsAnswered      bool      `json:"is_answered"`
+	IsDeleted       bool      `json:"is_deleted"`
+	IsDraft         bool      `json:"is_draft"`
+	FolderID        *uint     `json:"folder_id,omitempty"`
+	SizeBytes       int64     `json:"size_bytes"`
 	ReceivedAt      time.Time `json:"received_at"`
 	AttachmentCount int       `json:"attachment_count"`
+	UID             uint      `json:"-"`
+}
+
+// StoredMessageBody holds the body columns of a message exactly as stored,
+// bypassing column decryption; it is used to re-wrap encrypted bodies
+type StoredMessageBody struct {
+	ID       uint
+	BodyText string
+	BodyHTML string
+}
+
+// MessageSearchIndex holds the full-text search document of a message. Bodies
+// may be encrypted at rest, so the document is computed from the plaintext when
+// the message is stored; its lexemes are not encrypted.
+type MessageSearchIndex struct {
+	MessageID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Document  string `gorm:"type:tsvector;not null;index:idx_message_search_document,type:gin"`
+
+	Message Message `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE"`
+}
+
+// TableName returns the table name for MessageSearchIndex
+func (MessageSearchIndex) TableName() string {
+	return "message_search_index"
+}
+
+// MessageSearchHit is a message matched by a search
+type MessageSearchHit struct {
+	Message
+	MailboxAddress string
+	// Rank is the full-text relevance, 0 when the search had no text terms
+	Rank float64
 }
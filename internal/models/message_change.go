@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// MessageChangeKind tells what happened to a message
+type MessageChangeKind string
+
+const (
+	MessageCreated   MessageChangeKind = "created"
+	MessageUpdated   MessageChangeKind = "updated"
+	MessageDestroyed MessageChangeKind = "destroyed"
+)
+
+// MessageChange records a change to a message of a mailbox. Seq numbers the
+// changes of each mailbox in commit order, so the latest Seq of a mailbox is a
+// state clients can ask for changes since.
+type MessageChange struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	MailboxID uint              `gorm:"not null;index:idx_message_changes_mailbox,priority:1;index:idx_message_changes_seq,priority:1" json:"mailbox_id"`
+	Seq       uint              `gorm:"not null;default:0;index:idx_message_changes_seq,priority:2" json:"seq"`
+	MessageID uint              `gorm:"not null;index:idx_message_changes_mailbox,priority:2" json:"message_id"`
+	Kind      MessageChangeKind `gorm:"not null;size:16" json:"kind"`
+	CreatedAt time.Time         `gorm:"autoCreateTime;index" json:"created_at"`
+
+	// Relationships
+	Mailbox Mailbox `gorm:"foreignKey:MailboxID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName returns the table name for MessageChange
+func (MessageChange) TableName() string {
+	return "message_changes"
+}
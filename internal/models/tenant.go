@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// Tenant is a team sharing the deployment. It owns domains, and through them
+// mailboxes and messages, and only sees its own.
+type Tenant struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"uniqueIndex;not null;size:100" json:"name"`
+
+	// Limits on what the tenant can own (0 = unlimited)
+	MaxDomains   int `gorm:"not null;default:0" json:"max_domains"`
+	MaxMailboxes int `gorm:"not null;default:0" json:"max_mailboxes"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName returns the table name for Tenant
+func (Tenant) TableName() string {
+	return "tenants"
+}
+
+// APIKeyRole is the role an API key grants
+type APIKeyRole string
+
+const (
+	// RoleSuperAdmin sees every tenant and manages tenants and the server
+	RoleSuperAdmin APIKeyRole = "super_admin"
+	// RoleTenant only sees the domains of its tenant
+	RoleTenant APIKeyRole = "tenant"
+)
+
+// APIKey is an API key stored in the database, next to the API_KEY of the
+// configuration, which always is a super-admin key. Only the SHA-256 hash of
+// the key is stored.
+type APIKey struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	TenantID *uint      `gorm:"index" json:"tenant_id,omitempty"`
+	Role     APIKeyRole `gorm:"type:varchar(20);not null" json:"role"`
+	Name     string     `gorm:"size:100" json:"name,omitempty"`
+	KeyHash  string     `gorm:"uniqueIndex;not null;size:64" json:"-"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName returns the table name for APIKey
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// TenantUsage counts what a tenant owns, to compare with its limits
+type TenantUsage struct {
+	Domains   int64 `json:"domains"`
+	Mailboxes int64 `json:"mailboxes"`
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// domainRepository publishes transitions of the setup status of domains
+type domainRepository struct {
+	repository.DomainRepository
+	publisher Publisher
+}
+
+// NewDomainRepository wraps a DomainRepository to publish status transitions
+func NewDomainRepository(repo repository.DomainRepository, publisher Publisher) repository.DomainRepository {
+	return &domainRepository{DomainRepository: repo, publisher: publisher}
+}
+
+// Update saves a domain
+func (r *domainRepository) Update(ctx context.Context, domain *models.Domain) error {
+	previous, err := r.DomainRepository.GetByID(ctx, domain.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.DomainRepository.Update(ctx, domain); err != nil {
+		return err
+	}
+	if previous.Status != domain.Status {
+		r.publisher.BroadcastDomainStatusChanged(&websocket.DomainStatusPayload{
+			ID:             domain.ID,
+			Name:           domain.Name,
+			PreviousStatus: string(previous.Status),
+			Status:         string(domain.Status),
+			IsActive:       domain.IsActive,
+			ErrorMessage:   domain.ErrorMessage,
+		})
+	}
+	return nil
+}
+
+// certificateRepository publishes issued and renewed certificates
+type certificateRepository struct {
+	repository.CertificateRepository
+	publisher Publisher
+}
+
+// NewCertificateRepository wraps a CertificateRepository to publish issued and
+// renewed certificates
+func NewCertificateRepository(repo repository.CertificateRepository, publisher Publisher) repository.CertificateRepository {
+	return &certificateRepository{CertificateRepository: repo, publisher: publisher}
+}
+
+// Create saves the first certificate of a domain
+func (r *certificateRepository) Create(ctx context.Context, cert *models.DomainCertificate) error {
+	if err := r.CertificateRepository.Create(ctx, cert); err != nil {
+		return err
+	}
+	r.publisher.BroadcastCertificateIssued(certificatePayload(cert))
+	return nil
+}
+
+// Update saves a certificate; a new issue time means it was renewed
+func (r *certificateRepository) Update(ctx context.Context, cert *models.DomainCertificate) error {
+	previous, err := r.CertificateRepository.GetByID(ctx, cert.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.CertificateRepository.Update(ctx, cert); err != nil {
+		return err
+	}
+	if !previous.IssuedAt.Equal(cert.IssuedAt) {
+		r.publisher.BroadcastCertificateRenewed(certificatePayload(cert))
+	}
+	return nil
+}
+
+func certificatePayload(cert *models.DomainCertificate) *websocket.CertificatePayload {
+	return &websocket.CertificatePayload{
+		DomainID:   cert.DomainID,
+		DomainName: cert.DomainName,
+		IssuedAt:   formatTime(cert.IssuedAt),
+		ExpiresAt:  formatTime(cert.ExpiresAt),
+	}
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// mailboxRepository publishes created and deleted mailboxes
+type mailboxRepository struct {
+	repository.MailboxRepository
+	publisher Publisher
+}
+
+// NewMailboxRepository wraps a MailboxRepository to publish its changes
+func NewMailboxRepository(repo repository.MailboxRepository, publisher Publisher) repository.MailboxRepository {
+	return &mailboxRepository{MailboxRepository: repo, publisher: publisher}
+}
+
+// Create creates a mailbox
+func (r *mailboxRepository) Create(ctx context.Context, mailbox *models.Mailbox) error {
+	if err := r.MailboxRepository.Create(ctx, mailbox); err != nil {
+		return err
+	}
+	r.publisher.BroadcastMailboxCreated(mailboxPayload(mailbox))
+	return nil
+}
+
+// GetOrCreate returns the mailbox of an address, creating it when it is missing
+func (r *mailboxRepository) GetOrCreate(ctx context.Context, localPart string, domainID uint, domainName string) (*models.Mailbox, bool, error) {
+	mailbox, created, err := r.MailboxRepository.GetOrCreate(ctx, localPart, domainID, domainName)
+	if err == nil && created {
+		r.publisher.BroadcastMailboxCreated(mailboxPayload(mailbox))
+	}
+	return mailbox, created, err
+}
+
+// Delete deletes a mailbox with its messages
+func (r *mailboxRepository) Delete(ctx context.Context, id uint) error {
+	mailbox, err := r.MailboxRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.MailboxRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.publisher.BroadcastMailboxDeleted(mailboxPayload(mailbox))
+	return nil
+}
+
+// DeleteByIDs deletes mailboxes with their messages
+func (r *mailboxRepository) DeleteByIDs(ctx context.Context, ids []uint) ([]string, error) {
+	mailboxes := make([]*models.Mailbox, 0, len(ids))
+	for _, id := range ids {
+		// Mailboxes that are already gone are not deleted again
+		if mailbox, err := r.MailboxRepository.GetByID(ctx, id); err == nil {
+			mailboxes = append(mailboxes, mailbox)
+		}
+	}
+
+	paths, err := r.MailboxRepository.DeleteByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, mailbox := range mailboxes {
+		r.publisher.BroadcastMailboxDeleted(mailboxPayload(mailbox))
+	}
+	return paths, nil
+}
+
+func mailboxPayload(mailbox *models.Mailbox) *websocket.MailboxPayload {
+	return &websocket.MailboxPayload{
+		ID:          mailbox.ID,
+		DomainID:    mailbox.DomainID,
+		FullAddress: mailbox.FullAddress,
+	}
+}
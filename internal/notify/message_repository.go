@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// messageRepository publishes read state changes and deletions of single
+// messages; bulk operations are summarized by the bulk message service
+type messageRepository struct {
+	repository.MessageRepository
+	publisher Publisher
+}
+
+// NewMessageRepository wraps a MessageRepository to publish its changes
+func NewMessageRepository(repo repository.MessageRepository, publisher Publisher) repository.MessageRepository {
+	return &messageRepository{MessageRepository: repo, publisher: publisher}
+}
+
+// MarkAsRead marks a message as read
+func (r *messageRepository) MarkAsRead(ctx context.Context, id uint) error {
+	message, err := r.MessageRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.MessageRepository.MarkAsRead(ctx, id); err != nil {
+		return err
+	}
+	if !message.IsRead {
+		r.publisher.BroadcastMessageRead(message.MailboxID, &websocket.MessageReadPayload{ID: id, IsRead: true})
+	}
+	return nil
+}
+
+// SetFlags sets or clears system flags of a message
+func (r *messageRepository) SetFlags(ctx context.Context, id uint, flags map[string]bool) error {
+	read, ok := readFlag(flags)
+	if !ok {
+		return r.MessageRepository.SetFlags(ctx, id, flags)
+	}
+
+	message, err := r.MessageRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.MessageRepository.SetFlags(ctx, id, flags); err != nil {
+		return err
+	}
+	if message.IsRead != read {
+		r.publisher.BroadcastMessageRead(message.MailboxID, &websocket.MessageReadPayload{ID: id, IsRead: read})
+	}
+	return nil
+}
+
+// Delete deletes a message
+func (r *messageRepository) Delete(ctx context.Context, id uint) error {
+	message, err := r.MessageRepository.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.MessageRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.publisher.BroadcastMessageDeleted(message.MailboxID, &websocket.MessageDeletedPayload{ID: id})
+	return nil
+}
+
+// readFlag returns the value of the \Seen flag among flags, if it is set
+func readFlag(flags map[string]bool) (read, ok bool) {
+	for flag, set := range flags {
+		if column, known := models.FlagColumn(flag); known && column == "is_read" {
+			return set, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,41 @@
+// Package notify wraps repositories so that their changes are published as
+// WebSocket events, whether they are made through the REST API, a mail
+// protocol or a background job.
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// Publisher receives the events of the wrapped repositories, usually the
+// WebSocket hub
+type Publisher interface {
+	BroadcastMessageRead(mailboxID uint, payload *websocket.MessageReadPayload)
+	BroadcastMessageDeleted(mailboxID uint, payload *websocket.MessageDeletedPayload)
+	BroadcastMailboxCreated(payload *websocket.MailboxPayload)
+	BroadcastMailboxDeleted(payload *websocket.MailboxPayload)
+	BroadcastDomainStatusChanged(payload *websocket.DomainStatusPayload)
+	BroadcastCertificateIssued(payload *websocket.CertificatePayload)
+	BroadcastCertificateRenewed(payload *websocket.CertificatePayload)
+}
+
+// MailboxDomains returns a resolver for the hub that looks up the domain of a
+// mailbox
+func MailboxDomains(mailboxRepo repository.MailboxRepository) websocket.DomainResolver {
+	return func(ctx context.Context, mailboxID uint) (uint, error) {
+		mailbox, err := mailboxRepo.GetByID(ctx, mailboxID)
+		if err != nil {
+			return 0, err
+		}
+		return mailbox.DomainID, nil
+	}
+}
+
+// formatTime formats timestamps of payloads like the received time of messages
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,230 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// event is a call recorded by recordingPublisher
+type event struct {
+	messageType websocket.MessageType
+	mailboxID   uint
+	payload     interface{}
+}
+
+// recordingPublisher records the events it receives
+type recordingPublisher struct {
+	events []event
+}
+
+func (p *recordingPublisher) record(messageType websocket.MessageType, mailboxID uint, payload interface{}) {
+	p.events = append(p.events, event{messageType: messageType, mailboxID: mailboxID, payload: payload})
+}
+
+func (p *recordingPublisher) BroadcastMessageRead(mailboxID uint, payload *websocket.MessageReadPayload) {
+	p.record(websocket.MessageTypeMessageRead, mailboxID, payload)
+}
+
+func (p *recordingPublisher) BroadcastMessageDeleted(mailboxID uint, payload *websocket.MessageDeletedPayload) {
+	p.record(websocket.MessageTypeMessageDeleted, mailboxID, payload)
+}
+
+func (p *recordingPublisher) BroadcastMailboxCreated(payload *websocket.MailboxPayload) {
+	p.record(websocket.MessageTypeMailboxCreated, payload.ID, payload)
+}
+
+func (p *recordingPublisher) BroadcastMailboxDeleted(payload *websocket.MailboxPayload) {
+	p.record(websocket.MessageTypeMailboxDeleted, payload.ID, payload)
+}
+
+func (p *recordingPublisher) BroadcastDomainStatusChanged(payload *websocket.DomainStatusPayload) {
+	p.record(websocket.MessageTypeDomainStatusChanged, 0, payload)
+}
+
+func (p *recordingPublisher) BroadcastCertificateIssued(payload *websocket.CertificatePayload) {
+	p.record(websocket.MessageTypeCertificateIssued, 0, payload)
+}
+
+func (p *recordingPublisher) BroadcastCertificateRenewed(payload *websocket.CertificatePayload) {
+	p.record(websocket.MessageTypeCertificateRenewed, 0, payload)
+}
+
+func (p *recordingPublisher) types() []websocket.MessageType {
+	types := make([]websocket.MessageType, 0, len(p.events))
+	for _, e := range p.events {
+		types = append(types, e.messageType)
+	}
+	return types
+}
+
+// newTestDB opens an in-memory database with a domain
+func newTestDB(t *testing.T) (*gorm.DB, *models.Domain) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	db.Exec("PRAGMA foreign_keys = ON")
+	require.NoError(t, database.Migrate(db))
+
+	domain := &models.Domain{Name: "notify.test", Status: models.StatusPendingDNS}
+	require.NoError(t, db.Create(domain).Error)
+	return db, domain
+}
+
+func TestMessageRepository_PublishesReadAndDelete(t *testing.T) {
+	db, domain := newTestDB(t)
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	mailboxes := repository.NewMailboxRepository(db)
+	messages := NewMessageRepository(repository.NewMessageRepository(db), publisher)
+
+	mailbox := &models.Mailbox{LocalPart: "user", DomainID: domain.ID, FullAddress: "user@notify.test"}
+	require.NoError(t, mailboxes.Create(ctx, mailbox))
+	message := &models.Message{MailboxID: mailbox.ID, SenderEmail: "sender@example.com"}
+	require.NoError(t, messages.Create(ctx, message))
+
+	require.NoError(t, messages.MarkAsRead(ctx, message.ID))
+	// Already read, nothing changes
+	require.NoError(t, messages.MarkAsRead(ctx, message.ID))
+	require.NoError(t, messages.SetFlags(ctx, message.ID, map[string]bool{models.FlagSeen: false}))
+	// Flags other than \Seen are not published
+	require.NoError(t, messages.SetFlags(ctx, message.ID, map[string]bool{models.FlagFlagged: true}))
+	require.NoError(t, messages.Delete(ctx, message.ID))
+
+	assert.Equal(t, []websocket.MessageType{
+		websocket.MessageTypeMessageRead,
+		websocket.MessageTypeMessageRead,
+		websocket.MessageTypeMessageDeleted,
+	}, publisher.types())
+	assert.Equal(t, mailbox.ID, publisher.events[0].mailboxID)
+	assert.Equal(t, &websocket.MessageReadPayload{ID: message.ID, IsRead: true}, publisher.events[0].payload)
+	assert.Equal(t, &websocket.MessageReadPayload{ID: message.ID, IsRead: false}, publisher.events[1].payload)
+	assert.Equal(t, &websocket.MessageDeletedPayload{ID: message.ID}, publisher.events[2].payload)
+}
+
+func TestMessageRepository_NotFound(t *testing.T) {
+	db, _ := newTestDB(t)
+	publisher := &recordingPublisher{}
+	messages := NewMessageRepository(repository.NewMessageRepository(db), publisher)
+
+	err := messages.MarkAsRead(context.Background(), 99)
+
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Empty(t, publisher.events)
+}
+
+func TestMailboxRepository_PublishesCreateAndDelete(t *testing.T) {
+	db, domain := newTestDB(t)
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	mailboxes := NewMailboxRepository(repository.NewMailboxRepository(db), publisher)
+
+	first, created, err := mailboxes.GetOrCreate(ctx, "first", domain.ID, domain.Name)
+	require.NoError(t, err)
+	require.True(t, created)
+	// Existing mailboxes are not created again
+	_, _, err = mailboxes.GetOrCreate(ctx, "first", domain.ID, domain.Name)
+	require.NoError(t, err)
+	second := &models.Mailbox{LocalPart: "second", DomainID: domain.ID, FullAddress: "second@notify.test"}
+	require.NoError(t, mailboxes.Create(ctx, second))
+	require.NoError(t, mailboxes.Delete(ctx, first.ID))
+	_, err = mailboxes.DeleteByIDs(ctx, []uint{second.ID, first.ID})
+	require.NoError(t, err)
+
+	assert.Equal(t, []websocket.MessageType{
+		websocket.MessageTypeMailboxCreated,
+		websocket.MessageTypeMailboxCreated,
+		websocket.MessageTypeMailboxDeleted,
+		websocket.MessageTypeMailboxDeleted,
+	}, publisher.types())
+	assert.Equal(t, &websocket.MailboxPayload{ID: first.ID, DomainID: domain.ID, FullAddress: "first@notify.test"}, publisher.events[0].payload)
+	assert.Equal(t, second.ID, publisher.events[3].mailboxID)
+}
+
+func TestDomainRepository_PublishesStatusTransitions(t *testing.T) {
+	db, domain := newTestDB(t)
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	domains := NewDomainRepository(repository.NewDomainRepository(db), publisher)
+
+	// Updates without a new status are not published
+	domain.IsActive = false
+	require.NoError(t, domains.Update(ctx, domain))
+	domain.Status = models.StatusActive
+	domain.IsActive = true
+	require.NoError(t, domains.Update(ctx, domain))
+
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, &websocket.DomainStatusPayload{
+		ID:             domain.ID,
+		Name:           "notify.test",
+		PreviousStatus: string(models.StatusPendingDNS),
+		Status:         string(models.StatusActive),
+		IsActive:       true,
+	}, publisher.events[0].payload)
+}
+
+func TestCertificateRepository_PublishesIssueAndRenewal(t *testing.T) {
+	db, domain := newTestDB(t)
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	certs := NewCertificateRepository(repository.NewCertificateRepository(db), publisher)
+	issuedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cert := &models.DomainCertificate{
+		DomainID:   domain.ID,
+		DomainName: domain.Name,
+		CertPath:   "cert.pem",
+		KeyPath:    "key.pem",
+		IssuedAt:   issuedAt,
+		ExpiresAt:  issuedAt.AddDate(0, 3, 0),
+		AutoRenew:  true,
+	}
+	require.NoError(t, certs.Create(ctx, cert))
+	// Changing auto renewal is not a renewal
+	cert.AutoRenew = false
+	require.NoError(t, certs.Update(ctx, cert))
+	cert.IssuedAt = issuedAt.AddDate(0, 2, 0)
+	cert.ExpiresAt = cert.IssuedAt.AddDate(0, 3, 0)
+	require.NoError(t, certs.Update(ctx, cert))
+
+	assert.Equal(t, []websocket.MessageType{
+		websocket.MessageTypeCertificateIssued,
+		websocket.MessageTypeCertificateRenewed,
+	}, publisher.types())
+	assert.Equal(t, &websocket.CertificatePayload{
+		DomainID:   domain.ID,
+		DomainName: "notify.test",
+		IssuedAt:   "2026-03-01T00:00:00Z",
+		ExpiresAt:  "2026-06-01T00:00:00Z",
+	}, publisher.events[1].payload)
+}
+
+func TestMailboxDomains(t *testing.T) {
+	db, domain := newTestDB(t)
+	ctx := context.Background()
+	mailboxes := repository.NewMailboxRepository(db)
+	mailbox := &models.Mailbox{LocalPart: "user", DomainID: domain.ID, FullAddress: "user@notify.test"}
+	require.NoError(t, mailboxes.Create(ctx, mailbox))
+	resolve := MailboxDomains(mailboxes)
+
+	domainID, err := resolve(ctx, mailbox.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ID, domainID)
+
+	_, err = resolve(ctx, 99)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
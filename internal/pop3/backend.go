@@ -0,0 +1,143 @@
+// Package pop3 serves mailboxes over POP3 (RFC 1939) for clients that only poll.
+// Each models.Mailbox is a maildrop named by its address, holding the messages of
+// its Inbox folder.
+package pop3
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/services"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// Errors returned to clients, prefixed with the response codes of RFC 2449 and RFC 3206
+var (
+	errInvalidCredentials = errors.New("[AUTH] invalid username or password")
+	errMaildropLocked     = errors.New("[IN-USE] maildrop is already open in another session")
+	errTemporary          = errors.New("[SYS/TEMP] internal server error, try again later")
+)
+
+// Backend opens maildrops on top of the repositories
+type Backend struct {
+	mailboxRepo repository.MailboxRepository
+	messageRepo repository.MessageRepository
+	folderRepo  repository.FolderRepository
+	fileStorage storage.FileStorage
+	auth        *mailauth.Authenticator
+	logger      *slog.Logger
+
+	// Mailboxes with an open session; RFC 1939 gives a session an exclusive lock
+	mu     sync.Mutex
+	locked map[uint]bool
+}
+
+// BackendConfig holds configuration for the POP3 backend
+type BackendConfig struct {
+	MailboxRepo repository.MailboxRepository
+	MessageRepo repository.MessageRepository
+	FolderRepo  repository.FolderRepository
+	FileStorage storage.FileStorage
+	Auth        *mailauth.Authenticator
+	Logger      *slog.Logger
+}
+
+// NewBackend creates a new POP3 backend
+func NewBackend(cfg *BackendConfig) *Backend {
+	return &Backend{
+		mailboxRepo: cfg.MailboxRepo,
+		messageRepo: cfg.MessageRepo,
+		folderRepo:  cfg.FolderRepo,
+		fileStorage: cfg.FileStorage,
+		auth:        cfg.Auth,
+		logger:      cfg.Logger,
+		locked:      make(map[uint]bool),
+	}
+}
+
+// login authenticates a client with a password (USER/PASS) or, when timestamp is
+// set, with an APOP digest, and opens the maildrop of the mailbox
+func (b *Backend) login(ctx context.Context, username, secret, timestamp, remoteAddr string) (*maildrop, error) {
+	address := strings.ToLower(strings.TrimSpace(username))
+
+	var ok bool
+	switch {
+	case b.auth == nil:
+	case timestamp != "":
+		ok = b.auth.VerifyDigest(address, timestamp, secret)
+	default:
+		ok = b.auth.Verify(address, secret)
+	}
+	if !ok {
+		b.logLoginFailure(address, remoteAddr)
+		return nil, errInvalidCredentials
+	}
+
+	mailbox, err := b.mailboxRepo.GetByAddress(ctx, address)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			b.logLoginFailure(address, remoteAddr)
+			return nil, errInvalidCredentials
+		}
+		return nil, b.internalError("failed to get mailbox", err)
+	}
+	_ = b.mailboxRepo.UpdateLastAccessed(ctx, mailbox.ID)
+
+	return b.openMaildrop(ctx, mailbox)
+}
+
+// openMaildrop locks the mailbox and lists its Inbox
+func (b *Backend) openMaildrop(ctx context.Context, mailbox *models.Mailbox) (*maildrop, error) {
+	b.mu.Lock()
+	if b.locked[mailbox.ID] {
+		b.mu.Unlock()
+		return nil, errMaildropLocked
+	}
+	b.locked[mailbox.ID] = true
+	b.mu.Unlock()
+
+	drop := &maildrop{backend: b, mailbox: mailbox}
+	if err := drop.load(ctx); err != nil {
+		b.unlock(mailbox.ID)
+		return nil, b.internalError("failed to list maildrop", err)
+	}
+	return drop, nil
+}
+
+// unlock releases the lock of a mailbox
+func (b *Backend) unlock(mailboxID uint) {
+	b.mu.Lock()
+	delete(b.locked, mailboxID)
+	b.mu.Unlock()
+}
+
+// source returns the RFC 822 source of a message
+func (b *Backend) source(ctx context.Context, mailbox *models.Mailbox, id uint) ([]byte, error) {
+	message, err := b.messageRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return services.MessageSource(b.fileStorage, mailbox, message)
+}
+
+// internalError logs err and returns the error shown to clients
+func (b *Backend) internalError(msg string, err error) error {
+	if b.logger != nil {
+		b.logger.Error(msg, slog.Any("error", err))
+	}
+	return errTemporary
+}
+
+func (b *Backend) logLoginFailure(address, remoteAddr string) {
+	if b.logger != nil {
+		b.logger.Warn("POP3 login failed",
+			slog.String("username", address),
+			slog.String("remote_addr", remoteAddr))
+	}
+}
@@ -0,0 +1,112 @@
+package pop3
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// maildrop is the snapshot of an Inbox a session works on. Message numbers are
+// fixed for the session; deletions are only marked until QUIT.
+type maildrop struct {
+	backend  *Backend
+	mailbox  *models.Mailbox
+	messages []*dropMessage
+}
+
+// dropMessage is a message of the maildrop
+type dropMessage struct {
+	id      uint
+	size    int64
+	deleted bool
+}
+
+// load lists the Inbox. The size of a message is its stored size, or the length of
+// its rebuilt source when no size was recorded.
+func (d *maildrop) load(ctx context.Context) error {
+	inbox, err := d.backend.folderRepo.GetByRole(ctx, d.mailbox.ID, models.FolderRoleInbox)
+	if err != nil {
+		return err
+	}
+	items, err := d.backend.messageRepo.ListFolderItems(ctx, d.mailbox.ID, inbox.ID)
+	if err != nil {
+		return err
+	}
+
+	d.messages = make([]*dropMessage, 0, len(items))
+	for _, item := range items {
+		message := &dropMessage{id: item.ID, size: item.SizeBytes}
+		if message.size <= 0 {
+			raw, err := d.backend.source(ctx, d.mailbox, item.ID)
+			if err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					continue
+				}
+				return err
+			}
+			message.size = int64(len(raw))
+		}
+		d.messages = append(d.messages, message)
+	}
+	return nil
+}
+
+// message returns a message that is not marked as deleted by its 1-based number
+func (d *maildrop) message(arg string) (*dropMessage, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(d.messages) {
+		return nil, errors.New("no such message")
+	}
+	message := d.messages[n-1]
+	if message.deleted {
+		return nil, errors.New("message is deleted")
+	}
+	return message, nil
+}
+
+// stat returns the number and total size of messages not marked as deleted
+func (d *maildrop) stat() (count int, size int64) {
+	for _, message := range d.messages {
+		if !message.deleted {
+			count++
+			size += message.size
+		}
+	}
+	return count, size
+}
+
+// reset unmarks deleted messages
+func (d *maildrop) reset() {
+	for _, message := range d.messages {
+		message.deleted = false
+	}
+}
+
+// commit deletes the marked messages along with their stored files, as the HTTP
+// delete does; messages already deleted elsewhere are skipped
+func (d *maildrop) commit(ctx context.Context) error {
+	var failed error
+	for _, message := range d.messages {
+		if !message.deleted {
+			continue
+		}
+		if err := d.backend.messageRepo.Delete(ctx, message.id); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// close releases the lock of the maildrop
+func (d *maildrop) close() {
+	d.backend.unlock(d.mailbox.ID)
+}
+
+// uidl returns the unique-id of a message. Message IDs are never reused, so the
+// same message keeps its unique-id across sessions.
+func uidl(message *dropMessage) string {
+	return strconv.FormatUint(uint64(message.id), 10)
+}
@@ -0,0 +1,248 @@
+package pop3
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ServerConfig holds configuration for the POP3 server
+type ServerConfig struct {
+	// Addr is the plain listener, upgraded with STLS; empty disables it
+	Addr string
+	// TLSAddr is the implicit TLS listener; empty disables it
+	TLSAddr string
+	// Hostname appears in the APOP challenge of the greeting
+	Hostname string
+	// AllowInsecure allows USER and PASS before STLS
+	AllowInsecure bool
+	// SNI Support
+	GetCertificate  func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	DefaultCertFile string
+	DefaultKeyFile  string
+}
+
+// Server accepts POP3 connections on a STLS and an implicit TLS listener, with
+// the SNI certificates of the SMTP server
+type Server struct {
+	backend   *Backend
+	cfg       *ServerConfig
+	tlsConfig *tls.Config
+	logger    *slog.Logger
+
+	mu             sync.RWMutex
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	defaultCert    *tls.Certificate
+	listeners      map[net.Listener]struct{}
+	conns          map[net.Conn]struct{}
+	closed         bool
+}
+
+// NewServer creates a new POP3 server. TLS is only offered when a certificate
+// source is configured.
+func NewServer(backend *Backend, cfg *ServerConfig) *Server {
+	if cfg.Hostname == "" {
+		cfg.Hostname = "localhost"
+	}
+	s := &Server{
+		backend:        backend,
+		cfg:            cfg,
+		logger:         backend.logger,
+		getCertificate: cfg.GetCertificate,
+		listeners:      make(map[net.Listener]struct{}),
+		conns:          make(map[net.Conn]struct{}),
+	}
+
+	if cfg.DefaultCertFile != "" && cfg.DefaultKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.DefaultCertFile, cfg.DefaultKeyFile)
+		if err == nil {
+			s.defaultCert = &cert
+		} else if s.logger != nil {
+			s.logger.Warn("failed to load default POP3 certificate", slog.Any("error", err))
+		}
+	}
+	if s.getCertificate != nil || s.defaultCert != nil {
+		s.tlsConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.getCertificateWithFallback,
+		}
+	}
+
+	return s
+}
+
+// ListenAndServe listens on the configured addresses and serves POP3 until Close
+func (s *Server) ListenAndServe() error {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	if s.cfg.Addr != "" {
+		l, err := net.Listen("tcp", s.cfg.Addr)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	if s.cfg.TLSAddr != "" {
+		if s.tlsConfig == nil {
+			if s.logger != nil {
+				s.logger.Warn("no certificate configured, POP3 implicit TLS listener disabled",
+					slog.String("addr", s.cfg.TLSAddr))
+			}
+		} else {
+			l, err := net.Listen("tcp", s.cfg.TLSAddr)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			listeners = append(listeners, tls.NewListener(l, s.tlsConfig))
+		}
+	}
+	if len(listeners) == 0 {
+		return errors.New("no POP3 listener configured")
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- s.Serve(l)
+		}(l)
+	}
+	for range listeners {
+		if err := <-errs; err != nil {
+			s.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Serve accepts connections on l until Close. Connections from a TLS listener
+// are implicit TLS sessions.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.RLock()
+			closed := s.closed
+			s.mu.RUnlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go func() {
+			defer s.untrack(conn)
+			newSession(s, conn).serve()
+		}()
+	}
+}
+
+// Close stops the listeners and closes all connections. Sessions without QUIT
+// delete nothing.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// getCertificateWithFallback returns the certificate for the SNI hostname,
+// falling back to the default certificate
+func (s *Server) getCertificateWithFallback(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	getCertificate := s.getCertificate
+	defaultCert := s.defaultCert
+	s.mu.RUnlock()
+
+	if getCertificate != nil {
+		cert, err := getCertificate(hello)
+		if err == nil && cert != nil {
+			return cert, nil
+		}
+		if s.logger != nil && err != nil {
+			s.logger.Debug("SNI certificate lookup failed, using fallback",
+				slog.String("server_name", hello.ServerName),
+				slog.Any("error", err))
+		}
+	}
+	return defaultCert, nil
+}
+
+// LoadServerConfigFromEnv loads server configuration from environment variables.
+// The listener addresses and hostname come from the application config.
+func LoadServerConfigFromEnv() *ServerConfig {
+	cfg := &ServerConfig{
+		AllowInsecure: getEnvBool("POP3_ALLOW_INSECURE", false),
+	}
+
+	// Default certificate used when SNI finds no match; falls back to the SMTP one
+	cfg.DefaultCertFile = getEnvOrDefault("POP3_TLS_CERT", os.Getenv("SMTP_TLS_CERT"))
+	cfg.DefaultKeyFile = getEnvOrDefault("POP3_TLS_KEY", os.Getenv("SMTP_TLS_KEY"))
+
+	return cfg
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
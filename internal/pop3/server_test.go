@@ -0,0 +1,422 @@
+package pop3
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailauth"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const masterToken = "master-token"
+
+// pop3Fixture serves a POP3 backend over an in-memory database and temp storage
+type pop3Fixture struct {
+	fileStorage storage.FileStorage
+	messageRepo repository.MessageRepository
+	auth        *mailauth.Authenticator
+	mailbox     *models.Mailbox
+	backend     *Backend
+}
+
+func newPOP3Fixture(t *testing.T) *pop3Fixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// Every connection of an in-memory database is a separate database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	db.Exec("PRAGMA foreign_keys = ON")
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	fileStorage, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	domain := &models.Domain{Name: "pop3.test", IsActive: true}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("failed to create domain: %v", err)
+	}
+	mailbox := &models.Mailbox{LocalPart: "qa", DomainID: domain.ID, FullAddress: "qa@pop3.test"}
+	if err := db.Create(mailbox).Error; err != nil {
+		t.Fatalf("failed to create mailbox: %v", err)
+	}
+
+	auth, err := mailauth.New(bytes.Repeat([]byte{2}, mailauth.MinSecretLength), masterToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messageRepo := repository.NewMessageRepositoryWithStorage(db, fileStorage)
+	return &pop3Fixture{
+		fileStorage: fileStorage,
+		messageRepo: messageRepo,
+		auth:        auth,
+		mailbox:     mailbox,
+		backend: NewBackend(&BackendConfig{
+			MailboxRepo: repository.NewMailboxRepository(db),
+			MessageRepo: messageRepo,
+			FolderRepo:  repository.NewFolderRepository(db),
+			FileStorage: fileStorage,
+			Auth:        auth,
+		}),
+	}
+}
+
+// serve starts a server on a local port and returns its address
+func (f *pop3Fixture) serve(t *testing.T, cfg *ServerConfig) (*Server, string) {
+	t.Helper()
+	server := NewServer(f.backend, cfg)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return server, listener.Addr().String()
+}
+
+// createMessage stores a message with its raw source in the Inbox
+func (f *pop3Fixture) createMessage(t *testing.T, subject, body string) *models.Message {
+	t.Helper()
+	raw := "From: sender@example.com\r\n" +
+		"To: " + f.mailbox.FullAddress + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"\r\n" +
+		body
+	rawPath, err := f.fileStorage.Save("message.eml", strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to save raw source: %v", err)
+	}
+	message := &models.Message{
+		MailboxID:   f.mailbox.ID,
+		SenderEmail: "sender@example.com",
+		Subject:     subject,
+		RawPath:     rawPath,
+		SizeBytes:   int64(len(raw)),
+		ReceivedAt:  time.Now(),
+	}
+	if err := f.messageRepo.Create(context.Background(), message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	return message
+}
+
+// pop3Client speaks POP3 over a connection
+type pop3Client struct {
+	t        *testing.T
+	conn     net.Conn
+	text     *textproto.Conn
+	greeting string
+}
+
+func dial(t *testing.T, addr string) *pop3Client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	c := &pop3Client{t: t, conn: conn, text: textproto.NewConn(conn)}
+	t.Cleanup(func() { c.text.Close() })
+	c.greeting = c.expectOK()
+	return c
+}
+
+// cmd sends a command and returns its status line
+func (c *pop3Client) cmd(format string, args ...interface{}) string {
+	c.t.Helper()
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		c.t.Fatalf("failed to send command: %v", err)
+	}
+	line, err := c.text.ReadLine()
+	if err != nil {
+		c.t.Fatalf("failed to read response: %v", err)
+	}
+	return line
+}
+
+func (c *pop3Client) expectOK() string {
+	c.t.Helper()
+	line, err := c.text.ReadLine()
+	if err != nil || !strings.HasPrefix(line, "+OK") {
+		c.t.Fatalf("response = %q, %v; want +OK", line, err)
+	}
+	return line
+}
+
+// ok sends a command that must succeed
+func (c *pop3Client) ok(format string, args ...interface{}) string {
+	c.t.Helper()
+	line := c.cmd(format, args...)
+	if !strings.HasPrefix(line, "+OK") {
+		c.t.Fatalf("%s: response = %q, want +OK", strings.Fields(format)[0], line)
+	}
+	return line
+}
+
+// multiline reads the body of a multi-line response
+func (c *pop3Client) multiline() string {
+	c.t.Helper()
+	data, err := c.text.ReadDotBytes()
+	if err != nil {
+		c.t.Fatalf("failed to read multi-line response: %v", err)
+	}
+	return string(data)
+}
+
+func (c *pop3Client) login(f *pop3Fixture) {
+	c.t.Helper()
+	c.ok("USER %s", f.mailbox.FullAddress)
+	c.ok("PASS %s", f.auth.Password(f.mailbox.FullAddress))
+}
+
+func TestSession_ListRetrieveAndDelete(t *testing.T) {
+	f := newPOP3Fixture(t)
+	first := f.createMessage(t, "First", "Hello\r\n.hidden dot\r\n")
+	second := f.createMessage(t, "Second", "Bye\r\n")
+	_, addr := f.serve(t, &ServerConfig{AllowInsecure: true})
+
+	c := dial(t, addr)
+	c.login(f)
+
+	total := first.SizeBytes + second.SizeBytes
+	if got, want := c.ok("STAT"), "+OK 2 "+itoa(total); got != want {
+		t.Errorf("STAT = %q, want %q", got, want)
+	}
+	c.ok("LIST")
+	if got, want := c.multiline(), "1 "+itoa(first.SizeBytes)+"\n2 "+itoa(second.SizeBytes)+"\n"; got != want {
+		t.Errorf("LIST = %q, want %q", got, want)
+	}
+	c.ok("UIDL")
+	if got, want := c.multiline(), "1 "+itoa(int64(first.ID))+"\n2 "+itoa(int64(second.ID))+"\n"; got != want {
+		t.Errorf("UIDL = %q, want %q", got, want)
+	}
+
+	c.ok("RETR 1")
+	if body := c.multiline(); !strings.Contains(body, "Subject: First\n") || !strings.Contains(body, "\n.hidden dot\n") {
+		t.Errorf("RETR 1 = %q", body)
+	}
+	stored, err := f.messageRepo.GetByID(context.Background(), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.IsRead {
+		t.Error("RETR did not mark the message as read")
+	}
+
+	c.ok("TOP 2 0")
+	if top := c.multiline(); !strings.Contains(top, "Subject: Second") || strings.Contains(top, "Bye") {
+		t.Errorf("TOP 2 0 = %q", top)
+	}
+
+	c.ok("DELE 1")
+	if line := c.cmd("RETR 1"); !strings.HasPrefix(line, "-ERR") {
+		t.Errorf("RETR of a deleted message = %q, want -ERR", line)
+	}
+	if got := c.ok("STAT"); got != "+OK 1 "+itoa(second.SizeBytes) {
+		t.Errorf("STAT after DELE = %q", got)
+	}
+	c.ok("QUIT")
+
+	if _, err := f.messageRepo.GetByID(context.Background(), first.ID); err == nil {
+		t.Error("deleted message still exists after QUIT")
+	}
+	if _, err := f.fileStorage.Get(first.RawPath); err == nil {
+		t.Error("raw source of the deleted message still exists")
+	}
+	if _, err := f.messageRepo.GetByID(context.Background(), second.ID); err != nil {
+		t.Errorf("kept message is gone: %v", err)
+	}
+}
+
+func TestSession_DeleteNeedsQuit(t *testing.T) {
+	f := newPOP3Fixture(t)
+	message := f.createMessage(t, "Keep", "Body\r\n")
+	_, addr := f.serve(t, &ServerConfig{AllowInsecure: true})
+
+	c := dial(t, addr)
+	c.login(f)
+	c.ok("DELE 1")
+	c.ok("RSET")
+	c.ok("DELE 1")
+	c.text.Close()
+
+	// The maildrop lock is released once the server sees the disconnect
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c = dial(t, addr)
+		c.ok("USER %s", f.mailbox.FullAddress)
+		line := c.cmd("PASS %s", f.auth.Password(f.mailbox.FullAddress))
+		if strings.HasPrefix(line, "+OK maildrop has 1 ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("PASS after disconnect = %q", line)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := f.messageRepo.GetByID(context.Background(), message.ID); err != nil {
+		t.Errorf("message deleted without QUIT: %v", err)
+	}
+}
+
+func TestSession_Login(t *testing.T) {
+	f := newPOP3Fixture(t)
+	_, addr := f.serve(t, &ServerConfig{AllowInsecure: true})
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		wantOK   bool
+	}{
+		{"mailbox password", "QA@pop3.test", f.auth.Password("qa@pop3.test"), true},
+		{"master token", "qa@pop3.test", masterToken, true},
+		{"wrong password", "qa@pop3.test", "guess", false},
+		{"unknown mailbox", "nobody@pop3.test", masterToken, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, addr)
+			c.ok("USER %s", tt.user)
+			line := c.cmd("PASS %s", tt.password)
+			if strings.HasPrefix(line, "+OK") != tt.wantOK {
+				t.Errorf("PASS = %q, want ok %v", line, tt.wantOK)
+			}
+			if !tt.wantOK && !strings.Contains(line, "[AUTH]") {
+				t.Errorf("PASS = %q, want [AUTH] response code", line)
+			}
+			c.ok("QUIT")
+		})
+	}
+}
+
+func TestSession_APOPAndLock(t *testing.T) {
+	f := newPOP3Fixture(t)
+	_, addr := f.serve(t, &ServerConfig{})
+
+	c := dial(t, addr)
+	timestamp := regexp.MustCompile(`<[^>]+>`).FindString(c.greeting)
+	if timestamp == "" {
+		t.Fatalf("greeting %q has no APOP timestamp", c.greeting)
+	}
+	digest := mailauth.Digest(timestamp, f.auth.Password(f.mailbox.FullAddress))
+	c.ok("APOP %s %s", f.mailbox.FullAddress, digest)
+
+	other := dial(t, addr)
+	otherTimestamp := regexp.MustCompile(`<[^>]+>`).FindString(other.greeting)
+	if otherTimestamp == timestamp {
+		t.Error("greetings share an APOP timestamp")
+	}
+	line := other.cmd("APOP %s %s", f.mailbox.FullAddress, mailauth.Digest(otherTimestamp, masterToken))
+	if !strings.HasPrefix(line, "-ERR [IN-USE]") {
+		t.Errorf("second session = %q, want -ERR [IN-USE]", line)
+	}
+
+	c.ok("QUIT")
+	other.ok("APOP %s %s", f.mailbox.FullAddress, mailauth.Digest(otherTimestamp, masterToken))
+}
+
+func TestSession_STLS(t *testing.T) {
+	f := newPOP3Fixture(t)
+	cert := selfSignedCertificate(t)
+	_, addr := f.serve(t, &ServerConfig{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil },
+	})
+
+	c := dial(t, addr)
+	c.ok("CAPA")
+	if capabilities := c.multiline(); !strings.Contains(capabilities, "STLS") || strings.Contains(capabilities, "USER") {
+		t.Errorf("CAPA before STLS = %q, want STLS without USER", capabilities)
+	}
+	if line := c.cmd("USER %s", f.mailbox.FullAddress); !strings.HasPrefix(line, "-ERR") {
+		t.Errorf("USER before STLS = %q, want -ERR", line)
+	}
+
+	c.ok("STLS")
+	tlsConn := tls.Client(c.conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("TLS handshake failed: %v", err)
+	}
+	c.text = textproto.NewConn(tlsConn)
+
+	c.ok("CAPA")
+	if capabilities := c.multiline(); strings.Contains(capabilities, "STLS") || !strings.Contains(capabilities, "USER") {
+		t.Errorf("CAPA after STLS = %q, want USER without STLS", capabilities)
+	}
+	c.login(f)
+	c.ok("QUIT")
+}
+
+func TestTop(t *testing.T) {
+	raw := []byte("Subject: x\r\n\r\none\r\ntwo\r\nthree")
+	tests := []struct {
+		lines int
+		want  string
+	}{
+		{0, "Subject: x\r\n\r\n"},
+		{2, "Subject: x\r\n\r\none\r\ntwo\r\n"},
+		{5, string(raw)},
+	}
+	for _, tt := range tests {
+		if got := string(top(raw, tt.lines)); got != tt.want {
+			t.Errorf("top(%d) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// selfSignedCertificate creates a certificate for the TLS tests
+func selfSignedCertificate(t *testing.T) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pop3.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"pop3.test"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,458 @@
+package pop3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// idleTimeout closes sessions without commands for the time RFC 1939 sets as the minimum
+const idleTimeout = 10 * time.Minute
+
+// maxLineLength bounds command lines; RFC 2449 allows 255 octets
+const maxLineLength = 512
+
+var errLineTooLong = errors.New("line too long")
+
+// session is one client connection. It is in the AUTHORIZATION state until a
+// maildrop is opened and in the TRANSACTION state after.
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	isTLS  bool
+
+	// timestamp is the APOP challenge of the greeting
+	timestamp string
+	// user is the name given with USER, waiting for PASS
+	user string
+	drop *maildrop
+}
+
+func newSession(server *Server, conn net.Conn) *session {
+	s := &session{server: server, timestamp: newTimestamp(server.cfg.Hostname)}
+	s.setConn(conn)
+	_, s.isTLS = conn.(*tls.Conn)
+	return s
+}
+
+func (s *session) setConn(conn net.Conn) {
+	s.conn = conn
+	s.reader = bufio.NewReaderSize(conn, maxLineLength)
+	s.writer = bufio.NewWriter(conn)
+}
+
+// serve runs commands until QUIT or the connection ends. A session that ends
+// without QUIT deletes nothing.
+func (s *session) serve() {
+	defer func() {
+		if s.drop != nil {
+			s.drop.close()
+		}
+		s.conn.Close()
+	}()
+
+	s.ok("Infinimail POP3 server ready " + s.timestamp)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		line, err := s.readLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				s.fail("line too long")
+			}
+			return
+		}
+
+		command, args := parseCommand(line)
+		if done := s.handle(command, args); done {
+			return
+		}
+	}
+}
+
+// handle runs a command and reports whether the session is over
+func (s *session) handle(command string, args []string) bool {
+	if command == "QUIT" {
+		s.quit()
+		return true
+	}
+	if command == "CAPA" {
+		s.capabilities()
+		return false
+	}
+	if command == "NOOP" && s.drop != nil {
+		s.ok("")
+		return false
+	}
+
+	if s.drop == nil {
+		switch command {
+		case "USER":
+			s.handleUser(args)
+		case "PASS":
+			s.handlePass(args)
+		case "APOP":
+			s.handleAPOP(args)
+		case "STLS":
+			return s.handleSTLS()
+		default:
+			s.fail("unknown command or not allowed before login")
+		}
+		return false
+	}
+
+	switch command {
+	case "STAT":
+		count, size := s.drop.stat()
+		s.ok(fmt.Sprintf("%d %d", count, size))
+	case "LIST":
+		s.handleList(args)
+	case "UIDL":
+		s.handleUIDL(args)
+	case "RETR":
+		s.handleRetr(args)
+	case "TOP":
+		s.handleTop(args)
+	case "DELE":
+		s.handleDele(args)
+	case "RSET":
+		s.drop.reset()
+		count, size := s.drop.stat()
+		s.ok(fmt.Sprintf("maildrop has %d messages (%d octets)", count, size))
+	default:
+		s.fail("unknown command or not allowed after login")
+	}
+	return false
+}
+
+// plaintextAllowed reports whether USER and PASS may be used on this connection
+func (s *session) plaintextAllowed() bool {
+	return s.isTLS || s.server.cfg.AllowInsecure
+}
+
+// capabilities answers CAPA (RFC 2449)
+func (s *session) capabilities() {
+	capabilities := []string{"TOP", "UIDL", "RESP-CODES", "AUTH-RESP-CODE"}
+	if s.drop == nil {
+		if s.plaintextAllowed() {
+			capabilities = append(capabilities, "USER")
+		}
+		if !s.isTLS && s.server.tlsConfig != nil {
+			capabilities = append(capabilities, "STLS")
+		}
+	}
+	capabilities = append(capabilities, "IMPLEMENTATION Infinimail")
+
+	s.ok("capability list follows")
+	s.writeLines(capabilities)
+}
+
+func (s *session) handleUser(args []string) {
+	if !s.plaintextAllowed() {
+		s.fail("use STLS before logging in")
+		return
+	}
+	if len(args) != 1 {
+		s.fail("usage: USER name")
+		return
+	}
+	s.user = args[0]
+	s.ok("send PASS")
+}
+
+func (s *session) handlePass(args []string) {
+	if s.user == "" {
+		s.fail("send USER first")
+		return
+	}
+	user := s.user
+	s.user = ""
+	if len(args) == 0 {
+		s.fail("usage: PASS password")
+		return
+	}
+	// The password is the rest of the line and may contain spaces
+	s.login(user, strings.Join(args, " "), "")
+}
+
+func (s *session) handleAPOP(args []string) {
+	if len(args) != 2 {
+		s.fail("usage: APOP name digest")
+		return
+	}
+	s.login(args[0], args[1], s.timestamp)
+}
+
+// login opens the maildrop; timestamp is set for APOP
+func (s *session) login(user, secret, timestamp string) {
+	drop, err := s.server.backend.login(context.Background(), user, secret, timestamp, s.conn.RemoteAddr().String())
+	if err != nil {
+		s.fail(err.Error())
+		return
+	}
+	s.drop = drop
+	count, size := drop.stat()
+	s.ok(fmt.Sprintf("maildrop has %d messages (%d octets)", count, size))
+}
+
+// handleSTLS upgrades the connection to TLS (RFC 2595) and reports whether the
+// session is over
+func (s *session) handleSTLS() bool {
+	if s.isTLS || s.server.tlsConfig == nil {
+		s.fail("TLS not available")
+		return false
+	}
+	s.ok("begin TLS negotiation")
+
+	tlsConn := tls.Server(s.conn, s.server.tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := tlsConn.Handshake(); err != nil {
+		if s.server.logger != nil {
+			s.server.logger.Debug("POP3 STLS handshake failed", slog.Any("error", err))
+		}
+		return true
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	// Commands sent before the handshake are discarded with the old reader
+	s.setConn(tlsConn)
+	s.isTLS = true
+	s.user = ""
+	return false
+}
+
+func (s *session) handleList(args []string) {
+	if len(args) > 0 {
+		message, err := s.drop.message(args[0])
+		if err != nil {
+			s.fail(err.Error())
+			return
+		}
+		s.ok(fmt.Sprintf("%s %d", args[0], message.size))
+		return
+	}
+
+	count, size := s.drop.stat()
+	var lines []string
+	for i, message := range s.drop.messages {
+		if !message.deleted {
+			lines = append(lines, fmt.Sprintf("%d %d", i+1, message.size))
+		}
+	}
+	s.ok(fmt.Sprintf("%d messages (%d octets)", count, size))
+	s.writeLines(lines)
+}
+
+func (s *session) handleUIDL(args []string) {
+	if len(args) > 0 {
+		message, err := s.drop.message(args[0])
+		if err != nil {
+			s.fail(err.Error())
+			return
+		}
+		s.ok(args[0] + " " + uidl(message))
+		return
+	}
+
+	var lines []string
+	for i, message := range s.drop.messages {
+		if !message.deleted {
+			lines = append(lines, fmt.Sprintf("%d %s", i+1, uidl(message)))
+		}
+	}
+	s.ok("unique-id listing follows")
+	s.writeLines(lines)
+}
+
+// handleRetr sends a message and marks it as read
+func (s *session) handleRetr(args []string) {
+	if len(args) != 1 {
+		s.fail("usage: RETR msg")
+		return
+	}
+	message, err := s.drop.message(args[0])
+	if err != nil {
+		s.fail(err.Error())
+		return
+	}
+	ctx := context.Background()
+	raw, err := s.source(ctx, message)
+	if err != nil {
+		s.fail(err.Error())
+		return
+	}
+
+	s.ok(fmt.Sprintf("%d octets", message.size))
+	s.writeData(raw)
+
+	if _, err := s.server.backend.messageRepo.SetReadByIDs(ctx, []uint{message.id}, true); err != nil && s.server.logger != nil {
+		s.server.logger.Warn("failed to mark retrieved message as read",
+			slog.Uint64("message_id", uint64(message.id)),
+			slog.Any("error", err))
+	}
+}
+
+// handleTop sends the header and the first lines of the body of a message
+func (s *session) handleTop(args []string) {
+	if len(args) != 2 {
+		s.fail("usage: TOP msg n")
+		return
+	}
+	message, err := s.drop.message(args[0])
+	if err != nil {
+		s.fail(err.Error())
+		return
+	}
+	lines, err := strconv.Atoi(args[1])
+	if err != nil || lines < 0 {
+		s.fail("invalid number of lines")
+		return
+	}
+	raw, err := s.source(context.Background(), message)
+	if err != nil {
+		s.fail(err.Error())
+		return
+	}
+
+	s.ok("top of message follows")
+	s.writeData(top(raw, lines))
+}
+
+func (s *session) handleDele(args []string) {
+	if len(args) != 1 {
+		s.fail("usage: DELE msg")
+		return
+	}
+	message, err := s.drop.message(args[0])
+	if err != nil {
+		s.fail(err.Error())
+		return
+	}
+	message.deleted = true
+	s.ok("message " + args[0] + " deleted")
+}
+
+// quit ends the session, deleting the marked messages after a login
+func (s *session) quit() {
+	if s.drop == nil {
+		s.ok("Infinimail POP3 server signing off")
+		return
+	}
+
+	if err := s.drop.commit(context.Background()); err != nil {
+		s.fail(s.server.backend.internalError("failed to delete messages", err).Error())
+		return
+	}
+	count, _ := s.drop.stat()
+	s.ok(fmt.Sprintf("Infinimail POP3 server signing off (%d messages left)", count))
+}
+
+// source loads a message, which may have been deleted since the maildrop was opened
+func (s *session) source(ctx context.Context, message *dropMessage) ([]byte, error) {
+	raw, err := s.server.backend.source(ctx, s.drop.mailbox, message.id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("message no longer exists")
+		}
+		return nil, s.server.backend.internalError("failed to load message", err)
+	}
+	return raw, nil
+}
+
+// readLine reads a command line without its line ending
+func (s *session) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (s *session) ok(text string) {
+	s.reply("+OK", text)
+}
+
+func (s *session) fail(text string) {
+	s.reply("-ERR", text)
+}
+
+func (s *session) reply(status, text string) {
+	if text != "" {
+		status += " " + text
+	}
+	s.writer.WriteString(status + "\r\n")
+	s.writer.Flush()
+}
+
+// writeLines sends the lines of a multi-line response and its terminating dot
+func (s *session) writeLines(lines []string) {
+	for _, line := range lines {
+		s.writer.WriteString(line + "\r\n")
+	}
+	s.writer.WriteString(".\r\n")
+	s.writer.Flush()
+}
+
+// writeData sends a message as a multi-line response with CRLF line endings and
+// byte-stuffed lines starting with a dot
+func (s *session) writeData(data []byte) {
+	w := textproto.NewWriter(s.writer).DotWriter()
+	w.Write(data)
+	w.Close()
+	s.writer.Flush()
+}
+
+// parseCommand splits a command line into an upper case keyword and its arguments
+func parseCommand(line string) (string, []string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(fields[0]), fields[1:]
+}
+
+// top returns the header of a message and the first n lines of its body
+func top(raw []byte, n int) []byte {
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	separator := 4
+	if lf := bytes.Index(raw, []byte("\n\n")); lf >= 0 && (end < 0 || lf < end) {
+		end, separator = lf, 2
+	}
+	if end < 0 {
+		return raw
+	}
+
+	offset := end + separator
+	for i := 0; i < n && offset < len(raw); i++ {
+		next := bytes.IndexByte(raw[offset:], '\n')
+		if next < 0 {
+			return raw
+		}
+		offset += next + 1
+	}
+	return raw[:offset]
+}
+
+// newTimestamp returns a unique APOP challenge (RFC 1939)
+func newTimestamp(hostname string) string {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(nonce), time.Now().Unix(), hostname)
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository defines the interface for API key data access
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListByTenant(ctx context.Context, tenantID *uint) ([]models.APIKey, error)
+	Delete(ctx context.Context, tenantID *uint, id uint) error
+}
+
+// apiKeyRepository implements APIKeyRepository using GORM
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository instance
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+// Create creates a new API key
+func (r *apiKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		if isDuplicateKeyError(err) {
+			return fmt.Errorf("API key already exists: %w", ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetByHash retrieves an API key by the hash of its value
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	result := r.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", result.Error)
+	}
+	return &key, nil
+}
+
+// ListByTenant retrieves the keys of a tenant, or the super-admin keys when
+// tenantID is nil, oldest first
+func (r *apiKeyRepository) ListByTenant(ctx context.Context, tenantID *uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "tenant_id")).Where(keyOwner(tenantID)).Order("id ASC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Delete revokes a key of a tenant, or a super-admin key when tenantID is nil
+func (r *apiKeyRepository) Delete(ctx context.Context, tenantID *uint, id uint) error {
+	result := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "tenant_id")).Where(keyOwner(tenantID)).Delete(&models.APIKey{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// keyOwner matches the keys of a tenant, or the super-admin keys for nil
+func keyOwner(tenantID *uint) map[string]interface{} {
+	return map[string]interface{}{"tenant_id": tenantID}
+}
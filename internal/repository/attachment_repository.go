@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
@@ -15,7 +16,12 @@ type AttachmentRepository interface {
 	Create(ctx context.Context, attachment *models.Attachment) error
 	GetByID(ctx context.Context, id uint) (*models.Attachment, error)
 	ListByMessage(ctx context.Context, messageID uint) ([]models.Attachment, error)
+	ListByMailbox(ctx context.Context, mailboxID uint, from, to time.Time) ([]models.MailboxAttachment, error)
 	Delete(ctx context.Context, id uint) error
+	ListAfterID(ctx context.Context, afterID uint, limit int) ([]models.Attachment, error)
+	ExistingFilePaths(ctx context.Context, filePaths []string) (map[string]bool, error)
+	UpdateFilePath(ctx context.Context, id uint, filePath string) error
+	SetPreviewPath(ctx context.Context, id uint, previewPath string) (bool, error)
 }
 
 // attachmentRepository implements AttachmentRepository using GORM
@@ -34,6 +40,9 @@ func NewAttachmentRepository(db *gorm.DB, fileStorage storage.FileStorage) Attac
 
 // Create creates a new attachment record
 func (r *attachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	if err := owns(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), attachment.MessageID); err != nil {
+		return err
+	}
 	result := r.db.WithContext(ctx).Create(attachment)
 	if result.Error != nil {
 		return fmt.Errorf("failed to create attachment: %w", result.Error)
@@ -44,7 +53,7 @@ func (r *attachmentRepository) Create(ctx context.Context, attachment *models.At
 // GetByID retrieves an attachment by its ID
 func (r *attachmentRepository) GetByID(ctx context.Context, id uint) (*models.Attachment, error) {
 	var attachment models.Attachment
-	result := r.db.WithContext(ctx).First(&attachment, id)
+	result := r.db.WithContext(ctx).Scopes(scopeMessages(ctx, "message_id")).First(&attachment, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -57,13 +66,37 @@ func (r *attachmentRepository) GetByID(ctx context.Context, id uint) (*models.At
 // ListByMessage retrieves all attachments for a message
 func (r *attachmentRepository) ListByMessage(ctx context.Context, messageID uint) ([]models.Attachment, error) {
 	var attachments []models.Attachment
-	result := r.db.WithContext(ctx).Where("message_id = ?", messageID).Find(&attachments)
+	result := r.db.WithContext(ctx).Scopes(scopeMessages(ctx, "message_id")).Where("message_id = ?", messageID).Find(&attachments)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to list attachments: %w", result.Error)
 	}
 	return attachments, nil
 }
 
+// ListByMailbox retrieves the attachments of messages in a mailbox received in [from, to),
+// ordered by message. A zero from or to leaves that end of the range open.
+func (r *attachmentRepository) ListByMailbox(ctx context.Context, mailboxID uint, from, to time.Time) ([]models.MailboxAttachment, error) {
+	query := r.db.WithContext(ctx).
+		Table("attachments").
+		Select("attachments.*, messages.received_at").
+		Joins("JOIN messages ON messages.id = attachments.message_id").
+		Scopes(scopeMailboxes(ctx, "messages.mailbox_id")).
+		Where("messages.mailbox_id = ?", mailboxID)
+	if !from.IsZero() {
+		query = query.Where("messages.received_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("messages.received_at < ?", to)
+	}
+
+	var attachments []models.MailboxAttachment
+	result := query.Order("messages.received_at ASC, attachments.id ASC").Scan(&attachments)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list mailbox attachments: %w", result.Error)
+	}
+	return attachments, nil
+}
+
 // Delete deletes an attachment by its ID and removes the associated file
 func (r *attachmentRepository) Delete(ctx context.Context, id uint) error {
 	// Get attachment first to get file path
@@ -78,10 +111,82 @@ func (r *attachmentRepository) Delete(ctx context.Context, id uint) error {
 		return fmt.Errorf("failed to delete attachment: %w", result.Error)
 	}
 
-	// Delete associated file (ignore errors as file might already be deleted)
+	// Delete associated files (ignore errors as files might already be deleted)
 	if attachment.FilePath != "" && r.fileStorage != nil {
 		_ = r.fileStorage.Delete(attachment.FilePath)
 	}
+	if attachment.PreviewPath != "" && r.fileStorage != nil {
+		_ = r.fileStorage.Delete(attachment.PreviewPath)
+	}
 
 	return nil
 }
+
+// ListAfterID retrieves up to limit attachments with an ID greater than afterID, ordered by ID.
+// Used to page through all attachments without holding the whole table in memory.
+func (r *attachmentRepository) ListAfterID(ctx context.Context, afterID uint, limit int) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	result := r.db.WithContext(ctx).
+		Scopes(scopeMessages(ctx, "message_id")).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&attachments)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", result.Error)
+	}
+	return attachments, nil
+}
+
+// ExistingFilePaths reports which of the given storage paths are referenced by an
+// attachment row, either as the attachment file or as its preview
+func (r *attachmentRepository) ExistingFilePaths(ctx context.Context, filePaths []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(filePaths))
+	if len(filePaths) == 0 {
+		return existing, nil
+	}
+
+	for _, column := range []string{"file_path", "preview_path"} {
+		var found []string
+		result := r.db.WithContext(ctx).
+			Model(&models.Attachment{}).
+			Scopes(scopeMessages(ctx, "message_id")).
+			Where(column+" IN ?", filePaths).
+			Distinct().
+			Pluck(column, &found)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to look up attachment paths: %w", result.Error)
+		}
+		for _, path := range found {
+			existing[path] = true
+		}
+	}
+	return existing, nil
+}
+
+// UpdateFilePath points an attachment at a new storage path
+func (r *attachmentRepository) UpdateFilePath(ctx context.Context, id uint, filePath string) error {
+	result := r.db.WithContext(ctx).Model(&models.Attachment{}).Scopes(scopeMessages(ctx, "message_id")).
+		Where("id = ?", id).Update("file_path", filePath)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update attachment path: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetPreviewPath records a generated preview unless another request already did.
+// It reports false when the attachment already had a preview, so the caller can
+// release the file it saved.
+func (r *attachmentRepository) SetPreviewPath(ctx context.Context, id uint, previewPath string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Attachment{}).
+		Scopes(scopeMessages(ctx, "message_id")).
+		Where("id = ? AND (preview_path = '' OR preview_path IS NULL)", id).
+		Updates(map[string]interface{}{"preview_path": previewPath, "has_preview": true})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update attachment preview: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
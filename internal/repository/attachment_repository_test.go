@@ -3,8 +3,10 @@ package repository
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -58,7 +60,7 @@ func (s *AttachmentRepositoryTestSuite) SetupSuite() {
 	require.NoError(s.T(), err)
 
 	// Auto-migrate models
-	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.Attachment{})
+	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{})
 	require.NoError(s.T(), err)
 
 	s.db = db
@@ -262,6 +264,36 @@ func (s *AttachmentRepositoryTestSuite) TestListByMessage_OnlyReturnsForSpecific
 	assert.Equal(s.T(), "doc1.pdf", result[0].Filename)
 }
 
+func (s *AttachmentRepositoryTestSuite) TestListByMailbox_FiltersByReceivedAt() {
+	// Arrange - three messages on consecutive days, plus one in another mailbox
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	otherMailbox := &models.Mailbox{LocalPart: "other", DomainID: s.testDomain.ID, FullAddress: "other@test.com"}
+	require.NoError(s.T(), s.db.Create(otherMailbox).Error)
+
+	for i, mailboxID := range []uint{s.testMailbox.ID, s.testMailbox.ID, s.testMailbox.ID, otherMailbox.ID} {
+		message := &models.Message{MailboxID: mailboxID, SenderEmail: "sender@example.com", ReceivedAt: base.AddDate(0, 0, i)}
+		require.NoError(s.T(), s.db.Create(message).Error)
+		att := &models.Attachment{MessageID: message.ID, Filename: fmt.Sprintf("day%d.pdf", i), FilePath: fmt.Sprintf("/path/day%d.pdf", i)}
+		require.NoError(s.T(), s.repo.Create(context.Background(), att))
+	}
+
+	// Act
+	all, err := s.repo.ListByMailbox(context.Background(), s.testMailbox.ID, time.Time{}, time.Time{})
+	require.NoError(s.T(), err)
+	ranged, err := s.repo.ListByMailbox(context.Background(), s.testMailbox.ID, base.AddDate(0, 0, 1), base.AddDate(0, 0, 2))
+	require.NoError(s.T(), err)
+
+	// Assert
+	require.Len(s.T(), all, 3)
+	assert.Equal(s.T(), "day0.pdf", all[0].Filename)
+	assert.Equal(s.T(), "day2.pdf", all[2].Filename)
+	require.Len(s.T(), ranged, 1)
+	assert.Equal(s.T(), "day1.pdf", ranged[0].Filename)
+	assert.NotZero(s.T(), ranged[0].ID)
+	assert.NotZero(s.T(), ranged[0].MessageID)
+	assert.True(s.T(), base.AddDate(0, 0, 1).Equal(ranged[0].ReceivedAt))
+}
+
 // ==================== Delete Tests ====================
 
 func (s *AttachmentRepositoryTestSuite) TestDelete_Success() {
@@ -292,6 +324,27 @@ func (s *AttachmentRepositoryTestSuite) TestDelete_Success() {
 	assert.Contains(s.T(), s.mockStorage.DeletedPaths, "/attachments/todelete.pdf")
 }
 
+func (s *AttachmentRepositoryTestSuite) TestDelete_RemovesPreview() {
+	// Arrange
+	attachment := &models.Attachment{
+		MessageID:   s.testMessage.ID,
+		Filename:    "photo.png",
+		ContentType: "image/png",
+		FilePath:    "ab/photo.png",
+		HasPreview:  true,
+		PreviewPath: "cd/photo-preview.jpg",
+	}
+	require.NoError(s.T(), s.repo.Create(context.Background(), attachment))
+
+	// Act
+	err := s.repo.Delete(context.Background(), attachment.ID)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), s.mockStorage.DeletedPaths, "ab/photo.png")
+	assert.Contains(s.T(), s.mockStorage.DeletedPaths, "cd/photo-preview.jpg")
+}
+
 func (s *AttachmentRepositoryTestSuite) TestDelete_NotFound() {
 	// Act
 	err := s.repo.Delete(context.Background(), 99999)
@@ -321,6 +374,76 @@ func (s *AttachmentRepositoryTestSuite) TestDelete_EmptyFilePath() {
 	assert.Empty(s.T(), s.mockStorage.DeletedPaths)
 }
 
+// ==================== Reconciliation Tests ====================
+
+func (s *AttachmentRepositoryTestSuite) TestListAfterID_PagesInIDOrder() {
+	// Arrange
+	var ids []uint
+	for _, name := range []string{"a.pdf", "b.pdf", "c.pdf"} {
+		attachment := &models.Attachment{MessageID: s.testMessage.ID, Filename: name, FilePath: "x/" + name}
+		require.NoError(s.T(), s.repo.Create(context.Background(), attachment))
+		ids = append(ids, attachment.ID)
+	}
+
+	// Act
+	first, err := s.repo.ListAfterID(context.Background(), 0, 2)
+	require.NoError(s.T(), err)
+	second, err := s.repo.ListAfterID(context.Background(), first[len(first)-1].ID, 2)
+	require.NoError(s.T(), err)
+
+	// Assert
+	require.Len(s.T(), first, 2)
+	require.Len(s.T(), second, 1)
+	assert.Equal(s.T(), ids[0], first[0].ID)
+	assert.Equal(s.T(), ids[1], first[1].ID)
+	assert.Equal(s.T(), ids[2], second[0].ID)
+}
+
+func (s *AttachmentRepositoryTestSuite) TestExistingFilePaths_ReportsReferencedPaths() {
+	// Arrange
+	require.NoError(s.T(), s.repo.Create(context.Background(), &models.Attachment{
+		MessageID: s.testMessage.ID, Filename: "a.png", FilePath: "ab/a.png", PreviewPath: "ef/a-preview.jpg",
+	}))
+
+	// Act
+	existing, err := s.repo.ExistingFilePaths(context.Background(), []string{"ab/a.png", "ef/a-preview.jpg", "cd/orphan.pdf"})
+
+	// Assert
+	require.NoError(s.T(), err)
+	assert.True(s.T(), existing["ab/a.png"])
+	assert.True(s.T(), existing["ef/a-preview.jpg"])
+	assert.False(s.T(), existing["cd/orphan.pdf"])
+}
+
+func (s *AttachmentRepositoryTestSuite) TestExistingFilePaths_Empty() {
+	existing, err := s.repo.ExistingFilePaths(context.Background(), nil)
+
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), existing)
+}
+
+func (s *AttachmentRepositoryTestSuite) TestUpdateFilePath_Success() {
+	// Arrange
+	attachment := &models.Attachment{MessageID: s.testMessage.ID, Filename: "a.pdf", FilePath: "ab/old.pdf"}
+	require.NoError(s.T(), s.repo.Create(context.Background(), attachment))
+
+	// Act
+	err := s.repo.UpdateFilePath(context.Background(), attachment.ID, "blobs/cd/cdef")
+
+	// Assert
+	require.NoError(s.T(), err)
+	updated, err := s.repo.GetByID(context.Background(), attachment.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "blobs/cd/cdef", updated.FilePath)
+	assert.Empty(s.T(), s.mockStorage.DeletedPaths)
+}
+
+func (s *AttachmentRepositoryTestSuite) TestUpdateFilePath_NotFound() {
+	err := s.repo.UpdateFilePath(context.Background(), 99999, "blobs/cd/cdef")
+
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+}
+
 // ==================== CRUD Round-Trip Test ====================
 
 func (s *AttachmentRepositoryTestSuite) TestCRUD_RoundTrip() {
@@ -417,3 +540,23 @@ func (s *AttachmentRepositoryTestSuite) TestCreate_VariousSizes() {
 		assert.Equal(s.T(), size, retrieved.SizeBytes)
 	}
 }
+
+func (s *AttachmentRepositoryTestSuite) TestSetPreviewPath_OnlyOnce() {
+	// Arrange
+	attachment := &models.Attachment{MessageID: s.testMessage.ID, Filename: "a.png", FilePath: "ab/a.png"}
+	require.NoError(s.T(), s.repo.Create(context.Background(), attachment))
+
+	// Act
+	first, err := s.repo.SetPreviewPath(context.Background(), attachment.ID, "blobs/cd/first")
+	require.NoError(s.T(), err)
+	second, err := s.repo.SetPreviewPath(context.Background(), attachment.ID, "blobs/cd/second")
+	require.NoError(s.T(), err)
+
+	// Assert
+	assert.True(s.T(), first)
+	assert.False(s.T(), second)
+	found, err := s.repo.GetByID(context.Background(), attachment.ID)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), found.HasPreview)
+	assert.Equal(s.T(), "blobs/cd/first", found.PreviewPath)
+}
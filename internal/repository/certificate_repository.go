@@ -56,6 +56,9 @@ func NewCertificateRepository(db *gorm.DB) CertificateRepository {
 
 // Create creates a new certificate record
 func (r *certificateRepository) Create(ctx context.Context, cert *models.DomainCertificate) error {
+	if err := owns(ctx, r.db, &models.Domain{}, scopeTenant(ctx, "tenant_id"), cert.DomainID); err != nil {
+		return err
+	}
 	result := r.db.WithContext(ctx).Create(cert)
 	if result.Error != nil {
 		if isDuplicateKeyError(result.Error) {
@@ -69,7 +72,7 @@ func (r *certificateRepository) Create(ctx context.Context, cert *models.DomainC
 // GetByID retrieves a certificate by its ID
 func (r *certificateRepository) GetByID(ctx context.Context, id uint) (*models.DomainCertificate, error) {
 	var cert models.DomainCertificate
-	result := r.db.WithContext(ctx).First(&cert, id)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).First(&cert, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -82,7 +85,7 @@ func (r *certificateRepository) GetByID(ctx context.Context, id uint) (*models.D
 // GetByDomainID retrieves a certificate by domain ID
 func (r *certificateRepository) GetByDomainID(ctx context.Context, domainID uint) (*models.DomainCertificate, error) {
 	var cert models.DomainCertificate
-	result := r.db.WithContext(ctx).Where("domain_id = ?", domainID).First(&cert)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).Where("domain_id = ?", domainID).First(&cert)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -95,7 +98,7 @@ func (r *certificateRepository) GetByDomainID(ctx context.Context, domainID uint
 // GetByDomainName retrieves a certificate by domain name
 func (r *certificateRepository) GetByDomainName(ctx context.Context, domainName string) (*models.DomainCertificate, error) {
 	var cert models.DomainCertificate
-	result := r.db.WithContext(ctx).Where("domain_name = ?", domainName).First(&cert)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).Where("domain_name = ?", domainName).First(&cert)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -107,6 +110,10 @@ func (r *certificateRepository) GetByDomainName(ctx context.Context, domainName
 
 // Update updates an existing certificate record
 func (r *certificateRepository) Update(ctx context.Context, cert *models.DomainCertificate) error {
+	// Save inserts rows it cannot find, so ownership is checked first
+	if err := owns(ctx, r.db, &models.DomainCertificate{}, scopeDomains(ctx, "domain_id"), cert.ID); err != nil {
+		return err
+	}
 	result := r.db.WithContext(ctx).Save(cert)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update certificate: %w", result.Error)
@@ -119,7 +126,7 @@ func (r *certificateRepository) Update(ctx context.Context, cert *models.DomainC
 
 // Delete deletes a certificate by its ID
 func (r *certificateRepository) Delete(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Delete(&models.DomainCertificate{}, id)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).Delete(&models.DomainCertificate{}, id)
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete certificate: %w", result.Error)
 	}
@@ -131,7 +138,7 @@ func (r *certificateRepository) Delete(ctx context.Context, id uint) error {
 
 // DeleteByDomainID deletes a certificate by domain ID
 func (r *certificateRepository) DeleteByDomainID(ctx context.Context, domainID uint) error {
-	result := r.db.WithContext(ctx).Where("domain_id = ?", domainID).Delete(&models.DomainCertificate{})
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).Where("domain_id = ?", domainID).Delete(&models.DomainCertificate{})
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete certificate by domain ID: %w", result.Error)
 	}
@@ -144,6 +151,7 @@ func (r *certificateRepository) GetExpiringCertificates(ctx context.Context, day
 	expiryThreshold := time.Now().AddDate(0, 0, days)
 
 	result := r.db.WithContext(ctx).
+		Scopes(scopeDomains(ctx, "domain_id")).
 		Where("expires_at <= ? AND expires_at > ?", expiryThreshold, time.Now()).
 		Order("expires_at ASC").
 		Find(&certs)
@@ -158,6 +166,7 @@ func (r *certificateRepository) GetExpiringCertificates(ctx context.Context, day
 func (r *certificateRepository) GetAllWithAutoRenew(ctx context.Context) ([]models.DomainCertificate, error) {
 	var certs []models.DomainCertificate
 	result := r.db.WithContext(ctx).
+		Scopes(scopeDomains(ctx, "domain_id")).
 		Where("auto_renew = ?", true).
 		Order("expires_at ASC").
 		Find(&certs)
@@ -171,7 +180,7 @@ func (r *certificateRepository) GetAllWithAutoRenew(ctx context.Context) ([]mode
 // List returns all certificates
 func (r *certificateRepository) List(ctx context.Context) ([]models.DomainCertificate, error) {
 	var certs []models.DomainCertificate
-	result := r.db.WithContext(ctx).Order("domain_name ASC").Find(&certs)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).Order("domain_name ASC").Find(&certs)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to list certificates: %w", result.Error)
 	}
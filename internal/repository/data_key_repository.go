@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DataKeyRepository defines the interface for wrapped data key access.
+// It implements storage.DataKeyStore, so lookups of unknown paths return
+// storage.ErrDataKeyNotFound rather than ErrNotFound.
+type DataKeyRepository interface {
+	storage.DataKeyStore
+	ListNotWrappedBy(ctx context.Context, masterKeyID, afterPath string, limit int) ([]models.DataKey, error)
+	UpdateWrappedKey(ctx context.Context, filePath, masterKeyID string, wrappedKey []byte) error
+}
+
+// dataKeyRepository implements DataKeyRepository using GORM
+type dataKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewDataKeyRepository creates a new DataKeyRepository instance
+func NewDataKeyRepository(db *gorm.DB) DataKeyRepository {
+	return &dataKeyRepository{db: db}
+}
+
+// SaveDataKey stores the wrapped data key of a file, replacing any previous key for the path
+func (r *dataKeyRepository) SaveDataKey(ctx context.Context, filePath, masterKeyID string, wrappedKey []byte) error {
+	dataKey := &models.DataKey{FilePath: filePath, MasterKeyID: masterKeyID, WrappedKey: wrappedKey}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"master_key_id", "wrapped_key"}),
+	}).Create(dataKey)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save data key: %w", result.Error)
+	}
+	return nil
+}
+
+// GetDataKey retrieves the wrapped data key of a file
+func (r *dataKeyRepository) GetDataKey(ctx context.Context, filePath string) (string, []byte, error) {
+	var dataKey models.DataKey
+	result := r.db.WithContext(ctx).Where("file_path = ?", filePath).First(&dataKey)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return "", nil, storage.ErrDataKeyNotFound
+		}
+		return "", nil, fmt.Errorf("failed to get data key: %w", result.Error)
+	}
+	return dataKey.MasterKeyID, dataKey.WrappedKey, nil
+}
+
+// DeleteDataKey removes the data key of a file; deleting a missing key is not an error
+func (r *dataKeyRepository) DeleteDataKey(ctx context.Context, filePath string) error {
+	result := r.db.WithContext(ctx).Where("file_path = ?", filePath).Delete(&models.DataKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete data key: %w", result.Error)
+	}
+	return nil
+}
+
+// ListNotWrappedBy returns data keys wrapped by any master key other than masterKeyID,
+// ordered by path and starting after afterPath
+func (r *dataKeyRepository) ListNotWrappedBy(ctx context.Context, masterKeyID, afterPath string, limit int) ([]models.DataKey, error) {
+	var dataKeys []models.DataKey
+	result := r.db.WithContext(ctx).
+		Where("master_key_id <> ? AND file_path > ?", masterKeyID, afterPath).
+		Order("file_path ASC").
+		Limit(limit).
+		Find(&dataKeys)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list data keys: %w", result.Error)
+	}
+	return dataKeys, nil
+}
+
+// UpdateWrappedKey replaces the wrapped key of a file after rotation
+func (r *dataKeyRepository) UpdateWrappedKey(ctx context.Context, filePath, masterKeyID string, wrappedKey []byte) error {
+	result := r.db.WithContext(ctx).Model(&models.DataKey{}).
+		Where("file_path = ?", filePath).
+		Updates(map[string]interface{}{"master_key_id": masterKeyID, "wrapped_key": wrappedKey})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update data key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
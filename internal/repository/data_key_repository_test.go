@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DataKeyRepositoryTestSuite is the test suite for DataKeyRepository
+type DataKeyRepositoryTestSuite struct {
+	suite.Suite
+	db   *gorm.DB
+	repo DataKeyRepository
+}
+
+// SetupSuite runs once before all tests
+func (s *DataKeyRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), db.AutoMigrate(&models.DataKey{}))
+
+	s.db = db
+	s.repo = NewDataKeyRepository(db)
+}
+
+// TearDownSuite runs once after all tests
+func (s *DataKeyRepositoryTestSuite) TearDownSuite() {
+	sqlDB, _ := s.db.DB()
+	if sqlDB != nil {
+		sqlDB.Close()
+	}
+}
+
+// SetupTest runs before each test
+func (s *DataKeyRepositoryTestSuite) SetupTest() {
+	s.db.Exec("DELETE FROM data_keys")
+}
+
+func TestDataKeyRepositorySuite(t *testing.T) {
+	suite.Run(t, new(DataKeyRepositoryTestSuite))
+}
+
+func (s *DataKeyRepositoryTestSuite) TestSaveGetDelete() {
+	ctx := context.Background()
+
+	s.NoError(s.repo.SaveDataKey(ctx, "blobs/ab/abc", "key1", []byte("wrapped")))
+
+	keyID, wrapped, err := s.repo.GetDataKey(ctx, "blobs/ab/abc")
+	s.NoError(err)
+	s.Equal("key1", keyID)
+	s.Equal([]byte("wrapped"), wrapped)
+
+	// Saving again replaces the key
+	s.NoError(s.repo.SaveDataKey(ctx, "blobs/ab/abc", "key2", []byte("rewrapped")))
+	keyID, wrapped, err = s.repo.GetDataKey(ctx, "blobs/ab/abc")
+	s.NoError(err)
+	s.Equal("key2", keyID)
+	s.Equal([]byte("rewrapped"), wrapped)
+
+	s.NoError(s.repo.DeleteDataKey(ctx, "blobs/ab/abc"))
+	_, _, err = s.repo.GetDataKey(ctx, "blobs/ab/abc")
+	s.ErrorIs(err, storage.ErrDataKeyNotFound)
+
+	// Deleting a missing key is not an error
+	s.NoError(s.repo.DeleteDataKey(ctx, "blobs/ab/abc"))
+}
+
+func (s *DataKeyRepositoryTestSuite) TestListNotWrappedBy() {
+	ctx := context.Background()
+	s.NoError(s.repo.SaveDataKey(ctx, "a", "old", []byte("1")))
+	s.NoError(s.repo.SaveDataKey(ctx, "b", "new", []byte("2")))
+	s.NoError(s.repo.SaveDataKey(ctx, "c", "old", []byte("3")))
+	s.NoError(s.repo.SaveDataKey(ctx, "d", "older", []byte("4")))
+
+	keys, err := s.repo.ListNotWrappedBy(ctx, "new", "", 2)
+	s.NoError(err)
+	s.Require().Len(keys, 2)
+	s.Equal("a", keys[0].FilePath)
+	s.Equal("c", keys[1].FilePath)
+
+	keys, err = s.repo.ListNotWrappedBy(ctx, "new", "c", 2)
+	s.NoError(err)
+	s.Require().Len(keys, 1)
+	s.Equal("d", keys[0].FilePath)
+}
+
+func (s *DataKeyRepositoryTestSuite) TestUpdateWrappedKey() {
+	ctx := context.Background()
+	s.NoError(s.repo.SaveDataKey(ctx, "a", "old", []byte("1")))
+
+	s.NoError(s.repo.UpdateWrappedKey(ctx, "a", "new", []byte("2")))
+	keyID, wrapped, err := s.repo.GetDataKey(ctx, "a")
+	s.NoError(err)
+	s.Equal("new", keyID)
+	s.Equal([]byte("2"), wrapped)
+
+	s.ErrorIs(s.repo.UpdateWrappedKey(ctx, "missing", "new", []byte("2")), ErrNotFound)
+}
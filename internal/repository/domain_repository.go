@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
 	"gorm.io/gorm"
 )
 
@@ -21,7 +22,8 @@ type DomainRepository interface {
 
 // domainRepository implements DomainRepository using GORM
 type domainRepository struct {
-	db *gorm.DB
+	db          *gorm.DB
+	fileStorage storage.FileStorage
 }
 
 // NewDomainRepository creates a new DomainRepository instance
@@ -29,14 +31,52 @@ func NewDomainRepository(db *gorm.DB) DomainRepository {
 	return &domainRepository{db: db}
 }
 
-// Create creates a new domain
+// NewDomainRepositoryWithStorage creates a DomainRepository that also removes
+// attachment files from storage when domains are deleted
+func NewDomainRepositoryWithStorage(db *gorm.DB, fileStorage storage.FileStorage) DomainRepository {
+	return &domainRepository{db: db, fileStorage: fileStorage}
+}
+
+// Create creates a new domain, owned by the tenant of ctx if there is one, and
+// returns ErrLimitExceeded when its tenant already owns as many as it may
 func (r *domainRepository) Create(ctx context.Context, domain *models.Domain) error {
-	result := r.db.WithContext(ctx).Create(domain)
-	if result.Error != nil {
-		if isDuplicateKeyError(result.Error) {
-			return fmt.Errorf("domain with name '%s' already exists: %w", domain.Name, ErrDuplicateEntry)
+	if tenantID, ok := TenantFromContext(ctx); ok {
+		domain.TenantID = &tenantID
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if domain.TenantID != nil {
+			if err := checkDomainLimit(tx, *domain.TenantID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(domain).Error; err != nil {
+			if isDuplicateKeyError(err) {
+				return fmt.Errorf("domain with name '%s' already exists: %w", domain.Name, ErrDuplicateEntry)
+			}
+			return fmt.Errorf("failed to create domain: %w", err)
 		}
-		return fmt.Errorf("failed to create domain: %w", result.Error)
+		return nil
+	})
+}
+
+// checkDomainLimit returns ErrLimitExceeded when a tenant owns as many domains as it may
+func checkDomainLimit(tx *gorm.DB, tenantID uint) error {
+	tenant, err := lockTenant(tx, tenantID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("tenant %d: %w", tenantID, ErrInvalidInput)
+		}
+		return fmt.Errorf("failed to get tenant: %w", err)
+	}
+	if tenant.MaxDomains == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Domain{}).Where("tenant_id = ?", tenantID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count tenant domains: %w", err)
+	}
+	if count >= int64(tenant.MaxDomains) {
+		return fmt.Errorf("tenant may own %d domains: %w", tenant.MaxDomains, ErrLimitExceeded)
 	}
 	return nil
 }
@@ -44,7 +84,7 @@ func (r *domainRepository) Create(ctx context.Context, domain *models.Domain) er
 // GetByID retrieves a domain by its ID
 func (r *domainRepository) GetByID(ctx context.Context, id uint) (*models.Domain, error) {
 	var domain models.Domain
-	result := r.db.WithContext(ctx).First(&domain, id)
+	result := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "tenant_id")).First(&domain, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -57,7 +97,7 @@ func (r *domainRepository) GetByID(ctx context.Context, id uint) (*models.Domain
 // GetByName retrieves a domain by its name
 func (r *domainRepository) GetByName(ctx context.Context, name string) (*models.Domain, error) {
 	var domain models.Domain
-	result := r.db.WithContext(ctx).Where("name = ?", name).First(&domain)
+	result := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "tenant_id")).Where("name = ?", name).First(&domain)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -70,7 +110,7 @@ func (r *domainRepository) GetByName(ctx context.Context, name string) (*models.
 // List retrieves all domains, optionally filtering by active status
 func (r *domainRepository) List(ctx context.Context, activeOnly bool) ([]models.Domain, error) {
 	var domains []models.Domain
-	query := r.db.WithContext(ctx)
+	query := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "tenant_id"))
 	
 	if activeOnly {
 		query = query.Where("is_active = ?", true)
@@ -83,8 +123,29 @@ func (r *domainRepository) List(ctx context.Context, activeOnly bool) ([]models.
 	return domains, nil
 }
 
-// Update updates an existing domain
+// Update updates an existing domain; tenants cannot give their domains away
 func (r *domainRepository) Update(ctx context.Context, domain *models.Domain) error {
+	// Save inserts rows it cannot find, so ownership is checked first
+	if tenantID, ok := TenantFromContext(ctx); ok {
+		if err := owns(ctx, r.db, &models.Domain{}, scopeTenant(ctx, "tenant_id"), domain.ID); err != nil {
+			return err
+		}
+		domain.TenantID = &tenantID
+	} else if domain.TenantID != nil {
+		// Domains given to another tenant count against its limit
+		var current models.Domain
+		if err := r.db.WithContext(ctx).Select("tenant_id").First(&current, domain.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to get domain by ID: %w", err)
+		}
+		if current.TenantID == nil || *current.TenantID != *domain.TenantID {
+			if err := checkDomainLimit(r.db.WithContext(ctx), *domain.TenantID); err != nil {
+				return err
+			}
+		}
+	}
 	result := r.db.WithContext(ctx).Save(domain)
 	if result.Error != nil {
 		if isDuplicateKeyError(result.Error) {
@@ -98,14 +159,39 @@ func (r *domainRepository) Update(ctx context.Context, domain *models.Domain) er
 	return nil
 }
 
-// Delete deletes a domain by its ID (cascade deletes mailboxes, messages, attachments)
+// Delete deletes a domain with its mailboxes, messages and attachments by the domain ID.
+// Attachment files are removed from storage only after the transaction commits.
 func (r *domainRepository) Delete(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Delete(&models.Domain{}, id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete domain: %w", result.Error)
+	if err := owns(ctx, r.db, &models.Domain{}, scopeTenant(ctx, "tenant_id"), id); err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+
+	var filePaths []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		mailboxIDs := tx.Model(&models.Mailbox{}).Select("id").Where("domain_id = ?", id)
+		paths, err := deleteMailboxContents(tx, mailboxIDs)
+		if err != nil {
+			return err
+		}
+		filePaths = paths
+
+		if err := tx.Where("domain_id = ?", id).Delete(&models.Mailbox{}).Error; err != nil {
+			return fmt.Errorf("failed to delete mailboxes: %w", err)
+		}
+
+		result := tx.Delete(&models.Domain{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete domain: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+
+	removeFiles(r.fileStorage, filePaths)
 	return nil
 }
@@ -32,7 +32,7 @@ func (s *DomainRepositoryTestSuite) SetupSuite() {
 	db.Exec("PRAGMA foreign_keys = ON")
 
 	// Auto-migrate models
-	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.Attachment{})
+	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{}, &models.MailboxToken{})
 	require.NoError(s.T(), err)
 
 	s.db = db
@@ -365,6 +365,31 @@ func (s *DomainRepositoryTestSuite) TestDelete_CascadeDeletesMailboxes() {
 	assert.ErrorIs(s.T(), err, ErrNotFound)
 }
 
+func (s *DomainRepositoryTestSuite) TestDelete_WithStorageRemovesAttachmentFiles() {
+	// Arrange
+	fileStorage := &MockFileStorageForRepo{}
+	repo := NewDomainRepositoryWithStorage(s.db, fileStorage)
+	domain := &models.Domain{Name: "files.com", IsActive: true}
+	require.NoError(s.T(), repo.Create(context.Background(), domain))
+
+	mailbox := &models.Mailbox{LocalPart: "user", DomainID: domain.ID, FullAddress: "user@files.com"}
+	require.NoError(s.T(), s.db.Create(mailbox).Error)
+	message := &models.Message{MailboxID: mailbox.ID, SenderEmail: "sender@example.com"}
+	require.NoError(s.T(), s.db.Create(message).Error)
+	require.NoError(s.T(), s.db.Create(&models.Attachment{MessageID: message.ID, Filename: "a.pdf", FilePath: "ab/a.pdf"}).Error)
+
+	// Act
+	err := repo.Delete(context.Background(), domain.ID)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"ab/a.pdf"}, fileStorage.DeletedPaths)
+
+	var count int64
+	s.db.Model(&models.Mailbox{}).Where("domain_id = ?", domain.ID).Count(&count)
+	assert.Equal(s.T(), int64(0), count)
+}
+
 // ==================== CRUD Round-Trip Test ====================
 
 func (s *DomainRepositoryTestSuite) TestCRUD_RoundTrip() {
@@ -10,6 +10,7 @@ var (
 	ErrNotFound       = errors.New("record not found")
 	ErrDuplicateEntry = errors.New("duplicate entry")
 	ErrInvalidInput   = errors.New("invalid input")
+	ErrLimitExceeded  = errors.New("tenant limit exceeded")
 )
 
 // isDuplicateKeyError checks if the error is a duplicate key violation
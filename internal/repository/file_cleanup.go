@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/gorm"
+)
+
+// collectStoredPaths returns the storage paths of the attachment files, previews and raw
+// sources of the messages selected by messageIDs, which is either a slice of IDs or a subquery
+func collectStoredPaths(tx *gorm.DB, messageIDs interface{}) ([]string, error) {
+	var filePaths, previewPaths, rawPaths []string
+	if err := tx.Model(&models.Attachment{}).
+		Where("message_id IN (?) AND file_path <> ''", messageIDs).
+		Pluck("file_path", &filePaths).Error; err != nil {
+		return nil, fmt.Errorf("failed to collect attachment paths: %w", err)
+	}
+	if err := tx.Model(&models.Attachment{}).
+		Where("message_id IN (?) AND preview_path <> ''", messageIDs).
+		Pluck("preview_path", &previewPaths).Error; err != nil {
+		return nil, fmt.Errorf("failed to collect preview paths: %w", err)
+	}
+	if err := tx.Model(&models.Message{}).
+		Where("id IN (?) AND raw_path <> ''", messageIDs).
+		Pluck("raw_path", &rawPaths).Error; err != nil {
+		return nil, fmt.Errorf("failed to collect raw source paths: %w", err)
+	}
+	return append(append(filePaths, previewPaths...), rawPaths...), nil
+}
+
+// removeFiles deletes stored files after the rows referencing them were committed as deleted.
+// Errors are ignored: a file that survives here is an orphan the storage reconciler will collect.
+func removeFiles(fileStorage storage.FileStorage, filePaths []string) {
+	if fileStorage == nil {
+		return
+	}
+	for _, path := range filePaths {
+		_ = fileStorage.Delete(path)
+	}
+}
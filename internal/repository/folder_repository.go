@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FolderRepository defines the interface for folder data access
+type FolderRepository interface {
+	EnsureSystemFolders(ctx context.Context, mailboxID uint) error
+	ListByMailbox(ctx context.Context, mailboxID uint) ([]models.FolderWithCounts, error)
+	GetByID(ctx context.Context, id uint) (*models.Folder, error)
+	GetByRole(ctx context.Context, mailboxID uint, role models.FolderRole) (*models.Folder, error)
+	Create(ctx context.Context, folder *models.Folder) error
+	Rename(ctx context.Context, id uint, name string) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// folderRepository implements FolderRepository using GORM
+type folderRepository struct {
+	db *gorm.DB
+}
+
+// NewFolderRepository creates a new FolderRepository instance
+func NewFolderRepository(db *gorm.DB) FolderRepository {
+	return &folderRepository{db: db}
+}
+
+// EnsureSystemFolders creates the system folders a mailbox is missing
+func (r *folderRepository) EnsureSystemFolders(ctx context.Context, mailboxID uint) error {
+	folders := make([]models.Folder, len(models.SystemFolders))
+	for i, folder := range models.SystemFolders {
+		folders[i] = models.Folder{MailboxID: mailboxID, Name: folder.Name, Role: folder.Role}
+	}
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), mailboxID); err != nil {
+		return err
+	}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&folders).Error; err != nil {
+		return fmt.Errorf("failed to create system folders: %w", err)
+	}
+	return nil
+}
+
+// ListByMailbox retrieves the folders of a mailbox with message and unread counts,
+// system folders first. Messages without a folder are counted in the Inbox.
+func (r *folderRepository) ListByMailbox(ctx context.Context, mailboxID uint) ([]models.FolderWithCounts, error) {
+	if err := r.EnsureSystemFolders(ctx, mailboxID); err != nil {
+		return nil, err
+	}
+
+	var results []models.FolderWithCounts
+	query := `
+		SELECT
+			f.*,
+			COALESCE((SELECT COUNT(*) FROM messages m WHERE m.mailbox_id = f.mailbox_id AND ` + folderMatch + `), 0) as message_count,
+			COALESCE((SELECT COUNT(*) FROM messages m WHERE m.mailbox_id = f.mailbox_id AND ` + folderMatch + ` AND m.is_read = false), 0) as unread_count
+		FROM folders f
+		WHERE f.mailbox_id = ?
+	`
+	if err := r.db.WithContext(ctx).Raw(query, mailboxID).Scan(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	order := make(map[models.FolderRole]int, len(models.SystemFolders))
+	for i, folder := range models.SystemFolders {
+		order[folder.Role] = i
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.IsSystem() != b.IsSystem() {
+			return a.IsSystem()
+		}
+		if a.IsSystem() {
+			return order[a.Role] < order[b.Role]
+		}
+		return a.Name < b.Name
+	})
+	return results, nil
+}
+
+// folderMatch matches messages m in folder f; the Inbox also holds messages without a folder
+const folderMatch = `(m.folder_id = f.id OR (m.folder_id IS NULL AND f.role = 'inbox'))`
+
+// GetByID retrieves a folder by its ID
+func (r *folderRepository) GetByID(ctx context.Context, id uint) (*models.Folder, error) {
+	var folder models.Folder
+	result := r.db.WithContext(ctx).Scopes(scopeMailboxes(ctx, "mailbox_id")).First(&folder, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get folder by ID: %w", result.Error)
+	}
+	return &folder, nil
+}
+
+// GetByRole retrieves a system folder of a mailbox, creating the system folders if needed
+func (r *folderRepository) GetByRole(ctx context.Context, mailboxID uint, role models.FolderRole) (*models.Folder, error) {
+	if err := r.EnsureSystemFolders(ctx, mailboxID); err != nil {
+		return nil, err
+	}
+
+	var folder models.Folder
+	result := r.db.WithContext(ctx).Where("mailbox_id = ? AND role = ?", mailboxID, role).First(&folder)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get folder by role: %w", result.Error)
+	}
+	return &folder, nil
+}
+
+// Create creates a new custom folder
+func (r *folderRepository) Create(ctx context.Context, folder *models.Folder) error {
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), folder.MailboxID); err != nil {
+		return err
+	}
+	result := r.db.WithContext(ctx).Create(folder)
+	if result.Error != nil {
+		if isDuplicateKeyError(result.Error) {
+			return fmt.Errorf("folder '%s' already exists: %w", folder.Name, ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to create folder: %w", result.Error)
+	}
+	return nil
+}
+
+// Rename changes the name of a folder
+func (r *folderRepository) Rename(ctx context.Context, id uint, name string) error {
+	result := r.db.WithContext(ctx).Model(&models.Folder{}).Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Where("id = ?", id).Update("name", name)
+	if result.Error != nil {
+		if isDuplicateKeyError(result.Error) {
+			return fmt.Errorf("folder '%s' already exists: %w", name, ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to rename folder: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes a folder; its messages return to the Inbox with new UIDs
+func (r *folderRepository) Delete(ctx context.Context, id uint) error {
+	if err := owns(ctx, r.db, &models.Folder{}, scopeMailboxes(ctx, "mailbox_id"), id); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var moved []uint
+		if err := tx.Model(&models.Message{}).Where("folder_id = ?", id).Pluck("id", &moved).Error; err != nil {
+			return fmt.Errorf("failed to move folder messages: %w", err)
+		}
+		if len(moved) > 0 {
+			if err := recordChanges(tx, models.MessageUpdated, "id IN ?", moved); err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Message{}).Where("id IN ?", moved).Update("folder_id", nil).Error; err != nil {
+				return fmt.Errorf("failed to move folder messages: %w", err)
+			}
+			if _, err := assignUIDs(tx, "id IN ?", moved); err != nil {
+				return err
+			}
+		}
+		result := tx.Delete(&models.Folder{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete folder: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// FolderRepositoryTestSuite is the test suite for FolderRepository
+type FolderRepositoryTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	repo        FolderRepository
+	testMailbox *models.Mailbox
+}
+
+// SetupSuite runs once before all tests
+func (s *FolderRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(s.T(), err)
+	db.Exec("PRAGMA foreign_keys = ON")
+
+	err = db.AutoMigrate(&models.Domain{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{}, &models.Folder{})
+	require.NoError(s.T(), err)
+
+	s.db = db
+	s.repo = NewFolderRepository(db)
+}
+
+// TearDownSuite runs once after all tests
+func (s *FolderRepositoryTestSuite) TearDownSuite() {
+	sqlDB, _ := s.db.DB()
+	if sqlDB != nil {
+		sqlDB.Close()
+	}
+}
+
+// SetupTest runs before each test - clean up data and create a test mailbox
+func (s *FolderRepositoryTestSuite) SetupTest() {
+	s.db.Exec("DELETE FROM messages")
+	s.db.Exec("DELETE FROM folders")
+	s.db.Exec("DELETE FROM mailboxes")
+	s.db.Exec("DELETE FROM domains")
+
+	domain := &models.Domain{Name: "test.com", IsActive: true}
+	require.NoError(s.T(), s.db.Create(domain).Error)
+	s.testMailbox = &models.Mailbox{LocalPart: "user", DomainID: domain.ID, FullAddress: "user@test.com"}
+	require.NoError(s.T(), s.db.Create(s.testMailbox).Error)
+}
+
+// TestFolderRepositoryTestSuite runs the test suite
+func TestFolderRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(FolderRepositoryTestSuite))
+}
+
+func (s *FolderRepositoryTestSuite) TestListByMailbox_CreatesSystemFoldersWithCounts() {
+	// Arrange
+	ctx := context.Background()
+	custom := &models.Folder{MailboxID: s.testMailbox.ID, Name: "Receipts"}
+	require.NoError(s.T(), s.repo.Create(ctx, custom))
+	messages := []models.Message{
+		{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"},
+		{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com", IsRead: true},
+		{MailboxID: s.testMailbox.ID, SenderEmail: "c@example.com", FolderID: &custom.ID},
+	}
+	require.NoError(s.T(), s.db.Create(&messages).Error)
+
+	// Act
+	folders, err := s.repo.ListByMailbox(ctx, s.testMailbox.ID)
+	require.NoError(s.T(), err)
+	again, err := s.repo.ListByMailbox(ctx, s.testMailbox.ID)
+
+	// Assert
+	require.NoError(s.T(), err)
+	require.Len(s.T(), folders, 5)
+	assert.Len(s.T(), again, 5, "system folders must be created once")
+	var names []string
+	for _, folder := range folders {
+		names = append(names, folder.Name)
+	}
+	assert.Equal(s.T(), []string{"Inbox", "Archive", "Junk", "Trash", "Receipts"}, names)
+	assert.Equal(s.T(), int64(2), folders[0].MessageCount)
+	assert.Equal(s.T(), int64(1), folders[0].UnreadCount)
+	assert.Equal(s.T(), int64(1), folders[4].MessageCount)
+}
+
+func (s *FolderRepositoryTestSuite) TestGetByRole() {
+	// Act
+	folder, err := s.repo.GetByRole(context.Background(), s.testMailbox.ID, models.FolderRoleTrash)
+
+	// Assert
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "Trash", folder.Name)
+	assert.True(s.T(), folder.IsSystem())
+}
+
+func (s *FolderRepositoryTestSuite) TestCreateAndRename_Duplicate() {
+	// Arrange
+	ctx := context.Background()
+	require.NoError(s.T(), s.repo.Create(ctx, &models.Folder{MailboxID: s.testMailbox.ID, Name: "Work"}))
+	other := &models.Folder{MailboxID: s.testMailbox.ID, Name: "Home"}
+	require.NoError(s.T(), s.repo.Create(ctx, other))
+
+	// Act
+	createErr := s.repo.Create(ctx, &models.Folder{MailboxID: s.testMailbox.ID, Name: "Work"})
+	renameErr := s.repo.Rename(ctx, other.ID, "Work")
+
+	// Assert
+	assert.ErrorIs(s.T(), createErr, ErrDuplicateEntry)
+	assert.ErrorIs(s.T(), renameErr, ErrDuplicateEntry)
+	assert.ErrorIs(s.T(), s.repo.Rename(ctx, 99999, "Other"), ErrNotFound)
+}
+
+func (s *FolderRepositoryTestSuite) TestDelete_MovesMessagesToInbox() {
+	// Arrange
+	ctx := context.Background()
+	folder := &models.Folder{MailboxID: s.testMailbox.ID, Name: "Work"}
+	require.NoError(s.T(), s.repo.Create(ctx, folder))
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", FolderID: &folder.ID}
+	require.NoError(s.T(), s.db.Create(message).Error)
+
+	// Act
+	err := s.repo.Delete(ctx, folder.ID)
+
+	// Assert
+	require.NoError(s.T(), err)
+	var stored models.Message
+	require.NoError(s.T(), s.db.First(&stored, message.ID).Error)
+	assert.Nil(s.T(), stored.FolderID)
+	assert.ErrorIs(s.T(), s.repo.Delete(ctx, folder.ID), ErrNotFound)
+}
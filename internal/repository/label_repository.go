@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LabelRepository defines the interface for label data access
+type LabelRepository interface {
+	Create(ctx context.Context, label *models.Label) error
+	GetByID(ctx context.Context, id uint) (*models.Label, error)
+	ListByMailbox(ctx context.Context, mailboxID uint) ([]models.Label, error)
+	Update(ctx context.Context, label *models.Label) error
+	Delete(ctx context.Context, id uint) error
+	ListByMessage(ctx context.Context, messageID uint) ([]models.Label, error)
+	SetMessageLabels(ctx context.Context, messageID uint, labelIDs []uint) error
+}
+
+// labelRepository implements LabelRepository using GORM
+type labelRepository struct {
+	db *gorm.DB
+}
+
+// NewLabelRepository creates a new LabelRepository instance
+func NewLabelRepository(db *gorm.DB) LabelRepository {
+	return &labelRepository{db: db}
+}
+
+// Create creates a new label
+func (r *labelRepository) Create(ctx context.Context, label *models.Label) error {
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), label.MailboxID); err != nil {
+		return err
+	}
+	result := r.db.WithContext(ctx).Create(label)
+	if result.Error != nil {
+		if isDuplicateKeyError(result.Error) {
+			return fmt.Errorf("label '%s' already exists: %w", label.Name, ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to create label: %w", result.Error)
+	}
+	return nil
+}
+
+// GetByID retrieves a label by its ID
+func (r *labelRepository) GetByID(ctx context.Context, id uint) (*models.Label, error) {
+	var label models.Label
+	result := r.db.WithContext(ctx).Scopes(scopeMailboxes(ctx, "mailbox_id")).First(&label, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get label by ID: %w", result.Error)
+	}
+	return &label, nil
+}
+
+// ListByMailbox retrieves the labels of a mailbox ordered by name
+func (r *labelRepository) ListByMailbox(ctx context.Context, mailboxID uint) ([]models.Label, error) {
+	var labels []models.Label
+	if err := r.db.WithContext(ctx).Scopes(scopeMailboxes(ctx, "mailbox_id")).Where("mailbox_id = ?", mailboxID).Order("name ASC").Find(&labels).Error; err != nil {
+		return nil, fmt.Errorf("failed to list labels: %w", err)
+	}
+	return labels, nil
+}
+
+// Update saves the name and color of a label
+func (r *labelRepository) Update(ctx context.Context, label *models.Label) error {
+	result := r.db.WithContext(ctx).Model(&models.Label{}).Scopes(scopeMailboxes(ctx, "mailbox_id")).Where("id = ?", label.ID).
+		Updates(map[string]interface{}{"name": label.Name, "color": label.Color})
+	if result.Error != nil {
+		if isDuplicateKeyError(result.Error) {
+			return fmt.Errorf("label '%s' already exists: %w", label.Name, ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to update label: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes a label and removes it from its messages
+func (r *labelRepository) Delete(ctx context.Context, id uint) error {
+	if err := owns(ctx, r.db, &models.Label{}, scopeMailboxes(ctx, "mailbox_id"), id); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("label_id = ?", id).Delete(&models.MessageLabel{}).Error; err != nil {
+			return fmt.Errorf("failed to remove label from messages: %w", err)
+		}
+		result := tx.Delete(&models.Label{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete label: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// ListByMessage retrieves the labels of a message ordered by name
+func (r *labelRepository) ListByMessage(ctx context.Context, messageID uint) ([]models.Label, error) {
+	var labels []models.Label
+	err := r.db.WithContext(ctx).
+		Scopes(scopeMailboxes(ctx, "labels.mailbox_id")).
+		Joins("JOIN message_labels ml ON ml.label_id = labels.id").
+		Where("ml.message_id = ?", messageID).
+		Order("labels.name ASC").
+		Find(&labels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message labels: %w", err)
+	}
+	return labels, nil
+}
+
+// SetMessageLabels replaces the labels of a message
+func (r *labelRepository) SetMessageLabels(ctx context.Context, messageID uint, labelIDs []uint) error {
+	if err := owns(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), messageID); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", messageID).Delete(&models.MessageLabel{}).Error; err != nil {
+			return fmt.Errorf("failed to clear message labels: %w", err)
+		}
+		if len(labelIDs) == 0 {
+			return nil
+		}
+
+		rows := make([]models.MessageLabel, 0, len(labelIDs))
+		seen := make(map[uint]bool, len(labelIDs))
+		for _, labelID := range labelIDs {
+			if !seen[labelID] {
+				seen[labelID] = true
+				rows = append(rows, models.MessageLabel{MessageID: messageID, LabelID: labelID})
+			}
+		}
+		if err := tx.Omit(clause.Associations).Create(&rows).Error; err != nil {
+			return fmt.Errorf("failed to set message labels: %w", err)
+		}
+		return nil
+	})
+}
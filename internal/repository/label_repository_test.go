@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// LabelRepositoryTestSuite is the test suite for LabelRepository
+type LabelRepositoryTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	repo        LabelRepository
+	testMailbox *models.Mailbox
+	testMessage *models.Message
+}
+
+// SetupSuite runs once before all tests
+func (s *LabelRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(s.T(), err)
+	db.Exec("PRAGMA foreign_keys = ON")
+
+	err = db.AutoMigrate(&models.Domain{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{},
+		&models.Label{}, &models.MessageLabel{})
+	require.NoError(s.T(), err)
+
+	s.db = db
+	s.repo = NewLabelRepository(db)
+}
+
+// TearDownSuite runs once after all tests
+func (s *LabelRepositoryTestSuite) TearDownSuite() {
+	sqlDB, _ := s.db.DB()
+	if sqlDB != nil {
+		sqlDB.Close()
+	}
+}
+
+// SetupTest runs before each test - clean up data and create a test message
+func (s *LabelRepositoryTestSuite) SetupTest() {
+	s.db.Exec("DELETE FROM message_labels")
+	s.db.Exec("DELETE FROM labels")
+	s.db.Exec("DELETE FROM messages")
+	s.db.Exec("DELETE FROM mailboxes")
+	s.db.Exec("DELETE FROM domains")
+
+	domain := &models.Domain{Name: "test.com", IsActive: true}
+	require.NoError(s.T(), s.db.Create(domain).Error)
+	s.testMailbox = &models.Mailbox{LocalPart: "user", DomainID: domain.ID, FullAddress: "user@test.com"}
+	require.NoError(s.T(), s.db.Create(s.testMailbox).Error)
+	s.testMessage = &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"}
+	require.NoError(s.T(), s.db.Create(s.testMessage).Error)
+}
+
+// TestLabelRepositoryTestSuite runs the test suite
+func TestLabelRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(LabelRepositoryTestSuite))
+}
+
+// createLabel stores a label of the test mailbox
+func (s *LabelRepositoryTestSuite) createLabel(name string) *models.Label {
+	label := &models.Label{MailboxID: s.testMailbox.ID, Name: name, Color: models.DefaultLabelColor}
+	require.NoError(s.T(), s.repo.Create(context.Background(), label))
+	return label
+}
+
+func (s *LabelRepositoryTestSuite) TestCreate_Duplicate() {
+	// Arrange
+	s.createLabel("work")
+
+	// Act
+	err := s.repo.Create(context.Background(), &models.Label{MailboxID: s.testMailbox.ID, Name: "work", Color: "#ff0000"})
+
+	// Assert
+	assert.ErrorIs(s.T(), err, ErrDuplicateEntry)
+}
+
+func (s *LabelRepositoryTestSuite) TestUpdate() {
+	// Arrange
+	label := s.createLabel("work")
+	label.Name = "office"
+	label.Color = "#00ff00"
+
+	// Act
+	err := s.repo.Update(context.Background(), label)
+
+	// Assert
+	require.NoError(s.T(), err)
+	found, err := s.repo.GetByID(context.Background(), label.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "office", found.Name)
+	assert.Equal(s.T(), "#00ff00", found.Color)
+	assert.ErrorIs(s.T(), s.repo.Update(context.Background(), &models.Label{ID: 99999}), ErrNotFound)
+}
+
+func (s *LabelRepositoryTestSuite) TestSetMessageLabels_ReplacesAndLists() {
+	// Arrange
+	ctx := context.Background()
+	work := s.createLabel("work")
+	home := s.createLabel("home")
+	travel := s.createLabel("travel")
+	require.NoError(s.T(), s.repo.SetMessageLabels(ctx, s.testMessage.ID, []uint{work.ID, travel.ID}))
+
+	// Act
+	err := s.repo.SetMessageLabels(ctx, s.testMessage.ID, []uint{home.ID, work.ID, home.ID})
+
+	// Assert
+	require.NoError(s.T(), err)
+	labels, err := s.repo.ListByMessage(ctx, s.testMessage.ID)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), labels, 2)
+	assert.Equal(s.T(), "home", labels[0].Name)
+	assert.Equal(s.T(), "work", labels[1].Name)
+}
+
+func (s *LabelRepositoryTestSuite) TestDelete_RemovesFromMessages() {
+	// Arrange
+	ctx := context.Background()
+	label := s.createLabel("work")
+	require.NoError(s.T(), s.repo.SetMessageLabels(ctx, s.testMessage.ID, []uint{label.ID}))
+
+	// Act
+	err := s.repo.Delete(ctx, label.ID)
+
+	// Assert
+	require.NoError(s.T(), err)
+	labels, err := s.repo.ListByMessage(ctx, s.testMessage.ID)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), labels)
+	assert.ErrorIs(s.T(), s.repo.Delete(ctx, label.ID), ErrNotFound)
+}
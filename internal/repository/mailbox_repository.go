@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
 	"gorm.io/gorm"
 )
 
@@ -19,11 +20,15 @@ type MailboxRepository interface {
 	ListByDomain(ctx context.Context, domainID uint, limit, offset int) ([]models.MailboxWithUnreadCount, int64, error)
 	UpdateLastAccessed(ctx context.Context, id uint) error
 	Delete(ctx context.Context, id uint) error
+	ListInactive(ctx context.Context, domainID uint, since time.Time, limit int) ([]models.Mailbox, error)
+	CountInactive(ctx context.Context, domainID uint, since time.Time) (int64, error)
+	DeleteByIDs(ctx context.Context, ids []uint) ([]string, error)
 }
 
 // mailboxRepository implements MailboxRepository using GORM
 type mailboxRepository struct {
-	db *gorm.DB
+	db          *gorm.DB
+	fileStorage storage.FileStorage
 }
 
 // NewMailboxRepository creates a new MailboxRepository instance
@@ -31,14 +36,60 @@ func NewMailboxRepository(db *gorm.DB) MailboxRepository {
 	return &mailboxRepository{db: db}
 }
 
-// Create creates a new mailbox
+// NewMailboxRepositoryWithStorage creates a MailboxRepository that also removes
+// attachment files from storage when mailboxes are deleted
+func NewMailboxRepositoryWithStorage(db *gorm.DB, fileStorage storage.FileStorage) MailboxRepository {
+	return &mailboxRepository{db: db, fileStorage: fileStorage}
+}
+
+// Create creates a new mailbox in a domain of the tenant of ctx, if there is
+// one, and returns ErrLimitExceeded when the tenant owning the domain already
+// has as many mailboxes as it may
 func (r *mailboxRepository) Create(ctx context.Context, mailbox *models.Mailbox) error {
-	result := r.db.WithContext(ctx).Create(mailbox)
-	if result.Error != nil {
-		if isDuplicateKeyError(result.Error) {
-			return fmt.Errorf("mailbox with address '%s' already exists: %w", mailbox.FullAddress, ErrDuplicateEntry)
+	if err := owns(ctx, r.db, &models.Domain{}, scopeTenant(ctx, "tenant_id"), mailbox.DomainID); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkMailboxLimit(tx, mailbox.DomainID); err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to create mailbox: %w", result.Error)
+		if err := tx.Create(mailbox).Error; err != nil {
+			if isDuplicateKeyError(err) {
+				return fmt.Errorf("mailbox with address '%s' already exists: %w", mailbox.FullAddress, ErrDuplicateEntry)
+			}
+			return fmt.Errorf("failed to create mailbox: %w", err)
+		}
+		return nil
+	})
+}
+
+// checkMailboxLimit returns ErrLimitExceeded when the tenant owning a domain has
+// as many mailboxes as it may. Mail to new addresses counts too, so the limit
+// holds for mailboxes created by the SMTP server.
+func checkMailboxLimit(tx *gorm.DB, domainID uint) error {
+	var domain models.Domain
+	if err := tx.Select("id", "tenant_id").First(&domain, domainID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("domain %d: %w", domainID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to get domain: %w", err)
+	}
+	if domain.TenantID == nil {
+		return nil
+	}
+	tenant, err := lockTenant(tx, *domain.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant of domain: %w", err)
+	}
+	if tenant.MaxMailboxes == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Mailbox{}).Where("domain_id IN (?)", tenantDomainIDs(tx, tenant.ID)).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count tenant mailboxes: %w", err)
+	}
+	if count >= int64(tenant.MaxMailboxes) {
+		return fmt.Errorf("tenant may own %d mailboxes: %w", tenant.MaxMailboxes, ErrLimitExceeded)
 	}
 	return nil
 }
@@ -46,7 +97,7 @@ func (r *mailboxRepository) Create(ctx context.Context, mailbox *models.Mailbox)
 // GetByID retrieves a mailbox by its ID
 func (r *mailboxRepository) GetByID(ctx context.Context, id uint) (*models.Mailbox, error) {
 	var mailbox models.Mailbox
-	result := r.db.WithContext(ctx).First(&mailbox, id)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).First(&mailbox, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -59,7 +110,7 @@ func (r *mailboxRepository) GetByID(ctx context.Context, id uint) (*models.Mailb
 // GetByAddress retrieves a mailbox by its full email address
 func (r *mailboxRepository) GetByAddress(ctx context.Context, fullAddress string) (*models.Mailbox, error) {
 	var mailbox models.Mailbox
-	result := r.db.WithContext(ctx).Where("full_address = ?", fullAddress).First(&mailbox)
+	result := r.db.WithContext(ctx).Scopes(scopeDomains(ctx, "domain_id")).Where("full_address = ?", fullAddress).First(&mailbox)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -107,6 +158,13 @@ func (r *mailboxRepository) GetOrCreate(ctx context.Context, localPart string, d
 
 // ListByDomain retrieves all mailboxes for a domain with pagination and unread count
 func (r *mailboxRepository) ListByDomain(ctx context.Context, domainID uint, limit, offset int) ([]models.MailboxWithUnreadCount, int64, error) {
+	if err := owns(ctx, r.db, &models.Domain{}, scopeTenant(ctx, "tenant_id"), domainID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return []models.MailboxWithUnreadCount{}, 0, nil
+		}
+		return nil, 0, err
+	}
+
 	var total int64
 	
 	// Count total mailboxes for this domain
@@ -137,7 +195,7 @@ func (r *mailboxRepository) ListByDomain(ctx context.Context, domainID uint, lim
 // UpdateLastAccessed updates the last_accessed_at timestamp for a mailbox
 func (r *mailboxRepository) UpdateLastAccessed(ctx context.Context, id uint) error {
 	now := time.Now()
-	result := r.db.WithContext(ctx).Model(&models.Mailbox{}).Where("id = ?", id).Update("last_accessed_at", now)
+	result := r.db.WithContext(ctx).Model(&models.Mailbox{}).Scopes(scopeDomains(ctx, "domain_id")).Where("id = ?", id).Update("last_accessed_at", now)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update last accessed: %w", result.Error)
 	}
@@ -147,14 +205,117 @@ func (r *mailboxRepository) UpdateLastAccessed(ctx context.Context, id uint) err
 	return nil
 }
 
-// Delete deletes a mailbox by its ID (cascade deletes messages and attachments)
+// Delete deletes a mailbox with its messages and attachments by the mailbox ID.
+// Attachment files are removed from storage only after the transaction commits.
 func (r *mailboxRepository) Delete(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Delete(&models.Mailbox{}, id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete mailbox: %w", result.Error)
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), id); err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+
+	var filePaths []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		paths, err := deleteMailboxContents(tx, tx.Model(&models.Mailbox{}).Select("id").Where("id = ?", id))
+		if err != nil {
+			return err
+		}
+		filePaths = paths
+
+		result := tx.Delete(&models.Mailbox{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete mailbox: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+
+	removeFiles(r.fileStorage, filePaths)
 	return nil
 }
+
+// deleteMailboxContents deletes the messages, attachment rows and tokens of the
+// mailboxes selected by mailboxIDs and returns the storage paths of their files
+func deleteMailboxContents(tx *gorm.DB, mailboxIDs *gorm.DB) ([]string, error) {
+	messageIDs := tx.Model(&models.Message{}).Select("id").Where("mailbox_id IN (?)", mailboxIDs)
+
+	filePaths, err := collectStoredPaths(tx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("message_id IN (?)", messageIDs).Delete(&models.Attachment{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete attachments: %w", err)
+	}
+	if err := tx.Where("mailbox_id IN (?)", mailboxIDs).Delete(&models.Message{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete messages: %w", err)
+	}
+	if err := tx.Where("mailbox_id IN (?)", mailboxIDs).Delete(&models.MailboxToken{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete mailbox tokens: %w", err)
+	}
+	return filePaths, nil
+}
+
+// inactiveMailboxCondition matches mailboxes that were neither accessed nor received mail since the cutoff
+const inactiveMailboxCondition = `mailboxes.domain_id = ? AND COALESCE(mailboxes.last_accessed_at, mailboxes.created_at) < ?
+	AND NOT EXISTS (SELECT 1 FROM messages msg WHERE msg.mailbox_id = mailboxes.id AND msg.received_at >= ?)`
+
+// ListInactive retrieves mailboxes in a domain with no access and no new mail since the given time
+func (r *mailboxRepository) ListInactive(ctx context.Context, domainID uint, since time.Time, limit int) ([]models.Mailbox, error) {
+	var mailboxes []models.Mailbox
+	result := r.db.WithContext(ctx).
+		Scopes(scopeDomains(ctx, "mailboxes.domain_id")).
+		Where(inactiveMailboxCondition, domainID, since, since).
+		Order("mailboxes.id ASC").
+		Limit(limit).
+		Find(&mailboxes)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list inactive mailboxes: %w", result.Error)
+	}
+	return mailboxes, nil
+}
+
+// CountInactive counts mailboxes in a domain with no access and no new mail since the given time
+func (r *mailboxRepository) CountInactive(ctx context.Context, domainID uint, since time.Time) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&models.Mailbox{}).
+		Scopes(scopeDomains(ctx, "mailboxes.domain_id")).
+		Where(inactiveMailboxCondition, domainID, since, since).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count inactive mailboxes: %w", result.Error)
+	}
+	return count, nil
+}
+
+// DeleteByIDs deletes the given mailboxes together with their messages and attachment rows.
+// Returns the storage paths of the deleted attachments so the caller can remove the files.
+func (r *mailboxRepository) DeleteByIDs(ctx context.Context, ids []uint) ([]string, error) {
+	ids, err := ownedIDs(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var filePaths []string
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		paths, err := deleteMailboxContents(tx, tx.Model(&models.Mailbox{}).Select("id").Where("id IN ?", ids))
+		if err != nil {
+			return err
+		}
+		filePaths = paths
+
+		if err := tx.Where("id IN ?", ids).Delete(&models.Mailbox{}).Error; err != nil {
+			return fmt.Errorf("failed to delete mailboxes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filePaths, nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -34,7 +35,7 @@ func (s *MailboxRepositoryTestSuite) SetupSuite() {
 	db.Exec("PRAGMA foreign_keys = ON")
 
 	// Auto-migrate models
-	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.Attachment{})
+	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{}, &models.MailboxToken{})
 	require.NoError(s.T(), err)
 
 	s.db = db
@@ -401,6 +402,29 @@ func (s *MailboxRepositoryTestSuite) TestDelete_CascadeDeletesMessages() {
 	assert.ErrorIs(s.T(), err, ErrNotFound)
 }
 
+func (s *MailboxRepositoryTestSuite) TestDelete_WithStorageRemovesAttachmentFiles() {
+	// Arrange
+	fileStorage := &MockFileStorageForRepo{}
+	repo := NewMailboxRepositoryWithStorage(s.db, fileStorage)
+	mailbox := &models.Mailbox{LocalPart: "files", DomainID: s.testDomain.ID, FullAddress: "files@test.com"}
+	require.NoError(s.T(), repo.Create(context.Background(), mailbox))
+
+	message := &models.Message{MailboxID: mailbox.ID, SenderEmail: "sender@example.com"}
+	require.NoError(s.T(), s.db.Create(message).Error)
+	require.NoError(s.T(), s.db.Create(&models.Attachment{MessageID: message.ID, Filename: "a.pdf", FilePath: "ab/a.pdf"}).Error)
+
+	// Act
+	err := repo.Delete(context.Background(), mailbox.ID)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"ab/a.pdf"}, fileStorage.DeletedPaths)
+
+	var count int64
+	s.db.Model(&models.Message{}).Where("mailbox_id = ?", mailbox.ID).Count(&count)
+	assert.Equal(s.T(), int64(0), count)
+}
+
 // ==================== CRUD Round-Trip Test ====================
 
 func (s *MailboxRepositoryTestSuite) TestCRUD_RoundTrip() {
@@ -441,3 +465,53 @@ func (s *MailboxRepositoryTestSuite) TestCRUD_RoundTrip() {
 	_, err = s.repo.GetByID(context.Background(), mailbox.ID)
 	assert.ErrorIs(s.T(), err, ErrNotFound)
 }
+
+// ==================== Retention Tests ====================
+
+func (s *MailboxRepositoryTestSuite) TestListInactive() {
+	// Arrange
+	now := time.Now()
+	stale := &models.Mailbox{LocalPart: "stale", DomainID: s.testDomain.ID, FullAddress: "stale@test.com", CreatedAt: now.AddDate(0, 0, -30)}
+	recentlyRead := &models.Mailbox{LocalPart: "read", DomainID: s.testDomain.ID, FullAddress: "read@test.com", CreatedAt: now.AddDate(0, 0, -30)}
+	recentMail := &models.Mailbox{LocalPart: "mail", DomainID: s.testDomain.ID, FullAddress: "mail@test.com", CreatedAt: now.AddDate(0, 0, -30)}
+	fresh := &models.Mailbox{LocalPart: "fresh", DomainID: s.testDomain.ID, FullAddress: "fresh@test.com"}
+	for _, mb := range []*models.Mailbox{stale, recentlyRead, recentMail, fresh} {
+		require.NoError(s.T(), s.repo.Create(context.Background(), mb))
+	}
+	require.NoError(s.T(), s.repo.UpdateLastAccessed(context.Background(), recentlyRead.ID))
+	require.NoError(s.T(), s.db.Create(&models.Message{MailboxID: recentMail.ID, SenderEmail: "a@example.com"}).Error)
+
+	// Act
+	cutoff := now.AddDate(0, 0, -7)
+	mailboxes, err := s.repo.ListInactive(context.Background(), s.testDomain.ID, cutoff, 10)
+	count, countErr := s.repo.CountInactive(context.Background(), s.testDomain.ID, cutoff)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), countErr)
+	require.Len(s.T(), mailboxes, 1)
+	assert.Equal(s.T(), stale.ID, mailboxes[0].ID)
+	assert.Equal(s.T(), int64(1), count)
+}
+
+func (s *MailboxRepositoryTestSuite) TestDeleteByIDs_ReturnsAttachmentPaths() {
+	// Arrange
+	mailbox := &models.Mailbox{LocalPart: "gone", DomainID: s.testDomain.ID, FullAddress: "gone@test.com"}
+	require.NoError(s.T(), s.repo.Create(context.Background(), mailbox))
+	message := &models.Message{MailboxID: mailbox.ID, SenderEmail: "a@example.com"}
+	require.NoError(s.T(), s.db.Create(message).Error)
+	require.NoError(s.T(), s.db.Create(&models.Attachment{MessageID: message.ID, Filename: "a.pdf", FilePath: "ab/a.pdf"}).Error)
+
+	// Act
+	paths, err := s.repo.DeleteByIDs(context.Background(), []uint{mailbox.ID})
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"ab/a.pdf"}, paths)
+	_, err = s.repo.GetByID(context.Background(), mailbox.ID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+
+	var messages int64
+	s.db.Model(&models.Message{}).Where("mailbox_id = ?", mailbox.ID).Count(&messages)
+	assert.Zero(s.T(), messages)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MailboxTokenRepository defines the interface for mailbox token data access
+type MailboxTokenRepository interface {
+	Create(ctx context.Context, token *models.MailboxToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*models.MailboxToken, error)
+	ListByMailbox(ctx context.Context, mailboxID uint) ([]models.MailboxToken, error)
+	Delete(ctx context.Context, mailboxID, id uint) error
+}
+
+// mailboxTokenRepository implements MailboxTokenRepository using GORM
+type mailboxTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewMailboxTokenRepository creates a new MailboxTokenRepository instance
+func NewMailboxTokenRepository(db *gorm.DB) MailboxTokenRepository {
+	return &mailboxTokenRepository{db: db}
+}
+
+// Create creates a new mailbox token
+func (r *mailboxTokenRepository) Create(ctx context.Context, token *models.MailboxToken) error {
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), token.MailboxID); err != nil {
+		return err
+	}
+	if err := r.db.WithContext(ctx).Create(token).Error; err != nil {
+		if isDuplicateKeyError(err) {
+			return fmt.Errorf("mailbox token already exists: %w", ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to create mailbox token: %w", err)
+	}
+	return nil
+}
+
+// GetByHash retrieves a token by the hash of its value
+func (r *mailboxTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.MailboxToken, error) {
+	var token models.MailboxToken
+	result := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get mailbox token: %w", result.Error)
+	}
+	return &token, nil
+}
+
+// ListByMailbox retrieves the tokens of a mailbox, oldest first
+func (r *mailboxTokenRepository) ListByMailbox(ctx context.Context, mailboxID uint) ([]models.MailboxToken, error) {
+	var tokens []models.MailboxToken
+	if err := r.db.WithContext(ctx).Scopes(scopeMailboxes(ctx, "mailbox_id")).Where("mailbox_id = ?", mailboxID).Order("id ASC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to list mailbox tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Delete revokes a token of a mailbox
+func (r *mailboxTokenRepository) Delete(ctx context.Context, mailboxID, id uint) error {
+	result := r.db.WithContext(ctx).Scopes(scopeMailboxes(ctx, "mailbox_id")).Where("mailbox_id = ?", mailboxID).Delete(&models.MailboxToken{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete mailbox token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
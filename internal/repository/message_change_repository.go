@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageChangeRepository reads the log of message changes the message and folder
+// repositories record, which lets clients sync by state instead of refetching.
+// Changes are numbered per mailbox by Seq in the order they commit.
+type MessageChangeRepository interface {
+	LatestSeq(ctx context.Context, mailboxID uint) (uint, error)
+	OldestSeq(ctx context.Context, mailboxID uint) (uint, error)
+	HasChangesSince(ctx context.Context, mailboxID, sinceSeq uint) (bool, error)
+	ListSince(ctx context.Context, mailboxID, sinceSeq uint, limit int) ([]models.MessageChange, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// messageChangeRepository implements MessageChangeRepository using GORM
+type messageChangeRepository struct {
+	db *gorm.DB
+}
+
+// NewMessageChangeRepository creates a new MessageChangeRepository instance
+func NewMessageChangeRepository(db *gorm.DB) MessageChangeRepository {
+	return &messageChangeRepository{db: db}
+}
+
+// LatestSeq returns the Seq of the newest change of a mailbox, or 0 when none was recorded
+func (r *messageChangeRepository) LatestSeq(ctx context.Context, mailboxID uint) (uint, error) {
+	var seqs []uint
+	err := r.db.WithContext(ctx).Model(&models.Mailbox{}).
+		Scopes(scopeMailboxes(ctx, "id")).
+		Where("id = ?", mailboxID).
+		Pluck("change_seq", &seqs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest message change: %w", err)
+	}
+	if len(seqs) == 0 {
+		return 0, nil
+	}
+	return seqs[0], nil
+}
+
+// OldestSeq returns the Seq of the oldest change of a mailbox still kept, or 0 when none is
+func (r *messageChangeRepository) OldestSeq(ctx context.Context, mailboxID uint) (uint, error) {
+	var seq uint
+	err := r.db.WithContext(ctx).Model(&models.MessageChange{}).
+		Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Where("mailbox_id = ?", mailboxID).
+		Select("COALESCE(MIN(seq), 0)").
+		Scan(&seq).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get oldest message change: %w", err)
+	}
+	return seq, nil
+}
+
+// HasChangesSince reports whether messages of a mailbox changed after sinceSeq
+func (r *messageChangeRepository) HasChangesSince(ctx context.Context, mailboxID, sinceSeq uint) (bool, error) {
+	latest, err := r.LatestSeq(ctx, mailboxID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check message changes: %w", err)
+	}
+	return latest > sinceSeq, nil
+}
+
+// ListSince returns up to limit changes to messages of a mailbox after sinceSeq, oldest first
+func (r *messageChangeRepository) ListSince(ctx context.Context, mailboxID, sinceSeq uint, limit int) ([]models.MessageChange, error) {
+	var changes []models.MessageChange
+	err := r.db.WithContext(ctx).
+		Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Where("mailbox_id = ? AND seq > ?", mailboxID, sinceSeq).
+		Order("seq ASC").
+		Limit(limit).
+		Find(&changes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message changes: %w", err)
+	}
+	return changes, nil
+}
+
+// DeleteBefore removes changes recorded before the given time and returns how many
+// were removed. Each mailbox loses a run of its oldest changes, so the changes it
+// keeps are all those after some Seq.
+func (r *messageChangeRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Exec("DELETE FROM message_changes WHERE seq <= "+
+		"(SELECT MAX(old.seq) FROM message_changes old "+
+		"WHERE old.mailbox_id = message_changes.mailbox_id AND old.created_at < ?)", before)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete message changes: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// recordChanges logs a change of the given kind for every message matching the
+// condition. It runs in the transaction of the change, before messages are deleted.
+// Bumping the change counter of a mailbox locks its row until the transaction
+// ends, so the Seq of its changes follows the order transactions commit in and a
+// reader that sees a Seq also sees every change numbered up to it.
+func recordChanges(tx *gorm.DB, kind models.MessageChangeKind, query string, args ...interface{}) error {
+	var rows []struct {
+		ID        uint
+		MailboxID uint
+	}
+	// Mailboxes are locked in ID order so concurrent changes cannot deadlock
+	err := tx.Raw("SELECT id, mailbox_id FROM messages WHERE "+query+" ORDER BY mailbox_id, id", args...).
+		Scan(&rows).Error
+	if err != nil {
+		return fmt.Errorf("failed to record message changes: %w", err)
+	}
+
+	now := time.Now()
+	changes := make([]models.MessageChange, 0, len(rows))
+	for start := 0; start < len(rows); {
+		mailboxID := rows[start].MailboxID
+		end := start
+		for end < len(rows) && rows[end].MailboxID == mailboxID {
+			end++
+		}
+		count := uint(end - start)
+
+		var seq uint
+		err := tx.Exec("UPDATE mailboxes SET change_seq = change_seq + ? WHERE id = ?", count, mailboxID).Error
+		if err == nil {
+			err = tx.Raw("SELECT change_seq FROM mailboxes WHERE id = ?", mailboxID).Scan(&seq).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record message changes: %w", err)
+		}
+		for i, row := range rows[start:end] {
+			changes = append(changes, models.MessageChange{
+				MailboxID: mailboxID,
+				MessageID: row.ID,
+				Seq:       seq - count + uint(i) + 1,
+				Kind:      kind,
+				CreatedAt: now,
+			})
+		}
+		start = end
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := tx.Omit(clause.Associations).Create(&changes).Error; err != nil {
+		return fmt.Errorf("failed to record message changes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned for a malformed cursor or one from another sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// MessageSortField is a field message lists can be sorted by
+type MessageSortField string
+
+const (
+	// SortByReceivedAt sorts by arrival time
+	SortByReceivedAt MessageSortField = "received_at"
+	// SortBySender sorts by sender address
+	SortBySender MessageSortField = "sender"
+	// SortBySubject sorts by subject
+	SortBySubject MessageSortField = "subject"
+	// SortBySize sorts by raw message size
+	SortBySize MessageSortField = "size"
+)
+
+// column returns the SQL column of a sort field
+func (f MessageSortField) column() (string, bool) {
+	switch f {
+	case SortByReceivedAt:
+		return "m.received_at", true
+	case SortBySender:
+		return "m.sender_email", true
+	case SortBySubject:
+		return "m.subject", true
+	case SortBySize:
+		return "m.size_bytes", true
+	default:
+		return "", false
+	}
+}
+
+// ParseMessageSortField parses a sort field name; empty means received_at
+func ParseMessageSortField(v string) (MessageSortField, error) {
+	if v == "" {
+		return SortByReceivedAt, nil
+	}
+	field := MessageSortField(v)
+	if _, ok := field.column(); !ok {
+		return "", fmt.Errorf("unknown sort field %q", v)
+	}
+	return field, nil
+}
+
+// MessageListOptions filters, sorts and pages the messages of a mailbox.
+// Zero values leave a filter unapplied.
+type MessageListOptions struct {
+	Unread *bool
+	// Sender matches the sender address or name, case-insensitively
+	Sender string
+	// Subject matches part of the subject, case-insensitively
+	Subject string
+	// From and To bound the received time as [From, To)
+	From time.Time
+	To   time.Time
+	// HasAttachments keeps messages with (true) or without (false) non-inline attachments
+	HasAttachments *bool
+	// MinSize and MaxSize bound the raw message size in bytes, inclusive
+	MinSize int64
+	MaxSize int64
+	// Flagged keeps messages with (true) or without (false) the \Flagged flag
+	Flagged *bool
+	// FolderID keeps messages in a folder; the Inbox also holds messages without a folder
+	FolderID uint
+	// LabelID keeps messages carrying a label
+	LabelID uint
+	// IDs keeps only the listed messages when it is not nil; an empty list keeps none
+	IDs []uint
+
+	Sort      MessageSortField
+	Ascending bool
+
+	Limit  int
+	Offset int
+	// Cursor continues after a message of a previous page; Offset is ignored when it is set
+	Cursor *MessageCursor
+}
+
+// MessageCursor is the position after a message in a sorted message list
+type MessageCursor struct {
+	Sort      MessageSortField `json:"s"`
+	Ascending bool             `json:"a,omitempty"`
+	Value     string           `json:"v"`
+	ID        uint             `json:"id"`
+}
+
+// NewMessageCursor returns the cursor positioned after item in a list sorted by sort
+func NewMessageCursor(item models.MessageListItem, sort MessageSortField, ascending bool) MessageCursor {
+	cursor := MessageCursor{Sort: sort, Ascending: ascending, ID: item.ID}
+	switch sort {
+	case SortBySender:
+		cursor.Value = item.SenderEmail
+	case SortBySubject:
+		cursor.Value = item.Subject
+	case SortBySize:
+		cursor.Value = strconv.FormatInt(item.SizeBytes, 10)
+	default:
+		cursor.Value = item.ReceivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+// Encode returns the opaque string form of the cursor
+func (c MessageCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeMessageCursor parses a cursor returned by Encode
+func DecodeMessageCursor(s string) (*MessageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor MessageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if _, ok := cursor.Sort.column(); !ok {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := cursor.value(); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// value converts the cursor value to the type of its sort column
+func (c MessageCursor) value() (interface{}, error) {
+	switch c.Sort {
+	case SortByReceivedAt:
+		return time.Parse(time.RFC3339Nano, c.Value)
+	case SortBySize:
+		return strconv.ParseInt(c.Value, 10, 64)
+	default:
+		return c.Value, nil
+	}
+}
+
+// ListByMailboxWithOptions retrieves messages for a mailbox with filters, sorting and
+// offset or keyset pagination. The total counts every message matching the filters.
+func (r *messageRepository) ListByMailboxWithOptions(ctx context.Context, mailboxID uint, opts MessageListOptions) ([]models.MessageListItem, int64, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortByReceivedAt
+	}
+	column, ok := opts.Sort.column()
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort field %q", opts.Sort)
+	}
+	if opts.Cursor != nil && (opts.Cursor.Sort != opts.Sort || opts.Cursor.Ascending != opts.Ascending) {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	filtered := func() *gorm.DB {
+		return messageListFilters(r.db.WithContext(ctx).Table("messages m").Scopes(scopeMailboxes(ctx, "m.mailbox_id")).Where("m.mailbox_id = ?", mailboxID), opts)
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	direction, comparison := "DESC", "<"
+	if opts.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	page := filtered().Select(messageListColumns)
+	if opts.Cursor != nil {
+		value, err := opts.Cursor.value()
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		page = page.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND m.id %s ?))", column, comparison, column, comparison),
+			value, value, opts.Cursor.ID)
+	} else if opts.Offset > 0 {
+		page = page.Offset(opts.Offset)
+	}
+
+	var results []models.MessageListItem
+	err := page.Order(column + " " + direction).Order("m.id " + direction).
+		Limit(opts.Limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	return results, total, nil
+}
+
+// ListFolderItems retrieves every message of a folder ordered by UID, oldest first.
+// Mail access protocols use it to number the messages of a folder.
+func (r *messageRepository) ListFolderItems(ctx context.Context, mailboxID, folderID uint) ([]models.MessageListItem, error) {
+	var results []models.MessageListItem
+	err := messageListFilters(r.db.WithContext(ctx).Table("messages m").Scopes(scopeMailboxes(ctx, "m.mailbox_id")).Where("m.mailbox_id = ?", mailboxID), MessageListOptions{FolderID: folderID}).
+		Select(messageListColumns + ", m.uid").
+		Order("m.uid ASC, m.id ASC").
+		Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder messages: %w", err)
+	}
+	return results, nil
+}
+
+// messageListColumns selects the columns of models.MessageListItem from messages m
+const messageListColumns = `m.id, m.mailbox_id, m.sender_email, m.sender_name, m.subject, m.snippet,
+		m.is_read, m.is_flagged, m.is_answered, m.is_deleted, m.is_draft, m.folder_id, m.size_bytes, m.received_at,
+		COALESCE((SELECT COUNT(*) FROM attachments a WHERE a.message_id = m.id), 0) AS attachment_count`
+
+// messageListFilters applies the filters of opts to a query over messages m
+func messageListFilters(db *gorm.DB, opts MessageListOptions) *gorm.DB {
+	if opts.Unread != nil {
+		db = db.Where("m.is_read = ?", !*opts.Unread)
+	}
+	if opts.Sender != "" {
+		pattern := containsPattern(opts.Sender)
+		db = db.Where(`(LOWER(m.sender_email) LIKE ? ESCAPE '\' OR LOWER(m.sender_name) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if opts.Subject != "" {
+		db = db.Where(`LOWER(m.subject) LIKE ? ESCAPE '\'`, containsPattern(opts.Subject))
+	}
+	if !opts.From.IsZero() {
+		db = db.Where("m.received_at >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		db = db.Where("m.received_at < ?", opts.To)
+	}
+	if opts.HasAttachments != nil {
+		exists := "EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.id AND a.inline = ?)"
+		if !*opts.HasAttachments {
+			exists = "NOT " + exists
+		}
+		db = db.Where(exists, false)
+	}
+	if opts.MinSize > 0 {
+		db = db.Where("m.size_bytes >= ?", opts.MinSize)
+	}
+	if opts.MaxSize > 0 {
+		db = db.Where("m.size_bytes <= ?", opts.MaxSize)
+	}
+	if opts.Flagged != nil {
+		db = db.Where("m.is_flagged = ?", *opts.Flagged)
+	}
+	if opts.FolderID != 0 {
+		db = db.Where("EXISTS (SELECT 1 FROM folders f WHERE f.id = ? AND "+folderMatch+")", opts.FolderID)
+	}
+	if opts.LabelID != 0 {
+		db = db.Where("EXISTS (SELECT 1 FROM message_labels ml WHERE ml.message_id = m.id AND ml.label_id = ?)", opts.LabelID)
+	}
+	if opts.IDs != nil {
+		if len(opts.IDs) == 0 {
+			db = db.Where("1 = 0")
+		} else {
+			db = db.Where("m.id IN ?", opts.IDs)
+		}
+	}
+	return db
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+)
+
+// ==================== ListByMailboxWithOptions Tests ====================
+
+// createListFixtures stores five messages; two of them share a received time
+func (s *MessageRepositoryTestSuite) createListFixtures() []*models.Message {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	messages := []*models.Message{
+		{SenderEmail: "a@shop.com", Subject: "Invoice 1", SizeBytes: 500, ReceivedAt: base},
+		{SenderEmail: "b@news.com", Subject: "Weekly news", SizeBytes: 1500, IsRead: true, ReceivedAt: base.Add(time.Hour)},
+		{SenderEmail: "c@shop.com", Subject: "Invoice 2", SizeBytes: 3000, ReceivedAt: base.Add(time.Hour)},
+		{SenderEmail: "d@auth.io", Subject: "Login code", SizeBytes: 200, ReceivedAt: base.Add(2 * time.Hour)},
+		{SenderEmail: "e@shop.com", Subject: "Receipt", SizeBytes: 800, ReceivedAt: base.Add(24 * time.Hour)},
+	}
+	for _, message := range messages {
+		message.MailboxID = s.testMailbox.ID
+		require.NoError(s.T(), s.repo.Create(context.Background(), message))
+	}
+	require.NoError(s.T(), s.db.Create(&models.Attachment{
+		MessageID: messages[2].ID, Filename: "invoice.pdf", ContentType: "application/pdf", FilePath: "/i",
+	}).Error)
+	return messages
+}
+
+// listIDs returns the IDs of a page
+func listIDs(items []models.MessageListItem) []uint {
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func (s *MessageRepositoryTestSuite) TestListByMailboxWithOptions_Filters() {
+	// Arrange
+	m := s.createListFixtures()
+	unread, hasAttachments := true, true
+
+	tests := []struct {
+		name string
+		opts MessageListOptions
+		want []uint
+	}{
+		{"unread", MessageListOptions{Unread: &unread}, []uint{m[4].ID, m[3].ID, m[2].ID, m[0].ID}},
+		{"sender", MessageListOptions{Sender: "SHOP"}, []uint{m[4].ID, m[2].ID, m[0].ID}},
+		{"subject", MessageListOptions{Subject: "invoice"}, []uint{m[2].ID, m[0].ID}},
+		{"date range", MessageListOptions{From: m[1].ReceivedAt, To: m[3].ReceivedAt}, []uint{m[2].ID, m[1].ID}},
+		{"has attachments", MessageListOptions{HasAttachments: &hasAttachments}, []uint{m[2].ID}},
+		{"size", MessageListOptions{MinSize: 500, MaxSize: 1500}, []uint{m[4].ID, m[1].ID, m[0].ID}},
+		{"ids", MessageListOptions{IDs: []uint{m[3].ID, m[0].ID}}, []uint{m[3].ID, m[0].ID}},
+		{"no ids", MessageListOptions{IDs: []uint{}}, []uint{}},
+	}
+
+	for _, tt := range tests {
+		// Act
+		tt.opts.Limit = 10
+		items, total, err := s.repo.ListByMailboxWithOptions(context.Background(), s.testMailbox.ID, tt.opts)
+
+		// Assert
+		require.NoError(s.T(), err, tt.name)
+		assert.Equal(s.T(), tt.want, listIDs(items), tt.name)
+		assert.Equal(s.T(), int64(len(tt.want)), total, tt.name)
+	}
+}
+
+func (s *MessageRepositoryTestSuite) TestListByMailboxWithOptions_SortBySizeAscending() {
+	// Arrange
+	m := s.createListFixtures()
+
+	// Act
+	items, _, err := s.repo.ListByMailboxWithOptions(context.Background(), s.testMailbox.ID,
+		MessageListOptions{Sort: SortBySize, Ascending: true, Limit: 10})
+
+	// Assert
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []uint{m[3].ID, m[0].ID, m[4].ID, m[1].ID, m[2].ID}, listIDs(items))
+	assert.Equal(s.T(), int64(3000), items[4].SizeBytes)
+	assert.Equal(s.T(), 1, items[4].AttachmentCount)
+}
+
+func (s *MessageRepositoryTestSuite) TestListByMailboxWithOptions_CursorWalksAllPages() {
+	// Arrange
+	m := s.createListFixtures()
+
+	for _, sort := range []MessageSortField{SortByReceivedAt, SortBySender, SortBySubject, SortBySize} {
+		for _, ascending := range []bool{false, true} {
+			opts := MessageListOptions{Sort: sort, Ascending: ascending, Limit: 2}
+			all, _, err := s.repo.ListByMailboxWithOptions(context.Background(), s.testMailbox.ID,
+				MessageListOptions{Sort: sort, Ascending: ascending, Limit: 10})
+			require.NoError(s.T(), err)
+
+			// Act
+			var walked []uint
+			for page := 0; page < 5; page++ {
+				items, total, err := s.repo.ListByMailboxWithOptions(context.Background(), s.testMailbox.ID, opts)
+				require.NoError(s.T(), err)
+				assert.Equal(s.T(), int64(len(m)), total)
+				walked = append(walked, listIDs(items)...)
+				if len(items) < opts.Limit {
+					break
+				}
+				cursor, err := DecodeMessageCursor(NewMessageCursor(items[len(items)-1], sort, ascending).Encode())
+				require.NoError(s.T(), err)
+				opts.Cursor = cursor
+			}
+
+			// Assert
+			assert.Equal(s.T(), listIDs(all), walked, "%s ascending=%v", sort, ascending)
+		}
+	}
+}
+
+func (s *MessageRepositoryTestSuite) TestListByMailboxWithOptions_CursorFromOtherSort() {
+	// Arrange
+	cursor := &MessageCursor{Sort: SortBySize, Value: "10", ID: 1}
+
+	// Act
+	_, _, err := s.repo.ListByMailboxWithOptions(context.Background(), s.testMailbox.ID,
+		MessageListOptions{Sort: SortByReceivedAt, Limit: 10, Cursor: cursor})
+
+	// Assert
+	assert.ErrorIs(s.T(), err, ErrInvalidCursor)
+}
+
+func (s *MessageRepositoryTestSuite) TestDecodeMessageCursor_Invalid() {
+	for _, v := range []string{"", "!!", "e30", (MessageCursor{Sort: "priority", ID: 1}).Encode(),
+		(MessageCursor{Sort: SortBySize, Value: "big", ID: 1}).Encode()} {
+		_, err := DecodeMessageCursor(v)
+		assert.ErrorIs(s.T(), err, ErrInvalidCursor, v)
+	}
+}
+
+func (s *MessageRepositoryTestSuite) TestListByMailboxWithOptions_FolderLabelAndFlagFilters() {
+	// Arrange
+	ctx := context.Background()
+	m := s.createListFixtures()
+	folders := NewFolderRepository(s.db)
+	labels := NewLabelRepository(s.db)
+	inbox, err := folders.GetByRole(ctx, s.testMailbox.ID, models.FolderRoleInbox)
+	require.NoError(s.T(), err)
+	archive, err := folders.GetByRole(ctx, s.testMailbox.ID, models.FolderRoleArchive)
+	require.NoError(s.T(), err)
+	_, err = s.repo.SetFolderByIDs(ctx, []uint{m[1].ID, m[3].ID}, &archive.ID)
+	require.NoError(s.T(), err)
+	label := &models.Label{MailboxID: s.testMailbox.ID, Name: "shop", Color: models.DefaultLabelColor}
+	require.NoError(s.T(), labels.Create(ctx, label))
+	require.NoError(s.T(), labels.SetMessageLabels(ctx, m[0].ID, []uint{label.ID}))
+	require.NoError(s.T(), s.repo.SetFlags(ctx, m[4].ID, map[string]bool{models.FlagFlagged: true}))
+	flagged := true
+
+	tests := []struct {
+		name string
+		opts MessageListOptions
+		want []uint
+	}{
+		{"inbox", MessageListOptions{FolderID: inbox.ID}, []uint{m[4].ID, m[2].ID, m[0].ID}},
+		{"archive", MessageListOptions{FolderID: archive.ID}, []uint{m[3].ID, m[1].ID}},
+		{"label", MessageListOptions{LabelID: label.ID}, []uint{m[0].ID}},
+		{"flagged", MessageListOptions{Flagged: &flagged}, []uint{m[4].ID}},
+	}
+
+	for _, tt := range tests {
+		// Act
+		tt.opts.Limit = 10
+		items, _, err := s.repo.ListByMailboxWithOptions(ctx, s.testMailbox.ID, tt.opts)
+
+		// Assert
+		require.NoError(s.T(), err, tt.name)
+		assert.Equal(s.T(), tt.want, listIDs(items), tt.name)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
 	"gorm.io/gorm"
 )
 
@@ -15,14 +18,33 @@ type MessageRepository interface {
 	CreateWithAttachments(ctx context.Context, message *models.Message, attachments []models.Attachment) error
 	GetByID(ctx context.Context, id uint) (*models.Message, error)
 	ListByMailbox(ctx context.Context, mailboxID uint, limit, offset int) ([]models.MessageListItem, int64, error)
+	ListByMailboxWithOptions(ctx context.Context, mailboxID uint, opts MessageListOptions) ([]models.MessageListItem, int64, error)
+	ListByMailboxAfterID(ctx context.Context, mailboxID, afterID uint, limit int) ([]models.Message, error)
+	ListFolderItems(ctx context.Context, mailboxID, folderID uint) ([]models.MessageListItem, error)
 	MarkAsRead(ctx context.Context, id uint) error
 	Delete(ctx context.Context, id uint) error
 	CountUnread(ctx context.Context, mailboxID uint) (int64, error)
+	ListIDsReceivedBefore(ctx context.Context, domainID uint, before time.Time, limit int) ([]uint, error)
+	CountReceivedBefore(ctx context.Context, domainID uint, before time.Time) (int64, error)
+	DeleteByIDs(ctx context.Context, ids []uint) ([]string, error)
+	SetReadByIDs(ctx context.Context, ids []uint, read bool) (int64, error)
+	SetFlaggedByIDs(ctx context.Context, ids []uint, flagged bool) (int64, error)
+	MoveByIDs(ctx context.Context, ids []uint, mailboxID uint) (int64, error)
+	SetFolderByIDs(ctx context.Context, ids []uint, folderID *uint) (int64, error)
+	SetFlags(ctx context.Context, id uint, flags map[string]bool) error
+	MailboxIDsByIDs(ctx context.Context, ids []uint) (map[uint]uint, error)
+	ExistingRawPaths(ctx context.Context, rawPaths []string) (map[string]bool, error)
+	ListEncryptedBodiesAfterID(ctx context.Context, afterID uint, limit int) ([]models.StoredMessageBody, error)
+	UpdateStoredBody(ctx context.Context, body models.StoredMessageBody) error
+	Search(ctx context.Context, query *search.Query, scope SearchScope, limit, offset int) ([]models.MessageSearchHit, int64, error)
+	SearchIDs(ctx context.Context, query *search.Query, scope SearchScope, afterID uint, limit int) ([]uint, error)
+	IndexUnindexed(ctx context.Context, limit int) (int, error)
 }
 
 // messageRepository implements MessageRepository using GORM
 type messageRepository struct {
-	db *gorm.DB
+	db          *gorm.DB
+	fileStorage storage.FileStorage
 }
 
 // NewMessageRepository creates a new MessageRepository instance
@@ -30,22 +52,47 @@ func NewMessageRepository(db *gorm.DB) MessageRepository {
 	return &messageRepository{db: db}
 }
 
-// Create creates a new message
+// NewMessageRepositoryWithStorage creates a MessageRepository that also removes
+// attachment files and raw sources from storage when messages are deleted
+func NewMessageRepositoryWithStorage(db *gorm.DB, fileStorage storage.FileStorage) MessageRepository {
+	return &messageRepository{db: db, fileStorage: fileStorage}
+}
+
+// Create creates a new message and its search document
 func (r *messageRepository) Create(ctx context.Context, message *models.Message) error {
-	result := r.db.WithContext(ctx).Create(message)
-	if result.Error != nil {
-		return fmt.Errorf("failed to create message: %w", result.Error)
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), message.MailboxID); err != nil {
+		return err
 	}
-	return nil
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to create message: %w", err)
+		}
+		if err := assignUID(tx, message); err != nil {
+			return err
+		}
+		if err := recordChanges(tx, models.MessageCreated, "id = ?", message.ID); err != nil {
+			return err
+		}
+		return indexMessage(tx, message, nil)
+	})
 }
 
-// CreateWithAttachments creates a message with its attachments in a transaction
+// CreateWithAttachments creates a message with its attachments and search document in a transaction
 func (r *messageRepository) CreateWithAttachments(ctx context.Context, message *models.Message, attachments []models.Attachment) error {
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), message.MailboxID); err != nil {
+		return err
+	}
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create message first
 		if err := tx.Create(message).Error; err != nil {
 			return fmt.Errorf("failed to create message: %w", err)
 		}
+		if err := assignUID(tx, message); err != nil {
+			return err
+		}
+		if err := recordChanges(tx, models.MessageCreated, "id = ?", message.ID); err != nil {
+			return err
+		}
 
 		// Create attachments with message ID
 		for i := range attachments {
@@ -55,14 +102,14 @@ func (r *messageRepository) CreateWithAttachments(ctx context.Context, message *
 			}
 		}
 
-		return nil
+		return indexMessage(tx, message, attachments)
 	})
 }
 
 // GetByID retrieves a message by its ID with preloaded attachments
 func (r *messageRepository) GetByID(ctx context.Context, id uint) (*models.Message, error) {
 	var message models.Message
-	result := r.db.WithContext(ctx).Preload("Attachments").First(&message, id)
+	result := r.db.WithContext(ctx).Scopes(scopeMailboxes(ctx, "mailbox_id")).Preload("Attachments").First(&message, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -74,57 +121,378 @@ func (r *messageRepository) GetByID(ctx context.Context, id uint) (*models.Messa
 
 // ListByMailbox retrieves messages for a mailbox with pagination, ordered by received_at descending
 func (r *messageRepository) ListByMailbox(ctx context.Context, mailboxID uint, limit, offset int) ([]models.MessageListItem, int64, error) {
-	var total int64
+	return r.ListByMailboxWithOptions(ctx, mailboxID, MessageListOptions{Limit: limit, Offset: offset})
+}
 
-	// Count total messages for this mailbox
-	if err := r.db.WithContext(ctx).Model(&models.Message{}).Where("mailbox_id = ?", mailboxID).Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count messages: %w", err)
+// MarkAsRead marks a message as read
+func (r *messageRepository) MarkAsRead(ctx context.Context, id uint) error {
+	updated, err := r.updateMessages(ctx, map[string]interface{}{"is_read": true}, []uint{id})
+	if err != nil {
+		return fmt.Errorf("failed to mark message as read: %w", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes a message and its attachments by the message ID.
+// Attachment files and the raw source are removed from storage only after the transaction commits.
+func (r *messageRepository) Delete(ctx context.Context, id uint) error {
+	if err := owns(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), id); err != nil {
+		return err
 	}
 
-	// Get messages with attachment count
-	var results []models.MessageListItem
+	var filePaths []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		paths, err := collectStoredPaths(tx, []uint{id})
+		if err != nil {
+			return err
+		}
+		filePaths = paths
 
-	query := `
-		SELECT 
-			m.id,
-			m.mailbox_id,
-			m.sender_email,
-			m.sender_name,
-			m.subject,
-			m.snippet,
-			m.is_read,
-			m.received_at,
-			COALESCE((SELECT COUNT(*) FROM attachments a WHERE a.message_id = m.id), 0) as attachment_count
-		FROM messages m
-		WHERE m.mailbox_id = ?
-		ORDER BY m.received_at DESC
-		LIMIT ? OFFSET ?
-	`
+		if err := tx.Where("message_id = ?", id).Delete(&models.Attachment{}).Error; err != nil {
+			return fmt.Errorf("failed to delete attachments: %w", err)
+		}
+		if err := recordChanges(tx, models.MessageDestroyed, "id = ?", id); err != nil {
+			return err
+		}
 
-	if err := r.db.WithContext(ctx).Raw(query, mailboxID, limit, offset).Scan(&results).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to list messages: %w", err)
+		result := tx.Delete(&models.Message{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete message: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return results, total, nil
+	removeFiles(r.fileStorage, filePaths)
+	return nil
 }
 
-// MarkAsRead marks a message as read
-func (r *messageRepository) MarkAsRead(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Model(&models.Message{}).Where("id = ?", id).Update("is_read", true)
+// CountUnread counts unread messages for a mailbox
+func (r *messageRepository) CountUnread(ctx context.Context, mailboxID uint) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&models.Message{}).Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Where("mailbox_id = ? AND is_read = ?", mailboxID, false).Count(&count)
 	if result.Error != nil {
-		return fmt.Errorf("failed to mark message as read: %w", result.Error)
+		return 0, fmt.Errorf("failed to count unread messages: %w", result.Error)
 	}
-	if result.RowsAffected == 0 {
+	return count, nil
+}
+
+// ListIDsReceivedBefore returns IDs of messages in a domain received before the given time,
+// oldest first
+func (r *messageRepository) ListIDsReceivedBefore(ctx context.Context, domainID uint, before time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	result := r.db.WithContext(ctx).Model(&models.Message{}).
+		Scopes(scopeMailboxes(ctx, "messages.mailbox_id")).
+		Joins("JOIN mailboxes mb ON mb.id = messages.mailbox_id").
+		Where("mb.domain_id = ? AND messages.received_at < ?", domainID, before).
+		Order("messages.received_at ASC").
+		Limit(limit).
+		Pluck("messages.id", &ids)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list expired messages: %w", result.Error)
+	}
+	return ids, nil
+}
+
+// CountReceivedBefore counts messages in a domain received before the given time
+func (r *messageRepository) CountReceivedBefore(ctx context.Context, domainID uint, before time.Time) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&models.Message{}).
+		Scopes(scopeMailboxes(ctx, "messages.mailbox_id")).
+		Joins("JOIN mailboxes mb ON mb.id = messages.mailbox_id").
+		Where("mb.domain_id = ? AND messages.received_at < ?", domainID, before).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count expired messages: %w", result.Error)
+	}
+	return count, nil
+}
+
+// DeleteByIDs deletes the given messages and their attachment rows in a transaction.
+// Returns the storage paths of the deleted attachments and raw sources so the caller can remove the files.
+func (r *messageRepository) DeleteByIDs(ctx context.Context, ids []uint) ([]string, error) {
+	ids, err := ownedIDs(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var filePaths []string
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		paths, err := collectStoredPaths(tx, ids)
+		if err != nil {
+			return err
+		}
+		filePaths = paths
+
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.Attachment{}).Error; err != nil {
+			return fmt.Errorf("failed to delete attachments: %w", err)
+		}
+		if err := recordChanges(tx, models.MessageDestroyed, "id IN ?", ids); err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.Message{}).Error; err != nil {
+			return fmt.Errorf("failed to delete messages: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filePaths, nil
+}
+
+// SetReadByIDs sets the read state of the given messages and returns how many were updated
+func (r *messageRepository) SetReadByIDs(ctx context.Context, ids []uint, read bool) (int64, error) {
+	updated, err := r.updateMessages(ctx, map[string]interface{}{"is_read": read}, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update read state: %w", err)
+	}
+	return updated, nil
+}
+
+// SetFlaggedByIDs sets the flagged state of the given messages and returns how many were updated
+func (r *messageRepository) SetFlaggedByIDs(ctx context.Context, ids []uint, flagged bool) (int64, error) {
+	updated, err := r.updateMessages(ctx, map[string]interface{}{"is_flagged": flagged}, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update flagged state: %w", err)
+	}
+	return updated, nil
+}
+
+// MoveByIDs moves the given messages to the Inbox of another mailbox and returns how
+// many were moved. Folders and labels belong to a mailbox, so both are cleared.
+func (r *messageRepository) MoveByIDs(ctx context.Context, ids []uint, mailboxID uint) (int64, error) {
+	ids, err := ownedIDs(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := owns(ctx, r.db, &models.Mailbox{}, scopeDomains(ctx, "domain_id"), mailboxID); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id IN ?", ids).Delete(&models.MessageLabel{}).Error; err != nil {
+			return fmt.Errorf("failed to remove message labels: %w", err)
+		}
+		// The messages leave one mailbox and arrive in another
+		if err := recordChanges(tx, models.MessageDestroyed, "id IN ?", ids); err != nil {
+			return err
+		}
+		result := tx.Model(&models.Message{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"mailbox_id": mailboxID, "folder_id": nil})
+		if result.Error != nil {
+			return fmt.Errorf("failed to move messages: %w", result.Error)
+		}
+		moved = result.RowsAffected
+		if _, err := assignUIDs(tx, "id IN ?", ids); err != nil {
+			return err
+		}
+		return recordChanges(tx, models.MessageCreated, "id IN ?", ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// SetFolderByIDs moves the given messages to a folder of their mailbox, or to the
+// Inbox when folderID is nil, and returns how many were updated. Messages that
+// change folder get a new UID there.
+func (r *messageRepository) SetFolderByIDs(ctx context.Context, ids []uint, folderID *uint) (int64, error) {
+	ids, err := ownedIDs(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set message folder: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var updated int64
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		moving := tx.Model(&models.Message{}).Where("id IN ?", ids)
+		if folderID == nil {
+			moving = moving.Where("folder_id IS NOT NULL")
+		} else {
+			moving = moving.Where("(folder_id IS NULL OR folder_id <> ?)", *folderID)
+		}
+		var moved []uint
+		if err := moving.Pluck("id", &moved).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Message{}).Where("id IN ?", ids).Update("folder_id", folderID)
+		if result.Error != nil {
+			return result.Error
+		}
+		updated = result.RowsAffected
+		if len(moved) > 0 {
+			if _, err := assignUIDs(tx, "id IN ?", moved); err != nil {
+				return err
+			}
+		}
+		return recordChanges(tx, models.MessageUpdated, "id IN ?", ids)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to set message folder: %w", err)
+	}
+	return updated, nil
+}
+
+// SetFlags sets or clears system flags of a message, keyed by flag name such as \Flagged
+func (r *messageRepository) SetFlags(ctx context.Context, id uint, flags map[string]bool) error {
+	updates := make(map[string]interface{}, len(flags))
+	for flag, set := range flags {
+		column, ok := models.FlagColumn(flag)
+		if !ok {
+			return fmt.Errorf("unknown flag %q: %w", flag, ErrInvalidInput)
+		}
+		updates[column] = set
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	updated, err := r.updateMessages(ctx, updates, []uint{id})
+	if err != nil {
+		return fmt.Errorf("failed to update message flags: %w", err)
+	}
+	if updated == 0 {
 		return ErrNotFound
 	}
 	return nil
 }
 
-// Delete deletes a message by its ID (cascade deletes attachments)
-func (r *messageRepository) Delete(ctx context.Context, id uint) error {
-	result := r.db.WithContext(ctx).Delete(&models.Message{}, id)
+// updateMessages applies updates to the given messages, records them as changed
+// and returns how many were updated
+func (r *messageRepository) updateMessages(ctx context.Context, updates map[string]interface{}, ids []uint) (int64, error) {
+	ids, err := ownedIDs(ctx, r.db, &models.Message{}, scopeMailboxes(ctx, "mailbox_id"), ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var updated int64
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Message{}).Where("id IN ?", ids).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		updated = result.RowsAffected
+		return recordChanges(tx, models.MessageUpdated, "id IN ?", ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// MailboxIDsByIDs maps each existing message ID to its mailbox ID
+func (r *messageRepository) MailboxIDsByIDs(ctx context.Context, ids []uint) (map[uint]uint, error) {
+	mailboxIDs := make(map[uint]uint, len(ids))
+	if len(ids) == 0 {
+		return mailboxIDs, nil
+	}
+
+	var rows []struct {
+		ID        uint
+		MailboxID uint
+	}
+	if err := r.db.WithContext(ctx).Model(&models.Message{}).Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Select("id, mailbox_id").Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get message mailboxes: %w", err)
+	}
+	for _, row := range rows {
+		mailboxIDs[row.ID] = row.MailboxID
+	}
+	return mailboxIDs, nil
+}
+
+// ExistingRawPaths reports which of the given storage paths are referenced as a message raw source
+func (r *messageRepository) ExistingRawPaths(ctx context.Context, rawPaths []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(rawPaths))
+	if len(rawPaths) == 0 {
+		return existing, nil
+	}
+
+	var found []string
+	result := r.db.WithContext(ctx).
+		Model(&models.Message{}).
+		Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Where("raw_path IN ?", rawPaths).
+		Distinct().
+		Pluck("raw_path", &found)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to look up raw source paths: %w", result.Error)
+	}
+	for _, path := range found {
+		existing[path] = true
+	}
+	return existing, nil
+}
+
+// ListByMailboxAfterID retrieves full messages of a mailbox with their attachments,
+// ordered by ID and starting after afterID. Used to page through a whole mailbox.
+func (r *messageRepository) ListByMailboxAfterID(ctx context.Context, mailboxID, afterID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	result := r.db.WithContext(ctx).
+		Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Preload("Attachments").
+		Where("mailbox_id = ? AND id > ?", mailboxID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list mailbox messages: %w", result.Error)
+	}
+	return messages, nil
+}
+
+// ListEncryptedBodiesAfterID returns the stored, still encrypted body columns of
+// messages with at least one encrypted body, ordered by ID and starting after afterID
+func (r *messageRepository) ListEncryptedBodiesAfterID(ctx context.Context, afterID uint, limit int) ([]models.StoredMessageBody, error) {
+	var bodies []models.StoredMessageBody
+	// Table() instead of Model() so the columns are not passed through the decrypting serializer
+	result := r.db.WithContext(ctx).
+		Table(models.Message{}.TableName()).
+		Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Select("id, body_text, body_html").
+		Where("id > ? AND (body_text LIKE ? OR body_html LIKE ?)", afterID, "enc:%", "enc:%").
+		Order("id ASC").
+		Limit(limit).
+		Scan(&bodies)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list encrypted message bodies: %w", result.Error)
+	}
+	return bodies, nil
+}
+
+// UpdateStoredBody writes body columns exactly as given, without encrypting them again
+func (r *messageRepository) UpdateStoredBody(ctx context.Context, body models.StoredMessageBody) error {
+	result := r.db.WithContext(ctx).
+		Table(models.Message{}.TableName()).
+		Scopes(scopeMailboxes(ctx, "mailbox_id")).
+		Where("id = ?", body.ID).
+		Updates(map[string]interface{}{"body_text": body.BodyText, "body_html": body.BodyHTML})
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete message: %w", result.Error)
+		return fmt.Errorf("failed to update message body: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
 		return ErrNotFound
@@ -132,12 +500,59 @@ func (r *messageRepository) Delete(ctx context.Context, id uint) error {
 	return nil
 }
 
-// CountUnread counts unread messages for a mailbox
-func (r *messageRepository) CountUnread(ctx context.Context, mailboxID uint) (int64, error) {
-	var count int64
-	result := r.db.WithContext(ctx).Model(&models.Message{}).Where("mailbox_id = ? AND is_read = ?", mailboxID, false).Count(&count)
-	if result.Error != nil {
-		return 0, fmt.Errorf("failed to count unread messages: %w", result.Error)
+// assignUID gives a new message its UID
+func assignUID(tx *gorm.DB, message *models.Message) error {
+	uids, err := assignUIDs(tx, "id = ?", message.ID)
+	if err != nil {
+		return err
 	}
-	return count, nil
+	message.UID = uids[message.ID]
+	return nil
+}
+
+// assignUIDs gives every message matching the condition a new IMAP UID from the
+// counter of its mailbox and returns them by message ID. It runs in the
+// transaction that stores or moves the messages. Bumping the counter locks the
+// mailbox row until the transaction ends, so UIDs follow the order transactions
+// commit in and a folder never gains a message below a UID it already showed.
+func assignUIDs(tx *gorm.DB, query string, args ...interface{}) (map[uint]uint, error) {
+	var rows []struct {
+		ID        uint
+		MailboxID uint
+	}
+	// Mailboxes are locked in ID order so concurrent changes cannot deadlock
+	err := tx.Raw("SELECT id, mailbox_id FROM messages WHERE "+query+" ORDER BY mailbox_id, id", args...).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign message UIDs: %w", err)
+	}
+
+	uids := make(map[uint]uint, len(rows))
+	for start := 0; start < len(rows); {
+		mailboxID := rows[start].MailboxID
+		end := start
+		for end < len(rows) && rows[end].MailboxID == mailboxID {
+			end++
+		}
+		count := uint(end - start)
+
+		var next uint
+		err := tx.Exec("UPDATE mailboxes SET uid_next = uid_next + ? WHERE id = ?", count, mailboxID).Error
+		if err == nil {
+			err = tx.Raw("SELECT uid_next FROM mailboxes WHERE id = ?", mailboxID).Scan(&next).Error
+		}
+		for i, row := range rows[start:end] {
+			if err != nil {
+				break
+			}
+			uid := next - count + uint(i)
+			err = tx.Exec("UPDATE messages SET uid = ? WHERE id = ?", uid, row.ID).Error
+			uids[row.ID] = uid
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign message UIDs: %w", err)
+		}
+		start = end
+	}
+	return uids, nil
 }
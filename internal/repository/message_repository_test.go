@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"testing"
 	"time"
@@ -8,7 +9,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -35,7 +38,8 @@ func (s *MessageRepositoryTestSuite) SetupSuite() {
 	db.Exec("PRAGMA foreign_keys = ON")
 
 	// Auto-migrate models
-	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.Attachment{})
+	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{},
+		&models.Folder{}, &models.Label{}, &models.MessageLabel{})
 	require.NoError(s.T(), err)
 
 	s.db = db
@@ -52,6 +56,9 @@ func (s *MessageRepositoryTestSuite) TearDownSuite() {
 
 // SetupTest runs before each test - clean up data and create test fixtures
 func (s *MessageRepositoryTestSuite) SetupTest() {
+	s.db.Exec("DELETE FROM message_labels")
+	s.db.Exec("DELETE FROM labels")
+	s.db.Exec("DELETE FROM folders")
 	s.db.Exec("DELETE FROM attachments")
 	s.db.Exec("DELETE FROM messages")
 	s.db.Exec("DELETE FROM mailboxes")
@@ -455,6 +462,97 @@ func (s *MessageRepositoryTestSuite) TestDelete_CascadeDeletesAttachments() {
 	assert.ErrorIs(s.T(), err, ErrNotFound)
 }
 
+func (s *MessageRepositoryTestSuite) TestDelete_WithStorageRemovesAttachmentFiles() {
+	// Arrange
+	fileStorage := &MockFileStorageForRepo{}
+	repo := NewMessageRepositoryWithStorage(s.db, fileStorage)
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "sender@example.com"}
+	attachments := []models.Attachment{
+		{Filename: "a.pdf", FilePath: "ab/a.pdf"},
+		{Filename: "b.pdf", FilePath: "cd/b.pdf"},
+	}
+	require.NoError(s.T(), repo.CreateWithAttachments(context.Background(), message, attachments))
+
+	// Act
+	err := repo.Delete(context.Background(), message.ID)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.ElementsMatch(s.T(), []string{"ab/a.pdf", "cd/b.pdf"}, fileStorage.DeletedPaths)
+
+	var count int64
+	s.db.Model(&models.Attachment{}).Where("message_id = ?", message.ID).Count(&count)
+	assert.Equal(s.T(), int64(0), count)
+}
+
+func (s *MessageRepositoryTestSuite) TestDelete_WithStorageNotFoundKeepsFiles() {
+	// Arrange
+	fileStorage := &MockFileStorageForRepo{}
+	repo := NewMessageRepositoryWithStorage(s.db, fileStorage)
+
+	// Act
+	err := repo.Delete(context.Background(), 99999)
+
+	// Assert
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+	assert.Empty(s.T(), fileStorage.DeletedPaths)
+}
+
+func (s *MessageRepositoryTestSuite) TestDelete_WithStorageRemovesRawSource() {
+	// Arrange
+	fileStorage := &MockFileStorageForRepo{}
+	repo := NewMessageRepositoryWithStorage(s.db, fileStorage)
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "sender@example.com", RawPath: "blobs/ab/abcd"}
+	require.NoError(s.T(), repo.Create(context.Background(), message))
+
+	// Act
+	err := repo.Delete(context.Background(), message.ID)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"blobs/ab/abcd"}, fileStorage.DeletedPaths)
+}
+
+func (s *MessageRepositoryTestSuite) TestExistingRawPaths_ReportsReferencedPaths() {
+	// Arrange
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "sender@example.com", RawPath: "blobs/ab/abcd"}
+	require.NoError(s.T(), s.repo.Create(context.Background(), message))
+
+	// Act
+	existing, err := s.repo.ExistingRawPaths(context.Background(), []string{"blobs/ab/abcd", "blobs/cd/cdef"})
+
+	// Assert
+	require.NoError(s.T(), err)
+	assert.True(s.T(), existing["blobs/ab/abcd"])
+	assert.False(s.T(), existing["blobs/cd/cdef"])
+}
+
+func (s *MessageRepositoryTestSuite) TestListByMailboxAfterID_PagesInIDOrder() {
+	// Arrange
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "sender@example.com"}
+		require.NoError(s.T(), s.repo.Create(context.Background(), message))
+		ids = append(ids, message.ID)
+	}
+	attachment := &models.Attachment{MessageID: ids[1], Filename: "a.txt", ContentType: "text/plain", FilePath: "/a.txt"}
+	require.NoError(s.T(), s.db.Create(attachment).Error)
+
+	// Act
+	first, err := s.repo.ListByMailboxAfterID(context.Background(), s.testMailbox.ID, 0, 2)
+	require.NoError(s.T(), err)
+	rest, err := s.repo.ListByMailboxAfterID(context.Background(), s.testMailbox.ID, first[len(first)-1].ID, 2)
+	require.NoError(s.T(), err)
+
+	// Assert
+	require.Len(s.T(), first, 2)
+	assert.Equal(s.T(), ids[0], first[0].ID)
+	assert.Equal(s.T(), ids[1], first[1].ID)
+	assert.Len(s.T(), first[1].Attachments, 1)
+	require.Len(s.T(), rest, 1)
+	assert.Equal(s.T(), ids[2], rest[0].ID)
+}
+
 // ==================== CountUnread Tests ====================
 
 func (s *MessageRepositoryTestSuite) TestCountUnread_ReturnsCorrectCount() {
@@ -546,3 +644,378 @@ func (s *MessageRepositoryTestSuite) TestCRUD_RoundTrip() {
 	_, err = s.repo.GetByID(context.Background(), message.ID)
 	assert.ErrorIs(s.T(), err, ErrNotFound)
 }
+
+// ==================== Retention Tests ====================
+
+func (s *MessageRepositoryTestSuite) TestListIDsReceivedBefore_ReturnsOldestFirst() {
+	// Arrange
+	now := time.Now()
+	old := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", ReceivedAt: now.Add(-48 * time.Hour)}
+	older := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com", ReceivedAt: now.Add(-72 * time.Hour)}
+	fresh := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "c@example.com", ReceivedAt: now}
+	for _, m := range []*models.Message{old, older, fresh} {
+		require.NoError(s.T(), s.repo.Create(context.Background(), m))
+	}
+
+	// Act
+	ids, err := s.repo.ListIDsReceivedBefore(context.Background(), s.testDomain.ID, now.Add(-24*time.Hour), 10)
+	count, countErr := s.repo.CountReceivedBefore(context.Background(), s.testDomain.ID, now.Add(-24*time.Hour))
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), countErr)
+	assert.Equal(s.T(), []uint{older.ID, old.ID}, ids)
+	assert.Equal(s.T(), int64(2), count)
+}
+
+func (s *MessageRepositoryTestSuite) TestListIDsReceivedBefore_OtherDomain() {
+	// Arrange
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", ReceivedAt: time.Now().Add(-48 * time.Hour)}
+	require.NoError(s.T(), s.repo.Create(context.Background(), message))
+
+	// Act
+	ids, err := s.repo.ListIDsReceivedBefore(context.Background(), s.testDomain.ID+1, time.Now(), 10)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), ids)
+}
+
+func (s *MessageRepositoryTestSuite) TestDeleteByIDs_ReturnsAttachmentPaths() {
+	// Arrange
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"}
+	attachments := []models.Attachment{
+		{Filename: "a.pdf", FilePath: "ab/a.pdf"},
+		{Filename: "b.png", FilePath: "cd/b.png", HasPreview: true, PreviewPath: "ef/b-preview.jpg"},
+	}
+	require.NoError(s.T(), s.repo.CreateWithAttachments(context.Background(), message, attachments))
+	keep := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com"}
+	require.NoError(s.T(), s.repo.Create(context.Background(), keep))
+
+	// Act
+	paths, err := s.repo.DeleteByIDs(context.Background(), []uint{message.ID})
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.ElementsMatch(s.T(), []string{"ab/a.pdf", "cd/b.png", "ef/b-preview.jpg"}, paths)
+	_, err = s.repo.GetByID(context.Background(), message.ID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+	_, err = s.repo.GetByID(context.Background(), keep.ID)
+	assert.NoError(s.T(), err)
+
+	var remaining int64
+	s.db.Model(&models.Attachment{}).Count(&remaining)
+	assert.Zero(s.T(), remaining)
+}
+
+func (s *MessageRepositoryTestSuite) TestDeleteByIDs_Empty() {
+	// Act
+	paths, err := s.repo.DeleteByIDs(context.Background(), nil)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), paths)
+}
+
+func (s *MessageRepositoryTestSuite) TestBulkUpdates_ReadFlaggedAndMove() {
+	// Arrange
+	ctx := context.Background()
+	other := &models.Mailbox{LocalPart: "other", DomainID: s.testDomain.ID, FullAddress: "other@test.com"}
+	require.NoError(s.T(), s.db.Create(other).Error)
+	first := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"}
+	second := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com"}
+	require.NoError(s.T(), s.repo.Create(ctx, first))
+	require.NoError(s.T(), s.repo.Create(ctx, second))
+	ids := []uint{first.ID, second.ID}
+
+	// Act
+	read, readErr := s.repo.SetReadByIDs(ctx, ids, true)
+	flagged, flagErr := s.repo.SetFlaggedByIDs(ctx, []uint{first.ID}, true)
+	moved, moveErr := s.repo.MoveByIDs(ctx, []uint{second.ID}, other.ID)
+	mailboxes, mapErr := s.repo.MailboxIDsByIDs(ctx, append(ids, 99999))
+
+	// Assert
+	require.NoError(s.T(), readErr)
+	require.NoError(s.T(), flagErr)
+	require.NoError(s.T(), moveErr)
+	require.NoError(s.T(), mapErr)
+	assert.Equal(s.T(), int64(2), read)
+	assert.Equal(s.T(), int64(1), flagged)
+	assert.Equal(s.T(), int64(1), moved)
+	assert.Equal(s.T(), map[uint]uint{first.ID: s.testMailbox.ID, second.ID: other.ID}, mailboxes)
+
+	found, err := s.repo.GetByID(ctx, first.ID)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), found.IsRead)
+	assert.True(s.T(), found.IsFlagged)
+}
+
+func (s *MessageRepositoryTestSuite) TestSetFlags() {
+	// Arrange
+	ctx := context.Background()
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"}
+	require.NoError(s.T(), s.repo.Create(ctx, message))
+
+	// Act
+	err := s.repo.SetFlags(ctx, message.ID, map[string]bool{`\answered`: true, models.FlagDraft: true, models.FlagSeen: true})
+
+	// Assert
+	require.NoError(s.T(), err)
+	found, err := s.repo.GetByID(ctx, message.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{models.FlagSeen, models.FlagAnswered, models.FlagDraft}, found.Flags())
+	assert.ErrorIs(s.T(), s.repo.SetFlags(ctx, message.ID, map[string]bool{`\Recent`: true}), ErrInvalidInput)
+	assert.ErrorIs(s.T(), s.repo.SetFlags(ctx, 99999, map[string]bool{models.FlagSeen: true}), ErrNotFound)
+}
+
+func (s *MessageRepositoryTestSuite) TestMoveByIDs_ClearsFolderAndLabels() {
+	// Arrange
+	ctx := context.Background()
+	other := &models.Mailbox{LocalPart: "other", DomainID: s.testDomain.ID, FullAddress: "other@test.com"}
+	require.NoError(s.T(), s.db.Create(other).Error)
+	folder := &models.Folder{MailboxID: s.testMailbox.ID, Name: "Work"}
+	require.NoError(s.T(), s.db.Create(folder).Error)
+	label := &models.Label{MailboxID: s.testMailbox.ID, Name: "work", Color: models.DefaultLabelColor}
+	require.NoError(s.T(), s.db.Create(label).Error)
+	message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", FolderID: &folder.ID}
+	require.NoError(s.T(), s.repo.Create(ctx, message))
+	require.NoError(s.T(), NewLabelRepository(s.db).SetMessageLabels(ctx, message.ID, []uint{label.ID}))
+
+	// Act
+	moved, err := s.repo.MoveByIDs(ctx, []uint{message.ID}, other.ID)
+
+	// Assert
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(1), moved)
+	found, err := s.repo.GetByID(ctx, message.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), other.ID, found.MailboxID)
+	assert.Nil(s.T(), found.FolderID)
+	var labels int64
+	s.db.Model(&models.MessageLabel{}).Count(&labels)
+	assert.Zero(s.T(), labels)
+}
+
+func (s *MessageRepositoryTestSuite) TestListFolderItems_InboxAndCustomFolder() {
+	// Arrange
+	ctx := context.Background()
+	folders := NewFolderRepository(s.db)
+	inbox, err := folders.GetByRole(ctx, s.testMailbox.ID, models.FolderRoleInbox)
+	require.NoError(s.T(), err)
+	work := &models.Folder{MailboxID: s.testMailbox.ID, Name: "Work"}
+	require.NoError(s.T(), folders.Create(ctx, work))
+	first := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", ReceivedAt: time.Now()}
+	filed := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com", FolderID: &work.ID}
+	second := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "c@example.com", ReceivedAt: time.Now().Add(-time.Hour)}
+	for _, message := range []*models.Message{first, filed, second} {
+		require.NoError(s.T(), s.repo.Create(ctx, message))
+	}
+
+	// Act
+	inboxItems, inboxErr := s.repo.ListFolderItems(ctx, s.testMailbox.ID, inbox.ID)
+	workItems, workErr := s.repo.ListFolderItems(ctx, s.testMailbox.ID, work.ID)
+
+	// Assert
+	require.NoError(s.T(), inboxErr)
+	require.NoError(s.T(), workErr)
+	require.Len(s.T(), inboxItems, 2)
+	assert.Equal(s.T(), first.ID, inboxItems[0].ID)
+	assert.Equal(s.T(), second.ID, inboxItems[1].ID)
+	require.Len(s.T(), workItems, 1)
+	assert.Equal(s.T(), filed.ID, workItems[0].ID)
+}
+
+func (s *MessageRepositoryTestSuite) TestSetFolderByIDs_AssignsNewUIDs() {
+	// Arrange
+	ctx := context.Background()
+	folders := NewFolderRepository(s.db)
+	work := &models.Folder{MailboxID: s.testMailbox.ID, Name: "Work"}
+	require.NoError(s.T(), folders.Create(ctx, work))
+	older := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"}
+	newer := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com"}
+	require.NoError(s.T(), s.repo.Create(ctx, older))
+	require.NoError(s.T(), s.repo.Create(ctx, newer))
+	require.Less(s.T(), older.UID, newer.UID)
+
+	// Act
+	_, err := s.repo.SetFolderByIDs(ctx, []uint{newer.ID}, &work.ID)
+	require.NoError(s.T(), err)
+	_, err = s.repo.SetFolderByIDs(ctx, []uint{older.ID, newer.ID}, &work.ID)
+	require.NoError(s.T(), err)
+
+	// Assert: the message moved last sorts last, and staying put keeps a UID
+	items, err := s.repo.ListFolderItems(ctx, s.testMailbox.ID, work.ID)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), items, 2)
+	assert.Equal(s.T(), newer.ID, items[0].ID)
+	assert.Equal(s.T(), older.ID, items[1].ID)
+	assert.Greater(s.T(), items[0].UID, newer.UID)
+	assert.Greater(s.T(), items[1].UID, items[0].UID)
+
+	// Deleting the folder returns the messages to the Inbox with new UIDs
+	require.NoError(s.T(), folders.Delete(ctx, work.ID))
+	var mailbox models.Mailbox
+	require.NoError(s.T(), s.db.First(&mailbox, s.testMailbox.ID).Error)
+	var uids []uint
+	require.NoError(s.T(), s.db.Model(&models.Message{}).Order("uid").Pluck("uid", &uids).Error)
+	assert.Greater(s.T(), uids[0], items[1].UID)
+	assert.Equal(s.T(), mailbox.UIDNext, uids[1]+1)
+}
+
+func (s *MessageRepositoryTestSuite) TestSearchIDs_PagesInIDOrder() {
+	// Arrange
+	ctx := context.Background()
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		message := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", Subject: "Invoice"}
+		require.NoError(s.T(), s.repo.Create(ctx, message))
+		ids = append(ids, message.ID)
+	}
+	require.NoError(s.T(), s.repo.Create(ctx, &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com", Subject: "News"}))
+	query, err := search.Parse("invoice")
+	require.NoError(s.T(), err)
+	scope := SearchScope{MailboxID: s.testMailbox.ID}
+
+	// Act
+	page, err := s.repo.SearchIDs(ctx, query, scope, 0, 2)
+	require.NoError(s.T(), err)
+	rest, err := s.repo.SearchIDs(ctx, query, scope, page[len(page)-1], 2)
+	require.NoError(s.T(), err)
+
+	// Assert
+	assert.Equal(s.T(), ids, append(page, rest...))
+}
+
+func (s *MessageRepositoryTestSuite) TestEncryptedBodies_ListAndUpdateStored() {
+	ctx := context.Background()
+	keyring, err := encryption.NewKeyring(bytes.Repeat([]byte{1}, encryption.KeySize))
+	s.Require().NoError(err)
+	encryption.ConfigureColumns(keyring, true)
+	defer encryption.ConfigureColumns(nil, false)
+
+	// A row written before encryption was enabled
+	s.Require().NoError(s.db.Exec(
+		"INSERT INTO messages (mailbox_id, sender_email, body_text, received_at) VALUES (?, ?, ?, ?)",
+		s.testMailbox.ID, "a@example.com", "plain text", time.Now(),
+	).Error)
+	encrypted := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com", BodyText: "secret", BodyHTML: "<p>secret</p>"}
+	s.Require().NoError(s.repo.Create(ctx, encrypted))
+
+	bodies, err := s.repo.ListEncryptedBodiesAfterID(ctx, 0, 10)
+	s.NoError(err)
+	s.Require().Len(bodies, 1)
+	s.Equal(encrypted.ID, bodies[0].ID)
+	s.True(encryption.IsEncryptedValue(bodies[0].BodyText))
+	s.True(encryption.IsEncryptedValue(bodies[0].BodyHTML))
+
+	// Stored values are written verbatim, not encrypted again
+	s.NoError(s.repo.UpdateStoredBody(ctx, models.StoredMessageBody{
+		ID: encrypted.ID, BodyText: bodies[0].BodyHTML, BodyHTML: bodies[0].BodyText,
+	}))
+	_, err = s.repo.GetByID(ctx, encrypted.ID)
+	s.Error(err, "values are bound to their column and must not decrypt elsewhere")
+
+	// A body copied from another message does not decrypt either
+	other := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "c@example.com", BodyText: "other secret"}
+	s.Require().NoError(s.repo.Create(ctx, other))
+	s.Require().NoError(s.db.Exec("UPDATE messages SET body_text = (SELECT body_text FROM messages WHERE id = ?) WHERE id = ?", other.ID, encrypted.ID).Error)
+	_, err = s.repo.GetByID(ctx, encrypted.ID)
+	s.Error(err, "values are bound to their row and must not decrypt in another one")
+
+	s.NoError(s.repo.UpdateStoredBody(ctx, bodies[0]))
+	found, err := s.repo.GetByID(ctx, encrypted.ID)
+	s.NoError(err)
+	s.Equal("secret", found.BodyText)
+	s.Equal("<p>secret</p>", found.BodyHTML)
+
+	s.ErrorIs(s.repo.UpdateStoredBody(ctx, models.StoredMessageBody{ID: 99999}), ErrNotFound)
+}
+
+// ==================== Change Log Tests ====================
+
+func (s *MessageRepositoryTestSuite) TestMessageChanges_RecordedAndListed() {
+	ctx := context.Background()
+	changes := NewMessageChangeRepository(s.db)
+	since, err := changes.LatestSeq(ctx, s.testMailbox.ID)
+	require.NoError(s.T(), err)
+
+	kept := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com", Subject: "Kept"}
+	removed := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "b@example.com", Subject: "Removed"}
+	require.NoError(s.T(), s.repo.Create(ctx, kept))
+	require.NoError(s.T(), s.repo.Create(ctx, removed))
+	_, err = s.repo.SetReadByIDs(ctx, []uint{kept.ID}, true)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), s.repo.Delete(ctx, removed.ID))
+
+	list, err := changes.ListSince(ctx, s.testMailbox.ID, since, 10)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), list, 4)
+	assert.Equal(s.T(), models.MessageCreated, list[0].Kind)
+	assert.Equal(s.T(), kept.ID, list[0].MessageID)
+	assert.Equal(s.T(), models.MessageUpdated, list[2].Kind)
+	assert.Equal(s.T(), kept.ID, list[2].MessageID)
+	assert.Equal(s.T(), models.MessageDestroyed, list[3].Kind)
+	assert.Equal(s.T(), removed.ID, list[3].MessageID)
+	for i, change := range list {
+		assert.Equal(s.T(), since+uint(i)+1, change.Seq, "seqs have no gaps")
+	}
+
+	latest, err := changes.LatestSeq(ctx, s.testMailbox.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), list[3].Seq, latest)
+
+	hasChanges, err := changes.HasChangesSince(ctx, s.testMailbox.ID, latest)
+	require.NoError(s.T(), err)
+	assert.False(s.T(), hasChanges)
+
+	// Pruning drops the changes but not the state
+	_, err = changes.DeleteBefore(ctx, time.Now().Add(time.Hour))
+	require.NoError(s.T(), err)
+	oldest, err := changes.OldestSeq(ctx, s.testMailbox.ID)
+	require.NoError(s.T(), err)
+	assert.Zero(s.T(), oldest)
+	latest, err = changes.LatestSeq(ctx, s.testMailbox.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), list[3].Seq, latest)
+}
+
+func (s *MessageRepositoryTestSuite) TestMessageChanges_NumberedPerMailbox() {
+	ctx := context.Background()
+	changes := NewMessageChangeRepository(s.db)
+	other := &models.Mailbox{LocalPart: "other", DomainID: s.testDomain.ID, FullAddress: "other@test.com"}
+	require.NoError(s.T(), s.db.Create(other).Error)
+
+	mine := &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "a@example.com"}
+	theirs := &models.Message{MailboxID: other.ID, SenderEmail: "b@example.com"}
+	require.NoError(s.T(), s.repo.Create(ctx, mine))
+	require.NoError(s.T(), s.repo.Create(ctx, theirs))
+
+	// A bulk change across mailboxes numbers the changes of each one on its own
+	_, err := s.repo.SetReadByIDs(ctx, []uint{mine.ID, theirs.ID}, true)
+	require.NoError(s.T(), err)
+
+	for _, mailboxID := range []uint{s.testMailbox.ID, other.ID} {
+		latest, err := changes.LatestSeq(ctx, mailboxID)
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), uint(2), latest)
+		list, err := changes.ListSince(ctx, mailboxID, 0, 10)
+		require.NoError(s.T(), err)
+		require.Len(s.T(), list, 2)
+		assert.Equal(s.T(), uint(1), list[0].Seq)
+		assert.Equal(s.T(), uint(2), list[1].Seq)
+	}
+}
+
+func (s *MessageRepositoryTestSuite) TestMessageChanges_SkipFailedUpdates() {
+	ctx := context.Background()
+	changes := NewMessageChangeRepository(s.db)
+	since, err := changes.LatestSeq(ctx, s.testMailbox.ID)
+	require.NoError(s.T(), err)
+
+	err = s.repo.SetFlags(ctx, 999999, map[string]bool{models.FlagSeen: true})
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+
+	list, err := changes.ListSince(ctx, s.testMailbox.ID, since, 10)
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), list)
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"gorm.io/gorm"
+)
+
+// searchConfig is the PostgreSQL text search configuration; "simple" does no
+// stemming, so highlighted words are exactly the indexed ones in any language
+const searchConfig = "simple"
+
+// indexEncryptedBodies is set by ConfigureSearch
+var indexEncryptedBodies atomic.Bool
+
+// ConfigureSearch sets whether message bodies are indexed while they are
+// encrypted in the database. They are left out by default, because the index
+// would hold their words in plaintext; when indexed, word positions are
+// stripped so bodies cannot be pieced back together, at the cost of phrase
+// matching in bodies.
+func ConfigureSearch(indexEncrypted bool) {
+	indexEncryptedBodies.Store(indexEncrypted)
+}
+
+// SearchScope limits a search to a mailbox or to all mailboxes of a domain;
+// zero fields are not applied
+type SearchScope struct {
+	MailboxID uint
+	DomainID  uint
+}
+
+// Search finds messages matching query within scope. Results are ordered by
+// relevance when the query has text terms, and newest first otherwise.
+// On PostgreSQL text terms use the full-text index; other databases fall back
+// to substring matching, which skips bodies while they are encrypted.
+func (r *messageRepository) Search(ctx context.Context, query *search.Query, scope SearchScope, limit, offset int) ([]models.MessageSearchHit, int64, error) {
+	fullText := query.HasText() && isPostgres(r.db)
+	filtered := func() *gorm.DB {
+		return r.searchFilters(r.db.WithContext(ctx).Table("messages").Scopes(scopeDomains(ctx, "mb.domain_id")), query, scope, fullText)
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	var ranked []struct {
+		ID             uint
+		MailboxAddress string
+		Rank           float64
+	}
+	page := filtered()
+	if fullText {
+		page = page.Select("messages.id, mb.full_address AS mailbox_address, ts_rank(si.document, to_tsquery(?, ?)) AS rank",
+			searchConfig, query.TSQuery()).
+			Order("rank DESC")
+	} else {
+		page = page.Select("messages.id, mb.full_address AS mailbox_address, 0 AS rank")
+	}
+	err := page.Order("messages.received_at DESC").Order("messages.id DESC").
+		Limit(limit).Offset(offset).
+		Scan(&ranked).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search messages: %w", err)
+	}
+	if len(ranked) == 0 {
+		return []models.MessageSearchHit{}, total, nil
+	}
+
+	// Load the full messages so bodies are decrypted for highlighting
+	ids := make([]uint, len(ranked))
+	for i, hit := range ranked {
+		ids[i] = hit.ID
+	}
+	var messages []models.Message
+	if err := r.db.WithContext(ctx).Preload("Attachments").Where("id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load search results: %w", err)
+	}
+	byID := make(map[uint]models.Message, len(messages))
+	for _, message := range messages {
+		byID[message.ID] = message
+	}
+
+	hits := make([]models.MessageSearchHit, 0, len(ranked))
+	for _, hit := range ranked {
+		message, ok := byID[hit.ID]
+		if !ok {
+			// Deleted between the two queries
+			continue
+		}
+		hits = append(hits, models.MessageSearchHit{Message: message, MailboxAddress: hit.MailboxAddress, Rank: hit.Rank})
+	}
+	return hits, total, nil
+}
+
+// SearchIDs returns up to limit IDs of messages matching query within scope with
+// an ID above afterID, in ID order; it is used to walk all matches in batches
+func (r *messageRepository) SearchIDs(ctx context.Context, query *search.Query, scope SearchScope, afterID uint, limit int) ([]uint, error) {
+	fullText := query.HasText() && isPostgres(r.db)
+	var ids []uint
+	err := r.searchFilters(r.db.WithContext(ctx).Table("messages").Scopes(scopeDomains(ctx, "mb.domain_id")), query, scope, fullText).
+		Where("messages.id > ?", afterID).
+		Order("messages.id ASC").
+		Limit(limit).
+		Pluck("messages.id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search message IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// searchFilters applies the scope and every query condition to db
+func (r *messageRepository) searchFilters(db *gorm.DB, query *search.Query, scope SearchScope, fullText bool) *gorm.DB {
+	db = db.Joins("JOIN mailboxes mb ON mb.id = messages.mailbox_id")
+	if scope.MailboxID != 0 {
+		db = db.Where("messages.mailbox_id = ?", scope.MailboxID)
+	}
+	if scope.DomainID != 0 {
+		db = db.Where("mb.domain_id = ?", scope.DomainID)
+	}
+
+	if fullText {
+		db = db.Joins("JOIN message_search_index si ON si.message_id = messages.id").
+			Where("si.document @@ to_tsquery(?, ?)", searchConfig, query.TSQuery())
+	} else {
+		texts := append([]string{}, query.Terms...)
+		for _, phrase := range query.Phrases {
+			texts = append(texts, strings.Join(phrase, " "))
+		}
+		// Encrypted bodies are ciphertext in the database and never match
+		body := ` OR LOWER(messages.body_text) LIKE @pattern ESCAPE '\'`
+		if encryption.ColumnsEncrypted() {
+			body = ""
+		}
+		for _, text := range texts {
+			db = db.Where(`(LOWER(messages.subject) LIKE @pattern ESCAPE '\' OR LOWER(messages.sender_email) LIKE @pattern ESCAPE '\'`+
+				` OR LOWER(messages.sender_name) LIKE @pattern ESCAPE '\'`+body+
+				` OR EXISTS (SELECT 1 FROM attachments fa WHERE fa.message_id = messages.id AND LOWER(fa.filename) LIKE @pattern ESCAPE '\'))`,
+				sql.Named("pattern", containsPattern(text)))
+		}
+	}
+
+	for _, from := range query.From {
+		pattern := containsPattern(from)
+		db = db.Where(`(LOWER(messages.sender_email) LIKE ? ESCAPE '\' OR LOWER(messages.sender_name) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	for _, to := range query.To {
+		db = db.Where(`LOWER(mb.full_address) LIKE ? ESCAPE '\'`, containsPattern(to))
+	}
+	for _, subject := range query.Subject {
+		db = db.Where(`LOWER(messages.subject) LIKE ? ESCAPE '\'`, containsPattern(subject))
+	}
+	if query.HasAttachment {
+		db = db.Where("EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = messages.id AND a.inline = ?)", false)
+	}
+	if query.Unread != nil {
+		db = db.Where("messages.is_read = ?", !*query.Unread)
+	}
+	if !query.After.IsZero() {
+		db = db.Where("messages.received_at >= ?", query.After)
+	}
+	if !query.Before.IsZero() {
+		db = db.Where("messages.received_at < ?", query.Before)
+	}
+	return db
+}
+
+// IndexUnindexed adds up to limit messages that have no search document yet,
+// such as messages stored before search existed, and returns how many it indexed.
+// It does nothing on databases without full-text search.
+func (r *messageRepository) IndexUnindexed(ctx context.Context, limit int) (int, error) {
+	if !isPostgres(r.db) {
+		return 0, nil
+	}
+
+	var messages []models.Message
+	err := r.db.WithContext(ctx).Preload("Attachments").
+		Where("NOT EXISTS (SELECT 1 FROM message_search_index si WHERE si.message_id = messages.id)").
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unindexed messages: %w", err)
+	}
+
+	for i := range messages {
+		if err := indexMessage(r.db.WithContext(ctx), &messages[i], messages[i].Attachments); err != nil {
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
+
+// indexMessage writes the search document of a message. Subject matches rank
+// highest, then sender and attachment names, then the body. Encrypted bodies
+// are left out, or indexed without word positions when ConfigureSearch allows it.
+func indexMessage(db *gorm.DB, message *models.Message, attachments []models.Attachment) error {
+	if !isPostgres(db) {
+		return nil
+	}
+
+	names := []string{message.SenderName, message.SenderEmail, strings.Join(search.Words(message.SenderEmail), " ")}
+	for _, attachment := range attachments {
+		names = append(names, attachment.Filename, strings.Join(search.Words(attachment.Filename), " "))
+	}
+	body := message.BodyText
+	if body == "" {
+		body = search.PlainText(message.BodyHTML)
+	}
+	bodyVector := "to_tsvector(?, ?)"
+	if encryption.ColumnsEncrypted() {
+		if indexEncryptedBodies.Load() {
+			bodyVector = "strip(to_tsvector(?, ?))"
+		} else {
+			body = ""
+		}
+	}
+
+	err := db.Exec(`INSERT INTO message_search_index (message_id, document) VALUES (?,
+			setweight(to_tsvector(?, ?), 'A') || setweight(to_tsvector(?, ?), 'B') || setweight(`+bodyVector+`, 'C'))
+		ON CONFLICT (message_id) DO UPDATE SET document = EXCLUDED.document`,
+		message.ID,
+		searchConfig, search.IndexText(message.Subject),
+		searchConfig, search.IndexText(strings.Join(names, " ")),
+		searchConfig, search.IndexText(body),
+	).Error
+	if err != nil {
+		return fmt.Errorf("failed to index message: %w", err)
+	}
+	return nil
+}
+
+// containsPattern builds a LIKE pattern matching value anywhere, case-insensitively
+func containsPattern(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(value))
+	return "%" + escaped + "%"
+}
+
+// isPostgres reports whether db is a PostgreSQL connection
+func isPostgres(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+)
+
+// ==================== Search Tests ====================
+// SQLite exercises the substring fallback; the filters are shared with PostgreSQL.
+
+// createSearchFixtures stores three messages in the test mailbox and one in another domain
+func (s *MessageRepositoryTestSuite) createSearchFixtures() (invoice, newsletter, reset *models.Message) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	invoice = &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "billing@shop.com", SenderName: "Shop Billing",
+		Subject: "Your invoice #42", BodyText: "Invoice attached. Total 10%", ReceivedAt: base}
+	newsletter = &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "news@shop.com",
+		Subject: "March newsletter", BodyText: "New products this month", IsRead: true, ReceivedAt: base.Add(24 * time.Hour)}
+	reset = &models.Message{MailboxID: s.testMailbox.ID, SenderEmail: "no-reply@auth.io",
+		Subject: "Password reset", BodyText: "Click to reset your password", ReceivedAt: base.Add(48 * time.Hour)}
+
+	require.NoError(s.T(), s.repo.CreateWithAttachments(context.Background(), invoice, []models.Attachment{
+		{Filename: "invoice-42.pdf", ContentType: "application/pdf", FilePath: "/a"},
+	}))
+	require.NoError(s.T(), s.repo.Create(context.Background(), newsletter))
+	require.NoError(s.T(), s.repo.Create(context.Background(), reset))
+
+	otherDomain := &models.Domain{Name: "other.com", IsActive: true}
+	require.NoError(s.T(), s.db.Create(otherDomain).Error)
+	otherMailbox := &models.Mailbox{LocalPart: "user", DomainID: otherDomain.ID, FullAddress: "user@other.com"}
+	require.NoError(s.T(), s.db.Create(otherMailbox).Error)
+	require.NoError(s.T(), s.repo.Create(context.Background(), &models.Message{
+		MailboxID: otherMailbox.ID, SenderEmail: "billing@shop.com", Subject: "Another invoice", ReceivedAt: base,
+	}))
+	return invoice, newsletter, reset
+}
+
+// searchIDs runs a search in the test domain and returns the IDs of the hits
+func (s *MessageRepositoryTestSuite) searchIDs(q string) []uint {
+	query, err := search.Parse(q)
+	require.NoError(s.T(), err)
+
+	hits, total, err := s.repo.Search(context.Background(), query, SearchScope{DomainID: s.testDomain.ID}, 20, 0)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(len(hits)), total)
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+		assert.Equal(s.T(), "user@test.com", hit.MailboxAddress)
+	}
+	return ids
+}
+
+func (s *MessageRepositoryTestSuite) TestSearch_TextAndOperators() {
+	// Arrange
+	invoice, newsletter, reset := s.createSearchFixtures()
+
+	// Act & Assert
+	assert.Equal(s.T(), []uint{invoice.ID}, s.searchIDs("invoice"))
+	assert.Equal(s.T(), []uint{invoice.ID}, s.searchIDs("10%"))
+	assert.Equal(s.T(), []uint{reset.ID}, s.searchIDs(`"reset your password"`))
+	assert.Equal(s.T(), []uint{newsletter.ID, invoice.ID}, s.searchIDs("from:shop.com"))
+	assert.Equal(s.T(), []uint{newsletter.ID}, s.searchIDs(`subject:"march news"`))
+	assert.Equal(s.T(), []uint{invoice.ID}, s.searchIDs("has:attachment"))
+	assert.Equal(s.T(), []uint{reset.ID, invoice.ID}, s.searchIDs("is:unread"))
+	assert.Equal(s.T(), []uint{newsletter.ID}, s.searchIDs("after:2024-03-02 before:2024-03-03"))
+	assert.Equal(s.T(), []uint{reset.ID, newsletter.ID, invoice.ID}, s.searchIDs("to:user@test"))
+	assert.Empty(s.T(), s.searchIDs("to:nobody"))
+}
+
+func (s *MessageRepositoryTestSuite) TestSearch_EncryptedBodiesSkipped() {
+	// Arrange
+	keyring, err := encryption.NewKeyring(bytes.Repeat([]byte{1}, encryption.KeySize))
+	require.NoError(s.T(), err)
+	encryption.ConfigureColumns(keyring, true)
+	defer encryption.ConfigureColumns(nil, false)
+	_, newsletter, _ := s.createSearchFixtures()
+
+	// Act & Assert
+	assert.Empty(s.T(), s.searchIDs("products"), "bodies are ciphertext")
+	assert.Equal(s.T(), []uint{newsletter.ID}, s.searchIDs("newsletter"))
+}
+
+func (s *MessageRepositoryTestSuite) TestSearch_AttachmentFilename() {
+	// Arrange
+	invoice, _, _ := s.createSearchFixtures()
+
+	// Act & Assert
+	assert.Equal(s.T(), []uint{invoice.ID}, s.searchIDs("pdf"))
+}
+
+func (s *MessageRepositoryTestSuite) TestSearch_MailboxScopeAndPaging() {
+	// Arrange
+	_, newsletter, reset := s.createSearchFixtures()
+	query, err := search.Parse("is:read")
+	require.NoError(s.T(), err)
+	all, err := search.Parse("from:@")
+	require.NoError(s.T(), err)
+
+	// Act
+	hits, total, err := s.repo.Search(context.Background(), query, SearchScope{MailboxID: s.testMailbox.ID}, 20, 0)
+	require.NoError(s.T(), err)
+	page, pageTotal, pageErr := s.repo.Search(context.Background(), all, SearchScope{MailboxID: s.testMailbox.ID}, 1, 0)
+
+	// Assert
+	require.Len(s.T(), hits, 1)
+	assert.Equal(s.T(), int64(1), total)
+	assert.Equal(s.T(), newsletter.ID, hits[0].ID)
+	assert.Equal(s.T(), "New products this month", hits[0].BodyText)
+	require.NoError(s.T(), pageErr)
+	require.Len(s.T(), page, 1)
+	assert.Equal(s.T(), int64(3), pageTotal)
+	assert.Equal(s.T(), reset.ID, page[0].ID)
+}
+
+func (s *MessageRepositoryTestSuite) TestIndexUnindexed_NoopWithoutPostgres() {
+	// Act
+	indexed, err := s.repo.IndexUnindexed(context.Background(), 10)
+
+	// Assert
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 0, indexed)
+}
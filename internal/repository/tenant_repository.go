@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TenantRepository defines the interface for tenant data access
+type TenantRepository interface {
+	Create(ctx context.Context, tenant *models.Tenant) error
+	GetByID(ctx context.Context, id uint) (*models.Tenant, error)
+	List(ctx context.Context) ([]models.Tenant, error)
+	Update(ctx context.Context, tenant *models.Tenant) error
+	Delete(ctx context.Context, id uint) error
+	Usage(ctx context.Context, id uint) (*models.TenantUsage, error)
+}
+
+// tenantRepository implements TenantRepository using GORM
+type tenantRepository struct {
+	db *gorm.DB
+}
+
+// NewTenantRepository creates a new TenantRepository instance
+func NewTenantRepository(db *gorm.DB) TenantRepository {
+	return &tenantRepository{db: db}
+}
+
+// Create creates a new tenant
+func (r *tenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	if err := r.db.WithContext(ctx).Create(tenant).Error; err != nil {
+		if isDuplicateKeyError(err) {
+			return fmt.Errorf("tenant with name '%s' already exists: %w", tenant.Name, ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to create tenant: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves a tenant by its ID
+func (r *tenantRepository) GetByID(ctx context.Context, id uint) (*models.Tenant, error) {
+	var tenant models.Tenant
+	result := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "id")).First(&tenant, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get tenant by ID: %w", result.Error)
+	}
+	return &tenant, nil
+}
+
+// List retrieves all tenants ordered by name
+func (r *tenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	var tenants []models.Tenant
+	if err := r.db.WithContext(ctx).Scopes(scopeTenant(ctx, "id")).Order("name ASC").Find(&tenants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// Update saves the name and limits of a tenant
+func (r *tenantRepository) Update(ctx context.Context, tenant *models.Tenant) error {
+	result := r.db.WithContext(ctx).Model(&models.Tenant{}).Scopes(scopeTenant(ctx, "id")).Where("id = ?", tenant.ID).
+		Updates(map[string]interface{}{
+			"name":          tenant.Name,
+			"max_domains":   tenant.MaxDomains,
+			"max_mailboxes": tenant.MaxMailboxes,
+		})
+	if result.Error != nil {
+		if isDuplicateKeyError(result.Error) {
+			return fmt.Errorf("tenant with name '%s' already exists: %w", tenant.Name, ErrDuplicateEntry)
+		}
+		return fmt.Errorf("failed to update tenant: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes a tenant and its API keys. Tenants owning domains are not
+// deleted; their domains have to be deleted or given to another tenant first.
+func (r *tenantRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var domains int64
+		if err := tx.Model(&models.Domain{}).Where("tenant_id = ?", id).Count(&domains).Error; err != nil {
+			return fmt.Errorf("failed to count tenant domains: %w", err)
+		}
+		if domains > 0 {
+			return fmt.Errorf("tenant still owns %d domains: %w", domains, ErrInvalidInput)
+		}
+		if err := tx.Where("tenant_id = ?", id).Delete(&models.APIKey{}).Error; err != nil {
+			return fmt.Errorf("failed to delete tenant API keys: %w", err)
+		}
+		result := tx.Scopes(scopeTenant(ctx, "id")).Delete(&models.Tenant{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete tenant: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// Usage counts the domains and mailboxes a tenant owns
+func (r *tenantRepository) Usage(ctx context.Context, id uint) (*models.TenantUsage, error) {
+	db := r.db.WithContext(ctx)
+	var usage models.TenantUsage
+	if err := db.Model(&models.Domain{}).Where("tenant_id = ?", id).Count(&usage.Domains).Error; err != nil {
+		return nil, fmt.Errorf("failed to count tenant domains: %w", err)
+	}
+	if err := db.Model(&models.Mailbox{}).Where("domain_id IN (?)", tenantDomainIDs(db, id)).Count(&usage.Mailboxes).Error; err != nil {
+		return nil, fmt.Errorf("failed to count tenant mailboxes: %w", err)
+	}
+	return &usage, nil
+}
+
+// lockTenant reads a tenant with its row locked until tx ends, so concurrent
+// creations for the tenant count what it owns one after another. Databases
+// without row locks, such as SQLite, serialize writers anyway.
+func lockTenant(tx *gorm.DB, tenantID uint) (*models.Tenant, error) {
+	var tenant models.Tenant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tenant, tenantID).Error; err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TenantRepositoryTestSuite tests tenants and the tenant scoping of the other repositories
+type TenantRepositoryTestSuite struct {
+	suite.Suite
+	db          *gorm.DB
+	repo        TenantRepository
+	keyRepo     APIKeyRepository
+	domainRepo  DomainRepository
+	mailboxRepo MailboxRepository
+	messageRepo MessageRepository
+	tenantA     *models.Tenant
+	tenantB     *models.Tenant
+}
+
+// SetupSuite runs once before all tests
+func (s *TenantRepositoryTestSuite) SetupSuite() {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(s.T(), err)
+
+	err = db.AutoMigrate(&models.Tenant{}, &models.APIKey{}, &models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{},
+		&models.Message{}, &models.MessageChange{}, &models.Attachment{}, &models.MailboxToken{},
+		&models.Folder{}, &models.Label{}, &models.MessageLabel{})
+	require.NoError(s.T(), err)
+
+	s.db = db
+	s.repo = NewTenantRepository(db)
+	s.keyRepo = NewAPIKeyRepository(db)
+	s.domainRepo = NewDomainRepository(db)
+	s.mailboxRepo = NewMailboxRepository(db)
+	s.messageRepo = NewMessageRepository(db)
+}
+
+// TearDownSuite runs once after all tests
+func (s *TenantRepositoryTestSuite) TearDownSuite() {
+	sqlDB, _ := s.db.DB()
+	if sqlDB != nil {
+		sqlDB.Close()
+	}
+}
+
+// SetupTest runs before each test - clean up data and create two tenants
+func (s *TenantRepositoryTestSuite) SetupTest() {
+	s.db.Exec("DELETE FROM messages")
+	s.db.Exec("DELETE FROM mailboxes")
+	s.db.Exec("DELETE FROM domains")
+	s.db.Exec("DELETE FROM api_keys")
+	s.db.Exec("DELETE FROM tenants")
+
+	s.tenantA = &models.Tenant{Name: "team-a"}
+	s.tenantB = &models.Tenant{Name: "team-b"}
+	require.NoError(s.T(), s.repo.Create(context.Background(), s.tenantA))
+	require.NoError(s.T(), s.repo.Create(context.Background(), s.tenantB))
+}
+
+// TestTenantRepositoryTestSuite runs the test suite
+func TestTenantRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(TenantRepositoryTestSuite))
+}
+
+// as returns a context limited to a tenant
+func (s *TenantRepositoryTestSuite) as(tenant *models.Tenant) context.Context {
+	return WithTenant(context.Background(), tenant.ID)
+}
+
+// createDomain creates a domain owned by a tenant
+func (s *TenantRepositoryTestSuite) createDomain(tenant *models.Tenant, name string) *models.Domain {
+	domain := &models.Domain{Name: name, IsActive: true}
+	require.NoError(s.T(), s.domainRepo.Create(s.as(tenant), domain))
+	return domain
+}
+
+// createMailbox creates a mailbox in a domain
+func (s *TenantRepositoryTestSuite) createMailbox(domain *models.Domain, localPart string) *models.Mailbox {
+	mailbox := &models.Mailbox{LocalPart: localPart, DomainID: domain.ID, FullAddress: localPart + "@" + domain.Name}
+	require.NoError(s.T(), s.mailboxRepo.Create(context.Background(), mailbox))
+	return mailbox
+}
+
+// createMessage creates a message in a mailbox
+func (s *TenantRepositoryTestSuite) createMessage(mailbox *models.Mailbox) *models.Message {
+	message := &models.Message{MailboxID: mailbox.ID, SenderEmail: "sender@example.com", Subject: "Hello"}
+	require.NoError(s.T(), s.messageRepo.Create(context.Background(), message))
+	return message
+}
+
+// ==================== Scoping Tests ====================
+
+func (s *TenantRepositoryTestSuite) TestDomains_OnlyOwnVisible() {
+	// Arrange
+	own := s.createDomain(s.tenantA, "a.com")
+	other := s.createDomain(s.tenantB, "b.com")
+
+	// Act
+	domains, err := s.domainRepo.List(s.as(s.tenantA), false)
+
+	// Assert
+	s.NoError(err)
+	s.Require().Len(domains, 1)
+	s.Equal(own.ID, domains[0].ID)
+	s.Require().NotNil(domains[0].TenantID)
+	s.Equal(s.tenantA.ID, *domains[0].TenantID)
+	_, err = s.domainRepo.GetByID(s.as(s.tenantA), other.ID)
+	s.ErrorIs(err, ErrNotFound)
+	_, err = s.domainRepo.GetByName(s.as(s.tenantA), "b.com")
+	s.ErrorIs(err, ErrNotFound)
+	s.ErrorIs(s.domainRepo.Delete(s.as(s.tenantA), other.ID), ErrNotFound)
+
+	all, err := s.domainRepo.List(context.Background(), false)
+	s.NoError(err)
+	s.Len(all, 2)
+}
+
+func (s *TenantRepositoryTestSuite) TestDomains_TenantCannotGiveAway() {
+	// Arrange
+	domain := s.createDomain(s.tenantA, "a.com")
+	domain.TenantID = &s.tenantB.ID
+
+	// Act
+	err := s.domainRepo.Update(s.as(s.tenantA), domain)
+
+	// Assert
+	s.NoError(err)
+	stored, err := s.domainRepo.GetByID(context.Background(), domain.ID)
+	s.NoError(err)
+	s.Equal(s.tenantA.ID, *stored.TenantID)
+
+	// A tenant cannot update a domain of another tenant either
+	other := s.createDomain(s.tenantB, "b.com")
+	s.ErrorIs(s.domainRepo.Update(s.as(s.tenantA), other), ErrNotFound)
+}
+
+func (s *TenantRepositoryTestSuite) TestMailboxes_OnlyOwnVisible() {
+	// Arrange
+	own := s.createMailbox(s.createDomain(s.tenantA, "a.com"), "inbox")
+	otherDomain := s.createDomain(s.tenantB, "b.com")
+	other := s.createMailbox(otherDomain, "inbox")
+	ctx := s.as(s.tenantA)
+
+	// Act & Assert
+	_, err := s.mailboxRepo.GetByID(ctx, own.ID)
+	s.NoError(err)
+	_, err = s.mailboxRepo.GetByID(ctx, other.ID)
+	s.ErrorIs(err, ErrNotFound)
+	_, err = s.mailboxRepo.GetByAddress(ctx, other.FullAddress)
+	s.ErrorIs(err, ErrNotFound)
+	mailboxes, total, err := s.mailboxRepo.ListByDomain(ctx, otherDomain.ID, 10, 0)
+	s.NoError(err)
+	s.Empty(mailboxes)
+	s.Zero(total)
+	s.ErrorIs(s.mailboxRepo.Delete(ctx, other.ID), ErrNotFound)
+	s.ErrorIs(s.mailboxRepo.Create(ctx, &models.Mailbox{LocalPart: "new", DomainID: otherDomain.ID, FullAddress: "new@b.com"}), ErrNotFound)
+}
+
+func (s *TenantRepositoryTestSuite) TestMessages_OnlyOwnVisible() {
+	// Arrange
+	own := s.createMessage(s.createMailbox(s.createDomain(s.tenantA, "a.com"), "inbox"))
+	otherMailbox := s.createMailbox(s.createDomain(s.tenantB, "b.com"), "inbox")
+	other := s.createMessage(otherMailbox)
+	ctx := s.as(s.tenantA)
+
+	// Act & Assert
+	_, err := s.messageRepo.GetByID(ctx, own.ID)
+	s.NoError(err)
+	_, err = s.messageRepo.GetByID(ctx, other.ID)
+	s.ErrorIs(err, ErrNotFound)
+	s.ErrorIs(s.messageRepo.Delete(ctx, other.ID), ErrNotFound)
+	s.ErrorIs(s.messageRepo.MarkAsRead(ctx, other.ID), ErrNotFound)
+	moved, err := s.messageRepo.MoveByIDs(ctx, []uint{own.ID}, otherMailbox.ID)
+	s.ErrorIs(err, ErrNotFound)
+	s.Zero(moved)
+
+	_, err = s.messageRepo.DeleteByIDs(ctx, []uint{own.ID, other.ID})
+	s.NoError(err)
+	_, err = s.messageRepo.GetByID(context.Background(), own.ID)
+	s.ErrorIs(err, ErrNotFound)
+	_, err = s.messageRepo.GetByID(context.Background(), other.ID)
+	s.NoError(err, "messages of other tenants are not deleted")
+}
+
+// ==================== Limit Tests ====================
+
+func (s *TenantRepositoryTestSuite) TestDomainLimit() {
+	// Arrange
+	s.tenantA.MaxDomains = 1
+	s.Require().NoError(s.repo.Update(context.Background(), s.tenantA))
+	s.createDomain(s.tenantA, "a.com")
+
+	// Act
+	err := s.domainRepo.Create(s.as(s.tenantA), &models.Domain{Name: "a2.com"})
+
+	// Assert
+	s.ErrorIs(err, ErrLimitExceeded)
+
+	// Domains given to the tenant count too
+	moved := s.createDomain(s.tenantB, "b.com")
+	moved.TenantID = &s.tenantA.ID
+	s.ErrorIs(s.domainRepo.Update(context.Background(), moved), ErrLimitExceeded)
+}
+
+func (s *TenantRepositoryTestSuite) TestDomain_UnknownTenant() {
+	// Arrange
+	unknown := s.tenantB.ID + 100
+
+	// Act
+	err := s.domainRepo.Create(WithTenant(context.Background(), unknown), &models.Domain{Name: "x.com"})
+
+	// Assert
+	s.ErrorIs(err, ErrInvalidInput)
+}
+
+func (s *TenantRepositoryTestSuite) TestMailboxLimit() {
+	// Arrange
+	s.tenantA.MaxMailboxes = 1
+	s.Require().NoError(s.repo.Update(context.Background(), s.tenantA))
+	domain := s.createDomain(s.tenantA, "a.com")
+	s.createMailbox(domain, "first")
+
+	// Act
+	err := s.mailboxRepo.Create(s.as(s.tenantA), &models.Mailbox{LocalPart: "second", DomainID: domain.ID, FullAddress: "second@a.com"})
+
+	// Assert
+	s.ErrorIs(err, ErrLimitExceeded)
+
+	// Mailboxes created for incoming mail, outside any tenant, count too
+	_, _, err = s.mailboxRepo.GetOrCreate(context.Background(), "third", domain.ID, domain.Name)
+	s.ErrorIs(err, ErrLimitExceeded)
+}
+
+func (s *TenantRepositoryTestSuite) TestLimits_LockTenantRow() {
+	// Arrange
+	// SQLite leaves out FOR UPDATE, so look for the clause on the statement
+	var locked []string
+	s.Require().NoError(s.db.Callback().Query().Before("gorm:query").Register("test:tenant_locks", func(db *gorm.DB) {
+		if _, ok := db.Statement.Clauses["FOR"]; ok && db.Statement.Table == "tenants" {
+			locked = append(locked, db.Statement.Table)
+		}
+	}))
+	defer s.db.Callback().Query().Remove("test:tenant_locks")
+	s.tenantA.MaxDomains = 2
+	s.tenantA.MaxMailboxes = 2
+	s.Require().NoError(s.repo.Update(context.Background(), s.tenantA))
+
+	// Act
+	domain := s.createDomain(s.tenantA, "a.com")
+	s.createMailbox(domain, "first")
+
+	// Assert
+	s.Equal([]string{"tenants", "tenants"}, locked)
+}
+
+// ==================== Tenant Tests ====================
+
+func (s *TenantRepositoryTestSuite) TestUsageAndDelete() {
+	// Arrange
+	domain := s.createDomain(s.tenantA, "a.com")
+	s.createMailbox(domain, "one")
+	s.createMailbox(domain, "two")
+	s.createMailbox(s.createDomain(s.tenantB, "b.com"), "other")
+
+	// Act
+	usage, err := s.repo.Usage(context.Background(), s.tenantA.ID)
+
+	// Assert
+	s.NoError(err)
+	s.Equal(int64(1), usage.Domains)
+	s.Equal(int64(2), usage.Mailboxes)
+	s.ErrorIs(s.repo.Delete(context.Background(), s.tenantA.ID), ErrInvalidInput)
+	s.Require().NoError(s.domainRepo.Delete(context.Background(), domain.ID))
+	s.NoError(s.repo.Delete(context.Background(), s.tenantA.ID))
+	s.ErrorIs(s.repo.Delete(context.Background(), s.tenantA.ID), ErrNotFound)
+}
+
+func (s *TenantRepositoryTestSuite) TestTenants_OnlyOwnVisible() {
+	// Act
+	tenants, err := s.repo.List(s.as(s.tenantA))
+
+	// Assert
+	s.NoError(err)
+	s.Require().Len(tenants, 1)
+	s.Equal(s.tenantA.ID, tenants[0].ID)
+	_, err = s.repo.GetByID(s.as(s.tenantA), s.tenantB.ID)
+	s.ErrorIs(err, ErrNotFound)
+}
+
+// ==================== API Key Tests ====================
+
+func (s *TenantRepositoryTestSuite) TestAPIKeys_ByOwner() {
+	// Arrange
+	ctx := context.Background()
+	admin := &models.APIKey{Role: models.RoleSuperAdmin, KeyHash: "admin"}
+	tenantKey := &models.APIKey{TenantID: &s.tenantA.ID, Role: models.RoleTenant, KeyHash: "tenant"}
+	s.Require().NoError(s.keyRepo.Create(ctx, admin))
+	s.Require().NoError(s.keyRepo.Create(ctx, tenantKey))
+
+	// Act
+	adminKeys, err := s.keyRepo.ListByTenant(ctx, nil)
+	s.Require().NoError(err)
+	tenantKeys, err := s.keyRepo.ListByTenant(ctx, &s.tenantA.ID)
+	s.Require().NoError(err)
+
+	// Assert
+	s.Require().Len(adminKeys, 1)
+	s.Equal(admin.ID, adminKeys[0].ID)
+	s.Require().Len(tenantKeys, 1)
+	s.Equal(tenantKey.ID, tenantKeys[0].ID)
+	s.ErrorIs(s.keyRepo.Delete(ctx, nil, tenantKey.ID), ErrNotFound)
+	s.ErrorIs(s.keyRepo.Delete(ctx, &s.tenantB.ID, tenantKey.ID), ErrNotFound)
+	s.NoError(s.keyRepo.Delete(ctx, &s.tenantA.ID, tenantKey.ID))
+	_, err = s.keyRepo.GetByHash(ctx, "tenant")
+	s.ErrorIs(err, ErrNotFound)
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// tenantKey is the context key of the tenant repositories are limited to
+type tenantKey struct{}
+
+// WithTenant returns a context in which the repositories only read and change
+// rows of a tenant: its domains, their mailboxes and everything in them.
+// Without a tenant, as in the mail servers and background jobs, every row is
+// visible.
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set with WithTenant, if any
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(uint)
+	return tenantID, ok
+}
+
+// scopeTenant limits a query to rows whose tenant column is the tenant of ctx
+func scopeTenant(ctx context.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tenantID, ok := TenantFromContext(ctx)
+		if !ok {
+			return db
+		}
+		return db.Where(column+" = ?", tenantID)
+	}
+}
+
+// scopeDomains limits a query to rows whose domain column names a domain of
+// the tenant of ctx
+func scopeDomains(ctx context.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tenantID, ok := TenantFromContext(ctx)
+		if !ok {
+			return db
+		}
+		return db.Where(column+" IN (?)", tenantDomainIDs(db, tenantID))
+	}
+}
+
+// scopeMailboxes limits a query to rows whose mailbox column names a mailbox
+// of the tenant of ctx
+func scopeMailboxes(ctx context.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tenantID, ok := TenantFromContext(ctx)
+		if !ok {
+			return db
+		}
+		return db.Where(column+" IN (?)", tenantMailboxIDs(db, tenantID))
+	}
+}
+
+// scopeMessages limits a query to rows whose message column names a message
+// of the tenant of ctx
+func scopeMessages(ctx context.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		tenantID, ok := TenantFromContext(ctx)
+		if !ok {
+			return db
+		}
+		messageIDs := newQuery(db).Model(&models.Message{}).Select("id").
+			Where("mailbox_id IN (?)", tenantMailboxIDs(db, tenantID))
+		return db.Where(column+" IN (?)", messageIDs)
+	}
+}
+
+// tenantDomainIDs selects the IDs of the domains of a tenant
+func tenantDomainIDs(db *gorm.DB, tenantID uint) *gorm.DB {
+	return newQuery(db).Model(&models.Domain{}).Select("id").Where("tenant_id = ?", tenantID)
+}
+
+// tenantMailboxIDs selects the IDs of the mailboxes of a tenant
+func tenantMailboxIDs(db *gorm.DB, tenantID uint) *gorm.DB {
+	return newQuery(db).Model(&models.Mailbox{}).Select("id").Where("domain_id IN (?)", tenantDomainIDs(db, tenantID))
+}
+
+// newQuery starts a subquery on the connection of a query being built
+func newQuery(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true})
+}
+
+// ownedIDs narrows ids to those of the rows of model that scope lets through;
+// without a tenant in ctx ids are returned as they are
+func ownedIDs(ctx context.Context, db *gorm.DB, model interface{}, scope func(*gorm.DB) *gorm.DB, ids []uint) ([]uint, error) {
+	if _, ok := TenantFromContext(ctx); !ok || len(ids) == 0 {
+		return ids, nil
+	}
+	var owned []uint
+	if err := db.WithContext(ctx).Model(model).Scopes(scope).Where("id IN ?", ids).Pluck("id", &owned).Error; err != nil {
+		return nil, fmt.Errorf("failed to check tenant ownership: %w", err)
+	}
+	return owned, nil
+}
+
+// owns reports whether the row of model with the given ID is visible to the
+// tenant of ctx, returning ErrNotFound when it is not
+func owns(ctx context.Context, db *gorm.DB, model interface{}, scope func(*gorm.DB) *gorm.DB, id uint) error {
+	owned, err := ownedIDs(ctx, db, model, scope, []uint{id})
+	if err != nil {
+		return err
+	}
+	if len(owned) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
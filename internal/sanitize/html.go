@@ -0,0 +1,338 @@
+// Package sanitize turns untrusted email HTML into markup that is safe to render.
+package sanitize
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RemotePolicy controls what happens to images and backgrounds loaded from remote servers
+type RemotePolicy string
+
+const (
+	// RemoteBlock removes remote image URLs so nothing is fetched when the message is opened
+	RemoteBlock RemotePolicy = "block"
+	// RemoteProxy rewrites remote image URLs through Options.ProxyURL
+	RemoteProxy RemotePolicy = "proxy"
+	// RemoteAllow keeps remote image URLs unchanged
+	RemoteAllow RemotePolicy = "allow"
+)
+
+// ParseRemotePolicy parses a remote query value; empty means RemoteBlock
+func ParseRemotePolicy(v string) (RemotePolicy, error) {
+	switch RemotePolicy(strings.ToLower(v)) {
+	case "", RemoteBlock:
+		return RemoteBlock, nil
+	case RemoteProxy:
+		return RemoteProxy, nil
+	case RemoteAllow:
+		return RemoteAllow, nil
+	default:
+		return "", fmt.Errorf("unknown remote content policy %q", v)
+	}
+}
+
+// Options configures Sanitize
+type Options struct {
+	Remote RemotePolicy
+	// ProxyURL returns the URL that serves a remote image; required for RemoteProxy
+	ProxyURL func(remoteURL string) string
+	// ContentURL resolves the Content-ID of a cid: URL to the URL serving that
+	// message part. When set, cid: URLs it cannot resolve are removed; when nil
+	// they are kept unchanged.
+	ContentURL func(contentID string) (string, bool)
+}
+
+// Result is sanitized HTML with statistics about the remote content it referenced
+type Result struct {
+	HTML string
+	// RemoteImages counts remote image URLs that were blocked, proxied or allowed
+	RemoteImages int
+	// TrackersRemoved counts invisible remote images that were dropped entirely
+	TrackersRemoved int
+}
+
+// droppedElements are removed together with their content
+var droppedElements = map[string]bool{
+	"script": true, "noscript": true, "template": true,
+	"iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "param": true,
+	"svg": true, "math": true,
+	"input": true, "button": true, "select": true, "option": true, "optgroup": true,
+	"textarea": true, "datalist": true, "output": true,
+	"meta": true, "link": true, "base": true, "title": true,
+	"audio": true, "video": true, "source": true, "track": true, "canvas": true,
+}
+
+// allowedElements are kept; any other element is replaced by its content
+var allowedElements = map[string]bool{
+	"html": true, "head": true, "body": true, "style": true,
+	"div": true, "span": true, "p": true, "br": true, "hr": true, "wbr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"a": true, "img": true,
+	"table": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+	"caption": true, "colgroup": true, "col": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "s": true, "strike": true,
+	"del": true, "ins": true, "sub": true, "sup": true, "small": true, "big": true, "mark": true,
+	"font": true, "center": true, "blockquote": true, "pre": true, "code": true, "tt": true,
+	"kbd": true, "samp": true, "var": true, "q": true, "cite": true, "abbr": true, "address": true,
+	"section": true, "article": true, "header": true, "footer": true, "nav": true, "main": true,
+	"aside": true, "figure": true, "figcaption": true, "time": true,
+}
+
+// allowedAttributes are kept on any allowed element; URL attributes are handled separately
+var allowedAttributes = map[string]bool{
+	"style": true, "class": true, "id": true, "dir": true, "lang": true, "title": true,
+	"align": true, "valign": true, "width": true, "height": true, "bgcolor": true, "color": true,
+	"border": true, "cellpadding": true, "cellspacing": true, "colspan": true, "rowspan": true,
+	"nowrap": true, "alt": true, "face": true, "size": true, "start": true, "type": true,
+	"summary": true, "headers": true, "scope": true, "span": true, "clear": true,
+	"hspace": true, "vspace": true, "name": true,
+}
+
+// linkSchemes are the URL schemes allowed in href attributes
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true, "tel": true}
+
+var (
+	dataImageRegex = regexp.MustCompile(`^(?i)data:image/(png|gif|jpeg|webp);`)
+	cssURLRegex    = regexp.MustCompile(`(?i)url\(\s*(['"]?)(.*?)(['"]?)\s*\)`)
+	cssUnsafeRegex = regexp.MustCompile(`(?i)(expression\s*\(|@import|behavior\s*:|-moz-binding|javascript:)`)
+	hiddenRegex    = regexp.MustCompile(`(?i)(display\s*:\s*none|visibility\s*:\s*hidden|opacity\s*:\s*0(\.0+)?\s*(;|$))`)
+)
+
+// Sanitize parses untrusted HTML and returns a safe rendering of it.
+// Scripts, event handlers, forms and embedded content are removed, links only
+// keep safe schemes and open in a new window without a referrer, and remote
+// images follow opts.Remote.
+func Sanitize(input string, opts Options) (*Result, error) {
+	if opts.Remote == "" {
+		opts.Remote = RemoteBlock
+	}
+	if opts.Remote == RemoteProxy && opts.ProxyURL == nil {
+		return nil, fmt.Errorf("remote policy proxy requires a proxy URL builder")
+	}
+
+	doc, err := html.Parse(strings.NewReader(input))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	s := &sanitizer{opts: opts, result: &Result{}}
+	s.walk(doc)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, fmt.Errorf("failed to render HTML: %w", err)
+	}
+	s.result.HTML = buf.String()
+	return s.result, nil
+}
+
+// sanitizer holds the state of one Sanitize call
+type sanitizer struct {
+	opts   Options
+	result *Result
+}
+
+// walk sanitizes the children of n in place
+func (s *sanitizer) walk(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch c.Type {
+		case html.CommentNode, html.DoctypeNode:
+			// Comments may carry conditional markup for old Outlook versions
+			n.RemoveChild(c)
+		case html.ElementNode:
+			name := strings.ToLower(c.Data)
+			switch {
+			case droppedElements[name] || c.Namespace != "":
+				n.RemoveChild(c)
+			case !allowedElements[name]:
+				// Keep the content of unknown elements such as <form> or <o:p>
+				if c.FirstChild != nil {
+					next = c.FirstChild
+				}
+				for c.FirstChild != nil {
+					child := c.FirstChild
+					c.RemoveChild(child)
+					n.InsertBefore(child, c)
+				}
+				n.RemoveChild(c)
+			case name == "img" && s.isTracker(c):
+				s.result.TrackersRemoved++
+				n.RemoveChild(c)
+			default:
+				s.sanitizeElement(c, name)
+				s.walk(c)
+			}
+		}
+
+		c = next
+	}
+}
+
+// sanitizeElement filters the attributes of an allowed element
+func (s *sanitizer) sanitizeElement(n *html.Node, name string) {
+	attrs := make([]html.Attribute, 0, len(n.Attr))
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			continue
+		}
+
+		switch {
+		case key == "href" && name == "a":
+			if href, ok := cleanLink(attr.Val); ok {
+				attrs = append(attrs, html.Attribute{Key: key, Val: href})
+			}
+		case key == "src" && name == "img", key == "background":
+			if src, ok := s.imageURL(attr.Val); ok {
+				attrs = append(attrs, html.Attribute{Key: key, Val: src})
+			}
+		case key == "style":
+			if style := s.sanitizeCSS(attr.Val); style != "" {
+				attrs = append(attrs, html.Attribute{Key: key, Val: style})
+			}
+		case allowedAttributes[key]:
+			attrs = append(attrs, html.Attribute{Key: key, Val: attr.Val})
+		}
+	}
+
+	if name == "a" {
+		attrs = append(attrs,
+			html.Attribute{Key: "target", Val: "_blank"},
+			html.Attribute{Key: "rel", Val: "noopener noreferrer nofollow"})
+	}
+	n.Attr = attrs
+
+	if name == "style" {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				c.Data = s.sanitizeCSS(c.Data)
+			}
+		}
+	}
+}
+
+// isTracker reports whether an image is an invisible remote image, typically a tracking pixel
+func (s *sanitizer) isTracker(n *html.Node) bool {
+	if s.opts.Remote == RemoteAllow {
+		return false
+	}
+
+	var src, width, height, style string
+	for _, attr := range n.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "src":
+			src = attr.Val
+		case "width":
+			width = attr.Val
+		case "height":
+			height = attr.Val
+		case "style":
+			style = attr.Val
+		}
+	}
+	if !isRemoteURL(normalizeURL(src)) {
+		return false
+	}
+	return (isTinyDimension(width) && isTinyDimension(height)) || hiddenRegex.MatchString(style)
+}
+
+// imageURL applies the remote policy to an image URL; ok is false when it must be removed
+func (s *sanitizer) imageURL(raw string) (string, bool) {
+	u := normalizeURL(raw)
+	switch {
+	case dataImageRegex.MatchString(u):
+		return u, true
+	case strings.HasPrefix(strings.ToLower(u), "cid:"):
+		if s.opts.ContentURL == nil {
+			return u, true
+		}
+		return s.opts.ContentURL(contentID(u))
+	case isRemoteURL(u):
+		s.result.RemoteImages++
+		if strings.HasPrefix(u, "//") {
+			u = "https:" + u
+		}
+		switch s.opts.Remote {
+		case RemoteAllow:
+			return u, true
+		case RemoteProxy:
+			return s.opts.ProxyURL(u), true
+		}
+	}
+	return "", false
+}
+
+// sanitizeCSS removes active CSS constructs and applies the remote policy to url() values
+func (s *sanitizer) sanitizeCSS(css string) string {
+	// CSS escapes could spell out blocked keywords, and are rare in real mail
+	css = strings.ReplaceAll(css, `\`, "")
+	css = cssUnsafeRegex.ReplaceAllString(css, "")
+	return cssURLRegex.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssURLRegex.FindStringSubmatch(match)
+		u, ok := s.imageURL(parts[2])
+		if !ok {
+			return "none"
+		}
+		return `url("` + strings.ReplaceAll(u, `"`, "%22") + `")`
+	})
+}
+
+// cleanLink returns a link target with a safe scheme, or ok=false
+func cleanLink(raw string) (string, bool) {
+	u := normalizeURL(raw)
+	if strings.HasPrefix(u, "#") {
+		return u, true
+	}
+	if strings.HasPrefix(u, "//") {
+		return "https:" + u, true
+	}
+	scheme, _, found := strings.Cut(u, ":")
+	if !found || !linkSchemes[strings.ToLower(scheme)] {
+		return "", false
+	}
+	return u, true
+}
+
+// normalizeURL strips whitespace and control characters, which browsers ignore
+// inside URLs and which would otherwise hide schemes like "java\tscript:"
+func normalizeURL(raw string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+}
+
+// contentID extracts the Content-ID from a cid: URL (RFC 2392), which is URL-encoded
+// and sometimes wrongly kept in angle brackets
+func contentID(cidURL string) string {
+	id := cidURL[len("cid:"):]
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+}
+
+// isRemoteURL reports whether u is fetched over the network
+func isRemoteURL(u string) bool {
+	lower := strings.ToLower(u)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "//")
+}
+
+// isTinyDimension reports whether a width or height attribute is at most 2 pixels
+func isTinyDimension(v string) bool {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(v), "px"))
+	return err == nil && n <= 2
+}
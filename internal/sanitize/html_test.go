@@ -0,0 +1,157 @@
+package sanitize
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sanitize(t *testing.T, input string, opts Options) *Result {
+	t.Helper()
+	result, err := Sanitize(input, opts)
+	require.NoError(t, err)
+	return result
+}
+
+func TestParseRemotePolicy(t *testing.T) {
+	policy, err := ParseRemotePolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteBlock, policy)
+
+	policy, err = ParseRemotePolicy("Proxy")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteProxy, policy)
+
+	_, err = ParseRemotePolicy("always")
+	assert.Error(t, err)
+}
+
+func TestSanitize_RemovesActiveContent(t *testing.T) {
+	input := `<div onclick="steal()" style="color:red">Hello
+		<script>alert(1)</script>
+		<iframe src="https://evil.example"></iframe>
+		<form action="https://evil.example"><input name="password"><button>Go</button>Keep me</form>
+		<svg><script>alert(2)</script></svg>
+		<!-- comment -->
+	</div>`
+
+	result := sanitize(t, input, Options{})
+
+	assert.Contains(t, result.HTML, `style="color:red"`)
+	assert.Contains(t, result.HTML, "Hello")
+	assert.Contains(t, result.HTML, "Keep me")
+	for _, unsafe := range []string{"onclick", "<script", "alert", "<iframe", "<form", "<input", "<button", "<svg", "comment"} {
+		assert.NotContains(t, result.HTML, unsafe)
+	}
+}
+
+func TestSanitize_Links(t *testing.T) {
+	input := `<a href="https://example.com/a">ok</a>
+		<a href="java&#x09;script:alert(1)">bad</a>
+		<a href="data:text/html,hi">data</a>
+		<a href="mailto:a@example.com">mail</a>
+		<a href="#top">anchor</a>`
+
+	result := sanitize(t, input, Options{})
+
+	assert.Contains(t, result.HTML, `<a href="https://example.com/a" target="_blank" rel="noopener noreferrer nofollow">ok</a>`)
+	assert.Contains(t, result.HTML, `<a target="_blank" rel="noopener noreferrer nofollow">bad</a>`)
+	assert.Contains(t, result.HTML, `<a target="_blank" rel="noopener noreferrer nofollow">data</a>`)
+	assert.Contains(t, result.HTML, `href="mailto:a@example.com"`)
+	assert.Contains(t, result.HTML, `href="#top"`)
+	assert.NotContains(t, strings.ToLower(result.HTML), "script")
+}
+
+func TestSanitize_BlocksRemoteImagesByDefault(t *testing.T) {
+	input := `<img src="https://cdn.example.com/logo.png" alt="logo">
+		<img src="data:image/png;base64,iVBORw0KGgo=">
+		<img src="cid:logo@example.com">
+		<td background="http://cdn.example.com/bg.png"></td>`
+
+	result := sanitize(t, `<table><tr>`+input+`</tr></table>`, Options{Remote: RemoteBlock})
+
+	assert.NotContains(t, result.HTML, "cdn.example.com")
+	assert.Contains(t, result.HTML, `alt="logo"`)
+	assert.Contains(t, result.HTML, "data:image/png;base64")
+	assert.Contains(t, result.HTML, "cid:logo@example.com")
+	assert.Equal(t, 2, result.RemoteImages)
+}
+
+func TestSanitize_ProxiesRemoteImages(t *testing.T) {
+	proxyURL := func(remote string) string {
+		return "/proxy/image?url=" + url.QueryEscape(remote)
+	}
+	input := `<img src="//cdn.example.com/logo.png"><div style="background:url('https://cdn.example.com/bg.png')"></div>`
+
+	result := sanitize(t, input, Options{Remote: RemoteProxy, ProxyURL: proxyURL})
+
+	assert.Contains(t, result.HTML, `src="/proxy/image?url=https%3A%2F%2Fcdn.example.com%2Flogo.png"`)
+	assert.Contains(t, result.HTML, `url(&#34;/proxy/image?url=https%3A%2F%2Fcdn.example.com%2Fbg.png&#34;)`)
+	assert.Equal(t, 2, result.RemoteImages)
+}
+
+func TestSanitize_ProxyRequiresURLBuilder(t *testing.T) {
+	_, err := Sanitize("<p>hi</p>", Options{Remote: RemoteProxy})
+	assert.Error(t, err)
+}
+
+func TestSanitize_AllowKeepsRemoteImages(t *testing.T) {
+	input := `<img src="https://cdn.example.com/logo.png"><img src="https://t.example.com/open.gif" width="1" height="1">`
+
+	result := sanitize(t, input, Options{Remote: RemoteAllow})
+
+	assert.Contains(t, result.HTML, `src="https://cdn.example.com/logo.png"`)
+	assert.Contains(t, result.HTML, `src="https://t.example.com/open.gif"`)
+	assert.Equal(t, 0, result.TrackersRemoved)
+}
+
+func TestSanitize_RemovesTrackingPixels(t *testing.T) {
+	input := `<img src="https://t.example.com/open.gif" width="1" height="1">
+		<img src="https://t.example.com/hidden.gif" style="display: none">
+		<img src="https://cdn.example.com/logo.png" width="120" height="40">`
+
+	for _, policy := range []RemotePolicy{RemoteBlock, RemoteProxy} {
+		result := sanitize(t, input, Options{Remote: policy, ProxyURL: func(u string) string { return "/p?u=" + u }})
+
+		assert.NotContains(t, result.HTML, "t.example.com", policy)
+		assert.Equal(t, 2, result.TrackersRemoved, policy)
+		assert.Equal(t, 1, result.RemoteImages, policy)
+	}
+}
+
+func TestSanitize_CSS(t *testing.T) {
+	input := `<style>@import url(https://evil.example/x.css); p { color: red; width: expression(alert(1)); }</style>
+		<p style="background-image: url(javascript:alert(1)); behavior: url(x.htc)">text</p>
+		<p style="color: \65 xpression(alert(1))">escaped</p>`
+
+	result := sanitize(t, input, Options{})
+
+	assert.Contains(t, result.HTML, "color: red")
+	assert.NotContains(t, result.HTML, "@import")
+	assert.NotContains(t, result.HTML, "evil.example")
+	assert.NotContains(t, result.HTML, "expression(")
+	assert.NotContains(t, result.HTML, "javascript")
+	assert.NotContains(t, result.HTML, "behavior")
+	assert.NotContains(t, result.HTML, `\`)
+}
+
+func TestSanitize_ResolvesContentIDs(t *testing.T) {
+	contentURL := func(id string) (string, bool) {
+		if id == "logo@example.com" {
+			return "/api/attachments/7/download?inline=1", true
+		}
+		return "", false
+	}
+	input := `<img src="cid:logo%40example.com"><img src="cid:<logo@example.com>"><img src="cid:unknown" alt="x">` +
+		`<div style="background: url(cid:logo@example.com)"></div>`
+
+	result := sanitize(t, input, Options{ContentURL: contentURL})
+
+	assert.Equal(t, 3, strings.Count(result.HTML, "/api/attachments/7/download?inline=1"))
+	assert.NotContains(t, result.HTML, "cid:")
+	assert.Contains(t, result.HTML, `<img alt="x"/>`)
+	assert.Equal(t, 0, result.RemoteImages)
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// MarkOpen and MarkClose surround matched words in highlighted text
+const (
+	MarkOpen  = "<mark>"
+	MarkClose = "</mark>"
+)
+
+// Highlight returns HTML-escaped text with every word starting with one of
+// words wrapped in <mark>. When text is longer than maxRunes, the excerpt
+// around the first match is returned with an ellipsis at cut ends; 0 keeps it whole.
+func Highlight(text string, words []string, maxRunes int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+
+	start, end := 0, len(runes)
+	if maxRunes > 0 && len(runes) > maxRunes {
+		first := firstMatch(runes, words)
+		start = first - maxRunes/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + maxRunes
+		if end > len(runes) {
+			end = len(runes)
+			start = end - maxRunes
+		}
+		// Do not cut words in half
+		for start > 0 && start < end && !unicode.IsSpace(runes[start-1]) {
+			start++
+		}
+		for end < len(runes) && end > start && !unicode.IsSpace(runes[end]) {
+			end--
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("… ")
+	}
+	b.WriteString(mark(runes[start:end], words))
+	if end < len(runes) {
+		b.WriteString(" …")
+	}
+	return b.String()
+}
+
+// mark escapes runes and wraps matching words
+func mark(runes []rune, words []string) string {
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			j := i
+			for j < len(runes) && !isWordRune(runes[j]) {
+				j++
+			}
+			b.WriteString(html.EscapeString(string(runes[i:j])))
+			i = j
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if matchesAny(word, words) {
+			b.WriteString(MarkOpen + html.EscapeString(word) + MarkClose)
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// firstMatch returns the rune index of the first matching word, or 0
+func firstMatch(runes []rune, words []string) int {
+	for i := 0; i < len(runes); i++ {
+		if !isWordRune(runes[i]) || (i > 0 && isWordRune(runes[i-1])) {
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		if matchesAny(string(runes[i:j]), words) {
+			return i
+		}
+	}
+	return 0
+}
+
+// matchesAny reports whether word starts with one of the lowercase query words
+func matchesAny(word string, words []string) bool {
+	lower := strings.ToLower(word)
+	for _, w := range words {
+		if w != "" && strings.HasPrefix(lower, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// PlainText extracts the visible text of an HTML document
+func PlainText(document string) string {
+	var b strings.Builder
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(document))
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case nethtml.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case nethtml.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if tag := string(name); tag == "script" || tag == "style" || tag == "head" {
+				skip++
+			}
+			b.WriteByte(' ')
+		case nethtml.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if tag := string(name); (tag == "script" || tag == "style" || tag == "head") && skip > 0 {
+				skip--
+			}
+			b.WriteByte(' ')
+		case nethtml.TextToken:
+			if skip == 0 {
+				b.Write(tokenizer.Text())
+			}
+		}
+	}
+}
+
+// maxIndexRunes bounds the text indexed per field; a tsvector is limited to 1 MB
+const maxIndexRunes = 100000
+
+// IndexText prepares a field for the full-text index, collapsing whitespace
+// and truncating very long text
+func IndexText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= maxIndexRunes {
+		return s
+	}
+	return string([]rune(s)[:maxIndexRunes])
+}
@@ -0,0 +1,209 @@
+// Package search parses message search queries and renders highlighted snippets.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayout is the date-only form accepted by before: and after:
+const dateLayout = "2006-01-02"
+
+// ErrEmptyQuery is returned for a query without any term or operator
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// Query is a parsed search query. Terms and Phrases are matched against the
+// full-text index; the other fields are filters combined with AND.
+type Query struct {
+	// Terms are single words, matched as prefixes
+	Terms []string
+	// Phrases are quoted word sequences; each phrase is a list of words
+	Phrases [][]string
+	// From matches the sender address or name
+	From []string
+	// To matches the address of the receiving mailbox
+	To []string
+	// Subject matches the subject
+	Subject []string
+	// HasAttachment keeps only messages with non-inline attachments
+	HasAttachment bool
+	// Unread keeps only unread (true) or read (false) messages when set
+	Unread *bool
+	// Before keeps messages received before this time, zero means unbounded
+	Before time.Time
+	// After keeps messages received at or after this time, zero means unbounded
+	After time.Time
+}
+
+// HasText reports whether the query has full-text terms
+func (q *Query) HasText() bool {
+	return len(q.Terms) > 0 || len(q.Phrases) > 0
+}
+
+// Words returns every full-text word of the query, used for highlighting
+func (q *Query) Words() []string {
+	words := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		words = append(words, phrase...)
+	}
+	return words
+}
+
+// Parse parses a query such as
+//
+//	invoice from:alice subject:"march report" has:attachment is:unread after:2024-01-01
+//
+// Operators are from:, to:, subject:, has:attachment, is:unread, is:read,
+// before: and after:; dates are YYYY-MM-DD or RFC 3339. Unknown operators are
+// searched as plain text.
+func Parse(input string) (*Query, error) {
+	q := &Query{}
+	for _, token := range tokenize(input) {
+		key, value, isOperator := strings.Cut(token.text, ":")
+		if token.quoted || !isOperator || value == "" {
+			q.addText(token.text, token.quoted)
+			continue
+		}
+		if value[0] == '"' {
+			value = strings.Trim(value, `"`)
+		}
+
+		switch strings.ToLower(key) {
+		case "from":
+			q.From = append(q.From, value)
+		case "to":
+			q.To = append(q.To, value)
+		case "subject":
+			q.Subject = append(q.Subject, value)
+		case "has":
+			if !strings.EqualFold(value, "attachment") {
+				return nil, fmt.Errorf("unknown has: value %q", value)
+			}
+			q.HasAttachment = true
+		case "is":
+			var unread bool
+			switch strings.ToLower(value) {
+			case "unread":
+				unread = true
+			case "read":
+				unread = false
+			default:
+				return nil, fmt.Errorf("unknown is: value %q", value)
+			}
+			q.Unread = &unread
+		case "before", "after":
+			t, err := parseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: must be a YYYY-MM-DD date or an RFC 3339 timestamp", key)
+			}
+			if strings.EqualFold(key, "before") {
+				q.Before = t
+			} else {
+				q.After = t
+			}
+		default:
+			q.addText(token.text, false)
+		}
+	}
+
+	if q.isEmpty() {
+		return nil, ErrEmptyQuery
+	}
+	return q, nil
+}
+
+// addText adds free text as terms, or as a phrase when it was quoted
+func (q *Query) addText(text string, quoted bool) {
+	words := Words(text)
+	switch {
+	case len(words) == 0:
+	case quoted && len(words) > 1:
+		q.Phrases = append(q.Phrases, words)
+	default:
+		q.Terms = append(q.Terms, words...)
+	}
+}
+
+// isEmpty reports whether the query would match everything
+func (q *Query) isEmpty() bool {
+	return !q.HasText() && len(q.From) == 0 && len(q.To) == 0 && len(q.Subject) == 0 &&
+		!q.HasAttachment && q.Unread == nil && q.Before.IsZero() && q.After.IsZero()
+}
+
+// TSQuery renders the full-text part of the query for PostgreSQL to_tsquery.
+// Terms match as prefixes, phrases as adjacent words; all parts are required.
+func (q *Query) TSQuery() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Phrases))
+	for _, term := range q.Terms {
+		parts = append(parts, term+":*")
+	}
+	for _, phrase := range q.Phrases {
+		parts = append(parts, "("+strings.Join(phrase, " <-> ")+")")
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Words splits text into lowercase words of letters and digits; everything
+// else separates words, so the result is safe to use in a tsquery
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// token is one whitespace-separated part of a query
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits a query on whitespace, keeping "quoted text" and
+// operator:"quoted value" together
+func tokenize(input string) []token {
+	var tokens []token
+	var current strings.Builder
+	inQuotes, quoted := false, false
+
+	flush := func() {
+		if current.Len() > 0 || quoted {
+			tokens = append(tokens, token{text: current.String(), quoted: quoted})
+		}
+		current.Reset()
+		quoted = false
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"' && current.Len() == 0 && !inQuotes:
+			inQuotes, quoted = true, true
+		case r == '"' && inQuotes:
+			inQuotes = false
+			if quoted {
+				flush()
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' && !inQuotes:
+			// Opening quote of an operator value such as subject:"a b"
+			inQuotes = true
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parseDate parses a date or an RFC 3339 timestamp
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateLayout, v)
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Operators(t *testing.T) {
+	q, err := Parse(`Invoice from:alice@example.com to:ops subject:"march report" has:attachment is:unread after:2024-01-01 before:2024-02-01T00:00:00Z`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"invoice"}, q.Terms)
+	assert.Equal(t, []string{"alice@example.com"}, q.From)
+	assert.Equal(t, []string{"ops"}, q.To)
+	assert.Equal(t, []string{"march report"}, q.Subject)
+	assert.True(t, q.HasAttachment)
+	require.NotNil(t, q.Unread)
+	assert.True(t, *q.Unread)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), q.After)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), q.Before)
+}
+
+func TestParse_PhrasesAndTerms(t *testing.T) {
+	q, err := Parse(`"reset your password" token's unknown:op`)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{{"reset", "your", "password"}}, q.Phrases)
+	assert.Equal(t, []string{"token", "s", "unknown", "op"}, q.Terms)
+	assert.Equal(t, "token:* & s:* & unknown:* & op:* & (reset <-> your <-> password)", q.TSQuery())
+}
+
+func TestParse_TSQueryIsSafe(t *testing.T) {
+	q, err := Parse(`a&b | !c ('d':*)`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "a:* & b:* & c:* & d:*", q.TSQuery())
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, input := range []string{"", "   ", "has:pictures", "is:starred", "before:yesterday", `""`} {
+		_, err := Parse(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParse_OperatorsOnly(t *testing.T) {
+	q, err := Parse("is:read")
+	require.NoError(t, err)
+
+	assert.False(t, q.HasText())
+	require.NotNil(t, q.Unread)
+	assert.False(t, *q.Unread)
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "Your <mark>Invoice</mark> &lt;#42&gt; is <mark>ready</mark>",
+		Highlight("Your Invoice <#42>   is ready", []string{"invoice", "ready"}, 0))
+	assert.Equal(t, "no match", Highlight("no match", []string{"invoice"}, 0))
+}
+
+func TestHighlight_ExcerptAroundMatch(t *testing.T) {
+	text := "one two three four five six seven eight nine ten eleven twelve target thirteen fourteen fifteen"
+
+	got := Highlight(text, []string{"target"}, 30)
+
+	assert.Contains(t, got, "<mark>target</mark>")
+	assert.True(t, len([]rune(got)) < len(text))
+	assert.Regexp(t, `^… `, got)
+	assert.Regexp(t, ` …$`, got)
+}
+
+func TestPlainText(t *testing.T) {
+	doc := `<html><head><title>T</title><style>p{}</style></head><body><p>Hello&nbsp;<b>world</b></p><script>x()</script></body></html>`
+
+	assert.Equal(t, "Hello world", PlainText(doc))
+}
+
+func TestIndexText(t *testing.T) {
+	assert.Equal(t, "a b", IndexText("  a \n\t b "))
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// APIKeyPrefix starts every API key stored in the database, telling them apart
+// from the API_KEY of the configuration
+const APIKeyPrefix = "imk_"
+
+// ErrInvalidAPIKey is returned for API keys that were never issued or were revoked
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyService issues, verifies and revokes API keys of tenants and super-admins
+type APIKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+// NewAPIKeyService creates a new APIKeyService
+func NewAPIKeyService(repo repository.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+// IsAPIKey reports whether a bearer credential is an API key of the database
+func IsAPIKey(value string) bool {
+	return strings.HasPrefix(value, APIKeyPrefix)
+}
+
+// Issue creates a key for a tenant, or a super-admin key when tenantID is nil.
+// The key is only returned here; the record keeps its hash.
+func (s *APIKeyService) Issue(ctx context.Context, tenantID *uint, name string) (string, *models.APIKey, error) {
+	value, err := newSecret(APIKeyPrefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	record := &models.APIKey{
+		TenantID: tenantID,
+		Role:     models.RoleTenant,
+		Name:     name,
+		KeyHash:  hashSecret(value),
+	}
+	if tenantID == nil {
+		record.Role = models.RoleSuperAdmin
+	}
+	if err := s.repo.Create(ctx, record); err != nil {
+		return "", nil, err
+	}
+	return value, record, nil
+}
+
+// Verify returns the record of a valid key
+func (s *APIKeyService) Verify(ctx context.Context, value string) (*models.APIKey, error) {
+	if !IsAPIKey(value) {
+		return nil, ErrInvalidAPIKey
+	}
+	record, err := s.repo.GetByHash(ctx, hashSecret(value))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// List returns the keys of a tenant, or the super-admin keys when tenantID is nil
+func (s *APIKeyService) List(ctx context.Context, tenantID *uint) ([]models.APIKey, error) {
+	return s.repo.ListByTenant(ctx, tenantID)
+}
+
+// Revoke deletes a key of a tenant, or a super-admin key when tenantID is nil;
+// it stops working immediately
+func (s *APIKeyService) Revoke(ctx context.Context, tenantID *uint, id uint) error {
+	return s.repo.Delete(ctx, tenantID, id)
+}
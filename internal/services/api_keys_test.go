@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+func TestAPIKeyService_IssueAndVerify(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service := NewAPIKeyService(repository.NewAPIKeyRepository(f.db))
+	tenant := &models.Tenant{Name: "team"}
+	if err := f.db.Create(tenant).Error; err != nil {
+		t.Fatalf("failed to create tenant: %v", err)
+	}
+	ctx := context.Background()
+
+	key, record, err := service.Issue(ctx, &tenant.ID, "ci")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		t.Errorf("expected key to start with %q, got %q", APIKeyPrefix, key)
+	}
+	if record.Role != models.RoleTenant {
+		t.Errorf("expected role %q, got %q", models.RoleTenant, record.Role)
+	}
+	if record.KeyHash == "" || strings.Contains(record.KeyHash, key) {
+		t.Errorf("expected only the hash of the key to be stored")
+	}
+
+	verified, err := service.Verify(ctx, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verified.TenantID == nil || *verified.TenantID != tenant.ID {
+		t.Errorf("expected key of tenant %d, got %v", tenant.ID, verified.TenantID)
+	}
+
+	_, admin, err := service.Issue(ctx, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if admin.Role != models.RoleSuperAdmin || admin.TenantID != nil {
+		t.Errorf("expected a super-admin key without tenant, got %q %v", admin.Role, admin.TenantID)
+	}
+
+	if _, err := service.Verify(ctx, key+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for an unknown key, got %v", err)
+	}
+	if _, err := service.Verify(ctx, MailboxTokenPrefix+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey without the prefix, got %v", err)
+	}
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service := NewAPIKeyService(repository.NewAPIKeyRepository(f.db))
+	ctx := context.Background()
+
+	key, record, err := service.Issue(ctx, nil, "admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := uint(42)
+	if err := service.Revoke(ctx, &other, record.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when revoking through a tenant, got %v", err)
+	}
+	if err := service.Revoke(ctx, nil, record.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.Verify(ctx, key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected revoked key to be invalid, got %v", err)
+	}
+	keys, err := service.List(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no keys after revoking, got %d", len(keys))
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// BulkBatchSize is the number of messages updated per statement
+const BulkBatchSize = 500
+
+// MaxBulkIDs is the maximum number of explicit IDs accepted by one bulk request
+const MaxBulkIDs = 10000
+
+// BulkAction is an operation applied to many messages at once
+type BulkAction string
+
+const (
+	BulkMarkRead   BulkAction = "mark_read"
+	BulkMarkUnread BulkAction = "mark_unread"
+	BulkDelete     BulkAction = "delete"
+	BulkMove       BulkAction = "move"
+	BulkFlag       BulkAction = "flag"
+	BulkUnflag     BulkAction = "unflag"
+)
+
+var (
+	// ErrInvalidBulkAction is returned for an unknown action
+	ErrInvalidBulkAction = errors.New("invalid bulk action")
+	// ErrInvalidBulkSelection is returned when a request selects messages both or neither by IDs and filter
+	ErrInvalidBulkSelection = errors.New("select messages by ids or by filter")
+	// ErrTooManyBulkIDs is returned when a request lists more than MaxBulkIDs IDs
+	ErrTooManyBulkIDs = fmt.Errorf("at most %d ids are allowed", MaxBulkIDs)
+	// ErrMoveTargetRequired is returned for a move without a target mailbox
+	ErrMoveTargetRequired = errors.New("target mailbox is required to move messages")
+)
+
+// BulkRequest selects messages either by ID or by a search filter within a scope
+// and names the action to apply to them
+type BulkRequest struct {
+	Action BulkAction
+	IDs    []uint
+	// Filter selects every message matching the query within Scope; an empty
+	// query matches every message in scope
+	Filter *search.Query
+	Scope  repository.SearchScope
+	// TargetMailboxID is the destination of a move
+	TargetMailboxID uint
+}
+
+// BulkResult summarizes a bulk operation
+type BulkResult struct {
+	Action       BulkAction `json:"action"`
+	Matched      int64      `json:"matched"`
+	Affected     int64      `json:"affected"`
+	FilesDeleted int        `json:"files_deleted,omitempty"`
+	MailboxIDs   []uint     `json:"mailbox_ids"`
+}
+
+// BulkNotifier receives one summary per mailbox touched by a bulk operation
+type BulkNotifier interface {
+	BroadcastMessagesUpdated(mailboxID uint, payload *websocket.MessagesUpdatedPayload)
+}
+
+// BulkMessageService applies actions to many messages in batches
+type BulkMessageService struct {
+	messageRepo repository.MessageRepository
+	mailboxRepo repository.MailboxRepository
+	fileStorage storage.FileStorage
+	notifier    BulkNotifier
+	logger      *slog.Logger
+}
+
+// NewBulkMessageService creates a new BulkMessageService. fileStorage and
+// notifier may be nil.
+func NewBulkMessageService(
+	messageRepo repository.MessageRepository,
+	mailboxRepo repository.MailboxRepository,
+	fileStorage storage.FileStorage,
+	notifier BulkNotifier,
+	logger *slog.Logger,
+) *BulkMessageService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &BulkMessageService{
+		messageRepo: messageRepo,
+		mailboxRepo: mailboxRepo,
+		fileStorage: fileStorage,
+		notifier:    notifier,
+		logger:      logger,
+	}
+}
+
+// ParseBulkAction parses an action name
+func ParseBulkAction(v string) (BulkAction, error) {
+	switch action := BulkAction(v); action {
+	case BulkMarkRead, BulkMarkUnread, BulkDelete, BulkMove, BulkFlag, BulkUnflag:
+		return action, nil
+	default:
+		return "", ErrInvalidBulkAction
+	}
+}
+
+// Apply runs req in batches of BulkBatchSize and then sends one summary event
+// per affected mailbox. Batches already applied stay applied when a later one fails.
+func (s *BulkMessageService) Apply(ctx context.Context, req BulkRequest) (*BulkResult, error) {
+	if _, err := ParseBulkAction(string(req.Action)); err != nil {
+		return nil, err
+	}
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		return nil, ErrInvalidBulkSelection
+	}
+	if len(req.IDs) > MaxBulkIDs {
+		return nil, ErrTooManyBulkIDs
+	}
+	if req.Action == BulkMove {
+		if req.TargetMailboxID == 0 {
+			return nil, ErrMoveTargetRequired
+		}
+		if _, err := s.mailboxRepo.GetByID(ctx, req.TargetMailboxID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BulkResult{Action: req.Action}
+	perMailbox := make(map[uint]int64)
+
+	var err error
+	if req.Filter != nil {
+		err = s.applyFilter(ctx, req, result, perMailbox)
+	} else {
+		err = s.applyIDs(ctx, req, result, perMailbox)
+	}
+
+	s.notify(req, perMailbox)
+	if req.Action == BulkMove && len(perMailbox) > 0 {
+		perMailbox[req.TargetMailboxID] += 0
+	}
+	result.MailboxIDs = make([]uint, 0, len(perMailbox))
+	for mailboxID := range perMailbox {
+		result.MailboxIDs = append(result.MailboxIDs, mailboxID)
+	}
+	sort.Slice(result.MailboxIDs, func(i, j int) bool { return result.MailboxIDs[i] < result.MailboxIDs[j] })
+
+	return result, err
+}
+
+// applyIDs applies req to its explicit IDs
+func (s *BulkMessageService) applyIDs(ctx context.Context, req BulkRequest, result *BulkResult, perMailbox map[uint]int64) error {
+	for start := 0; start < len(req.IDs); start += BulkBatchSize {
+		end := start + BulkBatchSize
+		if end > len(req.IDs) {
+			end = len(req.IDs)
+		}
+		if err := s.applyBatch(ctx, req, req.IDs[start:end], result, perMailbox); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFilter walks the messages matching the filter in ID order and applies req to each batch
+func (s *BulkMessageService) applyFilter(ctx context.Context, req BulkRequest, result *BulkResult, perMailbox map[uint]int64) error {
+	var afterID uint
+	for {
+		ids, err := s.messageRepo.SearchIDs(ctx, req.Filter, req.Scope, afterID, BulkBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := s.applyBatch(ctx, req, ids, result, perMailbox); err != nil {
+			return err
+		}
+		if len(ids) < BulkBatchSize {
+			return nil
+		}
+		afterID = ids[len(ids)-1]
+	}
+}
+
+// applyBatch applies the action to one batch of message IDs
+func (s *BulkMessageService) applyBatch(ctx context.Context, req BulkRequest, ids []uint, result *BulkResult, perMailbox map[uint]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Resolve mailboxes first so unknown IDs are skipped and events can be grouped
+	mailboxes, err := s.messageRepo.MailboxIDsByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if len(mailboxes) == 0 {
+		return nil
+	}
+	existing := make([]uint, 0, len(mailboxes))
+	for _, id := range ids {
+		if _, ok := mailboxes[id]; ok {
+			existing = append(existing, id)
+		}
+	}
+	result.Matched += int64(len(existing))
+
+	var affected int64
+	switch req.Action {
+	case BulkMarkRead, BulkMarkUnread:
+		affected, err = s.messageRepo.SetReadByIDs(ctx, existing, req.Action == BulkMarkRead)
+	case BulkFlag, BulkUnflag:
+		affected, err = s.messageRepo.SetFlaggedByIDs(ctx, existing, req.Action == BulkFlag)
+	case BulkMove:
+		affected, err = s.messageRepo.MoveByIDs(ctx, existing, req.TargetMailboxID)
+	case BulkDelete:
+		var filePaths []string
+		filePaths, err = s.messageRepo.DeleteByIDs(ctx, existing)
+		if err == nil {
+			affected = int64(len(existing))
+			result.FilesDeleted += deleteStoredFiles(s.fileStorage, filePaths, s.logger)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	result.Affected += affected
+
+	for _, mailboxID := range mailboxes {
+		perMailbox[mailboxID]++
+	}
+	return nil
+}
+
+// notify sends one summary event to each mailbox touched by req. A move
+// notifies every source mailbox and then the target with the total moved in.
+func (s *BulkMessageService) notify(req BulkRequest, perMailbox map[uint]int64) {
+	if s.notifier == nil {
+		return
+	}
+
+	var moved int64
+	var sources []uint
+	for mailboxID, count := range perMailbox {
+		payload := &websocket.MessagesUpdatedPayload{Action: string(req.Action), Count: count}
+		if req.Action == BulkMove {
+			if mailboxID == req.TargetMailboxID {
+				// Already in the target
+				continue
+			}
+			payload.TargetMailboxID = req.TargetMailboxID
+			moved += count
+			sources = append(sources, mailboxID)
+		}
+		s.notifier.BroadcastMessagesUpdated(mailboxID, payload)
+	}
+
+	if moved > 0 {
+		payload := &websocket.MessagesUpdatedPayload{Action: string(req.Action), Count: moved}
+		if len(sources) == 1 {
+			payload.SourceMailboxID = sources[0]
+		}
+		s.notifier.BroadcastMessagesUpdated(req.TargetMailboxID, payload)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// recordingNotifier records bulk update events by mailbox
+type recordingNotifier struct {
+	events map[uint][]*websocket.MessagesUpdatedPayload
+}
+
+func (n *recordingNotifier) BroadcastMessagesUpdated(mailboxID uint, payload *websocket.MessagesUpdatedPayload) {
+	if n.events == nil {
+		n.events = make(map[uint][]*websocket.MessagesUpdatedPayload)
+	}
+	n.events[mailboxID] = append(n.events[mailboxID], payload)
+}
+
+// newBulkService builds a BulkMessageService over the database and storage of a retention fixture
+func newBulkService(f *retentionFixture) (*BulkMessageService, *recordingNotifier) {
+	notifier := &recordingNotifier{}
+	service := NewBulkMessageService(
+		repository.NewMessageRepository(f.db),
+		repository.NewMailboxRepository(f.db),
+		f.fileStorage,
+		notifier,
+		nil,
+	)
+	return service, notifier
+}
+
+func TestBulkMessageService_MarkReadByIDs(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service, notifier := newBulkService(f)
+	now := time.Now()
+	inbox := f.createMailbox(t, "inbox", now)
+	other := f.createMailbox(t, "other", now)
+	m1, _ := f.createMessage(t, inbox.ID, now, false)
+	m2, _ := f.createMessage(t, inbox.ID, now, false)
+	m3, _ := f.createMessage(t, other.ID, now, false)
+
+	result, err := service.Apply(context.Background(), BulkRequest{
+		Action: BulkMarkRead,
+		IDs:    []uint{m1.ID, m2.ID, m3.ID, 9999},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Matched != 3 || result.Affected != 3 {
+		t.Errorf("expected 3 matched and affected, got %d and %d", result.Matched, result.Affected)
+	}
+	var unread int64
+	f.db.Model(&models.Message{}).Where("is_read = ?", false).Count(&unread)
+	if unread != 0 {
+		t.Errorf("expected no unread messages, got %d", unread)
+	}
+	if len(notifier.events[inbox.ID]) != 1 || notifier.events[inbox.ID][0].Count != 2 {
+		t.Errorf("expected one event with count 2 for inbox, got %+v", notifier.events[inbox.ID])
+	}
+	if len(notifier.events[other.ID]) != 1 || notifier.events[other.ID][0].Count != 1 {
+		t.Errorf("expected one event with count 1 for other, got %+v", notifier.events[other.ID])
+	}
+}
+
+func TestBulkMessageService_DeleteByFilterRemovesFiles(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service, notifier := newBulkService(f)
+	now := time.Now()
+	inbox := f.createMailbox(t, "inbox", now)
+	other := f.createMailbox(t, "other", now)
+	_, path := f.createMessage(t, inbox.ID, now, true)
+	for i := 0; i < BulkBatchSize; i++ {
+		f.createMessage(t, inbox.ID, now, false)
+	}
+	_, otherPath := f.createMessage(t, other.ID, now, true)
+
+	result, err := service.Apply(context.Background(), BulkRequest{
+		Action: BulkDelete,
+		Filter: &search.Query{},
+		Scope:  repository.SearchScope{MailboxID: inbox.ID},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Affected != BulkBatchSize+1 {
+		t.Errorf("expected %d messages deleted, got %d", BulkBatchSize+1, result.Affected)
+	}
+	if result.FilesDeleted != 1 || f.fileExists(path) {
+		t.Errorf("expected the attachment file to be removed, files deleted %d", result.FilesDeleted)
+	}
+	if !f.fileExists(otherPath) {
+		t.Error("expected files of other mailboxes to be kept")
+	}
+	if n := f.count(&models.Message{}); n != 1 {
+		t.Errorf("expected 1 message left, got %d", n)
+	}
+	if len(notifier.events[inbox.ID]) != 1 || notifier.events[inbox.ID][0].Count != BulkBatchSize+1 {
+		t.Errorf("expected a single summary event for inbox, got %+v", notifier.events[inbox.ID])
+	}
+	if len(notifier.events[other.ID]) != 0 {
+		t.Errorf("expected no event for other mailbox, got %+v", notifier.events[other.ID])
+	}
+}
+
+func TestBulkMessageService_Move(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service, notifier := newBulkService(f)
+	now := time.Now()
+	inbox := f.createMailbox(t, "inbox", now)
+	archive := f.createMailbox(t, "archive", now)
+	m1, _ := f.createMessage(t, inbox.ID, now, false)
+	m2, _ := f.createMessage(t, inbox.ID, now, false)
+
+	result, err := service.Apply(context.Background(), BulkRequest{
+		Action:          BulkMove,
+		IDs:             []uint{m1.ID, m2.ID},
+		TargetMailboxID: archive.ID,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Affected != 2 {
+		t.Errorf("expected 2 messages moved, got %d", result.Affected)
+	}
+	if len(result.MailboxIDs) != 2 {
+		t.Errorf("expected source and target mailboxes in result, got %v", result.MailboxIDs)
+	}
+	var moved int64
+	f.db.Model(&models.Message{}).Where("mailbox_id = ?", archive.ID).Count(&moved)
+	if moved != 2 {
+		t.Errorf("expected 2 messages in archive, got %d", moved)
+	}
+	source := notifier.events[inbox.ID]
+	if len(source) != 1 || source[0].TargetMailboxID != archive.ID {
+		t.Errorf("expected a move event for inbox, got %+v", source)
+	}
+	target := notifier.events[archive.ID]
+	if len(target) != 1 || target[0].Count != 2 || target[0].SourceMailboxID != inbox.ID {
+		t.Errorf("expected a move event for archive, got %+v", target)
+	}
+}
+
+func TestBulkMessageService_Flag(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service, _ := newBulkService(f)
+	now := time.Now()
+	inbox := f.createMailbox(t, "inbox", now)
+	message, _ := f.createMessage(t, inbox.ID, now, false)
+
+	if _, err := service.Apply(context.Background(), BulkRequest{Action: BulkFlag, IDs: []uint{message.ID}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stored models.Message
+	f.db.First(&stored, message.ID)
+	if !stored.IsFlagged {
+		t.Error("expected message to be flagged")
+	}
+}
+
+func TestBulkMessageService_InvalidRequests(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service, _ := newBulkService(f)
+
+	tests := []struct {
+		name string
+		req  BulkRequest
+		want error
+	}{
+		{"unknown action", BulkRequest{Action: "archive", IDs: []uint{1}}, ErrInvalidBulkAction},
+		{"no selection", BulkRequest{Action: BulkDelete}, ErrInvalidBulkSelection},
+		{"both selections", BulkRequest{Action: BulkDelete, IDs: []uint{1}, Filter: &search.Query{}}, ErrInvalidBulkSelection},
+		{"too many ids", BulkRequest{Action: BulkDelete, IDs: make([]uint, MaxBulkIDs+1)}, ErrTooManyBulkIDs},
+		{"move without target", BulkRequest{Action: BulkMove, IDs: []uint{1}}, ErrMoveTargetRequired},
+		{"move to unknown mailbox", BulkRequest{Action: BulkMove, IDs: []uint{1}, TargetMailboxID: 404}, repository.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		if _, err := service.Apply(context.Background(), tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// KeyRotationReport summarizes a re-wrap of data keys under the primary master key
+type KeyRotationReport struct {
+	DryRun            bool     `json:"dry_run"`
+	PrimaryKeyID      string   `json:"primary_key_id"`
+	FileKeysScanned   int      `json:"file_keys_scanned"`
+	FileKeysRewrapped int      `json:"file_keys_rewrapped"`
+	BodiesScanned     int      `json:"bodies_scanned"`
+	BodiesRewrapped   int      `json:"bodies_rewrapped"`
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// RotateEncryptionKeys re-wraps every file data key and encrypted message body
+// that is not yet wrapped by the keyring's primary master key. Only the small
+// wrapped keys change: stored files and body ciphertexts are never rewritten.
+// Old master keys must stay in the keyring until a run reports no errors.
+func RotateEncryptionKeys(
+	ctx context.Context,
+	dataKeyRepo repository.DataKeyRepository,
+	messageRepo repository.MessageRepository,
+	keyring *encryption.Keyring,
+	dryRun bool,
+	logger *slog.Logger,
+) (*KeyRotationReport, error) {
+	report := &KeyRotationReport{DryRun: dryRun, PrimaryKeyID: keyring.PrimaryKeyID()}
+
+	if err := rotateFileKeys(ctx, dataKeyRepo, keyring, dryRun, logger, report); err != nil {
+		return nil, err
+	}
+	if err := rotateBodyKeys(ctx, messageRepo, keyring, dryRun, logger, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// rotateFileKeys re-wraps the data keys of encrypted attachment files
+func rotateFileKeys(
+	ctx context.Context,
+	dataKeyRepo repository.DataKeyRepository,
+	keyring *encryption.Keyring,
+	dryRun bool,
+	logger *slog.Logger,
+	report *KeyRotationReport,
+) error {
+	const batchSize = 500
+
+	var lastPath string
+	for {
+		dataKeys, err := dataKeyRepo.ListNotWrappedBy(ctx, keyring.PrimaryKeyID(), lastPath, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to scan data keys: %w", err)
+		}
+
+		for _, dataKey := range dataKeys {
+			lastPath = dataKey.FilePath
+			report.FileKeysScanned++
+
+			err := rewrapFileKey(ctx, dataKeyRepo, keyring, dataKey, dryRun)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("file %s: %v", dataKey.FilePath, err))
+				logger.Error("failed to re-wrap file data key",
+					slog.String("path", dataKey.FilePath),
+					slog.String("master_key_id", dataKey.MasterKeyID),
+					slog.Any("error", err))
+				continue
+			}
+			report.FileKeysRewrapped++
+		}
+
+		if len(dataKeys) < batchSize {
+			return nil
+		}
+	}
+}
+
+// rewrapFileKey re-wraps one file data key
+func rewrapFileKey(
+	ctx context.Context,
+	dataKeyRepo repository.DataKeyRepository,
+	keyring *encryption.Keyring,
+	dataKey models.DataKey,
+	dryRun bool,
+) error {
+	keyID, wrapped, _, err := keyring.RewrapKey(dataKey.MasterKeyID, dataKey.WrappedKey, []byte(dataKey.FilePath))
+	if err != nil || dryRun {
+		return err
+	}
+	return dataKeyRepo.UpdateWrappedKey(ctx, dataKey.FilePath, keyID, wrapped)
+}
+
+// rotateBodyKeys re-wraps the data keys embedded in encrypted message body columns
+func rotateBodyKeys(
+	ctx context.Context,
+	messageRepo repository.MessageRepository,
+	keyring *encryption.Keyring,
+	dryRun bool,
+	logger *slog.Logger,
+	report *KeyRotationReport,
+) error {
+	const batchSize = 500
+	table := models.Message{}.TableName()
+
+	var lastID uint
+	for {
+		bodies, err := messageRepo.ListEncryptedBodiesAfterID(ctx, lastID, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to scan message bodies: %w", err)
+		}
+
+		for _, body := range bodies {
+			lastID = body.ID
+			report.BodiesScanned++
+
+			changed, err := rewrapBody(keyring, &body, table)
+			if err == nil && changed && !dryRun {
+				err = messageRepo.UpdateStoredBody(ctx, body)
+			}
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("message %d: %v", body.ID, err))
+				logger.Error("failed to re-wrap message body key",
+					slog.Uint64("message_id", uint64(body.ID)),
+					slog.Any("error", err))
+				continue
+			}
+			if changed {
+				report.BodiesRewrapped++
+			}
+		}
+
+		if len(bodies) < batchSize {
+			return nil
+		}
+	}
+}
+
+// rewrapBody re-wraps both body columns of a message in place
+func rewrapBody(keyring *encryption.Keyring, body *models.StoredMessageBody, table string) (bool, error) {
+	id := uint64(body.ID)
+	bodyText, textChanged, err := keyring.RewrapString(body.BodyText, encryption.ColumnAAD(table, "body_text", id))
+	if err != nil {
+		return false, err
+	}
+	bodyHTML, htmlChanged, err := keyring.RewrapString(body.BodyHTML, encryption.ColumnAAD(table, "body_html", id))
+	if err != nil {
+		return false, err
+	}
+	body.BodyText, body.BodyHTML = bodyText, bodyHTML
+	return textChanged || htmlChanged, nil
+}
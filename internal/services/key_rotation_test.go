@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+func newTestKeyring(t *testing.T, seeds ...byte) *encryption.Keyring {
+	t.Helper()
+	var masterKeys [][]byte
+	for _, seed := range seeds {
+		masterKeys = append(masterKeys, bytes.Repeat([]byte{seed}, encryption.KeySize))
+	}
+	keyring, err := encryption.NewKeyring(masterKeys...)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+func TestRotateEncryptionKeys(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	if err := f.db.AutoMigrate(&models.DataKey{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	defer encryption.ConfigureColumns(nil, false)
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dataKeyRepo := repository.NewDataKeyRepository(f.db)
+	messageRepo := repository.NewMessageRepository(f.db)
+
+	// Write a file and a message body under the old master key
+	oldKeyring := newTestKeyring(t, 1)
+	encryption.ConfigureColumns(oldKeyring, true)
+	path, err := storage.NewEncryptedStorage(f.fileStorage, oldKeyring, dataKeyRepo).Save("doc.pdf", strings.NewReader("secret file"))
+	if err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	ciphertextBefore, err := os.ReadFile(filepath.Join(f.storageDir, path))
+	if err != nil {
+		t.Fatalf("failed to read stored file: %v", err)
+	}
+	mailbox := f.createMailbox(t, "user", f.domain.CreatedAt)
+	message := &models.Message{MailboxID: mailbox.ID, SenderEmail: "a@example.com", BodyText: "secret body"}
+	if err := messageRepo.Create(ctx, message); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+
+	rotated := newTestKeyring(t, 2, 1)
+
+	report, err := RotateEncryptionKeys(ctx, dataKeyRepo, messageRepo, rotated, true, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.FileKeysRewrapped != 1 || report.BodiesRewrapped != 1 {
+		t.Errorf("unexpected dry run report: %+v", report)
+	}
+	if keyID, _, _ := dataKeyRepo.GetDataKey(ctx, path); keyID != oldKeyring.PrimaryKeyID() {
+		t.Error("expected dry run to keep the old wrapped key")
+	}
+
+	report, err = RotateEncryptionKeys(ctx, dataKeyRepo, messageRepo, rotated, false, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.FileKeysRewrapped != 1 || report.BodiesRewrapped != 1 || len(report.Errors) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	// Only the new master key is needed from now on, and the file was not rewritten
+	newOnly := newTestKeyring(t, 2)
+	encryption.ConfigureColumns(newOnly, true)
+
+	ciphertextAfter, err := os.ReadFile(filepath.Join(f.storageDir, path))
+	if err != nil || !bytes.Equal(ciphertextBefore, ciphertextAfter) {
+		t.Error("expected stored file to be unchanged by rotation")
+	}
+	reader, err := storage.NewEncryptedStorage(f.fileStorage, newOnly, dataKeyRepo).Get(path)
+	if err != nil {
+		t.Fatalf("failed to open rotated file: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(content) != "secret file" {
+		t.Errorf("expected rotated file to decrypt, got %q (%v)", content, err)
+	}
+
+	found, err := messageRepo.GetByID(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("failed to read rotated message: %v", err)
+	}
+	if found.BodyText != "secret body" {
+		t.Errorf("expected rotated body to decrypt, got %q", found.BodyText)
+	}
+
+	// A second run has nothing left to do
+	report, err = RotateEncryptionKeys(ctx, dataKeyRepo, messageRepo, rotated, false, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.FileKeysScanned != 0 || report.BodiesRewrapped != 0 {
+		t.Errorf("expected nothing to rotate, got %+v", report)
+	}
+}
+
+func TestRotateEncryptionKeys_ReportsUnknownKeys(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	if err := f.db.AutoMigrate(&models.DataKey{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dataKeyRepo := repository.NewDataKeyRepository(f.db)
+
+	if err := dataKeyRepo.SaveDataKey(ctx, "blobs/aa/lost", "retired", []byte("wrapped")); err != nil {
+		t.Fatalf("failed to save data key: %v", err)
+	}
+
+	report, err := RotateEncryptionKeys(ctx, dataKeyRepo, repository.NewMessageRepository(f.db), newTestKeyring(t, 2), false, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.FileKeysRewrapped != 0 || len(report.Errors) != 1 {
+		t.Errorf("expected the unknown key to be reported, got %+v", report)
+	}
+}
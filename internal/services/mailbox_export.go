@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailfile"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// ExportFormat is a mailbox export file format
+type ExportFormat string
+
+const (
+	// ExportFormatMbox is a single mboxrd file
+	ExportFormatMbox ExportFormat = "mbox"
+	// ExportFormatMaildir is a Maildir directory in a tar.gz archive
+	ExportFormatMaildir ExportFormat = "maildir"
+)
+
+// ParseExportFormat parses an export format name; empty means mbox
+func ParseExportFormat(v string) (ExportFormat, error) {
+	switch ExportFormat(strings.ToLower(v)) {
+	case "", ExportFormatMbox:
+		return ExportFormatMbox, nil
+	case ExportFormatMaildir:
+		return ExportFormatMaildir, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q", v)
+	}
+}
+
+// Filename returns the name of the export file of a mailbox
+func (f ExportFormat) Filename(mailbox *models.Mailbox) string {
+	if f == ExportFormatMaildir {
+		return mailbox.FullAddress + ".maildir.tar.gz"
+	}
+	return mailbox.FullAddress + ".mbox"
+}
+
+// ContentType returns the media type of export files in this format
+func (f ExportFormat) ContentType() string {
+	if f == ExportFormatMaildir {
+		return "application/gzip"
+	}
+	return "application/mbox"
+}
+
+// MailboxExporter writes mailboxes in standard mailbox formats
+type MailboxExporter struct {
+	messageRepo repository.MessageRepository
+	fileStorage storage.FileStorage
+}
+
+// NewMailboxExporter creates a new MailboxExporter
+func NewMailboxExporter(messageRepo repository.MessageRepository, fileStorage storage.FileStorage) *MailboxExporter {
+	return &MailboxExporter{messageRepo: messageRepo, fileStorage: fileStorage}
+}
+
+// messageWriter is the common part of the mailfile writers
+type messageWriter interface {
+	write(message *models.Message, raw []byte) error
+	Close() error
+}
+
+// Export streams every message of a mailbox to w and returns how many were written.
+// Messages are written from their stored raw source; messages without one are
+// rebuilt as MIME from the stored fields and attachments.
+func (e *MailboxExporter) Export(ctx context.Context, w io.Writer, mailbox *models.Mailbox, format ExportFormat) (int, error) {
+	const batchSize = 100
+
+	writer, err := newMessageWriter(w, mailbox, format)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	var lastID uint
+	for {
+		messages, err := e.messageRepo.ListByMailboxAfterID(ctx, mailbox.ID, lastID, batchSize)
+		if err != nil {
+			return count, fmt.Errorf("failed to list messages: %w", err)
+		}
+
+		for i := range messages {
+			message := &messages[i]
+			lastID = message.ID
+
+			raw, err := MessageSource(e.fileStorage, mailbox, message)
+			if err != nil {
+				return count, fmt.Errorf("failed to read message %d: %w", message.ID, err)
+			}
+			if err := writer.write(message, raw); err != nil {
+				return count, fmt.Errorf("failed to write message %d: %w", message.ID, err)
+			}
+			count++
+		}
+
+		if len(messages) < batchSize {
+			return count, writer.Close()
+		}
+	}
+}
+
+// newMessageWriter creates the writer for an export format
+func newMessageWriter(w io.Writer, mailbox *models.Mailbox, format ExportFormat) (messageWriter, error) {
+	switch format {
+	case ExportFormatMbox:
+		return mboxMessageWriter{mailfile.NewMboxWriter(w)}, nil
+	case ExportFormatMaildir:
+		writer, err := mailfile.NewMaildirWriter(w, mailbox.FullAddress)
+		if err != nil {
+			return nil, err
+		}
+		return maildirMessageWriter{writer}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// mboxMessageWriter adapts mailfile.MboxWriter to messageWriter
+type mboxMessageWriter struct {
+	*mailfile.MboxWriter
+}
+
+func (m mboxMessageWriter) write(message *models.Message, raw []byte) error {
+	return m.WriteMessage(message.SenderEmail, message.ReceivedAt, raw)
+}
+
+// maildirMessageWriter adapts mailfile.MaildirWriter to messageWriter
+type maildirMessageWriter struct {
+	*mailfile.MaildirWriter
+}
+
+func (m maildirMessageWriter) write(message *models.Message, raw []byte) error {
+	return m.WriteMessage(strconv.FormatUint(uint64(message.ID), 10), message.ReceivedAt, maildirFlags(message), raw)
+}
+
+// maildirFlags maps message state to Maildir info flags
+func maildirFlags(message *models.Message) []mailfile.Flag {
+	var flags []mailfile.Flag
+	if message.IsRead {
+		flags = append(flags, mailfile.FlagSeen)
+	}
+	return flags
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newExportFixture creates an exporter over an in-memory database with one mailbox
+func newExportFixture(t *testing.T) (*MailboxExporter, *gorm.DB, storage.FileStorage, *models.Mailbox) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	fileStorage, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	domain := &models.Domain{Name: "export.test", IsActive: true}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("failed to create domain: %v", err)
+	}
+	mailbox := &models.Mailbox{LocalPart: "user", DomainID: domain.ID, FullAddress: "user@export.test"}
+	if err := db.Create(mailbox).Error; err != nil {
+		t.Fatalf("failed to create mailbox: %v", err)
+	}
+
+	return NewMailboxExporter(repository.NewMessageRepository(db), fileStorage), db, fileStorage, mailbox
+}
+
+func TestParseExportFormat(t *testing.T) {
+	for input, want := range map[string]ExportFormat{"": ExportFormatMbox, "MBOX": ExportFormatMbox, "maildir": ExportFormatMaildir} {
+		got, err := ParseExportFormat(input)
+		if err != nil || got != want {
+			t.Errorf("ParseExportFormat(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseExportFormat("pst"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestMailboxExporter_UsesRawSource(t *testing.T) {
+	exporter, db, fileStorage, mailbox := newExportFixture(t)
+
+	raw := "From: sender@example.com\r\nSubject: Stored\r\n\r\nFrom the raw source\r\n"
+	rawPath, err := fileStorage.Save("message.eml", strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to save raw source: %v", err)
+	}
+	receivedAt := time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)
+	db.Create(&models.Message{MailboxID: mailbox.ID, SenderEmail: "sender@example.com", RawPath: rawPath, ReceivedAt: receivedAt})
+
+	var buf bytes.Buffer
+	count, err := exporter.Export(context.Background(), &buf, mailbox, ExportFormatMbox)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	if count != 1 {
+		t.Errorf("expected 1 message, got %d", count)
+	}
+	expected := "From sender@example.com Tue Mar  5 08:30:00 2024\n" +
+		"From: sender@example.com\nSubject: Stored\n\n>From the raw source\n\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected mbox:\n%s", buf.String())
+	}
+}
+
+func TestMailboxExporter_RebuildsMissingSource(t *testing.T) {
+	exporter, db, fileStorage, mailbox := newExportFixture(t)
+
+	message := &models.Message{
+		MailboxID:   mailbox.ID,
+		SenderEmail: "sender@example.com",
+		SenderName:  "Sender",
+		Subject:     "Rebuilt",
+		BodyText:    "plain body",
+		BodyHTML:    "<p>html body</p>",
+		RawPath:     "missing/message.eml",
+	}
+	db.Create(message)
+	filePath, err := fileStorage.Save("doc.txt", strings.NewReader("attachment content"))
+	if err != nil {
+		t.Fatalf("failed to save attachment: %v", err)
+	}
+	db.Create(&models.Attachment{MessageID: message.ID, Filename: "doc.txt", ContentType: "text/plain", FilePath: filePath})
+
+	var buf bytes.Buffer
+	if _, err := exporter.Export(context.Background(), &buf, mailbox, ExportFormatMbox); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// Drop the separator line and parse the rebuilt message
+	_, rebuilt, _ := strings.Cut(buf.String(), "\n")
+	env, err := enmime.ReadEnvelope(strings.NewReader(rebuilt))
+	if err != nil {
+		t.Fatalf("rebuilt message does not parse: %v", err)
+	}
+	if env.GetHeader("Subject") != "Rebuilt" || env.GetHeader("To") != "<user@export.test>" {
+		t.Errorf("unexpected headers: subject %q, to %q", env.GetHeader("Subject"), env.GetHeader("To"))
+	}
+	if strings.TrimSpace(env.Text) != "plain body" || !strings.Contains(env.HTML, "html body") {
+		t.Errorf("unexpected bodies: %q, %q", env.Text, env.HTML)
+	}
+	if len(env.Attachments) != 1 || string(env.Attachments[0].Content) != "attachment content" {
+		t.Errorf("expected the stored attachment, got %d attachments", len(env.Attachments))
+	}
+}
+
+func TestMailboxExporter_Maildir(t *testing.T) {
+	exporter, db, _, mailbox := newExportFixture(t)
+
+	db.Create(&models.Message{MailboxID: mailbox.ID, SenderEmail: "a@example.com", Subject: "unread", BodyText: "x"})
+	db.Create(&models.Message{MailboxID: mailbox.ID, SenderEmail: "b@example.com", Subject: "read", BodyText: "y", IsRead: true})
+
+	var buf bytes.Buffer
+	count, err := exporter.Export(context.Background(), &buf, mailbox, ExportFormatMaildir)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 messages, got %d", count)
+	}
+
+	names := maildirEntryNames(t, buf.Bytes())
+	var newCount, seenCount int
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, "user@export.test/new/"):
+			newCount++
+		case strings.HasPrefix(name, "user@export.test/cur/") && strings.HasSuffix(name, ":2,S"):
+			seenCount++
+		}
+	}
+	if newCount != 1 || seenCount != 1 {
+		t.Errorf("expected one new and one seen message, got %v", names)
+	}
+}
+
+// maildirEntryNames lists the regular files of a tar.gz archive
+func maildirEntryNames(t *testing.T, archive []byte) []string {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("invalid tar: %v", err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/mailfile"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+)
+
+// MaxImportMessageSize is the largest message accepted by an import, matching the SMTP limit
+const MaxImportMessageSize = 25 * 1024 * 1024
+
+// errMessageTooLarge is reported for messages over MaxImportMessageSize
+var errMessageTooLarge = fmt.Errorf("message exceeds %d bytes", MaxImportMessageSize)
+
+// MessageDeliverer stores raw emails the same way mail received over SMTP is stored
+type MessageDeliverer interface {
+	// DeliverRaw parses raw and stores it in mailbox; with preserveDate the
+	// Date header becomes the received time
+	DeliverRaw(ctx context.Context, mailbox *models.Mailbox, raw []byte, preserveDate bool) (*models.Message, error)
+}
+
+// ImportSource is an uploaded file; zip archives need random access
+type ImportSource interface {
+	io.Reader
+	io.ReaderAt
+}
+
+// ImportResult is the outcome of importing one message
+type ImportResult struct {
+	Source    string `json:"source"`
+	MessageID uint   `json:"message_id,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an import
+type ImportReport struct {
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// fail records a message that could not be imported
+func (r *ImportReport) fail(source string, err error) {
+	r.Failed++
+	r.Results = append(r.Results, ImportResult{Source: source, Error: err.Error()})
+}
+
+// MailboxImporter imports .eml, mbox and zip-of-eml files into mailboxes
+type MailboxImporter struct {
+	deliverer MessageDeliverer
+}
+
+// NewMailboxImporter creates a new MailboxImporter
+func NewMailboxImporter(deliverer MessageDeliverer) *MailboxImporter {
+	return &MailboxImporter{deliverer: deliverer}
+}
+
+// importFormat is the container format of an uploaded file
+type importFormat int
+
+const (
+	importEML importFormat = iota
+	importMbox
+	importZip
+)
+
+// ImportFile imports every message of an uploaded file into mailbox and adds
+// one result per message to report. The format is taken from the file extension
+// and falls back to sniffing the content. Only a cancelled context is returned
+// as an error; everything else is reported per message.
+func (i *MailboxImporter) ImportFile(
+	ctx context.Context,
+	mailbox *models.Mailbox,
+	filename string,
+	file ImportSource,
+	size int64,
+	preserveDate bool,
+	report *ImportReport,
+) error {
+	switch detectImportFormat(filename, file) {
+	case importZip:
+		return i.importZip(ctx, mailbox, filename, file, size, preserveDate, report)
+	case importMbox:
+		return i.importMbox(ctx, mailbox, filename, file, preserveDate, report)
+	default:
+		raw, err := readMessage(file)
+		if err != nil {
+			report.fail(filename, err)
+			return nil
+		}
+		i.deliver(ctx, mailbox, filename, raw, preserveDate, report)
+		return ctx.Err()
+	}
+}
+
+// importMbox imports each message of an mbox file
+func (i *MailboxImporter) importMbox(
+	ctx context.Context,
+	mailbox *models.Mailbox,
+	filename string,
+	file io.Reader,
+	preserveDate bool,
+	report *ImportReport,
+) error {
+	reader := mailfile.NewMboxReader(file, MaxImportMessageSize)
+	for n := 1; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		source := fmt.Sprintf("%s#%d", filename, n)
+		raw, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, mailfile.ErrMessageTooLarge) {
+			report.fail(source, errMessageTooLarge)
+			continue
+		}
+		if err != nil {
+			report.fail(source, err)
+			return nil
+		}
+		i.deliver(ctx, mailbox, source, raw, preserveDate, report)
+	}
+}
+
+// importZip imports each .eml entry of a zip archive; other entries are ignored
+func (i *MailboxImporter) importZip(
+	ctx context.Context,
+	mailbox *models.Mailbox,
+	filename string,
+	file io.ReaderAt,
+	size int64,
+	preserveDate bool,
+	report *ImportReport,
+) error {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		report.fail(filename, fmt.Errorf("invalid zip archive: %w", err))
+		return nil
+	}
+
+	for _, entry := range archive.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.FileInfo().IsDir() || !strings.EqualFold(path.Ext(entry.Name), ".eml") ||
+			strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+
+		source := filename + "/" + entry.Name
+		if entry.UncompressedSize64 > MaxImportMessageSize {
+			report.fail(source, errMessageTooLarge)
+			continue
+		}
+		raw, err := readZipEntry(entry)
+		if err != nil {
+			report.fail(source, err)
+			continue
+		}
+		i.deliver(ctx, mailbox, source, raw, preserveDate, report)
+	}
+	return nil
+}
+
+// deliver stores one message and records the outcome
+func (i *MailboxImporter) deliver(
+	ctx context.Context,
+	mailbox *models.Mailbox,
+	source string,
+	raw []byte,
+	preserveDate bool,
+	report *ImportReport,
+) {
+	message, err := i.deliverer.DeliverRaw(ctx, mailbox, raw, preserveDate)
+	if err != nil {
+		report.fail(source, err)
+		return
+	}
+	report.Imported++
+	report.Results = append(report.Results, ImportResult{
+		Source:    source,
+		MessageID: message.ID,
+		Subject:   message.Subject,
+	})
+}
+
+// readMessage reads a single message, enforcing MaxImportMessageSize
+func readMessage(r io.Reader) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, MaxImportMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > MaxImportMessageSize {
+		return nil, errMessageTooLarge
+	}
+	return raw, nil
+}
+
+// readZipEntry reads a zip entry; the declared size is not trusted
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return readMessage(rc)
+}
+
+// detectImportFormat picks the format by extension, or by the first bytes of the file
+func detectImportFormat(filename string, file io.ReaderAt) importFormat {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".zip":
+		return importZip
+	case ".mbox", ".mbx":
+		return importMbox
+	case ".eml":
+		return importEML
+	}
+
+	head := make([]byte, 5)
+	n, _ := file.ReadAt(head, 0)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return importZip
+	case bytes.HasPrefix(head, []byte("From ")):
+		return importMbox
+	default:
+		return importEML
+	}
+}
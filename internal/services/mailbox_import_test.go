@@ -0,0 +1,116 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+)
+
+// fakeDeliverer records delivered messages and rejects sources containing "broken"
+type fakeDeliverer struct {
+	delivered [][]byte
+	preserved []bool
+}
+
+func (f *fakeDeliverer) DeliverRaw(_ context.Context, mailbox *models.Mailbox, raw []byte, preserveDate bool) (*models.Message, error) {
+	if bytes.Contains(raw, []byte("broken")) {
+		return nil, errors.New("failed to parse email")
+	}
+	f.delivered = append(f.delivered, raw)
+	f.preserved = append(f.preserved, preserveDate)
+	return &models.Message{ID: uint(len(f.delivered)), MailboxID: mailbox.ID, Subject: "imported"}, nil
+}
+
+func importTestFile(t *testing.T, filename string, content []byte, preserveDate bool) (*fakeDeliverer, *ImportReport) {
+	t.Helper()
+
+	deliverer := &fakeDeliverer{}
+	report := &ImportReport{}
+	err := NewMailboxImporter(deliverer).ImportFile(context.Background(), &models.Mailbox{ID: 1},
+		filename, bytes.NewReader(content), int64(len(content)), preserveDate, report)
+	if err != nil {
+		t.Fatalf("ImportFile failed: %v", err)
+	}
+	return deliverer, report
+}
+
+func TestMailboxImporter_EML(t *testing.T) {
+	deliverer, report := importTestFile(t, "message.eml", []byte("Subject: hi\r\n\r\nbody\r\n"), true)
+
+	if report.Imported != 1 || report.Failed != 0 {
+		t.Fatalf("imported/failed = %d/%d, want 1/0", report.Imported, report.Failed)
+	}
+	if report.Results[0].Source != "message.eml" || report.Results[0].MessageID != 1 {
+		t.Errorf("unexpected result: %+v", report.Results[0])
+	}
+	if !deliverer.preserved[0] {
+		t.Error("preserveDate was not passed to the deliverer")
+	}
+}
+
+func TestMailboxImporter_Mbox(t *testing.T) {
+	mbox := "From a@example.com Tue Mar  5 08:30:00 2024\n" +
+		"Subject: one\n\n>From quoted\n\n" +
+		"From b@example.com Tue Mar  5 08:31:00 2024\n" +
+		"Subject: broken\n\n" +
+		"From c@example.com Tue Mar  5 08:32:00 2024\n" +
+		"Subject: three\n"
+
+	// No extension: the format is sniffed from the content
+	deliverer, report := importTestFile(t, "upload", []byte(mbox), false)
+
+	if report.Imported != 2 || report.Failed != 1 {
+		t.Fatalf("imported/failed = %d/%d, want 2/1", report.Imported, report.Failed)
+	}
+	if report.Results[1].Source != "upload#2" || report.Results[1].Error == "" {
+		t.Errorf("expected the second message to fail, got %+v", report.Results[1])
+	}
+	if got := string(deliverer.delivered[0]); got != "Subject: one\r\n\r\nFrom quoted\r\n" {
+		t.Errorf("first message = %q", got)
+	}
+}
+
+func TestMailboxImporter_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"a.eml":             "Subject: a\r\n\r\nbody\r\n",
+		"nested/b.EML":      "Subject: b\r\n\r\nbody\r\n",
+		"notes.txt":         "ignored",
+		"__MACOSX/._a.eml":  "ignored",
+		"nested/broken.eml": "Subject: broken\r\n\r\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+
+	_, report := importTestFile(t, "corpus.zip", buf.Bytes(), false)
+
+	if report.Imported != 2 || report.Failed != 1 {
+		t.Fatalf("imported/failed = %d/%d, want 2/1: %+v", report.Imported, report.Failed, report.Results)
+	}
+	for _, result := range report.Results {
+		if !strings.HasPrefix(result.Source, "corpus.zip/") {
+			t.Errorf("source %q is not prefixed with the archive name", result.Source)
+		}
+	}
+}
+
+func TestMailboxImporter_InvalidZip(t *testing.T) {
+	_, report := importTestFile(t, "corpus.zip", []byte("not a zip"), false)
+
+	if report.Failed != 1 || !strings.Contains(report.Results[0].Error, "invalid zip archive") {
+		t.Errorf("expected an invalid archive failure, got %+v", report.Results)
+	}
+}
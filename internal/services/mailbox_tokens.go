@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// MailboxTokenPrefix starts every mailbox token, telling them apart from the API key
+const MailboxTokenPrefix = "mbx_"
+
+var (
+	// ErrInvalidMailboxToken is returned for tokens that were never issued or were revoked
+	ErrInvalidMailboxToken = errors.New("invalid mailbox token")
+	// ErrMailboxTokenExpired is returned for tokens past their expiry
+	ErrMailboxTokenExpired = errors.New("mailbox token expired")
+)
+
+// MailboxTokenService issues, verifies and revokes the bearer tokens that give end
+// users access to a single mailbox
+type MailboxTokenService struct {
+	repo repository.MailboxTokenRepository
+	now  func() time.Time
+}
+
+// NewMailboxTokenService creates a new MailboxTokenService
+func NewMailboxTokenService(repo repository.MailboxTokenRepository) *MailboxTokenService {
+	return &MailboxTokenService{repo: repo, now: time.Now}
+}
+
+// IsMailboxToken reports whether a bearer credential is a mailbox token rather
+// than the API key
+func IsMailboxToken(value string) bool {
+	return strings.HasPrefix(value, MailboxTokenPrefix)
+}
+
+// Issue creates a token for a mailbox that expires after ttl, or never when ttl
+// is 0. The token is only returned here; the record keeps its hash.
+func (s *MailboxTokenService) Issue(ctx context.Context, mailboxID uint, name string, ttl time.Duration) (string, *models.MailboxToken, error) {
+	value, err := newSecret(MailboxTokenPrefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate mailbox token: %w", err)
+	}
+
+	record := &models.MailboxToken{
+		MailboxID: mailboxID,
+		Name:      name,
+		TokenHash: hashSecret(value),
+	}
+	if ttl > 0 {
+		expiresAt := s.now().Add(ttl).UTC()
+		record.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.Create(ctx, record); err != nil {
+		return "", nil, err
+	}
+	return value, record, nil
+}
+
+// Verify returns the record of a valid token
+func (s *MailboxTokenService) Verify(ctx context.Context, value string) (*models.MailboxToken, error) {
+	if !IsMailboxToken(value) {
+		return nil, ErrInvalidMailboxToken
+	}
+	record, err := s.repo.GetByHash(ctx, hashSecret(value))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidMailboxToken
+		}
+		return nil, err
+	}
+	if record.IsExpired(s.now()) {
+		return nil, ErrMailboxTokenExpired
+	}
+	return record, nil
+}
+
+// List returns the tokens of a mailbox, including expired ones
+func (s *MailboxTokenService) List(ctx context.Context, mailboxID uint) ([]models.MailboxToken, error) {
+	return s.repo.ListByMailbox(ctx, mailboxID)
+}
+
+// Revoke deletes a token of a mailbox; it stops working immediately
+func (s *MailboxTokenService) Revoke(ctx context.Context, mailboxID, id uint) error {
+	return s.repo.Delete(ctx, mailboxID, id)
+}
+
+// hashSecret returns the stored form of a token or API key. Both are random, so
+// an unsalted hash is enough to keep a database leak from revealing them.
+func hashSecret(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecret returns 32 random bytes, encoded after prefix
+func newSecret(prefix string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
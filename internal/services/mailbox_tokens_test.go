@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+)
+
+// newTokenService builds a MailboxTokenService over the database of a retention fixture
+func newTokenService(f *retentionFixture) *MailboxTokenService {
+	return NewMailboxTokenService(repository.NewMailboxTokenRepository(f.db))
+}
+
+func TestMailboxTokenService_IssueAndVerify(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service := newTokenService(f)
+	mailbox := f.createMailbox(t, "inbox", time.Now())
+	ctx := context.Background()
+
+	token, record, err := service.Issue(ctx, mailbox.ID, "default", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, MailboxTokenPrefix) {
+		t.Errorf("expected token to start with %q, got %q", MailboxTokenPrefix, token)
+	}
+	if record.TokenHash == "" || strings.Contains(record.TokenHash, token) {
+		t.Errorf("expected only the hash of the token to be stored")
+	}
+	if record.ExpiresAt != nil {
+		t.Errorf("expected token without ttl not to expire, got %v", record.ExpiresAt)
+	}
+
+	verified, err := service.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verified.MailboxID != mailbox.ID {
+		t.Errorf("expected mailbox %d, got %d", mailbox.ID, verified.MailboxID)
+	}
+
+	if _, err := service.Verify(ctx, token+"x"); !errors.Is(err, ErrInvalidMailboxToken) {
+		t.Errorf("expected ErrInvalidMailboxToken for an unknown token, got %v", err)
+	}
+	if _, err := service.Verify(ctx, "not-a-token"); !errors.Is(err, ErrInvalidMailboxToken) {
+		t.Errorf("expected ErrInvalidMailboxToken without the prefix, got %v", err)
+	}
+}
+
+func TestMailboxTokenService_Expiry(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service := newTokenService(f)
+	mailbox := f.createMailbox(t, "inbox", time.Now())
+	ctx := context.Background()
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	token, record, err := service.Issue(ctx, mailbox.ID, "", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.ExpiresAt == nil || !record.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected expiry in one hour, got %v", record.ExpiresAt)
+	}
+	if _, err := service.Verify(ctx, token); err != nil {
+		t.Errorf("expected token to be valid before expiry, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := service.Verify(ctx, token); !errors.Is(err, ErrMailboxTokenExpired) {
+		t.Errorf("expected ErrMailboxTokenExpired, got %v", err)
+	}
+}
+
+func TestMailboxTokenService_Revoke(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service := newTokenService(f)
+	mailbox := f.createMailbox(t, "inbox", time.Now())
+	other := f.createMailbox(t, "other", time.Now())
+	ctx := context.Background()
+
+	token, record, err := service.Issue(ctx, mailbox.ID, "phone", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := service.Revoke(ctx, other.ID, record.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound when revoking through another mailbox, got %v", err)
+	}
+	if err := service.Revoke(ctx, mailbox.ID, record.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := service.Verify(ctx, token); !errors.Is(err, ErrInvalidMailboxToken) {
+		t.Errorf("expected revoked token to be invalid, got %v", err)
+	}
+
+	tokens, err := service.List(ctx, mailbox.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("expected no tokens after revoking, got %d", len(tokens))
+	}
+}
+
+func TestMailboxTokenService_DeletedWithMailbox(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	service := newTokenService(f)
+	mailbox := f.createMailbox(t, "inbox", time.Now())
+	ctx := context.Background()
+
+	token, _, err := service.Issue(ctx, mailbox.ID, "", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repository.NewMailboxRepository(f.db).Delete(ctx, mailbox.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := service.Verify(ctx, token); !errors.Is(err, ErrInvalidMailboxToken) {
+		t.Errorf("expected token of a deleted mailbox to be invalid, got %v", err)
+	}
+	if count := f.count(&models.MailboxToken{}); count != 0 {
+		t.Errorf("expected tokens to be deleted with the mailbox, got %d", count)
+	}
+}
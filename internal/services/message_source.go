@@ -0,0 +1,71 @@
+package services
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// MessageSource returns the RFC 822 source of a message. The stored raw source is
+// used when it is readable; otherwise the message is rebuilt as MIME from the
+// stored fields and attachments.
+func MessageSource(fileStorage storage.FileStorage, mailbox *models.Mailbox, message *models.Message) ([]byte, error) {
+	if message.RawPath != "" {
+		if raw, err := readStoredFile(fileStorage, message.RawPath); err == nil {
+			return raw, nil
+		}
+	}
+	return rebuildMessage(fileStorage, mailbox, message)
+}
+
+// rebuildMessage generates MIME from the stored message fields and attachments
+func rebuildMessage(fileStorage storage.FileStorage, mailbox *models.Mailbox, message *models.Message) ([]byte, error) {
+	builder := enmime.Builder().
+		From(message.SenderName, message.SenderEmail).
+		To("", mailbox.FullAddress).
+		Subject(message.Subject).
+		Date(message.ReceivedAt).
+		Header("X-Infinimail-Rebuilt", "true")
+	if message.BodyText != "" {
+		builder = builder.Text([]byte(message.BodyText))
+	}
+	if message.BodyHTML != "" {
+		builder = builder.HTML([]byte(message.BodyHTML))
+	}
+
+	for _, attachment := range message.Attachments {
+		content, err := readStoredFile(fileStorage, attachment.FilePath)
+		if err != nil {
+			// Keep the message even when one of its files is gone
+			continue
+		}
+		if attachment.Inline {
+			builder = builder.AddInline(content, attachment.ContentType, attachment.Filename, attachment.ContentID)
+		} else {
+			builder = builder.AddAttachment(content, attachment.ContentType, attachment.Filename)
+		}
+	}
+
+	root, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := root.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readStoredFile reads a whole stored file
+func readStoredFile(fileStorage storage.FileStorage, path string) ([]byte, error) {
+	file, err := fileStorage.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
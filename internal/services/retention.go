@@ -0,0 +1,404 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// RetentionConfig holds configuration for the retention service
+type RetentionConfig struct {
+	// CheckInterval is how often the retention sweep runs
+	CheckInterval time.Duration
+	// MessageRetentionHours is the default message lifetime (0 = keep forever)
+	MessageRetentionHours int
+	// MailboxRetentionDays is the default mailbox inactivity limit (0 = keep forever)
+	MailboxRetentionDays int
+	// DryRun reports what would be deleted without deleting anything
+	DryRun bool
+	// BatchSize is the maximum number of rows deleted per statement
+	BatchSize int
+}
+
+// RetentionReport summarizes a single retention sweep
+type RetentionReport struct {
+	StartedAt        time.Time               `json:"started_at"`
+	FinishedAt       time.Time               `json:"finished_at"`
+	DryRun           bool                    `json:"dry_run"`
+	MessagesDeleted  int64                   `json:"messages_deleted"`
+	MailboxesDeleted int64                   `json:"mailboxes_deleted"`
+	FilesDeleted     int                     `json:"files_deleted"`
+	Domains          []DomainRetentionResult `json:"domains"`
+	Errors           []string                `json:"errors,omitempty"`
+}
+
+// DomainRetentionResult holds the outcome of a sweep for a single domain
+type DomainRetentionResult struct {
+	DomainID              uint   `json:"domain_id"`
+	DomainName            string `json:"domain_name"`
+	MessageRetentionHours int    `json:"message_retention_hours"`
+	MailboxRetentionDays  int    `json:"mailbox_retention_days"`
+	ExpiredMessages       int64  `json:"expired_messages"`
+	InactiveMailboxes     int64  `json:"inactive_mailboxes"`
+	FilesDeleted          int    `json:"files_deleted"`
+}
+
+// RetentionRunner exposes retention sweeps to the API layer
+type RetentionRunner interface {
+	// LastReport returns the report of the most recent sweep, or nil if none ran yet
+	LastReport() *RetentionReport
+	// RunOnce performs a sweep immediately and returns its report
+	RunOnce(ctx context.Context, dryRun bool) (*RetentionReport, error)
+}
+
+// RetentionService deletes expired messages and inactive mailboxes in the background
+type RetentionService struct {
+	domainRepo  repository.DomainRepository
+	mailboxRepo repository.MailboxRepository
+	messageRepo repository.MessageRepository
+	fileStorage storage.FileStorage
+	config      RetentionConfig
+	logger      *slog.Logger
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+	running     bool
+	mu          sync.Mutex
+
+	// runMu serializes sweeps so a forced run never overlaps the scheduled one
+	runMu      sync.Mutex
+	lastReport *RetentionReport
+	now        func() time.Time
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService(
+	domainRepo repository.DomainRepository,
+	mailboxRepo repository.MailboxRepository,
+	messageRepo repository.MessageRepository,
+	fileStorage storage.FileStorage,
+	config RetentionConfig,
+	logger *slog.Logger,
+) *RetentionService {
+	// Set defaults
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Hour
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.MessageRetentionHours < 0 {
+		config.MessageRetentionHours = 0
+	}
+	if config.MailboxRetentionDays < 0 {
+		config.MailboxRetentionDays = 0
+	}
+
+	return &RetentionService{
+		domainRepo:  domainRepo,
+		mailboxRepo: mailboxRepo,
+		messageRepo: messageRepo,
+		fileStorage: fileStorage,
+		config:      config,
+		logger:      logger,
+		stopCh:      make(chan struct{}),
+		now:         time.Now,
+	}
+}
+
+// Start begins the retention background job
+func (s *RetentionService) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stopCh = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.retentionLoop()
+
+	s.logger.Info("retention service started",
+		slog.Duration("check_interval", s.config.CheckInterval),
+		slog.Int("message_retention_hours", s.config.MessageRetentionHours),
+		slog.Int("mailbox_retention_days", s.config.MailboxRetentionDays),
+		slog.Bool("dry_run", s.config.DryRun))
+}
+
+// Stop gracefully stops the retention background job
+func (s *RetentionService) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopCh)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.logger.Info("retention service stopped")
+}
+
+// IsRunning returns whether the retention service is currently running
+func (s *RetentionService) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// ForceCheck triggers an immediate retention sweep in the background
+func (s *RetentionService) ForceCheck() {
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+
+	if !running {
+		s.logger.Warn("force check called but retention service is not running")
+		return
+	}
+
+	s.logger.Info("retention force check triggered")
+	go s.runScheduled()
+}
+
+// LastReport returns the report of the most recent sweep
+func (s *RetentionService) LastReport() *RetentionReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastReport
+}
+
+// retentionLoop is the main loop that periodically runs the retention sweep
+func (s *RetentionService) retentionLoop() {
+	defer s.wg.Done()
+
+	// Run immediately on start
+	s.runScheduled()
+
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.runScheduled()
+		}
+	}
+}
+
+// runScheduled runs a sweep with the configured dry-run setting
+func (s *RetentionService) runScheduled() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if _, err := s.RunOnce(ctx, s.config.DryRun); err != nil {
+		s.logger.Error("retention sweep failed", slog.Any("error", err))
+	}
+}
+
+// RunOnce performs a retention sweep over all domains.
+// When dryRun is true, expired data is counted but nothing is deleted.
+func (s *RetentionService) RunOnce(ctx context.Context, dryRun bool) (*RetentionReport, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	report := &RetentionReport{
+		StartedAt: s.now(),
+		DryRun:    dryRun,
+		Domains:   []DomainRetentionResult{},
+	}
+
+	domains, err := s.domainRepo.List(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	for i := range domains {
+		result, errs := s.sweepDomain(ctx, &domains[i], dryRun)
+		report.Errors = append(report.Errors, errs...)
+		if result == nil {
+			continue
+		}
+		report.Domains = append(report.Domains, *result)
+		if !dryRun {
+			report.MessagesDeleted += result.ExpiredMessages
+			report.MailboxesDeleted += result.InactiveMailboxes
+			report.FilesDeleted += result.FilesDeleted
+		}
+	}
+
+	report.FinishedAt = s.now()
+
+	s.mu.Lock()
+	s.lastReport = report
+	s.mu.Unlock()
+
+	s.logger.Info("retention sweep completed",
+		slog.Bool("dry_run", dryRun),
+		slog.Int64("messages_deleted", report.MessagesDeleted),
+		slog.Int64("mailboxes_deleted", report.MailboxesDeleted),
+		slog.Int("files_deleted", report.FilesDeleted),
+		slog.Int("errors", len(report.Errors)))
+
+	return report, nil
+}
+
+// sweepDomain applies the retention policy of a single domain.
+// Returns nil if the domain has no active policy.
+func (s *RetentionService) sweepDomain(ctx context.Context, domain *models.Domain, dryRun bool) (*DomainRetentionResult, []string) {
+	messageHours, mailboxDays := s.effectivePolicy(domain)
+	if messageHours == 0 && mailboxDays == 0 {
+		return nil, nil
+	}
+
+	result := &DomainRetentionResult{
+		DomainID:              domain.ID,
+		DomainName:            domain.Name,
+		MessageRetentionHours: messageHours,
+		MailboxRetentionDays:  mailboxDays,
+	}
+	var errs []string
+	now := s.now()
+
+	if messageHours > 0 {
+		cutoff := now.Add(-time.Duration(messageHours) * time.Hour)
+		if err := s.expireMessages(ctx, domain.ID, cutoff, dryRun, result); err != nil {
+			errs = append(errs, fmt.Sprintf("domain %s: %v", domain.Name, err))
+			s.logger.Error("failed to expire messages",
+				slog.String("domain", domain.Name),
+				slog.Any("error", err))
+		}
+	}
+
+	if mailboxDays > 0 {
+		cutoff := now.AddDate(0, 0, -mailboxDays)
+		if err := s.expireMailboxes(ctx, domain.ID, cutoff, dryRun, result); err != nil {
+			errs = append(errs, fmt.Sprintf("domain %s: %v", domain.Name, err))
+			s.logger.Error("failed to expire mailboxes",
+				slog.String("domain", domain.Name),
+				slog.Any("error", err))
+		}
+	}
+
+	return result, errs
+}
+
+// effectivePolicy resolves the domain's overrides against the service defaults
+func (s *RetentionService) effectivePolicy(domain *models.Domain) (messageHours, mailboxDays int) {
+	messageHours = s.config.MessageRetentionHours
+	if domain.MessageRetentionHours != nil {
+		messageHours = *domain.MessageRetentionHours
+	}
+	mailboxDays = s.config.MailboxRetentionDays
+	if domain.MailboxRetentionDays != nil {
+		mailboxDays = *domain.MailboxRetentionDays
+	}
+	if messageHours < 0 {
+		messageHours = 0
+	}
+	if mailboxDays < 0 {
+		mailboxDays = 0
+	}
+	return messageHours, mailboxDays
+}
+
+// expireMessages deletes messages received before the cutoff in batches
+func (s *RetentionService) expireMessages(ctx context.Context, domainID uint, cutoff time.Time, dryRun bool, result *DomainRetentionResult) error {
+	if dryRun {
+		count, err := s.messageRepo.CountReceivedBefore(ctx, domainID, cutoff)
+		if err != nil {
+			return err
+		}
+		result.ExpiredMessages = count
+		return nil
+	}
+
+	for {
+		ids, err := s.messageRepo.ListIDsReceivedBefore(ctx, domainID, cutoff, s.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		filePaths, err := s.messageRepo.DeleteByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+		result.ExpiredMessages += int64(len(ids))
+		result.FilesDeleted += deleteStoredFiles(s.fileStorage, filePaths, s.logger)
+
+		if len(ids) < s.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// expireMailboxes deletes mailboxes inactive since the cutoff in batches
+func (s *RetentionService) expireMailboxes(ctx context.Context, domainID uint, cutoff time.Time, dryRun bool, result *DomainRetentionResult) error {
+	if dryRun {
+		count, err := s.mailboxRepo.CountInactive(ctx, domainID, cutoff)
+		if err != nil {
+			return err
+		}
+		result.InactiveMailboxes = count
+		return nil
+	}
+
+	for {
+		mailboxes, err := s.mailboxRepo.ListInactive(ctx, domainID, cutoff, s.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(mailboxes) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(mailboxes))
+		for i, mb := range mailboxes {
+			ids[i] = mb.ID
+		}
+
+		filePaths, err := s.mailboxRepo.DeleteByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+		result.InactiveMailboxes += int64(len(ids))
+		result.FilesDeleted += deleteStoredFiles(s.fileStorage, filePaths, s.logger)
+
+		if len(mailboxes) < s.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// deleteStoredFiles removes the files of deleted rows from storage and returns
+// how many were removed. Failures are logged; the reconciler cleans up later.
+func deleteStoredFiles(fileStorage storage.FileStorage, filePaths []string, logger *slog.Logger) int {
+	if fileStorage == nil {
+		return 0
+	}
+
+	deleted := 0
+	for _, path := range filePaths {
+		if err := fileStorage.Delete(path); err != nil {
+			logger.Warn("failed to delete stored file",
+				slog.String("path", path),
+				slog.Any("error", err))
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
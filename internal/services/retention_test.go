@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/database"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// retentionFixture wires a RetentionService to an in-memory database and temp storage
+type retentionFixture struct {
+	db          *gorm.DB
+	service     *RetentionService
+	fileStorage storage.FileStorage
+	storageDir  string
+	domain      *models.Domain
+}
+
+func newRetentionFixture(t *testing.T, config RetentionConfig) *retentionFixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Exec("PRAGMA foreign_keys = ON")
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	storageDir := t.TempDir()
+	fileStorage, err := storage.NewLocalStorage(storageDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	domain := &models.Domain{Name: "retention.test", IsActive: true}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("failed to create domain: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	service := NewRetentionService(
+		repository.NewDomainRepository(db),
+		repository.NewMailboxRepository(db),
+		repository.NewMessageRepository(db),
+		fileStorage,
+		config,
+		logger,
+	)
+
+	return &retentionFixture{
+		db:          db,
+		service:     service,
+		fileStorage: fileStorage,
+		storageDir:  storageDir,
+		domain:      domain,
+	}
+}
+
+func (f *retentionFixture) createMailbox(t *testing.T, localPart string, createdAt time.Time) *models.Mailbox {
+	t.Helper()
+	mailbox := &models.Mailbox{
+		LocalPart:   localPart,
+		DomainID:    f.domain.ID,
+		FullAddress: localPart + "@" + f.domain.Name,
+		CreatedAt:   createdAt,
+	}
+	if err := f.db.Create(mailbox).Error; err != nil {
+		t.Fatalf("failed to create mailbox: %v", err)
+	}
+	return mailbox
+}
+
+func (f *retentionFixture) createMessage(t *testing.T, mailboxID uint, receivedAt time.Time, withFile bool) (*models.Message, string) {
+	t.Helper()
+	message := &models.Message{MailboxID: mailboxID, SenderEmail: "sender@example.com", ReceivedAt: receivedAt}
+	if err := f.db.Create(message).Error; err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	if !withFile {
+		return message, ""
+	}
+
+	path, err := f.fileStorage.Save("doc.pdf", strings.NewReader("attachment body"))
+	if err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	if err := f.db.Create(&models.Attachment{MessageID: message.ID, Filename: "doc.pdf", FilePath: path}).Error; err != nil {
+		t.Fatalf("failed to create attachment: %v", err)
+	}
+	return message, path
+}
+
+func (f *retentionFixture) fileExists(path string) bool {
+	_, err := os.Stat(filepath.Join(f.storageDir, path))
+	return err == nil
+}
+
+func (f *retentionFixture) count(model interface{}) int64 {
+	var n int64
+	f.db.Model(model).Count(&n)
+	return n
+}
+
+func TestNewRetentionService_Defaults(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{MessageRetentionHours: -5})
+
+	if f.service.config.CheckInterval != time.Hour {
+		t.Errorf("expected default check interval 1h, got %v", f.service.config.CheckInterval)
+	}
+	if f.service.config.BatchSize != 500 {
+		t.Errorf("expected default batch size 500, got %d", f.service.config.BatchSize)
+	}
+	if f.service.config.MessageRetentionHours != 0 {
+		t.Errorf("expected negative retention to be clamped to 0, got %d", f.service.config.MessageRetentionHours)
+	}
+}
+
+func TestRetentionService_ExpiresOldMessages(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{MessageRetentionHours: 24, BatchSize: 1})
+	now := time.Now()
+	mailbox := f.createMailbox(t, "user", now)
+
+	_, oldPath := f.createMessage(t, mailbox.ID, now.Add(-48*time.Hour), true)
+	f.createMessage(t, mailbox.ID, now.Add(-30*time.Hour), false)
+	fresh, freshPath := f.createMessage(t, mailbox.ID, now.Add(-time.Hour), true)
+
+	report, err := f.service.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.MessagesDeleted != 2 {
+		t.Errorf("expected 2 messages deleted, got %d", report.MessagesDeleted)
+	}
+	if report.FilesDeleted != 1 {
+		t.Errorf("expected 1 file deleted, got %d", report.FilesDeleted)
+	}
+	if f.fileExists(oldPath) {
+		t.Error("expected expired attachment file to be removed")
+	}
+	if !f.fileExists(freshPath) {
+		t.Error("expected fresh attachment file to be kept")
+	}
+
+	var remaining []models.Message
+	f.db.Find(&remaining)
+	if len(remaining) != 1 || remaining[0].ID != fresh.ID {
+		t.Errorf("expected only the fresh message to remain, got %+v", remaining)
+	}
+	if f.service.LastReport() != report {
+		t.Error("expected last report to be recorded")
+	}
+}
+
+func TestRetentionService_ExpiresInactiveMailboxes(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{MailboxRetentionDays: 7})
+	now := time.Now()
+
+	stale := f.createMailbox(t, "stale", now.AddDate(0, 0, -30))
+	_, stalePath := f.createMessage(t, stale.ID, now.AddDate(0, 0, -20), true)
+	active := f.createMailbox(t, "active", now.AddDate(0, 0, -30))
+	f.createMessage(t, active.ID, now.Add(-time.Hour), false)
+
+	report, err := f.service.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.MailboxesDeleted != 1 {
+		t.Errorf("expected 1 mailbox deleted, got %d", report.MailboxesDeleted)
+	}
+	if f.fileExists(stalePath) {
+		t.Error("expected attachment of deleted mailbox to be removed")
+	}
+	if n := f.count(&models.Mailbox{}); n != 1 {
+		t.Errorf("expected 1 mailbox to remain, got %d", n)
+	}
+	if n := f.count(&models.Attachment{}); n != 0 {
+		t.Errorf("expected attachments of deleted mailbox to be removed, got %d", n)
+	}
+}
+
+func TestRetentionService_DryRunDeletesNothing(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{MessageRetentionHours: 1, MailboxRetentionDays: 1})
+	now := time.Now()
+	mailbox := f.createMailbox(t, "user", now.AddDate(0, 0, -10))
+	_, path := f.createMessage(t, mailbox.ID, now.AddDate(0, 0, -5), true)
+
+	report, err := f.service.RunOnce(context.Background(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !report.DryRun {
+		t.Error("expected report to be marked as dry run")
+	}
+	if len(report.Domains) != 1 {
+		t.Fatalf("expected 1 domain result, got %d", len(report.Domains))
+	}
+	if report.Domains[0].ExpiredMessages != 1 || report.Domains[0].InactiveMailboxes != 1 {
+		t.Errorf("unexpected dry run counts: %+v", report.Domains[0])
+	}
+	if report.MessagesDeleted != 0 || report.MailboxesDeleted != 0 || report.FilesDeleted != 0 {
+		t.Errorf("expected no deletions in dry run, got %+v", report)
+	}
+	if n := f.count(&models.Message{}); n != 1 {
+		t.Errorf("expected message to be kept, got %d", n)
+	}
+	if !f.fileExists(path) {
+		t.Error("expected attachment file to be kept")
+	}
+}
+
+func TestRetentionService_DomainOverrides(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{MessageRetentionHours: 1})
+	keepForever := 0
+	f.domain.MessageRetentionHours = &keepForever
+	if err := f.db.Save(f.domain).Error; err != nil {
+		t.Fatalf("failed to update domain: %v", err)
+	}
+
+	mailbox := f.createMailbox(t, "user", time.Now())
+	f.createMessage(t, mailbox.ID, time.Now().AddDate(0, 0, -10), false)
+
+	report, err := f.service.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(report.Domains) != 0 {
+		t.Errorf("expected domain with retention disabled to be skipped, got %+v", report.Domains)
+	}
+	if n := f.count(&models.Message{}); n != 1 {
+		t.Errorf("expected message to be kept, got %d", n)
+	}
+}
+
+func TestRetentionService_StartStop(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{CheckInterval: time.Hour})
+
+	f.service.Start()
+	if !f.service.IsRunning() {
+		t.Error("expected service to be running after Start")
+	}
+
+	// Start is idempotent
+	f.service.Start()
+
+	f.service.Stop()
+	if f.service.IsRunning() {
+		t.Error("expected service to be stopped after Stop")
+	}
+
+	// Stop is idempotent
+	f.service.Stop()
+
+	if f.service.LastReport() == nil {
+		t.Error("expected initial sweep to record a report")
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// StorageMigrationReport summarizes a migration of legacy files into content-addressed storage
+type StorageMigrationReport struct {
+	DryRun              bool     `json:"dry_run"`
+	AttachmentsScanned  int      `json:"attachments_scanned"`
+	AttachmentsMigrated int      `json:"attachments_migrated"`
+	MissingFiles        int      `json:"missing_files"`
+	Errors              []string `json:"errors,omitempty"`
+}
+
+// MigrateToContentAddressed moves attachment files saved under per-upload paths
+// into content-addressed blobs and repoints their rows. cas must be a storage
+// created with storage.NewContentAddressedStorage over the same base path, so
+// legacy paths stay readable until each row is migrated.
+// The migration is idempotent: rows already pointing at a blob are skipped.
+func MigrateToContentAddressed(
+	ctx context.Context,
+	attachmentRepo repository.AttachmentRepository,
+	cas storage.FileStorage,
+	dryRun bool,
+	logger *slog.Logger,
+) (*StorageMigrationReport, error) {
+	report := &StorageMigrationReport{DryRun: dryRun}
+	const batchSize = 500
+
+	var lastID uint
+	for {
+		attachments, err := attachmentRepo.ListAfterID(ctx, lastID, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachments: %w", err)
+		}
+		if len(attachments) == 0 {
+			return report, nil
+		}
+
+		for _, attachment := range attachments {
+			lastID = attachment.ID
+			report.AttachmentsScanned++
+			if attachment.FilePath == "" || storage.IsBlobPath(attachment.FilePath) {
+				continue
+			}
+
+			err := migrateAttachmentFile(ctx, attachmentRepo, cas, attachment.ID, attachment.FilePath, dryRun)
+			switch {
+			case err == nil:
+				report.AttachmentsMigrated++
+			case errors.Is(err, storage.ErrFileNotFound):
+				report.MissingFiles++
+			default:
+				report.Errors = append(report.Errors, fmt.Sprintf("attachment %d: %v", attachment.ID, err))
+				logger.Error("failed to migrate attachment file",
+					slog.Uint64("attachment_id", uint64(attachment.ID)),
+					slog.String("path", attachment.FilePath),
+					slog.Any("error", err))
+			}
+		}
+
+		if len(attachments) < batchSize {
+			return report, nil
+		}
+	}
+}
+
+// migrateAttachmentFile copies one legacy file into a blob, repoints the row and removes the legacy file
+func migrateAttachmentFile(
+	ctx context.Context,
+	attachmentRepo repository.AttachmentRepository,
+	cas storage.FileStorage,
+	id uint,
+	legacyPath string,
+	dryRun bool,
+) error {
+	reader, err := cas.Get(legacyPath)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return reader.Close()
+	}
+
+	blobPath, err := cas.Save(legacyPath, reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := attachmentRepo.UpdateFilePath(ctx, id, blobPath); err != nil {
+		// Release the reference taken by Save, the row still points at the legacy file
+		_ = cas.Delete(blobPath)
+		return err
+	}
+
+	return cas.Delete(legacyPath)
+}
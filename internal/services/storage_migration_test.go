@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+func TestMigrateToContentAddressed(t *testing.T) {
+	f := newRetentionFixture(t, RetentionConfig{})
+	mailbox := f.createMailbox(t, "user", time.Now())
+
+	// Two legacy copies of the same file and one missing file
+	_, firstPath := f.createMessage(t, mailbox.ID, time.Now(), true)
+	_, secondPath := f.createMessage(t, mailbox.ID, time.Now(), true)
+	missing, _ := f.createMessage(t, mailbox.ID, time.Now(), false)
+	if err := f.db.Create(&models.Attachment{MessageID: missing.ID, Filename: "gone.pdf", FilePath: "ab/gone.pdf"}).Error; err != nil {
+		t.Fatalf("failed to create attachment: %v", err)
+	}
+
+	cas, err := storage.NewContentAddressedStorage(f.storageDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	attachmentRepo := repository.NewAttachmentRepository(f.db, cas)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Dry run changes nothing
+	report, err := MigrateToContentAddressed(context.Background(), attachmentRepo, cas, true, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.AttachmentsMigrated != 2 || report.MissingFiles != 1 {
+		t.Errorf("unexpected dry run report: %+v", report)
+	}
+	if !f.fileExists(firstPath) {
+		t.Error("expected dry run to keep legacy file")
+	}
+
+	report, err = MigrateToContentAddressed(context.Background(), attachmentRepo, cas, false, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.AttachmentsMigrated != 2 || len(report.Errors) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if f.fileExists(firstPath) || f.fileExists(secondPath) {
+		t.Error("expected legacy files to be removed")
+	}
+
+	var attachments []models.Attachment
+	f.db.Where("file_path <> ?", "ab/gone.pdf").Find(&attachments)
+	if len(attachments) != 2 || attachments[0].FilePath != attachments[1].FilePath || !storage.IsBlobPath(attachments[0].FilePath) {
+		t.Fatalf("expected both rows to share one blob, got %+v", attachments)
+	}
+
+	reader, err := cas.Get(attachments[0].FilePath)
+	if err != nil {
+		t.Fatalf("failed to read blob: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(content) != "attachment body" {
+		t.Errorf("unexpected blob content %q (err %v)", content, err)
+	}
+
+	// Running again is a no-op
+	report, err = MigrateToContentAddressed(context.Background(), attachmentRepo, cas, false, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.AttachmentsMigrated != 0 {
+		t.Errorf("expected second run to migrate nothing, got %+v", report)
+	}
+}
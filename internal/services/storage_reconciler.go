@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// ErrStorageNotWalkable is returned when the configured storage cannot enumerate its files
+var ErrStorageNotWalkable = errors.New("file storage does not support listing files")
+
+// maxReportedItems caps the number of paths and IDs listed in a reconcile report
+const maxReportedItems = 1000
+
+// ReconcileConfig holds configuration for the storage reconciler
+type ReconcileConfig struct {
+	// CheckInterval is how often the reconciliation runs (0 = only on demand)
+	CheckInterval time.Duration
+	// MinAge is the grace period before an unreferenced file counts as orphaned,
+	// so files written by an in-flight delivery are never collected
+	MinAge time.Duration
+	// DryRun reports inconsistencies without fixing them
+	DryRun bool
+	// BatchSize is the number of paths or rows checked per query
+	BatchSize int
+}
+
+// ReconcileReport summarizes a single storage reconciliation
+type ReconcileReport struct {
+	StartedAt            time.Time `json:"started_at"`
+	FinishedAt           time.Time `json:"finished_at"`
+	DryRun               bool      `json:"dry_run"`
+	FilesScanned         int       `json:"files_scanned"`
+	OrphanedFileCount    int       `json:"orphaned_file_count"`
+	OrphanedFiles        []string  `json:"orphaned_files"`
+	OrphanedFilesDeleted int       `json:"orphaned_files_deleted"`
+	AttachmentsScanned   int       `json:"attachments_scanned"`
+	MissingFileCount     int       `json:"missing_file_count"`
+	MissingFileIDs       []uint    `json:"missing_file_attachment_ids"`
+	MissingRowsDeleted   int       `json:"missing_rows_deleted"`
+	Errors               []string  `json:"errors,omitempty"`
+}
+
+// StorageReconcileRunner exposes storage reconciliation to the API layer
+type StorageReconcileRunner interface {
+	// LastReport returns the report of the most recent run, or nil if none ran yet
+	LastReport() *ReconcileReport
+	// RunOnce reconciles storage immediately and returns its report
+	RunOnce(ctx context.Context, dryRun bool) (*ReconcileReport, error)
+}
+
+// StorageReconciler finds stored files referenced by neither an attachment nor a
+// message raw source, and attachment rows whose file is gone, and removes them
+type StorageReconciler struct {
+	attachmentRepo repository.AttachmentRepository
+	messageRepo    repository.MessageRepository
+	fileStorage    storage.FileStorage
+	config         ReconcileConfig
+	logger         *slog.Logger
+	stopCh         chan struct{}
+	wg             sync.WaitGroup
+	running        bool
+	mu             sync.Mutex
+
+	// runMu serializes runs so a forced run never overlaps the scheduled one
+	runMu      sync.Mutex
+	lastReport *ReconcileReport
+	now        func() time.Time
+}
+
+// NewStorageReconciler creates a new storage reconciler
+func NewStorageReconciler(
+	attachmentRepo repository.AttachmentRepository,
+	messageRepo repository.MessageRepository,
+	fileStorage storage.FileStorage,
+	config ReconcileConfig,
+	logger *slog.Logger,
+) *StorageReconciler {
+	// Set defaults
+	if config.MinAge <= 0 {
+		config.MinAge = time.Hour
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+
+	return &StorageReconciler{
+		attachmentRepo: attachmentRepo,
+		messageRepo:    messageRepo,
+		fileStorage:    fileStorage,
+		config:         config,
+		logger:         logger,
+		stopCh:         make(chan struct{}),
+		now:            time.Now,
+	}
+}
+
+// Start begins the periodic reconciliation job.
+// Does nothing when no check interval is configured.
+func (r *StorageReconciler) Start() {
+	if r.config.CheckInterval <= 0 {
+		r.logger.Info("storage reconciler disabled, running on demand only")
+		return
+	}
+
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = true
+	r.stopCh = make(chan struct{})
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.reconcileLoop()
+
+	r.logger.Info("storage reconciler started",
+		slog.Duration("check_interval", r.config.CheckInterval),
+		slog.Duration("min_age", r.config.MinAge),
+		slog.Bool("dry_run", r.config.DryRun))
+}
+
+// Stop gracefully stops the periodic reconciliation job
+func (r *StorageReconciler) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	close(r.stopCh)
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	r.logger.Info("storage reconciler stopped")
+}
+
+// IsRunning returns whether the periodic job is currently running
+func (r *StorageReconciler) IsRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running
+}
+
+// LastReport returns the report of the most recent run
+func (r *StorageReconciler) LastReport() *ReconcileReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastReport
+}
+
+// reconcileLoop periodically runs the reconciliation
+func (r *StorageReconciler) reconcileLoop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			r.runScheduled()
+		}
+	}
+}
+
+// runScheduled runs a reconciliation with the configured dry-run setting
+func (r *StorageReconciler) runScheduled() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	if _, err := r.RunOnce(ctx, r.config.DryRun); err != nil {
+		r.logger.Error("storage reconciliation failed", slog.Any("error", err))
+	}
+}
+
+// RunOnce compares stored files against attachment rows in both directions.
+// When dryRun is true, inconsistencies are reported but nothing is deleted.
+func (r *StorageReconciler) RunOnce(ctx context.Context, dryRun bool) (*ReconcileReport, error) {
+	walker, ok := r.fileStorage.(storage.FileWalker)
+	if !ok {
+		return nil, ErrStorageNotWalkable
+	}
+
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	report := &ReconcileReport{
+		StartedAt:      r.now(),
+		DryRun:         dryRun,
+		OrphanedFiles:  []string{},
+		MissingFileIDs: []uint{},
+	}
+
+	if err := r.collectOrphanedFiles(ctx, walker, dryRun, report); err != nil {
+		return nil, err
+	}
+	if err := r.collectMissingFiles(ctx, dryRun, report); err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = r.now()
+
+	r.mu.Lock()
+	r.lastReport = report
+	r.mu.Unlock()
+
+	r.logger.Info("storage reconciliation completed",
+		slog.Bool("dry_run", dryRun),
+		slog.Int("files_scanned", report.FilesScanned),
+		slog.Int("orphaned_files", report.OrphanedFileCount),
+		slog.Int("orphaned_files_deleted", report.OrphanedFilesDeleted),
+		slog.Int("missing_files", report.MissingFileCount),
+		slog.Int("missing_rows_deleted", report.MissingRowsDeleted),
+		slog.Int("errors", len(report.Errors)))
+
+	return report, nil
+}
+
+// collectOrphanedFiles walks the storage and handles files no row references.
+// Orphans are purged when the storage counts references, since no row is left to release them.
+func (r *StorageReconciler) collectOrphanedFiles(ctx context.Context, walker storage.FileWalker, dryRun bool, report *ReconcileReport) error {
+	cutoff := r.now().Add(-r.config.MinAge)
+	batch := make([]string, 0, r.config.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		attached, err := r.attachmentRepo.ExistingFilePaths(ctx, batch)
+		if err != nil {
+			return err
+		}
+		raw, err := r.messageRepo.ExistingRawPaths(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for _, path := range batch {
+			if attached[path] || raw[path] {
+				continue
+			}
+			report.OrphanedFileCount++
+			if len(report.OrphanedFiles) < maxReportedItems {
+				report.OrphanedFiles = append(report.OrphanedFiles, path)
+			}
+			if dryRun {
+				continue
+			}
+			if err := r.removeOrphan(path); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete %s: %v", path, err))
+				continue
+			}
+			report.OrphanedFilesDeleted++
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := walker.Walk(func(info storage.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.FilesScanned++
+		if info.ModTime.After(cutoff) {
+			return nil
+		}
+		batch = append(batch, info.Path)
+		if len(batch) >= r.config.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan storage: %w", err)
+	}
+	return nil
+}
+
+// removeOrphan deletes an unreferenced file from storage
+func (r *StorageReconciler) removeOrphan(path string) error {
+	if purger, ok := r.fileStorage.(storage.Purger); ok {
+		return purger.Purge(path)
+	}
+	return r.fileStorage.Delete(path)
+}
+
+// collectMissingFiles pages through attachment rows and handles rows whose file is gone
+func (r *StorageReconciler) collectMissingFiles(ctx context.Context, dryRun bool, report *ReconcileReport) error {
+	var lastID uint
+	for {
+		attachments, err := r.attachmentRepo.ListAfterID(ctx, lastID, r.config.BatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to scan attachments: %w", err)
+		}
+		if len(attachments) == 0 {
+			return nil
+		}
+
+		for _, attachment := range attachments {
+			lastID = attachment.ID
+			report.AttachmentsScanned++
+			if attachment.FilePath == "" {
+				continue
+			}
+
+			reader, err := r.fileStorage.Get(attachment.FilePath)
+			if err == nil {
+				reader.Close()
+				continue
+			}
+			if !errors.Is(err, storage.ErrFileNotFound) {
+				report.Errors = append(report.Errors, fmt.Sprintf("check attachment %d: %v", attachment.ID, err))
+				continue
+			}
+
+			report.MissingFileCount++
+			if len(report.MissingFileIDs) < maxReportedItems {
+				report.MissingFileIDs = append(report.MissingFileIDs, attachment.ID)
+			}
+			if dryRun {
+				continue
+			}
+			if err := r.attachmentRepo.Delete(ctx, attachment.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete attachment %d: %v", attachment.ID, err))
+				continue
+			}
+			report.MissingRowsDeleted++
+		}
+
+		if len(attachments) < r.config.BatchSize {
+			return nil
+		}
+	}
+}
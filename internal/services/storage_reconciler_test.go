@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+)
+
+// reconcileFixture reuses the retention fixture database and storage for reconciler tests
+type reconcileFixture struct {
+	*retentionFixture
+	reconciler *StorageReconciler
+	message    *models.Message
+}
+
+func newReconcileFixture(t *testing.T, config ReconcileConfig) *reconcileFixture {
+	t.Helper()
+	base := newRetentionFixture(t, RetentionConfig{})
+	mailbox := base.createMailbox(t, "user", time.Now())
+	message, _ := base.createMessage(t, mailbox.ID, time.Now(), false)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	reconciler := NewStorageReconciler(
+		repository.NewAttachmentRepository(base.db, base.fileStorage),
+		repository.NewMessageRepository(base.db),
+		base.fileStorage,
+		config,
+		logger,
+	)
+	return &reconcileFixture{retentionFixture: base, reconciler: reconciler, message: message}
+}
+
+// saveFile stores a file and backdates it past the reconciler's grace period
+func (f *reconcileFixture) saveFile(t *testing.T, name string, age time.Duration) string {
+	t.Helper()
+	path, err := f.fileStorage.Save(name, strings.NewReader("content"))
+	if err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(f.storageDir, path), modTime, modTime); err != nil {
+		t.Fatalf("failed to backdate file: %v", err)
+	}
+	return path
+}
+
+func (f *reconcileFixture) createAttachment(t *testing.T, path string) *models.Attachment {
+	t.Helper()
+	attachment := &models.Attachment{MessageID: f.message.ID, Filename: "doc.pdf", FilePath: path}
+	if err := f.db.Create(attachment).Error; err != nil {
+		t.Fatalf("failed to create attachment: %v", err)
+	}
+	return attachment
+}
+
+func TestStorageReconciler_DeletesOrphanedFiles(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{MinAge: time.Hour, BatchSize: 1})
+
+	referenced := f.saveFile(t, "kept.pdf", 2*time.Hour)
+	f.createAttachment(t, referenced)
+	orphan := f.saveFile(t, "orphan.pdf", 2*time.Hour)
+	recent := f.saveFile(t, "recent.pdf", time.Minute)
+
+	report, err := f.reconciler.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.FilesScanned != 3 {
+		t.Errorf("expected 3 files scanned, got %d", report.FilesScanned)
+	}
+	if report.OrphanedFileCount != 1 || report.OrphanedFilesDeleted != 1 {
+		t.Errorf("expected 1 orphan found and deleted, got %+v", report)
+	}
+	if len(report.OrphanedFiles) != 1 || report.OrphanedFiles[0] != orphan {
+		t.Errorf("expected orphan %s to be reported, got %v", orphan, report.OrphanedFiles)
+	}
+	if f.fileExists(orphan) {
+		t.Error("expected orphaned file to be removed")
+	}
+	if !f.fileExists(referenced) {
+		t.Error("expected referenced file to be kept")
+	}
+	if !f.fileExists(recent) {
+		t.Error("expected file within the grace period to be kept")
+	}
+}
+
+func TestStorageReconciler_KeepsRawSources(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{})
+
+	rawPath := f.saveFile(t, "message.eml", 2*time.Hour)
+	if err := f.db.Model(f.message).Update("raw_path", rawPath).Error; err != nil {
+		t.Fatalf("failed to set raw path: %v", err)
+	}
+
+	report, err := f.reconciler.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.OrphanedFileCount != 0 {
+		t.Errorf("expected raw source not to be orphaned, got %v", report.OrphanedFiles)
+	}
+	if !f.fileExists(rawPath) {
+		t.Error("expected raw source to be kept")
+	}
+}
+
+func TestStorageReconciler_PurgesSharedOrphanBlobs(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{})
+	cas, err := storage.NewContentAddressedStorage(f.storageDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	f.reconciler.fileStorage = cas
+
+	// Two leaked references to a blob no row points at
+	path, _ := cas.Save("a.pdf", strings.NewReader("leaked"))
+	cas.Save("b.pdf", strings.NewReader("leaked"))
+	f.reconciler.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	report, err := f.reconciler.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.OrphanedFilesDeleted != 1 {
+		t.Errorf("expected 1 orphan deleted, got %+v", report)
+	}
+	if f.fileExists(path) {
+		t.Error("expected orphaned blob to be purged despite its references")
+	}
+}
+
+func TestStorageReconciler_KeepsReusedOrphanBlob(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{})
+	cas, err := storage.NewContentAddressedStorage(f.storageDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	f.reconciler.fileStorage = cas
+
+	// An old orphan blob that a new upload then deduplicates against
+	path, err := cas.Save("old.pdf", strings.NewReader("shared"))
+	if err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(f.storageDir, path), old, old); err != nil {
+		t.Fatalf("failed to backdate file: %v", err)
+	}
+	if _, err := cas.Save("new.pdf", strings.NewReader("shared")); err != nil {
+		t.Fatalf("failed to save file: %v", err)
+	}
+
+	// The reconciler runs before the new attachment row is inserted
+	report, err := f.reconciler.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.OrphanedFilesDeleted != 0 {
+		t.Errorf("expected the reused blob to be kept, got %+v", report)
+	}
+
+	f.createAttachment(t, path)
+	report, err = f.reconciler.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.MissingRowsDeleted != 0 || !f.fileExists(path) {
+		t.Errorf("expected the new attachment to keep its file, got %+v", report)
+	}
+}
+
+func TestStorageReconciler_DeletesRowsWithMissingFiles(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{BatchSize: 1})
+
+	present := f.createAttachment(t, f.saveFile(t, "present.pdf", 0))
+	missing := f.createAttachment(t, "ab/missing.pdf")
+
+	report, err := f.reconciler.RunOnce(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.AttachmentsScanned != 2 {
+		t.Errorf("expected 2 attachments scanned, got %d", report.AttachmentsScanned)
+	}
+	if report.MissingFileCount != 1 || report.MissingRowsDeleted != 1 {
+		t.Errorf("expected 1 missing file found and deleted, got %+v", report)
+	}
+	if len(report.MissingFileIDs) != 1 || report.MissingFileIDs[0] != missing.ID {
+		t.Errorf("expected attachment %d to be reported, got %v", missing.ID, report.MissingFileIDs)
+	}
+
+	var remaining []models.Attachment
+	f.db.Find(&remaining)
+	if len(remaining) != 1 || remaining[0].ID != present.ID {
+		t.Errorf("expected only the attachment with a file to remain, got %+v", remaining)
+	}
+}
+
+func TestStorageReconciler_DryRunDeletesNothing(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{})
+
+	orphan := f.saveFile(t, "orphan.pdf", 2*time.Hour)
+	f.createAttachment(t, "ab/missing.pdf")
+
+	report, err := f.reconciler.RunOnce(context.Background(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !report.DryRun {
+		t.Error("expected report to be marked as dry run")
+	}
+	if report.OrphanedFileCount != 1 || report.MissingFileCount != 1 {
+		t.Errorf("unexpected dry run counts: %+v", report)
+	}
+	if report.OrphanedFilesDeleted != 0 || report.MissingRowsDeleted != 0 {
+		t.Errorf("expected no deletions in dry run, got %+v", report)
+	}
+	if !f.fileExists(orphan) {
+		t.Error("expected orphaned file to be kept")
+	}
+	if n := f.count(&models.Attachment{}); n != 1 {
+		t.Errorf("expected attachment row to be kept, got %d", n)
+	}
+	if f.reconciler.LastReport() != report {
+		t.Error("expected last report to be recorded")
+	}
+}
+
+// unwalkableStorage is a FileStorage that cannot enumerate its files
+type unwalkableStorage struct{}
+
+func (unwalkableStorage) Save(string, io.Reader) (string, error) { return "", nil }
+func (unwalkableStorage) Get(string) (io.ReadCloser, error)      { return nil, storage.ErrFileNotFound }
+func (unwalkableStorage) Delete(string) error                    { return nil }
+
+func TestStorageReconciler_UnwalkableStorage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	reconciler := NewStorageReconciler(nil, nil, unwalkableStorage{}, ReconcileConfig{}, logger)
+
+	_, err := reconciler.RunOnce(context.Background(), true)
+	if !errors.Is(err, ErrStorageNotWalkable) {
+		t.Errorf("expected ErrStorageNotWalkable, got %v", err)
+	}
+}
+
+func TestStorageReconciler_StartDisabledWithoutInterval(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{})
+
+	f.reconciler.Start()
+	if f.reconciler.IsRunning() {
+		t.Error("expected reconciler without interval not to start")
+	}
+	f.reconciler.Stop()
+}
+
+func TestStorageReconciler_StartStop(t *testing.T) {
+	f := newReconcileFixture(t, ReconcileConfig{CheckInterval: time.Hour})
+
+	f.reconciler.Start()
+	if !f.reconciler.IsRunning() {
+		t.Error("expected reconciler to be running after Start")
+	}
+	f.reconciler.Stop()
+	if f.reconciler.IsRunning() {
+		t.Error("expected reconciler to be stopped after Stop")
+	}
+}
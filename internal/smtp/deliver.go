@@ -0,0 +1,126 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+)
+
+// Deliver stores a parsed email in a mailbox together with its raw source and
+// attachments, and notifies WebSocket subscribers. A zero receivedAt means now.
+// Every call saves its own copy of the raw source and attachments; a
+// content-addressed storage turns the copies into references to one blob.
+func (b *Backend) Deliver(ctx context.Context, mailbox *models.Mailbox, email *ParsedEmail, raw []byte, receivedAt time.Time) (*models.Message, error) {
+	message := &models.Message{
+		MailboxID:   mailbox.ID,
+		SenderEmail: email.SenderEmail,
+		SenderName:  email.SenderName,
+		Subject:     email.Subject,
+		Snippet:     email.Snippet,
+		BodyText:    email.BodyText,
+		BodyHTML:    email.BodyHTML,
+		IsRead:      false,
+		SizeBytes:   int64(len(raw)),
+		ReceivedAt:  receivedAt,
+	}
+
+	// Store raw source
+	var savedPaths []string
+	rawPath, err := b.fileStorage.Save("message.eml", bytes.NewReader(raw))
+	if err != nil {
+		if b.logger != nil {
+			b.logger.Error("failed to save raw message", slog.Any("error", err))
+		}
+	} else {
+		message.RawPath = rawPath
+		savedPaths = append(savedPaths, rawPath)
+	}
+
+	// Store attachments
+	var attachments []models.Attachment
+	for _, att := range email.Attachments {
+		// Rewind content already consumed by a previous recipient
+		if seeker, ok := att.Content.(io.Seeker); ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				continue
+			}
+		}
+
+		// Save file to storage
+		filePath, err := b.fileStorage.Save(att.Filename, att.Content)
+		if err != nil {
+			if b.logger != nil {
+				b.logger.Error("failed to save attachment",
+					slog.String("filename", att.Filename),
+					slog.Any("error", err))
+			}
+			continue
+		}
+		savedPaths = append(savedPaths, filePath)
+
+		attachment := models.Attachment{
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			FilePath:    filePath,
+			SizeBytes:   att.Size,
+			ContentID:   att.ContentID,
+			Inline:      att.Inline,
+		}
+		if len(att.Preview) > 0 {
+			previewPath, err := b.fileStorage.Save("preview.jpg", bytes.NewReader(att.Preview))
+			if err == nil {
+				attachment.PreviewPath = previewPath
+				attachment.HasPreview = true
+				savedPaths = append(savedPaths, previewPath)
+			} else if b.logger != nil {
+				b.logger.Warn("failed to save attachment preview",
+					slog.String("filename", att.Filename),
+					slog.Any("error", err))
+			}
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	// Create message with attachments
+	if err := b.messageRepo.CreateWithAttachments(ctx, message, attachments); err != nil {
+		// Release the stored files, no row references them
+		for _, path := range savedPaths {
+			_ = b.fileStorage.Delete(path)
+		}
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+
+	// Notify WebSocket subscribers
+	if b.wsHub != nil {
+		b.wsHub.BroadcastNewMessage(mailbox.ID, &websocket.NewMessagePayload{
+			ID:          message.ID,
+			SenderEmail: message.SenderEmail,
+			SenderName:  message.SenderName,
+			Subject:     message.Subject,
+			ReceivedAt:  message.ReceivedAt.Format(time.RFC3339),
+		})
+	}
+
+	return message, nil
+}
+
+// DeliverRaw parses a raw email and delivers it to a mailbox. When preserveDate
+// is set, the Date header becomes the received time if it is present.
+func (b *Backend) DeliverRaw(ctx context.Context, mailbox *models.Mailbox, raw []byte, preserveDate bool) (*models.Message, error) {
+	email, err := ParseEmail(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+
+	var receivedAt time.Time
+	if preserveDate {
+		receivedAt = email.Date
+	}
+	return b.Deliver(ctx, mailbox, email, raw, receivedAt)
+}
@@ -3,10 +3,13 @@ package smtp
 import (
 	"bytes"
 	"io"
+	"mime"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/jhillyerd/enmime"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/thumbnail"
 )
 
 // ParsedEmail represents a parsed email message
@@ -17,6 +20,8 @@ type ParsedEmail struct {
 	Snippet     string
 	BodyText    string
 	BodyHTML    string
+	// Date is the Date header, zero when it is missing or malformed
+	Date        time.Time
 	Attachments []ParsedAttachment
 }
 
@@ -26,6 +31,12 @@ type ParsedAttachment struct {
 	ContentType string
 	Content     io.Reader
 	Size        int64
+	// ContentID is the Content-ID without angle brackets, referenced by cid: URLs in the HTML body
+	ContentID string
+	// Inline is true for parts meant to be displayed within the body rather than downloaded
+	Inline bool
+	// Preview is a JPEG thumbnail for image attachments, nil when none could be generated
+	Preview []byte
 }
 
 // ParseEmail parses an email from an io.Reader
@@ -45,34 +56,75 @@ func ParseEmail(r io.Reader) (*ParsedEmail, error) {
 	fromHeader := env.GetHeader("From")
 	parsed.SenderName, parsed.SenderEmail = parseFromHeader(fromHeader)
 
+	if date, err := env.Date(); err == nil {
+		parsed.Date = date
+	}
+
 	// Generate snippet
 	parsed.Snippet = generateSnippet(parsed.BodyText, parsed.BodyHTML)
 
 	// Parse attachments
 	for _, att := range env.Attachments {
-		parsed.Attachments = append(parsed.Attachments, ParsedAttachment{
-			Filename:    att.FileName,
-			ContentType: att.ContentType,
-			Content:     bytes.NewReader(att.Content),
-			Size:        int64(len(att.Content)),
-		})
+		parsed.Attachments = append(parsed.Attachments, newParsedAttachment(att, false))
 	}
 
-	// Also include inline attachments
+	// Also include inline parts, which often have no filename but are
+	// referenced from the HTML body by Content-ID
 	for _, att := range env.Inlines {
-		if att.FileName != "" {
-			parsed.Attachments = append(parsed.Attachments, ParsedAttachment{
-				Filename:    att.FileName,
-				ContentType: att.ContentType,
-				Content:     bytes.NewReader(att.Content),
-				Size:        int64(len(att.Content)),
-			})
+		parsed.Attachments = append(parsed.Attachments, newParsedAttachment(att, true))
+	}
+
+	// Parts of multipart/related bodies may carry a Content-ID without any disposition
+	for _, att := range env.OtherParts {
+		if att.ContentID != "" {
+			parsed.Attachments = append(parsed.Attachments, newParsedAttachment(att, true))
 		}
 	}
 
 	return parsed, nil
 }
 
+// newParsedAttachment wraps decoded attachment content, rendering a preview for images.
+// Previews are generated once per email and shared by all recipients.
+func newParsedAttachment(part *enmime.Part, inline bool) ParsedAttachment {
+	att := ParsedAttachment{
+		Filename:    part.FileName,
+		ContentType: part.ContentType,
+		Content:     bytes.NewReader(part.Content),
+		Size:        int64(len(part.Content)),
+		ContentID:   part.ContentID,
+		Inline:      inline,
+	}
+	if att.Filename == "" {
+		att.Filename = inlineFilename(part.ContentType)
+	}
+	if thumbnail.Supported(part.ContentType) {
+		// Images that fail to decode are stored without a preview
+		att.Preview, _ = thumbnail.Generate(bytes.NewReader(part.Content), thumbnail.MaxSize)
+	}
+	return att
+}
+
+// inlineExtensions are the preferred extensions of common inline content types;
+// mime.ExtensionsByType sorts alphabetically and would name JPEGs ".jfif"
+var inlineExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// inlineFilename names an inline part that has no filename after its content type
+func inlineFilename(contentType string) string {
+	if ext, ok := inlineExtensions[strings.ToLower(contentType)]; ok {
+		return "inline" + ext
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return "inline" + exts[0]
+	}
+	return "inline"
+}
+
 // parseFromHeader extracts name and email from a From header
 func parseFromHeader(from string) (name, email string) {
 	from = strings.TrimSpace(from)
@@ -1,6 +1,11 @@
 package smtp
 
 import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"os"
 	"path/filepath"
@@ -458,3 +463,76 @@ Content-Disposition: attachment; filename="test.txt"
 	require.Len(t, parsed.Attachments, 1)
 	assert.Greater(t, parsed.Attachments[0].Size, int64(0))
 }
+
+// TestParseEmail_ImageAttachmentPreview tests that image attachments get a preview
+func TestParseEmail_ImageAttachmentPreview(t *testing.T) {
+	// Arrange
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1024, 768))))
+	emailContent := "From: sender@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"photo.png\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(img.Bytes()) + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"broken.png\"\r\n" +
+		"\r\n" +
+		"not a png\r\n" +
+		"--b--\r\n"
+
+	// Act
+	parsed, err := ParseEmail(strings.NewReader(emailContent))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 2)
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(parsed.Attachments[0].Preview))
+	require.NoError(t, err)
+	assert.Equal(t, 512, cfg.Width)
+	assert.Equal(t, 384, cfg.Height)
+	assert.Nil(t, parsed.Attachments[1].Preview)
+}
+
+// TestParseEmail_InlineContentIDs tests that inline parts are kept with their Content-ID
+func TestParseEmail_InlineContentIDs(t *testing.T) {
+	// Arrange
+	emailContent := "From: sender@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/related; boundary=\"r\"\r\n" +
+		"\r\n" +
+		"--r\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<p><img src=\"cid:logo@example.com\"><img src=\"cid:banner\"></p>\r\n" +
+		"--r\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"Content-ID: <logo@example.com>\r\n" +
+		"\r\n" +
+		"logo\r\n" +
+		"--r\r\n" +
+		"Content-Type: image/jpeg\r\n" +
+		"Content-ID: <banner>\r\n" +
+		"\r\n" +
+		"banner\r\n" +
+		"--r--\r\n"
+
+	// Act
+	parsed, err := ParseEmail(strings.NewReader(emailContent))
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 2)
+	assert.Equal(t, "logo@example.com", parsed.Attachments[0].ContentID)
+	assert.Equal(t, "inline.png", parsed.Attachments[0].Filename)
+	assert.True(t, parsed.Attachments[0].Inline)
+	assert.Equal(t, "banner", parsed.Attachments[1].ContentID)
+	assert.Equal(t, "inline.jpg", parsed.Attachments[1].Filename)
+	assert.True(t, parsed.Attachments[1].Inline)
+}
@@ -1,6 +1,7 @@
 package smtp
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -10,9 +11,7 @@ import (
 	"time"
 
 	"github.com/emersion/go-smtp"
-	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
-	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
 )
 
 // Session implements the go-smtp Session interface
@@ -119,8 +118,21 @@ func (s *Session) Data(r io.Reader) error {
 		}
 	}
 
+	// Keep the raw source so it can be stored alongside the parsed message
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		if s.backend.logger != nil {
+			s.backend.logger.Error("failed to read email", slog.Any("error", err))
+		}
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+			Message:      "Failed to read message",
+		}
+	}
+
 	// Parse the email
-	parsedEmail, err := ParseEmail(r)
+	parsedEmail, err := ParseEmail(bytes.NewReader(raw))
 	if err != nil {
 		if s.backend.logger != nil {
 			s.backend.logger.Error("failed to parse email", slog.Any("error", err))
@@ -141,7 +153,7 @@ func (s *Session) Data(r io.Reader) error {
 
 	// Process for each recipient
 	for _, recipient := range s.recipients {
-		if err := s.processEmail(ctx, recipient, parsedEmail); err != nil {
+		if err := s.processEmail(ctx, recipient, parsedEmail, raw); err != nil {
 			if s.backend.logger != nil {
 				s.backend.logger.Error("failed to process email",
 					slog.String("recipient", recipient),
@@ -161,8 +173,8 @@ func (s *Session) Data(r io.Reader) error {
 	return nil
 }
 
-// processEmail stores the email for a single recipient
-func (s *Session) processEmail(ctx context.Context, recipient string, email *ParsedEmail) error {
+// processEmail resolves the mailbox of a single recipient and delivers the email to it
+func (s *Session) processEmail(ctx context.Context, recipient string, email *ParsedEmail, raw []byte) error {
 	localPart, domainName, err := parseEmailAddress(recipient)
 	if err != nil {
 		return err
@@ -184,57 +196,8 @@ func (s *Session) processEmail(ctx context.Context, recipient string, email *Par
 		s.backend.logger.Info("auto-provisioned mailbox", slog.String("address", mailbox.FullAddress))
 	}
 
-	// Create message
-	message := &models.Message{
-		MailboxID:   mailbox.ID,
-		SenderEmail: email.SenderEmail,
-		SenderName:  email.SenderName,
-		Subject:     email.Subject,
-		Snippet:     email.Snippet,
-		BodyText:    email.BodyText,
-		BodyHTML:    email.BodyHTML,
-		IsRead:      false,
-	}
-
-	// Store attachments
-	var attachments []models.Attachment
-	for _, att := range email.Attachments {
-		// Save file to storage
-		filePath, err := s.backend.fileStorage.Save(att.Filename, att.Content)
-		if err != nil {
-			if s.backend.logger != nil {
-				s.backend.logger.Error("failed to save attachment",
-					slog.String("filename", att.Filename),
-					slog.Any("error", err))
-			}
-			continue
-		}
-
-		attachments = append(attachments, models.Attachment{
-			Filename:    att.Filename,
-			ContentType: att.ContentType,
-			FilePath:    filePath,
-			SizeBytes:   att.Size,
-		})
-	}
-
-	// Create message with attachments
-	if err := s.backend.messageRepo.CreateWithAttachments(ctx, message, attachments); err != nil {
-		return fmt.Errorf("failed to create message: %w", err)
-	}
-
-	// Notify WebSocket subscribers
-	if s.backend.wsHub != nil {
-		s.backend.wsHub.BroadcastNewMessage(mailbox.ID, &websocket.NewMessagePayload{
-			ID:          message.ID,
-			SenderEmail: message.SenderEmail,
-			SenderName:  message.SenderName,
-			Subject:     message.Subject,
-			ReceivedAt:  message.ReceivedAt.Format(time.RFC3339),
-		})
-	}
-
-	return nil
+	_, err = s.backend.Deliver(ctx, mailbox, email, raw, time.Time{})
+	return err
 }
 
 // Reset resets the session state
@@ -0,0 +1,181 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/storage"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestSession creates a session backed by an in-memory database and content-addressed storage
+func newTestSession(t *testing.T) (*Session, *gorm.DB, storage.FileStorage) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Domain{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{}))
+	require.NoError(t, db.Create(&models.Domain{Name: "test.com", IsActive: true}).Error)
+
+	fileStorage, err := storage.NewContentAddressedStorage(t.TempDir())
+	require.NoError(t, err)
+
+	backend := NewBackend(&BackendConfig{
+		DomainRepo:     repository.NewDomainRepository(db),
+		MailboxRepo:    repository.NewMailboxRepository(db),
+		MessageRepo:    repository.NewMessageRepository(db),
+		AttachmentRepo: repository.NewAttachmentRepository(db, fileStorage),
+		FileStorage:    fileStorage,
+		AutoProvision:  true,
+	})
+	return NewSession(backend), db, fileStorage
+}
+
+const multipartEmail = "From: sender@example.com\r\n" +
+	"Subject: Newsletter\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hello\r\n" +
+	"--b\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"doc.pdf\"\r\n" +
+	"\r\n" +
+	"pdf bytes\r\n" +
+	"--b--\r\n"
+
+func TestSessionData_MultipleRecipientsShareBlobs(t *testing.T) {
+	session, db, fileStorage := newTestSession(t)
+	require.NoError(t, session.Rcpt("alice@test.com", nil))
+	require.NoError(t, session.Rcpt("bob@test.com", nil))
+
+	require.NoError(t, session.Data(strings.NewReader(multipartEmail)))
+
+	var messages []models.Message
+	require.NoError(t, db.Find(&messages).Error)
+	require.Len(t, messages, 2)
+	assert.NotEmpty(t, messages[0].RawPath)
+	assert.Equal(t, messages[0].RawPath, messages[1].RawPath)
+
+	var attachments []models.Attachment
+	require.NoError(t, db.Find(&attachments).Error)
+	require.Len(t, attachments, 2)
+	assert.Equal(t, attachments[0].FilePath, attachments[1].FilePath)
+
+	// Both recipients get the full attachment, not a drained reader
+	for _, att := range attachments {
+		assert.Equal(t, int64(len("pdf bytes")), att.SizeBytes)
+	}
+	reader, err := fileStorage.Get(attachments[1].FilePath)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "pdf bytes", strings.TrimSpace(string(content)))
+
+	reader, err = fileStorage.Get(messages[0].RawPath)
+	require.NoError(t, err)
+	raw, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, multipartEmail, string(raw))
+}
+
+func TestSessionData_StoresImagePreview(t *testing.T) {
+	session, db, fileStorage := newTestSession(t)
+	require.NoError(t, session.Rcpt("alice@test.com", nil))
+
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 64, 64))))
+	email := "From: sender@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"photo.png\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(img.Bytes()) + "\r\n" +
+		"--b--\r\n"
+
+	require.NoError(t, session.Data(strings.NewReader(email)))
+
+	var attachment models.Attachment
+	require.NoError(t, db.First(&attachment).Error)
+	assert.True(t, attachment.HasPreview)
+	require.NotEmpty(t, attachment.PreviewPath)
+
+	reader, err := fileStorage.Get(attachment.PreviewPath)
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = jpeg.DecodeConfig(reader)
+	assert.NoError(t, err)
+}
+
+func TestSessionData_StoresInlineContentID(t *testing.T) {
+	session, db, _ := newTestSession(t)
+	require.NoError(t, session.Rcpt("alice@test.com", nil))
+
+	email := "From: sender@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/related; boundary=\"r\"\r\n" +
+		"\r\n" +
+		"--r\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<img src=\"cid:logo@example.com\">\r\n" +
+		"--r\r\n" +
+		"Content-Type: image/gif\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"Content-ID: <logo@example.com>\r\n" +
+		"\r\n" +
+		"gif bytes\r\n" +
+		"--r--\r\n"
+
+	require.NoError(t, session.Data(strings.NewReader(email)))
+
+	var attachment models.Attachment
+	require.NoError(t, db.First(&attachment).Error)
+	assert.Equal(t, "logo@example.com", attachment.ContentID)
+	assert.True(t, attachment.Inline)
+	assert.Equal(t, "inline.gif", attachment.Filename)
+}
+
+func TestBackendDeliverRaw_PreservesDate(t *testing.T) {
+	session, db, _ := newTestSession(t)
+	mailbox := &models.Mailbox{LocalPart: "import", DomainID: 1, FullAddress: "import@test.com"}
+	require.NoError(t, db.Create(mailbox).Error)
+	raw := []byte("From: sender@example.com\r\nDate: Tue, 05 Mar 2024 08:30:00 +0000\r\nSubject: Old\r\n\r\nHello\r\n")
+
+	preserved, err := session.backend.DeliverRaw(context.Background(), mailbox, raw, true)
+	require.NoError(t, err)
+	current, err := session.backend.DeliverRaw(context.Background(), mailbox, raw, false)
+	require.NoError(t, err)
+
+	var stored models.Message
+	require.NoError(t, db.First(&stored, preserved.ID).Error)
+	assert.True(t, stored.ReceivedAt.Equal(time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)))
+	assert.Equal(t, "Old", stored.Subject)
+	assert.NotEmpty(t, stored.RawPath)
+	assert.WithinDuration(t, time.Now(), current.ReceivedAt, time.Minute)
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIntegrityMismatch is returned while reading a blob whose content no longer matches its hash
+var ErrIntegrityMismatch = errors.New("stored file failed integrity check")
+
+const (
+	// blobDir holds content-addressed blobs, relative to the storage base path
+	blobDir = "blobs"
+	// tempDir holds partially written uploads before they are moved into blobDir
+	tempDir = "tmp"
+	// refSuffix is appended to a blob path to name its reference count file
+	refSuffix = ".ref"
+)
+
+// Purger is implemented by storages whose Delete only drops a reference.
+// Purge removes the stored file regardless of how many references remain.
+type Purger interface {
+	Purge(filePath string) error
+}
+
+// contentAddressedStorage stores files by the SHA-256 of their content so
+// identical files share one blob. Every Save adds a reference and every Delete
+// drops one; the blob is removed when the last reference is gone.
+// Paths that are not under blobs/ are legacy per-upload files and are served
+// by the wrapped localStorage unchanged.
+type contentAddressedStorage struct {
+	legacy *localStorage
+	// mu guards reference count updates; counts are only safe within one process
+	mu sync.Mutex
+}
+
+// NewContentAddressedStorage creates a deduplicating FileStorage rooted at basePath
+func NewContentAddressedStorage(basePath string) (FileStorage, error) {
+	for _, dir := range []string{basePath, filepath.Join(basePath, blobDir), filepath.Join(basePath, tempDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+	return &contentAddressedStorage{legacy: &localStorage{basePath: basePath}}, nil
+}
+
+// IsBlobPath reports whether a stored path refers to a content-addressed blob
+func IsBlobPath(filePath string) bool {
+	return strings.HasPrefix(filepath.ToSlash(filePath), blobDir+"/")
+}
+
+// blobPathFor returns the relative blob path for a hex SHA-256 digest
+func blobPathFor(digest string) string {
+	return blobDir + "/" + digest[:2] + "/" + digest
+}
+
+// Save stores content under its SHA-256 digest and returns the blob path.
+// The filename is ignored: identical content always maps to the same blob.
+func (s *contentAddressedStorage) Save(filename string, content io.Reader) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.legacy.basePath, tempDir), "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), content); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	blobPath := blobPathFor(hex.EncodeToString(hasher.Sum(nil)))
+	fullPath := filepath.Join(s.legacy.basePath, filepath.FromSlash(blobPath))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs, err := s.readRefs(fullPath)
+	if err != nil {
+		return "", err
+	}
+	// Also restores a blob whose file went missing while its count survived
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create subdirectory: %w", err)
+		}
+		if err := os.Rename(tmpPath, fullPath); err != nil {
+			return "", fmt.Errorf("failed to store file: %w", err)
+		}
+	} else {
+		// A reused blob may be an old orphan; touching it keeps the storage
+		// reconciler's grace period from purging it before its row is saved
+		now := time.Now()
+		if err := os.Chtimes(fullPath, now, now); err != nil {
+			return "", fmt.Errorf("failed to touch file: %w", err)
+		}
+	}
+	if err := s.writeRefs(fullPath, refs+1); err != nil {
+		return "", err
+	}
+
+	return blobPath, nil
+}
+
+// Get opens a stored file. Blob reads are verified against the blob's digest:
+// the final Read returns ErrIntegrityMismatch if the content was altered.
+func (s *contentAddressedStorage) Get(filePath string) (io.ReadCloser, error) {
+	if !IsBlobPath(filePath) {
+		return s.legacy.Get(filePath)
+	}
+
+	file, err := s.legacy.Get(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{
+		file:     file,
+		hasher:   sha256.New(),
+		expected: filepath.Base(filePath),
+	}, nil
+}
+
+// Delete drops one reference to a blob and removes it once no references remain.
+// Legacy files are removed immediately.
+func (s *contentAddressedStorage) Delete(filePath string) error {
+	if !IsBlobPath(filePath) {
+		return s.legacy.Delete(filePath)
+	}
+
+	fullPath, err := s.legacy.validatePath(filePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refs, err := s.readRefs(fullPath)
+	if err != nil {
+		return err
+	}
+	if refs > 1 {
+		return s.writeRefs(fullPath, refs-1)
+	}
+	return s.removeBlob(fullPath)
+}
+
+// Purge removes a blob and its reference count regardless of remaining references
+func (s *contentAddressedStorage) Purge(filePath string) error {
+	if !IsBlobPath(filePath) {
+		return s.legacy.Delete(filePath)
+	}
+
+	fullPath, err := s.legacy.validatePath(filePath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeBlob(fullPath)
+}
+
+// Walk enumerates blobs and legacy files, skipping reference counts and in-flight uploads
+func (s *contentAddressedStorage) Walk(fn func(info FileInfo) error) error {
+	return s.legacy.Walk(func(info FileInfo) error {
+		if strings.HasPrefix(info.Path, tempDir+"/") {
+			return nil
+		}
+		if IsBlobPath(info.Path) && strings.HasSuffix(info.Path, refSuffix) {
+			return nil
+		}
+		return fn(info)
+	})
+}
+
+// readRefs returns the reference count of a blob, or 0 if the blob does not exist.
+// A blob without a count file is treated as having a single reference.
+func (s *contentAddressedStorage) readRefs(fullPath string) (int, error) {
+	data, err := os.ReadFile(fullPath + refSuffix)
+	if err == nil {
+		refs, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("invalid reference count for %s: %w", filepath.Base(fullPath), err)
+		}
+		return refs, nil
+	}
+	if !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read reference count: %w", err)
+	}
+
+	if _, err := os.Stat(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return 1, nil
+}
+
+// writeRefs atomically replaces the reference count of a blob
+func (s *contentAddressedStorage) writeRefs(fullPath string, refs int) error {
+	tmpPath := fullPath + refSuffix + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.Itoa(refs)), 0644); err != nil {
+		return fmt.Errorf("failed to write reference count: %w", err)
+	}
+	if err := os.Rename(tmpPath, fullPath+refSuffix); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write reference count: %w", err)
+	}
+	return nil
+}
+
+// removeBlob deletes a blob and its reference count file
+func (s *contentAddressedStorage) removeBlob(fullPath string) error {
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if err := os.Remove(fullPath + refSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete reference count: %w", err)
+	}
+	return nil
+}
+
+// verifyingReader hashes a blob while it is read and checks the digest at EOF
+type verifyingReader struct {
+	file     io.ReadCloser
+	hasher   hash.Hash
+	expected string
+}
+
+// Read implements io.Reader
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.hasher.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.hasher.Sum(nil)) != r.expected {
+		return n, ErrIntegrityMismatch
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *verifyingReader) Close() error {
+	return r.file.Close()
+}
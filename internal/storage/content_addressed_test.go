@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCAS(t *testing.T) (FileStorage, string) {
+	t.Helper()
+	baseDir := t.TempDir()
+	cas, err := NewContentAddressedStorage(baseDir)
+	require.NoError(t, err)
+	return cas, baseDir
+}
+
+func TestCAS_IdenticalContentSharesBlob(t *testing.T) {
+	cas, baseDir := newTestCAS(t)
+
+	first, err := cas.Save("logo.png", strings.NewReader("same bytes"))
+	require.NoError(t, err)
+	second, err := cas.Save("other-name.png", strings.NewReader("same bytes"))
+	require.NoError(t, err)
+	different, err := cas.Save("logo.png", strings.NewReader("other bytes"))
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, different)
+	assert.True(t, IsBlobPath(first))
+
+	refs, err := os.ReadFile(filepath.Join(baseDir, first+refSuffix))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(refs))
+}
+
+func TestCAS_DeleteRemovesBlobAfterLastReference(t *testing.T) {
+	cas, baseDir := newTestCAS(t)
+
+	path, err := cas.Save("a.pdf", strings.NewReader("shared"))
+	require.NoError(t, err)
+	_, err = cas.Save("b.pdf", strings.NewReader("shared"))
+	require.NoError(t, err)
+	fullPath := filepath.Join(baseDir, path)
+
+	require.NoError(t, cas.Delete(path))
+	assert.FileExists(t, fullPath, "blob must survive while referenced")
+
+	require.NoError(t, cas.Delete(path))
+	assert.NoFileExists(t, fullPath)
+	assert.NoFileExists(t, fullPath+refSuffix)
+
+	// Deleting an already removed blob is not an error
+	assert.NoError(t, cas.Delete(path))
+}
+
+func TestCAS_GetVerifiesIntegrity(t *testing.T) {
+	cas, baseDir := newTestCAS(t)
+
+	path, err := cas.Save("doc.txt", strings.NewReader("original content"))
+	require.NoError(t, err)
+
+	reader, err := cas.Get(path)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "original content", string(content))
+
+	// Tamper with the blob on disk
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, path), []byte("tampered content"), 0644))
+
+	reader, err = cas.Get(path)
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	reader.Close()
+	assert.ErrorIs(t, err, ErrIntegrityMismatch)
+}
+
+func TestCAS_LegacyPathsStillReadable(t *testing.T) {
+	baseDir := t.TempDir()
+	legacy, err := NewLocalStorage(baseDir)
+	require.NoError(t, err)
+	legacyPath, err := legacy.Save("old.pdf", strings.NewReader("legacy content"))
+	require.NoError(t, err)
+
+	cas, err := NewContentAddressedStorage(baseDir)
+	require.NoError(t, err)
+
+	reader, err := cas.Get(legacyPath)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "legacy content", string(content))
+
+	require.NoError(t, cas.Delete(legacyPath))
+	assert.NoFileExists(t, filepath.Join(baseDir, legacyPath))
+}
+
+func TestCAS_PurgeIgnoresReferences(t *testing.T) {
+	cas, baseDir := newTestCAS(t)
+
+	path, err := cas.Save("a.pdf", strings.NewReader("shared"))
+	require.NoError(t, err)
+	_, err = cas.Save("b.pdf", strings.NewReader("shared"))
+	require.NoError(t, err)
+
+	require.NoError(t, cas.(Purger).Purge(path))
+	assert.NoFileExists(t, filepath.Join(baseDir, path))
+}
+
+func TestCAS_WalkSkipsReferenceCounts(t *testing.T) {
+	cas, _ := newTestCAS(t)
+
+	path, err := cas.Save("a.pdf", strings.NewReader("walk me"))
+	require.NoError(t, err)
+
+	var seen []string
+	err = cas.(FileWalker).Walk(func(info FileInfo) error {
+		seen = append(seen, info.Path)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, seen)
+}
+
+func TestCAS_PathTraversal(t *testing.T) {
+	cas, _ := newTestCAS(t)
+
+	_, err := cas.Get("blobs/../../etc/passwd")
+	assert.ErrorIs(t, err, ErrPathTraversal)
+	assert.ErrorIs(t, cas.Delete("blobs/../../etc/passwd"), ErrPathTraversal)
+}
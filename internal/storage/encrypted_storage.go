@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+)
+
+// ErrDataKeyNotFound is returned by a DataKeyStore when a file has no data key
+var ErrDataKeyNotFound = errors.New("data key not found")
+
+// DataKeyStore persists the wrapped data keys of encrypted files, keyed by stored path
+type DataKeyStore interface {
+	SaveDataKey(ctx context.Context, filePath, masterKeyID string, wrappedKey []byte) error
+	GetDataKey(ctx context.Context, filePath string) (masterKeyID string, wrappedKey []byte, err error)
+	DeleteDataKey(ctx context.Context, filePath string) error
+}
+
+// encryptedStorage encrypts files with a per-file data key before handing them
+// to the wrapped storage. Wrapped data keys are kept in a DataKeyStore rather
+// than in the file, so master key rotation only updates key rows.
+//
+// Files without a data key were stored before encryption was enabled and are
+// served unchanged. Encrypted files are never served through signed URLs, since
+// the object store only holds ciphertext.
+type encryptedStorage struct {
+	inner   FileStorage
+	keyring *encryption.Keyring
+	keys    DataKeyStore
+}
+
+// NewEncryptedStorage wraps inner so file contents are encrypted at rest.
+// Note that each file gets its own data key, so a content-addressed inner
+// storage no longer deduplicates new files.
+func NewEncryptedStorage(inner FileStorage, keyring *encryption.Keyring, keys DataKeyStore) FileStorage {
+	return &encryptedStorage{inner: inner, keyring: keyring, keys: keys}
+}
+
+// Save encrypts content and stores it, then records the wrapped data key
+func (s *encryptedStorage) Save(filename string, content io.Reader) (string, error) {
+	dataKey, err := s.keyring.NewDataKey()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encryption.NewEncryptReader(dataKey, content)
+	if err != nil {
+		return "", err
+	}
+
+	filePath, err := s.inner.Save(filename, encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	keyID, wrapped, err := s.keyring.WrapKey(dataKey, []byte(filePath))
+	if err == nil {
+		err = s.keys.SaveDataKey(context.Background(), filePath, keyID, wrapped)
+	}
+	if err != nil {
+		// Without its key the file is unreadable
+		_ = s.inner.Delete(filePath)
+		return "", fmt.Errorf("failed to store data key: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// Get returns a reader that decrypts the stored file
+func (s *encryptedStorage) Get(filePath string) (io.ReadCloser, error) {
+	keyID, wrapped, err := s.keys.GetDataKey(context.Background(), filePath)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return s.inner.Get(filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key: %w", err)
+	}
+
+	dataKey, err := s.keyring.UnwrapKey(keyID, wrapped, []byte(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.inner.Get(filePath)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := encryption.NewDecryptReader(dataKey, reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return &decryptingReadCloser{Reader: decrypted, closer: reader}, nil
+}
+
+// Delete removes the stored file and its data key
+func (s *encryptedStorage) Delete(filePath string) error {
+	if err := s.inner.Delete(filePath); err != nil {
+		return err
+	}
+	return s.keys.DeleteDataKey(context.Background(), filePath)
+}
+
+// Purge removes the stored file regardless of remaining references, and its data key
+func (s *encryptedStorage) Purge(filePath string) error {
+	purger, ok := s.inner.(Purger)
+	if !ok {
+		return s.Delete(filePath)
+	}
+	if err := purger.Purge(filePath); err != nil {
+		return err
+	}
+	return s.keys.DeleteDataKey(context.Background(), filePath)
+}
+
+// Walk enumerates the files of the wrapped storage
+func (s *encryptedStorage) Walk(fn func(info FileInfo) error) error {
+	walker, ok := s.inner.(FileWalker)
+	if !ok {
+		return fmt.Errorf("storage %T cannot enumerate files", s.inner)
+	}
+	return walker.Walk(fn)
+}
+
+// decryptingReadCloser closes the underlying stored file once decryption is done
+type decryptingReadCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *decryptingReadCloser) Close() error {
+	return r.closer.Close()
+}
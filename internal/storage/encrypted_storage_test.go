@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/encryption"
+)
+
+// memDataKey is a wrapped data key held by memDataKeyStore
+type memDataKey struct {
+	masterKeyID string
+	wrappedKey  []byte
+}
+
+// memDataKeyStore is an in-memory DataKeyStore
+type memDataKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]memDataKey
+}
+
+func newMemDataKeyStore() *memDataKeyStore {
+	return &memDataKeyStore{keys: make(map[string]memDataKey)}
+}
+
+func (m *memDataKeyStore) SaveDataKey(ctx context.Context, filePath, masterKeyID string, wrappedKey []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[filePath] = memDataKey{masterKeyID: masterKeyID, wrappedKey: wrappedKey}
+	return nil
+}
+
+func (m *memDataKeyStore) GetDataKey(ctx context.Context, filePath string) (string, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[filePath]
+	if !ok {
+		return "", nil, ErrDataKeyNotFound
+	}
+	return key.masterKeyID, key.wrappedKey, nil
+}
+
+func (m *memDataKeyStore) DeleteDataKey(ctx context.Context, filePath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, filePath)
+	return nil
+}
+
+func newTestEncryptedStorage(t *testing.T) (FileStorage, FileStorage, *memDataKeyStore, string) {
+	t.Helper()
+	inner, baseDir := newTestCAS(t)
+	keyring, err := encryption.NewKeyring(bytes.Repeat([]byte{9}, encryption.KeySize))
+	require.NoError(t, err)
+	keys := newMemDataKeyStore()
+	return NewEncryptedStorage(inner, keyring, keys), inner, keys, baseDir
+}
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	store, _, keys, baseDir := newTestEncryptedStorage(t)
+	content := strings.Repeat("passport number 12345\n", 10000)
+
+	path, err := store.Save("scan.pdf", strings.NewReader(content))
+	require.NoError(t, err)
+
+	onDisk, err := os.ReadFile(filepath.Join(baseDir, path))
+	require.NoError(t, err)
+	assert.NotContains(t, string(onDisk), "passport")
+	assert.Contains(t, keys.keys, path)
+
+	reader, err := store.Get(path)
+	require.NoError(t, err)
+	decrypted, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, content, string(decrypted))
+}
+
+func TestEncryptedStorage_IdenticalContentIsNotShared(t *testing.T) {
+	store, _, _, _ := newTestEncryptedStorage(t)
+
+	first, err := store.Save("a.txt", strings.NewReader("same"))
+	require.NoError(t, err)
+	second, err := store.Save("b.txt", strings.NewReader("same"))
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+}
+
+func TestEncryptedStorage_ReadsPlaintextFilesWithoutKey(t *testing.T) {
+	store, inner, _, _ := newTestEncryptedStorage(t)
+
+	path, err := inner.Save("old.txt", strings.NewReader("stored before encryption"))
+	require.NoError(t, err)
+
+	reader, err := store.Get(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "stored before encryption", string(content))
+}
+
+func TestEncryptedStorage_KeyIsBoundToPath(t *testing.T) {
+	store, _, keys, _ := newTestEncryptedStorage(t)
+
+	first, err := store.Save("a.txt", strings.NewReader("first"))
+	require.NoError(t, err)
+	second, err := store.Save("b.txt", strings.NewReader("second"))
+	require.NoError(t, err)
+
+	keys.keys[second] = keys.keys[first]
+	_, err = store.Get(second)
+	assert.ErrorIs(t, err, encryption.ErrDecrypt)
+}
+
+func TestEncryptedStorage_DeleteAndPurgeRemoveKeys(t *testing.T) {
+	store, _, keys, baseDir := newTestEncryptedStorage(t)
+
+	deleted, err := store.Save("a.txt", strings.NewReader("delete me"))
+	require.NoError(t, err)
+	purged, err := store.Save("b.txt", strings.NewReader("purge me"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Delete(deleted))
+	require.NoError(t, store.(Purger).Purge(purged))
+
+	assert.Empty(t, keys.keys)
+	for _, path := range []string{deleted, purged} {
+		_, err := os.Stat(filepath.Join(baseDir, path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
+
+func TestEncryptedStorage_Walk(t *testing.T) {
+	store, _, _, _ := newTestEncryptedStorage(t)
+
+	path, err := store.Save("a.txt", strings.NewReader("walk me"))
+	require.NoError(t, err)
+
+	var walked []string
+	require.NoError(t, store.(FileWalker).Walk(func(info FileInfo) error {
+		walked = append(walked, info.Path)
+		return nil
+	}))
+	assert.Equal(t, []string{path}, walked)
+}
@@ -6,7 +6,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -37,6 +39,22 @@ type FileStorage interface {
 	Delete(filePath string) error
 }
 
+// FileInfo describes a stored file returned by FileWalker
+type FileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// FileWalker is implemented by storages that can enumerate their stored files
+type FileWalker interface {
+	// Walk calls fn for every stored file; returning an error from fn stops the walk
+	Walk(fn func(info FileInfo) error) error
+}
+
+// windowsVolumeRegex matches Windows drive letter prefixes such as "C:"
+var windowsVolumeRegex = regexp.MustCompile(`^[A-Za-z]:`)
+
 // localStorage implements FileStorage using local filesystem
 type localStorage struct {
 	basePath string
@@ -56,8 +74,9 @@ func (s *localStorage) validatePath(filePath string) (string, error) {
 	// Clean the path
 	cleanPath := filepath.Clean(filePath)
 
-	// Prevent absolute paths
-	if filepath.IsAbs(cleanPath) {
+	// Prevent absolute paths, including Windows-style drive and UNC paths on any OS
+	if filepath.IsAbs(cleanPath) || windowsVolumeRegex.MatchString(cleanPath) ||
+		strings.HasPrefix(cleanPath, `\\`) {
 		return "", ErrPathTraversal
 	}
 
@@ -176,3 +195,36 @@ func (s *localStorage) Delete(filePath string) error {
 
 	return nil
 }
+
+// Walk enumerates all files below the storage base path.
+// Paths passed to fn are relative and use forward slashes, matching the paths returned by Save.
+func (s *localStorage) Walk(fn func(info FileInfo) error) error {
+	return filepath.WalkDir(s.basePath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed while walking
+				return nil
+			}
+			return err
+		}
+
+		relPath, err := filepath.Rel(s.basePath, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(FileInfo{
+			Path:    filepath.ToSlash(relPath),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	})
+}
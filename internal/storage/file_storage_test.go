@@ -227,3 +227,36 @@ func TestNewLocalStorage_CreatesDirectory(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, info.IsDir())
 }
+
+func TestWalk_ListsSavedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	storage, err := NewLocalStorage(tempDir)
+	require.NoError(t, err)
+
+	first, err := storage.Save("a.txt", strings.NewReader("first"))
+	require.NoError(t, err)
+	second, err := storage.Save("b.txt", strings.NewReader("second file"))
+	require.NoError(t, err)
+
+	walker, ok := storage.(FileWalker)
+	require.True(t, ok, "local storage should implement FileWalker")
+
+	sizes := map[string]int64{}
+	err = walker.Walk(func(info FileInfo) error {
+		sizes[info.Path] = info.Size
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int64{
+		filepath.ToSlash(first):  5,
+		filepath.ToSlash(second): 11,
+	}, sizes)
+
+	// Walked paths must be usable with Get
+	for path := range sizes {
+		reader, err := storage.Get(path)
+		require.NoError(t, err)
+		reader.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/config"
+)
+
+// NewFromConfig creates the attachment storage selected by STORAGE_BACKEND
+func NewFromConfig(cfg *config.Config) (FileStorage, error) {
+	if cfg.StorageBackend != "s3" {
+		// Content-addressed; legacy per-upload files remain readable
+		return NewContentAddressedStorage(cfg.AttachmentStoragePath)
+	}
+
+	presignExpiry, err := time.ParseDuration(cfg.S3PresignExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3_PRESIGN_EXPIRY: %w", err)
+	}
+
+	return NewS3Storage(S3Config{
+		Endpoint:       cfg.S3Endpoint,
+		Region:         cfg.S3Region,
+		Bucket:         cfg.S3Bucket,
+		Prefix:         cfg.S3Prefix,
+		AccessKey:      cfg.S3AccessKey,
+		SecretKey:      cfg.S3SecretKey,
+		UseSSL:         cfg.S3UseSSL,
+		ForcePathStyle: cfg.S3ForcePathStyle,
+		SSE:            cfg.S3SSE,
+		SSEKMSKeyID:    cfg.S3SSEKMSKeyID,
+		PartSize:       uint64(cfg.S3PartSizeMB) * 1024 * 1024,
+		PresignExpiry:  presignExpiry,
+	})
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// Server-side encryption modes supported by S3Config.SSE
+const (
+	SSENone = ""
+	SSES3   = "AES256"
+	SSEKMS  = "aws:kms"
+)
+
+// DefaultS3PartSize is the multipart chunk size used when S3Config.PartSize is unset.
+// Uploads of unknown length are buffered one part at a time.
+const DefaultS3PartSize = 16 * 1024 * 1024
+
+// minS3PartSize is the smallest part size S3 accepts for multipart uploads
+const minS3PartSize = 5 * 1024 * 1024
+
+// DefaultPresignExpiry is how long presigned download URLs stay valid by default
+const DefaultPresignExpiry = 15 * time.Minute
+
+// S3Config holds configuration for S3-compatible object storage
+type S3Config struct {
+	Endpoint  string // host[:port] without scheme, e.g. s3.amazonaws.com or minio:9000
+	Region    string
+	Bucket    string
+	Prefix    string // key prefix for all objects, e.g. "attachments/"
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// ForcePathStyle addresses buckets as endpoint/bucket instead of bucket.endpoint (needed by MinIO)
+	ForcePathStyle bool
+	// SSE is the server-side encryption mode: SSENone, SSES3 or SSEKMS
+	SSE string
+	// SSEKMSKeyID is the KMS key used when SSE is SSEKMS
+	SSEKMSKeyID string
+	// PartSize is the multipart upload chunk size in bytes (minimum 5 MB)
+	PartSize uint64
+	// PresignExpiry is the lifetime of presigned download URLs (0 = DefaultPresignExpiry)
+	PresignExpiry time.Duration
+	// Transport overrides the HTTP transport, e.g. to trust a private CA (nil = default)
+	Transport http.RoundTripper
+}
+
+// URLSigner is implemented by storages that can hand out time-limited direct download URLs
+type URLSigner interface {
+	// SignedURL returns a URL that downloads filePath as downloadName without going through the API
+	SignedURL(filePath, downloadName string) (string, error)
+}
+
+// s3Storage implements FileStorage on an S3-compatible object store.
+// Objects are not deduplicated: reference counts cannot be updated atomically
+// across replicas sharing a bucket, so every Save creates its own object.
+type s3Storage struct {
+	client        *minio.Client
+	bucket        string
+	prefix        string
+	sse           encrypt.ServerSide
+	partSize      uint64
+	presignExpiry time.Duration
+}
+
+// NewS3Storage creates a FileStorage backed by an S3-compatible bucket.
+// The bucket must already exist.
+func NewS3Storage(config S3Config) (FileStorage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required")
+	}
+
+	sse, err := newServerSide(config.SSE, config.SSEKMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set defaults
+	if config.PartSize == 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+	if config.PartSize < minS3PartSize {
+		return nil, fmt.Errorf("S3 part size must be at least %d bytes", minS3PartSize)
+	}
+	if config.PresignExpiry <= 0 {
+		config.PresignExpiry = DefaultPresignExpiry
+	}
+
+	lookup := minio.BucketLookupAuto
+	if config.ForcePathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure:       config.UseSSL,
+		Region:       config.Region,
+		BucketLookup: lookup,
+		Transport:    config.Transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check S3 bucket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("S3 bucket %q does not exist", config.Bucket)
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Storage{
+		client:        client,
+		bucket:        config.Bucket,
+		prefix:        prefix,
+		sse:           sse,
+		partSize:      config.PartSize,
+		presignExpiry: config.PresignExpiry,
+	}, nil
+}
+
+// newServerSide maps an SSE mode to minio encryption options
+func newServerSide(mode, kmsKeyID string) (encrypt.ServerSide, error) {
+	switch mode {
+	case SSENone:
+		return nil, nil
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		sse, err := encrypt.NewSSEKMS(kmsKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 KMS configuration: %w", err)
+		}
+		return sse, nil
+	default:
+		return nil, fmt.Errorf("unsupported S3 server-side encryption %q", mode)
+	}
+}
+
+// objectKey validates a stored path and returns its full object key
+func (s *s3Storage) objectKey(filePath string) (string, error) {
+	cleanPath := path.Clean(filePath)
+	if path.IsAbs(cleanPath) || windowsVolumeRegex.MatchString(cleanPath) ||
+		strings.HasPrefix(cleanPath, `\`) || strings.Contains(cleanPath, "..") || cleanPath == "." {
+		return "", ErrPathTraversal
+	}
+	return s.prefix + cleanPath, nil
+}
+
+// Save uploads content as a new object and returns its path relative to the prefix.
+// Content that fits in one part is sent with a single PUT; larger content is
+// streamed as a multipart upload without buffering more than one part.
+func (s *s3Storage) Save(filename string, content io.Reader) (string, error) {
+	ext := path.Ext(filename)
+	uniqueName := uuid.New().String() + ext
+	filePath := uniqueName[:2] + "/" + uniqueName
+
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// Read up to one part to learn whether the size is known
+	head, err := io.ReadAll(io.LimitReader(content, int64(s.partSize)+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	var body io.Reader = bytes.NewReader(head)
+	size := int64(len(head))
+	if size > int64(s.partSize) {
+		body = io.MultiReader(body, content)
+		size = -1
+	}
+
+	_, err = s.client.PutObject(context.Background(), s.bucket, s.prefix+filePath, body, size, minio.PutObjectOptions{
+		ContentType:          contentType,
+		ServerSideEncryption: s.sse,
+		PartSize:             s.partSize,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// Get downloads an object by its path
+func (s *s3Storage) Get(filePath string) (io.ReadCloser, error) {
+	key, err := s.objectKey(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	// GetObject is lazy; Stat surfaces a missing key before the caller starts reading
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if isS3NotFound(err) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return object, nil
+}
+
+// Delete removes an object by its path. Deleting a missing object is not an error.
+func (s *s3Storage) Delete(filePath string) error {
+	key, err := s.objectKey(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		if isS3NotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// Walk lists every object under the prefix.
+// The prefix should be dedicated to this storage, or unrelated objects will be reported.
+func (s *s3Storage) Walk(fn func(info FileInfo) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list files: %w", object.Err)
+		}
+		if err := fn(FileInfo{
+			Path:    strings.TrimPrefix(object.Key, s.prefix),
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL that downloads the object as an attachment named downloadName
+func (s *s3Storage) SignedURL(filePath, downloadName string) (string, error) {
+	key, err := s.objectKey(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if downloadName != "" {
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	}
+
+	signed, err := s.client.PresignedGetObject(context.Background(), s.bucket, key, s.presignExpiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download: %w", err)
+	}
+	return signed.String(), nil
+}
+
+// isS3NotFound reports whether err means the object or key does not exist
+func isS3NotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeS3 starts an in-memory S3 server with one bucket and returns a config pointing at it.
+// TLS is used so uploads carry plain payloads, as with a real HTTPS endpoint.
+func newFakeS3(t *testing.T) (S3Config, *http.Client) {
+	t.Helper()
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("attachments"))
+
+	server := httptest.NewTLSServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+
+	return S3Config{
+		Endpoint:       strings.TrimPrefix(server.URL, "https://"),
+		Region:         "us-east-1",
+		Bucket:         "attachments",
+		Prefix:         "mail/",
+		AccessKey:      "access",
+		SecretKey:      "secret",
+		ForcePathStyle: true,
+		UseSSL:         true,
+		Transport:      server.Client().Transport,
+	}, server.Client()
+}
+
+// newFakeS3Storage creates an s3Storage against a fresh fake server
+func newFakeS3Storage(t *testing.T) FileStorage {
+	t.Helper()
+	config, _ := newFakeS3(t)
+	s3, err := NewS3Storage(config)
+	require.NoError(t, err)
+	return s3
+}
+
+func TestS3Storage_SaveGetDelete(t *testing.T) {
+	s3 := newFakeS3Storage(t)
+
+	path, err := s3.Save("doc.pdf", strings.NewReader("pdf content"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(path, ".pdf"))
+	assert.False(t, strings.HasPrefix(path, "mail/"), "returned path must be relative to the prefix")
+
+	reader, err := s3.Get(path)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "pdf content", string(content))
+
+	require.NoError(t, s3.Delete(path))
+	_, err = s3.Get(path)
+	assert.ErrorIs(t, err, ErrFileNotFound)
+
+	// Deleting a missing object is not an error
+	assert.NoError(t, s3.Delete(path))
+}
+
+func TestS3Storage_GetNotFound(t *testing.T) {
+	s3 := newFakeS3Storage(t)
+
+	_, err := s3.Get("ab/missing.pdf")
+	assert.ErrorIs(t, err, ErrFileNotFound)
+}
+
+func TestS3Storage_PathTraversal(t *testing.T) {
+	s3 := newFakeS3Storage(t)
+
+	_, err := s3.Get("../other-prefix/secret")
+	assert.ErrorIs(t, err, ErrPathTraversal)
+	assert.ErrorIs(t, s3.Delete("/etc/passwd"), ErrPathTraversal)
+}
+
+func TestS3Storage_MultipartUpload(t *testing.T) {
+	config, _ := newFakeS3(t)
+	config.PartSize = minS3PartSize
+	s3, err := NewS3Storage(config)
+	require.NoError(t, err)
+
+	large := bytes.Repeat([]byte("x"), minS3PartSize+1024)
+	path, err := s3.Save("large.bin", bytes.NewReader(large))
+	require.NoError(t, err)
+
+	reader, err := s3.Get(path)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, len(large), len(content))
+}
+
+func TestS3Storage_WalkListsPrefixedObjects(t *testing.T) {
+	s3 := newFakeS3Storage(t)
+
+	first, err := s3.Save("a.txt", strings.NewReader("a"))
+	require.NoError(t, err)
+	second, err := s3.Save("b.txt", strings.NewReader("bb"))
+	require.NoError(t, err)
+
+	seen := map[string]int64{}
+	err = s3.(FileWalker).Walk(func(info FileInfo) error {
+		seen[info.Path] = info.Size
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{first: 1, second: 2}, seen)
+}
+
+func TestS3Storage_SignedURL(t *testing.T) {
+	config, client := newFakeS3(t)
+	s3, err := NewS3Storage(config)
+	require.NoError(t, err)
+
+	path, err := s3.Save("report.pdf", strings.NewReader("signed content"))
+	require.NoError(t, err)
+
+	signedURL, err := s3.(URLSigner).SignedURL(path, "report.pdf")
+	require.NoError(t, err)
+	assert.Contains(t, signedURL, "/attachments/mail/"+path)
+	assert.Contains(t, signedURL, "X-Amz-Signature=")
+	assert.Contains(t, signedURL, "response-content-disposition=")
+
+	resp, err := client.Get(signedURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "signed content", string(body))
+}
+
+func TestNewS3Storage_Validation(t *testing.T) {
+	config, _ := newFakeS3(t)
+
+	missingBucket := config
+	missingBucket.Bucket = ""
+	_, err := NewS3Storage(missingBucket)
+	assert.Error(t, err)
+
+	unknownBucket := config
+	unknownBucket.Bucket = "does-not-exist"
+	_, err = NewS3Storage(unknownBucket)
+	assert.Error(t, err)
+
+	badSSE := config
+	badSSE.SSE = "rot13"
+	_, err = NewS3Storage(badSSE)
+	assert.Error(t, err)
+
+	smallParts := config
+	smallParts.PartSize = 1024
+	_, err = NewS3Storage(smallParts)
+	assert.Error(t, err)
+
+	withSSE := config
+	withSSE.SSE = SSES3
+	_, err = NewS3Storage(withSSE)
+	assert.NoError(t, err)
+}
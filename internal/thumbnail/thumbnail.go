@@ -0,0 +1,103 @@
+// Package thumbnail renders small JPEG previews of image attachments.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"strings"
+
+	// Register the decoders for every supported format
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxSize is the longest side in pixels of a stored preview
+	MaxSize = 512
+	// ContentType is the media type of generated previews
+	ContentType = "image/jpeg"
+	// maxSourcePixels guards against decompression bombs: images whose
+	// header declares more pixels than this are not decoded
+	maxSourcePixels = 40_000_000
+	jpegQuality     = 80
+)
+
+// Thumbnail errors
+var (
+	ErrUnsupported = errors.New("content type has no preview")
+	ErrTooLarge    = errors.New("image dimensions exceed preview limit")
+)
+
+// supportedTypes lists the attachment content types that get previews
+var supportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Supported reports whether a preview can be generated for contentType
+func Supported(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return supportedTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// Generate decodes an image and returns a JPEG whose longest side is at most size pixels.
+// Images already within size are re-encoded without scaling; the first frame of
+// animated GIFs is used and transparency is flattened onto white.
+func Generate(r io.Reader, size int) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxSourcePixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	return encode(scale(src, size))
+}
+
+// scale fits src into a size x size box on a white background, keeping its aspect ratio
+func scale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.BiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+// encode writes img as a JPEG
+func encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode preview: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,70 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupported(t *testing.T) {
+	assert.True(t, Supported("image/png"))
+	assert.True(t, Supported("IMAGE/JPEG; name=photo.jpg"))
+	assert.True(t, Supported("image/webp"))
+	assert.False(t, Supported("image/svg+xml"))
+	assert.False(t, Supported("application/pdf"))
+}
+
+func TestGenerate_ScalesLongestSide(t *testing.T) {
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, image.NewRGBA(image.Rect(0, 0, 2000, 1000))))
+
+	preview, err := Generate(&src, MaxSize)
+	require.NoError(t, err)
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+	require.NoError(t, err)
+	assert.Equal(t, MaxSize, cfg.Width)
+	assert.Equal(t, MaxSize/2, cfg.Height)
+}
+
+func TestGenerate_KeepsSmallImages(t *testing.T) {
+	var src bytes.Buffer
+	palette := []color.Color{color.Black, color.White}
+	require.NoError(t, gif.Encode(&src, image.NewPaletted(image.Rect(0, 0, 40, 30), palette), nil))
+
+	preview, err := Generate(&src, MaxSize)
+	require.NoError(t, err)
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+	require.NoError(t, err)
+	assert.Equal(t, 40, cfg.Width)
+	assert.Equal(t, 30, cfg.Height)
+}
+
+func TestGenerate_FlattensTransparency(t *testing.T) {
+	var src bytes.Buffer
+	require.NoError(t, png.Encode(&src, image.NewNRGBA(image.Rect(0, 0, 10, 10))))
+
+	preview, err := Generate(&src, MaxSize)
+	require.NoError(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(preview))
+	require.NoError(t, err)
+	r, g, b, _ := img.At(5, 5).RGBA()
+	assert.Greater(t, r, uint32(0xf000))
+	assert.Greater(t, g, uint32(0xf000))
+	assert.Greater(t, b, uint32(0xf000))
+}
+
+func TestGenerate_RejectsInvalidImages(t *testing.T) {
+	_, err := Generate(strings.NewReader("not an image"), MaxSize)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
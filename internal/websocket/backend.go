@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+)
+
+// Backend carries the events of a hub to the hubs of other instances, so clients
+// receive events no matter which instance they are connected to. Without a
+// backend a hub only delivers the events of its own process.
+type Backend interface {
+	// Publish sends an event to the hubs listening on the backend
+	Publish(ctx context.Context, data []byte) error
+	// Listen calls receive with the published events until ctx is done or the
+	// backend fails
+	Listen(ctx context.Context, receive func(data []byte)) error
+}
+
+// MemoryBackend connects the hubs of one process
+type MemoryBackend struct {
+	mu        sync.RWMutex
+	listeners map[int]func([]byte)
+	next      int
+}
+
+// NewMemoryBackend creates a new MemoryBackend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{listeners: make(map[int]func([]byte))}
+}
+
+// Publish implements Backend
+func (b *MemoryBackend) Publish(_ context.Context, data []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, receive := range b.listeners {
+		receive(data)
+	}
+	return nil
+}
+
+// Listen implements Backend
+func (b *MemoryBackend) Listen(ctx context.Context, receive func(data []byte)) error {
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.listeners[id] = receive
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.listeners, id)
+	b.mu.Unlock()
+	return ctx.Err()
+}
@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSharedHubs starts two hubs connected by a memory backend
+func newSharedHubs(t *testing.T) (*Hub, *Hub) {
+	t.Helper()
+	backend := NewMemoryBackend()
+	a, b := NewHub(nil), NewHub(nil)
+	a.SetBackend(backend)
+	b.SetBackend(backend)
+	go a.Run()
+	go b.Run()
+
+	// Wait until both hubs listen
+	assert.Eventually(t, func() bool {
+		backend.mu.RLock()
+		defer backend.mu.RUnlock()
+		return len(backend.listeners) == 2
+	}, time.Second, time.Millisecond)
+	return a, b
+}
+
+func TestBackend_DeliversToOtherHubs(t *testing.T) {
+	a, b := newSharedHubs(t)
+	streamA, _, _ := a.OpenStream(1, "")
+	defer a.CloseStream(streamA)
+	streamB, _, _ := b.OpenStream(1, "")
+	defer b.CloseStream(streamB)
+
+	a.BroadcastNewMessage(1, &NewMessagePayload{ID: 10})
+	b.BroadcastDomainStatusChanged(&DomainStatusPayload{ID: 5, Status: "active"})
+
+	event := receive(t, streamB)
+	assert.Equal(t, MessageTypeNewMessage, event.Type)
+	assert.Contains(t, string(event.Data), `"id":10`)
+	// Each hub delivers an event once and numbers it itself
+	event = receive(t, streamA)
+	assert.Equal(t, MessageTypeNewMessage, event.Type)
+	assert.Contains(t, event.ID, a.epoch+"-1")
+	select {
+	case event := <-streamA.Events():
+		t.Fatalf("unexpected event %s", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBackend_KeepsDomainOfRemoteEvents(t *testing.T) {
+	a, b := newSharedHubs(t)
+	// Only the publishing hub can resolve the domain of the mailbox
+	a.SetDomainResolver(func(_ context.Context, mailboxID uint) (uint, error) {
+		return 5, nil
+	})
+	stream, _, _ := b.OpenDomainStream(5, "")
+	defer b.CloseStream(stream)
+
+	a.BroadcastMessageDeleted(1, &MessageDeletedPayload{ID: 10})
+
+	event := receive(t, stream)
+	assert.Equal(t, MessageTypeMessageDeleted, event.Type)
+	assert.Equal(t, uint(5), event.DomainID)
+}
+
+// blockingBackend holds every publish until release is closed
+type blockingBackend struct {
+	release   chan struct{}
+	published chan []byte
+}
+
+func (b *blockingBackend) Publish(_ context.Context, data []byte) error {
+	<-b.release
+	b.published <- data
+	return nil
+}
+
+func (b *blockingBackend) Listen(ctx context.Context, _ func([]byte)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHub_SlowBackendDoesNotDelayBroadcasts(t *testing.T) {
+	backend := &blockingBackend{release: make(chan struct{}), published: make(chan []byte, 2)}
+	hub := NewHub(nil)
+	hub.SetBackend(backend)
+	go hub.Run()
+	stream, _, _ := hub.OpenStream(1, "")
+	defer hub.CloseStream(stream)
+
+	sent := make(chan struct{})
+	go func() {
+		hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 10})
+		hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 11})
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast waited for the backend")
+	}
+	receive(t, stream)
+	receive(t, stream)
+
+	close(backend.release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-backend.published:
+		case <-time.After(time.Second):
+			t.Fatal("queued event not published")
+		}
+	}
+}
+
+func TestHub_ReceiveIgnoresInvalidEvents(t *testing.T) {
+	hub := NewHub(nil)
+
+	hub.receive([]byte("not json"))
+
+	assert.Empty(t, hub.broadcast)
+}
@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"time"
 
@@ -20,23 +22,65 @@ const (
 
 	// Maximum message size allowed from peer
 	maxMessageSize = 512
+
+	// Time allowed to authorize a subscription
+	authorizeWait = 5 * time.Second
+)
+
+// Error codes of error frames
+const (
+	ErrorCodeInvalidMessage  = "invalid_message"
+	ErrorCodeUnknownType     = "unknown_type"
+	ErrorCodeMailboxRequired = "mailbox_id_required"
+	ErrorCodeForbidden       = "forbidden"
+	ErrorCodeNotFound        = "mailbox_not_found"
+	ErrorCodeDomainNotFound  = "domain_not_found"
+	ErrorCodeInternal        = "internal_error"
 )
 
+var (
+	// ErrForbidden is returned by an Authorizer for mailboxes the client may not watch
+	ErrForbidden = errors.New("forbidden")
+	// ErrMailboxNotFound is returned by an Authorizer for mailboxes that do not exist
+	ErrMailboxNotFound = errors.New("mailbox not found")
+	// ErrDomainNotFound is returned by an Authorizer for domains that do not exist
+	ErrDomainNotFound = errors.New("domain not found")
+)
+
+// Authorizer decides whether a client may subscribe to a mailbox or a domain
+type Authorizer interface {
+	AuthorizeMailbox(ctx context.Context, mailboxID uint) error
+	AuthorizeDomain(ctx context.Context, domainID uint) error
+}
+
 // Client represents a WebSocket client connection
 type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	logger *slog.Logger
+	hub        *Hub
+	conn       *websocket.Conn
+	send       chan []byte
+	authorizer Authorizer
+	logger     *slog.Logger
+
+	// Guarded by hub.mu: whether send was closed, and the last event queued
+	// on it for the overflow frame
+	closed      bool
+	lastEventID string
 }
 
-// NewClient creates a new Client instance
+// NewClient creates a new Client instance that may subscribe to any mailbox
 func NewClient(hub *Hub, conn *websocket.Conn, logger *slog.Logger) *Client {
+	return NewClientWithAuthorizer(hub, conn, nil, logger)
+}
+
+// NewClientWithAuthorizer creates a new Client whose subscriptions are checked
+// by authorizer
+func NewClientWithAuthorizer(hub *Hub, conn *websocket.Conn, authorizer Authorizer, logger *slog.Logger) *Client {
 	return &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		logger: logger,
+		hub:        hub,
+		conn:       conn,
+		send:       make(chan []byte, 256),
+		authorizer: authorizer,
+		logger:     logger,
 	}
 }
 
@@ -110,35 +154,96 @@ func (c *Client) WritePump() {
 func (c *Client) handleMessage(data []byte) {
 	var msg WSMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
-		c.sendError("invalid message format")
+		c.sendError(ErrorCodeInvalidMessage, nil, "invalid message format")
 		return
 	}
 
 	switch msg.Type {
 	case MessageTypeSubscribe:
-		if msg.MailboxID == 0 {
-			c.sendError("mailbox_id is required")
+		if !c.validTarget(&msg) || !c.authorize(&msg) {
+			return
+		}
+		if msg.DomainID != 0 {
+			c.hub.SubscribeDomainSince(c, msg.DomainID, msg.SinceEventID)
 			return
 		}
-		c.hub.Subscribe(c, msg.MailboxID)
+		c.hub.SubscribeSince(c, msg.MailboxID, msg.SinceEventID)
 
 	case MessageTypeUnsubscribe:
-		if msg.MailboxID == 0 {
-			c.sendError("mailbox_id is required")
+		if !c.validTarget(&msg) {
+			return
+		}
+		if msg.DomainID != 0 {
+			c.hub.UnsubscribeDomain(c, msg.DomainID)
 			return
 		}
 		c.hub.Unsubscribe(c, msg.MailboxID)
 
 	default:
-		c.sendError("unknown message type")
+		c.sendError(ErrorCodeUnknownType, nil, "unknown message type")
+	}
+}
+
+// validTarget checks that a subscription frame names a mailbox or a domain
+func (c *Client) validTarget(msg *WSMessage) bool {
+	switch {
+	case msg.MailboxID == 0 && msg.DomainID == 0:
+		c.sendError(ErrorCodeMailboxRequired, nil, "mailbox_id or domain_id is required")
+	case msg.MailboxID != 0 && msg.DomainID != 0:
+		c.sendError(ErrorCodeInvalidMessage, nil, "only one of mailbox_id and domain_id can be given")
+	default:
+		return true
+	}
+	return false
+}
+
+// authorize checks the mailbox or domain of a subscription and sends an error
+// frame when it is refused
+func (c *Client) authorize(target *WSMessage) bool {
+	if c.authorizer == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), authorizeWait)
+	defer cancel()
+	var err error
+	if target.DomainID != 0 {
+		err = c.authorizer.AuthorizeDomain(ctx, target.DomainID)
+	} else {
+		err = c.authorizer.AuthorizeMailbox(ctx, target.MailboxID)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrForbidden):
+		c.sendError(ErrorCodeForbidden, target, "not allowed to subscribe")
+	case errors.Is(err, ErrMailboxNotFound):
+		c.sendError(ErrorCodeNotFound, target, "mailbox not found")
+	case errors.Is(err, ErrDomainNotFound):
+		c.sendError(ErrorCodeDomainNotFound, target, "domain not found")
+	default:
+		if c.logger != nil {
+			c.logger.Error("failed to authorize websocket subscription",
+				slog.Uint64("mailbox_id", uint64(target.MailboxID)),
+				slog.Uint64("domain_id", uint64(target.DomainID)),
+				slog.Any("error", err))
+		}
+		c.sendError(ErrorCodeInternal, target, "failed to authorize subscription")
 	}
+	return false
 }
 
-// sendError sends an error message to the client
-func (c *Client) sendError(errMsg string) {
+// sendError sends an error frame to the client; target names the mailbox or
+// domain of the refused request, if any
+func (c *Client) sendError(code string, target *WSMessage, errMsg string) {
 	msg := WSMessage{
 		Type:  MessageTypeError,
 		Error: errMsg,
+		Code:  code,
+	}
+	if target != nil {
+		msg.MailboxID = target.MailboxID
+		msg.DomainID = target.DomainID
 	}
 
 	data, err := json.Marshal(msg)
@@ -146,9 +251,21 @@ func (c *Client) sendError(errMsg string) {
 		return
 	}
 
-	select {
-	case c.send <- data:
-	default:
-		// Buffer full, skip
+	// The hub closes send when it drops the client
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	if !c.closed {
+		// Skipped when the buffer is full
+		c.queue(data)
+	}
+}
+
+// queue adds a frame to the send buffer unless only the slot kept for the
+// overflow frame is left
+func (c *Client) queue(data []byte) bool {
+	if len(c.send) >= cap(c.send)-1 {
+		return false
 	}
+	c.send <- data
+	return true
 }
@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -155,17 +157,147 @@ func TestClient_HandleMessage_SendsErrorForMissingMailboxID(t *testing.T) {
 		err := json.Unmarshal(msg, &wsMsg)
 		require.NoError(t, err)
 		assert.Equal(t, MessageTypeError, wsMsg.Type)
-		assert.Contains(t, wsMsg.Error, "mailbox_id is required")
+		assert.Contains(t, wsMsg.Error, "mailbox_id or domain_id is required")
+		assert.Equal(t, ErrorCodeMailboxRequired, wsMsg.Code)
 	case <-time.After(100 * time.Millisecond):
 		t.Fatal("expected error message to be sent")
 	}
 }
 
+// testAuthorizer records the mailbox or domain it checked and returns err
+type testAuthorizer struct {
+	err       error
+	mailboxID uint
+	domainID  uint
+}
+
+func (a *testAuthorizer) AuthorizeMailbox(_ context.Context, mailboxID uint) error {
+	a.mailboxID = mailboxID
+	return a.err
+}
+
+func (a *testAuthorizer) AuthorizeDomain(_ context.Context, domainID uint) error {
+	a.domainID = domainID
+	return a.err
+}
+
+func TestClient_HandleMessage_RefusesUnauthorizedSubscribe(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"forbidden", ErrForbidden, ErrorCodeForbidden},
+		{"not found", ErrMailboxNotFound, ErrorCodeNotFound},
+		{"lookup failed", errors.New("database down"), ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		hub := NewHub(nil)
+		client := NewClientWithAuthorizer(hub, nil, &testAuthorizer{err: tt.err}, nil)
+
+		data, err := json.Marshal(WSMessage{Type: MessageTypeSubscribe, MailboxID: 7})
+		require.NoError(t, err)
+		client.handleMessage(data)
+
+		select {
+		case msg := <-client.send:
+			var wsMsg WSMessage
+			require.NoError(t, json.Unmarshal(msg, &wsMsg))
+			assert.Equal(t, MessageTypeError, wsMsg.Type, tt.name)
+			assert.Equal(t, tt.code, wsMsg.Code, tt.name)
+			assert.Equal(t, uint(7), wsMsg.MailboxID, tt.name)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("%s: expected error message to be sent", tt.name)
+		}
+		// The hub loop is not running, so a subscription would have blocked above
+		assert.Empty(t, hub.subscriptions, tt.name)
+	}
+}
+
+func TestClient_HandleMessage_SubscribesWhenAuthorized(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+
+	authorizer := &testAuthorizer{}
+	client := NewClientWithAuthorizer(hub, nil, authorizer, nil)
+	hub.Register(client)
+
+	data, err := json.Marshal(WSMessage{Type: MessageTypeSubscribe, MailboxID: 7})
+	require.NoError(t, err)
+	client.handleMessage(data)
+	time.Sleep(10 * time.Millisecond) // Allow subscription to process
+
+	hub.mu.RLock()
+	_, exists := hub.subscriptions[7][client]
+	hub.mu.RUnlock()
+	assert.True(t, exists)
+	assert.Equal(t, uint(7), authorizer.mailboxID)
+	assert.Empty(t, client.send)
+}
+
+func TestClient_HandleMessage_SubscribesToDomain(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+
+	authorizer := &testAuthorizer{}
+	client := NewClientWithAuthorizer(hub, nil, authorizer, nil)
+	hub.Register(client)
+
+	data, err := json.Marshal(WSMessage{Type: MessageTypeSubscribe, DomainID: 4})
+	require.NoError(t, err)
+	client.handleMessage(data)
+	time.Sleep(10 * time.Millisecond) // Allow subscription to process
+
+	hub.mu.RLock()
+	_, exists := hub.domainSubscriptions[4][client]
+	hub.mu.RUnlock()
+	assert.True(t, exists)
+	assert.Equal(t, uint(4), authorizer.domainID)
+
+	data, err = json.Marshal(WSMessage{Type: MessageTypeUnsubscribe, DomainID: 4})
+	require.NoError(t, err)
+	client.handleMessage(data)
+	time.Sleep(10 * time.Millisecond)
+
+	hub.mu.RLock()
+	_, exists = hub.domainSubscriptions[4]
+	hub.mu.RUnlock()
+	assert.False(t, exists)
+}
+
+func TestClient_HandleMessage_RefusesUnknownDomain(t *testing.T) {
+	hub := NewHub(nil)
+	client := NewClientWithAuthorizer(hub, nil, &testAuthorizer{err: ErrDomainNotFound}, nil)
+
+	data, err := json.Marshal(WSMessage{Type: MessageTypeSubscribe, DomainID: 4})
+	require.NoError(t, err)
+	client.handleMessage(data)
+
+	var wsMsg WSMessage
+	require.NoError(t, json.Unmarshal(<-client.send, &wsMsg))
+	assert.Equal(t, ErrorCodeDomainNotFound, wsMsg.Code)
+	assert.Equal(t, uint(4), wsMsg.DomainID)
+}
+
+func TestClient_HandleMessage_RefusesMailboxAndDomain(t *testing.T) {
+	hub := NewHub(nil)
+	client := NewClient(hub, nil, nil)
+
+	data, err := json.Marshal(WSMessage{Type: MessageTypeSubscribe, MailboxID: 1, DomainID: 4})
+	require.NoError(t, err)
+	client.handleMessage(data)
+
+	var wsMsg WSMessage
+	require.NoError(t, json.Unmarshal(<-client.send, &wsMsg))
+	assert.Equal(t, ErrorCodeInvalidMessage, wsMsg.Code)
+}
+
 func TestClient_SendError_SendsErrorMessage(t *testing.T) {
 	hub := NewHub(nil)
 	client := NewClient(hub, nil, nil)
 
-	client.sendError("test error")
+	client.sendError(ErrorCodeInvalidMessage, nil, "test error")
 
 	// Check that error was sent
 	select {
@@ -175,6 +307,7 @@ func TestClient_SendError_SendsErrorMessage(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, MessageTypeError, wsMsg.Type)
 		assert.Equal(t, "test error", wsMsg.Error)
+		assert.Equal(t, ErrorCodeInvalidMessage, wsMsg.Code)
 	case <-time.After(100 * time.Millisecond):
 		t.Fatal("expected error message to be sent")
 	}
@@ -236,7 +369,7 @@ func TestClient_SendChannel_HasBuffer(t *testing.T) {
 
 	// Should be able to send multiple messages without blocking
 	for i := 0; i < 10; i++ {
-		client.sendError("test error")
+		client.sendError(ErrorCodeInvalidMessage, nil, "test error")
 	}
 
 	// Verify messages were buffered
@@ -0,0 +1,85 @@
+package websocket
+
+// Events about messages, mailboxes and domains besides new messages
+const (
+	MessageTypeMessageRead         MessageType = "message_read"
+	MessageTypeMessageDeleted      MessageType = "message_deleted"
+	MessageTypeMailboxCreated      MessageType = "mailbox_created"
+	MessageTypeMailboxDeleted      MessageType = "mailbox_deleted"
+	MessageTypeDomainStatusChanged MessageType = "domain_status_changed"
+	MessageTypeCertificateIssued   MessageType = "certificate_issued"
+	MessageTypeCertificateRenewed  MessageType = "certificate_renewed"
+)
+
+// MessageReadPayload reports that a message was marked read or unread
+type MessageReadPayload struct {
+	ID     uint `json:"id"`
+	IsRead bool `json:"is_read"`
+}
+
+// MessageDeletedPayload reports that a message was deleted
+type MessageDeletedPayload struct {
+	ID uint `json:"id"`
+}
+
+// MailboxPayload describes a mailbox that was created or deleted
+type MailboxPayload struct {
+	ID          uint   `json:"id"`
+	DomainID    uint   `json:"domain_id"`
+	FullAddress string `json:"full_address"`
+}
+
+// DomainStatusPayload reports a transition of the setup status of a domain
+type DomainStatusPayload struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+	IsActive       bool   `json:"is_active"`
+	ErrorMessage   string `json:"error_message,omitempty"`
+}
+
+// CertificatePayload describes a certificate that was issued or renewed
+type CertificatePayload struct {
+	DomainID   uint   `json:"domain_id"`
+	DomainName string `json:"domain_name"`
+	IssuedAt   string `json:"issued_at"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+// BroadcastMessageRead broadcasts a read state change to mailbox subscribers
+func (h *Hub) BroadcastMessageRead(mailboxID uint, payload *MessageReadPayload) {
+	h.publish(MessageTypeMessageRead, mailboxID, 0, payload)
+}
+
+// BroadcastMessageDeleted broadcasts a message deletion to mailbox subscribers
+func (h *Hub) BroadcastMessageDeleted(mailboxID uint, payload *MessageDeletedPayload) {
+	h.publish(MessageTypeMessageDeleted, mailboxID, 0, payload)
+}
+
+// BroadcastMailboxCreated broadcasts a new mailbox to the subscribers of its domain
+func (h *Hub) BroadcastMailboxCreated(payload *MailboxPayload) {
+	h.publish(MessageTypeMailboxCreated, payload.ID, payload.DomainID, payload)
+}
+
+// BroadcastMailboxDeleted broadcasts a mailbox deletion to its subscribers and
+// the subscribers of its domain
+func (h *Hub) BroadcastMailboxDeleted(payload *MailboxPayload) {
+	h.publish(MessageTypeMailboxDeleted, payload.ID, payload.DomainID, payload)
+}
+
+// BroadcastDomainStatusChanged broadcasts a status transition to domain subscribers
+func (h *Hub) BroadcastDomainStatusChanged(payload *DomainStatusPayload) {
+	h.publish(MessageTypeDomainStatusChanged, 0, payload.ID, payload)
+}
+
+// BroadcastCertificateIssued broadcasts the first certificate of a domain to its
+// subscribers
+func (h *Hub) BroadcastCertificateIssued(payload *CertificatePayload) {
+	h.publish(MessageTypeCertificateIssued, 0, payload.DomainID, payload)
+}
+
+// BroadcastCertificateRenewed broadcasts a replaced certificate to domain subscribers
+func (h *Hub) BroadcastCertificateRenewed(payload *CertificatePayload) {
+	h.publish(MessageTypeCertificateRenewed, 0, payload.DomainID, payload)
+}
@@ -0,0 +1,100 @@
+package websocket
+
+import "container/list"
+
+// Replay history bounds. Every mailbox and domain gets its own ring, so a busy
+// mailbox cannot push the events of quiet ones out of the history; the rings
+// written least recently are dropped when there are too many.
+const (
+	// mailboxHistorySize is how many recent events are kept per mailbox
+	mailboxHistorySize = 64
+	// maxHistoryMailboxes is how many mailboxes have a ring at a time
+	maxHistoryMailboxes = 2048
+	// domainHistorySize is how many recent events are kept per domain
+	domainHistorySize = 256
+	// maxHistoryDomains is how many domains have a ring at a time
+	maxHistoryDomains = 512
+	// globalHistorySize is how many recent events are kept for streams of everything
+	globalHistorySize = 1024
+)
+
+// eventRing holds the latest events of one key. It has every event of its key
+// numbered above after; older ones were dropped to bound its size.
+type eventRing struct {
+	key    uint
+	events []*Event
+	after  uint64
+	elem   *list.Element
+}
+
+// eventHistory keeps a bounded ring of recent events per key, such as per
+// mailbox or per domain. The caller serializes access.
+type eventHistory struct {
+	size     int
+	maxRings int
+	rings    map[uint]*eventRing
+	// order lists the rings, most recently written first
+	order *list.List
+	// evicted is the newest event of any dropped ring; keys without a ring
+	// may have had events up to it
+	evicted uint64
+}
+
+func newEventHistory(size, maxRings int) *eventHistory {
+	return &eventHistory{
+		size:     size,
+		maxRings: maxRings,
+		rings:    make(map[uint]*eventRing),
+		order:    list.New(),
+	}
+}
+
+// add appends an event to the ring of key, creating the ring if needed
+func (h *eventHistory) add(key uint, event *Event) {
+	ring, ok := h.rings[key]
+	if !ok {
+		ring = &eventRing{key: key, after: h.evicted}
+		ring.elem = h.order.PushFront(ring)
+		h.rings[key] = ring
+		if h.order.Len() > h.maxRings {
+			h.evict(h.order.Back().Value.(*eventRing))
+		}
+	} else {
+		h.order.MoveToFront(ring.elem)
+	}
+
+	ring.events = append(ring.events, event)
+	if len(ring.events) > h.size {
+		ring.after = ring.events[0].seq
+		ring.events = ring.events[1:]
+	}
+}
+
+// evict drops the ring of a key
+func (h *eventHistory) evict(ring *eventRing) {
+	if n := len(ring.events); n > 0 && ring.events[n-1].seq > h.evicted {
+		h.evicted = ring.events[n-1].seq
+	}
+	h.order.Remove(ring.elem)
+	delete(h.rings, ring.key)
+}
+
+// since returns the events of key numbered above seq, or false when some of
+// them may have been dropped
+func (h *eventHistory) since(key uint, seq uint64) ([]*Event, bool) {
+	ring, ok := h.rings[key]
+	if !ok {
+		// No events for key since the newest dropped one
+		return nil, seq >= h.evicted
+	}
+	if seq < ring.after {
+		return nil, false
+	}
+	var missed []*Event
+	for _, event := range ring.events {
+		if event.seq > seq {
+			missed = append(missed, event)
+		}
+	}
+	return missed, true
+}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventHistory_EvictsLeastRecentlyWrittenRing(t *testing.T) {
+	history := newEventHistory(4, 2)
+	history.add(1, &Event{seq: 1})
+	history.add(2, &Event{seq: 2})
+	history.add(1, &Event{seq: 3})
+	history.add(3, &Event{seq: 4}) // drops the ring of 2
+
+	missed, ok := history.since(1, 0)
+	assert.True(t, ok)
+	assert.Len(t, missed, 2)
+
+	// Events of 2 up to its last one are gone
+	_, ok = history.since(2, 1)
+	assert.False(t, ok)
+	missed, ok = history.since(2, 2)
+	assert.True(t, ok)
+	assert.Empty(t, missed)
+
+	// A ring created after the eviction cannot vouch for older events either
+	history.add(4, &Event{seq: 5})
+	_, ok = history.since(4, 1)
+	assert.False(t, ok)
+	missed, ok = history.since(4, 2)
+	assert.True(t, ok)
+	require.Len(t, missed, 1)
+	assert.Equal(t, uint64(5), missed[0].seq)
+}
+
+func TestEventHistory_TrimsRing(t *testing.T) {
+	history := newEventHistory(2, 1)
+	for seq := uint64(1); seq <= 3; seq++ {
+		history.add(0, &Event{seq: seq})
+	}
+
+	_, ok := history.since(0, 0)
+	assert.False(t, ok)
+	missed, ok := history.since(0, 1)
+	assert.True(t, ok)
+	assert.Len(t, missed, 2)
+}
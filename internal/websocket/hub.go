@@ -1,9 +1,14 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
+	"strconv"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // MessageType represents the type of WebSocket message
@@ -14,14 +19,30 @@ const (
 	MessageTypeUnsubscribe MessageType = "unsubscribe"
 	MessageTypeNewMessage  MessageType = "new_message"
 	MessageTypeError       MessageType = "error"
+	// MessageTypeMessagesUpdated summarizes a bulk operation on a mailbox
+	MessageTypeMessagesUpdated MessageType = "messages_updated"
+	// MessageTypeOverflow is the last frame of a client that fell too far
+	// behind; it should reconnect and subscribe with since_event_id
+	MessageTypeOverflow MessageType = "overflow"
+	// MessageTypeReset answers a subscription whose since_event_id can no
+	// longer be replayed; the client should reload the mailbox or domain
+	MessageTypeReset MessageType = "reset"
 )
 
 // WSMessage represents a WebSocket message
 type WSMessage struct {
 	Type      MessageType `json:"type"`
 	MailboxID uint        `json:"mailbox_id,omitempty"`
+	DomainID  uint        `json:"domain_id,omitempty"`
 	Message   interface{} `json:"message,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	// Code identifies the error of error frames, see the ErrorCode constants
+	Code string `json:"code,omitempty"`
+	// EventID identifies broadcast events. IDs increase, so a reconnecting
+	// client subscribes with the last one it saw as SinceEventID to replay the
+	// events it missed.
+	EventID      string `json:"event_id,omitempty"`
+	SinceEventID string `json:"since_event_id,omitempty"`
 }
 
 // NewMessagePayload represents the payload for new message notifications
@@ -33,6 +54,22 @@ type NewMessagePayload struct {
 	ReceivedAt  string `json:"received_at"`
 }
 
+// MessagesUpdatedPayload summarizes a bulk operation on the messages of a mailbox;
+// clients should reload the mailbox rather than patch individual messages
+type MessagesUpdatedPayload struct {
+	Action string `json:"action"`
+	Count  int64  `json:"count"`
+	// TargetMailboxID is set when messages were moved out of the mailbox
+	TargetMailboxID uint `json:"target_mailbox_id,omitempty"`
+	// SourceMailboxID is set when messages were moved into the mailbox
+	SourceMailboxID uint `json:"source_mailbox_id,omitempty"`
+}
+
+// OverflowPayload names the last event a client received before it fell behind
+type OverflowPayload struct {
+	LastEventID string `json:"last_event_id,omitempty"`
+}
+
 // Hub maintains the set of active clients and broadcasts messages
 type Hub struct {
 	// Registered clients
@@ -41,21 +78,49 @@ type Hub struct {
 	// Mailbox subscriptions: mailboxID -> set of clients
 	subscriptions map[uint]map[*Client]bool
 
+	// Domain subscriptions: domainID -> set of clients receiving the events of
+	// the domain and of all its mailboxes
+	domainSubscriptions map[uint]map[*Client]bool
+
 	// Register requests from clients
 	register chan *Client
 
 	// Unregister requests from clients
 	unregister chan *Client
 
-	// Subscribe to mailbox
+	// Subscribe to mailbox or domain
 	subscribe chan *subscriptionRequest
 
-	// Unsubscribe from mailbox
+	// Unsubscribe from mailbox or domain
 	unsubscribeMailbox chan *subscriptionRequest
 
-	// Broadcast to mailbox subscribers
+	// Broadcast to mailbox and domain subscribers
 	broadcast chan *broadcastMessage
 
+	// Finds the domain of mailbox events, with a cache of its answers
+	resolveDomain DomainResolver
+	domains       map[uint]uint
+	domainsMu     sync.Mutex
+
+	// Server-Sent Event streams
+	streams map[*Stream]bool
+
+	// Carries events to and from the hubs of other instances (optional).
+	// origin tells the events of this hub apart.
+	backend Backend
+	origin  string
+	// Broadcasts of this hub waiting to be published to the backend
+	outbound chan *broadcastMessage
+
+	// Recent events per mailbox, per domain and of everything, for streams
+	// resuming with a Last-Event-ID. Event IDs start with epoch so IDs issued
+	// before a restart are recognized.
+	mailboxHistory *eventHistory
+	domainHistory  *eventHistory
+	globalHistory  *eventHistory
+	seq            uint64
+	epoch          string
+
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
 
@@ -63,32 +128,82 @@ type Hub struct {
 	logger *slog.Logger
 }
 
+// DomainResolver returns the domain of a mailbox
+type DomainResolver func(ctx context.Context, mailboxID uint) (uint, error)
+
+// maxCachedDomains bounds the mailbox to domain cache of the hub
+const maxCachedDomains = 10000
+
+// resolveDomainWait is how long a broadcast waits for the domain of a mailbox
+const resolveDomainWait = 5 * time.Second
+
+// backendPublishWait is how long publishing a broadcast to the backend may take
+const backendPublishWait = 5 * time.Second
+
+// outboundQueueSize is how many broadcasts can wait for the backend before new
+// ones are dropped
+const outboundQueueSize = 1024
+
+// backendRetryWait is how long the hub waits before listening again after the
+// backend failed
+const backendRetryWait = 5 * time.Second
+
+// subscriptionRequest names either a mailbox or a domain, and the last event
+// the client saw when it resumes a subscription
 type subscriptionRequest struct {
-	client    *Client
-	mailboxID uint
+	client       *Client
+	mailboxID    uint
+	domainID     uint
+	sinceEventID string
 }
 
+// broadcastMessage is an event before the hub numbered it
 type broadcastMessage struct {
-	mailboxID uint
-	message   []byte
+	mailboxID   uint
+	domainID    uint
+	messageType MessageType
+	payload     json.RawMessage
+}
+
+// backendEvent is a broadcast as exchanged with the hubs of other instances
+type backendEvent struct {
+	Origin    string          `json:"origin"`
+	Type      MessageType     `json:"type"`
+	MailboxID uint            `json:"mailbox_id,omitempty"`
+	DomainID  uint            `json:"domain_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
 }
 
 // NewHub creates a new Hub instance
 func NewHub(logger *slog.Logger) *Hub {
 	return &Hub{
-		clients:            make(map[*Client]bool),
-		subscriptions:      make(map[uint]map[*Client]bool),
-		register:           make(chan *Client),
-		unregister:         make(chan *Client),
-		subscribe:          make(chan *subscriptionRequest),
-		unsubscribeMailbox: make(chan *subscriptionRequest),
-		broadcast:          make(chan *broadcastMessage, 256),
-		logger:             logger,
+		clients:             make(map[*Client]bool),
+		subscriptions:       make(map[uint]map[*Client]bool),
+		domainSubscriptions: make(map[uint]map[*Client]bool),
+		domains:             make(map[uint]uint),
+		register:            make(chan *Client),
+		unregister:          make(chan *Client),
+		subscribe:           make(chan *subscriptionRequest),
+		unsubscribeMailbox:  make(chan *subscriptionRequest),
+		broadcast:           make(chan *broadcastMessage, 256),
+		outbound:            make(chan *broadcastMessage, outboundQueueSize),
+		streams:             make(map[*Stream]bool),
+		mailboxHistory:      newEventHistory(mailboxHistorySize, maxHistoryMailboxes),
+		domainHistory:       newEventHistory(domainHistorySize, maxHistoryDomains),
+		globalHistory:       newEventHistory(globalHistorySize, 1),
+		epoch:               strconv.FormatInt(time.Now().UnixNano(), 36),
+		origin:              uuid.NewString(),
+		logger:              logger,
 	}
 }
 
 // Run starts the hub's main loop
 func (h *Hub) Run() {
+	if h.backend != nil {
+		go h.listen()
+		go h.drainOutbound()
+	}
+
 	for {
 		select {
 		case client := <-h.register:
@@ -101,17 +216,7 @@ func (h *Hub) Run() {
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				// Remove from all subscriptions
-				for mailboxID, subscribers := range h.subscriptions {
-					delete(subscribers, client)
-					if len(subscribers) == 0 {
-						delete(h.subscriptions, mailboxID)
-					}
-				}
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
 			if h.logger != nil {
 				h.logger.Debug("client unregistered")
@@ -119,39 +224,58 @@ func (h *Hub) Run() {
 
 		case req := <-h.subscribe:
 			h.mu.Lock()
-			if h.subscriptions[req.mailboxID] == nil {
-				h.subscriptions[req.mailboxID] = make(map[*Client]bool)
+			if req.client.closed {
+				// Dropped after an overflow, the client is reconnecting
+				h.mu.Unlock()
+				continue
+			}
+			if req.domainID != 0 {
+				addSubscriber(h.domainSubscriptions, req.domainID, req.client)
+			} else {
+				addSubscriber(h.subscriptions, req.mailboxID, req.client)
+			}
+			if req.sinceEventID != "" {
+				h.replay(req)
 			}
-			h.subscriptions[req.mailboxID][req.client] = true
 			h.mu.Unlock()
 			if h.logger != nil {
-				h.logger.Debug("client subscribed to mailbox", slog.Uint64("mailbox_id", uint64(req.mailboxID)))
+				h.logger.Debug("client subscribed",
+					slog.Uint64("mailbox_id", uint64(req.mailboxID)),
+					slog.Uint64("domain_id", uint64(req.domainID)))
 			}
 
 		case req := <-h.unsubscribeMailbox:
 			h.mu.Lock()
-			if subscribers, ok := h.subscriptions[req.mailboxID]; ok {
-				delete(subscribers, req.client)
-				if len(subscribers) == 0 {
-					delete(h.subscriptions, req.mailboxID)
-				}
+			if req.domainID != 0 {
+				removeSubscriber(h.domainSubscriptions, req.domainID, req.client)
+			} else {
+				removeSubscriber(h.subscriptions, req.mailboxID, req.client)
 			}
 			h.mu.Unlock()
 			if h.logger != nil {
-				h.logger.Debug("client unsubscribed from mailbox", slog.Uint64("mailbox_id", uint64(req.mailboxID)))
+				h.logger.Debug("client unsubscribed",
+					slog.Uint64("mailbox_id", uint64(req.mailboxID)),
+					slog.Uint64("domain_id", uint64(req.domainID)))
 			}
 
 		case msg := <-h.broadcast:
-			h.mu.RLock()
-			subscribers := h.subscriptions[msg.mailboxID]
-			for client := range subscribers {
-				select {
-				case client.send <- msg.message:
-				default:
-					// Client buffer full, skip
+			h.mu.Lock()
+			event := h.record(msg)
+			if event != nil {
+				h.deliver(event)
+				subscribers := h.subscriptions[msg.mailboxID]
+				for client := range subscribers {
+					h.sendEvent(client, event)
+				}
+				for client := range h.domainSubscriptions[msg.domainID] {
+					if subscribers[client] {
+						// Already sent as a mailbox subscriber
+						continue
+					}
+					h.sendEvent(client, event)
 				}
 			}
-			h.mu.RUnlock()
+			h.mu.Unlock()
 		}
 	}
 }
@@ -168,7 +292,13 @@ func (h *Hub) Unregister(client *Client) {
 
 // Subscribe subscribes a client to a mailbox
 func (h *Hub) Subscribe(client *Client, mailboxID uint) {
-	h.subscribe <- &subscriptionRequest{client: client, mailboxID: mailboxID}
+	h.SubscribeSince(client, mailboxID, "")
+}
+
+// SubscribeSince subscribes a client to a mailbox and first sends it the events
+// of the mailbox after sinceEventID, or a reset frame when they are not known
+func (h *Hub) SubscribeSince(client *Client, mailboxID uint, sinceEventID string) {
+	h.subscribe <- &subscriptionRequest{client: client, mailboxID: mailboxID, sinceEventID: sinceEventID}
 }
 
 // Unsubscribe unsubscribes a client from a mailbox
@@ -176,15 +306,51 @@ func (h *Hub) Unsubscribe(client *Client, mailboxID uint) {
 	h.unsubscribeMailbox <- &subscriptionRequest{client: client, mailboxID: mailboxID}
 }
 
+// SubscribeDomain subscribes a client to a domain and all of its mailboxes
+func (h *Hub) SubscribeDomain(client *Client, domainID uint) {
+	h.SubscribeDomainSince(client, domainID, "")
+}
+
+// SubscribeDomainSince subscribes a client to a domain and replays the events
+// after sinceEventID, see SubscribeSince
+func (h *Hub) SubscribeDomainSince(client *Client, domainID uint, sinceEventID string) {
+	h.subscribe <- &subscriptionRequest{client: client, domainID: domainID, sinceEventID: sinceEventID}
+}
+
+// UnsubscribeDomain unsubscribes a client from a domain
+func (h *Hub) UnsubscribeDomain(client *Client, domainID uint) {
+	h.unsubscribeMailbox <- &subscriptionRequest{client: client, domainID: domainID}
+}
+
+// SetDomainResolver sets how the hub finds the domain of mailbox events for
+// domain subscribers. Call it before the hub is used.
+func (h *Hub) SetDomainResolver(resolve DomainResolver) {
+	h.resolveDomain = resolve
+}
+
+// SetBackend sets the backend that carries events between the hubs of several
+// instances. Call it before the hub is used.
+func (h *Hub) SetBackend(backend Backend) {
+	h.backend = backend
+}
+
 // BroadcastNewMessage broadcasts a new message notification to mailbox subscribers
 func (h *Hub) BroadcastNewMessage(mailboxID uint, payload *NewMessagePayload) {
-	msg := WSMessage{
-		Type:      MessageTypeNewMessage,
-		MailboxID: mailboxID,
-		Message:   payload,
-	}
+	h.publish(MessageTypeNewMessage, mailboxID, 0, payload)
+}
 
-	data, err := json.Marshal(msg)
+// BroadcastMessagesUpdated broadcasts a bulk update summary to mailbox subscribers
+func (h *Hub) BroadcastMessagesUpdated(mailboxID uint, payload *MessagesUpdatedPayload) {
+	h.publish(MessageTypeMessagesUpdated, mailboxID, 0, payload)
+}
+
+// publish sends an event to the subscribers of its mailbox and of its domain. The
+// domain of a mailbox event is looked up when domainID is 0.
+func (h *Hub) publish(messageType MessageType, mailboxID, domainID uint, payload interface{}) {
+	if domainID == 0 && mailboxID != 0 {
+		domainID = h.mailboxDomain(mailboxID)
+	}
+	data, err := json.Marshal(payload)
 	if err != nil {
 		if h.logger != nil {
 			h.logger.Error("failed to marshal broadcast message", slog.Any("error", err))
@@ -192,8 +358,217 @@ func (h *Hub) BroadcastNewMessage(mailboxID uint, payload *NewMessagePayload) {
 		return
 	}
 
+	msg := &broadcastMessage{
+		mailboxID:   mailboxID,
+		domainID:    domainID,
+		messageType: messageType,
+		payload:     data,
+	}
+	h.broadcast <- msg
+	if h.backend != nil {
+		h.enqueueOutbound(msg)
+	}
+}
+
+// enqueueOutbound queues a broadcast for the other instances without waiting
+// for the backend. When the backend is too slow to keep up, the broadcast is
+// dropped for the other instances; clients there see the change on reload.
+func (h *Hub) enqueueOutbound(msg *broadcastMessage) {
+	select {
+	case h.outbound <- msg:
+	default:
+		if h.logger != nil {
+			h.logger.Warn("event backend is falling behind, event not sent to other instances",
+				slog.String("type", string(msg.messageType)))
+		}
+	}
+}
+
+// drainOutbound publishes the queued broadcasts of this hub to the backend
+func (h *Hub) drainOutbound() {
+	for msg := range h.outbound {
+		h.forward(msg)
+	}
+}
+
+// forward publishes a broadcast of this hub to the other instances
+func (h *Hub) forward(msg *broadcastMessage) {
+	data, err := json.Marshal(backendEvent{
+		Origin:    h.origin,
+		Type:      msg.messageType,
+		MailboxID: msg.mailboxID,
+		DomainID:  msg.domainID,
+		Payload:   msg.payload,
+	})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backendPublishWait)
+	defer cancel()
+	if err := h.backend.Publish(ctx, data); err != nil && h.logger != nil {
+		h.logger.Error("failed to publish event to other instances",
+			slog.String("type", string(msg.messageType)),
+			slog.Any("error", err))
+	}
+}
+
+// listen broadcasts the events of other instances, listening again whenever
+// the backend fails
+func (h *Hub) listen() {
+	for {
+		err := h.backend.Listen(context.Background(), h.receive)
+		if h.logger != nil {
+			h.logger.Error("event backend failed, events of other instances are missed until it recovers",
+				slog.Any("error", err))
+		}
+		time.Sleep(backendRetryWait)
+	}
+}
+
+// receive broadcasts an event of another instance
+func (h *Hub) receive(data []byte) {
+	var event backendEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		if h.logger != nil {
+			h.logger.Warn("invalid event from backend", slog.Any("error", err))
+		}
+		return
+	}
+	if event.Origin == h.origin {
+		// Already broadcast when it was published
+		return
+	}
+
 	h.broadcast <- &broadcastMessage{
-		mailboxID: mailboxID,
-		message:   data,
+		mailboxID:   event.MailboxID,
+		domainID:    event.DomainID,
+		messageType: event.Type,
+		payload:     event.Payload,
+	}
+}
+
+// mailboxDomain returns the domain of a mailbox, or 0 when it is unknown.
+// Mailboxes never change domain, so answers are cached.
+func (h *Hub) mailboxDomain(mailboxID uint) uint {
+	if h.resolveDomain == nil {
+		return 0
+	}
+
+	h.domainsMu.Lock()
+	domainID, ok := h.domains[mailboxID]
+	h.domainsMu.Unlock()
+	if ok {
+		return domainID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveDomainWait)
+	defer cancel()
+	domainID, err := h.resolveDomain(ctx, mailboxID)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Debug("failed to resolve mailbox domain",
+				slog.Uint64("mailbox_id", uint64(mailboxID)),
+				slog.Any("error", err))
+		}
+		return 0
+	}
+
+	h.domainsMu.Lock()
+	if len(h.domains) >= maxCachedDomains {
+		h.domains = make(map[uint]uint)
+	}
+	h.domains[mailboxID] = domainID
+	h.domainsMu.Unlock()
+	return domainID
+}
+
+// sendEvent queues an event for a client. A client that cannot take it is sent
+// an overflow frame and dropped. The caller holds mu.
+func (h *Hub) sendEvent(client *Client, event *Event) {
+	if client.closed {
+		return
+	}
+	if !client.queue(event.Data) {
+		h.overflow(client)
+		return
+	}
+	client.lastEventID = event.ID
+}
+
+// replay sends a resumed subscription the events it missed. The caller holds mu.
+func (h *Hub) replay(req *subscriptionRequest) {
+	missed, ok := h.since(req.sinceEventID, req.mailboxID, req.domainID)
+	if !ok {
+		h.sendFrame(req.client, WSMessage{Type: MessageTypeReset, MailboxID: req.mailboxID, DomainID: req.domainID})
+		return
+	}
+	for _, event := range missed {
+		h.sendEvent(req.client, event)
+	}
+}
+
+// overflow sends a client its last frame, naming the last event it received,
+// and drops it; the client reconnects and resumes from that event. The caller
+// holds mu.
+func (h *Hub) overflow(client *Client) {
+	// queue keeps the last slot of the buffer free for this frame
+	data, err := json.Marshal(WSMessage{
+		Type:    MessageTypeOverflow,
+		Message: &OverflowPayload{LastEventID: client.lastEventID},
+	})
+	if err == nil {
+		client.send <- data
+	}
+	if h.logger != nil {
+		h.logger.Warn("websocket client fell behind, dropping it",
+			slog.String("last_event_id", client.lastEventID))
+	}
+	h.removeClient(client)
+}
+
+// sendFrame queues a frame that is not an event for a client. The caller holds mu.
+func (h *Hub) sendFrame(client *Client, msg WSMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil || client.closed {
+		return
+	}
+	if !client.queue(data) {
+		h.overflow(client)
+	}
+}
+
+// removeClient unregisters a client, removes its subscriptions and closes its
+// send channel. The caller holds mu.
+func (h *Hub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	client.closed = true
+	close(client.send)
+	for mailboxID := range h.subscriptions {
+		removeSubscriber(h.subscriptions, mailboxID, client)
+	}
+	for domainID := range h.domainSubscriptions {
+		removeSubscriber(h.domainSubscriptions, domainID, client)
+	}
+}
+
+// addSubscriber adds a client to the subscribers of a mailbox or domain
+func addSubscriber(subscriptions map[uint]map[*Client]bool, id uint, client *Client) {
+	if subscriptions[id] == nil {
+		subscriptions[id] = make(map[*Client]bool)
+	}
+	subscriptions[id][client] = true
+}
+
+// removeSubscriber removes a client from the subscribers of a mailbox or domain
+func removeSubscriber(subscriptions map[uint]map[*Client]bool, id uint, client *Client) {
+	if subscribers, ok := subscriptions[id]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(subscriptions, id)
+		}
 	}
 }
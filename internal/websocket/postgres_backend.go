@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultNotifyChannel is the Postgres channel of hub events
+	DefaultNotifyChannel = "infinimail_events"
+
+	// maxNotifyPayload keeps notifications under the 8000 byte limit of Postgres;
+	// larger events are stored and passed by reference
+	maxNotifyPayload = 7000
+
+	// payloadRetention is how long stored events are kept for the listeners
+	payloadRetention = 5 * time.Minute
+
+	// payloadRefPrefix marks notifications that carry an event_payloads ID;
+	// events themselves are JSON objects
+	payloadRefPrefix = "ref:"
+)
+
+// PostgresBackend carries hub events between instances with Postgres
+// LISTEN/NOTIFY
+type PostgresBackend struct {
+	db          *gorm.DB
+	databaseURL string
+	channel     string
+}
+
+// NewPostgresBackend creates a backend that notifies through db and listens on
+// a dedicated connection to databaseURL
+func NewPostgresBackend(db *gorm.DB, databaseURL, channel string) *PostgresBackend {
+	if channel == "" {
+		channel = DefaultNotifyChannel
+	}
+	return &PostgresBackend{db: db, databaseURL: databaseURL, channel: channel}
+}
+
+// Publish implements Backend
+func (b *PostgresBackend) Publish(ctx context.Context, data []byte) error {
+	payload := string(data)
+	if len(data) > maxNotifyPayload {
+		stored := &models.EventPayload{Data: data}
+		if err := b.db.WithContext(ctx).Create(stored).Error; err != nil {
+			return fmt.Errorf("failed to store event payload: %w", err)
+		}
+		payload = payloadRefPrefix + strconv.FormatUint(uint64(stored.ID), 10)
+
+		// Listeners read a payload as soon as they are notified
+		if err := b.db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-payloadRetention)).
+			Delete(&models.EventPayload{}).Error; err != nil {
+			return fmt.Errorf("failed to remove old event payloads: %w", err)
+		}
+	}
+
+	if err := b.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", b.channel, payload).Error; err != nil {
+		return fmt.Errorf("failed to notify: %w", err)
+	}
+	return nil
+}
+
+// Listen implements Backend. Events published while the connection is down are
+// not received.
+func (b *PostgresBackend) Listen(ctx context.Context, receive func(data []byte)) error {
+	conn, err := pgx.Connect(ctx, b.databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect listener: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to wait for notification: %w", err)
+		}
+
+		ref, byReference := strings.CutPrefix(notification.Payload, payloadRefPrefix)
+		if !byReference {
+			receive([]byte(notification.Payload))
+			continue
+		}
+		id, err := strconv.ParseUint(ref, 10, 64)
+		if err != nil {
+			continue
+		}
+		var stored models.EventPayload
+		if err := b.db.WithContext(ctx).First(&stored, id).Error; err != nil {
+			// Removed already, or the database failed; the event is lost
+			continue
+		}
+		receive(stored.Data)
+	}
+}
@@ -0,0 +1,111 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFrame waits for the next frame queued for a client
+func readFrame(t *testing.T, client *Client) WSMessage {
+	t.Helper()
+	select {
+	case data, ok := <-client.send:
+		require.True(t, ok, "send channel closed")
+		var msg WSMessage
+		require.NoError(t, json.Unmarshal(data, &msg))
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+		return WSMessage{}
+	}
+}
+
+func TestHub_FramesCarryEventIDs(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+	client := NewClient(hub, nil, nil)
+	hub.Register(client)
+	hub.Subscribe(client, 1)
+
+	hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 10})
+	hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 11})
+
+	first := readFrame(t, client)
+	second := readFrame(t, client)
+	assert.Equal(t, hub.epoch+"-1", first.EventID)
+	assert.Equal(t, hub.epoch+"-2", second.EventID)
+}
+
+func TestHub_SubscribeSinceReplaysMissedEvents(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+	all, _, _ := hub.OpenStream(0, "")
+	defer hub.CloseStream(all)
+
+	hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 10})
+	hub.BroadcastNewMessage(2, &NewMessagePayload{ID: 11})
+	hub.BroadcastMessageRead(1, &MessageReadPayload{ID: 10, IsRead: true})
+	first := receive(t, all)
+	receive(t, all)
+	last := receive(t, all)
+
+	client := NewClient(hub, nil, nil)
+	hub.Register(client)
+	hub.SubscribeSince(client, 1, first.ID)
+
+	frame := readFrame(t, client)
+	assert.Equal(t, MessageTypeMessageRead, frame.Type)
+	assert.Equal(t, last.ID, frame.EventID)
+	assert.Empty(t, client.send)
+}
+
+func TestHub_SubscribeSinceUnknownEventSendsReset(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+	client := NewClient(hub, nil, nil)
+	hub.Register(client)
+
+	hub.SubscribeDomainSince(client, 5, "previous-3")
+
+	frame := readFrame(t, client)
+	assert.Equal(t, MessageTypeReset, frame.Type)
+	assert.Equal(t, uint(5), frame.DomainID)
+}
+
+func TestHub_OverflowDropsClient(t *testing.T) {
+	hub := NewHub(nil)
+	client := NewClient(hub, nil, nil)
+	hub.clients[client] = true
+	addSubscriber(hub.subscriptions, 1, client)
+
+	hub.mu.Lock()
+	var last *Event
+	for i := 0; i < cap(client.send); i++ {
+		event := hub.record(&broadcastMessage{mailboxID: 1, messageType: MessageTypeNewMessage, payload: []byte(`{}`)})
+		if i == cap(client.send)-2 {
+			last = event
+		}
+		hub.sendEvent(client, event)
+	}
+	hub.mu.Unlock()
+
+	var frames []WSMessage
+	for data := range client.send {
+		var msg WSMessage
+		require.NoError(t, json.Unmarshal(data, &msg))
+		frames = append(frames, msg)
+	}
+	require.Len(t, frames, cap(client.send))
+	overflow := frames[len(frames)-1]
+	assert.Equal(t, MessageTypeOverflow, overflow.Type)
+	assert.Equal(t, map[string]interface{}{"last_event_id": last.ID}, overflow.Message)
+	assert.Empty(t, hub.clients)
+	assert.Empty(t, hub.subscriptions)
+
+	// Errors for a dropped client are discarded instead of panicking
+	client.sendError(ErrorCodeInvalidMessage, nil, "too late")
+}
@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// streamBufferSize is how many events a stream can fall behind before the hub
+// closes it
+const streamBufferSize = 256
+
+// Event is a broadcast as delivered to streams. Data is the JSON frame sent to
+// WebSocket clients.
+type Event struct {
+	ID        string
+	Type      MessageType
+	MailboxID uint
+	DomainID  uint
+	Data      []byte
+
+	seq uint64
+}
+
+// Stream receives the events of one mailbox, of one domain and its mailboxes, or
+// of everything. The hub closes the channel when the stream falls too far behind;
+// the reader should reconnect and resume from the last event it saw.
+type Stream struct {
+	mailboxID uint
+	domainID  uint
+	events    chan *Event
+}
+
+// Events returns the channel the events of the stream are delivered on
+func (s *Stream) Events() <-chan *Event {
+	return s.events
+}
+
+// matches reports whether the stream receives an event
+func (s *Stream) matches(event *Event) bool {
+	switch {
+	case s.domainID != 0:
+		return s.domainID == event.DomainID
+	case s.mailboxID != 0:
+		return s.mailboxID == event.MailboxID
+	default:
+		return true
+	}
+}
+
+// OpenStream registers a stream for a mailbox (0 = every event) and returns the
+// events after lastEventID that it missed. resumed is false when lastEventID is
+// set but the events after it are no longer known, either because they fell out
+// of the history or because the hub restarted; the reader should then reload.
+func (h *Hub) OpenStream(mailboxID uint, lastEventID string) (stream *Stream, missed []*Event, resumed bool) {
+	return h.openStream(&Stream{mailboxID: mailboxID}, lastEventID)
+}
+
+// OpenDomainStream registers a stream for the events of a domain and of all its
+// mailboxes, see OpenStream
+func (h *Hub) OpenDomainStream(domainID uint, lastEventID string) (stream *Stream, missed []*Event, resumed bool) {
+	return h.openStream(&Stream{domainID: domainID}, lastEventID)
+}
+
+func (h *Hub) openStream(stream *Stream, lastEventID string) (*Stream, []*Event, bool) {
+	stream.events = make(chan *Event, streamBufferSize)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams[stream] = true
+
+	missed, resumed := h.since(lastEventID, stream.mailboxID, stream.domainID)
+	return stream, missed, resumed
+}
+
+// since returns the events of a mailbox, a domain or of everything after
+// lastEventID, or false when they are no longer known. The caller holds mu.
+func (h *Hub) since(lastEventID string, mailboxID, domainID uint) ([]*Event, bool) {
+	if lastEventID == "" {
+		return nil, true
+	}
+	seq, ok := h.parseEventID(lastEventID)
+	if !ok || seq > h.seq {
+		return nil, false
+	}
+	switch {
+	case domainID != 0:
+		return h.domainHistory.since(domainID, seq)
+	case mailboxID != 0:
+		return h.mailboxHistory.since(mailboxID, seq)
+	default:
+		return h.globalHistory.since(0, seq)
+	}
+}
+
+// CloseStream unregisters a stream and closes its channel
+func (h *Hub) CloseStream(stream *Stream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams[stream] {
+		delete(h.streams, stream)
+		close(stream.events)
+	}
+}
+
+// record numbers a broadcast and adds it to the histories. The caller holds mu.
+func (h *Hub) record(msg *broadcastMessage) *Event {
+	id := h.epoch + "-" + strconv.FormatUint(h.seq+1, 10)
+	data, err := json.Marshal(WSMessage{
+		Type:      msg.messageType,
+		MailboxID: msg.mailboxID,
+		DomainID:  msg.domainID,
+		Message:   msg.payload,
+		EventID:   id,
+	})
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Error("failed to marshal broadcast message", slog.Any("error", err))
+		}
+		return nil
+	}
+
+	h.seq++
+	event := &Event{
+		ID:        id,
+		Type:      msg.messageType,
+		MailboxID: msg.mailboxID,
+		DomainID:  msg.domainID,
+		Data:      data,
+		seq:       h.seq,
+	}
+	h.globalHistory.add(0, event)
+	if event.MailboxID != 0 {
+		h.mailboxHistory.add(event.MailboxID, event)
+	}
+	if event.DomainID != 0 {
+		h.domainHistory.add(event.DomainID, event)
+	}
+	return event
+}
+
+// deliver sends an event to the matching streams, closing the ones that are full.
+// The caller holds mu.
+func (h *Hub) deliver(event *Event) {
+	for stream := range h.streams {
+		if !stream.matches(event) {
+			continue
+		}
+		select {
+		case stream.events <- event:
+		default:
+			delete(h.streams, stream)
+			close(stream.events)
+		}
+	}
+}
+
+// parseEventID returns the sequence number of an event ID issued by this hub
+func (h *Hub) parseEventID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive waits for the next event of a stream
+func receive(t *testing.T, stream *Stream) *Event {
+	t.Helper()
+	select {
+	case event, ok := <-stream.Events():
+		require.True(t, ok, "stream closed")
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestStream_ReceivesMailboxEvents(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+	stream, missed, resumed := hub.OpenStream(1, "")
+	defer hub.CloseStream(stream)
+
+	hub.BroadcastNewMessage(2, &NewMessagePayload{ID: 10})
+	hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 11})
+
+	assert.Empty(t, missed)
+	assert.True(t, resumed)
+	event := receive(t, stream)
+	assert.Equal(t, MessageTypeNewMessage, event.Type)
+	assert.Equal(t, uint(1), event.MailboxID)
+	assert.Contains(t, string(event.Data), `"id":11`)
+	assert.Contains(t, event.ID, hub.epoch+"-")
+}
+
+func TestStream_ResumesFromLastEventID(t *testing.T) {
+	hub := NewHub(nil)
+	go hub.Run()
+	all, _, _ := hub.OpenStream(0, "")
+	defer hub.CloseStream(all)
+
+	hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 10})
+	hub.BroadcastMessagesUpdated(2, &MessagesUpdatedPayload{Action: "delete", Count: 3})
+	hub.BroadcastNewMessage(1, &NewMessagePayload{ID: 11})
+	first := receive(t, all)
+	receive(t, all)
+	last := receive(t, all)
+
+	stream, missed, resumed := hub.OpenStream(1, first.ID)
+	defer hub.CloseStream(stream)
+
+	assert.True(t, resumed)
+	require.Len(t, missed, 1)
+	assert.Equal(t, last.ID, missed[0].ID)
+
+	stream, missed, resumed = hub.OpenStream(0, first.ID)
+	defer hub.CloseStream(stream)
+
+	assert.True(t, resumed)
+	require.Len(t, missed, 2)
+	assert.Equal(t, MessageTypeMessagesUpdated, missed[0].Type)
+}
+
+func TestStream_CannotResume(t *testing.T) {
+	hub := NewHub(nil)
+	hub.mu.Lock()
+	for i := 0; i < mailboxHistorySize+2; i++ {
+		hub.record(&broadcastMessage{mailboxID: 1, messageType: MessageTypeNewMessage, payload: []byte(`{}`)})
+	}
+	hub.mu.Unlock()
+
+	tests := []struct {
+		name        string
+		lastEventID string
+	}{
+		{"older than history", hub.epoch + "-1"},
+		{"before restart", "previous-3"},
+		{"not issued yet", hub.epoch + "-999999"},
+		{"malformed", "abc"},
+	}
+	for _, tt := range tests {
+		stream, missed, resumed := hub.OpenStream(1, tt.lastEventID)
+		hub.CloseStream(stream)
+
+		assert.False(t, resumed, tt.name)
+		assert.Empty(t, missed, tt.name)
+	}
+
+	// The oldest kept event can still be resumed from the one before it
+	stream, missed, resumed := hub.OpenStream(1, hub.epoch+"-2")
+	hub.CloseStream(stream)
+	assert.True(t, resumed)
+	assert.Len(t, missed, mailboxHistorySize)
+}
+
+func TestStream_BusyMailboxKeepsOthersResumable(t *testing.T) {
+	hub := NewHub(nil)
+	hub.mu.Lock()
+	quiet := hub.record(&broadcastMessage{mailboxID: 1, domainID: 5, messageType: MessageTypeNewMessage, payload: []byte(`{}`)})
+	hub.record(&broadcastMessage{mailboxID: 1, domainID: 5, messageType: MessageTypeMessageRead, payload: []byte(`{}`)})
+	for i := 0; i < globalHistorySize+1; i++ {
+		hub.record(&broadcastMessage{mailboxID: 2, domainID: 6, messageType: MessageTypeNewMessage, payload: []byte(`{}`)})
+	}
+	hub.mu.Unlock()
+
+	mailbox, missed, resumed := hub.OpenStream(1, quiet.ID)
+	hub.CloseStream(mailbox)
+	assert.True(t, resumed)
+	require.Len(t, missed, 1)
+	assert.Equal(t, MessageTypeMessageRead, missed[0].Type)
+
+	domain, missed, resumed := hub.OpenDomainStream(5, quiet.ID)
+	hub.CloseStream(domain)
+	assert.True(t, resumed)
+	assert.Len(t, missed, 1)
+
+	// The stream of everything shares one ring with the busy mailbox
+	all, _, resumed := hub.OpenStream(0, quiet.ID)
+	hub.CloseStream(all)
+	assert.False(t, resumed)
+}
+
+func TestStream_ClosedWhenFull(t *testing.T) {
+	hub := NewHub(nil)
+	stream, _, _ := hub.OpenStream(1, "")
+
+	hub.mu.Lock()
+	for i := 0; i < streamBufferSize+1; i++ {
+		hub.deliver(hub.record(&broadcastMessage{mailboxID: 1, messageType: MessageTypeNewMessage, payload: []byte(`{}`)}))
+	}
+	hub.mu.Unlock()
+
+	received := 0
+	for range stream.Events() {
+		received++
+	}
+	assert.Equal(t, streamBufferSize, received)
+	assert.Empty(t, hub.streams)
+
+	// Closing a dropped stream is a no-op
+	hub.CloseStream(stream)
+}
+
+func TestStream_DomainReceivesDomainAndMailboxEvents(t *testing.T) {
+	hub := NewHub(nil)
+	lookups := 0
+	hub.SetDomainResolver(func(_ context.Context, mailboxID uint) (uint, error) {
+		lookups++
+		return map[uint]uint{1: 5, 2: 6}[mailboxID], nil
+	})
+	go hub.Run()
+	stream, _, _ := hub.OpenDomainStream(5, "")
+	defer hub.CloseStream(stream)
+
+	hub.BroadcastNewMessage(2, &NewMessagePayload{ID: 10})
+	hub.BroadcastMessageRead(1, &MessageReadPayload{ID: 11, IsRead: true})
+	hub.BroadcastDomainStatusChanged(&DomainStatusPayload{ID: 6, Status: "active"})
+	hub.BroadcastMessageDeleted(1, &MessageDeletedPayload{ID: 11})
+	hub.BroadcastDomainStatusChanged(&DomainStatusPayload{ID: 5, PreviousStatus: "pending_dns", Status: "active"})
+
+	event := receive(t, stream)
+	assert.Equal(t, MessageTypeMessageRead, event.Type)
+	assert.Equal(t, uint(5), event.DomainID)
+	assert.Contains(t, string(event.Data), `"domain_id":5`)
+	assert.Equal(t, MessageTypeMessageDeleted, receive(t, stream).Type)
+	event = receive(t, stream)
+	assert.Equal(t, MessageTypeDomainStatusChanged, event.Type)
+	assert.Contains(t, string(event.Data), `"previous_status":"pending_dns"`)
+	// The domain of mailbox 1 is looked up once
+	assert.Equal(t, 2, lookups)
+}
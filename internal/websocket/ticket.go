@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTicketTTL is how long a ticket can be used to open a connection
+const DefaultTicketTTL = time.Minute
+
+var (
+	// ErrInvalidTicket is returned for tickets that were not issued by the issuer
+	ErrInvalidTicket = errors.New("invalid ticket")
+	// ErrTicketExpired is returned for tickets past their expiry
+	ErrTicketExpired = errors.New("ticket expired")
+	// ErrTicketUsed is returned for tickets that already opened a connection
+	ErrTicketUsed = errors.New("ticket already used")
+)
+
+// Ticket authorizes one WebSocket upgrade for browsers, which cannot send an
+// API key header with the handshake
+type Ticket struct {
+	// MailboxIDs limits the mailboxes the connection can subscribe to; empty
+	// allows every mailbox
+	MailboxIDs []uint
+	// TenantID limits the connection to the mailboxes and domains of a
+	// tenant; nil for tickets issued with a super-admin key
+	TenantID  *uint
+	ExpiresAt time.Time
+}
+
+// ticketPayload is the signed part of a ticket
+type ticketPayload struct {
+	MailboxIDs []uint `json:"m,omitempty"`
+	TenantID   *uint  `json:"t,omitempty"`
+	Expiry     int64  `json:"e"`
+	// Nonce tells tickets with the same contents apart, so each is used once
+	Nonce string `json:"n"`
+}
+
+// Allows reports whether the ticket covers a mailbox
+func (t *Ticket) Allows(mailboxID uint) bool {
+	if len(t.MailboxIDs) == 0 {
+		return true
+	}
+	for _, id := range t.MailboxIDs {
+		if id == mailboxID {
+			return true
+		}
+	}
+	return false
+}
+
+// TicketIssuer signs and verifies short-lived tickets. A ticket is accepted
+// once per instance: the nonces of used tickets are kept until they expire.
+type TicketIssuer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewTicketIssuer creates a TicketIssuer; a ttl of 0 uses DefaultTicketTTL
+func NewTicketIssuer(secret []byte, ttl time.Duration) (*TicketIssuer, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("ticket secret is required")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTicketTTL
+	}
+	return &TicketIssuer{secret: secret, ttl: ttl, now: time.Now, used: make(map[string]time.Time)}, nil
+}
+
+// Issue returns a ticket for the given mailboxes (none = every mailbox)
+func (i *TicketIssuer) Issue(mailboxIDs []uint) (string, time.Time) {
+	return i.IssueForTenant(nil, mailboxIDs)
+}
+
+// IssueForTenant returns a ticket for the given mailboxes of a tenant (none =
+// every mailbox of the tenant, or every mailbox for a nil tenant)
+func (i *TicketIssuer) IssueForTenant(tenantID *uint, mailboxIDs []uint) (string, time.Time) {
+	expiresAt := i.now().Add(i.ttl).Truncate(time.Second)
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	payload, _ := json.Marshal(ticketPayload{
+		MailboxIDs: mailboxIDs,
+		TenantID:   tenantID,
+		Expiry:     expiresAt.Unix(),
+		Nonce:      base64.RawURLEncoding.EncodeToString(nonce),
+	})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + i.sign(encoded), expiresAt
+}
+
+// Verify checks the signature and expiry of a ticket and uses it up, so a
+// ticket leaked through a URL in a log cannot open another connection
+func (i *TicketIssuer) Verify(ticket string) (*Ticket, error) {
+	encoded, sig, ok := strings.Cut(ticket, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(i.sign(encoded))) {
+		return nil, ErrInvalidTicket
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidTicket
+	}
+	var p ticketPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, ErrInvalidTicket
+	}
+	t := &Ticket{MailboxIDs: p.MailboxIDs, TenantID: p.TenantID, ExpiresAt: time.Unix(p.Expiry, 0)}
+	if !i.now().Before(t.ExpiresAt) {
+		return nil, ErrTicketExpired
+	}
+	if !i.use(p.Nonce, t.ExpiresAt) {
+		return nil, ErrTicketUsed
+	}
+	return t, nil
+}
+
+// use records the nonce of a ticket and reports whether it was unused
+func (i *TicketIssuer) use(nonce string, expiresAt time.Time) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// Expired tickets are refused anyway, so their nonces can go
+	now := i.now()
+	for n, expiry := range i.used {
+		if !now.Before(expiry) {
+			delete(i.used, n)
+		}
+	}
+
+	if _, ok := i.used[nonce]; ok || nonce == "" {
+		return false
+	}
+	i.used[nonce] = expiresAt
+	return true
+}
+
+func (i *TicketIssuer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte("ws-ticket:" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
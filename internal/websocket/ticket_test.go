@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIssuer(t *testing.T) *TicketIssuer {
+	t.Helper()
+	issuer, err := NewTicketIssuer([]byte("test-secret"), time.Minute)
+	require.NoError(t, err)
+	return issuer
+}
+
+func TestNewTicketIssuer_RequiresSecret(t *testing.T) {
+	_, err := NewTicketIssuer(nil, 0)
+	assert.Error(t, err)
+}
+
+func TestTicketIssuer_IssueAndVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	ticket, expiresAt := issuer.Issue([]uint{3, 5})
+	verified, err := issuer.Verify(ticket)
+
+	require.NoError(t, err)
+	assert.Equal(t, []uint{3, 5}, verified.MailboxIDs)
+	assert.True(t, verified.ExpiresAt.Equal(expiresAt))
+	assert.True(t, verified.Allows(5))
+	assert.False(t, verified.Allows(4))
+}
+
+func TestTicketIssuer_UsedOnce(t *testing.T) {
+	issuer := newTestIssuer(t)
+	ticket, _ := issuer.Issue([]uint{3})
+	same, _ := issuer.Issue([]uint{3})
+
+	_, err := issuer.Verify(ticket)
+	require.NoError(t, err)
+	_, err = issuer.Verify(ticket)
+	assert.ErrorIs(t, err, ErrTicketUsed)
+
+	// A second ticket for the same mailboxes is a different ticket
+	assert.NotEqual(t, ticket, same)
+	_, err = issuer.Verify(same)
+	assert.NoError(t, err)
+
+	// Nonces are forgotten once their tickets expire
+	issuer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err = issuer.Verify(ticket)
+	assert.ErrorIs(t, err, ErrTicketExpired)
+	later, _ := issuer.Issue(nil)
+	_, err = issuer.Verify(later)
+	require.NoError(t, err)
+	assert.Len(t, issuer.used, 1)
+}
+
+func TestTicketIssuer_AllMailboxes(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	ticket, _ := issuer.Issue(nil)
+	verified, err := issuer.Verify(ticket)
+
+	require.NoError(t, err)
+	assert.True(t, verified.Allows(42))
+}
+
+func TestTicketIssuer_Tenant(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tenantID := uint(7)
+
+	ticket, _ := issuer.IssueForTenant(&tenantID, nil)
+	verified, err := issuer.Verify(ticket)
+
+	require.NoError(t, err)
+	require.NotNil(t, verified.TenantID)
+	assert.Equal(t, tenantID, *verified.TenantID)
+
+	ticket, _ = issuer.Issue(nil)
+	verified, err = issuer.Verify(ticket)
+
+	require.NoError(t, err)
+	assert.Nil(t, verified.TenantID)
+}
+
+func TestTicketIssuer_Expired(t *testing.T) {
+	issuer := newTestIssuer(t)
+	ticket, _ := issuer.Issue(nil)
+
+	issuer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	_, err := issuer.Verify(ticket)
+
+	assert.ErrorIs(t, err, ErrTicketExpired)
+}
+
+func TestTicketIssuer_RejectsForgedTickets(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other, err := NewTicketIssuer([]byte("other-secret"), time.Minute)
+	require.NoError(t, err)
+
+	ticket, _ := issuer.Issue([]uint{3})
+	payload, sig, _ := strings.Cut(ticket, ".")
+	widened, _ := issuer.Issue(nil)
+	widenedPayload, _, _ := strings.Cut(widened, ".")
+	foreign, _ := other.Issue(nil)
+
+	for _, forged := range []string{"", "abc", payload, payload + ".", widenedPayload + "." + sig, foreign} {
+		_, err := issuer.Verify(forged)
+		assert.ErrorIs(t, err, ErrInvalidTicket, forged)
+	}
+}
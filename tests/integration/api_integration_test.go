@@ -86,7 +86,7 @@ func (s *APIIntegrationTestSuite) SetupSuite() {
 	s.db = db
 
 	// Run migrations
-	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.Attachment{})
+	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{}, &models.MailboxToken{})
 	require.NoError(s.T(), err)
 
 	// Initialize repositories
@@ -74,7 +74,7 @@ func (s *DatabaseIntegrationTestSuite) SetupSuite() {
 	s.db = db
 
 	// Run migrations
-	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.Attachment{})
+	err = db.AutoMigrate(&models.Domain{}, &models.DomainCertificate{}, &models.Mailbox{}, &models.Message{}, &models.MessageChange{}, &models.Attachment{}, &models.MailboxToken{})
 	require.NoError(s.T(), err)
 
 	// Initialize repositories
@@ -0,0 +1,160 @@
+//go:build integration
+
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/websocket"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// EventFanoutTestSuite tests two hubs, as on two API instances, sharing events
+// through one PostgreSQL database
+type EventFanoutTestSuite struct {
+	suite.Suite
+	container testcontainers.Container
+	dsn       string
+	nodeA     *websocket.Hub
+	nodeB     *websocket.Hub
+}
+
+// SetupSuite starts PostgreSQL and two hubs with their own connections
+func (s *EventFanoutTestSuite) SetupSuite() {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:16-alpine",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "test",
+			"POSTGRES_PASSWORD": "test",
+			"POSTGRES_DB":       "infinimail_test",
+		},
+		WaitingFor: wait.ForLog("database system is ready to accept connections").
+			WithOccurrence(2).
+			WithStartupTimeout(60 * time.Second),
+	}
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(s.T(), err)
+	s.container = container
+
+	host, err := container.Host(ctx)
+	require.NoError(s.T(), err)
+	port, err := container.MappedPort(ctx, "5432")
+	require.NoError(s.T(), err)
+	s.dsn = fmt.Sprintf("host=%s port=%s user=test password=test dbname=infinimail_test sslmode=disable",
+		host, port.Port())
+
+	s.nodeA = s.startHub()
+	s.nodeB = s.startHub()
+}
+
+// startHub starts a hub with its own database pool, like a separate instance
+func (s *EventFanoutTestSuite) startHub() *websocket.Hub {
+	db, err := gorm.Open(postgres.Open(s.dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), db.AutoMigrate(&models.EventPayload{}))
+
+	hub := websocket.NewHub(nil)
+	hub.SetBackend(websocket.NewPostgresBackend(db, s.dsn, "fanout_test"))
+	go hub.Run()
+	return hub
+}
+
+// TearDownSuite stops the PostgreSQL container
+func (s *EventFanoutTestSuite) TearDownSuite() {
+	if s.container != nil {
+		s.container.Terminate(context.Background())
+	}
+}
+
+// TestEventFanoutTestSuite runs the test suite
+func TestEventFanoutTestSuite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	suite.Run(t, new(EventFanoutTestSuite))
+}
+
+// receive waits for the next event of a stream
+func (s *EventFanoutTestSuite) receive(stream *websocket.Stream) *websocket.Event {
+	select {
+	case event := <-stream.Events():
+		return event
+	case <-time.After(5 * time.Second):
+		s.FailNow("no event received")
+		return nil
+	}
+}
+
+// waitForListeners broadcasts probes from node A until node B receives one, so
+// tests start once both listeners are connected
+func (s *EventFanoutTestSuite) waitForListeners() {
+	stream, _, _ := s.nodeB.OpenStream(0, "")
+	defer s.nodeB.CloseStream(stream)
+	for i := 0; i < 50; i++ {
+		s.nodeA.BroadcastMessagesUpdated(999, &websocket.MessagesUpdatedPayload{Action: "probe"})
+		select {
+		case <-stream.Events():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	s.FailNow("listeners did not connect")
+}
+
+func (s *EventFanoutTestSuite) TestEventReachesOtherInstance() {
+	s.waitForListeners()
+	stream, _, _ := s.nodeB.OpenStream(1, "")
+	defer s.nodeB.CloseStream(stream)
+
+	s.nodeA.BroadcastNewMessage(1, &websocket.NewMessagePayload{ID: 42, Subject: "Hello"})
+
+	event := s.receive(stream)
+	s.Equal(websocket.MessageTypeNewMessage, event.Type)
+	s.Contains(string(event.Data), `"subject":"Hello"`)
+}
+
+func (s *EventFanoutTestSuite) TestLargeEventIsPassedByReference() {
+	s.waitForListeners()
+	stream, _, _ := s.nodeB.OpenStream(2, "")
+	defer s.nodeB.CloseStream(stream)
+	subject := strings.Repeat("x", 20000)
+
+	s.nodeA.BroadcastNewMessage(2, &websocket.NewMessagePayload{ID: 43, Subject: subject})
+
+	event := s.receive(stream)
+	s.Contains(string(event.Data), subject)
+}
+
+func (s *EventFanoutTestSuite) TestOwnEventsAreDeliveredOnce() {
+	s.waitForListeners()
+	stream, _, _ := s.nodeA.OpenStream(3, "")
+	defer s.nodeA.CloseStream(stream)
+
+	s.nodeA.BroadcastNewMessage(3, &websocket.NewMessagePayload{ID: 44})
+
+	s.receive(stream)
+	select {
+	case event := <-stream.Events():
+		s.Failf("duplicate event", "received %s again", event.Type)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
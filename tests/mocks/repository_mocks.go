@@ -2,9 +2,12 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/welldanyogia/webrana-infinimail-backend/internal/models"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/repository"
+	"github.com/welldanyogia/webrana-infinimail-backend/internal/search"
 )
 
 // MockDomainRepository implements repository.DomainRepository
@@ -118,6 +121,30 @@ func (m *MockMailboxRepository) Delete(ctx context.Context, id uint) error {
 	return args.Error(0)
 }
 
+// ListInactive retrieves mailboxes with no activity since the given time
+func (m *MockMailboxRepository) ListInactive(ctx context.Context, domainID uint, since time.Time, limit int) ([]models.Mailbox, error) {
+	args := m.Called(ctx, domainID, since, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Mailbox), args.Error(1)
+}
+
+// CountInactive counts mailboxes with no activity since the given time
+func (m *MockMailboxRepository) CountInactive(ctx context.Context, domainID uint, since time.Time) (int64, error) {
+	args := m.Called(ctx, domainID, since)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// DeleteByIDs deletes mailboxes and returns the orphaned attachment paths
+func (m *MockMailboxRepository) DeleteByIDs(ctx context.Context, ids []uint) ([]string, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 // MockMessageRepository implements repository.MessageRepository
 type MockMessageRepository struct {
 	mock.Mock
@@ -154,6 +181,15 @@ func (m *MockMessageRepository) ListByMailbox(ctx context.Context, mailboxID uin
 	return args.Get(0).([]models.MessageListItem), args.Get(1).(int64), args.Error(2)
 }
 
+// ListByMailboxWithOptions retrieves filtered and sorted messages for a mailbox
+func (m *MockMessageRepository) ListByMailboxWithOptions(ctx context.Context, mailboxID uint, opts repository.MessageListOptions) ([]models.MessageListItem, int64, error) {
+	args := m.Called(ctx, mailboxID, opts)
+	if args.Get(0) == nil {
+		return nil, args.Get(1).(int64), args.Error(2)
+	}
+	return args.Get(0).([]models.MessageListItem), args.Get(1).(int64), args.Error(2)
+}
+
 // MarkAsRead marks a message as read
 func (m *MockMessageRepository) MarkAsRead(ctx context.Context, id uint) error {
 	args := m.Called(ctx, id)
@@ -172,6 +208,135 @@ func (m *MockMessageRepository) CountUnread(ctx context.Context, mailboxID uint)
 	return args.Get(0).(int64), args.Error(1)
 }
 
+// ListIDsReceivedBefore returns IDs of messages in a domain received before the given time
+func (m *MockMessageRepository) ListIDsReceivedBefore(ctx context.Context, domainID uint, before time.Time, limit int) ([]uint, error) {
+	args := m.Called(ctx, domainID, before, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uint), args.Error(1)
+}
+
+// CountReceivedBefore counts messages in a domain received before the given time
+func (m *MockMessageRepository) CountReceivedBefore(ctx context.Context, domainID uint, before time.Time) (int64, error) {
+	args := m.Called(ctx, domainID, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// DeleteByIDs deletes messages and returns the orphaned attachment paths
+func (m *MockMessageRepository) DeleteByIDs(ctx context.Context, ids []uint) ([]string, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+// ExistingRawPaths reports which storage paths are referenced as raw sources
+func (m *MockMessageRepository) ExistingRawPaths(ctx context.Context, rawPaths []string) (map[string]bool, error) {
+	args := m.Called(ctx, rawPaths)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
+// ListByMailboxAfterID retrieves a page of full messages of a mailbox
+func (m *MockMessageRepository) ListByMailboxAfterID(ctx context.Context, mailboxID, afterID uint, limit int) ([]models.Message, error) {
+	args := m.Called(ctx, mailboxID, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Message), args.Error(1)
+}
+
+// ListFolderItems retrieves every message of a folder ordered by ID
+func (m *MockMessageRepository) ListFolderItems(ctx context.Context, mailboxID, folderID uint) ([]models.MessageListItem, error) {
+	args := m.Called(ctx, mailboxID, folderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.MessageListItem), args.Error(1)
+}
+
+// SearchIDs returns IDs of messages matching a query within a scope
+func (m *MockMessageRepository) SearchIDs(ctx context.Context, query *search.Query, scope repository.SearchScope, afterID uint, limit int) ([]uint, error) {
+	args := m.Called(ctx, query, scope, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uint), args.Error(1)
+}
+
+// SetReadByIDs sets the read state of messages
+func (m *MockMessageRepository) SetReadByIDs(ctx context.Context, ids []uint, read bool) (int64, error) {
+	args := m.Called(ctx, ids, read)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// SetFlaggedByIDs sets the flagged state of messages
+func (m *MockMessageRepository) SetFlaggedByIDs(ctx context.Context, ids []uint, flagged bool) (int64, error) {
+	args := m.Called(ctx, ids, flagged)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MoveByIDs moves messages to another mailbox
+func (m *MockMessageRepository) MoveByIDs(ctx context.Context, ids []uint, mailboxID uint) (int64, error) {
+	args := m.Called(ctx, ids, mailboxID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MailboxIDsByIDs maps message IDs to mailbox IDs
+func (m *MockMessageRepository) MailboxIDsByIDs(ctx context.Context, ids []uint) (map[uint]uint, error) {
+	args := m.Called(ctx, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[uint]uint), args.Error(1)
+}
+
+// Search finds messages matching a query within a scope
+func (m *MockMessageRepository) Search(ctx context.Context, query *search.Query, scope repository.SearchScope, limit, offset int) ([]models.MessageSearchHit, int64, error) {
+	args := m.Called(ctx, query, scope, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Get(1).(int64), args.Error(2)
+	}
+	return args.Get(0).([]models.MessageSearchHit), args.Get(1).(int64), args.Error(2)
+}
+
+// IndexUnindexed indexes messages missing from the search index
+func (m *MockMessageRepository) IndexUnindexed(ctx context.Context, limit int) (int, error) {
+	args := m.Called(ctx, limit)
+	return args.Int(0), args.Error(1)
+}
+
+// ListEncryptedBodiesAfterID returns stored encrypted message bodies
+func (m *MockMessageRepository) ListEncryptedBodiesAfterID(ctx context.Context, afterID uint, limit int) ([]models.StoredMessageBody, error) {
+	args := m.Called(ctx, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.StoredMessageBody), args.Error(1)
+}
+
+// UpdateStoredBody writes stored message body columns
+func (m *MockMessageRepository) UpdateStoredBody(ctx context.Context, body models.StoredMessageBody) error {
+	args := m.Called(ctx, body)
+	return args.Error(0)
+}
+
+// SetFolderByIDs moves messages to a folder
+func (m *MockMessageRepository) SetFolderByIDs(ctx context.Context, ids []uint, folderID *uint) (int64, error) {
+	args := m.Called(ctx, ids, folderID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// SetFlags sets or clears system flags of a message
+func (m *MockMessageRepository) SetFlags(ctx context.Context, id uint, flags map[string]bool) error {
+	args := m.Called(ctx, id, flags)
+	return args.Error(0)
+}
+
 // MockAttachmentRepository implements repository.AttachmentRepository
 type MockAttachmentRepository struct {
 	mock.Mock
@@ -201,8 +366,317 @@ func (m *MockAttachmentRepository) ListByMessage(ctx context.Context, messageID
 	return args.Get(0).([]models.Attachment), args.Error(1)
 }
 
+// ListByMailbox retrieves the attachments of a mailbox's messages in a date range
+func (m *MockAttachmentRepository) ListByMailbox(ctx context.Context, mailboxID uint, from, to time.Time) ([]models.MailboxAttachment, error) {
+	args := m.Called(ctx, mailboxID, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.MailboxAttachment), args.Error(1)
+}
+
 // Delete deletes an attachment by its ID
 func (m *MockAttachmentRepository) Delete(ctx context.Context, id uint) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
+
+// ListAfterID retrieves a page of attachments ordered by ID
+func (m *MockAttachmentRepository) ListAfterID(ctx context.Context, afterID uint, limit int) ([]models.Attachment, error) {
+	args := m.Called(ctx, afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Attachment), args.Error(1)
+}
+
+// UpdateFilePath points an attachment at a new storage path
+func (m *MockAttachmentRepository) UpdateFilePath(ctx context.Context, id uint, filePath string) error {
+	args := m.Called(ctx, id, filePath)
+	return args.Error(0)
+}
+
+// SetPreviewPath records a generated preview path
+func (m *MockAttachmentRepository) SetPreviewPath(ctx context.Context, id uint, previewPath string) (bool, error) {
+	args := m.Called(ctx, id, previewPath)
+	return args.Bool(0), args.Error(1)
+}
+
+// ExistingFilePaths reports which storage paths are referenced by attachments
+func (m *MockAttachmentRepository) ExistingFilePaths(ctx context.Context, filePaths []string) (map[string]bool, error) {
+	args := m.Called(ctx, filePaths)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]bool), args.Error(1)
+}
+
+// MockFolderRepository implements repository.FolderRepository
+type MockFolderRepository struct {
+	mock.Mock
+}
+
+// EnsureSystemFolders creates missing system folders
+func (m *MockFolderRepository) EnsureSystemFolders(ctx context.Context, mailboxID uint) error {
+	args := m.Called(ctx, mailboxID)
+	return args.Error(0)
+}
+
+// ListByMailbox retrieves the folders of a mailbox
+func (m *MockFolderRepository) ListByMailbox(ctx context.Context, mailboxID uint) ([]models.FolderWithCounts, error) {
+	args := m.Called(ctx, mailboxID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.FolderWithCounts), args.Error(1)
+}
+
+// GetByID retrieves a folder by its ID
+func (m *MockFolderRepository) GetByID(ctx context.Context, id uint) (*models.Folder, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Folder), args.Error(1)
+}
+
+// GetByRole retrieves a system folder of a mailbox
+func (m *MockFolderRepository) GetByRole(ctx context.Context, mailboxID uint, role models.FolderRole) (*models.Folder, error) {
+	args := m.Called(ctx, mailboxID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Folder), args.Error(1)
+}
+
+// Create creates a new folder
+func (m *MockFolderRepository) Create(ctx context.Context, folder *models.Folder) error {
+	args := m.Called(ctx, folder)
+	return args.Error(0)
+}
+
+// Rename changes the name of a folder
+func (m *MockFolderRepository) Rename(ctx context.Context, id uint, name string) error {
+	args := m.Called(ctx, id, name)
+	return args.Error(0)
+}
+
+// Delete deletes a folder
+func (m *MockFolderRepository) Delete(ctx context.Context, id uint) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockLabelRepository implements repository.LabelRepository
+type MockLabelRepository struct {
+	mock.Mock
+}
+
+// Create creates a new label
+func (m *MockLabelRepository) Create(ctx context.Context, label *models.Label) error {
+	args := m.Called(ctx, label)
+	return args.Error(0)
+}
+
+// GetByID retrieves a label by its ID
+func (m *MockLabelRepository) GetByID(ctx context.Context, id uint) (*models.Label, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Label), args.Error(1)
+}
+
+// ListByMailbox retrieves the labels of a mailbox
+func (m *MockLabelRepository) ListByMailbox(ctx context.Context, mailboxID uint) ([]models.Label, error) {
+	args := m.Called(ctx, mailboxID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Label), args.Error(1)
+}
+
+// Update saves a label
+func (m *MockLabelRepository) Update(ctx context.Context, label *models.Label) error {
+	args := m.Called(ctx, label)
+	return args.Error(0)
+}
+
+// Delete deletes a label
+func (m *MockLabelRepository) Delete(ctx context.Context, id uint) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// ListByMessage retrieves the labels of a message
+func (m *MockLabelRepository) ListByMessage(ctx context.Context, messageID uint) ([]models.Label, error) {
+	args := m.Called(ctx, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Label), args.Error(1)
+}
+
+// SetMessageLabels replaces the labels of a message
+func (m *MockLabelRepository) SetMessageLabels(ctx context.Context, messageID uint, labelIDs []uint) error {
+	args := m.Called(ctx, messageID, labelIDs)
+	return args.Error(0)
+}
+
+// MockMessageChangeRepository implements repository.MessageChangeRepository
+type MockMessageChangeRepository struct {
+	mock.Mock
+}
+
+// LatestSeq returns the Seq of the newest change of a mailbox
+func (m *MockMessageChangeRepository) LatestSeq(ctx context.Context, mailboxID uint) (uint, error) {
+	args := m.Called(ctx, mailboxID)
+	return args.Get(0).(uint), args.Error(1)
+}
+
+// OldestSeq returns the Seq of the oldest change of a mailbox still kept
+func (m *MockMessageChangeRepository) OldestSeq(ctx context.Context, mailboxID uint) (uint, error) {
+	args := m.Called(ctx, mailboxID)
+	return args.Get(0).(uint), args.Error(1)
+}
+
+// HasChangesSince reports whether messages of a mailbox changed after sinceSeq
+func (m *MockMessageChangeRepository) HasChangesSince(ctx context.Context, mailboxID, sinceSeq uint) (bool, error) {
+	args := m.Called(ctx, mailboxID, sinceSeq)
+	return args.Bool(0), args.Error(1)
+}
+
+// ListSince returns changes to messages of a mailbox after sinceSeq
+func (m *MockMessageChangeRepository) ListSince(ctx context.Context, mailboxID, sinceSeq uint, limit int) ([]models.MessageChange, error) {
+	args := m.Called(ctx, mailboxID, sinceSeq, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.MessageChange), args.Error(1)
+}
+
+// DeleteBefore removes changes recorded before the given time
+func (m *MockMessageChangeRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MockMailboxTokenRepository implements repository.MailboxTokenRepository
+type MockMailboxTokenRepository struct {
+	mock.Mock
+}
+
+// Create stores a new mailbox token
+func (m *MockMailboxTokenRepository) Create(ctx context.Context, token *models.MailboxToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+// GetByHash retrieves a mailbox token by the hash of its value
+func (m *MockMailboxTokenRepository) GetByHash(ctx context.Context, hash string) (*models.MailboxToken, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.MailboxToken), args.Error(1)
+}
+
+// ListByMailbox retrieves the tokens of a mailbox
+func (m *MockMailboxTokenRepository) ListByMailbox(ctx context.Context, mailboxID uint) ([]models.MailboxToken, error) {
+	args := m.Called(ctx, mailboxID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.MailboxToken), args.Error(1)
+}
+
+// Delete removes a token of a mailbox
+func (m *MockMailboxTokenRepository) Delete(ctx context.Context, mailboxID, id uint) error {
+	args := m.Called(ctx, mailboxID, id)
+	return args.Error(0)
+}
+
+// MockTenantRepository implements repository.TenantRepository
+type MockTenantRepository struct {
+	mock.Mock
+}
+
+// Create stores a new tenant
+func (m *MockTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	args := m.Called(ctx, tenant)
+	return args.Error(0)
+}
+
+// GetByID retrieves a tenant by ID
+func (m *MockTenantRepository) GetByID(ctx context.Context, id uint) (*models.Tenant, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Tenant), args.Error(1)
+}
+
+// List retrieves all tenants
+func (m *MockTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Tenant), args.Error(1)
+}
+
+// Update saves the name and limits of a tenant
+func (m *MockTenantRepository) Update(ctx context.Context, tenant *models.Tenant) error {
+	args := m.Called(ctx, tenant)
+	return args.Error(0)
+}
+
+// Delete removes a tenant
+func (m *MockTenantRepository) Delete(ctx context.Context, id uint) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// Usage counts what a tenant owns
+func (m *MockTenantRepository) Usage(ctx context.Context, id uint) (*models.TenantUsage, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TenantUsage), args.Error(1)
+}
+
+// MockAPIKeyRepository implements repository.APIKeyRepository
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+// Create stores a new API key
+func (m *MockAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+// GetByHash retrieves an API key by the hash of its value
+func (m *MockAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+// ListByTenant retrieves the keys of a tenant, or the super-admin keys for nil
+func (m *MockAPIKeyRepository) ListByTenant(ctx context.Context, tenantID *uint) ([]models.APIKey, error) {
+	args := m.Called(ctx, tenantID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+// Delete removes a key of a tenant, or a super-admin key for nil
+func (m *MockAPIKeyRepository) Delete(ctx context.Context, tenantID *uint, id uint) error {
+	args := m.Called(ctx, tenantID, id)
+	return args.Error(0)
+}
@@ -31,3 +31,14 @@ func (m *MockFileStorage) Delete(filePath string) error {
 	args := m.Called(filePath)
 	return args.Error(0)
 }
+
+// MockSigningFileStorage implements storage.FileStorage and storage.URLSigner
+type MockSigningFileStorage struct {
+	MockFileStorage
+}
+
+// SignedURL returns a presigned download URL
+func (m *MockSigningFileStorage) SignedURL(filePath, downloadName string) (string, error) {
+	args := m.Called(filePath, downloadName)
+	return args.String(0), args.Error(1)
+}